@@ -0,0 +1,214 @@
+// Package admission is a Kubernetes validating admission webhook, which denies
+// the scheduling of data-access workloads (pods, jobs and cron jobs) whose
+// annotations are denied by a policy.
+//
+// The annotation of a workload comes from its labels, and from the labels of
+// its pod template: a label grok.dev/<attribute> declares a value of the
+// attribute, and a label datasets.grok.dev/<dataset> declares a dataset the
+// workload mounts, whose annotation is in the catalog:
+//
+//	metadata:
+//	  labels:
+//	    grok.dev/Purpose: Analytics
+//	    datasets.grok.dev/raw.clicks: "true"
+//
+// A workload without such labels isn't a data-access workload, and is admitted.
+// The webhook is registered with a ValidatingWebhookConfiguration, and is
+// served over TLS by the caller:
+//
+//	http.Handle("/validate", admission.NewWebhook(policy, store))
+package admission
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/ingest"
+)
+
+// Label prefixes of the annotations of workloads
+const (
+	// AttributeLabelPrefix prefixes the labels declaring attribute values
+	AttributeLabelPrefix = "grok.dev/"
+	// DatasetLabelPrefix prefixes the labels declaring mounted datasets
+	DatasetLabelPrefix = "datasets.grok.dev/"
+)
+
+// reviewVersion is the version of the AdmissionReview API
+const reviewVersion = "admission.k8s.io/v1"
+
+// Review is an AdmissionReview, with the fields the webhook uses
+type Review struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Request    *ReviewRequest  `json:"request,omitempty"`
+	Response   *ReviewResponse `json:"response,omitempty"`
+}
+
+// ReviewRequest is the request of an AdmissionReview
+type ReviewRequest struct {
+	UID  string `json:"uid"`
+	Kind struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"kind"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Object    json.RawMessage `json:"object"`
+}
+
+// ReviewResponse is the response of an AdmissionReview
+type ReviewResponse struct {
+	UID     string  `json:"uid"`
+	Allowed bool    `json:"allowed"`
+	Result  *Status `json:"status,omitempty"`
+}
+
+// Status is the reason of a denial
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// metadata is the metadata of an object or a template
+type metadata struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// workload has the labels of pods, of jobs (spec.template) and of cron jobs
+// (spec.jobTemplate)
+type workload struct {
+	Metadata metadata `json:"metadata"`
+	Spec     struct {
+		Template struct {
+			Metadata metadata `json:"metadata"`
+		} `json:"template"`
+		JobTemplate struct {
+			Metadata metadata `json:"metadata"`
+			Spec     struct {
+				Template struct {
+					Metadata metadata `json:"metadata"`
+				} `json:"template"`
+			} `json:"spec"`
+		} `json:"jobTemplate"`
+	} `json:"spec"`
+}
+
+// labels returns the labels of the workload and of its templates
+func (w workload) labels() map[string]string {
+	ls := make(map[string]string)
+	for _, m := range []metadata{w.Metadata, w.Spec.Template.Metadata, w.Spec.JobTemplate.Metadata,
+		w.Spec.JobTemplate.Spec.Template.Metadata} {
+		for k, v := range m.Labels {
+			ls[k] = v
+		}
+	}
+	return ls
+}
+
+// Webhook admits the workloads that comply with a policy
+type Webhook struct {
+	Policy *grok.Policy
+	// Store has the annotations of the datasets
+	Store *ingest.Store
+	// Options are the options of the evaluations, e.g. an audit sink
+	Options []grok.EvalOption
+	// Renderer renders the reasons of denials, a default Renderer when it's nil
+	Renderer *grok.Renderer
+}
+
+// NewWebhook returns a webhook admitting the workloads that comply with the
+// policy, with the annotations of the datasets of the store
+func NewWebhook(p *grok.Policy, s *ingest.Store) *Webhook {
+	return &Webhook{Policy: p, Store: s}
+}
+
+// ServeHTTP serves an AdmissionReview
+func (wh *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var rv Review
+	if err := json.NewDecoder(r.Body).Decode(&rv); err != nil || rv.Request == nil {
+		http.Error(w, "admission: the body should be an AdmissionReview request", http.StatusBadRequest)
+		return
+	}
+	res := &ReviewResponse{UID: rv.Request.UID, Allowed: true}
+	if err := wh.Review(rv.Request); err != nil {
+		res.Allowed = false
+		res.Result = &Status{Code: http.StatusForbidden, Message: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Review{APIVersion: reviewVersion, Kind: "AdmissionReview", Response: res})
+}
+
+// Review returns nil when the workload of the request may be scheduled, and
+// the reason of the denial otherwise
+func (wh *Webhook) Review(req *ReviewRequest) error {
+	var w workload
+	if err := json.Unmarshal(req.Object, &w); err != nil {
+		return errors.New(fmt.Sprintf("admission: %s", err))
+	}
+	an, ok, err := wh.Annotation(w.labels())
+	if err != nil || !ok {
+		return err
+	}
+	d := wh.Policy.Evaluate(an, wh.Options...)
+	if d.Allowed {
+		return nil
+	}
+	what := fmt.Sprintf("%s %s/%s", req.Kind.Kind, req.Namespace, req.Name)
+	if d.Err != nil {
+		return errors.New(fmt.Sprintf("admission: %s: %s", what, d.Err))
+	}
+	r := wh.Renderer
+	if r == nil {
+		r = &grok.Renderer{}
+	}
+	reason, err := r.Render(wh.Policy.Trace(an))
+	if err != nil {
+		return err
+	}
+	return errors.New(fmt.Sprintf("admission: %s: %s", what, reason))
+}
+
+// Annotation returns the annotation declared by labels, the attribute values
+// followed by the annotations of the datasets, in the order of the labels.
+// It returns false when the labels declare nothing.
+func (wh *Webhook) Annotation(labels map[string]string) (grok.Annotation, bool, error) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	known := make(map[string]bool)
+	for _, d := range wh.Store.Datasets() {
+		known[d] = true
+	}
+
+	values, datasets := make(grok.Annotation, 0), make(grok.Annotation, 0)
+	ok := false
+	for _, k := range keys {
+		switch {
+		case strings.HasPrefix(k, AttributeLabelPrefix):
+			an, err := wh.Policy.ParseValue(strings.TrimPrefix(k, AttributeLabelPrefix), labels[k])
+			if err != nil {
+				return nil, false, errors.New(fmt.Sprintf("admission: label %s: %s", k, err))
+			}
+			values = append(values, an...)
+		case strings.HasPrefix(k, DatasetLabelPrefix):
+			d := strings.TrimPrefix(k, DatasetLabelPrefix)
+			if !known[d] {
+				return nil, false, errors.New(fmt.Sprintf("admission: dataset %s isn't in the catalog", d))
+			}
+			datasets = append(datasets, wh.Store.Annotation(d)...)
+		default:
+			continue
+		}
+		ok = true
+	}
+	return append(values, datasets...), ok, nil
+}
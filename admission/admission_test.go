@@ -0,0 +1,83 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/ingest"
+)
+
+func newWebhook(t *testing.T) *Webhook {
+	ls := grok.NewLattices(`[
+		{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } },
+		{ "name": "Purpose", "edges": { "Analytics": [], "Sharing": [] } }
+	]`)
+	p := grok.NewPolicy(ls)
+	if err := p.ParsePolicy("ALLOW DataType TOP Purpose TOP EXCEPT { DENY DataType IPAddress Purpose Sharing }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	s := ingest.NewStore()
+	an, err := p.ParseValue("DataType", "IPAddress")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	s.Add("raw.clicks", "ip", an)
+	return NewWebhook(p, s)
+}
+
+func TestReview(t *testing.T) {
+	wh := newWebhook(t)
+	cases := []struct {
+		kind, object, err string
+	}{
+		{"Pod", `{"metadata": {"labels": {"app": "web"}}}`, ""},
+		{"Pod", `{"metadata": {"labels": {"grok.dev/Purpose": "Analytics", "datasets.grok.dev/raw.clicks": "true"}}}`, ""},
+		{"Job", `{"metadata": {"labels": {"grok.dev/Purpose": "Sharing"}},
+			"spec": {"template": {"metadata": {"labels": {"datasets.grok.dev/raw.clicks": "true"}}}}}`,
+			"admission: Job jobs/export: Denied because the program uses Sharing together with IPAddress, " +
+				"which the exception to the global allow forbids."},
+		{"CronJob", `{"spec": {"jobTemplate": {"spec": {"template": {"metadata": {"labels": {"datasets.grok.dev/raw.users": "true"}}}}}}}`,
+			"admission: dataset raw.users isn't in the catalog"},
+		{"Pod", `{"metadata": {"labels": {"grok.dev/Purpose": "Selling"}}}`, "admission: label grok.dev/Purpose: "},
+	}
+	for _, c := range cases {
+		req := &ReviewRequest{UID: "1", Namespace: "jobs", Name: "export", Object: json.RawMessage(c.object)}
+		req.Kind.Kind = c.kind
+		err := wh.Review(req)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("Review(%s) = %q", c.object, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("Review(%s) = %v, want %q", c.object, err, c.err)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	body := `{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview", "request": {"uid": "42",
+		"kind": {"kind": "Pod"}, "object": {"metadata": {"labels": {"grok.dev/Purpose": "Sharing", "datasets.grok.dev/raw.clicks": "true"}}}}}`
+	w := httptest.NewRecorder()
+	newWebhook(t).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewBufferString(body)))
+	var rv Review
+	if err := json.Unmarshal(w.Body.Bytes(), &rv); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if rv.Kind != "AdmissionReview" || rv.Response == nil || rv.Response.UID != "42" || rv.Response.Allowed ||
+		rv.Response.Result.Code != http.StatusForbidden {
+		t.Errorf("ServeHTTP() = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	newWebhook(t).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewBufferString("{}")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("ServeHTTP() without a request = %d", w.Code)
+	}
+}
@@ -0,0 +1,233 @@
+// Package airflow checks Airflow tasks against a policy before they run: a
+// PDP serves the checks over HTTP with a Handler, and the operators or hooks
+// of the DAGs ask it with a Client (or any HTTP client).
+//
+// The contract is a POST of a JSON TaskRequest to CheckPath:
+//
+//	POST /v1/tasks/check
+//	{
+//	 "dag_id": "daily_clicks", "task_id": "join",
+//	 "context": {"owner": "analytics", "purpose": "Analytics"},
+//	 "inputs": [{"name": "raw.clicks", "annotation": "DataType IPAddress"}],
+//	 "outputs": [{"name": "daily.clicks", "annotation": ""}]
+//	}
+//
+// answered by a 200 with a JSON TaskResponse, whose reasons explain a denial:
+//
+//	{"allowed": false, "reasons": ["output daily.clicks: Denied because ..."]}
+//
+// or by a 400 with {"error": "..."} for an invalid request. The task uses the
+// data of all its inputs, and so does every output, on top of its own
+// annotation. The attributes of the task context, e.g. its declared purpose,
+// are added to the annotations by the ContextMapping of the Handler.
+package airflow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/grongjun/grok"
+)
+
+// CheckPath is the path of the checks
+const CheckPath = "/v1/tasks/check"
+
+// Dataset is an input or an output of a task, and its annotation in the
+// policy syntax
+type Dataset struct {
+	Name       string `json:"name"`
+	Annotation string `json:"annotation"`
+}
+
+// TaskRequest asks whether a task may run
+type TaskRequest struct {
+	DagID  string `json:"dag_id"`
+	TaskID string `json:"task_id"`
+	RunID  string `json:"run_id,omitempty"`
+	// Context are attributes of the task context, e.g. its owner or the
+	// params of the run
+	Context map[string]string `json:"context,omitempty"`
+	Inputs  []Dataset         `json:"inputs"`
+	Outputs []Dataset         `json:"outputs"`
+}
+
+// TaskResponse tells whether a task may run
+type TaskResponse struct {
+	Allowed bool `json:"allowed"`
+	// Reasons are the explanations of the denials of the task or its outputs
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// ContextMapping maps the keys of task contexts to the policy attributes their
+// values are, e.g. "purpose": "Purpose" for a task context having "purpose":
+// "Analytics" to use Purpose Analytics. The other keys are ignored.
+type ContextMapping map[string]string
+
+// Annotation returns the annotation of a task context, in the order of the keys
+func (m ContextMapping) Annotation(p *grok.Policy, ctx map[string]string) (grok.Annotation, error) {
+	keys := make([]string, 0, len(ctx))
+	for k := range ctx {
+		if _, ok := m[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	an := make(grok.Annotation, 0, len(keys))
+	for _, k := range keys {
+		v, err := p.ParseValue(m[k], ctx[k])
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("airflow: context %s: %s", k, err))
+		}
+		an = append(an, v...)
+	}
+	return an, nil
+}
+
+// Handler serves the checks of tasks against a policy
+type Handler struct {
+	Policy  *grok.Policy
+	Mapping ContextMapping
+	// Options are the options of the evaluations, e.g. an audit sink
+	Options []grok.EvalOption
+	// Renderer renders the reasons of denials, a default Renderer when it's nil
+	Renderer *grok.Renderer
+}
+
+// NewHandler returns a handler of the checks against the policy
+func NewHandler(p *grok.Policy, m ContextMapping) *Handler {
+	return &Handler{Policy: p, Mapping: m}
+}
+
+// ServeHTTP serves a check
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "airflow: checks should be POST requests"})
+		return
+	}
+	var req TaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "airflow: " + err.Error()})
+		return
+	}
+	res, err := h.Check(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Check checks whether a task may run
+func (h *Handler) Check(req TaskRequest) (TaskResponse, error) {
+	uses, err := h.Mapping.Annotation(h.Policy, req.Context)
+	if err != nil {
+		return TaskResponse{}, err
+	}
+	for _, d := range req.Inputs {
+		an, err := h.Policy.ParseAnnotation(d.Annotation)
+		if err != nil {
+			return TaskResponse{}, errors.New(fmt.Sprintf("airflow: input %s: %s", d.Name, err))
+		}
+		uses = append(uses, an...)
+	}
+
+	res := TaskResponse{Allowed: true}
+	if err := h.check(&res, "the task", uses); err != nil {
+		return TaskResponse{}, err
+	}
+	for _, d := range req.Outputs {
+		an, err := h.Policy.ParseAnnotation(d.Annotation)
+		if err != nil {
+			return TaskResponse{}, errors.New(fmt.Sprintf("airflow: output %s: %s", d.Name, err))
+		}
+		if err := h.check(&res, "output "+d.Name, append(append(grok.Annotation{}, uses...), an...)); err != nil {
+			return TaskResponse{}, err
+		}
+	}
+	return res, nil
+}
+
+// check evaluates the annotation of a part of a task, and adds the reason of
+// its denial to the response
+func (h *Handler) check(res *TaskResponse, what string, an grok.Annotation) error {
+	d := h.Policy.Evaluate(an, h.Options...)
+	if d.Allowed {
+		return nil
+	}
+	res.Allowed = false
+	if d.Err != nil {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("%s: %s", what, d.Err))
+		return nil
+	}
+	r := h.Renderer
+	if r == nil {
+		r = &grok.Renderer{}
+	}
+	reason, err := r.Render(h.Policy.Trace(an))
+	if err != nil {
+		return err
+	}
+	res.Reasons = append(res.Reasons, fmt.Sprintf("%s: %s", what, reason))
+	return nil
+}
+
+// Client asks a PDP whether tasks may run
+type Client struct {
+	// URL is the base URL of the PDP, e.g. http://pdp:8080
+	URL string
+	// HTTPClient is the client of the requests, http.DefaultClient when it's nil
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client of the PDP at the URL
+func NewClient(url string) *Client {
+	return &Client{URL: url}
+}
+
+// Check asks whether a task may run
+func (c *Client) Check(ctx context.Context, req TaskRequest) (TaskResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return TaskResponse{}, err
+	}
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+CheckPath, bytes.NewReader(body))
+	if err != nil {
+		return TaskResponse{}, err
+	}
+	hr.Header.Set("Content-Type", "application/json")
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(hr)
+	if err != nil {
+		return TaskResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			return TaskResponse{}, errors.New(e.Error)
+		}
+		return TaskResponse{}, errors.New(fmt.Sprintf("airflow: the PDP answered %s", resp.Status))
+	}
+	var res TaskResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return TaskResponse{}, err
+	}
+	return res, nil
+}
@@ -0,0 +1,67 @@
+package airflow
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func newHandler(t *testing.T) *Handler {
+	ls := grok.NewLattices(`[
+		{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } },
+		{ "name": "Purpose", "edges": { "Analytics": [], "Sharing": [] } }
+	]`)
+	p := grok.NewPolicy(ls)
+	if err := p.ParsePolicy("ALLOW DataType TOP Purpose TOP EXCEPT { DENY DataType IPAddress Purpose Sharing }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return NewHandler(p, ContextMapping{"purpose": "Purpose"})
+}
+
+func TestClientCheck(t *testing.T) {
+	srv := httptest.NewServer(newHandler(t))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	cases := []struct {
+		req     TaskRequest
+		allowed bool
+		reasons string
+	}{
+		{TaskRequest{DagID: "d", TaskID: "t", Context: map[string]string{"purpose": "Analytics", "owner": "me"},
+			Inputs: []Dataset{{"raw.clicks", "DataType IPAddress"}}, Outputs: []Dataset{{"daily.clicks", ""}}}, true, ""},
+		{TaskRequest{DagID: "d", TaskID: "t", Context: map[string]string{"purpose": "Analytics"},
+			Inputs: []Dataset{{"raw.clicks", "DataType IPAddress"}}, Outputs: []Dataset{{"shared.clicks", "Purpose Sharing"}}}, false,
+			"output shared.clicks: Denied because the program uses Analytics, IPAddress together with Sharing, which the exception to the global allow forbids."},
+	}
+	for _, tc := range cases {
+		res, err := c.Check(context.Background(), tc.req)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if res.Allowed != tc.allowed || strings.Join(res.Reasons, "; ") != tc.reasons {
+			t.Errorf("Check(%+v) = %+v", tc.req, res)
+		}
+	}
+
+	_, err := c.Check(context.Background(), TaskRequest{Context: map[string]string{"purpose": "Selling"}})
+	if err == nil || !strings.HasPrefix(err.Error(), "airflow: context purpose: ") {
+		t.Errorf("Check() with an invalid context = %v", err)
+	}
+	_, err = c.Check(context.Background(), TaskRequest{Inputs: []Dataset{{"raw.users", "DataType Nowhere"}}})
+	if err == nil || !strings.HasPrefix(err.Error(), "airflow: input raw.users: ") {
+		t.Errorf("Check() with an invalid input = %v", err)
+	}
+}
+
+func TestServeHTTPMethod(t *testing.T) {
+	w := httptest.NewRecorder()
+	newHandler(t).ServeHTTP(w, httptest.NewRequest(http.MethodGet, CheckPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d", w.Code)
+	}
+}
@@ -0,0 +1,139 @@
+package grok
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Fields of decision records that an Anonymizer masks. The values of an
+// attribute of the annotations are the field AnnotationField+attribute, e.g.
+// annotation.Principal.
+const (
+	TimestampField  = "ts"
+	PolicyField     = "policy"
+	AnnotationField = "annotation."
+)
+
+// Transform masks a value of a field of decision records. An empty result
+// removes the value.
+type Transform func(value string) string
+
+// HashTransform returns a transform replacing values by their salted SHA-256
+// hashes, so that equal values stay equal in the exported logs
+func HashTransform(salt string) Transform {
+	return func(v string) string {
+		sum := sha256.Sum256([]byte(salt + v))
+		return hex.EncodeToString(sum[:8])
+	}
+}
+
+// BucketTransform returns a transform truncating RFC 3339 timestamps to
+// multiples of d, e.g. to the hour
+func BucketTransform(d time.Duration) Transform {
+	return func(v string) string {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return ""
+		}
+		return t.Truncate(d).Format(time.RFC3339Nano)
+	}
+}
+
+// RedactTransform removes values
+func RedactTransform(string) string {
+	return ""
+}
+
+// Anonymizer scrubs decision records before they're exported, e.g. to
+// analytics, according to a grok policy: the fields of the records are
+// annotated like the columns of a table, and are masked by the plan of the
+// policy (see PlanMasking), whose transforms are the states of the state
+// lattices, e.g. Hashed or Bucketed.
+type Anonymizer struct {
+	Policy *Policy
+	// Plan is the masking plan of the fields
+	Plan MaskingPlan
+	// transforms are the transforms of the masked fields
+	transforms map[string]Transform
+}
+
+// NewAnonymizer plans the masking of the fields of decision records with the
+// export policy. The transforms implement the states of the plan by name,
+// e.g. "Hashed": HashTransform(salt), and the first implemented transform of
+// a mask or of its alternatives is used.
+func NewAnonymizer(p *Policy, fields map[string]Annotation, transforms map[string]Transform) (*Anonymizer, error) {
+	plan := p.PlanMasking(fields)
+	if !plan.Allowed {
+		return nil, errors.New("replay: no masking of the fields gets the decision logs allowed")
+	}
+	a := &Anonymizer{Policy: p, Plan: plan, transforms: make(map[string]Transform)}
+	for _, m := range plan.Masks {
+		for _, t := range append([]string{m.Transform}, m.Alternatives...) {
+			if fn, ok := transforms[t]; ok {
+				a.transforms[m.Column] = fn
+				break
+			}
+		}
+		if a.transforms[m.Column] == nil {
+			return nil, errors.New(fmt.Sprintf("replay: field %s should be %s, which has no transform", m.Column, m.Transform))
+		}
+	}
+	return a, nil
+}
+
+// Fields returns the masked fields, sorted
+func (a *Anonymizer) Fields() []string {
+	fs := make([]string, 0, len(a.transforms))
+	for f := range a.transforms {
+		fs = append(fs, f)
+	}
+	sort.Strings(fs)
+	return fs
+}
+
+// Anonymize returns a record with its fields masked
+func (a *Anonymizer) Anonymize(r Record) Record {
+	if t, ok := a.transforms[TimestampField]; ok {
+		ts, _ := time.Parse(time.RFC3339Nano, t(r.Timestamp.Format(time.RFC3339Nano)))
+		r.Timestamp = ts
+	}
+	if t, ok := a.transforms[PolicyField]; ok {
+		r.PolicyID = t(r.PolicyID)
+	}
+	an := make(Annotation, 0, len(r.Annotation))
+	for _, pa := range r.Annotation {
+		if t, ok := a.transforms[AnnotationField+pa.name]; ok {
+			if pa.value = t(pa.value); pa.value == "" {
+				continue
+			}
+		}
+		an = append(an, pa)
+	}
+	r.Annotation = an
+	return r
+}
+
+// Copy anonymizes the records of a replay file into another, and returns the
+// number of records
+func (a *Anonymizer) Copy(w io.Writer, r io.Reader) (int, error) {
+	rr, rw := NewRecordReader(r), NewRecordWriter(w)
+	n := 0
+	for {
+		rec, err := rr.Read()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := rw.Write(a.Anonymize(rec)); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,63 @@
+package grok
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnonymizer(t *testing.T) {
+	l := NewLattice(`{ "name": "LogData", "edges": { "Principal": [], "Time": [] } }`)
+	l.Product(NewLattice(`{ "name": "LogState", "edges": { "Bucketed": [], "Hashed": [] } }`))
+	p := NewPolicy([]*Lattice{l})
+	if err := p.ParsePolicy("ALLOW LogData Principal:Hashed LogData Time:Bucketed"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	fields := make(map[string]Annotation)
+	for f, astr := range map[string]string{"annotation.Principal": "LogData Principal", "ts": "LogData Time"} {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		fields[f] = an
+	}
+	transforms := map[string]Transform{"Hashed": HashTransform("salt"), "Bucketed": BucketTransform(time.Hour)}
+	a, err := NewAnonymizer(p, fields, transforms)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := strings.Join(a.Fields(), ","); got != "annotation.Principal,ts" {
+		t.Errorf("Fields() = %s", got)
+	}
+
+	in := `{"annotation":[["DataType","IPAddress"],["Principal","alice"]],"policy":"p1","effect":"ALLOW","ts":"2020-06-01T10:42:00Z"}
+{"annotation":[["Principal","alice"]],"policy":"p1","effect":"DENY","ts":"2020-06-01T11:05:00Z"}
+`
+	var out bytes.Buffer
+	n, err := a.Copy(&out, strings.NewReader(in))
+	if err != nil || n != 2 {
+		t.Fatalf("Copy() = %d, %v", n, err)
+	}
+	recs, err := ReadRecords(&out)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	hashed := HashTransform("salt")("alice")
+	if recs[0].Annotation.String() != "DataType IPAddress Principal "+hashed ||
+		!recs[0].Timestamp.Equal(time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)) || recs[0].PolicyID != "p1" ||
+		recs[1].Annotation.String() != "Principal "+hashed || !recs[1].Timestamp.Equal(time.Date(2020, 6, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Copy() = %+v", recs)
+	}
+
+	if _, err := NewAnonymizer(p, fields, map[string]Transform{"Hashed": RedactTransform}); err == nil ||
+		err.Error() != "replay: field ts should be Bucketed, which has no transform" {
+		t.Errorf("NewAnonymizer() without a transform = %v", err)
+	}
+	if err := p.ParsePolicy("DENY LogData Principal"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if _, err := NewAnonymizer(p, fields, transforms); err == nil {
+		t.Errorf("NewAnonymizer() of a denying policy = nil error")
+	}
+}
@@ -0,0 +1,130 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Column is a dictionary-encoded column of a batch of annotations: the value
+// of a row is Values[Codes[row]], and a negative code is no value. Query
+// results carry few distinct labels, so that a column is mostly codes.
+type Column struct {
+	Attribute string
+	Values    []string
+	Codes     []int32
+}
+
+// NewColumn returns the column of the values of an attribute, one per row,
+// where an empty string is no value
+func NewColumn(attr string, values []string) Column {
+	c := Column{Attribute: attr, Values: make([]string, 0), Codes: make([]int32, len(values))}
+	index := make(map[string]int32)
+	for i, v := range values {
+		if v == "" {
+			c.Codes[i] = -1
+			continue
+		}
+		code, ok := index[v]
+		if !ok {
+			code = int32(len(c.Values))
+			index[v] = code
+			c.Values = append(c.Values, v)
+		}
+		c.Codes[i] = code
+	}
+	return c
+}
+
+// Batch is a batch of annotations in columns, e.g. the per-row labels of a
+// query result. The columns have the same number of rows, and an attribute
+// may have several columns for rows with several values.
+type Batch []Column
+
+// Rows returns the number of rows of the batch
+func (b Batch) Rows() int {
+	if len(b) == 0 {
+		return 0
+	}
+	return len(b[0].Codes)
+}
+
+// ApplyOnBatch decides on every row of a batch like ApplyOn. The values of
+// the dictionaries are checked against the downsets of the clause of an ALLOW
+// policy once per column, which denies the rows of the values out of the
+// downsets without evaluating them, and the other rows are evaluated once per
+// distinct combination of values.
+func (p *Policy) ApplyOnBatch(b Batch) ([]bool, error) {
+	rows := b.Rows()
+	// the parsed pairs of the values of each column
+	values := make([][]Annotation, len(b))
+	for i, c := range b {
+		if len(c.Codes) != rows {
+			return nil, errors.New(fmt.Sprintf("policy: column %d (%s) has %d rows, want %d", i, c.Attribute, len(c.Codes), rows))
+		}
+		values[i] = make([]Annotation, len(c.Values))
+		for j, v := range c.Values {
+			an, err := p.ParseValue(c.Attribute, v)
+			if err != nil {
+				return nil, err
+			}
+			values[i][j] = an
+		}
+		for _, code := range c.Codes {
+			if int(code) >= len(c.Values) {
+				return nil, errors.New(fmt.Sprintf("policy: column %d (%s) has no value %d", i, c.Attribute, code))
+			}
+		}
+	}
+
+	// outside[i][j] is true when the value j of column i is out of the
+	// downsets of an ALLOW clause
+	outside := make([][]bool, len(b))
+	for i, c := range b {
+		outside[i] = make([]bool, len(c.Values))
+		l, ok := p.baseOn[c.Attribute]
+		if !p.Mode || p.Monitor || !ok || p.Repeated == JoinValues || p.RepeatedOf[c.Attribute] == JoinValues {
+			continue
+		}
+		pattrs := p.Clause.ValuesOf(c.Attribute)
+		for j, an := range values[i] {
+			if !Clause(an).hasAnyOf() {
+				outside[i][j] = !l.Allow(pattrs, an.ValuesOf(c.Attribute))
+			}
+		}
+	}
+
+	res := make([]bool, rows)
+	decisions := make(map[string]bool)
+	var key strings.Builder
+	for r := 0; r < rows; r++ {
+		denied := false
+		key.Reset()
+		for i, c := range b {
+			code := c.Codes[r]
+			if code >= 0 && outside[i][code] {
+				denied = true
+				break
+			}
+			key.WriteString(strconv.Itoa(int(code)))
+			key.WriteByte(',')
+		}
+		if denied {
+			continue
+		}
+		allowed, ok := decisions[key.String()]
+		if !ok {
+			an := make(Annotation, 0, len(b))
+			for i, c := range b {
+				if code := c.Codes[r]; code >= 0 {
+					an = append(an, values[i][code]...)
+				}
+			}
+			allowed = p.ApplyOn(an)
+			decisions[key.String()] = allowed
+		}
+		res[r] = allowed
+	}
+	return res, nil
+}
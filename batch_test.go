@@ -0,0 +1,65 @@
+package grok
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestNewColumn(t *testing.T) {
+	c := NewColumn("DataType", []string{"IPAddress", "", "AccountID", "IPAddress"})
+	if !equals(c.Values, []string{"IPAddress", "AccountID"}) || len(c.Codes) != 4 ||
+		c.Codes[0] != 0 || c.Codes[1] != -1 || c.Codes[2] != 1 || c.Codes[3] != 0 {
+		t.Errorf("NewColumn() = %+v", c)
+	}
+}
+
+func TestApplyOnBatch(t *testing.T) {
+	elements := []string{"", "IPAddress", "AccountID", "Location", "UniqueID", "TOP"}
+	for _, pstr := range []string{
+		"ALLOW DataType Location",
+		"ALLOW DataType UniqueID EXCEPT { DENY DataType IPAddress DataType AccountID }",
+		"DENY DataType IPAddress DataType AccountID",
+		"ALLOW MODE=monitor DataType Location",
+	} {
+		p := newScopedPolicy(t, pstr)
+		r := rand.New(rand.NewSource(1))
+		first, second := make([]string, 1000), make([]string, 1000)
+		for i := range first {
+			first[i], second[i] = elements[r.Intn(len(elements))], elements[r.Intn(len(elements))]
+		}
+		b := Batch{NewColumn("DataType", first), NewColumn("DataType", second)}
+		got, err := p.ApplyOnBatch(b)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		for i := range first {
+			an := make(Annotation, 0, 2)
+			for _, v := range []string{first[i], second[i]} {
+				if v != "" {
+					an = append(an, pair{name: "DataType", value: v})
+				}
+			}
+			if want := p.ApplyOn(an); got[i] != want {
+				t.Errorf("ApplyOnBatch [%q] row %d (%q) = %t, want %t", pstr, i, an, got[i], want)
+			}
+		}
+	}
+}
+
+func TestApplyOnBatchErrors(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	cases := []struct {
+		b   Batch
+		err string
+	}{
+		{Batch{NewColumn("DataType", []string{"IPAddress"}), NewColumn("DataType", []string{"IPAddress", ""})},
+			"policy: column 1 (DataType) has 2 rows, want 1"},
+		{Batch{NewColumn("DataType", []string{"Unknown"})}, "policy: Unknown is not a valid value in lattice DataType"},
+		{Batch{{Attribute: "DataType", Values: []string{"IPAddress"}, Codes: []int32{1}}}, "policy: column 0 (DataType) has no value 1"},
+	}
+	for _, c := range cases {
+		if _, err := p.ApplyOnBatch(c.b); err == nil || err.Error() != c.err {
+			t.Errorf("ApplyOnBatch() = %v, want %q", err, c.err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package grok
+
+import (
+	"errors"
+)
+
+// ErrBudgetExceeded is the error of the decisions that ran out of budget
+var ErrBudgetExceeded = errors.New("policy: evaluation budget exceeded")
+
+// Budget limits the work of a decision, so that pathological policies can't
+// cause unbounded latency. A zero limit is no limit.
+type Budget struct {
+	// Steps is the maximum number of lattice edges visited by Meet, Join and
+	// Precede (and Allow, Deny and Overlap, which use them), where a lookup
+	// in a compiled lattice is a step, and so is each alternative of an
+	// annotation with ANYOF sets (see Annotation.Alternatives)
+	Steps int
+	// Exceptions is the maximum number of evaluated exceptions
+	Exceptions int
+}
+
+// WithBudget limits the work of a decision, over all its evaluation passes.
+// A decision that runs out of budget before its effect is known is denied
+// with ErrBudgetExceeded, and carries the partial explanation of the
+// evaluation, while the passes after it (the would-be effect of monitor mode,
+// and whether the effect depends on Unknown values) are left out.
+func WithBudget(b Budget) EvalOption {
+	return func(ctx *evalContext) {
+		ctx.budget = &budget{Budget: b}
+	}
+}
+
+// budget is the budget of a decision and what it spent
+type budget struct {
+	Budget
+	steps, exceptions int
+	exceeded          bool
+	// lattices are the copies of the lattices counting their steps, see
+	// counting
+	lattices map[*Lattice]*Lattice
+}
+
+// lattice returns the copy of a lattice that counts its steps into the
+// budget, or the lattice itself without budget
+func (ctx *evalContext) lattice(l *Lattice) *Lattice {
+	if ctx == nil || ctx.budget == nil {
+		return l
+	}
+	b := ctx.budget
+	if b.lattices == nil {
+		b.lattices = make(map[*Lattice]*Lattice)
+	}
+	c, ok := b.lattices[l]
+	if !ok {
+		c = l.counting(&b.steps)
+		b.lattices[l] = c
+	}
+	return c
+}
+
+// spent updates the budget with the steps spent so far, and returns false
+// when it's exceeded
+func (ctx *evalContext) spent() bool {
+	if ctx == nil || ctx.budget == nil {
+		return true
+	}
+	b := ctx.budget
+	b.exceeded = b.exceeded || (b.Steps > 0 && b.steps > b.Steps)
+	return !b.exceeded
+}
+
+// alternative spends a step on an alternative of an annotation, and returns
+// false when the budget is exceeded
+func (ctx *evalContext) alternative() bool {
+	if ctx == nil || ctx.budget == nil {
+		return true
+	}
+	ctx.budget.steps++
+	return ctx.spent()
+}
+
+// exception spends an exception, and returns false when the budget is exceeded
+func (ctx *evalContext) exception() bool {
+	if ctx == nil || ctx.budget == nil {
+		return true
+	}
+	b := ctx.budget
+	b.exceptions++
+	b.exceeded = b.exceeded || (b.Exceptions > 0 && b.exceptions > b.Exceptions)
+	return !b.exceeded
+}
+
+// exceeded returns true when the budget is exceeded
+func (ctx *evalContext) exceeded() bool {
+	return ctx != nil && ctx.budget != nil && ctx.budget.exceeded
+}
+
+// counting returns a copy of the lattice (and of its state lattice) whose
+// walks count the edges they visit into steps
+func (l *Lattice) counting(steps *int) *Lattice {
+	c := l.clone()
+	c.steps = steps
+	if s := l.state(); s != nil {
+		c.product.Store(s.counting(steps))
+	}
+	return c
+}
+
+// visit counts n steps of a counting lattice
+func (l *Lattice) visit(n int) {
+	if l.steps != nil {
+		*l.steps += n
+	}
+}
+
+// walked counts the edges from nodes in adjacency map adj, or every edge
+// when the edges are scanned rather than indexed
+func (l *Lattice) walked(adj map[string][]string, nodes []string) {
+	if l.steps == nil {
+		return
+	}
+	if !l.isIndexed() {
+		l.visit(len(l.Edges))
+		return
+	}
+	for _, n := range nodes {
+		l.visit(len(adj[n]))
+	}
+}
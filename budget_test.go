@@ -0,0 +1,113 @@
+package grok
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateBudget(t *testing.T) {
+	pstr := "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID DENY DataType Location }"
+	cases := []struct {
+		budget   Budget
+		astr     string
+		allowed  bool
+		exceeded bool
+	}{
+		{Budget{}, "DataType IPAddress", false, false},
+		// the edges visited by the Allow of the policy, the Deny of each
+		// exception and the overlap of the matched one, while the would-be
+		// pass of monitor mode is left out once the budget is spent
+		{Budget{Steps: 10}, "DataType IPAddress", false, false},
+		{Budget{Steps: 9}, "DataType IPAddress", false, true},
+		{Budget{Exceptions: 2}, "DataType IPAddress", false, false},
+		{Budget{Exceptions: 1}, "DataType IPAddress", false, true},
+		// the budget only covers the Allow of the policy
+		{Budget{Steps: 1}, "DataType AccountID", false, true},
+		{Budget{Steps: 1}, "DataType UniqueID", false, true},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, pstr)
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		sink := &memorySink{}
+		d := p.Evaluate(an, WithBudget(c.budget), WithAuditSink(sink))
+		if d.Allowed != c.allowed || (d.Err == ErrBudgetExceeded) != c.exceeded {
+			t.Errorf("Evaluate(%q) with %+v = %+v", c.astr, c.budget, d)
+			continue
+		}
+		if !c.exceeded {
+			if d.Err != nil || d.Explanation != nil || d.Allowed != p.ApplyOn(an) {
+				t.Errorf("Evaluate(%q) with %+v = %+v, want the decision of ApplyOn", c.astr, c.budget, d)
+			}
+			continue
+		}
+		if d.Explanation == nil || !d.Explanation.Decisive().Exhausted {
+			t.Errorf("Evaluate(%q) with %+v has no partial explanation", c.astr, c.budget)
+		}
+		if len(sink.records) != 1 || sink.records[0].Error != ErrBudgetExceeded.Error() {
+			t.Errorf("records = %+v", sink.records)
+		}
+	}
+}
+
+func TestEvaluateBudgetExplanation(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID DENY DataType Location }")
+	an, err := p.ParseAnnotation("DataType IPAddress")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	e := p.Evaluate(an, WithBudget(Budget{Exceptions: 1})).Explanation
+	// the policy matched, and the first exception was evaluated
+	if !e.Matched || !e.Exhausted || len(e.Excepts) != 1 || e.Excepts[0].Exhausted || e.Excepts[0].Matched {
+		t.Errorf("Explanation = %+v", e)
+	}
+}
+
+func TestEvaluateBudgetMonitor(t *testing.T) {
+	// the exceptions in monitor mode don't spend the budget of the effect,
+	// which spends 5 steps, and the would-be effect spends what's left
+	p := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY MODE=monitor DataType IPAddress DENY MODE=monitor DataType Location }")
+	an, err := p.ParseAnnotation("DataType IPAddress")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	d := p.Evaluate(an, WithBudget(Budget{Steps: 5}))
+	if !d.Allowed || d.Err != nil || d.WouldBe != "" {
+		t.Errorf("Evaluate() = %+v", d)
+	}
+	if d := p.Evaluate(an, WithBudget(Budget{Steps: 10})); !d.Allowed || d.Err != nil || d.WouldBe != Deny {
+		t.Errorf("Evaluate() = %+v", d)
+	}
+}
+
+func TestEvaluateBudgetSteps(t *testing.T) {
+	// a chain of 20 elements, where E19 is the lowest
+	edges := make([]string, 0)
+	for i := 0; i < 19; i++ {
+		edges = append(edges, fmt.Sprintf(`"E%d": ["E%d"]`, i, i+1))
+	}
+	l := NewLattice(`{ "name": "Chain", "edges": { ` + strings.Join(edges, ", ") + ` } }`)
+	p := NewPolicy([]*Lattice{l})
+	if err := p.ParsePolicy("ALLOW Chain E0"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	an, err := p.ParseAnnotation("Chain E19")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	// the Allow is a single operation, which walks the chain
+	if d := p.Evaluate(an, WithBudget(Budget{Steps: 10})); d.Allowed || d.Err != ErrBudgetExceeded {
+		t.Errorf("Evaluate() = %+v", d)
+	}
+	if d := p.Evaluate(an, WithBudget(Budget{Steps: 20})); !d.Allowed || d.Err != nil {
+		t.Errorf("Evaluate() = %+v", d)
+	}
+	// a compiled lattice looks the order up in a step
+	l.Compile()
+	if d := p.Evaluate(an, WithBudget(Budget{Steps: 1})); !d.Allowed || d.Err != nil {
+		t.Errorf("Evaluate() = %+v", d)
+	}
+}
@@ -0,0 +1,131 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LatticeBuilder builds a lattice from elements and edges added in bulk, e.g.
+// by the syncs of a data catalog, whose edge lists have duplicates. The edges
+// from TOP and to BOTTOM are completed by Build, like NewLattice does.
+type LatticeBuilder struct {
+	Name string
+	// edges are the added edges in order, and children index them
+	edges    []Edge
+	children map[string][]string
+	// elements are the added elements in order, with or without edges
+	elements []string
+	known    map[string]bool
+}
+
+// NewLatticeBuilder returns the empty builder of a lattice
+func NewLatticeBuilder(name string) *LatticeBuilder {
+	return &LatticeBuilder{Name: name, edges: make([]Edge, 0), children: make(map[string][]string),
+		elements: make([]string, 0), known: make(map[string]bool)}
+}
+
+// AddElements adds elements, which are singletons unless edges connect them.
+// The elements already added are skipped.
+func (b *LatticeBuilder) AddElements(es ...string) error {
+	for _, e := range es {
+		if e == "" || e == Top || e == Bottom {
+			return errors.New(fmt.Sprintf("policy: %q isn't a valid element of lattice %s", e, b.Name))
+		}
+	}
+	for _, e := range es {
+		b.add(e)
+	}
+	return nil
+}
+
+// AddEdges adds edges from elements to the elements right below them, and
+// returns the number of edges added. The edges already added are skipped, and
+// when an edge conflicts with the direction of the others, i.e. when its
+// element To already precedes its element From, no edge is added.
+func (b *LatticeBuilder) AddEdges(es []Edge) (int, error) {
+	added := make(map[Edge]bool)
+	pending := make([]Edge, 0, len(es))
+	for _, e := range es {
+		for _, el := range []string{e.From, e.To} {
+			if el == "" || el == Top || el == Bottom {
+				return 0, errors.New(fmt.Sprintf("policy: %q isn't a valid element of lattice %s", el, b.Name))
+			}
+		}
+		if e.From == e.To {
+			return 0, errors.New(fmt.Sprintf("policy: edge %s -> %s of lattice %s is a loop", e.From, e.To, b.Name))
+		}
+		if added[e] || contains(b.children[e.From], e.To) {
+			continue
+		}
+		added[e] = true
+		pending = append(pending, e)
+	}
+	// the pending edges are checked together, since they may conflict with
+	// one another
+	children := make(map[string][]string, len(b.children))
+	for from, tos := range b.children {
+		children[from] = tos
+	}
+	for _, e := range pending {
+		// the children are copied on append, so that b.children is left as it
+		// is on conflicts
+		tos := children[e.From]
+		children[e.From] = append(tos[:len(tos):len(tos)], e.To)
+	}
+	for _, e := range pending {
+		if reaches(children, e.To, e.From) {
+			return 0, errors.New(fmt.Sprintf("policy: edge %s -> %s of lattice %s conflicts with the direction of the other edges",
+				e.From, e.To, b.Name))
+		}
+	}
+	for _, e := range es {
+		b.add(e.From)
+		b.add(e.To)
+	}
+	b.edges = append(b.edges, pending...)
+	b.children = children
+	return len(pending), nil
+}
+
+// Build returns the lattice, with the edges from TOP to the elements without
+// parents, from the elements without children to BOTTOM, and through the
+// singleton elements
+func (b *LatticeBuilder) Build() *Lattice {
+	connected := make(map[string]bool)
+	for _, e := range b.edges {
+		connected[e.From], connected[e.To] = true, true
+	}
+	ses := filter(b.elements, func(e string) bool { return !connected[e] })
+	l := &Lattice{Name: b.Name, Edges: completeEdges(append([]Edge(nil), b.edges...), ses),
+		Weights: make(map[string]int), Labels: make(map[string]map[string]string)}
+	l.indexEdges()
+	l.autoCompile()
+	return l
+}
+
+func (b *LatticeBuilder) add(e string) {
+	if !b.known[e] {
+		b.known[e] = true
+		b.elements = append(b.elements, e)
+	}
+}
+
+// reaches returns true when there's a path from an element to another
+func reaches(children map[string][]string, from, to string) bool {
+	seen := map[string]bool{from: true}
+	stack := []string{from}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if e == to {
+			return true
+		}
+		for _, c := range children[e] {
+			if !seen[c] {
+				seen[c] = true
+				stack = append(stack, c)
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLatticeBuilder(t *testing.T) {
+	b := NewLatticeBuilder("DataType")
+	n, err := b.AddEdges([]Edge{
+		{"UniqueID", "AccountID"}, {"UniqueID", "IPAddress"}, {"UniqueID", "AccountID"},
+		{"Location", "IPAddress"},
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("AddEdges() = %d, %v, want 3 edges", n, err)
+	}
+	if n, err := b.AddEdges([]Edge{{"Location", "IPAddress"}}); err != nil || n != 0 {
+		t.Errorf("AddEdges() of an added edge = %d, %v, want 0 edges", n, err)
+	}
+	if err := b.AddElements("Email", "AccountID"); err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	l := b.Build()
+	want := NewLattice(`{ "name": "DataType", "edges": {
+		"UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"], "Email": [] } }`)
+	if !equals(l.Elements(), want.Elements()) {
+		t.Errorf("Build() elements = %v, want %v", l.Elements(), want.Elements())
+	}
+	for _, a := range want.Elements() {
+		for _, c := range want.Elements() {
+			if l.Precede(a, c) != want.Precede(a, c) || l.Join(a, c) != want.Join(a, c) {
+				t.Errorf("Build() orders %s and %s unlike NewLattice", a, c)
+			}
+		}
+	}
+
+	cases := []struct {
+		edges []Edge
+		err   string
+	}{
+		{[]Edge{{"IPAddress", "UniqueID"}}, "conflicts with the direction"},
+		{[]Edge{{"Device", "Cookie"}, {"Cookie", "Device"}}, "conflicts with the direction"},
+		{[]Edge{{"Email", "Email"}}, "is a loop"},
+		{[]Edge{{Top, "Email"}}, "isn't a valid element"},
+	}
+	for _, c := range cases {
+		if _, err := b.AddEdges(c.edges); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("AddEdges(%v) = %v, want %q", c.edges, err, c.err)
+		}
+	}
+	// the conflicting edges are added neither in part, nor with their elements
+	if got := b.Build().Elements(); !equals(got, l.Elements()) {
+		t.Errorf("Build() after conflicts = %v, want %v", got, l.Elements())
+	}
+}
@@ -0,0 +1,79 @@
+package grok
+
+import (
+	"strings"
+	"sync"
+)
+
+// DecisionCache caches the decisions of a registry by scope and annotation,
+// and invalidates them when the policies of the registry are reloaded: the
+// decisions of a reloaded scope and of the scopes below it are dropped, since
+// their chains include the reloaded scope. It is safe for concurrent use.
+type DecisionCache struct {
+	r  *Registry
+	mu sync.Mutex
+	// decisions are the cached decisions by scope, then by annotation text
+	decisions map[string]map[string]ScopedDecision
+	// generation counts the invalidations, so that the decisions evaluated
+	// during an invalidation aren't cached
+	generation int
+}
+
+// NewDecisionCache returns an empty DecisionCache of a registry, which is
+// invalidated on the reloads of the registry
+func NewDecisionCache(r *Registry) *DecisionCache {
+	c := &DecisionCache{r: r, decisions: make(map[string]map[string]ScopedDecision)}
+	r.OnReload(c.Invalidate)
+	return c
+}
+
+// Evaluate returns the cached decision of the registry on an annotation at a
+// scope, and evaluates it when it isn't cached. Errors aren't cached.
+func (c *DecisionCache) Evaluate(scope string, an Annotation) (ScopedDecision, error) {
+	scope, key := strings.Trim(scope, ScopeSeparator), an.String()
+	c.mu.Lock()
+	d, ok := c.decisions[scope][key]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok {
+		return d, nil
+	}
+
+	d, err := c.r.Evaluate(scope, an)
+	if err != nil {
+		return d, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		if c.decisions[scope] == nil {
+			c.decisions[scope] = make(map[string]ScopedDecision)
+		}
+		c.decisions[scope][key] = d
+	}
+	return d, nil
+}
+
+// Invalidate drops the cached decisions of a scope and of the scopes below it
+func (c *DecisionCache) Invalidate(scope string) {
+	scope = strings.Trim(scope, ScopeSeparator)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for s := range c.decisions {
+		if scope == "" || s == scope || strings.HasPrefix(s, scope+ScopeSeparator) {
+			delete(c.decisions, s)
+		}
+	}
+}
+
+// Len returns the number of cached decisions
+func (c *DecisionCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, ds := range c.decisions {
+		n += len(ds)
+	}
+	return n
+}
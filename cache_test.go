@@ -0,0 +1,47 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestDecisionCache(t *testing.T) {
+	r := NewRegistry(DenyOverrides)
+	r.Register("acme", newScopedPolicy(t, "ALLOW DataType TOP"))
+	r.Register("other", newScopedPolicy(t, "ALLOW DataType TOP"))
+	c := NewDecisionCache(r)
+	reloads := make([]string, 0)
+	r.OnReload(func(scope string) { reloads = append(reloads, scope) })
+
+	an, err := newScopedPolicy(t, "ALLOW DataType TOP").ParseAnnotation("DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	for _, scope := range []string{"acme/marketing", "/acme/marketing/", "acme", "other"} {
+		if d, err := c.Evaluate(scope, an); err != nil || !d.Allowed {
+			t.Fatalf("Evaluate(%q) = %+v, %v", scope, d, err)
+		}
+	}
+	if c.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", c.Len())
+	}
+
+	// tightening acme drops the decisions of acme and below, not of other
+	r.Register("/acme", newScopedPolicy(t, "DENY DataType AccountID"))
+	if c.Len() != 1 {
+		t.Errorf("Len() after reload = %d, want 1", c.Len())
+	}
+	if d, err := c.Evaluate("acme/marketing", an); err != nil || d.Allowed {
+		t.Errorf("Evaluate(acme/marketing) after reload = %+v, %v", d, err)
+	}
+	if len(reloads) != 1 || reloads[0] != "acme" {
+		t.Errorf("reloads = %q", reloads)
+	}
+
+	r.Unregister("acme")
+	if _, err := c.Evaluate("acme/marketing", an); err == nil {
+		t.Errorf("Evaluate(acme/marketing) after unregister = nil error")
+	}
+	if c.Len() != 1 || len(reloads) != 2 {
+		t.Errorf("Len() = %d, reloads = %q", c.Len(), reloads)
+	}
+}
@@ -0,0 +1,171 @@
+package grok
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CertificateVersion is the version of the certificates issued by Evaluate
+const CertificateVersion = 1
+
+// Certificate is the signed, self-contained evidence of a decision, that
+// downstream systems can verify offline, e.g. for audits: it binds the
+// policy and the lattices the decision was made with, the annotation, the
+// effect and the explanation.
+type Certificate struct {
+	Version int    `json:"version"`
+	Policy  string `json:"policy,omitempty"`
+	// PolicyFingerprint is the digest of the policy and of its lattices
+	PolicyFingerprint string `json:"policy_fingerprint"`
+	// Lattices are the digests of the lattices of the policy by name
+	Lattices map[string]string `json:"lattices"`
+	// Annotation is the canonical annotation, its pairs sorted
+	Annotation string `json:"annotation"`
+	Effect     string `json:"effect"`
+	// ExplanationDigest is the digest of the explanation of the decision on
+	// the canonical annotation
+	ExplanationDigest string    `json:"explanation_digest"`
+	Timestamp         time.Time `json:"ts"`
+	// Signature is the base64 Ed25519 signature of the other fields
+	Signature string `json:"signature"`
+}
+
+// WithCertificate issues the certificate of every decision (see
+// Decision.Certificate), signed with the key
+func WithCertificate(key ed25519.PrivateKey) EvalOption {
+	return func(ctx *evalContext) {
+		ctx.certKey = key
+	}
+}
+
+// Certify returns the certificate of a decision of the policy on an
+// annotation, signed with the key
+func (p *Policy) Certify(an Annotation, d Decision, key ed25519.PrivateKey) *Certificate {
+	c := &Certificate{Version: CertificateVersion, Policy: p.ID, Effect: EffectOf(d.Allowed), Timestamp: d.Timestamp}
+	c.PolicyFingerprint, c.Lattices = p.fingerprints()
+	c.Annotation = CanonicalAnnotation(an)
+	c.ExplanationDigest = digest(p.Trace(canonical(an)))
+	c.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, c.payload()))
+	return c
+}
+
+// Verify verifies the signature of the certificate
+func (c *Certificate) Verify(key ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(c.Signature)
+	if err != nil || !ed25519.Verify(key, c.payload(), sig) {
+		return errors.New("certificate: invalid signature")
+	}
+	return nil
+}
+
+// Reproduce verifies that the policy is the one of the certificate, and that
+// it makes the certified decision on the certified annotation, with the
+// certified explanation
+func (c *Certificate) Reproduce(p *Policy) error {
+	fp, ls := p.fingerprints()
+	for name, d := range c.Lattices {
+		if ls[name] != d {
+			return errors.New(fmt.Sprintf("certificate: lattice %s differs from the certified one", name))
+		}
+	}
+	if fp != c.PolicyFingerprint {
+		return errors.New("certificate: the policy differs from the certified one")
+	}
+	an, err := p.ParseAnnotation(c.Annotation)
+	if err != nil {
+		return errors.New(fmt.Sprintf("certificate: %s", err))
+	}
+	e := p.Trace(an)
+	if EffectOf(e.Allowed) != c.Effect {
+		return errors.New(fmt.Sprintf("certificate: the policy decides %s, not %s", EffectOf(e.Allowed), c.Effect))
+	}
+	if digest(e) != c.ExplanationDigest {
+		return errors.New("certificate: the explanation differs from the certified one")
+	}
+	return nil
+}
+
+// payload returns what the signature of the certificate signs
+func (c *Certificate) payload() []byte {
+	cp := *c
+	cp.Signature = ""
+	b, _ := json.Marshal(&cp)
+	return b
+}
+
+// CanonicalAnnotation returns an annotation in the policy syntax with its
+// pairs sorted, so that equal annotations have the same text
+func CanonicalAnnotation(an Annotation) string {
+	return canonical(an).String()
+}
+
+func canonical(an Annotation) Annotation {
+	c := append(Annotation{}, an...)
+	sort.SliceStable(c, func(i, j int) bool {
+		if c[i].name != c[j].name {
+			return c[i].name < c[j].name
+		}
+		return c[i].value < c[j].value
+	})
+	return c
+}
+
+// Fingerprints returns the digest of the policy and the digests of its
+// lattices by name, the fingerprints that certificates are reproduced against
+func (p *Policy) Fingerprints() (string, map[string]string) {
+	return p.fingerprints()
+}
+
+// fingerprints returns the digest of the policy, and the digests of its
+// lattices by name. A lattice is digested from its sorted edges, so that
+// digests don't depend on the order its definition lists them in.
+func (p *Policy) fingerprints() (string, map[string]string) {
+	ls := make(map[string]string)
+	for _, l := range p.lattices() {
+		edges := make([]string, 0, len(l.Edges))
+		for _, e := range l.Edges {
+			edges = append(edges, e.From+" > "+e.To)
+		}
+		sort.Strings(edges)
+		product := ""
+		if s := l.state(); s != nil {
+			product = s.Name
+		}
+		ls[l.Name] = digest(struct {
+			Name, Product string
+			Edges         []string
+		}{l.Name, product, edges})
+	}
+	derivations := make([]string, 0, len(p.Derivations))
+	for _, r := range p.Derivations {
+		derivations = append(derivations, r.String())
+	}
+	// the settings are digested when they aren't the defaults, so that the
+	// fingerprints of the policies without settings don't change
+	var settings *policySettings
+	if s := p.settings(); !s.isZero() {
+		settings = &s
+	}
+	return digest(struct {
+		ID          string
+		Policy      policySnapshot
+		Lattices    map[string]string
+		Numerics    []string
+		Derivations []string        `json:",omitempty"`
+		Settings    *policySettings `json:",omitempty"`
+	}{p.ID, p.snapshot(), ls, p.numericNames(), derivations, settings}), ls
+}
+
+// digest returns the sha256 digest of the JSON of v, e.g. sha256:2c26b4...
+func digest(v interface{}) string {
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,64 @@
+package grok
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertificate(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	p.ID = "no-joins"
+	an, _ := p.ParseAnnotation("DataType IPAddress DataType AccountID")
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := p.Evaluate(an, WithCertificate(key), WithClock(func() time.Time { return now }))
+	c := d.Certificate
+	if c == nil || c.Effect != EffectOf(false) || c.Annotation != "DataType AccountID DataType IPAddress" || c.Policy != "no-joins" {
+		t.Fatalf("Certificate = %+v", c)
+	}
+	if !strings.HasPrefix(c.PolicyFingerprint, "sha256:") || len(c.Lattices) != 1 {
+		t.Errorf("Certificate = %+v", c)
+	}
+	if p.Evaluate(an).Certificate != nil {
+		t.Errorf("Evaluate() without WithCertificate should issue no certificate")
+	}
+
+	// the certificate is verified offline, from its JSON
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	var got Certificate
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := got.Verify(key.Public().(ed25519.PublicKey)); err != nil {
+		t.Errorf("Verify() = %q", err)
+	}
+	// the same policy, parsed again, reproduces the decision
+	if err := got.Reproduce(newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)); err == nil {
+		t.Errorf("Reproduce() of a policy without ID should fail")
+	}
+	same := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	same.ID = "no-joins"
+	if err := got.Reproduce(same); err != nil {
+		t.Errorf("Reproduce() = %q", err)
+	}
+
+	tampered := got
+	tampered.Effect = EffectOf(true)
+	if err := tampered.Verify(key.Public().(ed25519.PublicKey)); err == nil {
+		t.Errorf("Verify() of a tampered certificate should fail")
+	}
+	other := newScopedPolicy(t, `ALLOW DataType TOP`)
+	other.ID = "no-joins"
+	if err := got.Reproduce(other); err == nil {
+		t.Errorf("Reproduce() with another policy should fail")
+	}
+	if err := tampered.Reproduce(same); err == nil {
+		t.Errorf("Reproduce() of another effect should fail")
+	}
+}
@@ -0,0 +1,145 @@
+// Package chaos injects faults into the evaluation paths, so that embedders
+// verify their fallback behavior (fail-open or fail-closed) under realistic
+// failures in their tests: slow decisions, corrupted cached decisions, failed
+// decisions, and bundles that are loaded partially or not at all.
+//
+// An Injector wraps an evaluator, and the bundle source and the decisions of
+// a decision point:
+//
+//	in := chaos.New(chaos.Faults{Latency: 50 * time.Millisecond, LatencyRate: 0.1, ErrorRate: 0.01})
+//	e := in.Evaluator(evaluator)
+//	server.BeforeDecision = in.Delay
+//	server.Source = in.Source(server.Source)
+//
+// Faults are drawn from a seeded source, so that failing runs are
+// reproducible. The package is meant for tests, not for production.
+package chaos
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+// ErrInjected is the error of the decisions and the bundle loads that fail
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Faults are the faults to inject, each with its probability from 0 to 1
+type Faults struct {
+	// Latency is added to decisions with probability LatencyRate
+	Latency     time.Duration
+	LatencyRate float64
+	// CorruptRate is the probability that a decision is corrupted: its effect
+	// is flipped, like a corrupted cached decision
+	CorruptRate float64
+	// ErrorRate is the probability that a decision fails with ErrInjected,
+	// and is denied
+	ErrorRate float64
+	// PartialRate is the probability that a bundle is loaded partially, with
+	// some of its policies dropped, and LoadErrorRate the probability that
+	// its load fails with ErrInjected
+	PartialRate, LoadErrorRate float64
+	// Seed seeds the source of the faults
+	Seed int64
+}
+
+// Counts count the faults injected
+type Counts struct {
+	Delayed, Corrupted, Failed, Partial, LoadFailed int
+}
+
+// Injector injects faults. It's safe for concurrent use.
+type Injector struct {
+	f      Faults
+	mu     sync.Mutex
+	r      *rand.Rand
+	counts Counts
+}
+
+// New returns an injector of faults
+func New(f Faults) *Injector {
+	return &Injector{f: f, r: rand.New(rand.NewSource(f.Seed))}
+}
+
+// Counts returns the counts of the faults injected so far
+func (in *Injector) Counts() Counts {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.counts
+}
+
+// roll returns true with probability rate, and counts it in count
+func (in *Injector) roll(rate float64, count *int) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if rate <= 0 || in.r.Float64() >= rate {
+		return false
+	}
+	*count++
+	return true
+}
+
+// Delay sleeps for the latency of the faults with its probability, e.g. as
+// the BeforeDecision hook of a decision point
+func (in *Injector) Delay() {
+	if in.roll(in.f.LatencyRate, &in.counts.Delayed) {
+		time.Sleep(in.f.Latency)
+	}
+}
+
+// Evaluator returns an evaluator injecting latency, corruption and errors
+// into the decisions of e. Explanations are delayed, but not corrupted.
+func (in *Injector) Evaluator(e grok.Evaluator) grok.Evaluator {
+	return &evaluator{e: e, in: in}
+}
+
+type evaluator struct {
+	e  grok.Evaluator
+	in *Injector
+}
+
+func (e *evaluator) Evaluate(an grok.Annotation, opts ...grok.EvalOption) grok.Decision {
+	e.in.Delay()
+	d := e.e.Evaluate(an, opts...)
+	switch {
+	case e.in.roll(e.in.f.ErrorRate, &e.in.counts.Failed):
+		d.Allowed, d.Err = false, ErrInjected
+	case e.in.roll(e.in.f.CorruptRate, &e.in.counts.Corrupted):
+		d.Allowed = !d.Allowed
+	}
+	return d
+}
+
+func (e *evaluator) Explain(an grok.Annotation, opts ...grok.EvalOption) (*grok.Decision, error) {
+	e.in.Delay()
+	return e.e.Explain(an, opts...)
+}
+
+func (e *evaluator) Stats() grok.EvaluatorStats {
+	return e.e.Stats()
+}
+
+// Source returns a bundle source whose loads fail, or load a part of the
+// bundle of src: a random prefix of its policies, with at least one policy
+// dropped
+func (in *Injector) Source(src func() (string, *grok.PolicySet, error)) func() (string, *grok.PolicySet, error) {
+	return func() (string, *grok.PolicySet, error) {
+		if in.roll(in.f.LoadErrorRate, &in.counts.LoadFailed) {
+			return "", nil, ErrInjected
+		}
+		version, set, err := src()
+		if err != nil || set == nil || len(set.Policies) == 0 {
+			return version, set, err
+		}
+		if !in.roll(in.f.PartialRate, &in.counts.Partial) {
+			return version, set, nil
+		}
+		in.mu.Lock()
+		n := in.r.Intn(len(set.Policies))
+		in.mu.Unlock()
+		return version, grok.NewPolicySet(set.Policies[:n]...), nil
+	}
+}
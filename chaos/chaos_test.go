@@ -0,0 +1,87 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/pdp"
+)
+
+func newPolicy(t *testing.T, id string) *grok.Policy {
+	p := grok.NewPolicy(grok.NewLattices(`[
+		{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }
+	]`))
+	p.ID = id
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType AccountID }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return p
+}
+
+func TestEvaluator(t *testing.T) {
+	p := newPolicy(t, "p1")
+	an, err := p.ParseAnnotation("DataType Location")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	e, err := grok.NewEvaluator(p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if d := New(Faults{}).Evaluator(e).Evaluate(an); !d.Allowed || d.Err != nil {
+		t.Errorf("decision without faults = %+v", d)
+	}
+	failing := New(Faults{ErrorRate: 1})
+	if d := failing.Evaluator(e).Evaluate(an); d.Allowed || d.Err != ErrInjected || failing.Counts().Failed != 1 {
+		t.Errorf("failed decision = %+v", d)
+	}
+	corrupting := New(Faults{CorruptRate: 1})
+	if d := corrupting.Evaluator(e).Evaluate(an); d.Allowed || d.Err != nil || corrupting.Counts().Corrupted != 1 {
+		t.Errorf("corrupted decision = %+v", d)
+	}
+
+	// faults are reproducible from their seed
+	counts := make([]Counts, 2)
+	for i := range counts {
+		in := New(Faults{CorruptRate: 0.3, ErrorRate: 0.2, Seed: 42})
+		ce := in.Evaluator(e)
+		for j := 0; j < 100; j++ {
+			ce.Evaluate(an)
+		}
+		counts[i] = in.Counts()
+	}
+	if counts[0] != counts[1] || counts[0].Failed == 0 || counts[0].Corrupted == 0 {
+		t.Errorf("counts = %+v", counts)
+	}
+}
+
+func TestDecisionPoint(t *testing.T) {
+	src := func() (string, *grok.PolicySet, error) {
+		return "v1", grok.NewPolicySet(newPolicy(t, "p1"), newPolicy(t, "p2")), nil
+	}
+
+	// a partial bundle is loaded with a policy missing
+	in := New(Faults{PartialRate: 1, Latency: 50 * time.Millisecond, LatencyRate: 1})
+	s := pdp.NewServer()
+	s.Source, s.BeforeDecision = in.Source(src), in.Delay
+	s.Deadline = 5 * time.Millisecond
+	_, set, err := s.Source()
+	if err != nil || len(set.Policies) > 1 || in.Counts().Partial != 1 {
+		t.Errorf("partial bundle = %v, %v", set, err)
+	}
+
+	// slow decisions are shed
+	if err := s.Load("v1", grok.NewPolicySet(newPolicy(t, "p1"))); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if res, err := s.Decide(grok.Annotation{}); err != nil || !res.Shed || in.Counts().Delayed != 1 {
+		t.Errorf("delayed decision = %+v, %v", res, err)
+	}
+
+	failing := New(Faults{LoadErrorRate: 1})
+	if _, _, err := failing.Source(src)(); err != ErrInjected {
+		t.Errorf("failed load = %v", err)
+	}
+}
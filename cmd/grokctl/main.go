@@ -0,0 +1,337 @@
+// Command grokctl checks policies against annotated data.
+//
+// Usage:
+//
+//	grokctl check-graph -lattices lattices.json -policy policy.txt -graph lineage.json [-watch]
+//	grokctl check-graph -lattices lattices.json -policy policy.txt -openlineage events.ndjson [-watch]
+//
+// check-graph applies the policy on every node of a lineage graph and prints
+// the violating nodes. With -watch, it keeps monitoring the lineage file (or
+// the OpenLineage stream, which is read incrementally as it grows), re-checks
+// the nodes whose annotation changed, and prints a live violation summary.
+//
+//	grokctl plan -config policies.hcl [-baseline baseline.hcl]
+//
+// plan validates an HCL configuration of lattices and policies before it's
+// applied, and prints its findings: lint warnings, and the annotations that it
+// allows while the baseline denies them, which fail the plan.
+//
+//	grokctl corpus -lattices lattices.json -records decisions.jsonl -out corpus/ [-policy policy.txt]
+//
+// corpus exports a decision log as a benchmark corpus, whose lattice,
+// element and policy names are pseudonymized, into the lattices.json and
+// decisions.jsonl files of the output directory, with the policy.snapshot of
+// the pseudonymized policy when -policy is given.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/graph"
+	"github.com/grongjun/grok/hcl"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs a command, and returns the exit code: 0 when successful, 1 when
+// violations are found, and 2 on errors
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: grokctl <command> [flags]\n\ncommands:\n  check-graph\n  corpus\n  plan")
+		return 2
+	}
+	switch args[0] {
+	case "check-graph":
+		return checkGraph(args[1:], stdout, stderr)
+	case "corpus":
+		return corpus(args[1:], stdout, stderr)
+	case "plan":
+		return plan(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "grokctl: unknown command %s\n", args[0])
+		return 2
+	}
+}
+
+func checkGraph(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check-graph", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	lattices := fs.String("lattices", "", "JSON file of the lattice definitions")
+	policy := fs.String("policy", "", "file of the policy")
+	graphPath := fs.String("graph", "", "lineage JSON file")
+	openLineage := fs.String("openlineage", "", "OpenLineage event stream (one JSON event per line)")
+	watch := fs.Bool("watch", false, "keep checking when the lineage changes")
+	interval := fs.Duration("interval", time.Second, "polling interval of -watch")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *lattices == "" || *policy == "" || (*graphPath == "") == (*openLineage == "") {
+		fmt.Fprintln(stderr, "check-graph: -lattices, -policy, and one of -graph or -openlineage are required")
+		return 2
+	}
+
+	p, err := loadPolicy(*lattices, *policy)
+	if err != nil {
+		fmt.Fprintf(stderr, "check-graph: %s\n", err)
+		return 2
+	}
+	var src source
+	if *graphPath != "" {
+		src = &graphFile{path: *graphPath}
+	} else {
+		src = &lineageStream{path: *openLineage}
+	}
+
+	g := graph.NewDataFlowGraph()
+	c := graph.NewIncrementalChecker(p)
+	g, _, err = src.update(g, p)
+	if err != nil {
+		fmt.Fprintf(stderr, "check-graph: %s\n", err)
+		return 2
+	}
+	vs := report(stdout, c, g)
+	if !*watch {
+		if len(vs) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-interrupt:
+			return 0
+		case <-ticker.C:
+			ng, changed, err := src.update(g, p)
+			if err != nil {
+				// keep watching: the file may be in the middle of a rewrite
+				fmt.Fprintf(stderr, "check-graph: %s\n", err)
+				continue
+			}
+			if changed {
+				g = ng
+				report(stdout, c, g)
+			}
+		}
+	}
+}
+
+func plan(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	config := fs.String("config", "", "HCL file of the lattices and policies")
+	baseline := fs.String("baseline", "", "HCL file of the baseline to entail")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *config == "" {
+		fmt.Fprintln(stderr, "plan: -config is required")
+		return 2
+	}
+
+	c, err := hcl.DecodeFile(*config)
+	if err != nil {
+		fmt.Fprintf(stderr, "plan: %s\n", err)
+		return 2
+	}
+	var base *hcl.Config
+	if *baseline != "" {
+		if base, err = hcl.DecodeFile(*baseline); err != nil {
+			fmt.Fprintf(stderr, "plan: %s\n", err)
+			return 2
+		}
+	}
+	code := 0
+	findings := hcl.Plan(c, base)
+	for _, f := range findings {
+		fmt.Fprintln(stdout, f)
+		if f.Level == hcl.Error {
+			code = 1
+		}
+	}
+	fmt.Fprintf(stdout, "%d lattices, %d policies, %d findings\n", len(c.Lattices), len(c.Policies), len(findings))
+	return code
+}
+
+func corpus(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("corpus", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	lattices := fs.String("lattices", "", "JSON file of the lattice definitions")
+	policy := fs.String("policy", "", "file of the policy of the decisions")
+	records := fs.String("records", "", "decision log (one JSON record per line)")
+	out := fs.String("out", "", "output directory of the corpus")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *lattices == "" || *records == "" || *out == "" {
+		fmt.Fprintln(stderr, "corpus: -lattices, -records and -out are required")
+		return 2
+	}
+	if err := exportCorpus(*lattices, *policy, *records, *out, stdout); err != nil {
+		fmt.Fprintf(stderr, "corpus: %s\n", err)
+		return 2
+	}
+	return 0
+}
+
+// exportCorpus writes the pseudonymized lattices, decisions and policy into
+// the output directory
+func exportCorpus(lpath, ppath, rpath, out string, stdout io.Writer) error {
+	lb, err := ioutil.ReadFile(lpath)
+	if err != nil {
+		return err
+	}
+	ls, err := grok.NewLatticesE(string(lb))
+	if err != nil {
+		return err
+	}
+	z := grok.NewPseudonymizer(ls)
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+	write := func(name string, fn func(w io.Writer) error) error {
+		f, err := os.Create(filepath.Join(out, name))
+		if err != nil {
+			return err
+		}
+		if err := fn(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	if err := write("lattices.json", z.WriteDefinitions); err != nil {
+		return err
+	}
+	if ppath != "" {
+		p, err := loadPolicy(lpath, ppath)
+		if err != nil {
+			return err
+		}
+		if err := write("policy.snapshot", z.Policy(p).WriteSnapshot); err != nil {
+			return err
+		}
+	}
+	r, err := os.Open(rpath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	n := 0
+	err = write("decisions.jsonl", func(w io.Writer) error {
+		n, err = z.Copy(w, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%d lattices, %d decisions\n", len(z.Lattices()), n)
+	return nil
+}
+
+// report checks the graph and prints the violation summary
+func report(w io.Writer, c *graph.IncrementalChecker, g *graph.DataFlowGraph) []graph.Violation {
+	vs, rechecked := c.Check(g)
+	fmt.Fprintf(w, "[%s] %d nodes, %d re-checked, %d violations\n",
+		time.Now().Format("15:04:05"), len(g.Nodes), rechecked, len(vs))
+	for _, v := range vs {
+		fmt.Fprintf(w, "  VIOLATION %s: %s\n", v.Node, v.Annotation)
+	}
+	return vs
+}
+
+// loadPolicy reads the lattices and the policy based on them
+func loadPolicy(lpath, ppath string) (*grok.Policy, error) {
+	lb, err := ioutil.ReadFile(lpath)
+	if err != nil {
+		return nil, err
+	}
+	ls, err := grok.NewLatticesE(string(lb))
+	if err != nil {
+		return nil, err
+	}
+	if len(ls) == 0 {
+		return nil, errors.New("no lattice in " + lpath)
+	}
+	pb, err := ioutil.ReadFile(ppath)
+	if err != nil {
+		return nil, err
+	}
+	p := grok.NewPolicy(ls)
+	if err := p.ParsePolicy(string(pb)); err != nil {
+		return nil, err
+	}
+	// the policy is applied on every node, possibly repeatedly
+	p.Compile()
+	return p, nil
+}
+
+// source is where the lineage comes from. update returns the updated graph,
+// and whether it changed since the previous update.
+type source interface {
+	update(g *graph.DataFlowGraph, p *grok.Policy) (*graph.DataFlowGraph, bool, error)
+}
+
+// graphFile is a lineage JSON file, which is reloaded when it's modified
+type graphFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func (f *graphFile) update(g *graph.DataFlowGraph, p *grok.Policy) (*graph.DataFlowGraph, bool, error) {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return g, false, err
+	}
+	if fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return g, false, nil
+	}
+	r, err := os.Open(f.path)
+	if err != nil {
+		return g, false, err
+	}
+	defer r.Close()
+	ng, err := graph.LoadGraph(r, p)
+	if err != nil {
+		return g, false, err
+	}
+	f.modTime, f.size = fi.ModTime(), fi.Size()
+	return ng, true, nil
+}
+
+// lineageStream is an OpenLineage event stream, which is read from where the
+// previous update stopped
+type lineageStream struct {
+	path   string
+	offset int64
+}
+
+func (s *lineageStream) update(g *graph.DataFlowGraph, p *grok.Policy) (*graph.DataFlowGraph, bool, error) {
+	r, err := os.Open(s.path)
+	if err != nil {
+		return g, false, err
+	}
+	defer r.Close()
+	if _, err := r.Seek(s.offset, io.SeekStart); err != nil {
+		return g, false, err
+	}
+	n, err := graph.ApplyOpenLineage(g, p, r)
+	s.offset += n
+	return g, n > 0 || s.offset == 0, err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/graph"
+)
+
+func write(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return path
+}
+
+func TestCheckGraph(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grokctl")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(dir)
+	lattices := write(t, dir, "lattices.json", `[{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }]`)
+	policy := write(t, dir, "policy.txt", `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	graph := write(t, dir, "lineage.json", `{"nodes": [
+		{"id": "clicks", "annotation": "DataType IPAddress"},
+		{"id": "joined", "annotation": "DataType IPAddress DataType AccountID"}]}`)
+	events := write(t, dir, "events.ndjson",
+		`{"inputs": [{"namespace": "db", "name": "clicks", "facets": {"grok": {"annotation": "DataType IPAddress"}}}], "outputs": []}`+"\n")
+
+	cases := []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{[]string{"check-graph", "-lattices", lattices, "-policy", policy, "-graph", graph}, 1,
+			"VIOLATION joined: DataType IPAddress DataType AccountID"},
+		{[]string{"check-graph", "-lattices", lattices, "-policy", policy, "-openlineage", events}, 0,
+			"1 nodes, 1 re-checked, 0 violations"},
+		{[]string{"check-graph", "-lattices", lattices, "-policy", policy}, 2, ""},
+		{[]string{"unknown"}, 2, ""},
+		{[]string{}, 2, ""},
+	}
+	for _, c := range cases {
+		var stdout, stderr bytes.Buffer
+		if code := run(c.args, &stdout, &stderr); code != c.code {
+			t.Errorf("run(%q) = %d, want %d: %s", c.args, code, c.code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), c.out) {
+			t.Errorf("run(%q) printed %q, want %q", c.args, stdout.String(), c.out)
+		}
+	}
+}
+
+func TestLineageStreamUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grokctl")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(dir)
+	lattices := write(t, dir, "lattices.json", `[{ "name": "DataType", "edges": { "UniqueID": ["AccountID"] } }]`)
+	policy := write(t, dir, "policy.txt", `DENY DataType AccountID`)
+	p, err := loadPolicy(lattices, policy)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	path := write(t, dir, "events.ndjson", `{"inputs": [{"namespace": "db", "name": "a"}], "outputs": [{"namespace": "db", "name": "b"}]}`+"\n")
+
+	s := &lineageStream{path: path}
+	g, changed, err := s.update(graph.NewDataFlowGraph(), p)
+	if err != nil || !changed || len(g.Nodes) != 2 {
+		t.Fatalf("update() = %v, %t, %v", g, changed, err)
+	}
+	if _, changed, _ := s.update(g, p); changed {
+		t.Errorf("update() without new events should not change the graph")
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"inputs": [{"namespace": "db", "name": "b"}], "outputs": [{"namespace": "db", "name": "c"}]}` + "\n")
+	f.Close()
+	if g, changed, err = s.update(g, p); err != nil || !changed || len(g.Nodes) != 3 {
+		t.Errorf("update() = %v, %t, %v", g, changed, err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grokctl")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(dir)
+	lattice := `lattice "DataType" {
+  edges = { UniqueID = ["AccountID", "IPAddress"], Location = ["IPAddress"] }
+}
+`
+	baseline := write(t, dir, "baseline.hcl", lattice+`policy "no-joins" {
+  rule = "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"
+}`)
+	loosened := write(t, dir, "loosened.hcl", lattice+`policy "no-joins" {
+  rule = "ALLOW DataType TOP"
+}`)
+	invalid := write(t, dir, "invalid.hcl", `policy "p" {`)
+
+	cases := []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{[]string{"plan", "-config", baseline, "-baseline", baseline}, 0, "1 lattices, 1 policies, 0 findings"},
+		{[]string{"plan", "-config", loosened, "-baseline", baseline}, 1, "error: allows"},
+		{[]string{"plan", "-config", loosened}, 0, "0 findings"},
+		{[]string{"plan", "-config", invalid}, 2, ""},
+		{[]string{"plan"}, 2, ""},
+	}
+	for _, c := range cases {
+		var stdout, stderr bytes.Buffer
+		if code := run(c.args, &stdout, &stderr); code != c.code {
+			t.Errorf("run(%q) = %d, want %d: %s", c.args, code, c.code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), c.out) {
+			t.Errorf("run(%q) printed %q, want %q", c.args, stdout.String(), c.out)
+		}
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grokctl")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(dir)
+	lattices := write(t, dir, "lattices.json", `[{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }]`)
+	policy := write(t, dir, "policy.txt", `ALLOW DataType TOP EXCEPT { DENY DataType AccountID }`)
+	records := write(t, dir, "decisions.jsonl", `{"annotation":[["DataType","AccountID"]],"policy":"p1","effect":"DENY"}`+"\n")
+	out := filepath.Join(dir, "corpus")
+
+	cases := []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{[]string{"corpus", "-lattices", lattices, "-policy", policy, "-records", records, "-out", out}, 0, "1 lattices, 1 decisions"},
+		{[]string{"corpus", "-lattices", lattices, "-records", filepath.Join(dir, "missing.jsonl"), "-out", out}, 2, ""},
+		{[]string{"corpus", "-lattices", lattices}, 2, ""},
+	}
+	for _, c := range cases {
+		var stdout, stderr bytes.Buffer
+		if code := run(c.args, &stdout, &stderr); code != c.code {
+			t.Errorf("run(%q) = %d, want %d: %s", c.args, code, c.code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), c.out) {
+			t.Errorf("run(%q) printed %q, want %q", c.args, stdout.String(), c.out)
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(out, "decisions.jsonl"))
+	if err != nil || strings.Contains(string(b), "AccountID") || !strings.Contains(string(b), `"policy":"P1"`) {
+		t.Errorf("decisions.jsonl = %s, %v", b, err)
+	}
+	f, err := os.Open(filepath.Join(out, "policy.snapshot"))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer f.Close()
+	p, err := grok.ReadSnapshot(f)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	recs, err := grok.ReadRecords(strings.NewReader(string(b)))
+	if err != nil || len(recs) != 1 || p.Evaluate(recs[0].Annotation).Allowed {
+		t.Errorf("the pseudonymized policy should deny %v: %v", recs, err)
+	}
+}
@@ -0,0 +1,178 @@
+package grok
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Compatibility is a pairwise compatibility matrix over purposes, for purposes
+// that aren't hierarchical. It backs a compatibility attribute, e.g. the
+// purposes that data was collected for:
+//
+//	{
+//	 "name": "CollectedFor",
+//	 "compatible": {
+//	     "Billing": ["Analytics", "FraudDetection"],
+//	     "Research": ["Analytics"]
+//	 }
+//	}
+//
+// The relation is symmetric and reflexive, so the matrix above makes Analytics
+// compatible with Analytics, Billing and Research.
+//
+// A compatibility attribute is used in annotations like any other attribute
+// (CollectedFor Billing), and in policy clauses it conditions a lattice pair:
+//
+//	ALLOW Purpose Analytics COMPATIBLEWITH CollectedFor
+//
+// allows Analytics (or below) only when it's compatible with every purpose the
+// data was collected for. In a DENY clause, the condition restricts the deny to
+// the compatible values.
+type Compatibility struct {
+	Name       string
+	compatible map[string]map[string]bool
+}
+
+// NewCompatibility returns a Compatibility instance that is parsed from a string
+func NewCompatibility(str string) (*Compatibility, error) {
+	var def struct {
+		Name       string              `json:"name"`
+		Compatible map[string][]string `json:"compatible"`
+	}
+	if err := json.Unmarshal([]byte(str), &def); err != nil {
+		return nil, err
+	}
+	if def.Name == "" {
+		return nil, errors.New("compatibility: name should not be empty")
+	}
+	c := &Compatibility{def.Name, make(map[string]map[string]bool)}
+	for a, bs := range def.Compatible {
+		c.add(a, a)
+		for _, b := range bs {
+			c.add(a, b)
+			c.add(b, a)
+			c.add(b, b)
+		}
+	}
+	return c, nil
+}
+
+func (c *Compatibility) add(a, b string) {
+	if c.compatible[a] == nil {
+		c.compatible[a] = make(map[string]bool)
+	}
+	c.compatible[a][b] = true
+}
+
+// Elements returns the sorted elements of the matrix
+func (c *Compatibility) Elements() []string {
+	es := make([]string, 0, len(c.compatible))
+	for e := range c.compatible {
+		es = append(es, e)
+	}
+	sort.Strings(es)
+	return es
+}
+
+// Compatible returns true when a and b are compatible
+func (c *Compatibility) Compatible(a, b string) bool {
+	return c.compatible[a][b]
+}
+
+// DefineCompatibility declares a compatibility attribute for the policy, named after the matrix
+func (p *Policy) DefineCompatibility(c *Compatibility) error {
+	if _, ok := p.baseOn[c.Name]; ok || p.isNumeric(c.Name) {
+		return errors.New(fmt.Sprintf("policy: %s is already an attribute name", c.Name))
+	}
+	if p.compats == nil {
+		p.compats = make(map[string]*Compatibility)
+	}
+	p.compats[c.Name] = c
+	return nil
+}
+
+// isCompatibility returns true when name is a compatibility attribute of the policy
+func (p *Policy) isCompatibility(name string) bool {
+	_, ok := p.compats[name]
+	return ok
+}
+
+// CompatibilityValue returns a valid value of a compatibility attribute, or returns error
+func (p *Policy) CompatibilityValue(s string, name string) (string, error) {
+	if _, ok := p.compats[name].compatible[s]; !ok {
+		return "", errors.New(fmt.Sprintf("policy: %s is not a valid value in compatibility %s", s, name))
+	}
+	return s, nil
+}
+
+// compatibleWith returns true when v is compatible with every value of the
+// compatibility attribute name in the annotation. An annotation without
+// values of the attribute is compatible with nothing, since nothing says what
+// the data was collected for.
+func (p *Policy) compatibleWith(v, name string, an Annotation) bool {
+	c := p.compats[name]
+	ws := an.ValuesOf(name)
+	if len(ws) == 0 {
+		return false
+	}
+	for _, w := range ws {
+		if !c.Compatible(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowCompatible returns false when an annotation value covered by a
+// conditioned pair of an ALLOW clause isn't compatible
+func (p *Policy) allowCompatible(an Annotation) bool {
+	for _, pa := range p.Clause {
+		if pa.compatWith == "" {
+			continue
+		}
+		l := p.baseOn[pa.name]
+		for _, v := range an.ValuesOf(pa.name) {
+			if l.Precede(v, pa.value) && !p.compatibleWith(compatElement(l, v), pa.compatWith, an) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// denyCompatible returns false when a conditioned pair of a DENY clause
+// doesn't overlap with any compatible annotation value
+func (p *Policy) denyCompatible(an Annotation) bool {
+	for _, pa := range p.Clause {
+		if pa.compatWith == "" {
+			continue
+		}
+		l := p.baseOn[pa.name]
+		values := an.ValuesOf(pa.name)
+		if len(values) == 0 {
+			continue
+		}
+		matched := false
+		for _, v := range values {
+			if !l.isBottom(l.Meet(v, pa.value)) && p.compatibleWith(compatElement(l, v), pa.compatWith, an) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// compatElement returns the element of a value that is looked up in the
+// compatibility matrices, i.e. the element of a product value without its state
+func compatElement(l *Lattice, v string) string {
+	if l.isProductValue(v) {
+		v, _ = l.halve(v)
+	}
+	return v
+}
@@ -0,0 +1,143 @@
+package grok
+
+import (
+	"testing"
+)
+
+func newCompatPolicy(t *testing.T, pstr string) *Policy {
+	purpose := NewLattice(`{ "name": "Purpose",
+		"edges": {
+			"Analytics": ["Research"],
+			"Marketing": [],
+			"Billing": [] }
+		}`)
+	c, err := NewCompatibility(`{ "name": "CollectedFor",
+		"compatible": {
+			"Billing": ["Analytics", "Research"],
+			"Marketing": [] }
+		}`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	p := NewPolicy([]*Lattice{purpose})
+	if err := p.DefineCompatibility(c); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := p.ParsePolicy(pstr); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return p
+}
+
+func TestCompatible(t *testing.T) {
+	c, err := NewCompatibility(`{ "name": "CollectedFor", "compatible": { "Billing": ["Analytics"] } }`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	cases := []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		{"Billing", "Analytics", true},
+		{"Analytics", "Billing", true},
+		{"Analytics", "Analytics", true},
+		{"Analytics", "Marketing", false},
+	}
+	for _, tc := range cases {
+		if got := c.Compatible(tc.a, tc.b); got != tc.want {
+			t.Errorf("Compatible(%q, %q) = %t, want %t", tc.a, tc.b, got, tc.want)
+		}
+	}
+	if got := c.Elements(); !equals(got, []string{"Analytics", "Billing"}) {
+		t.Errorf("Elements() = %q", got)
+	}
+	if _, err := NewCompatibility(`{ "compatible": {} }`); err == nil {
+		t.Errorf("NewCompatibility without name should fail")
+	}
+}
+
+func TestDefineCompatibilityLiteral(t *testing.T) {
+	// a policy that isn't made with NewPolicy has no compatibilities yet
+	c, err := NewCompatibility(`{ "name": "CollectedFor", "compatible": { "Billing": ["Analytics"] } }`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	p := &Policy{}
+	if err := p.DefineCompatibility(c); err != nil || !p.isCompatibility("CollectedFor") {
+		t.Errorf("DefineCompatibility(CollectedFor) = %v", err)
+	}
+}
+
+func TestApplyOnCompatible(t *testing.T) {
+	pallow := `ALLOW Purpose Analytics COMPATIBLEWITH CollectedFor`
+	pdeny := `DENY Purpose TOP COMPATIBLEWITH CollectedFor`
+	cases := []struct {
+		pstr string
+		astr string
+		want bool
+	}{
+		{pallow, "Purpose Analytics CollectedFor Billing", true},
+		{pallow, "Purpose Research CollectedFor Billing", true},
+		{pallow, "Purpose Analytics CollectedFor Marketing", false},
+		{pallow, "Purpose Analytics CollectedFor Billing CollectedFor Marketing", false},
+		// without CollectedFor, nothing is compatible
+		{pallow, "Purpose Analytics", false},
+		{pdeny, "Purpose Analytics CollectedFor Billing", false},
+		{pdeny, "Purpose Analytics CollectedFor Marketing", true},
+		{pdeny, "Purpose Analytics", true},
+	}
+	for _, c := range cases {
+		p := newCompatPolicy(t, c.pstr)
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := p.ApplyOn(an); got != c.want {
+			t.Errorf("Apply [%q] on [%q]: %t, want %t", c.pstr, c.astr, got, c.want)
+		}
+	}
+}
+
+func TestParseCompatibleErrors(t *testing.T) {
+	p := newCompatPolicy(t, `ALLOW Purpose TOP`)
+	cases := []string{
+		`ALLOW COMPATIBLEWITH CollectedFor`,
+		`ALLOW Purpose Analytics COMPATIBLEWITH Purpose`,
+		`ALLOW Purpose Analytics CollectedFor Unknown`,
+	}
+	for _, c := range cases {
+		if err := p.ParsePolicy(c); err == nil {
+			t.Errorf("ParsePolicy(%q) should fail", c)
+		}
+	}
+}
+
+func TestApplyOnCompatibleProduct(t *testing.T) {
+	p := newCompatPolicy(t, `ALLOW Purpose TOP`)
+	p.baseOn["Purpose"].Product(NewLattice(`{ "name": "Consent", "edges": { "Given": [], "Withdrawn": [] } }`))
+	cases := []struct {
+		pstr string
+		astr string
+		want bool
+	}{
+		{`ALLOW Purpose Analytics COMPATIBLEWITH CollectedFor`, "Purpose Research:Given CollectedFor Billing", true},
+		{`DENY Purpose Research:Withdrawn COMPATIBLEWITH CollectedFor`, "Purpose Research:Withdrawn CollectedFor Billing", false},
+		// the clause overlaps with the values together, but their meets with
+		// it are Research:BOTTOM and BOTTOM:Withdrawn, i.e. bottom
+		{`DENY Purpose Research:Withdrawn COMPATIBLEWITH CollectedFor`,
+			"Purpose Analytics:Given Purpose Marketing:Withdrawn CollectedFor Billing", true},
+	}
+	for _, c := range cases {
+		if err := p.ParsePolicy(c.pstr); err != nil {
+			t.Fatalf("%q", err)
+		}
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := p.ApplyOn(an); got != c.want {
+			t.Errorf("Apply [%q] on [%q]: %t, want %t", c.pstr, c.astr, got, c.want)
+		}
+	}
+}
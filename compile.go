@@ -0,0 +1,190 @@
+package grok
+
+// closure is the compiled closure of a lattice. It's never modified once
+// built, so that it can be read while the lattice is compiled again.
+type closure struct {
+	symbols *Symbols
+	below   []bitset
+	above   []bitset
+}
+
+// Compile precomputes the closure of the lattice: its elements are interned
+// as IDs, and the elements below and above every element are kept as bitsets,
+// so that Precede, Allow, Meet and Join don't walk the edges anymore. Large
+// lattices are compiled when they're built, see CompileThreshold. It must be
+// called again after the edges change. It's safe to compile a lattice
+// while it's used.
+func (l *Lattice) Compile() {
+	symbols := NewSymbols()
+	for _, e := range l.Elements() {
+		symbols.Intern(e)
+	}
+	n := symbols.Len()
+	children := make([][]int, n)
+	for _, e := range l.Edges {
+		from, _ := symbols.ID(e.From)
+		to, _ := symbols.ID(e.To)
+		children[from] = append(children[from], to)
+	}
+
+	below := make([]bitset, n)
+	var visit func(id int)
+	visit = func(id int) {
+		if below[id] != nil {
+			return
+		}
+		below[id] = newBitset(n)
+		below[id].set(id)
+		for _, ch := range children[id] {
+			visit(ch)
+			below[id].union(below[ch])
+		}
+	}
+	for id := 0; id < n; id++ {
+		visit(id)
+	}
+	l.setClosure(symbols, below)
+}
+
+// CompileThreshold is the number of elements from which the lattices built by
+// NewLattice, NewLattices, their E variants and LatticeBuilder are compiled
+// when they're built, since walking the edges of large taxonomies is slow
+const CompileThreshold = 256
+
+// autoCompile compiles the lattice when it has CompileThreshold elements or
+// more
+func (l *Lattice) autoCompile() {
+	if len(l.Elements()) >= CompileThreshold {
+		l.Compile()
+	}
+}
+
+// setClosure sets the compiled closure of the lattice from the elements below
+// every element, and derives the elements above them
+func (l *Lattice) setClosure(symbols *Symbols, below []bitset) {
+	n := symbols.Len()
+	above := make([]bitset, n)
+	for id := range above {
+		above[id] = newBitset(n)
+	}
+	for id, bs := range below {
+		bs.each(func(b int) {
+			above[b].set(id)
+		})
+	}
+	l.compiled.Store(&closure{symbols, below, above})
+}
+
+// closure returns the compiled closure of the lattice, or nil
+func (l *Lattice) closure() *closure {
+	c, _ := l.compiled.Load().(*closure)
+	return c
+}
+
+// Compiled returns true when the lattice has a compiled closure
+func (l *Lattice) Compiled() bool {
+	return l.closure() != nil
+}
+
+// Symbols returns the symbol table of the lattice elements, compiling the
+// lattice if needed. The table must not be modified.
+func (l *Lattice) Symbols() *Symbols {
+	if !l.Compiled() {
+		l.Compile()
+	}
+	return l.closure().symbols
+}
+
+// precedeCompiled returns whether a precedes b from the compiled closure, and
+// false as second result when the lattice isn't compiled or doesn't know a or b.
+// BOTTOM is left to the walk of Precede, which stops before reaching it.
+func (l *Lattice) precedeCompiled(a, b string) (bool, bool) {
+	c := l.closure()
+	if c == nil || a == Bottom {
+		return false, false
+	}
+	ia, ok := c.symbols.ID(a)
+	if !ok {
+		return false, false
+	}
+	ib, ok := c.symbols.ID(b)
+	if !ok {
+		return false, false
+	}
+	l.visit(1)
+	return c.below[ib].has(ia), true
+}
+
+// allowCompiled is Allow on IDs, with the second result like precedeCompiled
+func (l *Lattice) allowCompiled(pattrs, aattrs []string) (bool, bool) {
+	c := l.closure()
+	if c == nil || contains(aattrs, Bottom) {
+		return false, false
+	}
+	pids, ok := c.symbols.IDs(pattrs)
+	if !ok {
+		return false, false
+	}
+	aids, ok := c.symbols.IDs(aattrs)
+	if !ok {
+		return false, false
+	}
+	for _, a := range aids {
+		allowed := false
+		for _, p := range pids {
+			l.visit(1)
+			if c.below[p].has(a) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// meetCompiled is Meet on IDs, with the second result like bound
+func (l *Lattice) meetCompiled(a, b string) (string, bool) {
+	if c := l.closure(); c != nil {
+		l.visit(1)
+		return c.bound(a, b, c.below)
+	}
+	return "", false
+}
+
+// joinCompiled is Join on IDs, with the second result like bound
+func (l *Lattice) joinCompiled(a, b string) (string, bool) {
+	if c := l.closure(); c != nil {
+		l.visit(1)
+		return c.bound(a, b, c.above)
+	}
+	return "", false
+}
+
+// bound returns the greatest element of the common bound of a and b, i.e.
+// their meet when bounds is below and their join when bounds is above.
+// The second result is false when the closure doesn't know a or b, or the
+// bound has no greatest element.
+func (c *closure) bound(a, b string, bounds []bitset) (string, bool) {
+	ia, ok := c.symbols.ID(a)
+	if !ok {
+		return "", false
+	}
+	ib, ok := c.symbols.ID(b)
+	if !ok {
+		return "", false
+	}
+	common := bounds[ia].intersect(bounds[ib])
+	res := -1
+	common.each(func(id int) {
+		if res < 0 && bounds[id].covers(common) {
+			res = id
+		}
+	})
+	if res < 0 {
+		return "", false
+	}
+	return c.symbols.Name(res), true
+}
@@ -0,0 +1,130 @@
+package grok
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	ls := []*Lattice{
+		NewLattice(`{ "name": "DataType",
+			"edges": {
+				"UniqueID": ["AccountID", "IPAddress"],
+				"Location": ["IPAddress"],
+				"Birthday": [] }
+			}`),
+		NewLattice(`{ "name": "Diamond",
+			"edges": {
+				"A": ["B", "C"],
+				"B": ["D"],
+				"C": ["D"],
+				"D": ["E", "F"] }
+			}`),
+	}
+	for _, l := range ls {
+		es := l.Elements()
+		type result struct {
+			precede    bool
+			meet, join string
+		}
+		want := make(map[[2]string]result)
+		for _, a := range es {
+			for _, b := range es {
+				want[[2]string{a, b}] = result{l.Precede(a, b), l.Meet(a, b), l.Join(a, b)}
+			}
+		}
+		l.Compile()
+		if !l.Compiled() || l.Symbols().Len() != len(es) {
+			t.Fatalf("lattice %s isn't compiled", l.Name)
+		}
+		for _, a := range es {
+			for _, b := range es {
+				got := result{l.Precede(a, b), l.Meet(a, b), l.Join(a, b)}
+				if got != want[[2]string{a, b}] {
+					t.Errorf("%s: (%q, %q) = %+v after Compile(), want %+v", l.Name, a, b, got, want[[2]string{a, b}])
+				}
+			}
+		}
+		if _, ok := l.precedeCompiled("Unknown", Top); ok {
+			t.Errorf("precedeCompiled() should fall back on unknown elements")
+		}
+	}
+}
+
+func TestAllowCompiled(t *testing.T) {
+	l := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	l.Compile()
+	cases := []struct {
+		pattrs []string
+		aattrs []string
+		want   bool
+		ok     bool
+	}{
+		{[]string{"UniqueID"}, []string{"AccountID", "IPAddress"}, true, true},
+		{[]string{"Location"}, []string{"AccountID", "IPAddress"}, false, true},
+		{[]string{"Location", "AccountID"}, []string{"AccountID", "IPAddress"}, true, true},
+		{[]string{"UniqueID"}, []string{}, true, true},
+		{[]string{"UniqueID"}, []string{"Unknown"}, false, false},
+		{[]string{"UniqueID"}, []string{"AccountID:Raw"}, false, false},
+	}
+	for _, c := range cases {
+		got, ok := l.allowCompiled(c.pattrs, c.aattrs)
+		if got != c.want || ok != c.ok {
+			t.Errorf("allowCompiled(%q, %q) = %t, %t, want %t, %t", c.pattrs, c.aattrs, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestAutoCompile(t *testing.T) {
+	if NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID"] } }`).Compiled() {
+		t.Errorf("small lattices shouldn't be compiled when they're built")
+	}
+
+	// a binary tree of 4000 elements, N0 above N1 and N2, and so on
+	edges := make([]string, 0)
+	for i := 0; 2*i+1 < 4000; i++ {
+		children := fmt.Sprintf(`"N%d"`, 2*i+1)
+		if 2*i+2 < 4000 {
+			children += fmt.Sprintf(`, "N%d"`, 2*i+2)
+		}
+		edges = append(edges, fmt.Sprintf(`"N%d": [%s]`, i, children))
+	}
+	l := NewLattice(`{ "name": "Taxonomy", "edges": {` + strings.Join(edges, ", ") + `} }`)
+	if !l.Compiled() {
+		t.Fatalf("large lattices should be compiled when they're built")
+	}
+	b := NewLatticeBuilder("Taxonomy")
+	tree := make([]Edge, 0, 3999)
+	for i := 1; i < 4000; i++ {
+		tree = append(tree, Edge{From: fmt.Sprintf("N%d", (i-1)/2), To: fmt.Sprintf("N%d", i)})
+	}
+	if _, err := b.AddEdges(tree); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if !b.Build().Compiled() {
+		t.Errorf("large built lattices should be compiled")
+	}
+	cases := []struct {
+		a, b       string
+		precede    bool
+		meet, join string
+	}{
+		{"N3999", "N0", true, "N3999", "N0"},
+		{"N3999", "N2", true, "N3999", "N2"},
+		{"N3999", "N1", false, Bottom, "N0"},
+		{"N7", "N8", false, Bottom, "N3"},
+	}
+	for _, c := range cases {
+		if got := l.Precede(c.a, c.b); got != c.precede {
+			t.Errorf("Precede(%s, %s) = %v, want %v", c.a, c.b, got, c.precede)
+		}
+		if got := l.Meet(c.a, c.b); got != c.meet {
+			t.Errorf("Meet(%s, %s) = %s, want %s", c.a, c.b, got, c.meet)
+		}
+		if got := l.Join(c.a, c.b); got != c.join {
+			t.Errorf("Join(%s, %s) = %s, want %s", c.a, c.b, got, c.join)
+		}
+	}
+}
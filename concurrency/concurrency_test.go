@@ -0,0 +1,129 @@
+package concurrency
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+const workers = 8
+
+func lattices() (*grok.Lattice, *grok.Lattice) {
+	dt := grok.NewLattice(`{ "name": "DataType",
+		"edges": {
+			"UniqueID": ["AccountID", "IPAddress"],
+			"Location": ["IPAddress"] },
+		"labels": { "de": { "IPAddress": "IP-Adresse" } }
+		}`)
+	state := grok.NewLattice(`{ "name": "TypeState", "edges": { "Raw": ["Truncated"] } }`)
+	dt.Product(state)
+	return dt, state
+}
+
+func parse(t *testing.T, dt *grok.Lattice, pstr string) *grok.Policy {
+	p := grok.NewPolicy([]*grok.Lattice{dt})
+	if err := p.ParsePolicy(pstr); err != nil {
+		t.Errorf("%q", err)
+	}
+	return p
+}
+
+// run runs fn in workers goroutines, n times each
+func run(n int, fn func(w, i int)) {
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				fn(w, i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestEvaluate(t *testing.T) {
+	dt, state := lattices()
+	p := parse(t, dt, `ALLOW DataType TOP EXCEPT {
+		DENY DataType IPAddress:Raw DataType AccountID
+		DENY MODE=monitor DataType AccountID }`)
+	cases := []struct {
+		astr    string
+		allowed bool
+	}{
+		{"DataType IPAddress:Raw DataType AccountID", false},
+		{"DataType IPAddress:Truncated DataType AccountID", false},
+		{"DataType Location", true},
+		{"DataType AccountID", true},
+	}
+	ans := make([]grok.Annotation, len(cases))
+	for i, c := range cases {
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		ans[i] = an
+	}
+
+	var buf bytes.Buffer
+	sink := grok.NewRecordWriter(&buf)
+	z := grok.NewLocalizer("en")
+	run(200, func(w, i int) {
+		switch w {
+		case 0:
+			// the lattices are compiled, and their product set, while they're used
+			dt.Compile()
+			dt.Product(state)
+		case 1:
+			// other policies are parsed on the same lattices
+			parse(t, dt, `DENY DataType UniqueID EXCEPT { ALLOW DataType IPAddress:Truncated }`)
+			z.AddLattice(dt)
+		default:
+			c := cases[i%len(cases)]
+			if d := p.Evaluate(ans[i%len(cases)], grok.WithAuditSink(sink)); d.Allowed != c.allowed {
+				t.Errorf("Evaluate(%q) = %+v", c.astr, d)
+			}
+			if _, err := p.ExplainText(ans[i%len(cases)], grok.WithLocalizer(z), grok.WithLocale("de")); err != nil {
+				t.Errorf("%q", err)
+			}
+		}
+	})
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != (workers-2)*200 {
+		t.Errorf("%d records, want %d", n, (workers-2)*200)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dt, _ := lattices()
+	r := grok.NewRegistry(grok.DenyOverrides)
+	ps := grok.NewPolicySet()
+	allow := parse(t, dt, `ALLOW DataType TOP`)
+	r.Register("org", allow)
+	an, err := allow.ParseAnnotation("DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	run(100, func(w, i int) {
+		switch w {
+		case 0:
+			// a policy is reloaded by parsing a new one and registering it
+			r.Register("org/unit", parse(t, dt, `DENY DataType AccountID`))
+		case 1:
+			ps.Add(allow)
+		default:
+			if _, err := r.Evaluate("org/unit/dataset", an); err != nil {
+				t.Errorf("%q", err)
+			}
+			if !ps.ApplyOn(an) || len(ps.Denying(an)) != 0 {
+				t.Errorf("the policy set should allow %q", an)
+			}
+		}
+	})
+	if d, err := r.Evaluate("org/unit/dataset", an); err != nil || d.Allowed {
+		t.Errorf("Evaluate() = %+v, %v", d, err)
+	}
+}
@@ -0,0 +1,6 @@
+// Package concurrency holds the concurrency tests of grok, which exercise the
+// documented guarantees of the API from many goroutines. They are meant to be
+// run with the race detector:
+//
+//	go test -race ./concurrency
+package concurrency
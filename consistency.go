@@ -0,0 +1,147 @@
+package grok
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Validate returns a *LatticeError when the lattice isn't consistent: when
+// its edges have duplicates or cycles, which make Meet and Join loop or
+// return wrong results, when TOP has parents or BOTTOM children, when an
+// element is reachable from neither TOP nor BOTTOM, or when the weights,
+// labels or deprecations reference elements that the lattice doesn't have.
+// NewLatticeE only validates the definition, so that Validate is the check
+// to run at load time, or after edges are added to a lattice.
+func (l *Lattice) Validate() error {
+	fail := func(key, format string, args ...interface{}) error {
+		return &LatticeError{Lattice: l.Name, Key: key, Err: fmt.Sprintf(format, args...)}
+	}
+	children := make(map[string][]string)
+	parents := make(map[string][]string)
+	seen := make(map[Edge]bool)
+	for _, e := range l.Edges {
+		if seen[e] {
+			return fail("edges", "the edge %s -> %s is duplicated", e.From, e.To)
+		}
+		seen[e] = true
+		if e.To == Top {
+			return fail("edges", "%s can't have parents, e.g. %s", Top, e.From)
+		}
+		if e.From == Bottom {
+			return fail("edges", "%s can't have children, e.g. %s", Bottom, e.To)
+		}
+		children[e.From] = append(children[e.From], e.To)
+		parents[e.To] = append(parents[e.To], e.From)
+	}
+	es := l.Elements()
+
+	// the cycles are found by depth-first search, from the sorted elements
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	path := make([]string, 0)
+	var cycle []string
+	var visit func(e string) bool
+	visit = func(e string) bool {
+		state[e] = visiting
+		path = append(path, e)
+		for _, c := range children[e] {
+			if state[c] == visiting {
+				for i, p := range path {
+					if p == c {
+						cycle = append(append([]string(nil), path[i:]...), c)
+						break
+					}
+				}
+				return true
+			}
+			if state[c] == unvisited && visit(c) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		state[e] = visited
+		return false
+	}
+	for _, e := range es {
+		if state[e] == unvisited && visit(e) {
+			return fail("edges", "the edges have a cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	reached := make(map[string]bool)
+	for _, walk := range []struct {
+		from string
+		next map[string][]string
+	}{{Top, children}, {Bottom, parents}} {
+		walked := make(map[string]bool)
+		stack := []string{walk.from}
+		for len(stack) > 0 {
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if walked[e] {
+				continue
+			}
+			walked[e], reached[e] = true, true
+			stack = append(stack, walk.next[e]...)
+		}
+	}
+	for _, e := range es {
+		if !reached[e] {
+			return fail("edges", "%s is reachable from neither %s nor %s", e, Top, Bottom)
+		}
+	}
+
+	has := func(e string) bool {
+		i := sort.SearchStrings(es, e)
+		return i < len(es) && es[i] == e
+	}
+	for _, e := range sortedWeights(l.Weights) {
+		if !has(e) {
+			return fail("weights", "%s isn't an element", e)
+		}
+	}
+	locales := make([]string, 0, len(l.Labels))
+	for locale := range l.Labels {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	for _, locale := range locales {
+		for _, e := range sortedLabels(l.Labels[locale]) {
+			if !has(e) {
+				return fail("labels", "%s of locale %s isn't an element", e, locale)
+			}
+		}
+	}
+	for _, e := range sortedLabels(l.Deprecated) {
+		if !has(e) {
+			return fail("deprecated", "%s isn't an element", e)
+		}
+		if r := l.Deprecated[e]; r != "" && !has(r) {
+			return fail("deprecated", "the replacement %s of %s isn't an element", r, e)
+		}
+	}
+	return nil
+}
+
+func sortedWeights(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedLabels(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
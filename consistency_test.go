@@ -0,0 +1,50 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestLatticeValidate(t *testing.T) {
+	valid := func() *Lattice {
+		return NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] },
+			"deprecated": { "Location": "" } }`)
+	}
+	if err := valid().Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	duplicated := valid()
+	duplicated.Edges = append(duplicated.Edges, Edge{"UniqueID", "AccountID"})
+	topParent := valid()
+	topParent.Edges = append(topParent.Edges, Edge{"IPAddress", Top})
+	weighted := valid()
+	weighted.Weights["Birthday"] = 3
+	deprecated := valid()
+	deprecated.Deprecated["Location"] = "Address"
+	for _, test := range []struct {
+		name string
+		l    *Lattice
+		err  string
+	}{
+		{"duplicate", duplicated, "lattice: DataType: edges: the edge UniqueID -> AccountID is duplicated"},
+		{"cycle", NewLattice(`{ "name": "DataType", "edges": { "A": ["B"], "B": ["C"], "C": ["A"], "D": [] } }`),
+			"lattice: DataType: edges: the edges have a cycle A -> B -> C -> A"},
+		{"top", topParent, "lattice: DataType: edges: TOP can't have parents, e.g. IPAddress"},
+		{"bottom", &Lattice{Name: "DataType", Edges: []Edge{{Top, "A"}, {"A", Bottom}, {Bottom, "B"}}},
+			"lattice: DataType: edges: BOTTOM can't have children, e.g. B"},
+		{"unreachable", &Lattice{Name: "DataType", Edges: []Edge{{Top, "A"}, {"A", Bottom}, {"B", "C"}}},
+			"lattice: DataType: edges: B is reachable from neither TOP nor BOTTOM"},
+		{"weights", weighted, "lattice: DataType: weights: Birthday isn't an element"},
+		{"deprecated", deprecated, "lattice: DataType: deprecated: the replacement Address of Location isn't an element"},
+	} {
+		if err := test.l.Validate(); err == nil || err.Error() != test.err {
+			t.Errorf("%s: Validate() = %v, want %s", test.name, err, test.err)
+		}
+	}
+
+	// a lattice built without NewLattice is reachable from BOTTOM only
+	partial := &Lattice{Name: "DataType", Edges: []Edge{{"A", "B"}, {"B", Bottom}}}
+	if err := partial.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
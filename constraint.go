@@ -0,0 +1,113 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Requires is the keyword of constraints, see ParseConstraint
+const Requires = "REQUIRES"
+
+// Constraint is a constraint between lattices: a value of an attribute is
+// only meaningful together with a value of another attribute, e.g. TypeState
+// Encrypted only for data below DataType UniqueID. The attributes are the
+// lattices of the policy, or their state lattices, whose values are the
+// second halves of product values, e.g. Encrypted in IPAddress:Encrypted.
+type Constraint struct {
+	// Attribute and Value are the constrained values: Value and the values
+	// below it
+	Attribute, Value string
+	// Required and Bound are the values the constrained values require: Bound
+	// and the values below it. The product value of a constrained state
+	// requires its own first half to be below Bound.
+	Required, Bound string
+}
+
+// String returns the constraint in its syntax, see ParseConstraint
+func (c Constraint) String() string {
+	return strings.Join([]string{c.Attribute, c.Value, Requires, c.Required, c.Bound}, " ")
+}
+
+// ParseConstraint parses a constraint between lattices of the policy, e.g.
+//
+//	TypeState Encrypted REQUIRES DataType UniqueID
+func (p *Policy) ParseConstraint(str string) (Constraint, error) {
+	ts := strings.Fields(str)
+	if len(ts) != 5 || ts[2] != Requires {
+		return Constraint{}, errors.New(fmt.Sprintf("policy: constraint %q should be of the form <attribute> <value> REQUIRES <attribute> <value>", str))
+	}
+	c := Constraint{ts[0], ts[1], ts[3], ts[4]}
+	for _, pa := range [][2]string{{c.Attribute, c.Value}, {c.Required, c.Bound}} {
+		l := p.latticeOf(pa[0])
+		if l == nil {
+			return Constraint{}, errors.New(fmt.Sprintf("policy: constraint %q refers to unknown lattice %s", str, pa[0]))
+		}
+		if !l.hasElement(pa[1]) {
+			return Constraint{}, errors.New(fmt.Sprintf("policy: constraint %q refers to unknown element %s of lattice %s", str, pa[1], pa[0]))
+		}
+	}
+	return c, nil
+}
+
+// CheckConstraints returns an error per value of the annotation that
+// violates a constraint of the policy
+func (p *Policy) CheckConstraints(an Annotation) []error {
+	errs := make([]error, 0)
+	for _, c := range p.Constraints {
+		a, r := p.latticeOf(c.Attribute), p.latticeOf(c.Required)
+		if a == nil || r == nil {
+			continue
+		}
+		for _, pa := range an {
+			v, ok := p.valueIn(pa, c.Attribute)
+			if !ok || v == Bottom || !a.Precede(v, c.Value) {
+				continue
+			}
+			satisfied := false
+			if own, ok := p.valueIn(pa, c.Required); ok {
+				satisfied = r.Precede(own, c.Bound)
+			} else {
+				for _, qa := range an {
+					if w, ok := p.valueIn(qa, c.Required); ok && r.Precede(w, c.Bound) {
+						satisfied = true
+						break
+					}
+				}
+			}
+			if !satisfied {
+				errs = append(errs, errors.New(fmt.Sprintf("policy: %s %s is only meaningful with %s below %s",
+					pa.name, pa.value, c.Required, c.Bound)))
+			}
+		}
+	}
+	return errs
+}
+
+// valueIn returns the value of a pair in a lattice: its value in the lattice
+// of the pair, or its state in the state lattice of the pair
+func (p *Policy) valueIn(pa pair, name string) (string, bool) {
+	l := p.baseOn[pa.name]
+	if l == nil {
+		return "", false
+	}
+	v, s := l.halve(pa.value)
+	switch {
+	case l.Name == name:
+		return baseOf(v), true
+	case l.state() != nil && l.state().Name == name:
+		return s, true
+	}
+	return "", false
+}
+
+// latticeOf returns the lattice of the policy of a name, or the state
+// lattice of a name of one of them, or nil
+func (p *Policy) latticeOf(name string) *Lattice {
+	for _, l := range p.lattices() {
+		if l.Name == name {
+			return l
+		}
+	}
+	return nil
+}
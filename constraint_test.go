@@ -0,0 +1,58 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestConstraints(t *testing.T) {
+	l := NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"], "Email": [] } }`)
+	l.Product(NewLattice(`{ "name": "TypeState", "edges": { "Encrypted": [], "Truncated": [] } }`))
+	p := NewPolicy([]*Lattice{l, NewLattice(`{ "name": "Purpose", "edges": { "Analytics": [], "Sharing": [] } }`)})
+
+	for _, c := range []struct{ str, err string }{
+		{"TypeState Encrypted DataType UniqueID", `policy: constraint "TypeState Encrypted DataType UniqueID" should be of the form <attribute> <value> REQUIRES <attribute> <value>`},
+		{"Region EU REQUIRES DataType UniqueID", `policy: constraint "Region EU REQUIRES DataType UniqueID" refers to unknown lattice Region`},
+		{"TypeState Hashed REQUIRES DataType UniqueID", `policy: constraint "TypeState Hashed REQUIRES DataType UniqueID" refers to unknown element Hashed of lattice TypeState`},
+	} {
+		if _, err := p.ParseConstraint(c.str); err == nil || err.Error() != c.err {
+			t.Errorf("ParseConstraint(%q) = %v, want %q", c.str, err, c.err)
+		}
+	}
+	for _, str := range []string{"TypeState Encrypted REQUIRES DataType UniqueID", "Purpose Sharing REQUIRES DataType Location"} {
+		c, err := p.ParseConstraint(str)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if c.String() != str {
+			t.Errorf("String() = %q, want %q", c, str)
+		}
+		p.Constraints = append(p.Constraints, c)
+	}
+
+	cases := []struct {
+		astr string
+		err  string
+	}{
+		{"DataType AccountID:Encrypted", ""},
+		{"DataType Email:Truncated", ""},
+		{"DataType Email:Encrypted", "policy: DataType Email:Encrypted is only meaningful with DataType below UniqueID"},
+		{"DataType Location Purpose Sharing", ""},
+		{"DataType Email DataType IPAddress Purpose Sharing", ""},
+		{"DataType Email Purpose Sharing", "policy: Purpose Sharing is only meaningful with DataType below Location"},
+	}
+	for _, c := range cases {
+		_, err := p.ParseAnnotation(c.astr)
+		if (err == nil) != (c.err == "") || err != nil && err.Error() != c.err {
+			t.Errorf("ParseAnnotation(%q) = %v, want %q", c.astr, err, c.err)
+		}
+	}
+
+	if err := p.ParsePolicy("ALLOW DataType TOP Purpose TOP EXCEPT { DENY DataType Email:Encrypted }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	errs := p.Validate()
+	want := "policy: exception 1 (DENY DataType Email:Encrypted) violates a constraint: DataType Email:Encrypted is only meaningful with DataType below UniqueID"
+	if len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("Validate() = %v, want %q", errs, want)
+	}
+}
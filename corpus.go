@@ -0,0 +1,257 @@
+package grok
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pseudonymizer maps the names of a taxonomy to synthetic ones, so that
+// decision logs are shared as benchmark corpora without leaking the taxonomy
+// or the traffic: lattices are named L1, L2, ... and their elements E1, E2,
+// ... in the order of their names, policies P1, P2, ... in the order they're
+// met, and the timestamps of records are dropped. TOP, BOTTOM, the parameters
+// of parameterized elements, value sets and product values are kept, so that
+// the lattices keep their structure and the pseudonymized decisions are the
+// decisions of the log. The attributes that aren't lattices, e.g. numeric
+// ones, are kept. A Pseudonymizer isn't safe for concurrent use.
+type Pseudonymizer struct {
+	// originals and lattices are the original and the pseudonymized lattices
+	// by original name
+	originals, lattices map[string]*Lattice
+	// names and elements are the pseudonyms of lattice names and of the
+	// elements of every lattice by its original name
+	names    map[string]string
+	elements map[string]map[string]string
+	policies map[string]string
+}
+
+// NewPseudonymizer returns a Pseudonymizer of the lattices and their state
+// lattices
+func NewPseudonymizer(ls []*Lattice) *Pseudonymizer {
+	all := make(map[string]*Lattice)
+	for _, l := range ls {
+		all[l.Name] = l
+		if s := l.state(); s != nil {
+			all[s.Name] = s
+		}
+	}
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	z := &Pseudonymizer{originals: all, lattices: make(map[string]*Lattice), names: make(map[string]string),
+		elements: make(map[string]map[string]string), policies: make(map[string]string)}
+	for i, name := range names {
+		z.names[name] = fmt.Sprintf("L%d", i+1)
+		es := make(map[string]string)
+		for _, e := range all[name].Elements() {
+			if e != Top && e != Bottom {
+				es[e] = fmt.Sprintf("E%d", len(es)+1)
+			}
+		}
+		z.elements[name] = es
+	}
+	for _, name := range names {
+		l := all[name]
+		m := &Lattice{Name: z.names[name], Edges: make([]Edge, 0, len(l.Edges)),
+			Weights: make(map[string]int), Labels: make(map[string]map[string]string)}
+		for _, e := range l.Edges {
+			m.Edges = append(m.Edges, Edge{From: z.element(name, e.From), To: z.element(name, e.To)})
+		}
+		for e, w := range l.Weights {
+			m.Weights[z.element(name, e)] = w
+		}
+		for e, r := range l.Deprecated {
+			if m.Deprecated == nil {
+				m.Deprecated = make(map[string]string)
+			}
+			m.Deprecated[z.element(name, e)] = z.element(name, r)
+		}
+		m.indexEdges()
+		m.autoCompile()
+		z.lattices[name] = m
+	}
+	for name, l := range all {
+		if s := l.state(); s != nil {
+			z.lattices[name].Product(z.lattices[s.Name])
+		}
+	}
+	return z
+}
+
+// Lattices returns the pseudonymized lattices, in the order of their
+// pseudonyms
+func (z *Pseudonymizer) Lattices() []*Lattice {
+	ls := make([]*Lattice, 0, len(z.lattices))
+	for _, l := range z.lattices {
+		ls = append(ls, l)
+	}
+	sort.Slice(ls, func(i, j int) bool {
+		return len(ls[i].Name) < len(ls[j].Name) || len(ls[i].Name) == len(ls[j].Name) && ls[i].Name < ls[j].Name
+	})
+	return ls
+}
+
+// WriteDefinitions writes the JSON definitions of the pseudonymized lattices
+// (see NewLattices). Products aren't part of definitions.
+func (z *Pseudonymizer) WriteDefinitions(w io.Writer) error {
+	defs := make([]map[string]interface{}, 0, len(z.lattices))
+	for _, l := range z.Lattices() {
+		edges := make(map[string][]string)
+		for _, e := range l.Elements() {
+			if e == Top || e == Bottom {
+				continue
+			}
+			edges[e] = filter(l.childrenOf([]string{e}), func(ch string) bool { return ch != Bottom })
+		}
+		def := map[string]interface{}{"name": l.Name, "edges": edges}
+		if len(l.Weights) > 0 {
+			def["weights"] = l.Weights
+		}
+		if len(l.Deprecated) > 0 {
+			def["deprecated"] = l.Deprecated
+		}
+		defs = append(defs, def)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(defs)
+}
+
+// element returns the pseudonym of an element of a lattice, which is given
+// one when the lattice didn't have it, except UnknownElement
+func (z *Pseudonymizer) element(lattice, e string) string {
+	if e == Top || e == Bottom || e == "" {
+		return e
+	}
+	base := baseOf(e)
+	es := z.elements[lattice]
+	m, ok := es[base]
+	if !ok && base == UnknownElement {
+		// the Unknown of annotations isn't an element of the taxonomy
+		return e
+	}
+	if !ok {
+		m = fmt.Sprintf("E%d", len(es)+1)
+		es[base] = m
+	}
+	return m + e[len(base):]
+}
+
+// value returns the pseudonym of a value of a lattice attribute
+func (z *Pseudonymizer) value(l *Lattice, v string) string {
+	if kind, members, ok := parseValueSet(v); ok {
+		ms := make([]string, 0, len(members))
+		for _, m := range members {
+			ms = append(ms, z.value(l, m))
+		}
+		return kind + "(" + strings.Join(ms, ",") + ")"
+	}
+	if l.isProductValue(v) {
+		a, s := l.halve(v)
+		return z.element(l.Name, a) + ":" + z.element(l.state().Name, s)
+	}
+	return z.element(l.Name, v)
+}
+
+// clause returns the pseudonymized pairs of a clause whose lattice
+// attributes are based on the lattices of p
+func (z *Pseudonymizer) clause(c Clause, p *Policy) Clause {
+	res := make(Clause, 0, len(c))
+	for _, pa := range c {
+		if l := p.baseOn[pa.name]; l != nil && z.names[l.Name] != "" {
+			pa.name, pa.value = z.names[l.Name], z.value(l, pa.value)
+		}
+		res = append(res, pa)
+	}
+	return res
+}
+
+// Annotation returns the pseudonymized annotation
+func (z *Pseudonymizer) Annotation(an Annotation) Annotation {
+	res := make(Annotation, 0, len(an))
+	for _, pa := range an {
+		if z.names[pa.name] != "" {
+			pa.name, pa.value = z.names[pa.name], z.value(z.originals[pa.name], pa.value)
+		}
+		res = append(res, pa)
+	}
+	return res
+}
+
+// PolicyID returns the pseudonym of a policy ID, empty for an empty ID
+func (z *Pseudonymizer) PolicyID(id string) string {
+	if id == "" {
+		return ""
+	}
+	if _, ok := z.policies[id]; !ok {
+		z.policies[id] = fmt.Sprintf("P%d", len(z.policies)+1)
+	}
+	return z.policies[id]
+}
+
+// Policy returns the pseudonymized policy: its ID, rule, exceptions and
+// numeric attributes, based on the pseudonymized lattices. Its other
+// settings, e.g. compatibility attributes, constraints and derivations,
+// aren't kept.
+func (z *Pseudonymizer) Policy(p *Policy) *Policy {
+	ls := make([]*Lattice, 0, len(p.baseOn))
+	for _, l := range p.baseOn {
+		if m := z.lattices[l.Name]; m != nil {
+			ls = append(ls, m)
+		}
+	}
+	q := NewPolicy(ls)
+	q.ID = z.PolicyID(p.ID)
+	for attr := range p.numerics {
+		q.numerics[attr] = true
+	}
+	rule := z.rule(p, p, q)
+	q.Mode, q.Monitor, q.Clause, q.Excepts = rule.Mode, rule.Monitor, rule.Clause, rule.Excepts
+	q.hasMonitor = q.monitorsExceptions()
+	return q
+}
+
+// rule returns the pseudonymized rule of ex, an exception of p or p itself,
+// based on the lattices of q
+func (z *Pseudonymizer) rule(ex, p, q *Policy) Policy {
+	r := Policy{Mode: ex.Mode, Monitor: ex.Monitor, Clause: z.clause(ex.Clause, p), Excepts: make([]Policy, 0, len(ex.Excepts))}
+	for i := range ex.Excepts {
+		r.Excepts = append(r.Excepts, z.rule(&ex.Excepts[i], p, q))
+	}
+	r.baseOn, r.numerics, r.compats = q.baseOn, q.numerics, q.compats
+	return r
+}
+
+// Record returns the pseudonymized record, without timestamp, unknown
+// attributes and bundle version
+func (z *Pseudonymizer) Record(r Record) Record {
+	return Record{Annotation: z.Annotation(r.Annotation), PolicyID: z.PolicyID(r.PolicyID), Effect: r.Effect,
+		Timestamp: time.Time{}, WouldBe: r.WouldBe, Error: r.Error}
+}
+
+// Copy pseudonymizes the records of a replay file into another, and returns
+// the number of records
+func (z *Pseudonymizer) Copy(w io.Writer, r io.Reader) (int, error) {
+	rr, rw := NewRecordReader(r), NewRecordWriter(w)
+	n := 0
+	for {
+		rec, err := rr.Read()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := rw.Write(z.Record(rec)); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,75 @@
+package grok
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPseudonymizer(t *testing.T) {
+	l := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"], "Birthday": [] },
+		"weights": { "AccountID": 3 } }`)
+	l.Product(NewLattice(`{ "name": "TypeState", "edges": { "Raw": ["Truncated"] } }`))
+	p := NewPolicy([]*Lattice{l})
+	p.ID = "marketing"
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType AccountID DENY DataType IPAddress:Raw }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	z := NewPseudonymizer([]*Lattice{l})
+	ls := z.Lattices()
+	if len(ls) != 2 || ls[0].Name != "L1" || ls[1].Name != "L2" || ls[0].state() != ls[1] ||
+		len(ls[0].Elements()) != len(l.Elements()) || ls[0].Weights[z.element("DataType", "AccountID")] != 3 {
+		t.Fatalf("Lattices() = %v", ls)
+	}
+
+	in := `{"annotation":[["DataType","IPAddress:Truncated"]],"policy":"marketing","effect":"DENY","ts":"2020-06-01T10:42:00Z"}
+{"annotation":[["DataType","ANYOF(Location,AccountID)"],["Retention","30"]],"policy":"marketing","effect":"DENY"}
+{"annotation":[["DataType","AccountID"]],"policy":"sales","effect":"DENY"}
+{"annotation":[["DataType","Birthday"]],"policy":"sales","effect":"ALLOW"}
+`
+	var out bytes.Buffer
+	n, err := z.Copy(&out, strings.NewReader(in))
+	if err != nil || n != 4 {
+		t.Fatalf("Copy() = %d, %v", n, err)
+	}
+	for _, name := range []string{"DataType", "TypeState", "IPAddress", "Location", "AccountID", "Truncated", "marketing", "2020"} {
+		if strings.Contains(out.String(), name) {
+			t.Errorf("Copy() leaks %s: %s", name, out.String())
+		}
+	}
+	recs, err := ReadRecords(&out)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if recs[0].PolicyID != "P1" || recs[2].PolicyID != "P2" || !recs[0].Timestamp.IsZero() ||
+		!strings.HasPrefix(recs[1].Annotation.String(), "L1 ANYOF(") || !strings.HasSuffix(recs[1].Annotation.String(), "Retention 30") {
+		t.Errorf("Copy() = %+v", recs)
+	}
+
+	// the pseudonymized policy decides the pseudonymized records as the
+	// policy decides the records
+	q := z.Policy(p)
+	if q.ID != "P1" {
+		t.Errorf("Policy().ID = %s", q.ID)
+	}
+	orig, err := ReadRecords(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	for i, r := range recs {
+		if got, want := q.Evaluate(r.Annotation).Allowed, p.Evaluate(orig[i].Annotation).Allowed; got != want || got != r.Allowed() {
+			t.Errorf("Evaluate(%s) = %v, want %v", r.Annotation, got, want)
+		}
+	}
+
+	var defs bytes.Buffer
+	if err := z.WriteDefinitions(&defs); err != nil {
+		t.Fatalf("%q", err)
+	}
+	rls, err := NewLatticesE(defs.String())
+	if err != nil || len(rls) != 2 || len(rls[0].Elements()) != len(l.Elements()) ||
+		!rls[0].Precede(z.element("DataType", "IPAddress"), z.element("DataType", "Location")) {
+		t.Errorf("WriteDefinitions() = %s, %v", defs.String(), err)
+	}
+}
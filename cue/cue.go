@@ -0,0 +1,235 @@
+// Package cue loads grok configurations written in CUE, for the teams that
+// validate and compose their configurations with the CUE tools.
+//
+// The definitions of lattices, policies and bundles are in grok.cue, next to
+// this file. A configuration is vetted against #Config and exported to JSON
+// by the CUE tools, which the Go API doesn't depend on:
+//
+//	cue vet -d '#Config' grok.cue config.cue
+//	cue export grok.cue config.cue --out json > config.json
+//
+// e.g. for the configuration
+//
+//	lattices: DataType: edges: {
+//		UniqueID: ["AccountID", "IPAddress"]
+//		Location: ["IPAddress"]
+//	}
+//	policies: "no-joins": rule: "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"
+//	bundles: core: {version: "1.0.0", policies: ["no-joins"]}
+//
+// Load checks the exported configuration against the constraints of the
+// definitions again, so that configurations that weren't vetted are caught
+// before they reach the policies.
+package cue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/hcl"
+)
+
+// Config is a loaded configuration, whose lattices and policies are those of
+// an HCL configuration, so that it's planned alike (see hcl.Plan)
+type Config struct {
+	*hcl.Config
+	// Bundles are sorted by name
+	Bundles []*Bundle
+}
+
+// Bundle is a versioned set of policies that are enforced together
+type Bundle struct {
+	Name        string
+	Version     string
+	Description string
+	Policies    []*hcl.Policy
+	// Degraded is true when policies of the bundle failed to load (see
+	// LoadPartial), and Missing are their names
+	Degraded bool
+	Missing  []string
+}
+
+// PolicyError is a policy that failed to load
+type PolicyError struct {
+	Policy string
+	Err    error
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("policy %s: %s", e.Policy, e.Err)
+}
+
+// PolicyErrors are all the policies of a configuration that failed to load
+type PolicyErrors []*PolicyError
+
+func (es PolicyErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return fmt.Sprintf("cue: %d invalid policies: %s", len(es), strings.Join(msgs, "; "))
+}
+
+// Bundle returns the bundle of a name, and nil if there's none
+func (c *Config) Bundle(name string) *Bundle {
+	for _, b := range c.Bundles {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// PolicySet returns the set of the policies of the bundle
+func (b *Bundle) PolicySet() *grok.PolicySet {
+	s := grok.NewPolicySet()
+	for _, p := range b.Policies {
+		s.Add(p.Policy)
+	}
+	return s
+}
+
+var (
+	// names are the names of lattices, elements and attributes (#Name)
+	names = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// versions are the versions of bundles
+	versions = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
+)
+
+// Load reads a configuration exported to JSON by the CUE tools
+func Load(r io.Reader) (*Config, error) {
+	return load(r, false)
+}
+
+// LoadPartial reads a configuration like Load, but continues past the
+// policies that fail to load, so that one bad policy doesn't take down the
+// whole bundle on reload. It returns the configuration without them, whose
+// bundles missing some are degraded, and a PolicyErrors of the failures.
+// Other errors, e.g. of lattices, fail the configuration as with Load.
+func LoadPartial(r io.Reader) (*Config, error) {
+	return load(r, true)
+}
+
+func load(r io.Reader, partial bool) (*Config, error) {
+	var def struct {
+		Lattices map[string]map[string]interface{} `json:"lattices"`
+		Policies map[string]map[string]interface{} `json:"policies"`
+		Bundles  map[string]struct {
+			Version     string   `json:"version"`
+			Policies    []string `json:"policies"`
+			Description string   `json:"description"`
+		} `json:"bundles"`
+	}
+	dec := json.NewDecoder(r)
+	// #Config is closed
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&def); err != nil {
+		return nil, errors.New(fmt.Sprintf("cue: %s", err))
+	}
+
+	c := &Config{Config: hcl.NewConfig(), Bundles: make([]*Bundle, 0)}
+	lnames := make([]string, 0, len(def.Lattices))
+	for n := range def.Lattices {
+		lnames = append(lnames, n)
+	}
+	sort.Strings(lnames)
+	for _, n := range lnames {
+		if err := checkLattice(n, def.Lattices[n]); err != nil {
+			return nil, err
+		}
+		if err := c.AddLattice(n, def.Lattices[n]); err != nil {
+			return nil, errors.New(fmt.Sprintf("cue: %s", err))
+		}
+	}
+	pnames := make([]string, 0, len(def.Policies))
+	for n := range def.Policies {
+		pnames = append(pnames, n)
+	}
+	sort.Strings(pnames)
+	failed := make(PolicyErrors, 0)
+	for _, n := range pnames {
+		if err := c.AddPolicy(n, def.Policies[n]); err != nil {
+			if !partial {
+				return nil, errors.New(fmt.Sprintf("cue: %s", err))
+			}
+			failed = append(failed, &PolicyError{n, errors.New(strings.TrimPrefix(err.Error(), "policy "+n+": "))})
+		}
+	}
+	isFailed := func(name string) bool {
+		for _, e := range failed {
+			if e.Policy == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	bnames := make([]string, 0, len(def.Bundles))
+	for n := range def.Bundles {
+		bnames = append(bnames, n)
+	}
+	sort.Strings(bnames)
+	for _, n := range bnames {
+		d := def.Bundles[n]
+		if !versions.MatchString(d.Version) {
+			return nil, errors.New(fmt.Sprintf("cue: bundle %s: invalid version %q", n, d.Version))
+		}
+		if len(d.Policies) == 0 {
+			return nil, errors.New(fmt.Sprintf("cue: bundle %s has no policies", n))
+		}
+		b := &Bundle{Name: n, Version: d.Version, Description: d.Description, Policies: make([]*hcl.Policy, 0, len(d.Policies))}
+		for _, pn := range d.Policies {
+			p := c.Policy(pn)
+			if p == nil && isFailed(pn) {
+				b.Degraded = true
+				b.Missing = append(b.Missing, pn)
+				continue
+			}
+			if p == nil {
+				return nil, errors.New(fmt.Sprintf("cue: bundle %s: undefined policy %s", n, pn))
+			}
+			b.Policies = append(b.Policies, p)
+		}
+		if err := b.PolicySet().Validate(); err != nil {
+			return nil, errors.New(fmt.Sprintf("cue: bundle %s: %s", n, strings.TrimPrefix(err.Error(), "policy: ")))
+		}
+		c.Bundles = append(c.Bundles, b)
+	}
+	if len(failed) > 0 {
+		return c, failed
+	}
+	return c, nil
+}
+
+// checkLattice checks the names of a lattice and of its elements (#Lattice)
+func checkLattice(name string, def map[string]interface{}) error {
+	if !names.MatchString(name) {
+		return errors.New(fmt.Sprintf("cue: invalid lattice name %q", name))
+	}
+	edges, _ := def["edges"].(map[string]interface{})
+	for from, tos := range edges {
+		es := []interface{}{from}
+		if l, ok := tos.([]interface{}); ok {
+			es = append(es, l...)
+		}
+		for _, e := range es {
+			if s, ok := e.(string); ok && !names.MatchString(s) {
+				return errors.New(fmt.Sprintf("cue: lattice %s: invalid element name %q", name, s))
+			}
+		}
+	}
+	if weights, ok := def["weights"].(map[string]interface{}); ok {
+		for e, w := range weights {
+			if f, ok := w.(float64); ok && (f < 0 || f != float64(int(f))) {
+				return errors.New(fmt.Sprintf("cue: lattice %s: invalid weight of %s", name, e))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package cue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok/hcl"
+)
+
+// config is the export of the configuration of the package documentation
+const config = `{
+	"lattices": {
+		"DataType": {
+			"edges": {"UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"]},
+			"weights": {"AccountID": 3}
+		},
+		"Purpose": {"edges": {"Analytics": [], "Sharing": []}}
+	},
+	"policies": {
+		"no-joins": {
+			"lattices": ["DataType"],
+			"rule": "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"
+		},
+		"analytics": {"rule": "ALLOW DataType TOP Purpose Analytics"}
+	},
+	"bundles": {
+		"core": {"version": "1.0.0", "policies": ["no-joins"]},
+		"strict": {"version": "1.1.0", "policies": ["no-joins", "analytics"], "description": "analytics only"}
+	}
+}`
+
+func TestLoad(t *testing.T) {
+	c, err := Load(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if len(c.Lattices) != 2 || c.Lattices[0].Name != "DataType" || c.Lattice("DataType").Weights["AccountID"] != 3 {
+		t.Errorf("Lattices = %v", c.Lattices)
+	}
+	if len(c.Policies) != 2 || c.Policies[0].Name != "analytics" {
+		t.Errorf("Policies = %v", c.Policies)
+	}
+	if len(c.Bundles) != 2 || c.Bundle("strict").Version != "1.1.0" || len(c.Bundle("strict").Policies) != 2 {
+		t.Fatalf("Bundles = %v", c.Bundles)
+	}
+
+	p := c.Policy("analytics")
+	for _, test := range []struct {
+		bundle, annotation string
+		allowed            bool
+	}{
+		{"core", "DataType IPAddress Purpose Sharing", true},
+		{"strict", "DataType IPAddress Purpose Sharing", false},
+		{"strict", "DataType IPAddress Purpose Analytics", true},
+		{"core", "DataType IPAddress DataType AccountID Purpose Analytics", false},
+	} {
+		an, err := p.ParseAnnotation(test.annotation)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := c.Bundle(test.bundle).PolicySet().ApplyOn(an); got != test.allowed {
+			t.Errorf("%s ApplyOn(%s) = %t", test.bundle, test.annotation, got)
+		}
+	}
+
+	// the configuration is planned like an HCL one
+	if fs := hcl.Plan(c.Config, c.Config); len(fs) != 0 {
+		t.Errorf("Plan() = %v", fs)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		config, err string
+	}{
+		{`{"lattices": {}, "polices": {}}`, `unknown field "polices"`},
+		{`{"lattices": {"Data-Type": {"edges": {}}}}`, `invalid lattice name "Data-Type"`},
+		{`{"lattices": {"A": {"edges": {"X": ["Y Z"]}}}}`, `lattice A: invalid element name "Y Z"`},
+		{`{"lattices": {"A": {"edges": {"X": []}, "weights": {"X": 1.5}}}}`, "lattice A: invalid weight of X"},
+		{`{"lattices": {"A": {"edge": {}}}}`, "lattice A: unexpected attribute edge"},
+		{`{"lattices": {"A": {"edges": {"X": []}}}, "policies": {"p": {"rule": "ALLOW B TOP", "lattices": ["B"]}}}`,
+			"policy p: undefined lattice B"},
+		{`{"lattices": {"A": {"edges": {"X": []}}}, "policies": {"p": {"rule": "ALLOW A X"}},
+			"bundles": {"b": {"version": "1.0", "policies": ["p"]}}}`, `bundle b: invalid version "1.0"`},
+		{`{"lattices": {"A": {"edges": {"X": []}}}, "policies": {"p": {"rule": "ALLOW A X"}},
+			"bundles": {"b": {"version": "1.0.0", "policies": []}}}`, "bundle b has no policies"},
+		{`{"lattices": {"A": {"edges": {"X": []}}}, "policies": {"p": {"rule": "ALLOW A X"}},
+			"bundles": {"b": {"version": "1.0.0", "policies": ["q"]}}}`, "bundle b: undefined policy q"},
+		{`{"lattices": {"A": {"edges": {"X": []}}}, "policies": {"p": {"rule": "ALLOW A X"}},
+			"bundles": {"b": {"version": "1.0.0", "policies": ["p", "p"]}}}`, "bundle b: duplicate policy ID p"},
+	}
+	for _, test := range tests {
+		_, err := Load(strings.NewReader(test.config))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Load(%s) = %v, want %q", test.config, err, test.err)
+		}
+	}
+}
+
+func TestLoadPartial(t *testing.T) {
+	partial := `{
+		"lattices": {"A": {"edges": {"X": [], "Y": []}}},
+		"policies": {"p": {"rule": "ALLOW A X"}, "q": {"rule": "ALLOW A Z"}, "r": {"rule": "ALLOW A X EXCEPT {"}},
+		"bundles": {
+			"b": {"version": "1.0.0", "policies": ["p", "q", "r"]},
+			"c": {"version": "1.0.0", "policies": ["p"]}
+		}
+	}`
+	c, err := LoadPartial(strings.NewReader(partial))
+	es, ok := err.(PolicyErrors)
+	if !ok || len(es) != 2 || es[0].Policy != "q" || es[1].Policy != "r" || !strings.HasPrefix(err.Error(), "cue: 2 invalid policies: policy q: ") {
+		t.Fatalf("LoadPartial() = %v", err)
+	}
+	if len(c.Policies) != 1 || c.Policy("p") == nil {
+		t.Errorf("Policies = %v", c.Policies)
+	}
+	b := c.Bundle("b")
+	if !b.Degraded || strings.Join(b.Missing, ",") != "q,r" || len(b.Policies) != 1 || c.Bundle("c").Degraded {
+		t.Errorf("Bundles = %+v", c.Bundles)
+	}
+
+	if _, err := Load(strings.NewReader(partial)); err == nil || !strings.HasPrefix(err.Error(), "cue: policy q: ") {
+		t.Errorf("Load() = %v", err)
+	}
+	if c, err := LoadPartial(strings.NewReader(config)); err != nil || len(c.Bundles) != 2 {
+		t.Errorf("LoadPartial() of a valid configuration = %v", err)
+	}
+}
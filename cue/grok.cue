@@ -0,0 +1,42 @@
+// CUE definitions of grok configurations. Validate and compose configurations
+// with the CUE tools, and export them to JSON for the cue package to load:
+//
+//	cue vet -d '#Config' grok.cue config.cue
+//	cue export grok.cue config.cue --out json > config.json
+package grok
+
+// #Name is the name of a lattice, of an element or of an attribute
+#Name: =~"^[A-Za-z_][A-Za-z0-9_]*$"
+
+// #Lattice maps elements to the elements right below them, where an element
+// with no element below is a flat element
+#Lattice: {
+	edges: [#Name]: [...#Name]
+	// sensitivity weights of elements
+	weights?: [#Name]: int & >=0
+	// display names of elements per locale
+	labels?: [string]: [#Name]: string
+}
+
+// #Policy is a policy in the policy syntax, based on some lattices (all the
+// lattices when omitted)
+#Policy: {
+	lattices?: [...#Name]
+	numeric?: [...#Name]
+	unknown?: "reject" | "ignore" | "flag"
+	selector?: string & !=""
+	rule: =~"^\\s*(ALLOW|DENY)\\s"
+}
+
+// #Bundle is a versioned set of policies that are enforced together
+#Bundle: {
+	version: =~"^[0-9]+\\.[0-9]+\\.[0-9]+$"
+	policies: [...string] & [_, ...]
+	description?: string
+}
+
+#Config: {
+	lattices: [#Name]: #Lattice
+	policies: [string]: #Policy
+	bundles?: [string]: #Bundle
+}
@@ -0,0 +1,273 @@
+// Package dbt checks dbt projects against a policy, from their manifest.json.
+//
+// The models, seeds, snapshots and sources of the manifest are the nodes of a
+// data-flow graph, flowing to the models that depend on them. Annotations are
+// in the "grok" key of the meta config of nodes and of their columns:
+//
+//	models:
+//	  - name: daily_clicks
+//	    config:
+//	      meta: {grok: "Purpose Analytics"}
+//	    columns:
+//	      - name: ip
+//	        meta: {grok: "DataType IPAddress"}
+//
+// A column without an annotation inherits the annotations of the columns of
+// the same name upstream, and a node without documented columns inherits the
+// annotations of all its parents, so that sensitive data is followed through
+// the DAG. The results of the check are dbt test results, one per node, which
+// WriteRunResults writes in the format of run_results.json.
+package dbt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/graph"
+)
+
+// MetaKey is the key of the meta config carrying grok annotations
+const MetaKey = "grok"
+
+// resourceTypes are the resource types of the nodes of the graph, besides sources
+var resourceTypes = map[string]bool{"model": true, "seed": true, "snapshot": true}
+
+type manifestNode struct {
+	ResourceType string                 `json:"resource_type"`
+	Meta         map[string]interface{} `json:"meta"`
+	Config       struct {
+		Meta map[string]interface{} `json:"meta"`
+	} `json:"config"`
+	Columns map[string]struct {
+		Name string                 `json:"name"`
+		Meta map[string]interface{} `json:"meta"`
+	} `json:"columns"`
+	DependsOn struct {
+		Nodes []string `json:"nodes"`
+	} `json:"depends_on"`
+}
+
+// Project is the annotated DAG of a dbt project
+type Project struct {
+	// Graph has the nodes of the project, labeled by their annotations and
+	// the annotations of their columns
+	Graph *graph.DataFlowGraph
+	// Columns are the annotations of the columns of the nodes, declared or
+	// inherited
+	Columns map[string]map[string]grok.Annotation
+	// own are the annotations of the nodes themselves, and parents the
+	// nodes they depend on
+	own     map[string]grok.Annotation
+	parents map[string][]string
+}
+
+// LoadManifest reads a dbt manifest.json, and returns the annotated DAG of its
+// project. Annotations are validated against the lattices of the policy.
+func LoadManifest(r io.Reader, p *grok.Policy) (*Project, error) {
+	var m struct {
+		Nodes   map[string]manifestNode `json:"nodes"`
+		Sources map[string]manifestNode `json:"sources"`
+	}
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]manifestNode)
+	for id, n := range m.Nodes {
+		if resourceTypes[n.ResourceType] {
+			nodes[id] = n
+		}
+	}
+	for id, n := range m.Sources {
+		nodes[id] = n
+	}
+
+	pr := &Project{Graph: graph.NewDataFlowGraph(), Columns: make(map[string]map[string]grok.Annotation),
+		own: make(map[string]grok.Annotation), parents: make(map[string][]string)}
+	declared := make(map[string]map[string]grok.Annotation)
+	documented := make(map[string][]string)
+	for id, n := range nodes {
+		an, err := annotationOf(p, n.Config.Meta, n.Meta)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("dbt: %s: %s", id, err))
+		}
+		pr.own[id] = an
+		declared[id] = make(map[string]grok.Annotation)
+		for key, c := range n.Columns {
+			name := c.Name
+			if name == "" {
+				name = key
+			}
+			documented[id] = append(documented[id], name)
+			an, err := annotationOf(p, c.Meta)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("dbt: %s: column %s: %s", id, name, err))
+			}
+			if len(an) > 0 {
+				declared[id][name] = an
+			}
+		}
+		sort.Strings(documented[id])
+		for _, d := range n.DependsOn.Nodes {
+			if _, ok := nodes[d]; ok {
+				pr.parents[id] = append(pr.parents[id], d)
+			}
+		}
+		sort.Strings(pr.parents[id])
+	}
+
+	// the columns are derived from the parents first
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return errors.New(fmt.Sprintf("dbt: %s depends on itself", id))
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		for _, d := range pr.parents[id] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		pr.Columns[id] = pr.columnsOf(id, documented[id], declared[id])
+		return nil
+	}
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := visit(id); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range ids {
+		pr.Graph.AddNode(id, pr.Annotation(id))
+		for _, d := range pr.parents[id] {
+			pr.Graph.AddFlow(d, id)
+		}
+	}
+	return pr, nil
+}
+
+// columnsOf returns the annotations of the columns of a node: the declared
+// ones, and the inherited ones of the undeclared columns. A node without
+// documented columns has a column "*" with the annotations of its parents.
+func (pr *Project) columnsOf(id string, documented []string, declared map[string]grok.Annotation) map[string]grok.Annotation {
+	cs := make(map[string]grok.Annotation)
+	if len(documented) == 0 {
+		an := make(grok.Annotation, 0)
+		for _, d := range pr.parents[id] {
+			an = append(an, pr.Annotation(d)...)
+		}
+		if len(an) > 0 {
+			cs["*"] = an
+		}
+		return cs
+	}
+	for _, c := range documented {
+		if an, ok := declared[c]; ok {
+			cs[c] = an
+			continue
+		}
+		an := make(grok.Annotation, 0)
+		for _, d := range pr.parents[id] {
+			an = append(an, pr.Columns[d][c]...)
+		}
+		if len(an) > 0 {
+			cs[c] = an
+		}
+	}
+	return cs
+}
+
+// Annotation returns the annotation of a node: its own values followed by the
+// values of its columns, in the order of the columns
+func (pr *Project) Annotation(id string) grok.Annotation {
+	an := append(grok.Annotation{}, pr.own[id]...)
+	cs := make([]string, 0, len(pr.Columns[id]))
+	for c := range pr.Columns[id] {
+		cs = append(cs, c)
+	}
+	sort.Strings(cs)
+	for _, c := range cs {
+		an = append(an, pr.Columns[id][c]...)
+	}
+	return an
+}
+
+// annotationOf parses the annotations of the first meta configs having one
+func annotationOf(p *grok.Policy, metas ...map[string]interface{}) (grok.Annotation, error) {
+	for _, m := range metas {
+		v, ok := m[MetaKey]
+		if !ok {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("the %s meta should be a string", MetaKey))
+		}
+		return p.ParseAnnotation(s)
+	}
+	return grok.Annotation{}, nil
+}
+
+// TestResult is the result of checking a node, as a dbt test result
+type TestResult struct {
+	// UniqueID is the ID of the test, test.grok.<node>
+	UniqueID string `json:"unique_id"`
+	// Status is "pass", "fail", or "skipped" for a node without annotations
+	Status   string `json:"status"`
+	Failures int    `json:"failures"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Check applies the policy on every node of the project with the graph
+// checker, and returns a test result per node, sorted by node. Nodes without
+// annotations aren't checked.
+func (pr *Project) Check(p *grok.Policy) []TestResult {
+	failed := make(map[string]graph.Violation)
+	for _, v := range graph.CheckGraph(p, pr.Graph) {
+		failed[v.Node] = v
+	}
+	rs := make([]TestResult, 0, len(pr.Graph.Nodes))
+	for _, id := range pr.Graph.NodeIDs() {
+		r := TestResult{UniqueID: "test.grok." + id, Status: "pass"}
+		if len(pr.Graph.Nodes[id].Annotation) == 0 {
+			r.Status = "skipped"
+		} else if v, ok := failed[id]; ok {
+			r.Status = "fail"
+			r.Failures = 1
+			r.Message = fmt.Sprintf("%s violates the policy: %s", id, v.Annotation)
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+// WriteRunResults writes test results in the format of dbt's run_results.json
+func WriteRunResults(w io.Writer, rs []TestResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Metadata struct {
+			SchemaVersion string `json:"dbt_schema_version"`
+		} `json:"metadata"`
+		Results []TestResult `json:"results"`
+	}{Metadata: struct {
+		SchemaVersion string `json:"dbt_schema_version"`
+	}{"https://schemas.getdbt.com/dbt/run-results/v4.json"}, Results: rs})
+}
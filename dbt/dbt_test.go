@@ -0,0 +1,98 @@
+package dbt
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+const manifest = `{
+ "nodes": {
+  "model.shop.clicks": {"resource_type": "model", "name": "clicks",
+   "depends_on": {"nodes": ["source.shop.raw.clicks"]},
+   "columns": {"ip": {"name": "ip", "meta": {}}, "day": {"name": "day", "meta": {}}}},
+  "model.shop.joined": {"resource_type": "model", "name": "joined",
+   "config": {"meta": {"grok": "DataType AccountID"}},
+   "depends_on": {"nodes": ["model.shop.clicks", "macro.shop.helper"]}},
+  "model.shop.daily": {"resource_type": "model", "name": "daily",
+   "depends_on": {"nodes": ["model.shop.clicks"]},
+   "columns": {"day": {"name": "day", "meta": {}}}},
+  "test.shop.not_null": {"resource_type": "test", "name": "not_null",
+   "depends_on": {"nodes": ["model.shop.clicks"]}}
+ },
+ "sources": {
+  "source.shop.raw.clicks": {"resource_type": "source", "name": "clicks",
+   "columns": {"ip": {"name": "ip", "meta": {"grok": "DataType IPAddress"}}}}
+ }
+}`
+
+func newPolicy(t *testing.T) *grok.Policy {
+	p := grok.NewPolicy([]*grok.Lattice{grok.NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)})
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return p
+}
+
+func TestLoadManifest(t *testing.T) {
+	p := newPolicy(t)
+	pr, err := LoadManifest(strings.NewReader(manifest), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	cases := []struct {
+		node, annotation string
+	}{
+		{"source.shop.raw.clicks", "DataType IPAddress"},
+		{"model.shop.clicks", "DataType IPAddress"},
+		{"model.shop.daily", ""},
+		{"model.shop.joined", "DataType AccountID DataType IPAddress"},
+	}
+	for _, c := range cases {
+		if got := pr.Annotation(c.node).String(); got != c.annotation {
+			t.Errorf("Annotation(%s) = %q, want %q", c.node, got, c.annotation)
+		}
+	}
+	if len(pr.Graph.Nodes) != 4 || len(pr.Graph.Flows) != 3 {
+		t.Errorf("Graph = %+v", pr.Graph)
+	}
+
+	rs := pr.Check(p)
+	if len(rs) != 4 || rs[1].Status != "skipped" || rs[2].Status != "fail" || rs[2].UniqueID != "test.grok.model.shop.joined" ||
+		rs[2].Message != "model.shop.joined violates the policy: DataType AccountID DataType IPAddress" || rs[0].Status != "pass" {
+		t.Errorf("Check() = %+v", rs)
+	}
+	var buf bytes.Buffer
+	if err := WriteRunResults(&buf, rs); err != nil {
+		t.Fatalf("%q", err)
+	}
+	var out struct {
+		Results []TestResult `json:"results"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil || len(out.Results) != 4 || out.Results[2].Failures != 1 {
+		t.Errorf("WriteRunResults() = %s", buf.String())
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	p := newPolicy(t)
+	cases := []struct {
+		manifest, err string
+	}{
+		{`{"nodes": {"model.a": {"resource_type": "model", "config": {"meta": {"grok": "DataType Nowhere"}}}}}`, "dbt: model.a: "},
+		{`{"nodes": {"model.a": {"resource_type": "model", "columns": {"c": {"meta": {"grok": 1}}}}}}`,
+			"dbt: model.a: column c: the grok meta should be a string"},
+		{`{"nodes": {"model.a": {"resource_type": "model", "depends_on": {"nodes": ["model.b"]}},
+			"model.b": {"resource_type": "model", "depends_on": {"nodes": ["model.a"]}}}}`, "dbt: model.a depends on itself"},
+	}
+	for _, c := range cases {
+		_, err := LoadManifest(strings.NewReader(c.manifest), p)
+		if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("LoadManifest(%s) = %v, want %q", c.manifest, err, c.err)
+		}
+	}
+}
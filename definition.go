@@ -0,0 +1,170 @@
+package grok
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LatticeError is an invalid lattice definition
+type LatticeError struct {
+	// Lattice is the name of the lattice, or its index in a list of
+	// definitions when it has no valid name
+	Lattice string
+	// Key is the key of the definition in error, e.g. edges, and empty when
+	// the definition isn't a JSON object
+	Key string
+	Err string
+}
+
+func (e *LatticeError) Error() string {
+	msg := "lattice: "
+	if e.Lattice != "" {
+		msg += e.Lattice + ": "
+	}
+	if e.Key != "" {
+		msg += e.Key + ": "
+	}
+	return msg + e.Err
+}
+
+// NewLatticeE returns a Lattice instance that is parsed from a string like
+// NewLattice, and a *LatticeError when the definition is invalid: when it
+// isn't JSON, when a key is unknown or has a value of the wrong type, or when
+// an element is TOP or BOTTOM, which the lattice adds itself.
+func NewLatticeE(str string) (*Lattice, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(str), &m); err != nil {
+		return nil, &LatticeError{Err: err.Error()}
+	}
+	return newLatticeOf(m, "")
+}
+
+// NewLatticesE returns a slice of Lattice instances that are parsed from a
+// string like NewLattices, and a *LatticeError for the first invalid
+// definition
+func NewLatticesE(str string) ([]*Lattice, error) {
+	var ms []map[string]interface{}
+	if err := json.Unmarshal([]byte(str), &ms); err != nil {
+		return nil, &LatticeError{Err: err.Error()}
+	}
+	lattices := make([]*Lattice, 0, len(ms))
+	for i, m := range ms {
+		l, err := newLatticeOf(m, fmt.Sprint(i))
+		if err != nil {
+			return nil, err
+		}
+		lattices = append(lattices, l)
+	}
+	return lattices, nil
+}
+
+// newLatticeOf returns the lattice of a definition, after validating it. The
+// lattice is named by index in errors when it has no valid name.
+func newLatticeOf(m map[string]interface{}, index string) (*Lattice, error) {
+	if err := validateDefinition(m, index); err != nil {
+		return nil, err
+	}
+	l := parse(m)
+	l.autoCompile()
+	return &l, nil
+}
+
+// validateDefinition returns an error when a lattice definition parsed from
+// JSON is invalid. The lattice is named by index when it has no valid name.
+func validateDefinition(m map[string]interface{}, index string) *LatticeError {
+	if m == nil {
+		return &LatticeError{Lattice: index, Err: "the definition should be an object"}
+	}
+	name, ok := m["name"].(string)
+	if !ok || name == "" {
+		return &LatticeError{Lattice: index, Key: "name", Err: "should be a non-empty string"}
+	}
+	fail := func(key, format string, args ...interface{}) *LatticeError {
+		return &LatticeError{Lattice: name, Key: key, Err: fmt.Sprintf(format, args...)}
+	}
+	for _, k := range sortedKeys(m) {
+		switch k {
+		case "name", "edges", "weights", "labels", "deprecated":
+		default:
+			return fail(k, "unknown key, expected one of name, edges, weights, labels and deprecated")
+		}
+	}
+
+	edges, ok := m["edges"].(map[string]interface{})
+	if !ok {
+		return fail("edges", "should be an object of elements to the lists of their children")
+	}
+	for _, from := range sortedKeys(edges) {
+		tos, ok := edges[from].([]interface{})
+		if !ok {
+			return fail("edges", "%s should have a list of children", from)
+		}
+		if isBound(from) {
+			return fail("edges", "%s is added by the lattice, and can't be defined", from)
+		}
+		for _, to := range tos {
+			s, ok := to.(string)
+			if !ok || s == "" {
+				return fail("edges", "the children of %s should be non-empty strings", from)
+			}
+			if isBound(s) {
+				return fail("edges", "%s is added by the lattice, and can't be defined", s)
+			}
+		}
+	}
+	if w, ok := m["weights"]; ok {
+		wm, ok := w.(map[string]interface{})
+		if !ok {
+			return fail("weights", "should be an object of elements to their weights")
+		}
+		for _, e := range sortedKeys(wm) {
+			if f, ok := wm[e].(float64); !ok || f != float64(int(f)) {
+				return fail("weights", "the weight of %s should be an integer", e)
+			}
+		}
+	}
+	if l, ok := m["labels"]; ok {
+		lm, ok := l.(map[string]interface{})
+		if !ok {
+			return fail("labels", "should be an object of locales to the labels of elements")
+		}
+		for _, locale := range sortedKeys(lm) {
+			em, ok := lm[locale].(map[string]interface{})
+			if !ok {
+				return fail("labels", "the labels of locale %s should be an object of elements to labels", locale)
+			}
+			for _, e := range sortedKeys(em) {
+				if _, ok := em[e].(string); !ok {
+					return fail("labels", "the label of %s in locale %s should be a string", e, locale)
+				}
+			}
+		}
+	}
+	if d, ok := m["deprecated"]; ok {
+		dm, ok := d.(map[string]interface{})
+		if !ok {
+			return fail("deprecated", "should be an object of elements to their replacements")
+		}
+		for _, e := range sortedKeys(dm) {
+			if _, ok := dm[e].(string); !ok {
+				return fail("deprecated", "the replacement of %s should be a string", e)
+			}
+		}
+	}
+	return nil
+}
+
+func isBound(e string) bool {
+	return strings.EqualFold(e, Top) || strings.EqualFold(e, Bottom)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,58 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestNewLatticeE(t *testing.T) {
+	l, err := NewLatticeE(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] },
+		"weights": { "AccountID": 3 }, "labels": { "de": { "IPAddress": "IP-Adresse" } }, "deprecated": { "Location": "" } }`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if !equals(l.Elements(), NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`).Elements()) ||
+		l.Weights["AccountID"] != 3 || l.Labels["de"]["IPAddress"] != "IP-Adresse" {
+		t.Errorf("NewLatticeE() = %+v", l)
+	}
+
+	cases := []struct {
+		str, lattice, key, err string
+	}{
+		{`{ "name": `, "", "", "unexpected end of JSON input"},
+		{`{ "edges": {} }`, "", "name", "lattice: name: should be a non-empty string"},
+		{`{ "name": "A", "edge": {} }`, "A", "edge", "lattice: A: edge: unknown key, expected one of name, edges, weights, labels and deprecated"},
+		{`{ "name": "A" }`, "A", "edges", "lattice: A: edges: should be an object of elements to the lists of their children"},
+		{`{ "name": "A", "edges": { "B": "C" } }`, "A", "edges", "lattice: A: edges: B should have a list of children"},
+		{`{ "name": "A", "edges": { "B": [1] } }`, "A", "edges", "lattice: A: edges: the children of B should be non-empty strings"},
+		{`{ "name": "A", "edges": { "TOP": ["B"] } }`, "A", "edges", "lattice: A: edges: TOP is added by the lattice, and can't be defined"},
+		{`{ "name": "A", "edges": { "B": [] }, "weights": { "B": 1.5 } }`, "A", "weights", "lattice: A: weights: the weight of B should be an integer"},
+		{`{ "name": "A", "edges": { "B": [] }, "labels": { "de": "B" } }`, "A", "labels", "lattice: A: labels: the labels of locale de should be an object of elements to labels"},
+		{`{ "name": "A", "edges": { "B": [] }, "deprecated": { "B": 1 } }`, "A", "deprecated", "lattice: A: deprecated: the replacement of B should be a string"},
+	}
+	for _, c := range cases {
+		_, err := NewLatticeE(c.str)
+		le, ok := err.(*LatticeError)
+		if !ok {
+			t.Errorf("NewLatticeE(%s) = %v, want a *LatticeError", c.str, err)
+			continue
+		}
+		if le.Lattice != c.lattice || le.Key != c.key || (c.key != "" || c.lattice != "") && le.Error() != c.err ||
+			c.key == "" && c.lattice == "" && le.Err != c.err {
+			t.Errorf("NewLatticeE(%s) = %+v, want %q", c.str, le, c.err)
+		}
+	}
+}
+
+func TestNewLatticesE(t *testing.T) {
+	ls, err := NewLatticesE(`[{ "name": "A", "edges": { "B": [] } }, { "name": "C", "edges": {} }]`)
+	if err != nil || len(ls) != 2 || ls[1].Name != "C" {
+		t.Errorf("NewLatticesE() = %v, %v", ls, err)
+	}
+	_, err = NewLatticesE(`[{ "name": "A", "edges": { "B": [] } }, { "edges": {} }]`)
+	if err == nil || err.Error() != "lattice: 1: name: should be a non-empty string" {
+		t.Errorf("NewLatticesE() = %v", err)
+	}
+	if _, err := NewLatticesE(`{}`); err == nil {
+		t.Errorf("NewLatticesE() should fail on a definition that isn't a list")
+	}
+}
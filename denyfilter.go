@@ -0,0 +1,131 @@
+package grok
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// denyFilterHashes is the number of hashes of a DenyFilter, which keeps the
+// false positive rate of its prefilter at about 1% with 10 bits per key
+const denyFilterHashes = 7
+
+// DenyFilter caches the denials of a policy for high-QPS decision points. A
+// bloom filter of the canonical keys of the denied annotations is consulted
+// before the evaluation, and its hits are verified against the exact set of
+// the denied keys, so that a false positive of the filter is evaluated like a
+// miss. The filter holds at most Capacity denied annotations, and must be
+// reset when the policy or its lattices are reloaded (see Registry.OnReload).
+// It is safe for concurrent use.
+type DenyFilter struct {
+	// hits, falsePositives and evaluations are first for their 64-bit
+	// alignment, since they're updated atomically
+	hits, falsePositives, evaluations int64
+	Policy                            *Policy
+	Capacity                          int
+	mu                                sync.RWMutex
+	bits                              bitset
+	denied                            map[string]bool
+}
+
+// DenyFilterStats counts the decisions of a DenyFilter
+type DenyFilterStats struct {
+	// Hits are the decisions taken from the cache, and FalsePositives the
+	// filter hits that the exact set didn't confirm
+	Hits, FalsePositives int
+	// Evaluations are the decisions evaluated by the policy
+	Evaluations int
+}
+
+// NewDenyFilter returns an empty DenyFilter of a policy holding at most
+// capacity denied annotations
+func NewDenyFilter(p *Policy, capacity int) *DenyFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &DenyFilter{Policy: p, Capacity: capacity, bits: newBitset(10 * capacity), denied: make(map[string]bool)}
+}
+
+// ApplyOn decides like the ApplyOn of the policy, without evaluating the
+// annotations known to be denied
+func (f *DenyFilter) ApplyOn(an Annotation) bool {
+	key := canonicalKey(an)
+	h1, h2 := hashes(key)
+	f.mu.RLock()
+	maybe := f.mayContain(h1, h2)
+	hit := maybe && f.denied[key]
+	f.mu.RUnlock()
+	if hit {
+		atomic.AddInt64(&f.hits, 1)
+		return false
+	}
+	if maybe {
+		atomic.AddInt64(&f.falsePositives, 1)
+	}
+
+	atomic.AddInt64(&f.evaluations, 1)
+	allowed := f.Policy.ApplyOn(an)
+	if !allowed {
+		f.mu.Lock()
+		if len(f.denied) < f.Capacity && !f.denied[key] {
+			f.denied[key] = true
+			n := uint64(len(f.bits) * 64)
+			for i := uint64(0); i < denyFilterHashes; i++ {
+				f.bits.set(int((h1 + i*h2) % n))
+			}
+		}
+		f.mu.Unlock()
+	}
+	return allowed
+}
+
+// Reset empties the filter, e.g. after the policy is reloaded
+func (f *DenyFilter) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bits = newBitset(10 * f.Capacity)
+	f.denied = make(map[string]bool)
+}
+
+// Stats returns the counts of the decisions of the filter
+func (f *DenyFilter) Stats() DenyFilterStats {
+	return DenyFilterStats{
+		Hits:           int(atomic.LoadInt64(&f.hits)),
+		FalsePositives: int(atomic.LoadInt64(&f.falsePositives)),
+		Evaluations:    int(atomic.LoadInt64(&f.evaluations)),
+	}
+}
+
+// mayContain returns false when the key of the hashes was never added
+func (f *DenyFilter) mayContain(h1, h2 uint64) bool {
+	n := uint64(len(f.bits) * 64)
+	for i := uint64(0); i < denyFilterHashes; i++ {
+		if !f.bits.has(int((h1 + i*h2) % n)) {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes returns the two hashes of a key, which derive the hashes of the
+// filter (double hashing)
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	return h1, h.Sum64() | 1
+}
+
+// canonicalKey returns the key of an annotation, which doesn't depend on the
+// order of its pairs since decisions don't
+func canonicalKey(an Annotation) string {
+	pairs := make([]string, 0, len(an))
+	for _, pa := range an {
+		pairs = append(pairs, Clause{pa}.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\x00")
+}
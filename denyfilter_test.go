@@ -0,0 +1,66 @@
+package grok
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestDenyFilter(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }")
+	parse := func(astr string) Annotation {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		return an
+	}
+	f := NewDenyFilter(p, 1)
+	steps := []struct {
+		astr    string
+		allowed bool
+		stats   DenyFilterStats
+	}{
+		{"DataType IPAddress DataType AccountID", false, DenyFilterStats{Evaluations: 1}},
+		// the key doesn't depend on the order of the pairs
+		{"DataType AccountID DataType IPAddress", false, DenyFilterStats{Hits: 1, Evaluations: 1}},
+		{"DataType IPAddress", true, DenyFilterStats{Hits: 1, Evaluations: 2}},
+		// the filter is full
+		{"DataType UniqueID", false, DenyFilterStats{Hits: 1, Evaluations: 3}},
+		{"DataType UniqueID", false, DenyFilterStats{Hits: 1, Evaluations: 4}},
+	}
+	for _, s := range steps {
+		if got := f.ApplyOn(parse(s.astr)); got != s.allowed {
+			t.Errorf("ApplyOn(%q) = %t, want %t", s.astr, got, s.allowed)
+		}
+		if got := f.Stats(); got.Hits != s.stats.Hits || got.Evaluations != s.stats.Evaluations {
+			t.Errorf("Stats() after %q = %+v, want %+v", s.astr, got, s.stats)
+		}
+	}
+	f.Reset()
+	f.ApplyOn(parse("DataType AccountID DataType IPAddress"))
+	if got := f.Stats(); got.Hits != 1 || got.Evaluations != 5 {
+		t.Errorf("Stats() after Reset() = %+v", got)
+	}
+}
+
+func TestDenyFilterAgrees(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }")
+	f := NewDenyFilter(p, 100)
+	ans := (&Simulator{Samples: 500, MaxValues: 3}).Generate(p)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, an := range ans {
+				if f.ApplyOn(an) != p.ApplyOn(an) {
+					t.Errorf("ApplyOn(%q) disagrees with the policy", an)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s := f.Stats(); s.Hits == 0 || s.Hits+s.Evaluations != 4*len(ans) {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
@@ -0,0 +1,106 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Deprecate marks an element of the lattice as deprecated, with the element
+// that replaces it, or without replacement when it's empty. Policies using
+// deprecated elements are warned about when they're parsed (see
+// Policy.Warnings) and validated. A lattice must not be modified while it's
+// evaluated.
+func (l *Lattice) Deprecate(element, replacement string) error {
+	if element == Top || element == Bottom || !l.hasElement(element) {
+		return errors.New(fmt.Sprintf("policy: %s isn't an element of lattice %s", element, l.Name))
+	}
+	if replacement != "" && (replacement == element || !l.hasElement(replacement)) {
+		return errors.New(fmt.Sprintf("policy: %s can't replace %s in lattice %s", replacement, element, l.Name))
+	}
+	if _, ok := l.Deprecated[replacement]; ok {
+		return errors.New(fmt.Sprintf("policy: %s is deprecated in lattice %s too", replacement, l.Name))
+	}
+	deprecated := make(map[string]string, len(l.Deprecated)+1)
+	for e, r := range l.Deprecated {
+		deprecated[e] = r
+	}
+	deprecated[element] = replacement
+	l.Deprecated = deprecated
+	return nil
+}
+
+// Replacement returns the replacement of a deprecated element, empty when it
+// has none, and false when the element isn't deprecated
+func (l *Lattice) Replacement(element string) (string, bool) {
+	r, ok := l.Deprecated[element]
+	return r, ok
+}
+
+// deprecatedUses returns an error per deprecated element that the policy or
+// its exceptions use, in the order of use
+func (p *Policy) deprecatedUses() []error {
+	errs := make([]error, 0)
+	seen := make(map[pair]bool)
+	var walk func(q *Policy)
+	walk = func(q *Policy) {
+		for _, pa := range q.Clause {
+			l := p.baseOn[pa.name]
+			if l == nil {
+				continue
+			}
+			for _, e := range p.elementsOf(l, pa.value) {
+				key := pair{name: pa.name, value: e}
+				r, ok := l.Replacement(e)
+				if !ok || seen[key] {
+					continue
+				}
+				seen[key] = true
+				if r == "" {
+					errs = append(errs, errors.New(fmt.Sprintf("policy: %s %s is deprecated", pa.name, e)))
+				} else {
+					errs = append(errs, errors.New(fmt.Sprintf("policy: %s %s is deprecated, use %s %s instead", pa.name, e, pa.name, r)))
+				}
+			}
+		}
+		for i := range q.Excepts {
+			walk(&q.Excepts[i])
+		}
+	}
+	walk(p)
+	return errs
+}
+
+// elementsOf returns the elements of the lattice that a value uses: the
+// members of a value set, the first half of product values, and the base of
+// parameterized ones
+func (p *Policy) elementsOf(l *Lattice, value string) []string {
+	members := []string{value}
+	if _, ms, ok := parseValueSet(value); ok {
+		members = ms
+	}
+	es := make([]string, 0, len(members))
+	for _, m := range members {
+		if l.isProductValue(m) {
+			m, _ = l.halve(m)
+		}
+		es = append(es, baseOf(m))
+	}
+	return es
+}
+
+// mapDeprecated returns a copy of an annotation whose deprecated elements
+// are replaced by their replacements, if any
+func (p *Policy) mapDeprecated(an Annotation) Annotation {
+	res := append(Annotation{}, an...)
+	for i, pa := range res {
+		l := p.baseOn[pa.name]
+		if l == nil {
+			continue
+		}
+		v, s := l.halve(pa.value)
+		if r, ok := l.Replacement(v); ok && r != "" {
+			res[i].value = l.combine(r, s)
+		}
+	}
+	return res
+}
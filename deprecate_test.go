@@ -0,0 +1,80 @@
+package grok
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDeprecate(t *testing.T) {
+	l := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"], "Device": [] },
+		"deprecated": { "Device": "" } }`)
+	if r, ok := l.Replacement("Device"); !ok || r != "" {
+		t.Errorf("Replacement(Device) = %q, %v", r, ok)
+	}
+	if err := l.Deprecate("UniqueID", "Location"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	cases := []struct {
+		element, replacement, err string
+	}{
+		{"Email", "", "policy: Email isn't an element of lattice DataType"},
+		{Top, "", "policy: TOP isn't an element of lattice DataType"},
+		{"AccountID", "Email", "policy: Email can't replace AccountID in lattice DataType"},
+		{"AccountID", "AccountID", "policy: AccountID can't replace AccountID in lattice DataType"},
+		{"AccountID", "UniqueID", "policy: UniqueID is deprecated in lattice DataType too"},
+	}
+	for _, c := range cases {
+		if err := l.Deprecate(c.element, c.replacement); err == nil || err.Error() != c.err {
+			t.Errorf("Deprecate(%s, %s) = %v, want %q", c.element, c.replacement, err, c.err)
+		}
+	}
+
+	p := NewPolicy([]*Lattice{l})
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType UniqueID DataType Device EXCEPT { ALLOW DataType UniqueID } }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := []string{"policy: DataType UniqueID is deprecated, use DataType Location instead", "policy: DataType Device is deprecated"}
+	if !equals(p.Warnings, want) {
+		t.Errorf("Warnings = %q, want %q", p.Warnings, want)
+	}
+	errs := p.Validate()
+	if len(errs) != 2 || errs[0].Error() != want[0] || errs[1].Error() != want[1] {
+		t.Errorf("Validate() = %v, want %q", errs, want)
+	}
+
+	for _, mapped := range []bool{false, true} {
+		p.MapDeprecated = mapped
+		an, err := p.ParseAnnotation("DataType UniqueID DataType Device")
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		want := "DataType UniqueID DataType Device"
+		if mapped {
+			want = "DataType Location DataType Device"
+		}
+		if an.String() != want {
+			t.Errorf("ParseAnnotation() with MapDeprecated %v = %s, want %s", mapped, an, want)
+		}
+	}
+}
+
+func TestDeprecatedSnapshot(t *testing.T) {
+	l := NewLattice(`{ "name": "DataType", "edges": { "Location": [], "Device": [] }, "deprecated": { "Device": "Location" } }`)
+	p := NewPolicy([]*Lattice{l})
+	if err := p.ParsePolicy("ALLOW DataType Device"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	var buf bytes.Buffer
+	if err := p.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("%q", err)
+	}
+	q, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if errs := q.Validate(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "use DataType Location instead") {
+		t.Errorf("Validate() of the snapshot = %v", errs)
+	}
+}
@@ -0,0 +1,141 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Keywords of derivation rules, see ParseDerivation
+const (
+	If   = "IF"
+	And  = "AND"
+	Then = "THEN"
+)
+
+// Condition is a condition of a derivation rule on the values of an
+// attribute: a value below Value, or Value itself when Exact
+type Condition struct {
+	Attribute, Value string
+	Exact            bool
+}
+
+// String returns the condition in its syntax, e.g. DataType <= UniqueID
+func (c Condition) String() string {
+	op := "<="
+	if c.Exact {
+		op = "="
+	}
+	return c.Attribute + " " + op + " " + c.Value
+}
+
+// DerivationRule derives pairs from the annotations that meet its
+// conditions, so that derived classifications, e.g. a risk, aren't
+// materialized upstream. The attributes of conditions are the lattices of
+// the policy or their state lattices (see Constraint), and a condition is met
+// when a value of the annotation meets it.
+type DerivationRule struct {
+	Conditions []Condition
+	// Derived are the pairs added to the annotations meeting the conditions
+	Derived Annotation
+}
+
+// String returns the rule in its syntax, see ParseDerivation
+func (r DerivationRule) String() string {
+	cs := make([]string, 0, len(r.Conditions))
+	for _, c := range r.Conditions {
+		cs = append(cs, c.String())
+	}
+	return If + " " + strings.Join(cs, " "+And+" ") + " " + Then + " " + r.Derived.String()
+}
+
+// ParseDerivation parses a derivation rule of the policy, e.g.
+//
+//	IF DataType <= UniqueID AND TypeState = Raw THEN Risk High
+func (p *Policy) ParseDerivation(str string) (DerivationRule, error) {
+	invalid := errors.New(fmt.Sprintf("policy: derivation %q should be of the form IF <attribute> <= <value> [AND ...] THEN <annotation>", str))
+	ts := strings.Fields(str)
+	then := -1
+	for i, t := range ts {
+		if t == Then {
+			then = i
+			break
+		}
+	}
+	if len(ts) < 2 || ts[0] != If || then < 0 || then%4 != 0 || then == len(ts)-1 {
+		return DerivationRule{}, invalid
+	}
+	r := DerivationRule{Conditions: make([]Condition, 0, then/4)}
+	for i := 1; i < then; i += 4 {
+		if i > 1 && ts[i-1] != And || ts[i+1] != "<=" && ts[i+1] != "=" {
+			return DerivationRule{}, invalid
+		}
+		c := Condition{ts[i], ts[i+2], ts[i+1] == "="}
+		l := p.latticeOf(c.Attribute)
+		if l == nil {
+			return DerivationRule{}, errors.New(fmt.Sprintf("policy: derivation %q refers to unknown lattice %s", str, c.Attribute))
+		}
+		if !l.hasElement(c.Value) {
+			return DerivationRule{}, errors.New(fmt.Sprintf("policy: derivation %q refers to unknown element %s of lattice %s", str, c.Value, c.Attribute))
+		}
+		r.Conditions = append(r.Conditions, c)
+	}
+	derived, err := p.ParseAnnotationPart(strings.Join(ts[then+1:], " "))
+	if err != nil {
+		return DerivationRule{}, err
+	}
+	r.Derived = derived
+	return r, nil
+}
+
+// Derive returns the annotation with the pairs derived by the derivation
+// rules of the policy, which are applied until no rule derives new pairs,
+// so that rules can build on the pairs derived by others
+func (p *Policy) Derive(an Annotation) Annotation {
+	if len(p.Derivations) == 0 {
+		return an
+	}
+	res := append(Annotation{}, an...)
+	for derived := true; derived; {
+		derived = false
+		for _, r := range p.Derivations {
+			if !p.meets(res, r.Conditions) {
+				continue
+			}
+			for _, pa := range r.Derived {
+				if !containsPair(res, pa) {
+					res = append(res, pa)
+					derived = true
+				}
+			}
+		}
+	}
+	return res
+}
+
+// meets returns true when an annotation meets all the conditions
+func (p *Policy) meets(an Annotation, cs []Condition) bool {
+	for _, c := range cs {
+		l := p.latticeOf(c.Attribute)
+		met := false
+		for _, pa := range an {
+			if v, ok := p.valueIn(pa, c.Attribute); ok && (v == c.Value || !c.Exact && l.Precede(v, c.Value)) {
+				met = true
+				break
+			}
+		}
+		if !met {
+			return false
+		}
+	}
+	return true
+}
+
+func containsPair(an Annotation, pa pair) bool {
+	for _, qa := range an {
+		if qa.name == pa.name && qa.value == pa.value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package grok
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newDerivingPolicy(t *testing.T) *Policy {
+	l := NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"], "Email": [] } }`)
+	l.Product(NewLattice(`{ "name": "TypeState", "edges": { "Raw": ["Truncated"] } }`))
+	p := NewPolicy([]*Lattice{l, NewLattice(`{ "name": "Risk", "edges": { "High": ["Low"] } }`)})
+	for _, str := range []string{
+		"IF DataType <= UniqueID AND TypeState = Raw THEN Risk High",
+		"IF Risk = High THEN Risk Low",
+	} {
+		r, err := p.ParseDerivation(str)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if r.String() != str {
+			t.Errorf("String() = %q, want %q", r, str)
+		}
+		p.Derivations = append(p.Derivations, r)
+	}
+	if err := p.ParsePolicy("ALLOW DataType TOP Risk Low"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return p
+}
+
+func TestDerive(t *testing.T) {
+	p := newDerivingPolicy(t)
+	cases := []struct {
+		astr, derived string
+	}{
+		{"DataType AccountID:Raw", "DataType AccountID:Raw Risk High Risk Low"},
+		{"DataType AccountID:Truncated", "DataType AccountID:Truncated"},
+		{"DataType Email:Raw", "DataType Email:Raw"},
+		{"DataType Email:Raw DataType IPAddress", "DataType Email:Raw DataType IPAddress Risk High Risk Low"},
+	}
+	for _, c := range cases {
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		derived := p.Derive(an)
+		if derived.String() != c.derived {
+			t.Errorf("Derive(%q) = %s, want %s", c.astr, derived, c.derived)
+		}
+		// the evaluator derives the pairs before matching the policy
+		allowed := derived.String() == c.astr
+		if p.ApplyOn(an) != allowed || p.Evaluate(an).Allowed != allowed {
+			t.Errorf("ApplyOn(%q) = %v, want %v", c.astr, p.ApplyOn(an), allowed)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("%q", err)
+	}
+	q, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	an, _ := q.ParseAnnotation("DataType AccountID:Raw")
+	if len(q.Derivations) != 2 || q.ApplyOn(an) {
+		t.Errorf("ReadSnapshot() derivations = %v", q.Derivations)
+	}
+}
+
+func TestParseDerivation(t *testing.T) {
+	p := newDerivingPolicy(t)
+	cases := []struct {
+		str, err string
+	}{
+		{"IF DataType <= UniqueID", "should be of the form"},
+		{"DataType <= UniqueID THEN Risk High", "should be of the form"},
+		{"IF DataType < UniqueID THEN Risk High", "should be of the form"},
+		{"IF DataType <= UniqueID OR Risk = Low THEN Risk High", "should be of the form"},
+		{"IF DataType <= UniqueID THEN", "should be of the form"},
+		{"IF Region = EU THEN Risk High", "refers to unknown lattice Region"},
+		{"IF DataType <= Phone THEN Risk High", "refers to unknown element Phone of lattice DataType"},
+		{"IF DataType <= UniqueID THEN Risk Medium", "Medium"},
+	}
+	for _, c := range cases {
+		if _, err := p.ParseDerivation(c.str); err == nil || !bytes.Contains([]byte(err.Error()), []byte(c.err)) {
+			t.Errorf("ParseDerivation(%q) = %v, want %q", c.str, err, c.err)
+		}
+	}
+}
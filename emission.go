@@ -0,0 +1,121 @@
+package grok
+
+import (
+	"sync"
+	"time"
+)
+
+// EmissionLimiter deduplicates and rate-limits the emission of violations,
+// so that the same violation found again and again by graph checks or
+// streaming enforcement doesn't flood reports and alert channels. A violation
+// is identified by its fingerprint (see Fingerprint). It is safe for
+// concurrent use.
+type EmissionLimiter struct {
+	// Window is the deduplication window: a violation isn't emitted again
+	// within Window of its last emission. No violation is deduplicated when
+	// it's 0.
+	Window time.Duration
+	// Rate is the maximum number of violations emitted in any period Per,
+	// unlimited when it's 0
+	Rate int
+	Per  time.Duration
+	// Now is the clock of the limiter, time.Now when it's nil
+	Now func() time.Time
+
+	mu sync.Mutex
+	// last are the times of the last emissions by fingerprint, pruned every
+	// Window
+	last   map[string]time.Time
+	pruned time.Time
+	// emitted are the times of the emissions of the current period, oldest first
+	emitted []time.Time
+	stats   EmissionStats
+}
+
+// EmissionStats count the decisions of an EmissionLimiter
+type EmissionStats struct {
+	Emitted int64
+	// Duplicates are the violations suppressed by the deduplication window
+	Duplicates int64
+	// RateLimited are the violations suppressed by the rate limit
+	RateLimited int64
+}
+
+// NewEmissionLimiter returns a limiter deduplicating violations within a
+// window, and emitting at most rate violations per period
+func NewEmissionLimiter(window time.Duration, rate int, per time.Duration) *EmissionLimiter {
+	return &EmissionLimiter{Window: window, Rate: rate, Per: per}
+}
+
+// Allow returns true when the violation of a fingerprint is emitted, and
+// records its emission
+func (l *EmissionLimiter) Allow(fingerprint string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.Now != nil {
+		now = l.Now()
+	}
+	if l.last == nil {
+		l.last = make(map[string]time.Time)
+	}
+
+	if l.Window > 0 {
+		if now.Sub(l.pruned) >= l.Window {
+			for fp, t := range l.last {
+				if now.Sub(t) >= l.Window {
+					delete(l.last, fp)
+				}
+			}
+			l.pruned = now
+		}
+		if t, ok := l.last[fingerprint]; ok && now.Sub(t) < l.Window {
+			l.stats.Duplicates++
+			return false
+		}
+	}
+	if l.Rate > 0 {
+		i := 0
+		for i < len(l.emitted) && now.Sub(l.emitted[i]) >= l.Per {
+			i++
+		}
+		l.emitted = l.emitted[i:]
+		if len(l.emitted) >= l.Rate {
+			l.stats.RateLimited++
+			return false
+		}
+		l.emitted = append(l.emitted, now)
+	}
+	if l.Window > 0 {
+		l.last[fingerprint] = now
+	}
+	l.stats.Emitted++
+	return true
+}
+
+// Stats returns the counts of the emitted and suppressed violations
+func (l *EmissionLimiter) Stats() EmissionStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Sink returns an audit sink writing the records to s, where the records of
+// denials are deduplicated and rate-limited by the limiter, a denial being
+// identified by its policy and annotation. The records of allows are all
+// written.
+func (l *EmissionLimiter) Sink(s AuditSink) AuditSink {
+	return &limitedSink{l, s}
+}
+
+type limitedSink struct {
+	l *EmissionLimiter
+	s AuditSink
+}
+
+func (ls *limitedSink) Write(r Record) error {
+	if r.Allowed() || ls.l.Allow(Fingerprint(r.PolicyID, r.Annotation.String())) {
+		return ls.s.Write(r)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package grok
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEmissionLimiter(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	l := NewEmissionLimiter(time.Minute, 2, time.Second)
+	l.Now = func() time.Time { return now }
+
+	steps := []struct {
+		after       time.Duration
+		fingerprint string
+		allowed     bool
+	}{
+		{0, "a", true},
+		{0, "a", false}, // duplicate
+		{0, "b", true},
+		{0, "c", false}, // rate-limited
+		{time.Second, "c", true},
+		{30 * time.Second, "a", false},
+		{30 * time.Second, "a", true}, // out of the window
+	}
+	for i, s := range steps {
+		now = now.Add(s.after)
+		if got := l.Allow(s.fingerprint); got != s.allowed {
+			t.Errorf("step %d: Allow(%s) = %t, want %t", i, s.fingerprint, got, s.allowed)
+		}
+	}
+	if s := l.Stats(); s.Emitted != 4 || s.Duplicates != 2 || s.RateLimited != 1 {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func TestEmissionLimiterSink(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType Location")
+	l := NewEmissionLimiter(time.Hour, 0, 0)
+	var sink memorySink
+	for _, astr := range []string{"DataType AccountID", "DataType AccountID", "DataType IPAddress", "DataType IPAddress"} {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		p.Evaluate(an, WithAuditSink(l.Sink(&sink)))
+	}
+	if len(sink.records) != 3 || sink.records[0].Allowed() || !sink.records[1].Allowed() {
+		t.Errorf("records = %+v", sink.records)
+	}
+}
@@ -0,0 +1,186 @@
+package grok
+
+import (
+	"crypto/ed25519"
+	"time"
+)
+
+// Decision is the result of evaluating a policy on an annotation
+type Decision struct {
+	// PolicyID is the ID of the evaluated policy
+	PolicyID string
+	// Allowed is the effect returned to the caller, which the monitor-mode
+	// policies and exceptions don't take part in
+	Allowed bool
+	// WouldBe is the effect (ALLOW or DENY) the decision would have if every
+	// monitor-mode policy and exception was enforced, when it differs from
+	// Allowed
+	WouldBe string
+	// Monitored is true when monitor mode changed the effect, i.e. WouldBe
+	// is set
+	Monitored bool
+	Timestamp time.Time
+	// Unknown are the attributes of the annotation unknown to the policy,
+	// when the policy flags them (see FlagUnknown)
+	Unknown []string
+	// Unclassified is true when the effect depends on the Unknown values of
+	// the annotation, i.e. evaluating them the other way changes it (see
+	// UnknownElement)
+	Unclassified bool
+	// Warnings are the non-fatal issues of the evaluation, e.g. unknown
+	// attributes that were ignored, by kind
+	Warnings []Warning
+	// Err is ErrBudgetExceeded when the evaluation ran out of budget (see
+	// WithBudget), in which case the decision denies, and Explanation is the
+	// partial explanation of the evaluation
+	Err         error
+	Explanation *Explanation
+	// Certificate is the signed certificate of the decision, when one is
+	// requested (see WithCertificate)
+	Certificate *Certificate
+}
+
+// AuditSink receives the records of decisions, e.g. a RecordWriter
+type AuditSink interface {
+	Write(r Record) error
+}
+
+// EvalOption configures Evaluate
+type EvalOption func(*evalContext)
+
+// WithAuditSink records every decision into an audit sink. The audit sink
+// errors are ignored, since auditing must not fail decisions.
+func WithAuditSink(s AuditSink) EvalOption {
+	return func(ctx *evalContext) {
+		ctx.sinks = append(ctx.sinks, s)
+	}
+}
+
+// WithClock sets the clock used to timestamp decisions
+func WithClock(now func() time.Time) EvalOption {
+	return func(ctx *evalContext) {
+		ctx.now = now
+	}
+}
+
+// evalContext is the configuration and the state of an evaluation
+type evalContext struct {
+	sinks []AuditSink
+	now   func() time.Time
+	// enforce is true to enforce monitor-mode policies and exceptions
+	enforce bool
+	// profile collects the time spent, see ProfileEvaluate
+	profile *profiler
+	// budget limits the work of the evaluation passes, see WithBudget
+	budget *budget
+	// certKey signs the certificates of decisions, see WithCertificate
+	certKey ed25519.PrivateKey
+	// fallbacks are the fallback elements of expired values by attribute,
+	// see WithExpiryFallback
+	fallbacks map[string]string
+	// usage tracks the elements and the clauses used, see WithUsage
+	usage *UsageTracker
+	// classifier is the policy saying how the Unknown values are evaluated,
+	// and flipUnclassified evaluates them the other way (see
+	// UnclassifiedValues)
+	classifier       *Policy
+	flipUnclassified bool
+	// explain traces the effect into the explanation of the decision, see
+	// Policy.Explain
+	explain bool
+}
+
+// monitored returns true when ex is in monitor mode and isn't enforced by
+// the context, so that its result must be ignored
+func (ctx *evalContext) monitored(ex *Policy) bool {
+	return ex.Monitor && (ctx == nil || !ctx.enforce)
+}
+
+// skipped returns true when ex is monitored in an evaluation, where it isn't
+// applied at all, so that it can't spend the budget of the effect. Traces
+// (without a context) still apply it for its explanation.
+func (ctx *evalContext) skipped(ex *Policy) bool {
+	return ctx != nil && ctx.monitored(ex)
+}
+
+// monitorsExceptions returns true when an exception of the policy, at any
+// depth, is in monitor mode
+func (p *Policy) monitorsExceptions() bool {
+	for i := range p.Excepts {
+		if p.Excepts[i].Monitor || p.Excepts[i].monitorsExceptions() {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate applies the policy on an annotation like ApplyOn, and returns the
+// decision. The effect is evaluated with the policies and exceptions in
+// monitor mode left out, so that monitor mode never changes it. They are
+// evaluated afterwards, and their would-be effect is recorded in the audit
+// sinks (as the WouldBe effect of the record) when it differs.
+func (p *Policy) Evaluate(an Annotation, opts ...EvalOption) Decision {
+	ctx := &evalContext{now: time.Now}
+	for _, opt := range opts {
+		opt(ctx)
+	}
+
+	d := Decision{PolicyID: p.ID, Timestamp: ctx.now()}
+	if ctx.usage != nil {
+		ctx.usage.observe(p, an)
+	}
+	// with a budget, the passes are traced for the partial explanation
+	var e *Explanation
+	if ctx.budget != nil || ctx.explain {
+		e = new(Explanation)
+	}
+	if p.Monitor {
+		e.start(p, an)
+		d.Allowed = e.result(true)
+	} else {
+		d.Allowed = p.apply(an, e, ctx)
+	}
+	exceeded := ctx.exceeded()
+	if exceeded {
+		d.Allowed, d.Err, d.Explanation = false, ErrBudgetExceeded, e
+	} else if ctx.explain {
+		d.Explanation = e
+	}
+	// the would-be effect isn't known when it runs out of budget, and is the
+	// effect itself without policies and exceptions in monitor mode
+	if !exceeded && (p.Monitor || p.hasMonitor) {
+		ctx.enforce = true
+		wouldBe := p.apply(an, nil, ctx)
+		ctx.enforce = false
+		if !ctx.exceeded() && wouldBe != d.Allowed {
+			d.WouldBe = EffectOf(wouldBe)
+		}
+	}
+	d.Monitored = d.WouldBe != ""
+	d.Unclassified = !exceeded && p.dependsOnUnclassified(an, d.Allowed, ctx)
+	if d.Unclassified && ctx.usage != nil {
+		ctx.usage.depended()
+	}
+	if p.Unknown == FlagUnknown {
+		if unknown := p.UnknownAttributesOf(an); len(unknown) > 0 {
+			d.Unknown = unknown
+		}
+	}
+	d.Warnings = p.warningsOf(an, d)
+	if ctx.certKey != nil {
+		d.Certificate = p.Certify(an, d, ctx.certKey)
+	}
+
+	if len(ctx.sinks) > 0 {
+		r := Record{Annotation: an, PolicyID: p.ID, Effect: EffectOf(d.Allowed), Timestamp: d.Timestamp, Unknown: d.Unknown,
+			Unclassified: d.Unclassified}
+		if d.Err != nil {
+			r.Error = d.Err.Error()
+		}
+		r.WouldBe = d.WouldBe
+		for _, s := range ctx.sinks {
+			s.Write(r)
+		}
+	}
+	return d
+}
@@ -0,0 +1,96 @@
+package grok
+
+import (
+	"testing"
+	"time"
+)
+
+// memorySink is an AuditSink keeping records in memory
+type memorySink struct {
+	records []Record
+}
+
+func (s *memorySink) Write(r Record) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func TestParseMonitor(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW MODE=monitor DataType TOP EXCEPT { DENY MODE = enforce DataType IPAddress }`)
+	if !p.Monitor || p.Excepts[0].Monitor || len(p.Clause) != 1 || len(p.Excepts[0].Clause) != 1 {
+		t.Errorf("ParsePolicy() = %+v", p)
+	}
+	if err := p.ParsePolicy(`DENY MODE=dryrun DataType IPAddress`); err == nil {
+		t.Errorf("ParsePolicy() with an invalid mode should fail")
+	}
+}
+
+func TestEvaluateMonitor(t *testing.T) {
+	pexcept := `ALLOW DataType TOP EXCEPT { DENY MODE=monitor DataType IPAddress DataType AccountID }`
+	cases := []struct {
+		pstr    string
+		astr    string
+		allowed bool
+		wouldBe string
+	}{
+		{pexcept, "DataType IPAddress DataType AccountID", true, Deny},
+		{pexcept, "DataType IPAddress", true, ""},
+		{"DENY MODE=monitor DataType AccountID", "DataType AccountID", true, Deny},
+		{"DENY MODE=enforce DataType AccountID", "DataType AccountID", false, ""},
+		// the enforced DENY denies, and the exception in monitor mode would allow
+		{"DENY DataType UniqueID EXCEPT { ALLOW MODE=monitor DataType AccountID }", "DataType AccountID", false, Allow},
+		{"DENY DataType UniqueID EXCEPT { ALLOW MODE=monitor DataType AccountID }", "DataType Location", false, ""},
+		{"ALLOW MODE=monitor DataType AccountID", "DataType Location", true, Deny},
+	}
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range cases {
+		p := newScopedPolicy(t, c.pstr)
+		p.ID = "no-joins"
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		sink := &memorySink{}
+		d := p.Evaluate(an, WithAuditSink(sink), WithClock(func() time.Time { return now }))
+		if d.Allowed != c.allowed || d.WouldBe != c.wouldBe || d.Monitored != (c.wouldBe != "") || d.PolicyID != p.ID {
+			t.Errorf("Evaluate [%q] on [%q] = %+v", c.pstr, c.astr, d)
+		}
+		if d.Allowed != p.ApplyOn(an) {
+			t.Errorf("Evaluate [%q] on [%q] disagrees with ApplyOn", c.pstr, c.astr)
+		}
+		if len(sink.records) != 1 {
+			t.Fatalf("len(records) = %d, want 1", len(sink.records))
+		}
+		r := sink.records[0]
+		if r.Effect != EffectOf(c.allowed) || r.PolicyID != p.ID || !r.Timestamp.Equal(now) || r.WouldBe != c.wouldBe {
+			t.Errorf("record = %+v", r)
+		}
+	}
+}
+
+func TestEvaluateWouldBePass(t *testing.T) {
+	cases := []struct {
+		pstr   string
+		passes int
+	}{
+		{"ALLOW DataType TOP EXCEPT { DENY DataType IPAddress }", 1},
+		{"ALLOW DataType TOP EXCEPT { DENY DataType Location EXCEPT { ALLOW MODE=monitor DataType IPAddress } }", 2},
+		{"DENY MODE=monitor DataType IPAddress", 1},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, c.pstr)
+		an, err := p.ParseAnnotation("DataType IPAddress")
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		// the steps of a pass, and of the decision
+		pass := &evalContext{budget: &budget{}}
+		p.apply(an, nil, pass)
+		var ctx *evalContext
+		p.Evaluate(an, WithBudget(Budget{}), func(c *evalContext) { ctx = c })
+		// a monitored policy has no pass of its own, only the would-be one
+		if got, want := ctx.budget.steps, c.passes*pass.budget.steps; got != want {
+			t.Errorf("Evaluate() on %s walked %d steps, want %d (%d passes)", c.pstr, got, want, c.passes)
+		}
+	}
+}
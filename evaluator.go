@@ -0,0 +1,126 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of evaluators, see WithEvaluatorKind
+const (
+	// RecursiveEvaluator walks the policy and the edges of its lattices on
+	// every evaluation, even when the lattices are compiled
+	RecursiveEvaluator = "recursive"
+	// CompiledEvaluator compiles copies of the lattices of the policy when
+	// it's created (see Compile), so that evaluations look their closures up
+	CompiledEvaluator = "compiled"
+)
+
+// Evaluator evaluates a policy. It's the stable interface of the evaluation
+// strategies, so that embedders don't depend on how decisions are made.
+// Evaluators are safe for concurrent use.
+type Evaluator interface {
+	// Evaluate returns the decision of the policy on an annotation, see
+	// Policy.Evaluate
+	Evaluate(an Annotation, opts ...EvalOption) Decision
+	// Explain returns the decision of the policy on an annotation with its
+	// explanation, see Policy.Explain
+	Explain(an Annotation, opts ...EvalOption) (*Decision, error)
+	// Stats returns the statistics of the evaluations
+	Stats() EvaluatorStats
+}
+
+// EvaluatorStats are the statistics of the evaluations of an Evaluator
+type EvaluatorStats struct {
+	// Kind is the kind of the evaluator
+	Kind string
+	// Evaluations count the decisions, of which Allowed allowed
+	Evaluations, Allowed int64
+	// Time is the time spent in evaluations
+	Time time.Duration
+}
+
+// EvaluatorOption configures NewEvaluator
+type EvaluatorOption func(*evaluatorConfig)
+
+type evaluatorConfig struct {
+	kind string
+}
+
+// WithEvaluatorKind selects the kind of the evaluator, RecursiveEvaluator by
+// default
+func WithEvaluatorKind(kind string) EvaluatorOption {
+	return func(c *evaluatorConfig) {
+		c.kind = kind
+	}
+}
+
+// NewEvaluator returns the evaluator of a policy. The evaluator evaluates a
+// copy of the policy taken when it's created, based on its own copies of the
+// lattices, so that the lattices of the policy aren't modified.
+func NewEvaluator(p *Policy, opts ...EvaluatorOption) (Evaluator, error) {
+	c := &evaluatorConfig{kind: RecursiveEvaluator}
+	for _, opt := range opts {
+		opt(c)
+	}
+	switch c.kind {
+	case RecursiveEvaluator:
+		return &policyEvaluator{p: p.rebind(p.copyLattices(false)), kind: c.kind}, nil
+	case CompiledEvaluator:
+		return &policyEvaluator{p: p.rebind(p.copyLattices(true)), kind: c.kind}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("policy: unknown evaluator %s", c.kind))
+}
+
+// copyLattices returns copies of the lattices the policy is based on, by
+// name, that are compiled or else have no closure
+func (p *Policy) copyLattices(compile bool) map[string]*Lattice {
+	baseOn := make(map[string]*Lattice, len(p.baseOn))
+	for name, l := range p.baseOn {
+		baseOn[name] = l.copied(compile)
+	}
+	return baseOn
+}
+
+// copied returns a copy of the lattice and of its state lattice, which is
+// compiled or else has no closure
+func (l *Lattice) copied(compile bool) *Lattice {
+	c := l.bare()
+	if s := l.state(); s != nil {
+		c.Product(s.copied(compile))
+	}
+	if compile {
+		c.Compile()
+	}
+	return c
+}
+
+// policyEvaluator evaluates its copy of a policy with Policy.Evaluate, which
+// looks the closures of the lattices up when they're compiled
+type policyEvaluator struct {
+	p    *Policy
+	kind string
+	// evaluations, allowed and nanos are updated atomically
+	evaluations, allowed, nanos int64
+}
+
+func (e *policyEvaluator) Evaluate(an Annotation, opts ...EvalOption) Decision {
+	start := time.Now()
+	d := e.p.Evaluate(an, opts...)
+	atomic.AddInt64(&e.nanos, int64(time.Since(start)))
+	atomic.AddInt64(&e.evaluations, 1)
+	if d.Allowed {
+		atomic.AddInt64(&e.allowed, 1)
+	}
+	return d
+}
+
+func (e *policyEvaluator) Explain(an Annotation, opts ...EvalOption) (*Decision, error) {
+	return e.p.Explain(an, opts...)
+}
+
+func (e *policyEvaluator) Stats() EvaluatorStats {
+	return EvaluatorStats{Kind: e.kind, Evaluations: atomic.LoadInt64(&e.evaluations),
+		Allowed: atomic.LoadInt64(&e.allowed), Time: time.Duration(atomic.LoadInt64(&e.nanos))}
+}
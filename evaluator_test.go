@@ -0,0 +1,88 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestEvaluator(t *testing.T) {
+	if _, err := NewEvaluator(newScopedPolicy(t, `ALLOW DataType TOP`), WithEvaluatorKind("jit")); err == nil {
+		t.Errorf("unknown evaluator should fail")
+	}
+
+	for _, kind := range []string{RecursiveEvaluator, CompiledEvaluator} {
+		p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType AccountID }`)
+		e, err := NewEvaluator(p, WithEvaluatorKind(kind))
+		if err != nil {
+			t.Fatalf("%s: %q", kind, err)
+		}
+		tests := []struct {
+			an      string
+			allowed bool
+		}{
+			{"DataType Location", true},
+			{"DataType AccountID", false},
+			{"DataType IPAddress", true},
+		}
+		for _, tt := range tests {
+			an, err := p.ParseAnnotation(tt.an)
+			if err != nil {
+				t.Fatalf("%q", err)
+			}
+			if d := e.Evaluate(an); d.Allowed != tt.allowed {
+				t.Errorf("%s: Evaluate(%s) = %v, want %v", kind, tt.an, d.Allowed, tt.allowed)
+			}
+			if d, err := e.Explain(an); err != nil || d.Allowed != tt.allowed || d.Explanation.Allowed != tt.allowed {
+				t.Errorf("%s: Explain(%s) = %+v, %v, want %v", kind, tt.an, d, err, tt.allowed)
+			}
+		}
+		s := e.Stats()
+		if s.Kind != kind || s.Evaluations != 3 || s.Allowed != 2 {
+			t.Errorf("%s: Stats() = %+v", kind, s)
+		}
+		// the evaluators don't compile the lattices of the policy
+		if p.baseOn["DataType"].Compiled() {
+			t.Errorf("%s: the lattice of the policy is compiled", kind)
+		}
+	}
+}
+
+func TestEvaluatorKinds(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID DENY DataType Location }`)
+	p.baseOn["DataType"].Product(NewLattice(`{ "name": "TypeState", "edges": { "Raw": ["Truncated"] } }`))
+	// the recursive evaluator walks the lattices even when the policy's are
+	// compiled, while the compiled one looks its own closures up
+	p.Compile()
+	evaluators := make(map[string]Evaluator)
+	for _, kind := range []string{RecursiveEvaluator, CompiledEvaluator} {
+		e, err := NewEvaluator(p, WithEvaluatorKind(kind))
+		if err != nil {
+			t.Fatalf("%s: %q", kind, err)
+		}
+		for _, l := range e.(*policyEvaluator).p.lattices() {
+			if l == p.baseOn[l.Name] || l.Compiled() != (kind == CompiledEvaluator) {
+				t.Errorf("%s: lattice %s is shared or has Compiled() = %v", kind, l.Name, l.Compiled())
+			}
+		}
+		evaluators[kind] = e
+	}
+
+	astrs := []string{
+		"DataType Location",
+		"DataType IPAddress",
+		"DataType IPAddress:Truncated DataType AccountID",
+		"DataType UniqueID",
+		"DataType AccountID DataType ANYOF(IPAddress,BOTTOM)",
+	}
+	for _, astr := range astrs {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		want := p.Evaluate(an).Allowed
+		for kind, e := range evaluators {
+			if got := e.Evaluate(an).Allowed; got != want {
+				t.Errorf("%s: Evaluate(%s) = %t, want %t", kind, astr, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package grok
+
+import (
+	"fmt"
+	"time"
+)
+
+// Until returns a copy of the annotation whose pairs of an attribute value
+// expire at a time, e.g. Consent Given until the consent lapses. Expiries are
+// honored by EvaluateAt, and kept by the JSON of annotations.
+func (an Annotation) Until(name, value string, t time.Time) Annotation {
+	res := append(Annotation{}, an...)
+	for i := range res {
+		if res[i].name == name && res[i].value == value {
+			res[i].expires = t
+		}
+	}
+	return res
+}
+
+// Expiry returns the time a value of an attribute of the annotation expires
+// at, and false when it doesn't expire
+func (an Annotation) Expiry(name, value string) (time.Time, bool) {
+	for _, pa := range an {
+		if pa.name == name && pa.value == value && !pa.expires.IsZero() {
+			return pa.expires, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// At returns the annotation as of a time, without the values expired by then
+func (an Annotation) At(t time.Time) Annotation {
+	res := make(Annotation, 0, len(an))
+	for _, pa := range an {
+		if pa.expires.IsZero() || t.Before(pa.expires) {
+			res = append(res, pa)
+		}
+	}
+	return res
+}
+
+// WithExpiryFallback flips the expired values of an attribute to a fallback
+// element of its lattice in EvaluateAt, e.g. Consent Given to Consent
+// Withdrawn, instead of dropping them
+func WithExpiryFallback(name, element string) EvalOption {
+	return func(ctx *evalContext) {
+		if ctx.fallbacks == nil {
+			ctx.fallbacks = make(map[string]string)
+		}
+		ctx.fallbacks[name] = element
+	}
+}
+
+// EvaluateAt evaluates the policy on an annotation as of a time, like
+// Evaluate with a clock stopped at the time: the pairs of the annotation that
+// expired by then are dropped, or flipped to the fallback element of their
+// attribute (see WithExpiryFallback). The decision then carries a warning per
+// expired pair, and the explanation of the evaluation with the warnings.
+func (p *Policy) EvaluateAt(t time.Time, an Annotation, opts ...EvalOption) Decision {
+	ctx := new(evalContext)
+	for _, opt := range opts {
+		opt(ctx)
+	}
+	current, warnings := p.expire(an, t, ctx.fallbacks)
+	d := p.Evaluate(current, append([]EvalOption{WithClock(func() time.Time { return t })}, opts...)...)
+	if len(warnings) > 0 {
+		if d.Explanation == nil {
+			d.Explanation = p.Trace(current)
+		}
+		d.Explanation.Warnings = append(d.Explanation.Warnings, warnings...)
+		d.Warnings = append(warnings, d.Warnings...)
+	}
+	return d
+}
+
+// expire returns the annotation as of a time, without the pairs expired by
+// then or with their fallbacks, and the warnings of the expired pairs
+func (p *Policy) expire(an Annotation, t time.Time, fallbacks map[string]string) (Annotation, []Warning) {
+	res := make(Annotation, 0, len(an))
+	warnings := make([]Warning, 0)
+	for _, pa := range an {
+		if pa.expires.IsZero() || t.Before(pa.expires) {
+			res = append(res, pa)
+			continue
+		}
+		expired := fmt.Sprintf("%s %s expired at %s", pa.name, pa.value, pa.expires.Format(time.RFC3339))
+		f, ok := fallbacks[pa.name]
+		if l := p.baseOn[pa.name]; ok && (l == nil || l.hasElement(f)) {
+			res = append(res, pair{name: pa.name, value: f, compatWith: pa.compatWith})
+			warnings = append(warnings, Warning{ExpiredValueWarning, pa.name,
+				fmt.Sprintf("%s and was replaced by %s %s.", expired, pa.name, f)})
+			continue
+		}
+		warnings = append(warnings, Warning{ExpiredValueWarning, pa.name, expired + " and was dropped."})
+	}
+	return res, warnings
+}
@@ -0,0 +1,102 @@
+package grok
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluateAt(t *testing.T) {
+	p := NewPolicy([]*Lattice{
+		NewLattice(`{ "name": "DataType", "edges": { "Email": [] } }`),
+		NewLattice(`{ "name": "Consent", "edges": { "Given": [], "Withdrawn": [] } }`),
+	})
+	if err := p.ParsePolicy("ALLOW DataType TOP Consent TOP EXCEPT { DENY DataType Email Consent Withdrawn }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	an, err := p.ParseAnnotation("DataType Email Consent Given")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	lapse := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	an = an.Until("Consent", "Given", lapse)
+	if got, ok := an.Expiry("Consent", "Given"); !ok || !got.Equal(lapse) {
+		t.Errorf("Expiry() = %v, %v", got, ok)
+	}
+	if _, ok := an.Expiry("DataType", "Email"); ok {
+		t.Errorf("Expiry() of a value without expiry should be false")
+	}
+
+	before, after := lapse.Add(-time.Hour), lapse.Add(time.Hour)
+	cases := []struct {
+		at      time.Time
+		opts    []EvalOption
+		allowed bool
+		warning string
+	}{
+		{before, nil, true, ""},
+		{after, nil, false, "Consent Given expired at 2021-06-01T00:00:00Z and was dropped."},
+		{after, []EvalOption{WithExpiryFallback("Consent", "Withdrawn")}, false,
+			"Consent Given expired at 2021-06-01T00:00:00Z and was replaced by Consent Withdrawn."},
+		{after, []EvalOption{WithExpiryFallback("Consent", "Revoked")}, false,
+			"Consent Given expired at 2021-06-01T00:00:00Z and was dropped."},
+	}
+	for _, c := range cases {
+		d := p.EvaluateAt(c.at, an, c.opts...)
+		if d.Allowed != c.allowed || !d.Timestamp.Equal(c.at) {
+			t.Errorf("EvaluateAt(%v) = %v at %v, want %v", c.at, d.Allowed, d.Timestamp, c.allowed)
+		}
+		if c.warning == "" {
+			if d.Explanation != nil {
+				t.Errorf("EvaluateAt(%v) explanation = %v, want none", c.at, d.Explanation)
+			}
+			continue
+		}
+		if d.Explanation == nil || len(d.Explanation.Warnings) != 1 || d.Explanation.Warnings[0].Message != c.warning {
+			t.Errorf("EvaluateAt(%v) explanation = %v, want warning %q", c.at, d.Explanation, c.warning)
+			continue
+		}
+		if text, err := (&Renderer{}).Render(d.Explanation); err != nil || !strings.HasSuffix(text, " "+c.warning) {
+			t.Errorf("Render() = %q, %v", text, err)
+		}
+	}
+}
+
+func TestAnnotationAt(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	an, err := p.ParseAnnotation("DataType IPAddress DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	lapse := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	an = an.Until("DataType", "IPAddress", lapse)
+	if got := an.At(lapse.Add(-time.Second)).String(); got != "DataType IPAddress DataType AccountID" {
+		t.Errorf("At() before the expiry = %q", got)
+	}
+	if got := an.At(lapse).String(); got != "DataType AccountID" {
+		t.Errorf("At() at the expiry = %q", got)
+	}
+}
+
+func TestExpiryJSON(t *testing.T) {
+	lapse := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	an := Annotation{{name: "DataType", value: "Email"}, {name: "Consent", value: "Given"}}.Until("Consent", "Given", lapse)
+	b, err := json.Marshal(an)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if want := `[["DataType","Email"],["Consent","Given","","2021-06-01T00:00:00Z"]]`; string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+	var got Annotation
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if exp, ok := got.Expiry("Consent", "Given"); !ok || !exp.Equal(lapse) {
+		t.Errorf("Unmarshal() = %v", got)
+	}
+	if err := json.Unmarshal([]byte(`[["Consent","Given","","June"]]`), &got); err == nil {
+		t.Errorf("Unmarshal() should fail on an invalid expiry")
+	}
+}
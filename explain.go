@@ -0,0 +1,153 @@
+package grok
+
+// Explanation is the trace of applying a policy on an annotation. It mirrors
+// the policy: every evaluated exception has its own Explanation.
+type Explanation struct {
+	Mode bool
+	// Monitor is true for a policy (or exception) in monitor mode, whose
+	// result doesn't count in the result of its parent
+	Monitor bool
+	Clause  Clause
+	// Annotation is the annotation the policy is applied on. Exceptions of a
+	// DENY policy are applied on the overlap of their parent.
+	Annotation Annotation
+	// Matched is true when the annotation is in the scope of the clause, i.e.
+	// every value is allowed by an ALLOW clause, or every attribute overlaps
+	// with a DENY clause
+	Matched bool
+	// Attribute is the attribute that failed to match, or COMPATIBLEWITH when
+	// a compatibility condition failed
+	Attribute string
+	// Failed are the values of a lattice Attribute that failed the
+	// comparison: the values of the annotation that are below no value of an
+	// ALLOW clause, or the values of a DENY clause that meet the values of
+	// the annotation at BOTTOM
+	Failed []string
+	// Overlap is the overlap of a matched DENY clause and the annotation
+	Overlap Annotation
+	// Excepts are the evaluated exceptions, in order
+	Excepts []*Explanation
+	// Decider is the index of the exception that decided the result, or -1
+	Decider int
+	Allowed bool
+	// Exhausted is true when the evaluation ran out of budget at this policy
+	// (see WithBudget), so that the explanation is partial
+	Exhausted bool
+	// Warnings are the warnings of the evaluation, e.g. the expired values
+	// that EvaluateAt dropped, which a Renderer renders in its locale
+	Warnings []Warning
+}
+
+// Trace applies the policy on an annotation like ApplyOn, and returns the
+// explanation of the result
+func (p *Policy) Trace(an Annotation) *Explanation {
+	e := new(Explanation)
+	p.apply(an, e, nil)
+	return e
+}
+
+// Explain evaluates the policy on an annotation like Evaluate, and returns the
+// decision with the explanation of its effect: whether the clause matched or
+// which lattice comparison failed, which exception decided, and the overlaps
+// computed (see Explanation). The explanation is traced by the evaluation of
+// the effect, with the same options, so that the policies and exceptions in
+// monitor mode are left out of it like they're left out of the effect. It
+// returns an error when the annotation isn't valid (see ValidateAnnotation),
+// so that reports don't explain decisions on malformed annotations.
+func (p *Policy) Explain(an Annotation, opts ...EvalOption) (*Decision, error) {
+	if err := p.ValidateAnnotation(an); err != nil {
+		return nil, err
+	}
+	d := p.Evaluate(an, append(append([]EvalOption(nil), opts...), explaining)...)
+	return &d, nil
+}
+
+// explaining traces the effect of an evaluation into its explanation
+func explaining(ctx *evalContext) {
+	ctx.explain = true
+}
+
+// Decisive returns the explanation of the exception that decided the result
+// (recursively), or e itself when no exception did
+func (e *Explanation) Decisive() *Explanation {
+	for e.Decider >= 0 {
+		e = e.Excepts[e.Decider]
+	}
+	return e
+}
+
+// The methods below record the steps of apply, and are no-ops on a nil
+// Explanation. The ones returning a bool return the result of the step.
+
+func (e *Explanation) start(p *Policy, an Annotation) {
+	if e != nil {
+		*e = Explanation{Mode: p.Mode, Monitor: p.Monitor, Clause: p.Clause, Annotation: an, Decider: -1}
+	}
+}
+
+func (e *Explanation) unmatched(attr string, allowed bool) bool {
+	if e != nil {
+		e.Attribute = attr
+	}
+	return e.result(allowed)
+}
+
+// failed records the values of a lattice attribute that failed to match
+func (e *Explanation) failed(p *Policy, attr string, values []string) {
+	if e == nil {
+		return
+	}
+	l, clause := p.baseOn[attr], p.Clause.ValuesOf(attr)
+	if p.Mode {
+		for _, v := range values {
+			if !l.Allow(clause, []string{v}) {
+				e.Failed = append(e.Failed, v)
+			}
+		}
+		return
+	}
+	for _, v := range clause {
+		for _, o := range l.overlap([]string{v}, values) {
+			if l.isBottom(o) {
+				e.Failed = append(e.Failed, v)
+				break
+			}
+		}
+	}
+}
+
+func (e *Explanation) matched(overlap Annotation) {
+	if e != nil {
+		e.Matched, e.Overlap = true, overlap
+	}
+}
+
+func (e *Explanation) except() *Explanation {
+	if e == nil {
+		return nil
+	}
+	ex := new(Explanation)
+	e.Excepts = append(e.Excepts, ex)
+	return ex
+}
+
+func (e *Explanation) decided(i int, allowed bool) bool {
+	if e != nil {
+		e.Decider = i
+	}
+	return e.result(allowed)
+}
+
+func (e *Explanation) exhausted() bool {
+	if e != nil {
+		e.Exhausted = true
+	}
+	return e.result(false)
+}
+
+func (e *Explanation) result(allowed bool) bool {
+	if e != nil {
+		e.Allowed = allowed
+	}
+	return allowed
+}
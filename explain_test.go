@@ -0,0 +1,104 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	pstr := `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`
+	cases := []struct {
+		pstr      string
+		astr      string
+		allowed   bool
+		matched   bool
+		attribute string
+		decider   int
+	}{
+		{pstr, "DataType IPAddress", true, true, "", -1},
+		{pstr, "DataType IPAddress DataType AccountID", false, true, "", 0},
+		{"ALLOW DataType UniqueID", "DataType Location", false, false, "DataType", -1},
+		{"DENY DataType Location", "DataType AccountID", true, false, "DataType", -1},
+		{"DENY DataType UniqueID EXCEPT { ALLOW DataType AccountID }", "DataType AccountID", true, true, "", 0},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, c.pstr)
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		e := p.Trace(an)
+		if e.Allowed != p.ApplyOn(an) {
+			t.Errorf("Trace [%q] on [%q] disagrees with ApplyOn", c.pstr, c.astr)
+		}
+		if e.Allowed != c.allowed || e.Matched != c.matched || e.Attribute != c.attribute || e.Decider != c.decider {
+			t.Errorf("Trace [%q] on [%q] = %+v", c.pstr, c.astr, e)
+		}
+	}
+}
+
+func TestDecisive(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP
+		EXCEPT { DENY DataType UniqueID EXCEPT { ALLOW DataType IPAddress } }`)
+	an, err := p.ParseAnnotation("DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	e := p.Trace(an)
+	if d := e.Decisive(); d != e.Excepts[0] || d.Mode != DENY || len(d.Excepts) != 1 {
+		t.Errorf("Decisive() = %+v", d)
+	}
+	if d := e.Excepts[0].Overlap; len(d) != 1 || d[0].value != "AccountID" {
+		t.Errorf("Overlap = %v", d)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	cases := []struct {
+		pstr, astr string
+		allowed    bool
+		failed     []string
+	}{
+		{"ALLOW DataType UniqueID", "DataType Location DataType AccountID", false, []string{"Location"}},
+		{"DENY DataType Location DataType AccountID", "DataType IPAddress", true, []string{"AccountID"}},
+		{"ALLOW DataType TOP", "DataType Location", true, nil},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, c.pstr)
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		d, err := p.Explain(an)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if d.Allowed != c.allowed || d.Explanation == nil || !equals(d.Explanation.Failed, c.failed) {
+			t.Errorf("Explain(%s) on %s = %+v, want %v failing %v", c.astr, c.pstr, d, c.allowed, c.failed)
+		}
+	}
+
+	// the explanation is the trace of the effect, which leaves monitor mode out
+	for _, pstr := range []string{"DENY MODE=monitor DataType IPAddress", "ALLOW DataType TOP EXCEPT { DENY MODE=monitor DataType IPAddress }"} {
+		p := newScopedPolicy(t, pstr)
+		an, err := p.ParseAnnotation("DataType IPAddress")
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		d, err := p.Explain(an, WithBudget(Budget{Steps: 100}))
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if !d.Allowed || d.WouldBe != "DENY" || !d.Explanation.Allowed || d.Explanation.Exhausted {
+			t.Errorf("Explain() on %s = %+v, explanation %+v", pstr, d, d.Explanation)
+		}
+	}
+
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	var an Annotation
+	if err := an.UnmarshalJSON([]byte(`[["DataType","Unknown"]]`)); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if _, err := p.Explain(an); err == nil {
+		t.Errorf("Explain() of an invalid annotation should fail")
+	}
+}
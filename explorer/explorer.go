@@ -0,0 +1,243 @@
+// Package explorer serves a read-only policy explorer over HTTP, so that a
+// decision point doubles as a self-service debugging tool: browse the
+// lattices, read the policies, and paste an annotation to see the decision
+// and its explanation.
+//
+// The explorer is a small HTML page on top of JSON endpoints:
+//
+//	GET /                                  the page
+//	GET /api/lattices                      the lattices, their elements and edges
+//	GET /api/policies                      the policies, formatted and summarized
+//	GET /api/policies/{id}                 a policy
+//	GET /api/decide?policy={id}&annotation=DataType+IPAddress
+//	                                       the decision of a policy and its explanation
+//
+// Policies are identified by their IDs, or by their indexes in the set when
+// they have none. The handler can be mounted under a prefix:
+//
+//	http.Handle("/explorer/", http.StripPrefix("/explorer", explorer.New(lattices, set)))
+package explorer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// Explorer serves the explorer of a policy set
+type Explorer struct {
+	Lattices []*grok.Lattice
+	Set      *grok.PolicySet
+	// Renderer renders the explanations, a default Renderer when it's nil
+	Renderer *grok.Renderer
+	mux      *http.ServeMux
+}
+
+// New returns the explorer of the policy set, whose policies are based on the
+// lattices
+func New(ls []*grok.Lattice, s *grok.PolicySet) *Explorer {
+	e := &Explorer{Lattices: ls, Set: s, mux: http.NewServeMux()}
+	e.mux.HandleFunc("/", e.page)
+	e.mux.HandleFunc("/api/lattices", e.lattices)
+	e.mux.HandleFunc("/api/policies", e.policies)
+	e.mux.HandleFunc("/api/policies/", e.policy)
+	e.mux.HandleFunc("/api/decide", e.decide)
+	return e
+}
+
+// ServeHTTP serves the page and the endpoints, to GET requests only
+func (e *Explorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "explorer: the explorer is read-only")
+		return
+	}
+	e.mux.ServeHTTP(w, r)
+}
+
+// Lattice is a lattice of the /api/lattices endpoint
+type Lattice struct {
+	Name     string      `json:"name"`
+	Elements []string    `json:"elements"`
+	Edges    [][2]string `json:"edges"`
+}
+
+// Policy is a policy of the /api/policies endpoints
+type Policy struct {
+	ID string `json:"id"`
+	// Rule is the policy in the policy syntax, with an exception per line
+	Rule string `json:"rule"`
+	// Summary is the plain-language summary of the policy (see grok.Summarize)
+	Summary []string `json:"summary"`
+}
+
+// Decision is the response of the /api/decide endpoint
+type Decision struct {
+	Policy      string            `json:"policy"`
+	Annotation  string            `json:"annotation"`
+	Allowed     bool              `json:"allowed"`
+	Explanation string            `json:"explanation"`
+	Trace       *grok.Explanation `json:"trace"`
+}
+
+func (e *Explorer) lattices(w http.ResponseWriter, r *http.Request) {
+	ls := make([]Lattice, 0, len(e.Lattices))
+	for _, l := range e.Lattices {
+		lj := Lattice{Name: l.Name, Elements: l.Elements(), Edges: make([][2]string, 0, len(l.Edges))}
+		for _, ed := range l.Edges {
+			lj.Edges = append(lj.Edges, [2]string{ed.From, ed.To})
+		}
+		ls = append(ls, lj)
+	}
+	writeJSON(w, http.StatusOK, ls)
+}
+
+func (e *Explorer) policies(w http.ResponseWriter, r *http.Request) {
+	ps := make([]Policy, 0, len(e.Set.Policies))
+	for i, p := range e.Set.Policies {
+		ps = append(ps, policyOf(idOf(p, i), p))
+	}
+	writeJSON(w, http.StatusOK, ps)
+}
+
+func (e *Explorer) policy(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/policies/")
+	p := e.find(id)
+	if p == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("explorer: no policy %s", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, policyOf(id, p))
+}
+
+func (e *Explorer) decide(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id := q.Get("policy")
+	p := e.find(id)
+	if p == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("explorer: no policy %s", id))
+		return
+	}
+	an, err := p.ParseAnnotation(q.Get("annotation"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	trace := p.Trace(an)
+	rd := e.Renderer
+	if rd == nil {
+		rd = &grok.Renderer{}
+	}
+	text, err := rd.Render(trace)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, Decision{Policy: id, Annotation: an.String(), Allowed: trace.Allowed, Explanation: text, Trace: trace})
+}
+
+// find returns the policy of an ID, or of an index when no policy has the ID
+func (e *Explorer) find(id string) *grok.Policy {
+	if p := e.Set.Get(id); p != nil {
+		return p
+	}
+	ps := e.Set.Policies
+	if i, err := strconv.Atoi(id); err == nil && i >= 0 && i < len(ps) && ps[i].ID == "" {
+		return ps[i]
+	}
+	return nil
+}
+
+// idOf returns the ID of the i-th policy of the set
+func idOf(p *grok.Policy, i int) string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return strconv.Itoa(i)
+}
+
+func policyOf(id string, p *grok.Policy) Policy {
+	return Policy{ID: id, Rule: p.String(), Summary: grok.Summarize(p)}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func (e *Explorer) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("explorer: no page %s", r.URL.Path))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(page))
+}
+
+// page is the explorer page, which renders the JSON endpoints
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>grok policy explorer</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f4f4f4; padding: 0.5em; }
+.allowed { color: green; } .denied { color: darkred; }
+</style>
+</head>
+<body>
+<h1>grok policy explorer</h1>
+<h2>Decide</h2>
+<form id="decide">
+<select id="policy"></select>
+<input id="annotation" size="60" placeholder="DataType IPAddress Purpose Analytics">
+<button>Decide</button>
+</form>
+<p id="decision"></p>
+<h2>Policies</h2>
+<div id="policies"></div>
+<h2>Lattices</h2>
+<div id="lattices"></div>
+<script>
+function api(path) { return fetch("api/" + path).then(function (r) { return r.json(); }); }
+function text(tag, s, cls) { var e = document.createElement(tag); e.textContent = s; if (cls) e.className = cls; return e; }
+api("policies").then(function (ps) {
+  ps.forEach(function (p) {
+    var o = text("option", p.id); o.value = p.id; document.getElementById("policy").appendChild(o);
+    var d = document.getElementById("policies");
+    d.appendChild(text("h3", p.id));
+    d.appendChild(text("pre", p.rule));
+    d.appendChild(text("pre", (p.summary || []).join("\n")));
+  });
+});
+api("lattices").then(function (ls) {
+  ls.forEach(function (l) {
+    var d = document.getElementById("lattices");
+    d.appendChild(text("h3", l.name));
+    d.appendChild(text("pre", l.edges.map(function (e) { return e[0] + " > " + e[1]; }).join("\n")));
+  });
+});
+document.getElementById("decide").addEventListener("submit", function (ev) {
+  ev.preventDefault();
+  var q = "policy=" + encodeURIComponent(document.getElementById("policy").value) +
+    "&annotation=" + encodeURIComponent(document.getElementById("annotation").value);
+  api("decide?" + q).then(function (d) {
+    var p = document.getElementById("decision");
+    p.textContent = d.error ? d.error : (d.allowed ? "ALLOW: " : "DENY: ") + d.explanation;
+    p.className = d.error ? "" : (d.allowed ? "allowed" : "denied");
+  });
+});
+</script>
+</body>
+</html>
+`
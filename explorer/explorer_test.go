@@ -0,0 +1,80 @@
+package explorer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func newExplorer(t *testing.T) *Explorer {
+	ls := grok.NewLattices(`[
+		{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }
+	]`)
+	p := grok.NewPolicy(ls)
+	p.ID = "no-joins"
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID DENY MODE=monitor DataType Location }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	q := grok.NewPolicy(ls)
+	if err := q.ParsePolicy("DENY DataType AccountID"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return New(ls, grok.NewPolicySet(p, q))
+}
+
+func get(t *testing.T, e *Explorer, method, target string, v interface{}) int {
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %q", method, target, err)
+		}
+	}
+	return w.Code
+}
+
+func TestExplorer(t *testing.T) {
+	e := newExplorer(t)
+
+	var ls []Lattice
+	if get(t, e, http.MethodGet, "/api/lattices", &ls); len(ls) != 1 || ls[0].Name != "DataType" || len(ls[0].Elements) != 6 {
+		t.Errorf("lattices = %+v", ls)
+	}
+
+	var ps []Policy
+	get(t, e, http.MethodGet, "/api/policies", &ps)
+	rule := "ALLOW DataType TOP EXCEPT {\n  DENY DataType IPAddress DataType AccountID\n  DENY MODE=monitor DataType Location\n}"
+	if len(ps) != 2 || ps[0].ID != "no-joins" || ps[0].Rule != rule || ps[1].ID != "1" || ps[1].Rule != "DENY DataType AccountID" {
+		t.Errorf("policies = %+v", ps)
+	}
+	var p Policy
+	if code := get(t, e, http.MethodGet, "/api/policies/1", &p); code != http.StatusOK || len(p.Summary) == 0 {
+		t.Errorf("policy 1 = %d %+v", code, p)
+	}
+
+	var d Decision
+	get(t, e, http.MethodGet, "/api/decide?policy=no-joins&annotation="+url.QueryEscape("DataType IPAddress DataType AccountID"), &d)
+	if d.Allowed || !strings.HasPrefix(d.Explanation, "Denied because") || d.Trace == nil || d.Trace.Decider != 0 {
+		t.Errorf("decide = %+v", d)
+	}
+
+	for _, c := range []struct {
+		method, target string
+		code           int
+	}{
+		{http.MethodGet, "/", http.StatusOK},
+		{http.MethodGet, "/nowhere", http.StatusNotFound},
+		{http.MethodGet, "/api/policies/2", http.StatusNotFound},
+		{http.MethodGet, "/api/decide?policy=no-joins&annotation=DataType+Nowhere", http.StatusBadRequest},
+		{http.MethodPost, "/api/decide", http.StatusMethodNotAllowed},
+	} {
+		if code := get(t, e, c.method, c.target, nil); code != c.code {
+			t.Errorf("%s %s = %d, want %d", c.method, c.target, code, c.code)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// String returns the policy in the policy syntax, with its exceptions
+// indented on their own lines, e.g.
+//
+//	ALLOW DataType TOP EXCEPT {
+//	  DENY DataType IPAddress DataType AccountID
+//	}
+//
+// The enforcement mode is only written for policies in monitor mode.
+func (p *Policy) String() string {
+	var b strings.Builder
+	p.format(&b, 0)
+	return b.String()
+}
+
+// format writes the policy, whose exceptions are nested depth levels deep
+func (p *Policy) format(b *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	mode := Deny
+	if p.Mode {
+		mode = Allow
+	}
+	b.WriteString(indent + mode)
+	if p.Monitor {
+		b.WriteString(" " + ModeOption + "=" + Monitor)
+	}
+	if len(p.Clause) > 0 {
+		b.WriteString(" " + p.Clause.String())
+	}
+	if len(p.Excepts) == 0 {
+		return
+	}
+	b.WriteString(" " + Except + " {\n")
+	for i := range p.Excepts {
+		p.Excepts[i].format(b, depth+1)
+		b.WriteString("\n")
+	}
+	b.WriteString(indent + "}")
+}
+
+// Marshal returns the policy in the policy syntax (see String), after
+// checking that it parses back to the same policy, so that policies built
+// programmatically are persisted safely. It fails for the policies that the
+// syntax can't express, e.g. exceptions of the same mode as their policy,
+// values that the lattices don't define, or values that expire (see Until).
+func (p *Policy) Marshal() ([]byte, error) {
+	if err := p.checkMarshal(); err != nil {
+		return nil, err
+	}
+	text := p.String()
+	q := &Policy{baseOn: p.baseOn, numerics: p.numerics, compats: p.compats, MaxExceptDepth: p.MaxExceptDepth}
+	if err := q.ParsePolicy(text); err != nil {
+		return nil, errors.New(fmt.Sprintf("policy: the text doesn't parse back: %s", err))
+	}
+	if back := q.String(); back != text {
+		return nil, errors.New(fmt.Sprintf("policy: the text parses back as %q", back))
+	}
+	return []byte(text), nil
+}
+
+// checkMarshal returns an error when the policy or its exceptions have
+// values that expire
+func (p *Policy) checkMarshal() error {
+	for _, pa := range p.Clause {
+		if !pa.expires.IsZero() {
+			return errors.New(fmt.Sprintf("policy: %s %s expires, which the policy syntax can't express", pa.name, pa.value))
+		}
+	}
+	for i := range p.Excepts {
+		if err := p.Excepts[i].checkMarshal(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
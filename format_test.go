@@ -0,0 +1,62 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyString(t *testing.T) {
+	policies := []struct {
+		pstr, want string
+	}{
+		{"ALLOW DataType TOP", "ALLOW DataType TOP"},
+		{"DENY MODE=enforce DataType AccountID", "DENY DataType AccountID"},
+		{"ALLOW DataType TOP EXCEPT { DENY MODE=monitor DataType IPAddress DataType AccountID DENY DataType Location }",
+			"ALLOW DataType TOP EXCEPT {\n  DENY MODE=monitor DataType IPAddress DataType AccountID\n  DENY DataType Location\n}"},
+		{"ALLOW DataType TOP EXCEPT { DENY DataType UniqueID EXCEPT { ALLOW DataType IPAddress } }",
+			"ALLOW DataType TOP EXCEPT {\n  DENY DataType UniqueID EXCEPT {\n    ALLOW DataType IPAddress\n  }\n}"},
+	}
+	for _, c := range policies {
+		p := newScopedPolicy(t, c.pstr)
+		if got := p.String(); got != c.want {
+			t.Errorf("String() of %s = %q, want %q", c.pstr, got, c.want)
+		}
+		b, err := p.Marshal()
+		if err != nil || string(b) != c.want {
+			t.Errorf("Marshal() of %s = %q, %v", c.pstr, b, err)
+		}
+		q := newScopedPolicy(t, "ALLOW DataType TOP")
+		if err := q.ParsePolicy(string(b)); err != nil || q.String() != p.String() {
+			t.Errorf("the text of %s parses as %q, %v", c.pstr, q.String(), err)
+		}
+	}
+}
+
+func TestPolicyMarshal(t *testing.T) {
+	// a policy built programmatically
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	deny, err := p.ParseClause("DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	p.Excepts = []Policy{{Mode: false, Clause: deny}}
+	if b, err := p.Marshal(); err != nil || string(b) != "ALLOW DataType TOP EXCEPT {\n  DENY DataType AccountID\n}" {
+		t.Errorf("Marshal() = %q, %v", b, err)
+	}
+
+	errs := []struct {
+		excepts []Policy
+		err     string
+	}{
+		{[]Policy{{Mode: true, Clause: deny}}, "policy: the text doesn't parse back: policy: except clause doesn't have the opposite mode"},
+		{[]Policy{{Clause: Clause{{name: "DataType", value: "Birthday"}}}}, "policy: the text doesn't parse back:"},
+		{[]Policy{{Clause: Clause(Annotation(deny).Until("DataType", "AccountID", time.Now()))}}, "policy: DataType AccountID expires"},
+	}
+	for _, c := range errs {
+		p.Excepts = c.excepts
+		if _, err := p.Marshal(); err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("Marshal() of %v = %v, want %s", c.excepts, err, c.err)
+		}
+	}
+}
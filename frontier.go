@@ -0,0 +1,121 @@
+package grok
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxFrontierDistance is the maximum number of values that Distance adds to
+// an annotation
+const MaxFrontierDistance = 2
+
+// FrontierStep is an addition of values that gets an allowed annotation
+// denied
+type FrontierStep struct {
+	Add Annotation
+	// Exception is the path of the exception that denies the annotation with
+	// the addition, e.g. 2 for the second exception or 2.1 for the first
+	// exception of the second one, and is empty when the policy itself does
+	Exception string
+	// Mode is the mode of the policy
+	Mode bool
+}
+
+// String returns the step in plain words, e.g. "adding DataType AccountID
+// would trigger exception 2"
+func (s FrontierStep) String() string {
+	add := "adding " + s.Add.String()
+	switch {
+	case s.Exception != "":
+		return add + " would trigger exception " + s.Exception
+	case s.Mode:
+		return add + " would leave the scope of the policy"
+	default:
+		return add + " would match the policy"
+	}
+}
+
+// Frontier describes how far an annotation is from being denied by a policy
+type Frontier struct {
+	Allowed bool
+	// Distance is the least number of values whose addition gets the
+	// annotation denied: 0 when it's denied, and -1 when no addition of at
+	// most MaxFrontierDistance values does
+	Distance int
+	// Steps are the additions of Distance values that get the annotation
+	// denied
+	Steps []FrontierStep
+}
+
+// Distance returns how far an annotation is from being denied by the policy,
+// so that data tools can warn before a violation occurs. The added values are
+// the elements of the lattices of the policy, except TOP and BOTTOM, that the
+// annotation doesn't have yet.
+func (p *Policy) Distance(an Annotation) Frontier {
+	f := Frontier{Allowed: p.ApplyOn(an), Steps: make([]FrontierStep, 0)}
+	if !f.Allowed {
+		return f
+	}
+	candidates := make([]pair, 0)
+	for _, name := range p.latticeNames() {
+		values := an.ValuesOf(name)
+		for _, e := range p.baseOn[name].Elements() {
+			if e != Top && e != Bottom && !contains(values, e) {
+				candidates = append(candidates, pair{name: name, value: e})
+			}
+		}
+	}
+
+	// the additions of d values, as indexes of candidates in increasing order
+	var add func(d, from int, added Annotation)
+	add = func(d, from int, added Annotation) {
+		if d == 0 {
+			e := p.Trace(append(append(make(Annotation, 0, len(an)+len(added)), an...), added...))
+			if !e.Allowed {
+				step := FrontierStep{Add: append(Annotation(nil), added...), Mode: p.Mode}
+				step.Exception = decisivePath(e)
+				f.Steps = append(f.Steps, step)
+			}
+			return
+		}
+		for i := from; i < len(candidates); i++ {
+			add(d-1, i+1, append(added, candidates[i]))
+		}
+	}
+	for d := 1; d <= MaxFrontierDistance; d++ {
+		add(d, 0, make(Annotation, 0, d))
+		if len(f.Steps) > 0 {
+			f.Distance = d
+			return f
+		}
+	}
+	f.Distance = -1
+	return f
+}
+
+// decisivePath returns the path of the exception that decided an explanation,
+// e.g. 2.1, and is empty when no exception did
+func decisivePath(e *Explanation) string {
+	path := make([]string, 0)
+	for e.Decider >= 0 {
+		path = append(path, strconv.Itoa(e.Decider+1))
+		e = e.Excepts[e.Decider]
+	}
+	return strings.Join(path, ".")
+}
+
+// String returns the frontier in plain words
+func (f Frontier) String() string {
+	switch {
+	case !f.Allowed:
+		return "denied"
+	case f.Distance < 0:
+		return fmt.Sprintf("allowed, and no addition of at most %d values gets it denied", MaxFrontierDistance)
+	}
+	steps := make([]string, 0, len(f.Steps))
+	for _, s := range f.Steps {
+		steps = append(steps, s.String())
+	}
+	return fmt.Sprintf("allowed, %d away from denied: %s", f.Distance, strings.Join(steps, "; "))
+}
@@ -0,0 +1,49 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	pexcept := "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"
+	cases := []struct {
+		pstr, astr string
+		frontier   string
+	}{
+		{pexcept, "DataType IPAddress",
+			"allowed, 1 away from denied: adding DataType AccountID would trigger exception 1; adding DataType UniqueID would trigger exception 1"},
+		{pexcept, "DataType IPAddress DataType AccountID", "denied"},
+		{"ALLOW DataType Location", "DataType IPAddress",
+			"allowed, 1 away from denied: adding DataType AccountID would leave the scope of the policy; adding DataType UniqueID would leave the scope of the policy"},
+		{"DENY DataType IPAddress DataType AccountID", "DataType IPAddress",
+			"allowed, 1 away from denied: adding DataType AccountID would match the policy; adding DataType UniqueID would match the policy"},
+		{"ALLOW DataType TOP EXCEPT { DENY DataType UniqueID EXCEPT { ALLOW DataType IPAddress } }", "DataType IPAddress",
+			"allowed, 1 away from denied: adding DataType AccountID would trigger exception 1; adding DataType UniqueID would trigger exception 1"},
+		{"ALLOW DataType TOP", "DataType IPAddress", "allowed, and no addition of at most 2 values gets it denied"},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, c.pstr)
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := p.Distance(an).String(); got != c.frontier {
+			t.Errorf("Distance [%q] of [%q] = %q, want %q", c.pstr, c.astr, got, c.frontier)
+		}
+	}
+}
+
+func TestDistanceOfTwo(t *testing.T) {
+	p := NewPolicy([]*Lattice{NewLattice(`{ "name": "Source", "edges": { "Clicks": [], "Orders": [], "Users": [] } }`)})
+	if err := p.ParsePolicy("DENY Source Orders Source Users"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	an, err := p.ParseAnnotation("Source Clicks")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	f := p.Distance(an)
+	if f.Distance != 2 || len(f.Steps) != 1 || f.Steps[0].String() != "adding Source Orders Source Users would match the policy" {
+		t.Errorf("Distance() = %s", f)
+	}
+}
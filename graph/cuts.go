@@ -0,0 +1,205 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// MaxCutSize is the maximum number of edges of the cuts that SuggestCuts suggests
+const MaxCutSize = 3
+
+// Cut is an edge of a cut: a flow that is removed, or whose data is brought
+// into a state of the state lattices (a typestate upgrade, e.g. hashing)
+type Cut struct {
+	Flow
+	// Transform is the state the data of the flow is brought into, or empty
+	// when the flow is removed
+	Transform string
+}
+
+// String returns the cut, e.g. "raw.clicks -> daily.joined: Hashed"
+func (c Cut) String() string {
+	s := c.From + " -> " + c.To
+	if c.Transform == "" {
+		return s + ": removed"
+	}
+	return s + ": " + c.Transform
+}
+
+// EdgeSet is a set of cuts that together resolve a violation
+type EdgeSet []Cut
+
+func (s EdgeSet) String() string {
+	cs := make([]string, 0, len(s))
+	for _, c := range s {
+		cs = append(cs, c.String())
+	}
+	return strings.Join(cs, "; ")
+}
+
+// SuggestCuts returns the minimal sets of at most MaxCutSize flows whose
+// removal, or whose data brought into a state, resolves a violation of the
+// graph, to guide its remediation. They are sorted by size and by flow, the
+// removal of a flow before its transforms, the weakest ones first.
+//
+// The data of a node is its own data and the data flowing into it: the
+// values of its annotation that a node flowing into it carries are taken to
+// flow from there, and the other values are its own. A violation whose own
+// data is denied has no cut, and neither has a node that isn't a violation.
+// A node left without data is resolved.
+func SuggestCuts(p *grok.Policy, g *DataFlowGraph, v Violation) []EdgeSet {
+	r := newReach(p, g, v.Node)
+	if r == nil || r.resolved(nil) || len(r.own[v.Node]) > 0 && !p.ApplyOn(r.own[v.Node]) {
+		return []EdgeSet{}
+	}
+	// options are the cuts of the flows into the node, a removal and the
+	// transforms of the data of every flow
+	whole := r.reached(nil)
+	options := make([][]Cut, 0, len(r.flows))
+	for _, f := range r.flows {
+		cs := []Cut{{Flow: f}}
+		for _, t := range p.Transforms(whole[f.From]) {
+			cs = append(cs, Cut{f, t})
+		}
+		options = append(options, cs)
+	}
+
+	res := make([]EdgeSet, 0)
+	// minimal returns true when no cut found has a subset of the flows of s
+	minimal := func(s EdgeSet) bool {
+		for _, found := range res {
+			if len(found) >= len(s) {
+				continue
+			}
+			subset := true
+			for _, c := range found {
+				in := false
+				for _, d := range s {
+					in = in || c.Flow == d.Flow
+				}
+				subset = subset && in
+			}
+			if subset {
+				return false
+			}
+		}
+		return true
+	}
+	var try func(d, from int, s EdgeSet)
+	try = func(d, from int, s EdgeSet) {
+		if d == 0 {
+			if minimal(s) && r.resolved(s) {
+				res = append(res, append(EdgeSet(nil), s...))
+			}
+			return
+		}
+		for i := from; i < len(options); i++ {
+			for _, c := range options[i] {
+				try(d-1, i+1, append(s, c))
+			}
+		}
+	}
+	for d := 1; d <= MaxCutSize && d <= len(options); d++ {
+		try(d, 0, make(EdgeSet, 0, d))
+	}
+	return res
+}
+
+// reach is the subgraph of the nodes flowing into a node
+type reach struct {
+	p    *grok.Policy
+	node string
+	// nodes are the node and the nodes flowing into it, sorted
+	nodes []string
+	// flows are the flows between them, sorted
+	flows []Flow
+	// own are the values of the nodes that don't flow from other nodes
+	own map[string]grok.Annotation
+}
+
+func newReach(p *grok.Policy, g *DataFlowGraph, node string) *reach {
+	if g.Nodes[node] == nil {
+		return nil
+	}
+	in := make(map[string][]Flow)
+	for _, f := range g.Flows {
+		in[f.To] = append(in[f.To], f)
+	}
+	r := &reach{p: p, node: node, own: make(map[string]grok.Annotation)}
+	seen := map[string]bool{node: true}
+	queue := []string{node}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		r.nodes = append(r.nodes, n)
+		for _, f := range in[n] {
+			r.flows = append(r.flows, f)
+			if !seen[f.From] {
+				seen[f.From] = true
+				queue = append(queue, f.From)
+			}
+		}
+	}
+	sort.Strings(r.nodes)
+	sort.Slice(r.flows, func(i, j int) bool {
+		if r.flows[i].From != r.flows[j].From {
+			return r.flows[i].From < r.flows[j].From
+		}
+		return r.flows[i].To < r.flows[j].To
+	})
+	for _, n := range r.nodes {
+		own := make(grok.Annotation, 0)
+		for _, pa := range g.Nodes[n].Annotation {
+			carried := false
+			for _, f := range in[n] {
+				for _, qa := range g.Nodes[f.From].Annotation {
+					carried = carried || qa == pa
+				}
+			}
+			if !carried {
+				own = append(own, pa)
+			}
+		}
+		r.own[n] = own
+	}
+	return r
+}
+
+// reached returns the data of the nodes once the flows are cut
+func (r *reach) reached(s EdgeSet) map[string]grok.Annotation {
+	data := make(map[string]grok.Annotation)
+	for _, n := range r.nodes {
+		data[n] = append(grok.Annotation{}, r.own[n]...)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, f := range r.flows {
+			t, removed := "", false
+			for _, c := range s {
+				if c.Flow == f {
+					t, removed = c.Transform, c.Transform == ""
+				}
+			}
+			if removed {
+				continue
+			}
+			carried := data[f.From]
+			if t != "" {
+				carried = r.p.Mask(carried, t)
+			}
+			if an := data[f.To].Union(carried); len(an) > len(data[f.To]) {
+				data[f.To], changed = an, true
+			}
+		}
+	}
+	return data
+}
+
+// resolved returns true when the data of the node is allowed once the flows
+// are cut, or when no data is left
+func (r *reach) resolved(s EdgeSet) bool {
+	an := r.reached(s)[r.node]
+	return len(an) == 0 || r.p.ApplyOn(an)
+}
@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func TestSuggestCuts(t *testing.T) {
+	dt := grok.NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	dt.Product(grok.NewLattice(`{ "name": "TypeState", "edges": { "Encrypted": [], "Hashed": [], "Truncated": ["Redacted"] } }`))
+	p := grok.NewPolicy([]*grok.Lattice{dt})
+	err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID EXCEPT { ALLOW DataType AccountID:Encrypted DataType IPAddress } }")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	g, err := LoadGraph(strings.NewReader(`{
+		"nodes": [
+			{"id": "clicks", "annotation": "DataType IPAddress"},
+			{"id": "accounts", "annotation": "DataType AccountID"},
+			{"id": "joined", "annotation": "DataType IPAddress DataType AccountID"},
+			{"id": "report", "annotation": "DataType IPAddress DataType AccountID"},
+			{"id": "leaked", "annotation": "DataType IPAddress DataType AccountID"}
+		],
+		"flows": [
+			{"from": "clicks", "to": "joined"},
+			{"from": "accounts", "to": "joined"},
+			{"from": "joined", "to": "report"},
+			{"from": "clicks", "to": "leaked"}
+		]
+	}`), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	vs := CheckGraph(p, g)
+	if len(vs) != 3 {
+		t.Fatalf("CheckGraph() = %v", vs)
+	}
+	cases := []struct {
+		node string
+		want []string
+	}{
+		{"joined", []string{
+			"accounts -> joined: removed",
+			"accounts -> joined: Encrypted",
+			"clicks -> joined: removed",
+		}},
+		{"report", []string{
+			"accounts -> joined: removed",
+			"accounts -> joined: Encrypted",
+			"clicks -> joined: removed",
+			"joined -> report: removed",
+			"joined -> report: Encrypted",
+		}},
+		// the AccountID of leaked is its own
+		{"leaked", []string{"clicks -> leaked: removed"}},
+	}
+	for _, c := range cases {
+		var v Violation
+		for _, v = range vs {
+			if v.Node == c.node {
+				break
+			}
+		}
+		got := make([]string, 0)
+		for _, s := range SuggestCuts(p, g, v) {
+			got = append(got, s.String())
+		}
+		if !equals(got, c.want) {
+			t.Errorf("SuggestCuts(%s) = %q, want %q", c.node, got, c.want)
+		}
+	}
+
+	// the own data of a node can't be cut
+	an, _ := p.ParseAnnotation("DataType IPAddress DataType AccountID")
+	g.AddNode("source", an)
+	if got := SuggestCuts(p, g, Violation{"source", an}); len(got) != 0 {
+		t.Errorf("SuggestCuts(source) = %v", got)
+	}
+}
@@ -0,0 +1,345 @@
+// Package graph checks whole pipelines against a policy: data-flow graphs
+// whose nodes, e.g. program blocks and datasets, are labeled by annotations,
+// and whose flows carry the data of the nodes to others.
+//
+//	g, err := graph.LoadGraph(r, policy)
+//	if err != nil { ... }
+//	for _, v := range graph.CheckGraph(policy, g) { ... }
+//
+// Graphs are built from lineage files, OpenLineage events or other sources
+// (see package ingest), checked incrementally (see IncrementalChecker) and
+// persisted with their results (see GraphLog).
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+// Node is a program block or a dataset of a data-flow graph, labeled by an annotation
+type Node struct {
+	ID         string
+	Annotation grok.Annotation
+}
+
+// Flow is a data flow from a node to another
+type Flow struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DataFlowGraph is a graph of nodes connected by data flows, e.g. the lineage
+// of a pipeline
+type DataFlowGraph struct {
+	// Nodes are the nodes by canonical ID
+	Nodes map[string]*Node
+	Flows []Flow
+	// Scheme canonicalizes the IDs of the nodes added to the graph, if any.
+	// It should be set before nodes are added.
+	Scheme IDScheme
+	// Active and FlowsActive are the intervals during which the nodes and
+	// the flows are active, if they have any (see SetActive)
+	Active      map[string]Interval
+	FlowsActive map[Flow]Interval
+	// FlowKinds are the kinds of the flows that have one (see SetFlowKind),
+	// which select how annotations propagate along them
+	FlowKinds map[Flow]string
+	// targets are the targets of the flows by source, which AddFlow indexes
+	// lazily since graphs may be built with their Flows
+	targets map[string]map[string]bool
+	indexed int
+}
+
+// NewDataFlowGraph returns an empty graph
+func NewDataFlowGraph() *DataFlowGraph {
+	return &DataFlowGraph{Nodes: make(map[string]*Node), Flows: make([]Flow, 0)}
+}
+
+// AddNode adds a node to the graph, or replaces the annotation of an existing node
+func (g *DataFlowGraph) AddNode(id string, an grok.Annotation) *Node {
+	id = g.Canonical(id)
+	if n, ok := g.Nodes[id]; ok {
+		n.Annotation = an
+		return n
+	}
+	n := &Node{id, an}
+	g.Nodes[id] = n
+	return n
+}
+
+// AddFlow adds a flow to the graph, and the unlabeled nodes it connects if missing
+func (g *DataFlowGraph) AddFlow(from, to string) {
+	from, to = g.Canonical(from), g.Canonical(to)
+	for _, id := range []string{from, to} {
+		if _, ok := g.Nodes[id]; !ok {
+			g.AddNode(id, grok.Annotation{})
+		}
+	}
+	g.indexFlows()
+	if g.targets[from][to] {
+		return
+	}
+	if g.targets[from] == nil {
+		g.targets[from] = make(map[string]bool)
+	}
+	g.targets[from][to] = true
+	g.Flows = append(g.Flows, Flow{from, to})
+	g.indexed++
+}
+
+// indexFlows indexes the flows appended to Flows since the last index, and
+// re-indexes them all when Flows was replaced
+func (g *DataFlowGraph) indexFlows() {
+	if g.targets == nil || g.indexed > len(g.Flows) {
+		g.targets, g.indexed = make(map[string]map[string]bool), 0
+	}
+	for _, f := range g.Flows[g.indexed:] {
+		if g.targets[f.From] == nil {
+			g.targets[f.From] = make(map[string]bool)
+		}
+		g.targets[f.From][f.To] = true
+	}
+	g.indexed = len(g.Flows)
+}
+
+// NodeIDs returns the sorted IDs of the nodes
+func (g *DataFlowGraph) NodeIDs() []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Violation is a node whose annotation is denied by a policy
+type Violation struct {
+	Node       string
+	Annotation grok.Annotation
+}
+
+// CheckGraph applies the policy on every node of the graph, and returns the
+// violating nodes sorted by ID. The values of the annotations expired by now
+// are dropped, like IncrementalChecker does.
+func CheckGraph(p *grok.Policy, g *DataFlowGraph) []Violation {
+	return checkAt(p, g, time.Now())
+}
+
+// checkAt is CheckGraph as of a time
+func checkAt(p *grok.Policy, g *DataFlowGraph, t time.Time) []Violation {
+	vs := make([]Violation, 0)
+	for _, id := range g.NodeIDs() {
+		n := g.Nodes[id]
+		if !allowedAt(p, n.Annotation, t) {
+			vs = append(vs, Violation{id, n.Annotation})
+		}
+	}
+	return vs
+}
+
+// allowedAt applies the policy on an annotation without the values expired
+// by a time, which is how the checks of graphs treat expiries
+func allowedAt(p *grok.Policy, an grok.Annotation, t time.Time) bool {
+	return p.ApplyOn(an.At(t))
+}
+
+// Emitted returns the violations of a graph check that the limiter emits, a
+// violation being identified by its node and annotation
+func Emitted(l *grok.EmissionLimiter, vs []Violation) []Violation {
+	res := make([]Violation, 0, len(vs))
+	for _, v := range vs {
+		if l.Allow(grok.Fingerprint(v.Node, v.Annotation.String())) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// FlowViolation is a flow that brings together data that a policy denies
+// together, while it allows the data of either end of the flow
+type FlowViolation struct {
+	Flow
+	// Annotation is the annotation of the source of the flow followed by the
+	// annotation of its target
+	Annotation grok.Annotation
+}
+
+// CheckFlows applies the policy on the data of every flow of the graph, i.e.
+// on the annotations of its source and target together, and returns the
+// violating flows whose ends aren't violations themselves (see CheckGraph),
+// e.g. a flow of IP addresses into a dataset of account IDs that doesn't
+// declare them. The flows are sorted by source and target, and expired
+// values are dropped like CheckGraph does.
+func CheckFlows(p *grok.Policy, g *DataFlowGraph) []FlowViolation {
+	t := time.Now()
+	vs := make([]FlowViolation, 0)
+	for _, f := range g.Flows {
+		from, to := g.Nodes[f.From], g.Nodes[f.To]
+		if from == nil || to == nil || !allowedAt(p, from.Annotation, t) || !allowedAt(p, to.Annotation, t) {
+			continue
+		}
+		an := append(append(make(grok.Annotation, 0, len(from.Annotation)+len(to.Annotation)), from.Annotation...), to.Annotation...)
+		if !allowedAt(p, an, t) {
+			vs = append(vs, FlowViolation{f, an})
+		}
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		if vs[i].From != vs[j].From {
+			return vs[i].From < vs[j].From
+		}
+		return vs[i].To < vs[j].To
+	})
+	return vs
+}
+
+// LoadGraph reads a lineage JSON file, where annotations are in the policy
+// syntax and validated against the lattices of the policy:
+//
+//	{
+//	 "nodes": [
+//	   {"id": "raw.clicks", "annotation": "DataType IPAddress"},
+//	   {"id": "raw.accounts", "annotation": "DataType AccountID"}
+//	 ],
+//	 "flows": [
+//	   {"from": "raw.clicks", "to": "daily.joined"},
+//	   {"from": "raw.accounts", "to": "daily.joined",
+//	    "active": {"from": "2023-01-01T00:00:00Z", "to": "2024-01-01T00:00:00Z"}},
+//	   {"from": "daily.joined", "to": "daily.counts", "kind": "aggregate"}
+//	 ]
+//	}
+//
+// where nodes and flows may be active during an interval only, whose times
+// are in RFC 3339, and flows may have a kind (see Propagation).
+func LoadGraph(r io.Reader, p *grok.Policy) (*DataFlowGraph, error) {
+	var def struct {
+		Nodes []struct {
+			ID         string    `json:"id"`
+			Annotation string    `json:"annotation"`
+			Active     *Interval `json:"active"`
+		} `json:"nodes"`
+		Flows []struct {
+			From   string    `json:"from"`
+			To     string    `json:"to"`
+			Active *Interval `json:"active"`
+			Kind   string    `json:"kind"`
+		} `json:"flows"`
+	}
+	if err := json.NewDecoder(r).Decode(&def); err != nil {
+		return nil, err
+	}
+	g := NewDataFlowGraph()
+	for _, n := range def.Nodes {
+		if n.ID == "" {
+			return nil, errors.New("graph: node id should not be empty")
+		}
+		an, err := p.ParseAnnotation(n.Annotation)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("graph: node %s: %s", n.ID, err))
+		}
+		g.AddNode(n.ID, an)
+		if n.Active != nil {
+			g.SetActive(n.ID, *n.Active)
+		}
+	}
+	for _, f := range def.Flows {
+		if f.From == "" || f.To == "" {
+			return nil, errors.New("graph: flow should have both ends")
+		}
+		g.AddFlow(f.From, f.To)
+		if f.Active != nil {
+			g.SetFlowActive(f.From, f.To, *f.Active)
+		}
+		if f.Kind != "" {
+			g.SetFlowKind(f.From, f.To, f.Kind)
+		}
+	}
+	return g, nil
+}
+
+// IncrementalChecker checks graphs repeatedly, re-applying the policy only on
+// the nodes whose annotation changed since the previous check, or whose
+// values expired since. The values of the annotations expired as of the
+// checker's clock are dropped (see grok.Annotation.Until).
+type IncrementalChecker struct {
+	Policy *grok.Policy
+	// Now is the clock of the checks, time.Now if nil
+	Now func() time.Time
+	// results are the previous results by node, keyed by the annotation text
+	results map[string]checkResult
+}
+
+type checkResult struct {
+	// annotation is the text of the annotation with the expiry of its values
+	annotation string
+	allowed    bool
+	// until is the time the next value of the annotation expires at, when
+	// the result must be re-checked, if any
+	until time.Time
+}
+
+// NewIncrementalChecker returns an IncrementalChecker of a policy
+func NewIncrementalChecker(p *grok.Policy) *IncrementalChecker {
+	return &IncrementalChecker{Policy: p, results: make(map[string]checkResult)}
+}
+
+// Check returns the violating nodes of the graph like CheckGraph, and the
+// number of nodes that were re-checked
+func (c *IncrementalChecker) Check(g *DataFlowGraph) ([]Violation, int) {
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	t := now()
+	vs := make([]Violation, 0)
+	rechecked := 0
+	results := make(map[string]checkResult)
+	for _, id := range g.NodeIDs() {
+		n := g.Nodes[id]
+		key := checkKey(n.Annotation)
+		r, ok := c.results[id]
+		if !ok || r.annotation != key || !r.until.IsZero() && !t.Before(r.until) {
+			r = checkResult{key, allowedAt(c.Policy, n.Annotation, t), nextExpiry(n.Annotation, t)}
+			rechecked++
+		}
+		results[id] = r
+		if !r.allowed {
+			vs = append(vs, Violation{id, n.Annotation})
+		}
+	}
+	c.results = results
+	return vs, rechecked
+}
+
+// checkKey returns the text of an annotation with the expiry of its values,
+// which the results of the checker are keyed by
+func checkKey(an grok.Annotation) string {
+	key := an.String()
+	for _, name := range an.Names() {
+		for _, v := range an.ValuesOf(name) {
+			if t, ok := an.Expiry(name, v); ok {
+				key += fmt.Sprintf(" %s %s until %s", name, v, t.Format(time.RFC3339Nano))
+			}
+		}
+	}
+	return key
+}
+
+// nextExpiry returns the earliest time after t a value of the annotation
+// expires at, if any
+func nextExpiry(an grok.Annotation, t time.Time) time.Time {
+	var next time.Time
+	for _, name := range an.Names() {
+		for _, v := range an.ValuesOf(name) {
+			if e, ok := an.Expiry(name, v); ok && e.After(t) && (next.IsZero() || e.Before(next)) {
+				next = e
+			}
+		}
+	}
+	return next
+}
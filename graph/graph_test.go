@@ -0,0 +1,231 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+func newScopedPolicy(t *testing.T, pstr string) *grok.Policy {
+	p := grok.NewPolicy(grok.NewLattices(`[{ "name": "DataType",
+		"edges": {
+			"UniqueID": ["AccountID", "IPAddress"],
+			"Location": ["IPAddress"] }
+		}]`))
+	if err := p.ParsePolicy(pstr); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return p
+}
+
+func equals(a, b []string) bool {
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
+
+const lineage = `{
+	"nodes": [
+		{"id": "raw.clicks", "annotation": "DataType IPAddress"},
+		{"id": "raw.accounts", "annotation": "DataType AccountID"},
+		{"id": "daily.joined", "annotation": "DataType IPAddress DataType AccountID"}
+	],
+	"flows": [
+		{"from": "raw.clicks", "to": "daily.joined"},
+		{"from": "raw.accounts", "to": "daily.joined"},
+		{"from": "daily.joined", "to": "report"}
+	]
+}`
+
+func TestLoadGraph(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	g, err := LoadGraph(strings.NewReader(lineage), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := g.NodeIDs(); !equals(got, []string{"daily.joined", "raw.accounts", "raw.clicks", "report"}) {
+		t.Errorf("NodeIDs() = %q", got)
+	}
+	if len(g.Flows) != 3 {
+		t.Errorf("len(Flows) = %d, want 3", len(g.Flows))
+	}
+	// unlabeled nodes are checked like any other node
+	vs := CheckGraph(p, g)
+	if len(vs) != 2 || vs[0].Node != "daily.joined" || vs[1].Node != "report" {
+		t.Errorf("CheckGraph() = %v", vs)
+	}
+
+	bad := []string{
+		`{"nodes": [{"id": "x", "annotation": "DataType Unknown"}]}`,
+		`{"nodes": [{"annotation": "DataType IPAddress"}]}`,
+		`{"flows": [{"from": "x"}]}`,
+		`not json`,
+	}
+	for _, b := range bad {
+		if _, err := LoadGraph(strings.NewReader(b), p); err == nil {
+			t.Errorf("LoadGraph(%q) should fail", b)
+		}
+	}
+}
+
+func TestCheckFlows(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	g, err := LoadGraph(strings.NewReader(`{
+		"nodes": [
+			{"id": "raw.clicks", "annotation": "DataType IPAddress"},
+			{"id": "raw.accounts", "annotation": "DataType AccountID"},
+			{"id": "daily.joined", "annotation": "DataType IPAddress DataType AccountID"},
+			{"id": "daily.locations", "annotation": "DataType Location"}
+		],
+		"flows": [
+			{"from": "raw.clicks", "to": "raw.accounts"},
+			{"from": "raw.clicks", "to": "daily.joined"},
+			{"from": "raw.clicks", "to": "daily.locations"}
+		]
+	}`), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	// the flow into daily.joined is left to CheckGraph, which reports the node
+	vs := CheckFlows(p, g)
+	if len(vs) != 1 || vs[0].Flow != (Flow{"raw.clicks", "raw.accounts"}) ||
+		vs[0].Annotation.String() != "DataType IPAddress DataType AccountID" {
+		t.Errorf("CheckFlows() = %v", vs)
+	}
+}
+
+func TestIncrementalChecker(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	g, err := LoadGraph(strings.NewReader(lineage), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	c := NewIncrementalChecker(p)
+	vs, n := c.Check(g)
+	if len(vs) != 2 || n != 4 {
+		t.Errorf("Check() = %v, %d", vs, n)
+	}
+	an, _ := p.ParseAnnotation("DataType IPAddress")
+	g.AddNode("daily.joined", an)
+	vs, n = c.Check(g)
+	if len(vs) != 1 || n != 1 {
+		t.Errorf("Check() = %v, %d, want 1 violation and 1 re-check", vs, n)
+	}
+}
+
+func TestEmitted(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType Location")
+	l := grok.NewEmissionLimiter(time.Hour, 0, 0)
+	g := NewDataFlowGraph()
+	an, _ := p.ParseAnnotation("DataType AccountID")
+	g.AddNode("accounts", an)
+	if vs := Emitted(l, CheckGraph(p, g)); len(vs) != 1 {
+		t.Errorf("Emitted() = %v", vs)
+	}
+	if vs := Emitted(l, CheckGraph(p, g)); len(vs) != 0 {
+		t.Errorf("Emitted() again = %v", vs)
+	}
+}
+
+func TestIncrementalCheckerExpiry(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	an, _ := p.ParseAnnotation("DataType IPAddress DataType AccountID")
+	g := NewDataFlowGraph()
+	g.AddNode("joined", an.Until("DataType", "IPAddress", now.Add(time.Hour)))
+	c := NewIncrementalChecker(p)
+	c.Now = func() time.Time { return now }
+
+	tests := []struct {
+		name       string
+		at         time.Time
+		until      time.Time
+		violations int
+		rechecked  int
+	}{
+		{"first check", now, now.Add(time.Hour), 1, 1},
+		{"unchanged", now.Add(time.Minute), now.Add(time.Hour), 1, 0},
+		{"expiry moved", now.Add(time.Minute), now.Add(2 * time.Hour), 1, 1},
+		{"expired", now.Add(2 * time.Hour), now.Add(2 * time.Hour), 0, 1},
+		{"still expired", now.Add(3 * time.Hour), now.Add(2 * time.Hour), 0, 0},
+	}
+	for _, tt := range tests {
+		now = tt.at
+		g.AddNode("joined", an.Until("DataType", "IPAddress", tt.until))
+		if vs, n := c.Check(g); len(vs) != tt.violations || n != tt.rechecked {
+			t.Errorf("%s: Check() = %v, %d, want %d violations and %d re-checks", tt.name, vs, n, tt.violations, tt.rechecked)
+		}
+	}
+}
+
+func TestCheckGraphExpiry(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	an, err := p.ParseAnnotation("DataType IPAddress DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	now := time.Now()
+	g := NewDataFlowGraph()
+	g.AddNode("expired", an.Until("DataType", "IPAddress", now.Add(-time.Hour)))
+	g.AddNode("expiring", an.Until("DataType", "IPAddress", now.Add(time.Hour)))
+	g.AddNode("joined", an)
+
+	// CheckGraph and IncrementalChecker agree on expired values
+	vs := CheckGraph(p, g)
+	ivs, _ := NewIncrementalChecker(p).Check(g)
+	if !reflect.DeepEqual(vs, ivs) || len(vs) != 2 || vs[0].Node != "expiring" || vs[1].Node != "joined" {
+		t.Errorf("CheckGraph() = %v, IncrementalChecker.Check() = %v", vs, ivs)
+	}
+	if vs := CheckGraphAt(p, g, now.Add(2*time.Hour)); len(vs) != 1 || vs[0].Node != "joined" {
+		t.Errorf("CheckGraphAt() = %v", vs)
+	}
+	if vs := CheckGraphOver(p, g, Interval{From: now.Add(-2 * time.Hour)}); len(vs) != 3 {
+		t.Errorf("CheckGraphOver() = %v", vs)
+	}
+}
+
+func TestAddFlow(t *testing.T) {
+	g := &DataFlowGraph{Nodes: make(map[string]*Node), Flows: []Flow{{"a", "b"}}}
+	g.AddFlow("a", "b")
+	g.AddFlow("b", "c")
+	g.AddFlow("b", "c")
+	g.Flows = append(g.Flows, Flow{"c", "d"})
+	g.AddFlow("c", "d")
+	if want := []Flow{{"a", "b"}, {"b", "c"}, {"c", "d"}}; !reflect.DeepEqual(g.Flows, want) {
+		t.Errorf("Flows = %v, want %v", g.Flows, want)
+	}
+	g.Flows = []Flow{{"c", "d"}}
+	g.AddFlow("a", "b")
+	g.AddFlow("c", "d")
+	if want := []Flow{{"c", "d"}, {"a", "b"}}; !reflect.DeepEqual(g.Flows, want) {
+		t.Errorf("Flows = %v, want %v", g.Flows, want)
+	}
+}
+
+func TestApplyOpenLineage(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	events := `{"eventType": "COMPLETE",
+		"inputs": [{"namespace": "db", "name": "clicks", "facets": {"grok": {"annotation": "DataType IPAddress"}}}],
+		"outputs": [{"namespace": "db", "name": "joined", "facets": {"grok": {"annotation": "DataType IPAddress DataType AccountID"}}}]}
+{"eventType": "COMPLETE", "inputs": [{"namespace": "db", "name": "joined"}], "outputs": [{"namespace": "s3", "name": "export"}]}
+{"eventType": "START", "inputs": [`
+	events = strings.Replace(events, "\n\t\t", " ", -1)
+	g := NewDataFlowGraph()
+	n, err := ApplyOpenLineage(g, p, strings.NewReader(events))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if n != int64(strings.LastIndex(events, "\n")+1) {
+		t.Errorf("ApplyOpenLineage() = %d, the partial line should be left", n)
+	}
+	if got := g.NodeIDs(); !equals(got, []string{"db/clicks", "db/joined", "s3/export"}) {
+		t.Errorf("NodeIDs() = %q", got)
+	}
+	if vs := CheckGraph(p, g); len(vs) != 2 || vs[0].Node != "db/joined" {
+		t.Errorf("CheckGraph() = %v", vs)
+	}
+	if _, err := ApplyOpenLineage(g, p, strings.NewReader("{\"inputs\": [{\"name\": \"x\", \"facets\": {\"grok\": {\"annotation\": \"Bad\"}}}]}\n")); err == nil {
+		t.Errorf("ApplyOpenLineage() with an invalid annotation should fail")
+	}
+}
@@ -0,0 +1,336 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+// GraphSnapshot is a snapshot of a graph and of the results of its checks:
+// a full snapshot, or the delta of the graph since the previous snapshot
+type GraphSnapshot struct {
+	Seq  int  `json:"seq"`
+	Full bool `json:"full,omitempty"`
+	// Nodes and Flows are the nodes and flows added or changed
+	Nodes []NodeSnapshot `json:"nodes,omitempty"`
+	Flows []FlowSnapshot `json:"flows,omitempty"`
+	// RemovedNodes and RemovedFlows are the nodes and flows removed
+	RemovedNodes []string `json:"removed_nodes,omitempty"`
+	RemovedFlows []Flow   `json:"removed_flows,omitempty"`
+}
+
+// NodeSnapshot is a node of a GraphSnapshot
+type NodeSnapshot struct {
+	ID         string          `json:"id"`
+	Annotation grok.Annotation `json:"annotation"`
+	Active     *Interval       `json:"active,omitempty"`
+	// Allowed is the result of the check of the node, if it was checked
+	Allowed *bool `json:"allowed,omitempty"`
+}
+
+// FlowSnapshot is a flow of a GraphSnapshot
+type FlowSnapshot struct {
+	Flow
+	Active *Interval `json:"active,omitempty"`
+	Kind   string    `json:"kind,omitempty"`
+}
+
+// GraphStore stores the snapshots of a graph, e.g. in files, in key-value
+// stores such as bolt or badger, or in SQL tables
+type GraphStore interface {
+	// Append appends a snapshot to the store
+	Append(s GraphSnapshot) error
+	// Snapshots returns the snapshots of the store, oldest first
+	Snapshots() ([]GraphSnapshot, error)
+	// Replace replaces the snapshots of the store by a full snapshot
+	Replace(s GraphSnapshot) error
+}
+
+// MemoryGraphStore is a GraphStore in memory
+type MemoryGraphStore struct {
+	snapshots []GraphSnapshot
+}
+
+// Append implements GraphStore
+func (m *MemoryGraphStore) Append(s GraphSnapshot) error {
+	m.snapshots = append(m.snapshots, s)
+	return nil
+}
+
+// Snapshots implements GraphStore
+func (m *MemoryGraphStore) Snapshots() ([]GraphSnapshot, error) {
+	return append([]GraphSnapshot(nil), m.snapshots...), nil
+}
+
+// Replace implements GraphStore
+func (m *MemoryGraphStore) Replace(s GraphSnapshot) error {
+	m.snapshots = []GraphSnapshot{s}
+	return nil
+}
+
+// FileGraphStore is a GraphStore in a file, with a snapshot in JSON per line
+type FileGraphStore struct {
+	Path string
+}
+
+// Append implements GraphStore
+func (f *FileGraphStore) Append(s GraphSnapshot) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(b, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Snapshots implements GraphStore. A missing file has no snapshots.
+func (f *FileGraphStore) Snapshots() ([]GraphSnapshot, error) {
+	file, err := os.Open(f.Path)
+	if os.IsNotExist(err) {
+		return []GraphSnapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ss := make([]GraphSnapshot, 0)
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), 1<<30)
+	for sc.Scan() {
+		var s GraphSnapshot
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return nil, errors.New(fmt.Sprintf("graph: snapshot %d of %s: %s", len(ss), f.Path, err))
+		}
+		ss = append(ss, s)
+	}
+	return ss, sc.Err()
+}
+
+// Replace implements GraphStore, replacing the file atomically
+func (f *FileGraphStore) Replace(s GraphSnapshot) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
+
+// GraphLog saves a graph and the results of its incremental checker to a
+// store, as the deltas of the graph since the previous save, so that the
+// checker doesn't re-check the whole graph on every run. The store is
+// compacted into a full snapshot every CompactEvery saves.
+type GraphLog struct {
+	Store GraphStore
+	// CompactEvery is the number of deltas after which Save compacts the
+	// store, never when it's 0
+	CompactEvery int
+	// nodes and flows are the state of the graph saved last
+	nodes  map[string]NodeSnapshot
+	flows  map[Flow]FlowSnapshot
+	seq    int
+	deltas int
+}
+
+// OpenGraphLog opens the log of a store, and returns the graph it saved last
+// and the incremental checker of the policy with the results saved with it
+func OpenGraphLog(store GraphStore, p *grok.Policy) (*GraphLog, *DataFlowGraph, *IncrementalChecker, error) {
+	ss, err := store.Snapshots()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	l := &GraphLog{Store: store, nodes: make(map[string]NodeSnapshot), flows: make(map[Flow]FlowSnapshot)}
+	for i, s := range ss {
+		if s.Seq != l.seq+1 && !(s.Full && i == 0) {
+			return nil, nil, nil, errors.New(fmt.Sprintf("graph: snapshot %d follows snapshot %d", s.Seq, l.seq))
+		}
+		if s.Full {
+			l.nodes, l.flows, l.deltas = make(map[string]NodeSnapshot), make(map[Flow]FlowSnapshot), 0
+		} else {
+			l.deltas++
+		}
+		l.apply(s)
+		l.seq = s.Seq
+	}
+
+	g := NewDataFlowGraph()
+	c := NewIncrementalChecker(p)
+	for id, n := range l.nodes {
+		g.Nodes[id] = &Node{id, n.Annotation}
+		if n.Active != nil {
+			g.SetActive(id, *n.Active)
+		}
+		if n.Allowed != nil {
+			// the saved results are re-checked once any value expired, since the
+			// time of the check isn't saved
+			c.results[id] = checkResult{checkKey(n.Annotation), *n.Allowed, nextExpiry(n.Annotation, time.Time{})}
+		}
+	}
+	for _, f := range l.sortedFlows() {
+		g.Flows = append(g.Flows, f.Flow)
+		if f.Active != nil {
+			g.SetFlowActive(f.From, f.To, *f.Active)
+		}
+		if f.Kind != "" {
+			g.SetFlowKind(f.From, f.To, f.Kind)
+		}
+	}
+	return l, g, c, nil
+}
+
+// Save appends the delta of the graph and of the results of the checker
+// since the previous save, if any, and compacts the store when it's due. The
+// checker may be nil, which keeps the saved results of the unchanged nodes.
+func (l *GraphLog) Save(g *DataFlowGraph, c *IncrementalChecker) error {
+	nodes, flows := l.state(g, c)
+	s := GraphSnapshot{Seq: l.seq + 1}
+	for _, id := range g.NodeIDs() {
+		if old, ok := l.nodes[id]; !ok || !sameNode(old, nodes[id]) {
+			s.Nodes = append(s.Nodes, nodes[id])
+		}
+	}
+	for id := range l.nodes {
+		if _, ok := nodes[id]; !ok {
+			s.RemovedNodes = append(s.RemovedNodes, id)
+		}
+	}
+	sort.Strings(s.RemovedNodes)
+	for _, f := range g.Flows {
+		if old, ok := l.flows[f]; !ok || !sameInterval(old.Active, flows[f].Active) || old.Kind != flows[f].Kind {
+			s.Flows = append(s.Flows, flows[f])
+		}
+	}
+	for _, f := range l.sortedFlows() {
+		if _, ok := flows[f.Flow]; !ok {
+			s.RemovedFlows = append(s.RemovedFlows, f.Flow)
+		}
+	}
+	if len(s.Nodes)+len(s.Flows)+len(s.RemovedNodes)+len(s.RemovedFlows) == 0 {
+		return nil
+	}
+	if err := l.Store.Append(s); err != nil {
+		return err
+	}
+	l.apply(s)
+	l.seq = s.Seq
+	if l.deltas++; l.CompactEvery > 0 && l.deltas >= l.CompactEvery {
+		return l.Compact()
+	}
+	return nil
+}
+
+// Compact replaces the snapshots of the store by a full snapshot of the
+// graph saved last
+func (l *GraphLog) Compact() error {
+	s := GraphSnapshot{Seq: l.seq + 1, Full: true}
+	ids := make([]string, 0, len(l.nodes))
+	for id := range l.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s.Nodes = append(s.Nodes, l.nodes[id])
+	}
+	s.Flows = l.sortedFlows()
+	if err := l.Store.Replace(s); err != nil {
+		return err
+	}
+	l.seq, l.deltas = s.Seq, 0
+	return nil
+}
+
+// state returns the snapshots of the nodes and flows of a graph
+func (l *GraphLog) state(g *DataFlowGraph, c *IncrementalChecker) (map[string]NodeSnapshot, map[Flow]FlowSnapshot) {
+	nodes := make(map[string]NodeSnapshot, len(g.Nodes))
+	for id, n := range g.Nodes {
+		ns := NodeSnapshot{ID: id, Annotation: n.Annotation}
+		if iv, ok := g.Active[id]; ok {
+			ns.Active = &iv
+		}
+		key := checkKey(n.Annotation)
+		if c == nil {
+			if old, ok := l.nodes[id]; ok && checkKey(old.Annotation) == key {
+				ns.Allowed = old.Allowed
+			}
+		} else if r, ok := c.results[id]; ok && r.annotation == key {
+			allowed := r.allowed
+			ns.Allowed = &allowed
+		}
+		nodes[id] = ns
+	}
+	flows := make(map[Flow]FlowSnapshot, len(g.Flows))
+	for _, f := range g.Flows {
+		fs := FlowSnapshot{Flow: f, Kind: g.FlowKinds[f]}
+		if iv, ok := g.FlowsActive[f]; ok {
+			fs.Active = &iv
+		}
+		flows[f] = fs
+	}
+	return nodes, flows
+}
+
+// apply applies a snapshot to the state of the graph saved last
+func (l *GraphLog) apply(s GraphSnapshot) {
+	for _, n := range s.Nodes {
+		l.nodes[n.ID] = n
+	}
+	for _, f := range s.Flows {
+		l.flows[f.Flow] = f
+	}
+	for _, id := range s.RemovedNodes {
+		delete(l.nodes, id)
+	}
+	for _, f := range s.RemovedFlows {
+		delete(l.flows, f)
+	}
+}
+
+func (l *GraphLog) sortedFlows() []FlowSnapshot {
+	fs := make([]FlowSnapshot, 0, len(l.flows))
+	for _, f := range l.flows {
+		fs = append(fs, f)
+	}
+	sort.Slice(fs, func(i, j int) bool {
+		if fs[i].From != fs[j].From {
+			return fs[i].From < fs[j].From
+		}
+		return fs[i].To < fs[j].To
+	})
+	return fs
+}
+
+func sameNode(a, b NodeSnapshot) bool {
+	return checkKey(a.Annotation) == checkKey(b.Annotation) && sameInterval(a.Active, b.Active) &&
+		(a.Allowed == nil) == (b.Allowed == nil) && (a.Allowed == nil || *a.Allowed == *b.Allowed)
+}
+
+func sameInterval(a, b *Interval) bool {
+	return a == nil && b == nil || a != nil && b != nil && a.From.Equal(b.From) && a.To.Equal(b.To)
+}
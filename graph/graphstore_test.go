@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graphstore")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(dir)
+	stores := []GraphStore{&MemoryGraphStore{}, &FileGraphStore{Path: filepath.Join(dir, "graph.jsonl")}}
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	for _, store := range stores {
+		l, g, c, err := OpenGraphLog(store, p)
+		if err != nil || len(g.Nodes) != 0 {
+			t.Fatalf("OpenGraphLog() = %v, %q", g, err)
+		}
+		l.CompactEvery = 3
+		g, _ = LoadGraph(strings.NewReader(lineage), p)
+		g.SetActive("report", Interval{From: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)})
+		g.SetFlowKind("daily.joined", "report", AggregateFlow)
+		c.Check(g)
+		if err := l.Save(g, c); err != nil {
+			t.Fatalf("%q", err)
+		}
+		// saving the same graph appends nothing
+		if err := l.Save(g, c); err != nil {
+			t.Fatalf("%q", err)
+		}
+		an, _ := p.ParseAnnotation("DataType IPAddress")
+		g.AddNode("daily.joined", an)
+		g.Flows = g.Flows[1:]
+		c.Check(g)
+		if err := l.Save(g, c); err != nil {
+			t.Fatalf("%q", err)
+		}
+		ss, _ := store.Snapshots()
+		if len(ss) != 2 || len(ss[0].Nodes) != 4 || len(ss[1].Nodes) != 1 || len(ss[1].RemovedFlows) != 1 {
+			t.Fatalf("Snapshots() = %+v", ss)
+		}
+
+		// the reopened checker doesn't re-check the saved nodes
+		_, g2, c2, err := OpenGraphLog(store, p)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if !equals(g2.NodeIDs(), g.NodeIDs()) || len(g2.Flows) != 2 || g2.Active["report"].From.Year() != 2023 ||
+			g2.FlowKinds[Flow{"daily.joined", "report"}] != AggregateFlow {
+			t.Errorf("OpenGraphLog() = %q, %v", g2.NodeIDs(), g2.Flows)
+		}
+		if vs, n := c2.Check(g2); len(vs) != 1 || n != 0 {
+			t.Errorf("Check() = %v, %d, want 1 violation and no re-check", vs, n)
+		}
+
+		// the third delta compacts the store
+		g.AddNode("raw.new", an)
+		if err := l.Save(g, nil); err != nil {
+			t.Fatalf("%q", err)
+		}
+		if ss, _ := store.Snapshots(); len(ss) != 1 || !ss[0].Full || ss[0].Seq != 4 || len(ss[0].Nodes) != 5 {
+			t.Errorf("Snapshots() = %+v", ss)
+		}
+		// without a checker, the results of the unchanged nodes are kept
+		if n := l.nodes["raw.clicks"]; n.Allowed == nil || !*n.Allowed {
+			t.Errorf("raw.clicks = %+v", n)
+		}
+		if _, g3, _, err := OpenGraphLog(store, p); err != nil || len(g3.Nodes) != 5 {
+			t.Errorf("OpenGraphLog() = %v, %q", g3, err)
+		}
+	}
+
+	store := &MemoryGraphStore{}
+	store.Append(GraphSnapshot{Seq: 1})
+	store.Append(GraphSnapshot{Seq: 3})
+	if _, _, _, err := OpenGraphLog(store, p); err == nil {
+		t.Errorf("OpenGraphLog() with a missing snapshot should fail")
+	}
+}
@@ -0,0 +1,185 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// NodeMatcher returns true when a node of a graph and a node of another graph
+// are the same node, e.g. the same dataset seen by the warehouse lineage and
+// by the service-to-service flows
+type NodeMatcher func(a, b *Node) bool
+
+// MatchIDs returns the matcher of the nodes whose IDs are the same in a
+// scheme (see IDScheme)
+func MatchIDs(scheme IDScheme) NodeMatcher {
+	return func(a, b *Node) bool {
+		return scheme(a.ID) == scheme(b.ID)
+	}
+}
+
+// MergeConflict is an attribute whose values in the annotations of a node
+// disagree between the merged graphs
+type MergeConflict struct {
+	Node      string
+	Attribute string
+	// Left and Right are the values of the attribute in the first and in the
+	// second graph
+	Left, Right []string
+	// Merged are the values of the attribute in the merged graph
+	Merged []string
+}
+
+func (c MergeConflict) String() string {
+	return fmt.Sprintf("%s: %s is %s in the first graph and %s in the second, merged into %s", c.Node, c.Attribute,
+		strings.Join(c.Left, ", "), strings.Join(c.Right, ", "), strings.Join(c.Merged, ", "))
+}
+
+// MergeGraphs stitches two graphs ingested from different systems into one,
+// so that end-to-end flows can be checked. Nodes with the same ID are the
+// same node, and so are the nodes of the second graph that match a node of
+// the first graph (the first one by ID), which take its ID. A nil matcher
+// matches nodes by ID only. A node or a flow in both graphs is active when
+// it is active in either.
+//
+// The annotations of the same node are reconciled attribute by attribute:
+// two single values of a lattice attribute are joined in their lattice, and
+// conflict when neither precedes the other; other values that differ are
+// merged into all the values of both annotations, and conflict. The
+// conflicts are returned sorted by node.
+func MergeGraphs(p *grok.Policy, g1, g2 *DataFlowGraph, matcher NodeMatcher) (*DataFlowGraph, []MergeConflict) {
+	g := NewDataFlowGraph()
+	ids1 := g1.NodeIDs()
+	for _, id := range ids1 {
+		g.Nodes[id] = &Node{id, g1.Nodes[id].Annotation}
+		if iv, ok := g1.Active[id]; ok {
+			g.SetActive(id, iv)
+		}
+	}
+	// ids are the IDs of the nodes of the second graph in the merged graph
+	ids := make(map[string]string)
+	cs := make([]MergeConflict, 0)
+	for _, id := range g2.NodeIDs() {
+		n2 := g2.Nodes[id]
+		ids[id] = id
+		if _, ok := g1.Nodes[id]; !ok && matcher != nil {
+			for _, id1 := range ids1 {
+				if matcher(g1.Nodes[id1], n2) {
+					ids[id] = id1
+					break
+				}
+			}
+		}
+		n, ok := g.Nodes[ids[id]]
+		if !ok {
+			g.Nodes[id] = &Node{id, n2.Annotation}
+			if iv, ok := g2.Active[id]; ok {
+				g.SetActive(id, iv)
+			}
+			continue
+		}
+		// the node is active when it is in either graph
+		if iv, ok := g.Active[n.ID]; ok {
+			if iv2, ok := g2.Active[id]; ok {
+				g.Active[n.ID] = iv.hull(iv2)
+			} else {
+				delete(g.Active, n.ID)
+			}
+		}
+		var ncs []MergeConflict
+		n.Annotation, ncs = joinAnnotations(p, n.Annotation, n2.Annotation)
+		for _, c := range ncs {
+			c.Node = n.ID
+			cs = append(cs, c)
+		}
+	}
+	for _, f := range g1.Flows {
+		g.AddFlow(f.From, f.To)
+		if iv, ok := g1.FlowsActive[f]; ok {
+			g.SetFlowActive(f.From, f.To, iv)
+		}
+	}
+	for _, f := range g2.Flows {
+		mf := Flow{ids[f.From], ids[f.To]}
+		merged := false
+		for _, f1 := range g.Flows {
+			merged = merged || f1 == mf
+		}
+		g.AddFlow(mf.From, mf.To)
+		// the flow is active when it is in either graph
+		iv, ok := g2.FlowsActive[f]
+		iv1, ok1 := g.FlowsActive[mf]
+		switch {
+		case !merged && ok:
+			g.SetFlowActive(mf.From, mf.To, iv)
+		case ok1 && ok:
+			g.FlowsActive[mf] = iv1.hull(iv)
+		case ok1:
+			delete(g.FlowsActive, mf)
+		}
+	}
+	g.Scheme = g1.Scheme
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].Node < cs[j].Node })
+	return g, cs
+}
+
+// joinAnnotations reconciles two annotations of the same node, and returns
+// the conflicts of their attributes
+func joinAnnotations(p *grok.Policy, a, b grok.Annotation) (grok.Annotation, []MergeConflict) {
+	res := make(grok.Annotation, 0, len(a)+len(b))
+	cs := make([]MergeConflict, 0)
+	for _, name := range append(append(grok.Annotation{}, a...), b...).Names() {
+		left, right := a.Select(name), b.Select(name)
+		switch {
+		case len(right) == 0 || sameValues(left.ValuesOf(name), right.ValuesOf(name)):
+			res = append(res, left...)
+			continue
+		case len(left) == 0:
+			res = append(res, right...)
+			continue
+		}
+		var merged grok.Annotation
+		conflict := true
+		if l := p.Lattice(name); l != nil && len(left) == 1 && len(right) == 1 {
+			x, y := left.ValuesOf(name)[0], right.ValuesOf(name)[0]
+			merged = left.MapValues(name, func(string) string { return l.Join(x, y) })
+			conflict = !l.Precede(x, y) && !l.Precede(y, x)
+		} else {
+			merged = left.Union(right)
+		}
+		res = append(res, merged...)
+		if conflict {
+			cs = append(cs, MergeConflict{Attribute: name, Left: left.ValuesOf(name),
+				Right: right.ValuesOf(name), Merged: merged.ValuesOf(name)})
+		}
+	}
+	return res, cs
+}
+
+// sameValues returns true when two lists of values have the same values
+func sameValues(a, b []string) bool {
+	for _, v := range a {
+		if !contains(b, v) {
+			return false
+		}
+	}
+	for _, v := range b {
+		if !contains(a, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains returns true when the list has the string
+func contains(arr []string, str string) bool {
+	for _, s := range arr {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeGraphs(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	warehouse, err := LoadGraph(strings.NewReader(`{
+		"nodes": [
+			{"id": "public.clicks", "annotation": "DataType IPAddress"},
+			{"id": "public.accounts", "annotation": "DataType AccountID"},
+			{"id": "public.sessions", "annotation": "DataType IPAddress DataType AccountID"}
+		],
+		"flows": [{"from": "public.clicks", "to": "public.sessions"}]
+	}`), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	services, err := LoadGraph(strings.NewReader(`{
+		"nodes": [
+			{"id": "CLICKS", "annotation": "DataType Location"},
+			{"id": "ACCOUNTS", "annotation": "DataType IPAddress"},
+			{"id": "public.sessions", "annotation": "DataType IPAddress"},
+			{"id": "tracker", "annotation": "DataType IPAddress"}
+		],
+		"flows": [{"from": "tracker", "to": "CLICKS"}]
+	}`), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	g, cs := MergeGraphs(p, warehouse, services, MatchIDs(FQNScheme("public")))
+	if got := g.NodeIDs(); !equals(got, []string{"public.accounts", "public.clicks", "public.sessions", "tracker"}) {
+		t.Errorf("NodeIDs() = %q", got)
+	}
+	annotations := []struct {
+		node string
+		want string
+	}{
+		// IPAddress precedes Location
+		{"public.clicks", "DataType Location"},
+		{"public.accounts", "DataType UniqueID"},
+		{"public.sessions", "DataType IPAddress DataType AccountID"},
+		{"tracker", "DataType IPAddress"},
+	}
+	for _, a := range annotations {
+		if got := g.Nodes[a.node].Annotation.String(); got != a.want {
+			t.Errorf("%s = %q, want %q", a.node, got, a.want)
+		}
+	}
+	if len(g.Flows) != 2 || g.Flows[1] != (Flow{"tracker", "public.clicks"}) {
+		t.Errorf("Flows = %v", g.Flows)
+	}
+	if len(cs) != 2 || cs[0].Node != "public.accounts" || cs[1].Node != "public.sessions" {
+		t.Fatalf("conflicts = %v", cs)
+	}
+	want := "public.accounts: DataType is AccountID in the first graph and IPAddress in the second, merged into UniqueID"
+	if got := cs[0].String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// without a matcher, only the nodes of the same ID are merged
+	g, cs = MergeGraphs(p, warehouse, services, nil)
+	if len(g.Nodes) != 6 || len(cs) != 1 {
+		t.Errorf("MergeGraphs() = %q, %v", g.NodeIDs(), cs)
+	}
+}
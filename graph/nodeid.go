@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"path"
+	"strings"
+)
+
+// IDScheme canonicalizes the IDs of the nodes of a graph, so that the lineage
+// of several sources, which name the same dataset differently, merges into
+// one graph instead of duplicating its node per source. It returns the
+// canonical ID of an ID.
+type IDScheme func(id string) string
+
+// Normalize returns a scheme applying normalization hooks in order, e.g.
+// Normalize(strings.TrimSpace, FQNScheme("warehouse", "public"))
+func Normalize(hooks ...func(string) string) IDScheme {
+	return func(id string) string {
+		for _, h := range hooks {
+			id = h(id)
+		}
+		return id
+	}
+}
+
+// URNScheme returns the scheme of catalog URNs of a namespace, e.g.
+// urn:li:dataset. The prefix "urn:" and the namespace are case-insensitive,
+// and the IDs that aren't URNs of the namespace are made so.
+func URNScheme(namespace string) IDScheme {
+	prefix := "urn:" + strings.TrimPrefix(strings.ToLower(namespace), "urn:") + ":"
+	return func(id string) string {
+		id = strings.TrimSpace(id)
+		if strings.HasPrefix(strings.ToLower(id), prefix) {
+			return prefix + id[len(prefix):]
+		}
+		return prefix + id
+	}
+}
+
+// FQNScheme returns the scheme of the fully qualified names of tables, e.g.
+// database.schema.table, where the missing leading parts of names are the
+// defaults, e.g. FQNScheme("warehouse", "public") maps "Clicks" to
+// warehouse.public.clicks. Names are case-insensitive, and their parts may
+// be quoted with ", ` or [].
+func FQNScheme(defaults ...string) IDScheme {
+	return func(id string) string {
+		parts := strings.Split(strings.TrimSpace(id), ".")
+		for i, s := range parts {
+			s = strings.TrimSpace(s)
+			if len(s) >= 2 && (s[0] == '"' || s[0] == '`') && s[len(s)-1] == s[0] ||
+				len(s) >= 2 && s[0] == '[' && s[len(s)-1] == ']' {
+				s = s[1 : len(s)-1]
+			}
+			parts[i] = strings.ToLower(s)
+		}
+		if missing := len(defaults) + 1 - len(parts); missing > 0 {
+			fill := make([]string, 0, missing)
+			for _, d := range defaults[:missing] {
+				fill = append(fill, strings.ToLower(d))
+			}
+			parts = append(fill, parts...)
+		}
+		return strings.Join(parts, ".")
+	}
+}
+
+// PathScheme is the scheme of file paths and object URLs, e.g.
+// s3://bucket/events/: paths are cleaned, without trailing slash, and the
+// scheme file:// is removed.
+func PathScheme(id string) string {
+	id = strings.TrimSpace(id)
+	scheme := ""
+	if i := strings.Index(id, "://"); i > 0 {
+		scheme, id = strings.ToLower(id[:i]), id[i+3:]
+	}
+	if id != "" {
+		id = path.Clean(id)
+	}
+	if scheme == "" || scheme == "file" {
+		return id
+	}
+	return scheme + "://" + strings.TrimPrefix(id, "/")
+}
+
+// Canonical returns the canonical ID of an ID in the scheme of the graph
+func (g *DataFlowGraph) Canonical(id string) string {
+	if g.Scheme == nil {
+		return id
+	}
+	return g.Scheme(id)
+}
+
+// Node returns the node of an ID in the scheme of the graph, or nil
+func (g *DataFlowGraph) Node(id string) *Node {
+	return g.Nodes[g.Canonical(id)]
+}
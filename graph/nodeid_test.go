@@ -0,0 +1,61 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIDSchemes(t *testing.T) {
+	urn := URNScheme("urn:li:dataset")
+	fqn := FQNScheme("warehouse", "public")
+	tests := []struct {
+		scheme IDScheme
+		id     string
+		want   string
+	}{
+		{urn, "URN:LI:Dataset:(hive,clicks)", "urn:li:dataset:(hive,clicks)"},
+		{urn, " (hive,clicks)", "urn:li:dataset:(hive,clicks)"},
+		{fqn, "Clicks", "warehouse.public.clicks"},
+		{fqn, `analytics."Clicks"`, "warehouse.analytics.clicks"},
+		{fqn, "[Other].`Raw`.clicks", "other.raw.clicks"},
+		{fqn, "a.b.c.d", "a.b.c.d"},
+		{PathScheme, "file:///data/raw/../events/", "/data/events"},
+		{PathScheme, "S3://bucket//events/./day=1/", "s3://bucket/events/day=1"},
+		{PathScheme, "data/events", "data/events"},
+		{Normalize(strings.ToLower, PathScheme), "/Data/Events/", "/data/events"},
+	}
+	for _, tt := range tests {
+		if got := tt.scheme(tt.id); got != tt.want {
+			t.Errorf("scheme(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestGraphScheme(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	g := NewDataFlowGraph()
+	g.Scheme = FQNScheme("warehouse", "public")
+	ip, _ := p.ParseAnnotation("DataType IPAddress")
+	g.AddNode("public.clicks", ip)
+	// the same tables, as named by another source
+	g.AddFlow(`"Clicks"`, "warehouse.public.joined")
+	g.AddFlow("WAREHOUSE.PUBLIC.CLICKS", "joined")
+	if got := g.NodeIDs(); !equals(got, []string{"warehouse.public.clicks", "warehouse.public.joined"}) {
+		t.Errorf("NodeIDs() = %q", got)
+	}
+	if len(g.Flows) != 1 {
+		t.Errorf("Flows = %v, want 1 flow", g.Flows)
+	}
+	if n := g.Node("clicks"); n == nil || len(n.Annotation) != 1 {
+		t.Errorf("Node(clicks) = %v", n)
+	}
+
+	events := `{"inputs": [{"namespace": "public", "name": "Clicks"}], "outputs": [{"namespace": "public", "name": "joined"}]}` + "\n"
+	g.Scheme = Normalize(func(id string) string { return strings.Replace(id, "/", ".", 1) }, FQNScheme("warehouse", "public"))
+	if _, err := ApplyOpenLineage(g, p, strings.NewReader(events)); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if len(g.Nodes) != 2 || len(g.Nodes["warehouse.public.clicks"].Annotation) != 1 {
+		t.Errorf("ApplyOpenLineage() added duplicate nodes: %q", g.NodeIDs())
+	}
+}
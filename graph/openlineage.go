@@ -0,0 +1,97 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// OpenLineageFacet is the name of the OpenLineage dataset facet that carries
+// the annotation of a dataset, in the policy syntax:
+//
+//	"facets": {"grok": {"annotation": "DataType IPAddress"}}
+const OpenLineageFacet = "grok"
+
+type openLineageDataset struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Facets    map[string]struct {
+		Annotation *string `json:"annotation"`
+	} `json:"facets"`
+}
+
+type openLineageEvent struct {
+	Inputs  []openLineageDataset `json:"inputs"`
+	Outputs []openLineageDataset `json:"outputs"`
+}
+
+// ApplyOpenLineage reads a stream of OpenLineage run events (one JSON object
+// per line) and adds their datasets and flows to the graph. Datasets are nodes
+// identified by namespace/name, and every input of an event flows to every
+// output. A dataset without the grok facet keeps its current annotation.
+//
+// Only complete lines are applied, and the number of bytes they take is
+// returned, so that a growing stream can be read again from that offset.
+func ApplyOpenLineage(g *DataFlowGraph, p *grok.Policy, r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var n int64
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			// a partial line is left for the next read
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if strings.TrimSpace(line) != "" {
+			var ev openLineageEvent
+			if err := json.Unmarshal([]byte(line), &ev); err != nil {
+				return n, errors.New(fmt.Sprintf("openlineage: %s", err))
+			}
+			if err := applyOpenLineageEvent(g, p, ev); err != nil {
+				return n, err
+			}
+		}
+		n += int64(len(line))
+	}
+}
+
+func applyOpenLineageEvent(g *DataFlowGraph, p *grok.Policy, ev openLineageEvent) error {
+	ids := func(ds []openLineageDataset) ([]string, error) {
+		res := make([]string, 0, len(ds))
+		for _, d := range ds {
+			id := d.Namespace + "/" + d.Name
+			if f, ok := d.Facets[OpenLineageFacet]; ok && f.Annotation != nil {
+				an, err := p.ParseAnnotation(*f.Annotation)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("openlineage: dataset %s: %s", id, err))
+				}
+				g.AddNode(id, an)
+			} else if g.Node(id) == nil {
+				g.AddNode(id, grok.Annotation{})
+			}
+			res = append(res, g.Canonical(id))
+		}
+		return res, nil
+	}
+	ins, err := ids(ev.Inputs)
+	if err != nil {
+		return err
+	}
+	outs, err := ids(ev.Outputs)
+	if err != nil {
+		return err
+	}
+	for _, in := range ins {
+		for _, out := range outs {
+			g.AddFlow(in, out)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grongjun/grok"
+)
+
+// Flow kinds, which select the propagation rule of flows (see Propagation)
+const (
+	// CopyFlow copies the data of its source as is, e.g. a replication job.
+	// It's the kind of the flows without kind.
+	CopyFlow = "copy"
+	// TransformFlow transforms the data of its source, e.g. truncating IP
+	// addresses
+	TransformFlow = "transform"
+	// AggregateFlow aggregates the data of its source, e.g. counting events
+	AggregateFlow = "aggregate"
+)
+
+// SetFlowKind sets the kind of a flow, e.g. TransformFlow
+func (g *DataFlowGraph) SetFlowKind(from, to, kind string) {
+	if g.FlowKinds == nil {
+		g.FlowKinds = make(map[Flow]string)
+	}
+	g.FlowKinds[Flow{g.Canonical(from), g.Canonical(to)}] = kind
+}
+
+// kindOf returns the kind of a flow
+func (g *DataFlowGraph) kindOf(f Flow) string {
+	if kind, ok := g.FlowKinds[f]; ok {
+		return kind
+	}
+	return CopyFlow
+}
+
+// PropagationRule returns the annotation of the data that a flow carries to
+// its target, from the annotation of its source
+type PropagationRule func(an grok.Annotation) grok.Annotation
+
+// Propagation propagates annotations forward along the flows of graphs, so
+// that the downstream nodes inherit the data of the upstream nodes. The
+// annotation of a node combines its seed annotation, if any, with the
+// annotations that its incoming flows carry, which depend on their kind:
+//
+//	p := &graph.Propagation{Policy: policy, Rules: map[string]graph.PropagationRule{
+//		graph.TransformFlow: graph.StateRule("DataType", "Truncated"),
+//		graph.AggregateFlow: graph.ReplaceRule("DataType", "Aggregated(k=25)"),
+//	}}
+//
+// The values of a lattice attribute are combined as the policy interprets
+// repeated values (see grok.RepeatedValues): the data of a node has every
+// upstream value, or their lattice join.
+type Propagation struct {
+	Policy *grok.Policy
+	// Rules are the propagation rules by flow kind. Flows of kind CopyFlow
+	// copy the annotation of their source unless a rule overrides it.
+	Rules map[string]PropagationRule
+}
+
+// StateRule returns a rule setting the state of the values of a lattice
+// attribute, e.g. IPAddress becomes IPAddress:Truncated, and
+// IPAddress:Raw too. The members of value sets are set one by one.
+func StateRule(attr, state string) PropagationRule {
+	return func(an grok.Annotation) grok.Annotation {
+		return an.MapValues(attr, func(v string) string { return grok.InState(v, state) })
+	}
+}
+
+// ReplaceRule returns a rule replacing the values of an attribute by a
+// single value, e.g. the account IDs and IP addresses of a source by
+// Aggregated(k=25)
+func ReplaceRule(attr, value string) PropagationRule {
+	return func(an grok.Annotation) grok.Annotation {
+		// the values replaced are the same value, which the union keeps once
+		return grok.Annotation{}.Union(an.MapValues(attr, func(string) string { return value }))
+	}
+}
+
+// Propagate returns the annotations of the nodes of a graph propagated from
+// seed annotations by node ID, which must be nodes of the graph. The nodes
+// that neither have a seed nor are downstream of one have empty annotations.
+// The annotations of the graph itself aren't read nor changed: AddNode sets
+// them, e.g. to check the propagated annotations with CheckGraph. The
+// intervals of the nodes and the flows are ignored, see At to propagate
+// along the graph at a time.
+func (pr *Propagation) Propagate(g *DataFlowGraph, seeds map[string]grok.Annotation) (map[string]grok.Annotation, error) {
+	ans := make(map[string]grok.Annotation, len(g.Nodes))
+	for id := range g.Nodes {
+		ans[id] = grok.Annotation{}
+	}
+	for id, an := range seeds {
+		cid := g.Canonical(id)
+		if _, ok := g.Nodes[cid]; !ok {
+			return nil, errors.New(fmt.Sprintf("graph: seed %s isn't a node", id))
+		}
+		ans[cid] = pr.combine(ans[cid], an)
+	}
+	for _, f := range g.Flows {
+		if kind := g.kindOf(f); kind != CopyFlow && pr.Rules[kind] == nil {
+			return nil, errors.New(fmt.Sprintf("graph: flow %s -> %s: no propagation rule for kind %s", f.From, f.To, kind))
+		}
+	}
+
+	// the annotations only grow, and the lattices are finite, so that the
+	// propagation ends with the cycles of the graph too
+	for changed := true; changed; {
+		changed = false
+		for _, f := range g.Flows {
+			carried := ans[f.From]
+			if rule := pr.Rules[g.kindOf(f)]; rule != nil {
+				carried = rule(carried)
+			}
+			an := pr.combine(ans[f.To], carried)
+			if grok.Clause(an).String() != grok.Clause(ans[f.To]).String() {
+				ans[f.To], changed = an, true
+			}
+		}
+	}
+	return ans, nil
+}
+
+// combine returns the annotation of the data of a and b, i.e. the pairs of a
+// followed by the pairs of b that a doesn't have, where the values of the
+// lattice attributes interpreted as JoinValues are joined
+func (pr *Propagation) combine(a, b grok.Annotation) grok.Annotation {
+	res := a.Union(b)
+	if pr.Policy != nil {
+		res = pr.Policy.JoinRepeated(res)
+	}
+	return res
+}
@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func TestPropagate(t *testing.T) {
+	l := grok.NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"], "Aggregated": [] } }`)
+	l.Product(grok.NewLattice(`{ "name": "TypeState", "edges": { "Raw": ["Truncated"] } }`))
+	p := grok.NewPolicy([]*grok.Lattice{l})
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID EXCEPT { ALLOW DataType IPAddress:Truncated DataType AccountID } }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	g, err := LoadGraph(strings.NewReader(`{
+		"flows": [
+			{"from": "raw.clicks", "to": "daily.joined"},
+			{"from": "raw.accounts", "to": "daily.joined"},
+			{"from": "raw.clicks", "to": "clicks.truncated", "kind": "transform"},
+			{"from": "clicks.truncated", "to": "daily.safe"},
+			{"from": "raw.accounts", "to": "daily.safe"},
+			{"from": "daily.joined", "to": "daily.counts", "kind": "aggregate"},
+			{"from": "daily.counts", "to": "daily.joined"}
+		]
+	}`), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	seeds := make(map[string]grok.Annotation)
+	for id, astr := range map[string]string{"raw.clicks": "DataType IPAddress", "raw.accounts": "DataType AccountID"} {
+		if seeds[id], err = p.ParseAnnotation(astr); err != nil {
+			t.Fatalf("%q", err)
+		}
+	}
+	pr := &Propagation{Policy: p, Rules: map[string]PropagationRule{
+		TransformFlow: StateRule("DataType", "Truncated"),
+		AggregateFlow: ReplaceRule("DataType", "Aggregated"),
+	}}
+	ans, err := pr.Propagate(g, seeds)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	// the cycle through daily.counts brings its aggregate back
+	want := map[string]string{
+		"raw.clicks":       "DataType IPAddress",
+		"clicks.truncated": "DataType IPAddress:Truncated",
+		"daily.joined":     "DataType IPAddress DataType AccountID DataType Aggregated",
+		"daily.safe":       "DataType IPAddress:Truncated DataType AccountID",
+		"daily.counts":     "DataType Aggregated",
+	}
+	for id, astr := range want {
+		if got := ans[id].String(); got != astr {
+			t.Errorf("Propagate()[%s] = %s, want %s", id, got, astr)
+		}
+	}
+	for id, an := range ans {
+		g.AddNode(id, an)
+	}
+	if vs := CheckGraph(p, g); len(vs) != 1 || vs[0].Node != "daily.joined" {
+		t.Errorf("CheckGraph() of the propagated annotations = %v", vs)
+	}
+
+	// with grok.JoinValues, the values of the joined data are joined
+	p.Repeated = grok.JoinValues
+	ans, err = pr.Propagate(g, seeds)
+	if err != nil || ans["daily.joined"].String() != "DataType TOP" || ans["daily.safe"].String() != "DataType UniqueID" {
+		t.Errorf("Propagate() with grok.JoinValues = %v, %v", ans, err)
+	}
+
+	if _, err := (&Propagation{Policy: p}).Propagate(g, seeds); err == nil ||
+		err.Error() != "graph: flow raw.clicks -> clicks.truncated: no propagation rule for kind transform" {
+		t.Errorf("Propagate() without rules = %v", err)
+	}
+	if _, err := pr.Propagate(g, map[string]grok.Annotation{"raw.logs": seeds["raw.clicks"]}); err == nil {
+		t.Errorf("Propagate() of an unknown seed should fail")
+	}
+}
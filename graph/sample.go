@@ -0,0 +1,231 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+// DefaultSampleSize is the number of nodes that a GraphSampler checks when
+// its Size isn't set
+const DefaultSampleSize = 1000
+
+// DefaultConfidence is the confidence level of the violation rates that a
+// GraphSampler estimates when its Confidence isn't set
+const DefaultConfidence = 0.95
+
+// GraphSampler checks a sample of the nodes of a graph too large to be
+// checked exhaustively, e.g. in CI, and estimates the violation rate of the
+// whole graph. The sample is stratified: every stratum of nodes, e.g. the
+// nodes of the same type, gets its share of the sample and at least one node.
+type GraphSampler struct {
+	// Size is the number of sampled nodes, DefaultSampleSize when it's 0
+	Size int
+	// Confidence is the confidence level of the estimated rate,
+	// DefaultConfidence when it's 0
+	Confidence float64
+	// Stratum returns the stratum of a node, AttributeStratum when it's nil
+	Stratum func(n *Node) string
+	// Rand is the source of the sample, seeded with 1 when it's nil so that
+	// samples are reproducible
+	Rand *rand.Rand
+}
+
+// AttributeStratum returns the attributes of the annotation of a node, e.g.
+// "DataType Purpose", so that the nodes labeled alike are in the same stratum
+func AttributeStratum(n *Node) string {
+	names := n.Annotation.Names()
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// StratumReport is the result of the check of a stratum of a sample
+type StratumReport struct {
+	Name                       string
+	Nodes, Sampled, Violations int
+}
+
+// SampleReport is the result of the check of a sample of a graph
+type SampleReport struct {
+	// Nodes is the number of nodes of the graph, and Sampled of the sample
+	Nodes, Sampled int
+	// Violations are the violating nodes of the sample, sorted by ID
+	Violations []Violation
+	// Rate is the estimated violation rate of the graph, and Low and High
+	// bound it with the confidence level of the sampler
+	Rate, Low, High float64
+	Confidence      float64
+	// Strata are the strata of the sample, sorted by name
+	Strata []StratumReport
+}
+
+// Exhaustive returns true when every node of the graph was checked
+func (r SampleReport) Exhaustive() bool {
+	return r.Sampled == r.Nodes
+}
+
+// String returns the report in one line, e.g. "12 violations in 1000 of
+// 250000 nodes: 1.2% of the nodes violate the policy (0.6% to 1.8% at 95%
+// confidence)"
+func (r SampleReport) String() string {
+	if r.Exhaustive() {
+		return fmt.Sprintf("%d violations in %d nodes", len(r.Violations), r.Nodes)
+	}
+	return fmt.Sprintf("%d violations in %d of %d nodes: %.1f%% of the nodes violate the policy (%.1f%% to %.1f%% at %.0f%% confidence)",
+		len(r.Violations), r.Sampled, r.Nodes, 100*r.Rate, 100*r.Low, 100*r.High, 100*r.Confidence)
+}
+
+// Check checks a stratified sample of the nodes of the graph, and estimates
+// the violation rate of the graph. The bounds of the rate are those of the
+// stratified estimator, with the proportions of the strata adjusted like in
+// Agresti-Coull intervals, so that a sample without violations doesn't
+// claim a rate of 0 with certainty.
+func (s *GraphSampler) Check(p *grok.Policy, g *DataFlowGraph) SampleReport {
+	size, confidence := s.Size, s.Confidence
+	if size <= 0 {
+		size = DefaultSampleSize
+	}
+	if confidence <= 0 || confidence >= 1 {
+		confidence = DefaultConfidence
+	}
+	stratum := s.Stratum
+	if stratum == nil {
+		stratum = AttributeStratum
+	}
+	now := time.Now()
+	r := s.Rand
+	if r == nil {
+		r = rand.New(rand.NewSource(1))
+	}
+
+	strata := make(map[string][]string)
+	names := make([]string, 0)
+	for _, id := range g.NodeIDs() {
+		h := stratum(g.Nodes[id])
+		if _, ok := strata[h]; !ok {
+			names = append(names, h)
+		}
+		strata[h] = append(strata[h], id)
+	}
+	sort.Strings(names)
+	report := SampleReport{Nodes: len(g.Nodes), Violations: make([]Violation, 0), Confidence: confidence,
+		Strata: make([]StratumReport, 0, len(names))}
+	if report.Nodes == 0 {
+		return report
+	}
+
+	z := zScore(confidence)
+	var variance float64
+	for _, h := range names {
+		ids := strata[h]
+		// the share of the sample of the stratum, at least a node
+		n := int(math.Round(float64(size) * float64(len(ids)) / float64(report.Nodes)))
+		if n < 1 {
+			n = 1
+		}
+		if n > len(ids) {
+			n = len(ids)
+		}
+		st := StratumReport{Name: h, Nodes: len(ids), Sampled: n}
+		for _, i := range r.Perm(len(ids))[:n] {
+			node := g.Nodes[ids[i]]
+			if !allowedAt(p, node.Annotation, now) {
+				report.Violations = append(report.Violations, Violation{node.ID, node.Annotation})
+				st.Violations++
+			}
+		}
+		report.Sampled += n
+		report.Strata = append(report.Strata, st)
+
+		w := float64(st.Nodes) / float64(report.Nodes)
+		report.Rate += w * float64(st.Violations) / float64(n)
+		if n < st.Nodes {
+			adjusted := (float64(st.Violations) + z*z/2) / (float64(n) + z*z)
+			fpc := 1 - float64(n)/float64(st.Nodes)
+			variance += w * w * adjusted * (1 - adjusted) / float64(n) * fpc
+		}
+	}
+	sort.Slice(report.Violations, func(i, j int) bool { return report.Violations[i].Node < report.Violations[j].Node })
+	margin := z * math.Sqrt(variance)
+	report.Low, report.High = math.Max(0, report.Rate-margin), math.Min(1, report.Rate+margin)
+	return report
+}
+
+// zScore returns the quantile of the standard normal distribution bounding a
+// two-sided confidence level, e.g. 1.96 for 0.95
+func zScore(confidence float64) float64 {
+	lo, hi := 0.0, 10.0
+	for i := 0; i < 60; i++ {
+		mid := (lo + hi) / 2
+		if math.Erf(mid/math.Sqrt2) < confidence {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// ChangedNodes returns the nodes of a graph that changed since a previous
+// version of it, sorted: the new nodes, the nodes whose annotation changed or
+// whose flows in changed, and the nodes downstream of them, whose data may
+// have changed with theirs
+func ChangedNodes(old, g *DataFlowGraph) []string {
+	in := func(g *DataFlowGraph) map[string][]string {
+		res := make(map[string][]string)
+		for _, f := range g.Flows {
+			res[f.To] = append(res[f.To], f.From)
+		}
+		return res
+	}
+	oldIn, newIn := in(old), in(g)
+	out := make(map[string][]string)
+	for _, f := range g.Flows {
+		out[f.From] = append(out[f.From], f.To)
+	}
+	changed := make(map[string]bool)
+	queue := make([]string, 0)
+	for _, id := range g.NodeIDs() {
+		o := old.Nodes[id]
+		if o == nil || o.Annotation.String() != g.Nodes[id].Annotation.String() || !sameValues(oldIn[id], newIn[id]) {
+			changed[id] = true
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, to := range out[id] {
+			if !changed[to] {
+				changed[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+	ids := make([]string, 0, len(changed))
+	for id := range changed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// CheckChanged checks exhaustively the nodes of a graph that changed since a
+// previous version of it (see ChangedNodes), like CheckGraph, e.g. to check
+// the graph of a pull request that a sample checks as a whole
+func CheckChanged(p *grok.Policy, old, g *DataFlowGraph) []Violation {
+	now := time.Now()
+	vs := make([]Violation, 0)
+	for _, id := range ChangedNodes(old, g) {
+		n := g.Nodes[id]
+		if !allowedAt(p, n.Annotation, now) {
+			vs = append(vs, Violation{id, n.Annotation})
+		}
+	}
+	return vs
+}
@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func TestGraphSampler(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	ip, _ := p.ParseAnnotation("DataType IPAddress")
+	both, _ := p.ParseAnnotation("DataType IPAddress DataType AccountID")
+	g := NewDataFlowGraph()
+	for i := 0; i < 900; i++ {
+		g.AddNode(fmt.Sprintf("raw.t%d", i), ip)
+	}
+	for i := 0; i < 100; i++ {
+		g.AddNode(fmt.Sprintf("joined.t%d", i), both)
+	}
+	s := &GraphSampler{Size: 100, Stratum: func(n *Node) string { return strings.Split(n.ID, ".")[0] }}
+	r := s.Check(p, g)
+	if r.Nodes != 1000 || r.Sampled != 100 || len(r.Strata) != 2 || r.Strata[0].Name != "joined" || r.Strata[0].Sampled != 10 {
+		t.Errorf("Check() = %+v", r)
+	}
+	if len(r.Violations) != 10 || r.Rate != 0.1 || r.Low > 0.1 || r.High < 0.1 || r.High-r.Low > 0.2 {
+		t.Errorf("Check() = %s", r)
+	}
+	if !strings.HasPrefix(r.String(), "10 violations in 100 of 1000 nodes: 10.0% of the nodes violate the policy (") {
+		t.Errorf("String() = %q", r)
+	}
+
+	// every stratum gets a node, and a sample without violations has bounds
+	s = &GraphSampler{Size: 10}
+	g.AddNode("other", grok.Annotation{})
+	r = s.Check(p, g)
+	if len(r.Strata) != 2 || r.Strata[0].Name != "" || r.Strata[0].Sampled != 1 || r.Sampled != 11 {
+		t.Errorf("Check() = %+v", r)
+	}
+	if r = (&GraphSampler{Size: 5000}).Check(p, g); !r.Exhaustive() || len(r.Violations) != 101 || r.Low != r.High {
+		t.Errorf("Check() = %s", r)
+	}
+	if z := zScore(0.95); z < 1.959 || z > 1.961 {
+		t.Errorf("zScore(0.95) = %f", z)
+	}
+}
+
+func TestCheckChanged(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	old, err := LoadGraph(strings.NewReader(lineage), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	g, _ := LoadGraph(strings.NewReader(lineage), p)
+	if got := ChangedNodes(old, g); len(got) != 0 {
+		t.Errorf("ChangedNodes() = %q", got)
+	}
+	an, _ := p.ParseAnnotation("DataType AccountID")
+	g.AddNode("raw.clicks", an)
+	g.AddFlow("raw.new", "raw.accounts")
+	if got := ChangedNodes(old, g); !equals(got, []string{"daily.joined", "raw.accounts", "raw.clicks", "raw.new", "report"}) {
+		t.Errorf("ChangedNodes() = %q", got)
+	}
+	if vs := CheckChanged(p, old, g); len(vs) != 3 || vs[0].Node != "daily.joined" {
+		t.Errorf("CheckChanged() = %v", vs)
+	}
+}
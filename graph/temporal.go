@@ -0,0 +1,102 @@
+package graph
+
+import (
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+// Interval is the time range [From, To) during which a node or a flow of a
+// graph is active, unbounded on the sides whose time is zero
+type Interval struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Contains returns true when the time is in the interval
+func (iv Interval) Contains(t time.Time) bool {
+	return (iv.From.IsZero() || !t.Before(iv.From)) && (iv.To.IsZero() || t.Before(iv.To))
+}
+
+// Overlaps returns true when the intervals have a time in common
+func (iv Interval) Overlaps(other Interval) bool {
+	return (iv.From.IsZero() || other.To.IsZero() || iv.From.Before(other.To)) &&
+		(iv.To.IsZero() || other.From.IsZero() || other.From.Before(iv.To))
+}
+
+// hull returns the least interval containing both intervals
+func (iv Interval) hull(other Interval) Interval {
+	if other.From.IsZero() || !iv.From.IsZero() && other.From.Before(iv.From) {
+		iv.From = other.From
+	}
+	if other.To.IsZero() || !iv.To.IsZero() && other.To.After(iv.To) {
+		iv.To = other.To
+	}
+	return iv
+}
+
+// SetActive sets the interval during which a node is active. A node without
+// an interval is always active.
+func (g *DataFlowGraph) SetActive(id string, iv Interval) {
+	if g.Active == nil {
+		g.Active = make(map[string]Interval)
+	}
+	g.Active[g.Canonical(id)] = iv
+}
+
+// SetFlowActive sets the interval during which a flow is active. A flow
+// without an interval is active when both its nodes are.
+func (g *DataFlowGraph) SetFlowActive(from, to string, iv Interval) {
+	if g.FlowsActive == nil {
+		g.FlowsActive = make(map[Flow]Interval)
+	}
+	g.FlowsActive[Flow{g.Canonical(from), g.Canonical(to)}] = iv
+}
+
+// Over returns the subgraph of the nodes and flows active at some time of a
+// window, e.g. so that decommissioned pipelines stop generating findings
+func (g *DataFlowGraph) Over(window Interval) *DataFlowGraph {
+	sub := NewDataFlowGraph()
+	sub.Scheme = g.Scheme
+	for id, n := range g.Nodes {
+		if iv, ok := g.Active[id]; !ok || iv.Overlaps(window) {
+			sub.Nodes[id] = &Node{id, n.Annotation}
+			if ok {
+				sub.SetActive(id, iv)
+			}
+		}
+	}
+	for _, f := range g.Flows {
+		iv, ok := g.FlowsActive[f]
+		if sub.Nodes[f.From] == nil || sub.Nodes[f.To] == nil || ok && !iv.Overlaps(window) {
+			continue
+		}
+		sub.Flows = append(sub.Flows, f)
+		if ok {
+			sub.SetFlowActive(f.From, f.To, iv)
+		}
+		if kind, ok := g.FlowKinds[f]; ok {
+			sub.SetFlowKind(f.From, f.To, kind)
+		}
+	}
+	return sub
+}
+
+// At returns the subgraph of the nodes and flows active at a time
+func (g *DataFlowGraph) At(t time.Time) *DataFlowGraph {
+	return g.Over(Interval{t, t.Add(1)})
+}
+
+// CheckGraphAt checks the nodes of the graph active at a time, like CheckGraph
+// but with the values of the annotations expired by that time dropped
+func CheckGraphAt(p *grok.Policy, g *DataFlowGraph, t time.Time) []Violation {
+	return checkAt(p, g.At(t), t)
+}
+
+// CheckGraphOver checks the nodes of the graph active at some time of a
+// window, like CheckGraph, e.g. to answer historical compliance questions.
+// The values of the annotations expired by the start of the window are
+// dropped.
+func CheckGraphOver(p *grok.Policy, g *DataFlowGraph, window Interval) []Violation {
+	return checkAt(p, g.Over(window), window.From)
+}
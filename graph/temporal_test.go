@@ -0,0 +1,90 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterval(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC) }
+	cases := []struct {
+		a, b     Interval
+		overlaps bool
+		hull     Interval
+	}{
+		{Interval{day(1), day(3)}, Interval{day(2), day(4)}, true, Interval{day(1), day(4)}},
+		{Interval{day(1), day(2)}, Interval{day(2), day(4)}, false, Interval{day(1), day(4)}},
+		{Interval{To: day(2)}, Interval{day(1), day(3)}, true, Interval{To: day(3)}},
+		{Interval{From: day(5)}, Interval{day(1), day(3)}, false, Interval{From: day(1)}},
+		{Interval{}, Interval{day(1), day(3)}, true, Interval{}},
+	}
+	for i, c := range cases {
+		if got := c.a.Overlaps(c.b); got != c.overlaps {
+			t.Errorf("%d: Overlaps() = %v", i, got)
+		}
+		if got := c.b.Overlaps(c.a); got != c.overlaps {
+			t.Errorf("%d: Overlaps() isn't symmetric", i)
+		}
+		if got := c.a.hull(c.b); got != c.hull {
+			t.Errorf("%d: hull() = %v, want %v", i, got, c.hull)
+		}
+	}
+	if iv := (Interval{day(1), day(2)}); !iv.Contains(day(1)) || iv.Contains(day(2)) {
+		t.Errorf("Contains() should be true on [From, To)")
+	}
+}
+
+func TestCheckGraphAt(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	g, err := LoadGraph(strings.NewReader(`{
+		"nodes": [
+			{"id": "raw.clicks", "annotation": "DataType IPAddress"},
+			{"id": "daily.joined", "annotation": "DataType IPAddress DataType AccountID",
+			 "active": {"from": "2022-01-01T00:00:00Z", "to": "2023-01-01T00:00:00Z"}},
+			{"id": "daily.masked", "annotation": "DataType AccountID DataType IPAddress",
+			 "active": {"from": "2023-06-01T00:00:00Z"}}
+		],
+		"flows": [
+			{"from": "raw.clicks", "to": "daily.joined"},
+			{"from": "raw.clicks", "to": "daily.masked",
+			 "active": {"from": "2023-07-01T00:00:00Z"}}
+		]
+	}`), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	at := func(s string) time.Time {
+		tm, _ := time.Parse(time.RFC3339, s)
+		return tm
+	}
+	cases := []struct {
+		at    string
+		nodes int
+		flows int
+		want  []string
+	}{
+		{"2022-06-01T00:00:00Z", 2, 1, []string{"daily.joined"}},
+		// the decommissioned pipeline generates no more findings
+		{"2023-03-01T00:00:00Z", 1, 0, []string{}},
+		{"2023-06-15T00:00:00Z", 2, 0, []string{"daily.masked"}},
+		{"2023-07-01T00:00:00Z", 2, 1, []string{"daily.masked"}},
+	}
+	for _, c := range cases {
+		sub := g.At(at(c.at))
+		if len(sub.Nodes) != c.nodes || len(sub.Flows) != c.flows {
+			t.Errorf("At(%s) = %q, %v", c.at, sub.NodeIDs(), sub.Flows)
+		}
+		got := make([]string, 0)
+		for _, v := range CheckGraphAt(p, g, at(c.at)) {
+			got = append(got, v.Node)
+		}
+		if !equals(got, c.want) {
+			t.Errorf("CheckGraphAt(%s) = %q, want %q", c.at, got, c.want)
+		}
+	}
+	vs := CheckGraphOver(p, g, Interval{at("2022-12-01T00:00:00Z"), at("2023-07-01T00:00:00Z")})
+	if len(vs) != 2 {
+		t.Errorf("CheckGraphOver() = %v", vs)
+	}
+}
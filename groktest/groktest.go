@@ -0,0 +1,174 @@
+// Package groktest is a golden-file test harness of policies: the decisions
+// and explanations of a policy on a corpus of annotations are compared with
+// golden files, so that semantic regressions show up as diffs in code review.
+//
+// Every subdirectory of a testdata directory is a case with its lattices, its
+// policy and its corpus:
+//
+//	testdata/no-joins/lattices.json     the lattice definitions (see grok.NewLattices)
+//	testdata/no-joins/policy.txt        the policy
+//	testdata/no-joins/annotations.txt   the annotations, one per line
+//	testdata/no-joins/decisions.golden  the expected output
+//
+// and a test runs the cases:
+//
+//	func TestPolicies(t *testing.T) {
+//		groktest.Run(t, "testdata")
+//	}
+//
+// Running the test with -groktest.update writes the golden files instead.
+package groktest
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+// Files of a case
+const (
+	LatticesFile    = "lattices.json"
+	PolicyFile      = "policy.txt"
+	AnnotationsFile = "annotations.txt"
+	GoldenFile      = "decisions.golden"
+)
+
+var update = flag.Bool("groktest.update", false, "write the golden files of groktest")
+
+// Run runs the cases of a testdata directory, as subtests named by the case
+func Run(t *testing.T, dir string) {
+	t.Helper()
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		t.Run(fi.Name(), func(t *testing.T) {
+			got, err := RunCase(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join(path, GoldenFile)
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%s (run with -groktest.update to write it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("decisions differ from %s:\n%s", golden, Diff(string(want), got))
+			}
+		})
+	}
+}
+
+// RunCase returns the output of the case of a directory
+func RunCase(dir string) (string, error) {
+	lb, err := ioutil.ReadFile(filepath.Join(dir, LatticesFile))
+	if err != nil {
+		return "", err
+	}
+	ls := grok.NewLattices(string(lb))
+	if len(ls) == 0 {
+		return "", errors.New(fmt.Sprintf("groktest: no lattice in %s", LatticesFile))
+	}
+	pb, err := ioutil.ReadFile(filepath.Join(dir, PolicyFile))
+	if err != nil {
+		return "", err
+	}
+	p := grok.NewPolicy(ls)
+	if err := p.ParsePolicy(string(pb)); err != nil {
+		return "", err
+	}
+	f, err := os.Open(filepath.Join(dir, AnnotationsFile))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Output(p, f)
+}
+
+// Output returns the decisions of the policy on the annotations of a corpus,
+// one per line, and their explanations. Blank lines and lines starting with #
+// are skipped. The output of an annotation is:
+//
+//	DataType IPAddress DataType AccountID
+//	  DENY by exception 1: Denied because the program uses ...
+func Output(p *grok.Policy, corpus io.Reader) (string, error) {
+	var b strings.Builder
+	s := bufio.NewScanner(corpus)
+	line := 0
+	for s.Scan() {
+		line++
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		an, err := p.ParseAnnotation(text)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("groktest: %s:%d: %s", AnnotationsFile, line, err))
+		}
+		e := p.Trace(an)
+		reason, err := new(grok.Renderer).Render(e)
+		if err != nil {
+			return "", err
+		}
+		decision := grok.EffectOf(e.Allowed)
+		if path := exceptionPath(e); path != "" {
+			decision += " by exception " + path
+		}
+		fmt.Fprintf(&b, "%s\n  %s: %s\n", an, decision, reason)
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// exceptionPath returns the path of the exception that decided an
+// explanation, e.g. 2.1, and is empty when no exception did
+func exceptionPath(e *grok.Explanation) string {
+	path := make([]string, 0)
+	for e.Decider >= 0 {
+		path = append(path, strconv.Itoa(e.Decider+1))
+		e = e.Excepts[e.Decider]
+	}
+	return strings.Join(path, ".")
+}
+
+// Diff returns the lines of want and got that differ, prefixed by - and +
+func Diff(want, got string) string {
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			fmt.Fprintf(&b, "line %d:\n- %s\n+ %s\n", i+1, w, g)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,26 @@
+package groktest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	Run(t, "testdata")
+}
+
+func TestOutputErrors(t *testing.T) {
+	if _, err := RunCase("testdata/missing"); err == nil {
+		t.Errorf("RunCase() of a missing case = nil error")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	got := Diff("a\nb\n", "a\nc\n")
+	if got != "line 2:\n- b\n+ c\n" {
+		t.Errorf("Diff() = %q", got)
+	}
+	if Diff("a", "a") != "" || !strings.Contains(Diff("a", "a\nb"), "+ b") {
+		t.Errorf("Diff() of equal or longer outputs")
+	}
+}
@@ -0,0 +1,397 @@
+// Package hcl decodes lattices and policies written in HCL, so that they're
+// managed as infrastructure as code, and validates configuration changes at
+// plan time against an organization baseline.
+//
+// A configuration is made of lattice and policy blocks:
+//
+//	lattice "DataType" {
+//	  edges = {
+//	    UniqueID = ["AccountID", "IPAddress"]
+//	    Location = ["IPAddress"]
+//	  }
+//	  weights = { AccountID = 3, IPAddress = 2 }
+//	  deprecated = { Location = "" }     # elements and their replacements
+//	}
+//
+//	lattice "Purpose" {
+//	  edges = { Analytics = [], Sharing = [] }
+//	}
+//
+//	policy "no-joins" {
+//	  lattices = ["DataType", "Purpose"] # all the lattices when omitted
+//	  numeric  = ["Epsilon"]
+//	  unknown  = "ignore"                # reject (default), ignore or flag
+//	  selector = "path:warehouse/sales"  # all the resources when omitted
+//	  constraints = ["Purpose Sharing REQUIRES DataType Location"]
+//	  derivations = ["IF DataType <= UniqueID THEN Purpose Analytics"]
+//	  rule = <<-EOT
+//	    ALLOW DataType TOP Purpose TOP
+//	    EXCEPT { DENY DataType IPAddress DataType AccountID }
+//	  EOT
+//	}
+//
+// where a lattice block takes the attributes of the JSON lattice definitions,
+// and a policy block takes the policy string as its rule. The decoder
+// supports the subset of the HCL syntax that configurations need: blocks,
+// attributes, strings without interpolation, heredocs, numbers, booleans,
+// lists, objects and comments.
+package hcl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/grongjun/grok"
+)
+
+// Config is a decoded configuration
+type Config struct {
+	// Lattices are in the order of their blocks
+	Lattices []*grok.Lattice
+	// Policies are in the order of their blocks
+	Policies []*Policy
+}
+
+// Policy is a named policy of a configuration
+type Policy struct {
+	Name string
+	// Lattices are the names of the lattices the policy is based on
+	Lattices []string
+	*grok.Policy
+}
+
+// Lattice returns the lattice of a name, and nil if there's none
+func (c *Config) Lattice(name string) *grok.Lattice {
+	for _, l := range c.Lattices {
+		if l.Name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+// Policy returns the policy of a name, and nil if there's none
+func (c *Config) Policy(name string) *Policy {
+	for _, p := range c.Policies {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// PolicySet returns the set of the policies of the configuration
+func (c *Config) PolicySet() *grok.PolicySet {
+	s := grok.NewPolicySet()
+	for _, p := range c.Policies {
+		s.Add(p.Policy)
+	}
+	return s
+}
+
+// DecodeFile decodes the configuration of a file
+func DecodeFile(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(string(b), path)
+}
+
+// Decode decodes a configuration, where filename locates errors
+func Decode(src, filename string) (*Config, error) {
+	b, err := parse(src, filename)
+	if err != nil {
+		return nil, err
+	}
+	errorf := func(line int, format string, args ...interface{}) error {
+		return errors.New(fmt.Sprintf("hcl: %s:%d: %s", filename, line, fmt.Sprintf(format, args...)))
+	}
+	if names := b.names(); len(names) > 0 {
+		return nil, errorf(b.attrs[names[0]].line, "unexpected attribute %s", names[0])
+	}
+
+	c := NewConfig()
+	for _, blk := range b.blocks {
+		if blk.typ != "lattice" && blk.typ != "policy" {
+			return nil, errorf(blk.line, "unexpected block %s", blk.typ)
+		}
+		if len(blk.labels) != 1 || blk.labels[0] == "" {
+			return nil, errorf(blk.line, "a %s block should have one name label", blk.typ)
+		}
+		if len(blk.body.blocks) > 0 {
+			return nil, errorf(blk.body.blocks[0].line, "unexpected block %s", blk.body.blocks[0].typ)
+		}
+		if blk.typ == "lattice" {
+			if err := c.AddLattice(blk.labels[0], blk.body.values()); err != nil {
+				return nil, errorf(blk.line, "%s", err)
+			}
+		}
+	}
+
+	// policies are decoded once all the lattices are, whatever the order of the blocks
+	for _, blk := range b.blocks {
+		if blk.typ != "policy" {
+			continue
+		}
+		if err := c.AddPolicy(blk.labels[0], blk.body.values()); err != nil {
+			return nil, errorf(blk.line, "%s", err)
+		}
+	}
+	return c, nil
+}
+
+// NewConfig returns an empty configuration, for other configuration languages
+// to build with AddLattice and AddPolicy
+func NewConfig() *Config {
+	return &Config{Lattices: make([]*grok.Lattice, 0), Policies: make([]*Policy, 0)}
+}
+
+// AddLattice adds a lattice whose definition has the attributes of a lattice
+// block, decoded to strings, float64s, []interface{} and map[string]interface{}
+func (c *Config) AddLattice(name string, def map[string]interface{}) error {
+	if c.Lattice(name) != nil {
+		return errors.New(fmt.Sprintf("duplicate lattice %s", name))
+	}
+	l, err := decodeLattice(name, def)
+	if err != nil {
+		return errors.New(fmt.Sprintf("lattice %s: %s", name, err))
+	}
+	c.Lattices = append(c.Lattices, l)
+	return nil
+}
+
+// AddPolicy adds a policy whose definition has the attributes of a policy
+// block, based on lattices added before
+func (c *Config) AddPolicy(name string, def map[string]interface{}) error {
+	if c.Policy(name) != nil {
+		return errors.New(fmt.Sprintf("duplicate policy %s", name))
+	}
+	p, err := c.decodePolicy(name, def)
+	if err != nil {
+		return errors.New(fmt.Sprintf("policy %s: %s", name, err))
+	}
+	c.Policies = append(c.Policies, p)
+	return nil
+}
+
+// decodeLattice decodes the definition of a lattice
+func decodeLattice(name string, def map[string]interface{}) (*grok.Lattice, error) {
+	js := map[string]interface{}{"name": name}
+	for _, attr := range sortedKeys(def) {
+		v := def[attr]
+		var ok bool
+		switch attr {
+		case "edges":
+			ok = isObjectOf(v, func(v interface{}) bool {
+				return isListOf(v, isString)
+			})
+		case "weights":
+			ok = isObjectOf(v, isNumber)
+		case "labels":
+			ok = isObjectOf(v, func(v interface{}) bool {
+				return isObjectOf(v, isString)
+			})
+		case "deprecated":
+			ok = isObjectOf(v, isString)
+		default:
+			return nil, errors.New(fmt.Sprintf("unexpected attribute %s", attr))
+		}
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("invalid %s", attr))
+		}
+		js[attr] = v
+	}
+	if _, ok := js["edges"]; !ok {
+		return nil, errors.New("edges are required")
+	}
+	b, err := json.Marshal(js)
+	if err != nil {
+		return nil, err
+	}
+	return grok.NewLatticeE(string(b))
+}
+
+// decodePolicy decodes the definition of a policy
+func (c *Config) decodePolicy(name string, def map[string]interface{}) (*Policy, error) {
+	names := make([]string, 0)
+	numerics := make([]string, 0)
+	constraints := make([]string, 0)
+	derivations := make([]string, 0)
+	unknown := grok.RejectUnknown
+	var rule, selector string
+	for _, attr := range sortedKeys(def) {
+		v := def[attr]
+		var ok bool
+		switch attr {
+		case "rule":
+			rule, ok = v.(string)
+		case "lattices":
+			names, ok = stringList(v)
+		case "numeric":
+			numerics, ok = stringList(v)
+		case "constraints":
+			constraints, ok = stringList(v)
+		case "derivations":
+			derivations, ok = stringList(v)
+		case "selector":
+			selector, ok = v.(string)
+		case "unknown":
+			var s string
+			s, ok = v.(string)
+			if u, found := unknownAttributes[s]; found {
+				unknown = u
+			} else {
+				ok = false
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("unexpected attribute %s", attr))
+		}
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("invalid %s", attr))
+		}
+	}
+	if rule == "" {
+		return nil, errors.New("rule is required")
+	}
+
+	if _, ok := def["lattices"]; !ok {
+		for _, l := range c.Lattices {
+			names = append(names, l.Name)
+		}
+	}
+	ls := make([]*grok.Lattice, 0, len(names))
+	for _, n := range names {
+		l := c.Lattice(n)
+		if l == nil {
+			return nil, errors.New(fmt.Sprintf("undefined lattice %s", n))
+		}
+		ls = append(ls, l)
+	}
+	if len(ls) == 0 {
+		return nil, errors.New("no lattice")
+	}
+	p := grok.NewPolicy(ls)
+	p.ID = name
+	p.Unknown = unknown
+	if selector != "" {
+		s, err := grok.ParseSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		p.Selector = s
+	}
+	for _, n := range numerics {
+		if err := p.DefineNumeric(n); err != nil {
+			return nil, err
+		}
+	}
+	for _, str := range constraints {
+		ct, err := p.ParseConstraint(str)
+		if err != nil {
+			return nil, err
+		}
+		p.Constraints = append(p.Constraints, ct)
+	}
+	for _, str := range derivations {
+		r, err := p.ParseDerivation(str)
+		if err != nil {
+			return nil, err
+		}
+		p.Derivations = append(p.Derivations, r)
+	}
+	if err := p.ParsePolicy(rule); err != nil {
+		return nil, err
+	}
+	return &Policy{Name: name, Lattices: names, Policy: p}, nil
+}
+
+// unknownAttributes maps the values of the unknown attribute of policies
+var unknownAttributes = map[string]grok.UnknownAttributes{
+	"reject": grok.RejectUnknown,
+	"ignore": grok.IgnoreUnknown,
+	"flag":   grok.FlagUnknown,
+}
+
+func isString(v interface{}) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+func isNumber(v interface{}) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+// isListOf returns true when v is a list whose elements are valid
+func isListOf(v interface{}, valid func(interface{}) bool) bool {
+	l, ok := v.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, e := range l {
+		if !valid(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// isObjectOf returns true when v is an object whose values are valid
+func isObjectOf(v interface{}, valid func(interface{}) bool) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, e := range m {
+		if !valid(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// stringList returns the strings of a list of strings
+func stringList(v interface{}) ([]string, bool) {
+	if !isListOf(v, isString) {
+		return nil, false
+	}
+	l := v.([]interface{})
+	ss := make([]string, 0, len(l))
+	for _, s := range l {
+		ss = append(ss, s.(string))
+	}
+	return ss, true
+}
+
+// names returns the sorted names of the attributes of a body
+func (b *body) names() []string {
+	names := make([]string, 0, len(b.attrs))
+	for n := range b.attrs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// values returns the values of the attributes of a body
+func (b *body) values() map[string]interface{} {
+	vs := make(map[string]interface{}, len(b.attrs))
+	for n, v := range b.attrs {
+		vs[n] = v.v
+	}
+	return vs
+}
+
+// sortedKeys returns the sorted keys of a map
+func sortedKeys(m map[string]interface{}) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
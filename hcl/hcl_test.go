@@ -0,0 +1,142 @@
+package hcl
+
+import (
+	"strings"
+	"testing"
+)
+
+const config = `
+# lattices
+lattice "DataType" {
+  edges = {
+    UniqueID = ["AccountID", "IPAddress"]
+    Location = ["IPAddress"]
+  }
+  weights = { AccountID = 3, "IPAddress": 2 }
+  labels  = { de = { IPAddress = "IP-Adresse" } }
+}
+
+lattice "Purpose" {
+  edges = { Analytics = [], Sharing = [] } // flat
+}
+
+/* policies */
+policy "no-joins" {
+  rule = <<-EOT
+    ALLOW DataType TOP Purpose TOP
+    EXCEPT { DENY DataType IPAddress DataType AccountID }
+  EOT
+}
+
+policy "epsilon" {
+  lattices = ["DataType"]
+  numeric  = ["Epsilon"]
+  unknown  = "ignore"
+  rule     = "ALLOW DataType TOP Epsilon <=1.0"
+}
+`
+
+func TestDecode(t *testing.T) {
+	c, err := Decode(config, "config.hcl")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if len(c.Lattices) != 2 || len(c.Policies) != 2 {
+		t.Fatalf("Decode() = %d lattices, %d policies", len(c.Lattices), len(c.Policies))
+	}
+	dt := c.Lattice("DataType")
+	if dt == nil || dt.Weights["AccountID"] != 3 || dt.Weights["IPAddress"] != 2 || dt.Labels["de"]["IPAddress"] != "IP-Adresse" {
+		t.Errorf("Lattice(DataType) = %v", dt)
+	}
+	if dt.Meet("UniqueID", "Location") != "IPAddress" {
+		t.Errorf("Meet(UniqueID, Location) = %s", dt.Meet("UniqueID", "Location"))
+	}
+
+	p := c.Policy("no-joins")
+	if strings.Join(p.Lattices, ",") != "DataType,Purpose" {
+		t.Errorf("no-joins lattices = %v", p.Lattices)
+	}
+	if p.ID != "no-joins" {
+		t.Errorf("no-joins ID = %q", p.ID)
+	}
+	for _, test := range []struct {
+		annotation string
+		allowed    bool
+	}{
+		{"DataType IPAddress Purpose Analytics", true},
+		{"DataType IPAddress DataType AccountID Purpose Analytics", false},
+	} {
+		an, err := p.ParseAnnotation(test.annotation)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if p.ApplyOn(an) != test.allowed {
+			t.Errorf("no-joins ApplyOn(%s) = %t", test.annotation, !test.allowed)
+		}
+	}
+	e := c.Policy("epsilon")
+	an, err := e.ParseAnnotation("DataType IPAddress Epsilon 0.5 Region EU")
+	if err != nil || !e.ApplyOn(an) {
+		t.Errorf("epsilon ApplyOn() = %t, %q", e.ApplyOn(an), err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		src, err string
+	}{
+		{`lattice "A" { edges = { X = [] }`, "config.hcl:1: unclosed block"},
+		{`lattice "A" {` + "\n" + ` edges = { X = "Y" }` + "\n}", "config.hcl:1: lattice A: invalid edges"},
+		{`lattice "A" { edge = {} }`, "lattice A: unexpected attribute edge"},
+		{`lattice "A" { edges = {} }` + "\n" + `lattice "A" { edges = {} }`, "config.hcl:2: duplicate lattice A"},
+		{`lattice { edges = {} }`, "should have one name label"},
+		{`policy "p" { rule = "ALLOW X TOP" }`, "policy p: no lattice"},
+		{`policy "p" { lattices = ["A"]` + "\n" + `rule = "ALLOW A TOP" }`, "policy p: undefined lattice A"},
+		{`lattice "A" { edges = {} }` + "\n" + `policy "p" { unknown = "drop" }`, "policy p: invalid unknown"},
+		{`lattice "A" { edges = { X = [] } }` + "\n" + `policy "p" { rule = "ALLOW A Y" }`, "policy p:"},
+		{`lattice "A" { edges = { X = ["${var.y}"] } }`, "template sequences are not supported"},
+		{`lattice "A" { edges = {} weights = {} }`, "expected a newline"},
+		{`version = 1`, "unexpected attribute version"},
+		{`module "m" {}`, "unexpected block module"},
+	}
+	for _, test := range tests {
+		_, err := Decode(test.src, "config.hcl")
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Decode(%q) = %v, want %q", test.src, err, test.err)
+		}
+	}
+}
+
+func TestHeredoc(t *testing.T) {
+	b, err := parse("a = <<EOT\n  x\n    y\nEOT\nb = <<-EOT\n  x\n    y\n  EOT\n", "f")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := b.attrs["a"].v; got != "  x\n    y\n" {
+		t.Errorf("a = %q", got)
+	}
+	if got := b.attrs["b"].v; got != "x\n  y\n" {
+		t.Errorf("b = %q", got)
+	}
+}
+
+func TestDecodeSelector(t *testing.T) {
+	c, err := Decode(baseline+`
+policy "sales" {
+  selector = "path:warehouse/sales"
+  rule = "ALLOW DataType TOP"
+}`, "config.hcl")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if s := c.Policy("sales").Selector; s == nil || s.String() != "path:warehouse/sales" {
+		t.Errorf("sales selector = %v", s)
+	}
+	if _, err := Decode(baseline+`
+policy "sales" {
+  selector = "tag:"
+  rule = "ALLOW DataType TOP"
+}`, "config.hcl"); err == nil {
+		t.Errorf("Decode() with an invalid selector = nil error")
+	}
+}
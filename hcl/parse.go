@@ -0,0 +1,383 @@
+package hcl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// body is the content of a file or of a block: attributes and nested blocks
+type body struct {
+	attrs  map[string]value
+	blocks []*block
+}
+
+// block is a block, e.g. lattice "DataType" { ... }
+type block struct {
+	typ    string
+	labels []string
+	body   *body
+	line   int
+}
+
+// value is an attribute value: a string, a float64, a bool, a []interface{}
+// or a map[string]interface{}, with the line where it starts
+type value struct {
+	v    interface{}
+	line int
+}
+
+// parser parses the subset of the HCL native syntax that configurations need:
+// attributes, blocks, strings (without interpolation), heredocs, numbers,
+// booleans, tuples and objects, and comments
+type parser struct {
+	src      []rune
+	pos      int
+	line     int
+	filename string
+}
+
+// parse parses the source of a file
+func parse(src, filename string) (*body, error) {
+	p := &parser{src: []rune(src), line: 1, filename: filename}
+	b, err := p.body(false)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return errors.New(fmt.Sprintf("hcl: %s:%d: %s", p.filename, p.line, fmt.Sprintf(format, args...)))
+}
+
+// body parses attributes and blocks up to the end of the source, or up to the
+// closing brace of a block when nested
+func (p *parser) body(nested bool) (*body, error) {
+	b := &body{attrs: make(map[string]value)}
+	for {
+		p.space(true)
+		if p.pos >= len(p.src) {
+			if nested {
+				return nil, p.errorf("unclosed block")
+			}
+			return b, nil
+		}
+		if p.src[p.pos] == '}' {
+			if !nested {
+				return nil, p.errorf("unexpected }")
+			}
+			p.pos++
+			return b, nil
+		}
+		line := p.line
+		name := p.ident()
+		if name == "" {
+			return nil, p.errorf("unexpected %q", p.src[p.pos])
+		}
+		p.space(false)
+		if p.peek() == '=' {
+			p.pos++
+			if _, ok := b.attrs[name]; ok {
+				return nil, p.errorf("duplicate attribute %s", name)
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			b.attrs[name] = value{v, line}
+			if err := p.endOfLine(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		blk := &block{typ: name, line: line}
+		for p.peek() != '{' {
+			switch {
+			case p.peek() == '"':
+				s, err := p.str()
+				if err != nil {
+					return nil, err
+				}
+				blk.labels = append(blk.labels, s)
+			default:
+				label := p.ident()
+				if label == "" {
+					return nil, p.errorf("expected = or { after %s", name)
+				}
+				blk.labels = append(blk.labels, label)
+			}
+			p.space(false)
+		}
+		p.pos++
+		nb, err := p.body(true)
+		if err != nil {
+			return nil, err
+		}
+		blk.body = nb
+		b.blocks = append(b.blocks, blk)
+	}
+}
+
+// value parses an expression
+func (p *parser) value() (interface{}, error) {
+	p.space(false)
+	switch c := p.peek(); {
+	case c == '"':
+		return p.str()
+	case c == '<' && p.at(1) == '<':
+		return p.heredoc()
+	case c == '[':
+		p.pos++
+		list := make([]interface{}, 0)
+		for {
+			p.space(true)
+			if p.peek() == ']' {
+				p.pos++
+				return list, nil
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			p.space(true)
+			if p.peek() == ',' {
+				p.pos++
+			} else if p.peek() != ']' {
+				return nil, p.errorf("expected , or ]")
+			}
+		}
+	case c == '{':
+		p.pos++
+		obj := make(map[string]interface{})
+		for {
+			p.space(true)
+			if p.peek() == '}' {
+				p.pos++
+				return obj, nil
+			}
+			var key string
+			if p.peek() == '"' {
+				s, err := p.str()
+				if err != nil {
+					return nil, err
+				}
+				key = s
+			} else if key = p.ident(); key == "" {
+				return nil, p.errorf("expected an object key")
+			}
+			p.space(false)
+			if c := p.peek(); c != '=' && c != ':' {
+				return nil, p.errorf("expected = after %s", key)
+			}
+			p.pos++
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = v
+			p.space(false)
+			if p.peek() == ',' {
+				p.pos++
+			}
+		}
+	case c == '-' || unicode.IsDigit(c):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.ContainsRune("0123456789.eE+-", p.src[p.pos]) {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(string(p.src[start:p.pos]), 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", string(p.src[start:p.pos]))
+		}
+		return f, nil
+	default:
+		switch id := p.ident(); id {
+		case "true", "false":
+			return id == "true", nil
+		case "":
+			if p.pos >= len(p.src) {
+				return nil, p.errorf("unexpected end of file")
+			}
+			return nil, p.errorf("unexpected %q", c)
+		default:
+			return nil, p.errorf("unsupported expression %s", id)
+		}
+	}
+}
+
+// str parses a quoted string
+func (p *parser) str() (string, error) {
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case '$', '%':
+			if p.peek() == '{' {
+				return "", p.errorf("template sequences are not supported")
+			}
+			sb.WriteRune(c)
+		case '\\':
+			if p.pos >= len(p.src) {
+				return "", p.errorf("unterminated string")
+			}
+			e := p.src[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			case '"', '\\':
+				sb.WriteRune(e)
+			default:
+				return "", p.errorf("invalid escape \\%c", e)
+			}
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// heredoc parses a heredoc string, <<EOT or <<-EOT (which strips the common
+// indentation of the lines)
+func (p *parser) heredoc() (string, error) {
+	p.pos += 2
+	indented := p.peek() == '-'
+	if indented {
+		p.pos++
+	}
+	marker := p.ident()
+	if marker == "" {
+		return "", p.errorf("expected a heredoc marker")
+	}
+	p.space(false)
+	if p.peek() != '\n' {
+		return "", p.errorf("expected a newline after <<%s", marker)
+	}
+	p.pos++
+	p.line++
+	lines := make([]string, 0)
+	for p.pos < len(p.src) {
+		end := p.pos
+		for end < len(p.src) && p.src[end] != '\n' {
+			end++
+		}
+		l := string(p.src[p.pos:end])
+		p.pos = end
+		if strings.TrimSpace(l) == marker {
+			return joinHeredoc(lines, indented), nil
+		}
+		lines = append(lines, l)
+		if p.pos < len(p.src) {
+			p.pos++
+			p.line++
+		}
+	}
+	return "", p.errorf("unterminated heredoc %s", marker)
+}
+
+// joinHeredoc joins the lines of a heredoc, stripping their common indentation
+// when indented
+func joinHeredoc(lines []string, indented bool) string {
+	if indented {
+		indent := -1
+		for _, l := range lines {
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			n := len(l) - len(strings.TrimLeft(l, " \t"))
+			if indent < 0 || n < indent {
+				indent = n
+			}
+		}
+		for i, l := range lines {
+			if len(l) >= indent && indent > 0 {
+				lines[i] = l[indent:]
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ident parses an identifier, and returns "" if there's none
+func (p *parser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if !(unicode.IsLetter(c) || c == '_' || (p.pos > start && (unicode.IsDigit(c) || c == '-'))) {
+			break
+		}
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+// space skips spaces and comments, and newlines too when newlines is true
+func (p *parser) space(newlines bool) {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\n' && newlines:
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#' || (c == '/' && p.at(1) == '/'):
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '/' && p.at(1) == '*':
+			p.pos += 2
+			for p.pos < len(p.src) && !(p.src[p.pos] == '*' && p.at(1) == '/') {
+				if p.src[p.pos] == '\n' {
+					p.line++
+				}
+				p.pos++
+			}
+			p.pos += 2
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine checks that an attribute is followed by a newline, a closing
+// brace or the end of the file
+func (p *parser) endOfLine() error {
+	p.space(false)
+	switch p.peek() {
+	case '\n', '}', 0:
+		return nil
+	}
+	return p.errorf("expected a newline after the attribute")
+}
+
+// peek returns the current rune, or 0 at the end of the source
+func (p *parser) peek() rune {
+	return p.at(0)
+}
+
+// at returns the rune at offset i of the current one, or 0 past the end
+func (p *parser) at(i int) rune {
+	if p.pos+i >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos+i]
+}
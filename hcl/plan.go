@@ -0,0 +1,166 @@
+package hcl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// MaxExamples is the maximum number of example annotations of a Finding
+const MaxExamples = 5
+
+// Level is the level of a Finding: errors block a change, warnings don't
+type Level string
+
+const (
+	Error   Level = "error"
+	Warning Level = "warning"
+)
+
+// Finding is an issue of a configuration found at plan time
+type Finding struct {
+	Level Level
+	// Policy (or Lattice) is the subject of the finding, if any
+	Policy  string
+	Lattice string
+	Message string
+	// Examples are annotations illustrating the finding, at most MaxExamples
+	Examples []grok.Annotation
+}
+
+func (f Finding) String() string {
+	var sb strings.Builder
+	sb.WriteString(string(f.Level))
+	switch {
+	case f.Policy != "":
+		sb.WriteString(": policy " + f.Policy)
+	case f.Lattice != "":
+		sb.WriteString(": lattice " + f.Lattice)
+	}
+	sb.WriteString(": " + f.Message)
+	for _, an := range f.Examples {
+		sb.WriteString(fmt.Sprintf("\n\te.g. %s", an))
+	}
+	return sb.String()
+}
+
+// Plan validates a configuration before it's applied: it lints it, and checks
+// that it entails the baseline when baseline isn't nil. Errors come first.
+func Plan(c, baseline *Config) []Finding {
+	fs := Lint(c)
+	if baseline != nil {
+		fs = append(fs, Entails(c, baseline)...)
+	}
+	sort.SliceStable(fs, func(i, j int) bool {
+		return fs[i].Level == Error && fs[j].Level != Error
+	})
+	return fs
+}
+
+// Lint returns the warnings of a configuration: lattices that no policy is
+// based on, lattices without elements, policies in monitor mode, which aren't
+// enforced, exceptions nested too deep or that never apply, and deprecated
+// elements that policies still use (see grok.Policy.Validate)
+func Lint(c *Config) []Finding {
+	fs := make([]Finding, 0)
+	used := make(map[string]bool)
+	for _, p := range c.Policies {
+		for _, n := range p.Lattices {
+			used[n] = true
+		}
+		if p.Monitor {
+			fs = append(fs, Finding{Level: Warning, Policy: p.Name, Message: "is in monitor mode, and isn't enforced"})
+		}
+		for _, err := range p.Validate() {
+			fs = append(fs, Finding{Level: Warning, Policy: p.Name, Message: strings.TrimPrefix(err.Error(), "policy: ")})
+		}
+	}
+	for _, l := range c.Lattices {
+		if !used[l.Name] {
+			fs = append(fs, Finding{Level: Warning, Lattice: l.Name, Message: "isn't used by any policy"})
+		}
+		if len(elements(l)) == 0 {
+			fs = append(fs, Finding{Level: Warning, Lattice: l.Name, Message: "has no elements"})
+		}
+	}
+	return fs
+}
+
+// Entails checks that a configuration entails the baseline, i.e. that its
+// policies together allow nothing that the baseline denies, so that a change
+// can tighten the baseline but not loosen it. Allowing an annotation that the
+// baseline denies is an error, and removing a baseline policy is a warning.
+//
+// Entailment is checked on the annotations of at most two elements of the
+// lattices of the baseline, which covers the policies denying single elements
+// and pairs of them. Annotations with elements that the configuration doesn't
+// define anymore can't be parsed, and are skipped.
+func Entails(c, baseline *Config) []Finding {
+	fs := make([]Finding, 0)
+	for _, bp := range baseline.Policies {
+		if c.Policy(bp.Name) == nil {
+			fs = append(fs, Finding{Level: Warning, Policy: bp.Name, Message: "is removed from the baseline"})
+		}
+	}
+	if len(baseline.Lattices) == 0 || len(c.Lattices) == 0 {
+		return fs
+	}
+
+	// candidates are parsed by policies based on all the lattices, which
+	// ignore the attributes they don't know
+	cp, bp := grok.NewPolicy(c.Lattices), grok.NewPolicy(baseline.Lattices)
+	cp.Unknown, bp.Unknown = grok.IgnoreUnknown, grok.IgnoreUnknown
+	cs, bs := c.PolicySet(), baseline.PolicySet()
+	f := Finding{Level: Error, Message: "allows annotations that the baseline denies"}
+	n := 0
+	for _, cand := range candidates(baseline) {
+		ban, err := bp.ParseAnnotationPart(cand)
+		if err != nil || bs.ApplyOn(ban) {
+			continue
+		}
+		an, err := cp.ParseAnnotationPart(cand)
+		if err != nil || !cs.ApplyOn(an) {
+			continue
+		}
+		if n++; len(f.Examples) < MaxExamples {
+			f.Examples = append(f.Examples, an)
+		}
+	}
+	if n > 0 {
+		f.Message = fmt.Sprintf("allows %d annotations that the baseline denies", n)
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// candidates returns the annotations of one and two elements of the lattices
+// of a configuration, in the policy syntax
+func candidates(c *Config) []string {
+	values := make([]string, 0)
+	for _, l := range c.Lattices {
+		for _, e := range elements(l) {
+			values = append(values, l.Name+" "+e)
+		}
+	}
+	cands := make([]string, 0, len(values)*(len(values)+1)/2)
+	for i, v := range values {
+		cands = append(cands, v)
+		for _, w := range values[i+1:] {
+			cands = append(cands, v+" "+w)
+		}
+	}
+	return cands
+}
+
+// elements returns the elements of a lattice, except TOP and BOTTOM
+func elements(l *grok.Lattice) []string {
+	es := make([]string, 0)
+	for _, e := range l.Elements() {
+		if e != grok.Top && e != grok.Bottom {
+			es = append(es, e)
+		}
+	}
+	return es
+}
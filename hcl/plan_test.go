@@ -0,0 +1,101 @@
+package hcl
+
+import (
+	"strings"
+	"testing"
+)
+
+const baseline = `
+lattice "DataType" {
+  edges = {
+    UniqueID = ["AccountID", "IPAddress"]
+    Location = ["IPAddress"]
+  }
+}
+
+lattice "Purpose" {
+  edges = { Analytics = [], Sharing = [] }
+}
+
+policy "no-joins" {
+  rule = "ALLOW DataType TOP Purpose TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"
+}
+`
+
+func decode(t *testing.T, src string) *Config {
+	c, err := Decode(src, "config.hcl")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	return c
+}
+
+func TestFindingString(t *testing.T) {
+	fs := Plan(decode(t, strings.Replace(baseline, "EXCEPT { DENY DataType IPAddress DataType AccountID }", "", 1)), decode(t, baseline))
+	if len(fs) != 1 || len(fs[0].Examples) != MaxExamples {
+		t.Fatalf("Plan() = %v", fs)
+	}
+	if got := strings.Split(fs[0].String(), "\n")[1]; got != "\te.g. DataType AccountID DataType IPAddress" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	base := decode(t, baseline)
+	tests := []struct {
+		name, config string
+		findings     []string
+	}{
+		{"unchanged", baseline, []string{}},
+		{"tightened", baseline + `
+policy "no-sharing" {
+  rule = "ALLOW DataType TOP Purpose Analytics"
+}`, []string{}},
+		{"loosened", strings.Replace(baseline, "EXCEPT { DENY DataType IPAddress DataType AccountID }", "", 1),
+			[]string{"error: allows 11 annotations that the baseline denies"}},
+		{"removed", strings.Replace(baseline, `policy "no-joins"`, `policy "renamed"`, 1),
+			[]string{"warning: policy no-joins: is removed from the baseline"}},
+		{"lint", strings.Replace(baseline, "rule", "lattices = [\"DataType\", \"Purpose\"]\n  rule", 1) + `
+lattice "Region" {
+  edges = {}
+}
+policy "trial" {
+  lattices = ["DataType"]
+  rule = "DENY MODE=monitor DataType UniqueID"
+}`, []string{
+			"warning: policy trial: is in monitor mode, and isn't enforced",
+			"warning: lattice Region: isn't used by any policy",
+			"warning: lattice Region: has no elements",
+		}},
+		{"disjoint exception", baseline + `
+policy "no-locations" {
+  rule = "ALLOW DataType Location EXCEPT { DENY DataType AccountID }"
+}`, []string{
+			"warning: policy no-locations: exception 1 (DENY DataType AccountID) doesn't overlap its parent clause on DataType, and never applies",
+		}},
+		{"constraint", baseline + `
+policy "sharing" {
+  constraints = ["Purpose Sharing REQUIRES DataType Location"]
+  rule = "ALLOW DataType TOP Purpose TOP EXCEPT { DENY DataType AccountID Purpose Sharing }"
+}`, []string{
+			"warning: policy sharing: exception 1 (DENY DataType AccountID Purpose Sharing) violates a constraint: Purpose Sharing is only meaningful with DataType below Location",
+		}},
+		{"deprecated element", strings.Replace(baseline, "Location = [\"IPAddress\"]\n  }", "Location = [\"IPAddress\"]\n  }\n  deprecated = { Location = \"\" }", 1) + `
+policy "locations" {
+  rule = "ALLOW DataType Location Purpose TOP"
+}`, []string{
+			"warning: policy locations: DataType Location is deprecated",
+		}},
+	}
+	for _, test := range tests {
+		fs := Plan(decode(t, test.config), base)
+		got := make([]string, 0, len(fs))
+		for _, f := range fs {
+			// the first line, without the examples
+			got = append(got, strings.Split(f.String(), "\n")[0])
+		}
+		if strings.Join(got, "\n") != strings.Join(test.findings, "\n") {
+			t.Errorf("%s: Plan() = %q, want %q", test.name, got, test.findings)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package grok
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BundleVersion is a version of a bundle of policies, which is active from
+// its activation time until the activation of the next version
+type BundleVersion struct {
+	Version string
+	Active  time.Time
+	Set     *PolicySet
+}
+
+// HistoricalDecision is the decision of the bundle version active at a time
+type HistoricalDecision struct {
+	Allowed bool
+	// Version is the version of the bundle that decided
+	Version string
+	// Denying are the IDs of the policies that deny the annotation
+	Denying []string
+}
+
+// BundleHistory stores the versions of a bundle, so that decisions can be
+// evaluated as of a past time, e.g. to tell whether a flow was compliant when
+// it happened during an incident review. The policies of a version carry the
+// lattices they were based on: a version must not be modified once it's
+// added, and reloaded lattices must be new lattices rather than modified
+// ones. It is safe for concurrent use.
+type BundleHistory struct {
+	mu sync.RWMutex
+	// versions are sorted by activation time
+	versions []BundleVersion
+}
+
+// NewBundleHistory returns an empty BundleHistory
+func NewBundleHistory() *BundleHistory {
+	return &BundleHistory{versions: make([]BundleVersion, 0)}
+}
+
+// Add adds a version of the bundle that is active from a time
+func (h *BundleHistory) Add(version string, active time.Time, s *PolicySet) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, v := range h.versions {
+		if v.Version == version {
+			return errors.New(fmt.Sprintf("policy: bundle version %s already exists", version))
+		}
+		if v.Active.Equal(active) {
+			return errors.New(fmt.Sprintf("policy: bundle version %s is already active at %s", v.Version, active.Format(time.RFC3339)))
+		}
+	}
+	i := sort.Search(len(h.versions), func(i int) bool {
+		return h.versions[i].Active.After(active)
+	})
+	h.versions = append(h.versions, BundleVersion{})
+	copy(h.versions[i+1:], h.versions[i:])
+	h.versions[i] = BundleVersion{Version: version, Active: active, Set: s}
+	return nil
+}
+
+// Versions returns the versions of the bundle, by activation time
+func (h *BundleHistory) Versions() []BundleVersion {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]BundleVersion(nil), h.versions...)
+}
+
+// AsOf returns the version of the bundle active at a time
+func (h *BundleHistory) AsOf(t time.Time) (BundleVersion, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	i := sort.Search(len(h.versions), func(i int) bool {
+		return h.versions[i].Active.After(t)
+	})
+	if i == 0 {
+		return BundleVersion{}, errors.New(fmt.Sprintf("policy: no bundle version is active at %s", t.Format(time.RFC3339)))
+	}
+	return h.versions[i-1], nil
+}
+
+// EvaluateAsOf applies the policies of the version active at a time on an
+// annotation. The annotation is allowed when every policy allows it.
+func (h *BundleHistory) EvaluateAsOf(t time.Time, an Annotation) (HistoricalDecision, error) {
+	v, err := h.AsOf(t)
+	if err != nil {
+		return HistoricalDecision{}, err
+	}
+	d := HistoricalDecision{Version: v.Version, Denying: v.Set.DenyingIDs(an)}
+	d.Allowed = len(d.Denying) == 0
+	return d, nil
+}
+
+// history is a BundleHistory in JSON, whose policies are snapshots
+type history struct {
+	Versions []versionSnapshot `json:"versions"`
+}
+
+type versionSnapshot struct {
+	Version  string            `json:"version"`
+	Active   time.Time         `json:"active"`
+	Policies []json.RawMessage `json:"policies"`
+}
+
+// WriteHistory writes the versions of the bundle to w, with the snapshots of
+// their policies (see WriteSnapshot)
+func (h *BundleHistory) WriteHistory(w io.Writer) error {
+	hs := history{Versions: make([]versionSnapshot, 0)}
+	for _, v := range h.Versions() {
+		vs := versionSnapshot{Version: v.Version, Active: v.Active, Policies: make([]json.RawMessage, 0)}
+		for _, p := range v.Set.policies() {
+			var buf bytes.Buffer
+			if err := p.WriteSnapshot(&buf); err != nil {
+				return err
+			}
+			vs.Policies = append(vs.Policies, json.RawMessage(bytes.TrimSpace(buf.Bytes())))
+		}
+		hs.Versions = append(hs.Versions, vs)
+	}
+	return json.NewEncoder(w).Encode(&hs)
+}
+
+// ReadHistory reads the versions of a bundle written by WriteHistory
+func ReadHistory(r io.Reader) (*BundleHistory, error) {
+	var hs history
+	if err := json.NewDecoder(r).Decode(&hs); err != nil {
+		return nil, err
+	}
+	h := NewBundleHistory()
+	for _, vs := range hs.Versions {
+		s := NewPolicySet()
+		for _, raw := range vs.Policies {
+			p, err := ReadSnapshot(bytes.NewReader(raw))
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("policy: bundle version %s: %s", vs.Version, err))
+			}
+			s.Add(p)
+		}
+		if err := h.Add(vs.Version, vs.Active, s); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,68 @@
+package grok
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestBundleHistory(t *testing.T) {
+	named := func(id, pstr string) *Policy {
+		p := newScopedPolicy(t, pstr)
+		p.ID = id
+		return p
+	}
+	jan := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	h := NewBundleHistory()
+	// versions can be added in any order
+	if err := h.Add("2.0.0", feb, NewPolicySet(named("no-joins", "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"),
+		named("no-accounts", "DENY DataType AccountID"))); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := h.Add("1.0.0", jan, NewPolicySet(named("no-joins", "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"))); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := h.Add("1.0.0", feb.AddDate(0, 1, 0), NewPolicySet()); err == nil {
+		t.Errorf("Add() of an existing version = nil error")
+	}
+
+	an, err := newScopedPolicy(t, "ALLOW DataType TOP").ParseAnnotation("DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	var buf bytes.Buffer
+	if err := h.WriteHistory(&buf); err != nil {
+		t.Fatalf("%q", err)
+	}
+	read, err := ReadHistory(&buf)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	cases := []struct {
+		t       time.Time
+		version string
+		allowed bool
+	}{
+		{jan, "1.0.0", true},
+		{jan.AddDate(0, 0, 14), "1.0.0", true},
+		{feb.Add(-time.Second), "1.0.0", true},
+		{feb, "2.0.0", false},
+		{feb.AddDate(1, 0, 0), "2.0.0", false},
+	}
+	for _, bh := range []*BundleHistory{h, read} {
+		for _, c := range cases {
+			d, err := bh.EvaluateAsOf(c.t, an)
+			if err != nil {
+				t.Fatalf("%q", err)
+			}
+			if d.Version != c.version || d.Allowed != c.allowed || (!d.Allowed && (len(d.Denying) != 1 || d.Denying[0] != "no-accounts")) {
+				t.Errorf("EvaluateAsOf(%s) = %+v, want %t by %s", c.t, d, c.allowed, c.version)
+			}
+		}
+		if _, err := bh.EvaluateAsOf(jan.Add(-time.Second), an); err == nil {
+			t.Errorf("EvaluateAsOf() before the first version = nil error")
+		}
+	}
+}
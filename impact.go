@@ -0,0 +1,202 @@
+package grok
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MaxImpactExamples is the maximum number of example annotations of an Impact
+const MaxImpactExamples = 5
+
+// LatticeDiff is the difference between two versions of a lattice
+type LatticeDiff struct {
+	Old, New *Lattice
+	// Added and Removed are the elements only in the new and old version
+	Added, Removed []string
+	// Moved are the elements of both versions whose parents changed, except BOTTOM
+	Moved []string
+	// AddedEdges and RemovedEdges are the edges only in the new and old version
+	AddedEdges, RemovedEdges []Edge
+}
+
+// DiffLattices returns the difference between two versions of a lattice
+func DiffLattices(old, new *Lattice) LatticeDiff {
+	d := LatticeDiff{Old: old, New: new}
+	oes, nes := old.Elements(), new.Elements()
+	for _, e := range nes {
+		if !contains(oes, e) {
+			d.Added = append(d.Added, e)
+		}
+	}
+	for _, e := range oes {
+		if !contains(nes, e) {
+			d.Removed = append(d.Removed, e)
+		} else if e != Top && e != Bottom && !equalSets(old.parentsOf([]string{e}), new.parentsOf([]string{e})) {
+			d.Moved = append(d.Moved, e)
+		}
+	}
+	for _, e := range new.Edges {
+		if !hasEdge(old.Edges, e) {
+			d.AddedEdges = append(d.AddedEdges, e)
+		}
+	}
+	for _, e := range old.Edges {
+		if !hasEdge(new.Edges, e) {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+		}
+	}
+	return d
+}
+
+// Empty returns true when both versions have the same edges
+func (d LatticeDiff) Empty() bool {
+	return len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0
+}
+
+// Impact is a policy whose decisions could change with a lattice change
+type Impact struct {
+	Policy *Policy
+	// Index is the index of the policy in the input policies
+	Index int
+	// Reasons explain the impact, e.g. references to removed elements
+	Reasons []string
+	// Examples are annotations whose decision changes, at most MaxImpactExamples
+	Examples []Annotation
+}
+
+// ImpactOfLatticeChange lists the policies whose decisions could change with a
+// lattice change, with example annotations whose decision changes. Candidate
+// annotations are the single elements kept in both versions, and the moved
+// elements combined with every other kept element.
+func ImpactOfLatticeChange(diff LatticeDiff, ps []*Policy) []Impact {
+	impacts := make([]Impact, 0)
+	if diff.Empty() {
+		return impacts
+	}
+	name := diff.Old.Name
+	kept := make([]string, 0)
+	for _, e := range diff.Old.Elements() {
+		if !contains(diff.Removed, e) {
+			kept = append(kept, e)
+		}
+	}
+	candidates := make([]Annotation, 0)
+	for _, e := range kept {
+		candidates = append(candidates, Annotation{{name: name, value: e}})
+	}
+	for _, m := range diff.Moved {
+		for _, e := range kept {
+			if e != m && e != Top && e != Bottom {
+				candidates = append(candidates, Annotation{{name: name, value: m}, {name: name, value: e}})
+			}
+		}
+	}
+
+	for i, p := range ps {
+		if _, ok := p.baseOn[name]; !ok {
+			continue
+		}
+		im := Impact{Policy: p, Index: i}
+		for _, e := range diff.Removed {
+			if p.references(name, e) {
+				im.Reasons = append(im.Reasons, fmt.Sprintf("references removed element %s", e))
+			}
+		}
+		if len(im.Reasons) == 0 {
+			// policies referencing removed elements can't be evaluated with the new version
+			old, new := p.withLattice(diff.Old), p.withLattice(diff.New)
+			for _, an := range candidates {
+				if old.ApplyOn(an) != new.ApplyOn(an) {
+					if len(im.Examples) < MaxImpactExamples {
+						im.Examples = append(im.Examples, an)
+					}
+				}
+			}
+			if len(im.Examples) > 0 {
+				im.Reasons = append(im.Reasons, "decisions change")
+			}
+		}
+		if len(im.Reasons) > 0 {
+			impacts = append(impacts, im)
+		}
+	}
+	return impacts
+}
+
+// references returns true when the policy or its exceptions refer to element e of lattice name
+func (p *Policy) references(name, e string) bool {
+	for _, pa := range p.Clause {
+		if pa.name != name {
+			continue
+		}
+		if l := p.baseOn[name]; l.isProductValue(pa.value) {
+			fst, _ := l.halve(pa.value)
+			if baseOf(fst) == e {
+				return true
+			}
+		} else if baseOf(pa.value) == e {
+			return true
+		}
+	}
+	for i := range p.Excepts {
+		if p.Excepts[i].references(name, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// withLattice returns a copy of the policy where the lattice of the same name
+// is replaced by l
+func (p *Policy) withLattice(l *Lattice) *Policy {
+	baseOn := make(map[string]*Lattice)
+	for name, b := range p.baseOn {
+		baseOn[name] = b
+	}
+	if old, ok := baseOn[l.Name]; ok && old.state() != nil && l.state() == nil {
+		// keep the product of the replaced lattice
+		l = l.clone()
+		l.Product(old.state())
+	}
+	baseOn[l.Name] = l
+	return p.rebind(baseOn)
+}
+
+// rebind returns a copy of the policy and its exceptions based on other lattices
+func (p *Policy) rebind(baseOn map[string]*Lattice) *Policy {
+	cp := *p
+	cp.baseOn = baseOn
+	cp.Clause = append(Clause(nil), p.Clause...)
+	cp.Excepts = make([]Policy, len(p.Excepts))
+	for i := range p.Excepts {
+		cp.Excepts[i] = *p.Excepts[i].rebind(baseOn)
+	}
+	return &cp
+}
+
+// hasEdge returns true when edges contains e
+func hasEdge(edges []Edge, e Edge) bool {
+	for _, f := range edges {
+		if f == e {
+			return true
+		}
+	}
+	return false
+}
+
+// equalSets returns true when a and b have the same elements
+func equalSets(a, b []string) bool {
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestDiffLattices(t *testing.T) {
+	old := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	new := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID"], "Location": ["IPAddress", "ZipCode"] } }`)
+	d := DiffLattices(old, new)
+	if !equals(d.Added, []string{"ZipCode"}) || len(d.Removed) != 0 {
+		t.Errorf("Added = %q, Removed = %q", d.Added, d.Removed)
+	}
+	if !equals(d.Moved, []string{"IPAddress"}) {
+		t.Errorf("Moved = %q", d.Moved)
+	}
+	if d.Empty() || !DiffLattices(old, old).Empty() {
+		t.Errorf("Empty() is wrong")
+	}
+}
+
+func TestImpactOfLatticeChange(t *testing.T) {
+	old := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"], "Birthday": [] } }`)
+	// IPAddress is no longer a UniqueID, and Birthday is removed
+	new := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID"], "Location": ["IPAddress"] } }`)
+
+	pstrs := []string{
+		"ALLOW DataType UniqueID",
+		"DENY DataType Location",
+		"ALLOW DataType TOP EXCEPT { DENY DataType Birthday }",
+	}
+	ps := make([]*Policy, 0)
+	for _, pstr := range pstrs {
+		p := NewPolicy([]*Lattice{old})
+		if err := p.ParsePolicy(pstr); err != nil {
+			t.Fatalf("%q", err)
+		}
+		ps = append(ps, p)
+	}
+
+	impacts := ImpactOfLatticeChange(DiffLattices(old, new), ps)
+	// the second policy is impacted since UniqueID and Location no longer overlap
+	if len(impacts) != 3 {
+		t.Fatalf("len(impacts) = %d, want 3: %+v", len(impacts), impacts)
+	}
+	if impacts[0].Index != 0 || len(impacts[0].Examples) == 0 {
+		t.Errorf("impacts[0] = %+v", impacts[0])
+	}
+	if got := impacts[0].Examples[0]; got.ValuesOf("DataType")[0] != "IPAddress" {
+		t.Errorf("impacts[0].Examples[0] = %q", got)
+	}
+	if impacts[1].Index != 1 || impacts[1].Examples[0].ValuesOf("DataType")[0] != "UniqueID" {
+		t.Errorf("impacts[1] = %+v", impacts[1])
+	}
+	if impacts[2].Index != 2 || impacts[2].Reasons[0] != "references removed element Birthday" {
+		t.Errorf("impacts[2] = %+v", impacts[2])
+	}
+	// the policies themselves are unchanged
+	an := Annotation{{name: "DataType", value: "IPAddress"}}
+	if !ps[0].ApplyOn(an) {
+		t.Errorf("ImpactOfLatticeChange changed the policy lattices")
+	}
+}
@@ -0,0 +1,168 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// MaxImpliesAnnotations is the maximum number of annotations that Implies
+// decides the policies on
+const MaxImpliesAnnotations = 1 << 20
+
+// Implies returns true when the policy is at least as restrictive as another
+// over their shared attributes, i.e. when the other policy allows every
+// annotation that the policy allows, e.g. to verify that a team-level policy
+// refines the org-level policy. The lattices of the same name must be the
+// same in both policies.
+//
+// The clauses and the exceptions of both policies split the values of every
+// shared attribute: the elements of the lattices, the values of the clauses,
+// and the numbers around the thresholds of the numeric predicates. Implies
+// decides the policies on every annotation with at most one of these values
+// per attribute, like ApplyOn does. The policies decide the annotations with
+// several values of an attribute as they decide every value, or their join
+// for the attributes of JoinValues, so that no other annotation is needed.
+// The attributes of a single policy are left out of the annotations.
+func (p *Policy) Implies(other *Policy) (bool, error) {
+	attrs, candidates, err := p.impliedValues(other)
+	if err != nil {
+		return false, err
+	}
+	n := 1
+	for _, cs := range candidates {
+		if n *= len(cs); n > MaxImpliesAnnotations {
+			return false, errors.New(fmt.Sprintf("policy: comparing the policies takes more than %d annotations", MaxImpliesAnnotations))
+		}
+	}
+
+	// every combination of the candidates, absent values included
+	idx := make([]int, len(attrs))
+	for {
+		an := make(Annotation, 0, len(attrs))
+		for i, attr := range attrs {
+			if v := candidates[i][idx[i]]; v != "" {
+				an = append(an, pair{name: attr, value: v})
+			}
+		}
+		if p.ApplyOn(an) && !other.ApplyOn(an) {
+			return false, nil
+		}
+		i := 0
+		for ; i < len(idx); i++ {
+			if idx[i]++; idx[i] < len(candidates[i]) {
+				break
+			}
+			idx[i] = 0
+		}
+		if i == len(idx) {
+			return true, nil
+		}
+	}
+}
+
+// impliedValues returns the sorted shared attributes of two policies, and
+// their candidate values, where the empty value is the absent one
+func (p *Policy) impliedValues(other *Policy) ([]string, [][]string, error) {
+	attrs := make([]string, 0)
+	for _, name := range p.latticeNames() {
+		l, ol := p.baseOn[name], other.baseOn[name]
+		if ol == nil {
+			continue
+		}
+		if l != ol && (!DiffLattices(l, ol).Empty() || (l.state() == nil) != (ol.state() == nil) ||
+			l.state() != nil && !DiffLattices(l.state(), ol.state()).Empty()) {
+			return nil, nil, errors.New(fmt.Sprintf("policy: lattice %s differs between the policies", name))
+		}
+		attrs = append(attrs, name)
+	}
+	for _, name := range p.numericNames() {
+		if other.isNumeric(name) {
+			attrs = append(attrs, name)
+		}
+	}
+	sort.Strings(attrs)
+	if len(attrs) == 0 {
+		return nil, nil, errors.New("policy: the policies share no attribute")
+	}
+
+	// the values of the clauses of both policies, by attribute
+	clauseValues := make(map[string][]string)
+	var collect func(q *Policy)
+	collect = func(q *Policy) {
+		for _, pa := range q.Clause {
+			_, members, ok := parseValueSet(pa.value)
+			if !ok {
+				members = []string{pa.value}
+			}
+			for _, m := range members {
+				if !contains(clauseValues[pa.name], m) {
+					clauseValues[pa.name] = append(clauseValues[pa.name], m)
+				}
+			}
+		}
+		for i := range q.Excepts {
+			collect(&q.Excepts[i])
+		}
+	}
+	collect(p)
+	collect(other)
+
+	candidates := make([][]string, 0, len(attrs))
+	for _, attr := range attrs {
+		cs := []string{""}
+		if l := p.baseOn[attr]; l != nil {
+			es := l.Elements()
+			if s := l.state(); s != nil {
+				for _, e := range l.Elements() {
+					for _, st := range s.Elements() {
+						es = append(es, e+ProductSeparator+st)
+					}
+				}
+			}
+			for _, v := range clauseValues[attr] {
+				if !contains(es, v) {
+					es = append(es, v)
+				}
+			}
+			cs = append(cs, es...)
+		} else {
+			cs = append(cs, numericCandidates(clauseValues[attr])...)
+		}
+		candidates = append(candidates, cs)
+	}
+	return attrs, candidates, nil
+}
+
+// numericCandidates returns numbers satisfying every combination of numeric
+// predicates that some number satisfies: the thresholds, the numbers between
+// them, and the numbers beyond them
+func numericCandidates(preds []string) []string {
+	ts := make([]float64, 0, len(preds))
+	for _, pred := range preds {
+		if _, t, err := parsePredicate(pred); err == nil {
+			ts = append(ts, t)
+		}
+	}
+	if len(ts) == 0 {
+		return []string{"0"}
+	}
+	sort.Float64s(ts)
+	ns := []float64{ts[0] - 1}
+	for i, t := range ts {
+		if i > 0 && t == ts[i-1] {
+			continue
+		}
+		if i > 0 {
+			ns = append(ns, (ts[i-1]+t)/2)
+		}
+		ns = append(ns, t)
+	}
+	ns = append(ns, ts[len(ts)-1]+1)
+	cs := make([]string, 0, len(ns))
+	for _, n := range ns {
+		cs = append(cs, strconv.FormatFloat(n, 'g', -1, 64))
+	}
+	return cs
+}
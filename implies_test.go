@@ -0,0 +1,64 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestImplies(t *testing.T) {
+	org := newBudgetPolicy(t, "ALLOW DataType TOP Epsilon <=1 EXCEPT { DENY DataType AccountID }")
+	for _, test := range []struct {
+		pstr    string
+		implies bool
+	}{
+		{"ALLOW DataType TOP Epsilon <=1 EXCEPT { DENY DataType AccountID }", true},
+		{"ALLOW DataType TOP Epsilon <=0.5 EXCEPT { DENY DataType UniqueID }", true},
+		{"ALLOW DataType TOP Epsilon <1 EXCEPT { DENY DataType AccountID DENY DataType Location }", true},
+		{"ALLOW DataType TOP Epsilon <=2 EXCEPT { DENY DataType AccountID }", false},
+		{"ALLOW DataType TOP Epsilon <=1 EXCEPT { DENY DataType IPAddress }", false},
+		// the nested exception allows AccountID back
+		{"ALLOW DataType TOP Epsilon <=1 EXCEPT { DENY DataType UniqueID EXCEPT { ALLOW DataType AccountID } }", false},
+		// the nested exception allows back the annotations without DataType, which the DENY matches
+		{"ALLOW DataType TOP Epsilon <=1 EXCEPT { DENY DataType UniqueID EXCEPT { ALLOW DataType IPAddress } }", false},
+		// annotations without DataType are denied by the org policy only
+		{"ALLOW DataType Location Epsilon <=1", false},
+		{"ALLOW DataType Location Epsilon <=1 EXCEPT { DENY DataType BOTTOM }", true},
+	} {
+		team := newBudgetPolicy(t, test.pstr)
+		if got, err := team.Implies(org); err != nil || got != test.implies {
+			t.Errorf("Implies(%s) = %t, %v, want %t", test.pstr, got, err, test.implies)
+		}
+	}
+
+	// the org policy doesn't refine a stricter one
+	if got, err := org.Implies(newBudgetPolicy(t, "ALLOW DataType TOP Epsilon <=0.5 EXCEPT { DENY DataType UniqueID }")); err != nil || got {
+		t.Errorf("Implies() = %t, %v, want false", got, err)
+	}
+
+	other := NewPolicy([]*Lattice{NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID"] } }`)})
+	if err := other.ParsePolicy("ALLOW DataType TOP"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if _, err := org.Implies(other); err == nil || err.Error() != "policy: lattice DataType differs between the policies" {
+		t.Errorf("Implies() with another lattice = %v", err)
+	}
+	other = NewPolicy([]*Lattice{NewLattice(`{ "name": "Purpose", "edges": { "Analytics": [] } }`)})
+	if err := other.ParsePolicy("ALLOW Purpose TOP"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if _, err := org.Implies(other); err == nil || err.Error() != "policy: the policies share no attribute" {
+		t.Errorf("Implies() without shared attribute = %v", err)
+	}
+}
+
+func TestNumericCandidates(t *testing.T) {
+	for _, test := range []struct {
+		preds, want []string
+	}{
+		{[]string{}, []string{"0"}},
+		{[]string{"<=1", ">0", "1"}, []string{"-1", "0", "0.5", "1", "2"}},
+	} {
+		if got := numericCandidates(test.preds); !equals(got, test.want) {
+			t.Errorf("numericCandidates(%v) = %v, want %v", test.preds, got, test.want)
+		}
+	}
+}
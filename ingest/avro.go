@@ -0,0 +1,226 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/grongjun/grok"
+)
+
+// LabelProperty is the property (Avro) or the metadata key (Parquet) carrying
+// grok annotations, in the policy syntax. See ReadAvroSchema and ReadParquet.
+const LabelProperty = "grok"
+
+// ReadAvroSchema reads the annotations of a dataset from an Avro schema, and
+// adds them to the store. The "grok" property of the top-level record labels
+// the dataset, and the "grok" property of a field labels the column of the
+// field, where the columns of nested records are dotted paths:
+//
+//	{
+//	 "type": "record", "name": "Click", "grok": "Purpose Analytics",
+//	 "fields": [
+//	     {"name": "ip", "type": "string", "grok": "DataType IPAddress"},
+//	     {"name": "user", "type": {"type": "record", "name": "User", "fields": [
+//	         {"name": "id", "type": "long", "grok": "DataType AccountID"}
+//	     ]}}
+//	 ]
+//	}
+//
+// labels the columns ip and user.id. The annotation of the dataset must
+// conform to the schema of the policy, if any.
+func ReadAvroSchema(r io.Reader, dataset string, p *grok.Policy, s *Store) error {
+	var schema interface{}
+	if err := json.NewDecoder(r).Decode(&schema); err != nil {
+		return err
+	}
+	return addAvroSchema(schema, dataset, p, s)
+}
+
+// ReadAvroFile reads the annotations of a dataset from the schema in the
+// header of an Avro object container file, like ReadAvroSchema
+func ReadAvroFile(r io.Reader, dataset string, p *grok.Policy, s *Store) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return err
+	}
+	if string(magic) != "Obj\x01" {
+		return errors.New("ingest: not an Avro object container file")
+	}
+	meta, err := readAvroMap(br)
+	if err != nil {
+		return err
+	}
+	text, ok := meta["avro.schema"]
+	if !ok {
+		return errors.New("ingest: the Avro file has no schema")
+	}
+	var schema interface{}
+	if err := json.Unmarshal(text, &schema); err != nil {
+		return err
+	}
+	return addAvroSchema(schema, dataset, p, s)
+}
+
+// addAvroSchema adds the labels of a parsed Avro schema to the store
+func addAvroSchema(schema interface{}, dataset string, p *grok.Policy, s *Store) error {
+	rec, ok := schema.(map[string]interface{})
+	if !ok || rec["type"] != "record" {
+		return errors.New("ingest: the Avro schema should be a record")
+	}
+	t := NewStore()
+	if err := addLabels(t, p, dataset, "", rec[LabelProperty]); err != nil {
+		return err
+	}
+	if err := addAvroFields(rec, "", dataset, p, t); err != nil {
+		return err
+	}
+	if err := checkSchema(t, p, dataset); err != nil {
+		return err
+	}
+	s.merge(t)
+	return nil
+}
+
+// addAvroFields adds the labels of the fields of a record, recursively
+func addAvroFields(rec map[string]interface{}, prefix, dataset string, p *grok.Policy, s *Store) error {
+	fields, _ := rec["fields"].([]interface{})
+	for _, f := range fields {
+		field, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := field["name"].(string)
+		column := prefix + name
+		if err := addLabels(s, p, dataset, column, field[LabelProperty]); err != nil {
+			return err
+		}
+		for _, nested := range avroRecords(field["type"]) {
+			if err := addLabels(s, p, dataset, column, nested[LabelProperty]); err != nil {
+				return err
+			}
+			if err := addAvroFields(nested, column+".", dataset, p, s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// avroRecords returns the records of a field type, looking into unions,
+// arrays and maps
+func avroRecords(t interface{}) []map[string]interface{} {
+	recs := make([]map[string]interface{}, 0)
+	switch t := t.(type) {
+	case []interface{}:
+		for _, u := range t {
+			recs = append(recs, avroRecords(u)...)
+		}
+	case map[string]interface{}:
+		switch t["type"] {
+		case "record":
+			recs = append(recs, t)
+		case "array":
+			recs = append(recs, avroRecords(t["items"])...)
+		case "map":
+			recs = append(recs, avroRecords(t["values"])...)
+		}
+	}
+	return recs
+}
+
+// readAvroMap reads an Avro map of bytes, e.g. the metadata of a container file
+func readAvroMap(r *bufio.Reader) (map[string][]byte, error) {
+	m := make(map[string][]byte)
+	for {
+		n, err := readAvroLong(r)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return m, nil
+		}
+		if n < 0 {
+			// a negative count is followed by the size of the block
+			n = -n
+			if _, err := readAvroLong(r); err != nil {
+				return nil, err
+			}
+		}
+		for i := int64(0); i < n; i++ {
+			k, err := readAvroBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			v, err := readAvroBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			m[string(k)] = v
+		}
+	}
+}
+
+// readAvroLong reads a zig-zag encoded variable-length long
+func readAvroLong(r *bufio.Reader) (int64, error) {
+	var u uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		u |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return int64(u>>1) ^ -int64(u&1), nil
+		}
+	}
+	return 0, errors.New("ingest: invalid Avro long")
+}
+
+// readAvroBytes reads length-prefixed bytes
+func readAvroBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := readAvroLong(r)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > maxMetadataSize {
+		return nil, errors.New(fmt.Sprintf("ingest: invalid Avro length %d", n))
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+// maxMetadataSize is the maximum size of file metadata
+const maxMetadataSize = 1 << 24
+
+// addLabels adds the labels of a property, if it's a string, to the store
+func addLabels(s *Store, p *grok.Policy, dataset, column string, prop interface{}) error {
+	str, ok := prop.(string)
+	if !ok {
+		return nil
+	}
+	an, err := p.ParseAnnotationPart(str)
+	if err != nil {
+		if column != "" {
+			return errors.New(fmt.Sprintf("ingest: %s.%s: %s", dataset, column, err))
+		}
+		return errors.New(fmt.Sprintf("ingest: %s: %s", dataset, err))
+	}
+	s.Add(dataset, column, an)
+	return nil
+}
+
+// checkSchema checks the annotation of a dataset against the schema of the policy
+func checkSchema(s *Store, p *grok.Policy, dataset string) error {
+	if p.Schema == nil {
+		return nil
+	}
+	if err := p.Schema.Validate(s.Annotation(dataset)); err != nil {
+		return errors.New(fmt.Sprintf("ingest: %s: %s", dataset, err))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package ingest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+const avroSchema = `{
+	"type": "record", "name": "Click", "grok": "Purpose Analytics",
+	"fields": [
+		{"name": "ip", "type": "string", "grok": "DataType IPAddress"},
+		{"name": "user", "type": ["null", {"type": "record", "name": "User", "fields": [
+			{"name": "id", "type": "long", "grok": "DataType AccountID"},
+			{"name": "name", "type": "string"}
+		]}]}
+	]
+}`
+
+func TestReadAvroSchema(t *testing.T) {
+	p := policy(t)
+	s := NewStore()
+	if err := ReadAvroSchema(strings.NewReader(avroSchema), "raw.clicks", p, s); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := strings.Join(s.Columns("raw.clicks"), ","); got != "ip,user.id" {
+		t.Errorf("Columns() = %q", got)
+	}
+	if got := s.Annotation("raw.clicks").String(); got != "Purpose Analytics DataType IPAddress DataType AccountID" {
+		t.Errorf("Annotation(raw.clicks) = %q", got)
+	}
+}
+
+// avroLong encodes a zig-zag variable-length long
+func avroLong(n int64) []byte {
+	u := uint64((n << 1) ^ (n >> 63))
+	b := make([]byte, 0)
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
+
+// avroFile returns the header of an Avro object container file with metadata
+func avroFile(meta map[string]string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("Obj\x01")
+	buf.Write(avroLong(int64(len(meta))))
+	for k, v := range meta {
+		buf.Write(avroLong(int64(len(k))))
+		buf.WriteString(k)
+		buf.Write(avroLong(int64(len(v))))
+		buf.WriteString(v)
+	}
+	buf.Write(avroLong(0))
+	buf.WriteString("0123456789abcdef") // sync marker
+	return buf.Bytes()
+}
+
+func TestReadAvroFile(t *testing.T) {
+	p := policy(t)
+	s := NewStore()
+	f := avroFile(map[string]string{"avro.codec": "null", "avro.schema": avroSchema})
+	if err := ReadAvroFile(bytes.NewReader(f), "raw.clicks", p, s); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if an, ok := s.Column("raw.clicks", "user.id"); !ok || an.String() != "DataType AccountID" {
+		t.Errorf("Column(raw.clicks, user.id) = %q, %t", an, ok)
+	}
+}
+
+func TestReadAvroErrors(t *testing.T) {
+	schema, err := grok.NewAnnotationSchema(`{"attributes": {"Purpose": {"required": true}}}`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	tests := []struct {
+		schema string
+		file   []byte
+		strict bool // whether the policy has the schema
+	}{
+		{`{"type": "record", "name": "A", "fields": [{"name": "ip", "type": "string", "grok": "DataType City"}]}`, nil, false},
+		{`{"type": "record", "name": "A", "fields": [{"name": "ip", "type": "string", "grok": "DataType IPAddress"}]}`, nil, true},
+		{`{"type": "string"}`, nil, false},
+		{"", []byte("PAR1"), false},
+		{"", avroFile(map[string]string{"avro.codec": "null"}), false},
+	}
+	for i, test := range tests {
+		p := policy(t)
+		if test.strict {
+			p.Schema = schema
+		}
+		s := NewStore()
+		if test.file != nil {
+			err = ReadAvroFile(bytes.NewReader(test.file), "raw.clicks", p, s)
+		} else {
+			err = ReadAvroSchema(strings.NewReader(test.schema), "raw.clicks", p, s)
+		}
+		if err == nil {
+			t.Errorf("%d: no error", i)
+		}
+		if len(s.Datasets()) != 0 {
+			t.Errorf("%d: the store should be unchanged", i)
+		}
+	}
+}
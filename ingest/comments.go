@@ -0,0 +1,445 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/graph"
+)
+
+// CommentLabel starts the comments carrying grok annotations in SQL files
+// (-- grok: ...) and in pipeline YAML (# grok: ...), see ReadSQL and
+// ReadPipelineYAML
+const CommentLabel = LabelProperty + ":"
+
+// ReadSQL derives the flows of the statements of a SQL file, from the tables
+// they read to the table they create or write, adds them to a graph, and adds
+// the annotations of their grok comments to the store:
+//
+//	-- grok: Purpose Analytics
+//	CREATE TABLE daily.clicks AS
+//	SELECT ip, user_id -- grok: DataType IPAddress DataType AccountID
+//	FROM raw.clicks JOIN raw.accounts USING (user_id);
+//
+// A comment labels the table of the statement it's in or precedes, i.e. the
+// table of CREATE TABLE, CREATE VIEW, INSERT INTO or MERGE INTO. The tables
+// read are the ones of FROM, JOIN and USING clauses, except the names of
+// common table expressions. The error is an Errors when comments are invalid.
+func ReadSQL(r io.Reader, p *grok.Policy, g *graph.DataFlowGraph, s *Store) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var errs Errors
+	for _, st := range splitSQL(string(b)) {
+		target, sources := sqlLineage(st.code)
+		if target == "" {
+			for _, l := range st.labels {
+				errs = append(errs, &Error{Line: l.line, Err: errors.New("the grok comment annotates no table")})
+			}
+			continue
+		}
+		if g.Node(target) == nil {
+			g.AddNode(target, grok.Annotation{})
+		}
+		for _, src := range sources {
+			g.AddFlow(src, target)
+		}
+		for _, l := range st.labels {
+			if err := addComment(s, p, target, l.text); err != nil {
+				errs = append(errs, &Error{Line: l.line, Dataset: target, Err: err})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ReadPipelineYAML derives the flows of the jobs of a pipeline in YAML, from
+// their inputs to the job and from the job to its outputs, adds them to a
+// graph, and adds the annotations of their grok comments to the store:
+//
+//	jobs:
+//	  - name: daily-join   # grok: Purpose Analytics
+//	    inputs: [raw.clicks, raw.accounts]
+//	    outputs:
+//	      # grok: DataType IPAddress
+//	      - daily.joined
+//
+// A comment labels the job or the dataset of its line, or of the next job or
+// dataset when it's on a line of its own. Jobs are the items with a name key
+// at any depth, and their datasets the items of their inputs and outputs
+// keys. The error is an Errors when comments are invalid.
+func ReadPipelineYAML(r io.Reader, p *grok.Policy, g *graph.DataFlowGraph, s *Store) error {
+	var errs Errors
+	var job, list string
+	listIndent := 0
+	pending := make([]comment, 0)
+	label := func(node string, cs []comment) {
+		for _, c := range cs {
+			if err := addComment(s, p, node, c.text); err != nil {
+				errs = append(errs, &Error{Line: c.line, Dataset: node, Err: err})
+			}
+		}
+	}
+	// dataset adds a dataset of the current list, and returns false when
+	// there's no job
+	dataset := func(name string) bool {
+		if job == "" {
+			return false
+		}
+		if list == "inputs" {
+			g.AddFlow(name, job)
+		} else {
+			g.AddFlow(job, name)
+		}
+		return true
+	}
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		code, text, ok := splitYAMLComment(sc.Text())
+		var cs []comment
+		if ok {
+			cs = []comment{{n, text}}
+		}
+		if strings.TrimSpace(code) == "" {
+			pending = append(pending, cs...)
+			continue
+		}
+		indent := len(code) - len(strings.TrimLeft(code, " "))
+		content := strings.TrimSpace(code)
+		item := content == "-" || strings.HasPrefix(content, "- ")
+		if item {
+			content = strings.TrimSpace(content[1:])
+		}
+		cs = append(pending, cs...)
+		pending = make([]comment, 0)
+
+		key, value, isKey := splitYAMLKey(content)
+		switch {
+		case list != "" && item && !isKey && indent >= listIndent:
+			name := unquoteYAML(content)
+			if !dataset(name) {
+				errs = append(errs, &Error{Line: n, Dataset: name, Err: errors.New("the dataset has no job")})
+				continue
+			}
+			label(name, cs)
+			continue
+		case isKey && key == "name":
+			job, list = unquoteYAML(value), ""
+			if g.Node(job) == nil {
+				g.AddNode(job, grok.Annotation{})
+			}
+			label(job, cs)
+			continue
+		case isKey && (key == "inputs" || key == "outputs"):
+			list, listIndent = key, indent
+			if !strings.HasPrefix(value, "[") {
+				break
+			}
+			names := strings.Split(strings.Trim(value, "[]"), ",")
+			for _, name := range names {
+				if name = unquoteYAML(strings.TrimSpace(name)); name != "" && !dataset(name) {
+					errs = append(errs, &Error{Line: n, Dataset: name, Err: errors.New("the dataset has no job")})
+				}
+			}
+			list = ""
+			if len(cs) > 0 && len(names) == 1 && job != "" {
+				label(unquoteYAML(strings.TrimSpace(names[0])), cs)
+				continue
+			}
+		default:
+			if indent <= listIndent {
+				list = ""
+			}
+		}
+		for _, c := range cs {
+			errs = append(errs, &Error{Line: c.line, Err: errors.New("the grok comment annotates no job or dataset")})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	for _, c := range pending {
+		errs = append(errs, &Error{Line: c.line, Err: errors.New("the grok comment annotates no job or dataset")})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Unannotated returns the sorted nodes of a graph that neither the graph nor
+// the store annotates, i.e. the datasets and jobs left to label
+func (s *Store) Unannotated(g *graph.DataFlowGraph) []string {
+	ids := make([]string, 0)
+	for _, id := range g.NodeIDs() {
+		if len(g.Nodes[id].Annotation) == 0 && len(s.Annotation(id)) == 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// comment is a grok comment, by the text after CommentLabel
+type comment struct {
+	line int
+	text string
+}
+
+// addComment adds the annotation of a grok comment to a dataset
+func addComment(s *Store, p *grok.Policy, dataset, text string) error {
+	an, err := p.ParseAnnotationPart(text)
+	if err != nil {
+		return err
+	}
+	s.Add(dataset, "", an)
+	return nil
+}
+
+// sqlStatement is a statement of a SQL file, without its comments and with
+// empty string literals, and the grok comments in it or before it
+type sqlStatement struct {
+	code   string
+	labels []comment
+}
+
+// splitSQL splits a SQL file into its statements. The comments after the
+// last statement are in a statement without code.
+func splitSQL(src string) []sqlStatement {
+	sts := make([]sqlStatement, 0)
+	var code strings.Builder
+	labels := make([]comment, 0)
+	line := 1
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			code.WriteByte(c)
+		case c == '-' && strings.HasPrefix(src[i:], "--"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			if text := strings.TrimSpace(src[i+2 : i+end]); strings.HasPrefix(text, CommentLabel) {
+				labels = append(labels, comment{line, strings.TrimSpace(text[len(CommentLabel):])})
+			}
+			i += end - 1
+		case c == '/' && strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			code.WriteByte(' ')
+			i += end + 3
+		case c == '\'':
+			// string literals are emptied, so that their words aren't tables
+			j := i + 1
+			for ; j < len(src); j++ {
+				if src[j] == '\'' && (j+1 >= len(src) || src[j+1] != '\'') {
+					break
+				} else if src[j] == '\'' {
+					j++
+				}
+			}
+			if j > len(src) {
+				j = len(src)
+			}
+			line += strings.Count(src[i:j], "\n")
+			code.WriteString("''")
+			i = j
+		case c == ';':
+			sts = append(sts, sqlStatement{code.String(), labels})
+			code.Reset()
+			labels = make([]comment, 0)
+		default:
+			code.WriteByte(c)
+		}
+	}
+	if strings.TrimSpace(code.String()) != "" || len(labels) > 0 {
+		sts = append(sts, sqlStatement{code.String(), labels})
+	}
+	return sts
+}
+
+// sqlModifiers are the words between CREATE and TABLE or VIEW
+var sqlModifiers = map[string]bool{"OR": true, "REPLACE": true, "TEMP": true, "TEMPORARY": true,
+	"MATERIALIZED": true, "EXTERNAL": true, "TRANSIENT": true, "UNLOGGED": true}
+
+// sqlKeywords are the words that end the list of the tables of a FROM clause
+var sqlKeywords = map[string]bool{"WHERE": true, "GROUP": true, "ORDER": true, "HAVING": true, "LIMIT": true,
+	"JOIN": true, "LEFT": true, "RIGHT": true, "INNER": true, "OUTER": true, "FULL": true, "CROSS": true,
+	"NATURAL": true, "ON": true, "USING": true, "UNION": true, "EXCEPT": true, "INTERSECT": true,
+	"SELECT": true, "WHEN": true, "WINDOW": true, "AS": true, "SET": true, "VALUES": true}
+
+// sqlFunctions are the functions whose arguments have a FROM
+var sqlFunctions = map[string]bool{"EXTRACT": true, "SUBSTRING": true, "TRIM": true, "OVERLAY": true, "POSITION": true}
+
+// sqlLineage returns the table that a statement creates or writes, if any,
+// and the tables it reads
+func sqlLineage(code string) (string, []string) {
+	for _, punct := range []string{"(", ")", ","} {
+		code = strings.Replace(code, punct, " "+punct+" ", -1)
+	}
+	ts := strings.Fields(code)
+	word := func(i int) string {
+		if i < len(ts) {
+			return strings.ToUpper(ts[i])
+		}
+		return ""
+	}
+
+	// the names of common table expressions, i.e. the names before AS (
+	ctes := make(map[string]bool)
+	for i := 0; i+2 < len(ts); i++ {
+		if word(i+1) == "AS" && ts[i+2] == "(" {
+			ctes[tableName(ts[i])] = true
+		}
+	}
+
+	target := ""
+	for i := 0; i < len(ts) && target == ""; i++ {
+		j := i + 1
+		switch word(i) {
+		case "CREATE":
+			for sqlModifiers[word(j)] {
+				j++
+			}
+			if word(j) != "TABLE" && word(j) != "VIEW" {
+				continue
+			}
+			if j++; word(j) == "IF" && word(j+1) == "NOT" && word(j+2) == "EXISTS" {
+				j += 3
+			}
+		case "INSERT":
+			if word(j) != "INTO" && word(j) != "OVERWRITE" {
+				continue
+			}
+			if j++; word(j) == "TABLE" {
+				j++
+			}
+		case "MERGE":
+			if word(j) != "INTO" {
+				continue
+			}
+			j++
+		default:
+			continue
+		}
+		if j < len(ts) && ts[j] != "(" {
+			target = tableName(ts[j])
+		}
+	}
+
+	sources := make([]string, 0)
+	add := func(i int) {
+		if i >= len(ts) || ts[i] == "(" || sqlKeywords[word(i)] {
+			return
+		}
+		if name := tableName(ts[i]); name != target && !ctes[name] && !contains(sources, name) {
+			sources = append(sources, name)
+		}
+	}
+	// fns are the words before the open parentheses, whose FROM isn't a
+	// clause in the calls of sqlFunctions, e.g. EXTRACT(YEAR FROM ts)
+	fns := make([]string, 0)
+	for i := range ts {
+		switch word(i) {
+		case "(":
+			fns = append(fns, word(i-1))
+		case ")":
+			if len(fns) > 0 {
+				fns = fns[:len(fns)-1]
+			}
+		case "JOIN", "USING":
+			add(i + 1)
+		case "FROM":
+			if len(fns) > 0 && sqlFunctions[fns[len(fns)-1]] {
+				continue
+			}
+			// FROM a, b AS c, d e
+			for j := i + 1; ; j++ {
+				add(j)
+				if j++; word(j) == "AS" {
+					j++
+				}
+				if j < len(ts) && ts[j] != "," && ts[j] != "(" && ts[j] != ")" && !sqlKeywords[word(j)] {
+					j++
+				}
+				if j >= len(ts) || ts[j] != "," {
+					break
+				}
+			}
+		}
+	}
+	return target, sources
+}
+
+// tableName returns the name of a table without its quotes, e.g. raw.clicks
+// for "raw"."clicks"
+func tableName(s string) string {
+	return strings.NewReplacer(`"`, "", "`", "", "[", "", "]", "").Replace(s)
+}
+
+// splitYAMLComment returns the code of a line of YAML, and the text of its
+// grok comment if it has one
+func splitYAMLComment(line string) (string, string, bool) {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			text := strings.TrimSpace(line[i+1:])
+			if !strings.HasPrefix(text, CommentLabel) {
+				return line[:i], "", false
+			}
+			return line[:i], strings.TrimSpace(text[len(CommentLabel):]), true
+		}
+	}
+	return line, "", false
+}
+
+// splitYAMLKey returns the key and the value of a mapping entry of YAML
+func splitYAMLKey(content string) (string, string, bool) {
+	if strings.HasPrefix(content, "[") || strings.HasPrefix(content, "{") {
+		return "", "", false
+	}
+	if strings.HasSuffix(content, ":") {
+		return content[:len(content)-1], "", true
+	}
+	if i := strings.Index(content, ": "); i > 0 {
+		return content[:i], strings.TrimSpace(content[i+2:]), true
+	}
+	return "", "", false
+}
+
+// unquoteYAML returns a scalar of YAML without its quotes
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
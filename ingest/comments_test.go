@@ -0,0 +1,98 @@
+package ingest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok/graph"
+)
+
+const sqlFile = `-- daily clicks, grok: not a label
+-- grok: Purpose Analytics
+CREATE OR REPLACE TABLE daily.clicks AS
+WITH recent AS (SELECT * FROM raw.clicks WHERE ts > '2020-01-01 FROM x')
+SELECT ip, user_id, EXTRACT(YEAR FROM ts) -- grok: DataType IPAddress
+FROM recent r JOIN raw.accounts USING (user_id);
+
+/* a view on the clicks, FROM nowhere */
+CREATE VIEW "daily"."report" AS SELECT * FROM daily.clicks, raw.geo AS g;
+
+INSERT INTO archive.clicks SELECT * FROM daily.clicks;
+`
+
+func TestReadSQL(t *testing.T) {
+	p := policy(t)
+	g, s := graph.NewDataFlowGraph(), NewStore()
+	if err := ReadSQL(strings.NewReader(sqlFile), p, g, s); err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := []graph.Flow{{From: "raw.clicks", To: "daily.clicks"}, {From: "raw.accounts", To: "daily.clicks"},
+		{From: "daily.clicks", To: "daily.report"}, {From: "raw.geo", To: "daily.report"},
+		{From: "daily.clicks", To: "archive.clicks"}}
+	if !reflect.DeepEqual(g.Flows, want) {
+		t.Errorf("Flows = %v, want %v", g.Flows, want)
+	}
+	if an := s.Annotation("daily.clicks"); an.String() != "Purpose Analytics DataType IPAddress" {
+		t.Errorf("Annotation(daily.clicks) = %s", an)
+	}
+	s.Label(g)
+	if ids := s.Unannotated(g); !reflect.DeepEqual(ids, []string{"archive.clicks", "daily.report", "raw.accounts", "raw.clicks", "raw.geo"}) {
+		t.Errorf("Unannotated() = %v", ids)
+	}
+
+	err := ReadSQL(strings.NewReader("-- grok: DataType Nothing\nCREATE TABLE t AS SELECT 1;\n-- grok: Purpose Analytics\nSELECT 1;"),
+		p, graph.NewDataFlowGraph(), NewStore())
+	if errs, ok := err.(Errors); !ok || len(errs) != 2 || errs[0].Line != 1 || errs[0].Dataset != "t" ||
+		errs[1].Error() != "line 3: : the grok comment annotates no table" {
+		t.Errorf("ReadSQL() = %v", err)
+	}
+}
+
+const pipelineYAML = `jobs:
+  # grok: Purpose Analytics
+  - name: daily-join
+    inputs: [raw.clicks, "raw.accounts"]
+    outputs:
+      - daily.joined   # grok: DataType IPAddress
+      - daily.errors
+  - name: 'export'     # grok: Purpose Sharing
+    inputs:
+    - daily.joined
+    outputs: [exports.partners]  # grok: DataType AccountID
+    schedule: "@daily # grok: not a comment"
+`
+
+func TestReadPipelineYAML(t *testing.T) {
+	p := policy(t)
+	g, s := graph.NewDataFlowGraph(), NewStore()
+	if err := ReadPipelineYAML(strings.NewReader(pipelineYAML), p, g, s); err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := []graph.Flow{{From: "raw.clicks", To: "daily-join"}, {From: "raw.accounts", To: "daily-join"},
+		{From: "daily-join", To: "daily.joined"}, {From: "daily-join", To: "daily.errors"},
+		{From: "daily.joined", To: "export"}, {From: "export", To: "exports.partners"}}
+	if !reflect.DeepEqual(g.Flows, want) {
+		t.Errorf("Flows = %v, want %v", g.Flows, want)
+	}
+	for dataset, want := range map[string]string{
+		"daily-join":       "Purpose Analytics",
+		"daily.joined":     "DataType IPAddress",
+		"export":           "Purpose Sharing",
+		"exports.partners": "DataType AccountID",
+	} {
+		if an := s.Annotation(dataset); an.String() != want {
+			t.Errorf("Annotation(%s) = %s, want %s", dataset, an, want)
+		}
+	}
+	if ids := s.Unannotated(g); !reflect.DeepEqual(ids, []string{"daily.errors", "raw.accounts", "raw.clicks"}) {
+		t.Errorf("Unannotated() = %v", ids)
+	}
+
+	err := ReadPipelineYAML(strings.NewReader("inputs:\n  - raw.clicks\njobs:  # grok: Purpose Analytics\n  - name: j\n# grok: DataType IPAddress\n"),
+		p, graph.NewDataFlowGraph(), NewStore())
+	if errs, ok := err.(Errors); !ok || len(errs) != 3 || errs[0].Error() != "line 2: raw.clicks: the dataset has no job" ||
+		errs[1].Line != 3 || errs[2].Line != 5 {
+		t.Errorf("ReadPipelineYAML() = %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+// Package ingest builds annotation stores from the exports of data catalogs.
+//
+// A mapping file maps datasets, or columns of datasets, to attribute values.
+// In CSV, every row is one value, with a header row:
+//
+//	dataset,column,attribute,value
+//	raw.clicks,,Purpose,Analytics
+//	raw.clicks,ip,DataType,IPAddress
+//	raw.clicks,user,DataType,AccountID
+//
+// where an empty column labels the dataset itself. In JSON, every entry maps
+// attributes to their values:
+//
+//	[
+//	 {"dataset": "raw.clicks", "attributes": {"Purpose": ["Analytics"]}},
+//	 {"dataset": "raw.clicks", "column": "ip", "attributes": {"DataType": ["IPAddress"]}}
+//	]
+//
+// Every value is validated against the lattices of a policy, and the
+// annotation of every dataset (the values of the dataset and of its columns)
+// must conform to the schema of the policy, if any. All the invalid entries
+// are reported at once.
+//
+// Annotations can also be read from the grok labels that schemas carry: Avro
+// schemas, Parquet metadata, and OpenAPI specifications, and from the grok
+// comments of SQL files and pipeline YAML, whose tables and jobs are the
+// nodes of the graphs derived from them.
+package ingest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/graph"
+	"github.com/grongjun/grok/recertify"
+)
+
+// Store is a keyed store of the annotations of datasets and their columns
+type Store struct {
+	datasets map[string]grok.Annotation
+	columns  map[string]map[string]grok.Annotation
+}
+
+// NewStore returns an empty Store
+func NewStore() *Store {
+	return &Store{make(map[string]grok.Annotation), make(map[string]map[string]grok.Annotation)}
+}
+
+// Add adds an annotation to a dataset, or to a column of it if column isn't empty
+func (s *Store) Add(dataset, column string, an grok.Annotation) {
+	if column == "" {
+		s.datasets[dataset] = append(s.datasets[dataset], an...)
+		return
+	}
+	if s.columns[dataset] == nil {
+		s.columns[dataset] = make(map[string]grok.Annotation)
+	}
+	s.columns[dataset][column] = append(s.columns[dataset][column], an...)
+}
+
+// merge adds the annotations of t to the store
+func (s *Store) merge(t *Store) {
+	for d, an := range t.datasets {
+		s.Add(d, "", an)
+	}
+	for d, cs := range t.columns {
+		for c, an := range cs {
+			s.Add(d, c, an)
+		}
+	}
+}
+
+// Datasets returns the sorted datasets of the store
+func (s *Store) Datasets() []string {
+	ds := make([]string, 0, len(s.datasets)+len(s.columns))
+	for d := range s.datasets {
+		ds = append(ds, d)
+	}
+	for d := range s.columns {
+		if _, ok := s.datasets[d]; !ok {
+			ds = append(ds, d)
+		}
+	}
+	sort.Strings(ds)
+	return ds
+}
+
+// Columns returns the sorted annotated columns of a dataset
+func (s *Store) Columns(dataset string) []string {
+	cs := make([]string, 0, len(s.columns[dataset]))
+	for c := range s.columns[dataset] {
+		cs = append(cs, c)
+	}
+	sort.Strings(cs)
+	return cs
+}
+
+// Column returns the annotation of a column, and false if it isn't annotated
+func (s *Store) Column(dataset, column string) (grok.Annotation, bool) {
+	an, ok := s.columns[dataset][column]
+	return an, ok
+}
+
+// Annotation returns the annotation of a dataset: its own values followed by
+// the values of its columns, in the order of the columns
+func (s *Store) Annotation(dataset string) grok.Annotation {
+	an := append(grok.Annotation{}, s.datasets[dataset]...)
+	for _, c := range s.Columns(dataset) {
+		an = append(an, s.columns[dataset][c]...)
+	}
+	return an
+}
+
+// Catalog returns the annotations of the datasets, for recertification
+func (s *Store) Catalog() recertify.Catalog {
+	c := make(recertify.Catalog)
+	for _, d := range s.Datasets() {
+		c[d] = s.Annotation(d)
+	}
+	return c
+}
+
+// Label sets the annotations of the nodes of a graph whose IDs are datasets
+// of the store, and returns the number of labeled nodes
+func (s *Store) Label(g *graph.DataFlowGraph) int {
+	n := 0
+	for _, d := range s.Datasets() {
+		if g.Node(d) != nil {
+			g.AddNode(d, s.Annotation(d))
+			n++
+		}
+	}
+	return n
+}
+
+// Error is an invalid entry of a mapping file
+type Error struct {
+	// Line is the line of the entry in a CSV file, or its index in a JSON file
+	Line    int
+	Dataset string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Dataset, e.Err)
+}
+
+// Errors are all the invalid entries of a mapping file
+type Errors []*Error
+
+func (es Errors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return fmt.Sprintf("ingest: %d invalid entries: %s", len(es), strings.Join(msgs, "; "))
+}
+
+// entry is one attribute value of a mapping file
+type entry struct {
+	line                              int
+	dataset, column, attribute, value string
+}
+
+// LoadCSV reads a CSV mapping file, and returns the store of its annotations
+// validated by the policy. The error is an Errors when entries are invalid.
+func LoadCSV(r io.Reader, p *grok.Policy) (*Store, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 4
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range []string{"dataset", "column", "attribute", "value"} {
+		if strings.ToLower(strings.TrimSpace(header[i])) != h {
+			return nil, errors.New("ingest: the header should be dataset,column,attribute,value")
+		}
+	}
+	entries := make([]entry, 0)
+	// values are single tokens, so that records are single lines after the header
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{line, rec[0], rec[1], rec[2], rec[3]})
+	}
+	return build(entries, p)
+}
+
+// LoadJSON reads a JSON mapping file, and returns the store of its annotations
+// validated by the policy. The error is an Errors when entries are invalid.
+func LoadJSON(r io.Reader, p *grok.Policy) (*Store, error) {
+	var def []struct {
+		Dataset    string              `json:"dataset"`
+		Column     string              `json:"column"`
+		Attributes map[string][]string `json:"attributes"`
+	}
+	if err := json.NewDecoder(r).Decode(&def); err != nil {
+		return nil, err
+	}
+	entries := make([]entry, 0)
+	for i, d := range def {
+		attrs := make([]string, 0, len(d.Attributes))
+		for a := range d.Attributes {
+			attrs = append(attrs, a)
+		}
+		sort.Strings(attrs)
+		for _, a := range attrs {
+			for _, v := range d.Attributes[a] {
+				entries = append(entries, entry{i, d.Dataset, d.Column, a, v})
+			}
+		}
+	}
+	return build(entries, p)
+}
+
+// build validates the entries, and returns the store of their annotations
+func build(entries []entry, p *grok.Policy) (*Store, error) {
+	s := NewStore()
+	errs := make(Errors, 0)
+	first := make(map[string]int) // the first line of every dataset
+	for _, e := range entries {
+		if e.dataset == "" {
+			errs = append(errs, &Error{e.line, e.dataset, errors.New("dataset should not be empty")})
+			continue
+		}
+		if _, ok := first[e.dataset]; !ok {
+			first[e.dataset] = e.line
+		}
+		an, err := p.ParseValue(e.attribute, e.value)
+		if err != nil {
+			errs = append(errs, &Error{e.line, e.dataset, err})
+			continue
+		}
+		s.Add(e.dataset, e.column, an)
+	}
+	if p.Schema != nil {
+		for _, d := range s.Datasets() {
+			if err := p.Schema.Validate(s.Annotation(d)); err != nil {
+				errs = append(errs, &Error{first[d], d, err})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool {
+			return errs[i].Line < errs[j].Line
+		})
+		return nil, errs
+	}
+	return s, nil
+}
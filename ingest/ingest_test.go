@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/graph"
+)
+
+func policy(t *testing.T) *grok.Policy {
+	dt := grok.NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	purpose := grok.NewLattice(`{ "name": "Purpose", "edges": { "Analytics": [], "Sharing": [] } }`)
+	p := grok.NewPolicy([]*grok.Lattice{dt, purpose})
+	if err := p.ParsePolicy(`ALLOW DataType TOP Purpose TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return p
+}
+
+const mapping = `dataset,column,attribute,value
+raw.clicks,,Purpose,Analytics
+raw.clicks,ip,DataType,IPAddress
+raw.accounts,user,DataType,AccountID
+daily.joined,ip,DataType,IPAddress
+daily.joined,user,DataType,AccountID
+`
+
+func TestLoadCSV(t *testing.T) {
+	p := policy(t)
+	s, err := LoadCSV(strings.NewReader(mapping), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := strings.Join(s.Datasets(), ","); got != "daily.joined,raw.accounts,raw.clicks" {
+		t.Errorf("Datasets() = %q", got)
+	}
+	if got := s.Annotation("raw.clicks").String(); got != "Purpose Analytics DataType IPAddress" {
+		t.Errorf("Annotation(raw.clicks) = %q", got)
+	}
+	if an, ok := s.Column("daily.joined", "user"); !ok || an.String() != "DataType AccountID" {
+		t.Errorf("Column(daily.joined, user) = %q, %t", an, ok)
+	}
+
+	// the store feeds recertification and the graph checker
+	c := s.Catalog()
+	if len(c) != 3 || p.ApplyOn(c["daily.joined"]) {
+		t.Errorf("Catalog() = %v", c)
+	}
+	g := graph.NewDataFlowGraph()
+	g.AddFlow("raw.clicks", "daily.joined")
+	if n := s.Label(g); n != 2 {
+		t.Errorf("Label() = %d, want 2", n)
+	}
+	if vs := graph.CheckGraph(p, g); len(vs) != 1 || vs[0].Node != "daily.joined" {
+		t.Errorf("CheckGraph() = %v", vs)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	s, err := LoadJSON(strings.NewReader(`[
+		{"dataset": "raw.clicks", "attributes": {"Purpose": ["Analytics"]}},
+		{"dataset": "raw.clicks", "column": "ip", "attributes": {"DataType": ["IPAddress", "Location"]}}
+	]`), policy(t))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := s.Annotation("raw.clicks").String(); got != "Purpose Analytics DataType IPAddress DataType Location" {
+		t.Errorf("Annotation(raw.clicks) = %q", got)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	p := policy(t)
+	schema, err := grok.NewAnnotationSchema(`{"attributes": {"Purpose": {"required": true}}}`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	p.Schema = schema
+	_, err = LoadCSV(strings.NewReader(mapping+`raw.geo,city,DataType,City
+,x,DataType,IPAddress
+`), p)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("LoadCSV() = %v, want Errors", err)
+	}
+	// raw.accounts and daily.joined have no Purpose, raw.geo has an invalid
+	// value, and the last entry has no dataset
+	lines := make([]int, 0)
+	for _, e := range errs {
+		lines = append(lines, e.Line)
+	}
+	if len(lines) != 4 || lines[0] != 4 || lines[2] != 7 || lines[3] != 8 {
+		t.Errorf("error lines = %v: %s", lines, err)
+	}
+
+	if _, err := LoadCSV(strings.NewReader("a,b,c,d\n"), p); err == nil {
+		t.Errorf("LoadCSV() should check the header")
+	}
+}
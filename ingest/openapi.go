@@ -0,0 +1,294 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// OpenAPIExtension is the vendor extension carrying grok annotations in
+// OpenAPI specifications, in the policy syntax. See LoadOpenAPI.
+const OpenAPIExtension = "x-grok"
+
+// Endpoint is an operation of an API, with the annotations of the data it
+// receives and of the data it returns
+type Endpoint struct {
+	Method   string
+	Path     string
+	Request  grok.Annotation
+	Response grok.Annotation
+}
+
+// API is the endpoints of an OpenAPI specification, sorted by path and method
+type API struct {
+	Endpoints []*Endpoint
+}
+
+// LoadOpenAPI reads an OpenAPI specification in JSON (OpenAPI 3 or Swagger 2),
+// and returns the annotations of its endpoints, for API gateways to enforce
+// the policy on requests and responses. The x-grok extension labels:
+//
+//   - an operation (or a path item): both its request and its response;
+//   - a parameter, or the request body: the request;
+//   - a response: the response;
+//   - a schema, or a property of it: the request or the response using it,
+//     following $ref, items, properties, allOf, anyOf and oneOf.
+//
+// For example:
+//
+//	"/users/{id}": {
+//	 "get": {
+//	     "x-grok": "Purpose Support",
+//	     "parameters": [{"name": "id", "in": "path", "x-grok": "DataType AccountID"}],
+//	     "responses": {"200": {"content": {"application/json": {
+//	         "schema": {"$ref": "#/components/schemas/User"}}}}}
+//	 }
+//	}
+//
+// The request and the response of every endpoint must conform to the schema
+// of the policy, if any.
+func LoadOpenAPI(r io.Reader, p *grok.Policy) (*API, error) {
+	var spec map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&spec); err != nil {
+		return nil, err
+	}
+	paths, ok := spec["paths"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("ingest: the OpenAPI specification has no paths")
+	}
+	l := &openAPILoader{spec: spec, p: p}
+	api := &API{Endpoints: make([]*Endpoint, 0)}
+	for path, v := range paths {
+		item, _ := l.resolve(v).(map[string]interface{})
+		for _, method := range openAPIMethods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			e, err := l.endpoint(strings.ToUpper(method), path, item, op)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("ingest: %s %s: %s", strings.ToUpper(method), path, err))
+			}
+			api.Endpoints = append(api.Endpoints, e)
+		}
+	}
+	order := make(map[string]int)
+	for i, m := range openAPIMethods {
+		order[strings.ToUpper(m)] = i
+	}
+	sort.Slice(api.Endpoints, func(i, j int) bool {
+		a, b := api.Endpoints[i], api.Endpoints[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return order[a.Method] < order[b.Method]
+	})
+	return api, nil
+}
+
+// Match returns the endpoint of a request, matching the templated segments of
+// the paths (e.g. /users/{id} matches /users/42), or nil if none matches. A
+// literal segment takes precedence over a templated one.
+func (a *API) Match(method, path string) *Endpoint {
+	method = strings.ToUpper(method)
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	var best *Endpoint
+	bestTemplated := 0
+	for _, e := range a.Endpoints {
+		if e.Method != method {
+			continue
+		}
+		tsegs := strings.Split(strings.Trim(e.Path, "/"), "/")
+		if len(tsegs) != len(segs) {
+			continue
+		}
+		templated, ok := 0, true
+		for i, t := range tsegs {
+			switch {
+			case strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}"):
+				templated++
+			case t != segs[i]:
+				ok = false
+			}
+		}
+		if ok && (best == nil || templated < bestTemplated) {
+			best, bestTemplated = e, templated
+		}
+	}
+	return best
+}
+
+// openAPIMethods are the methods of the operations of a path item
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// openAPILoader collects the annotations of the operations of a specification
+type openAPILoader struct {
+	spec map[string]interface{}
+	p    *grok.Policy
+}
+
+// endpoint returns the endpoint of an operation of a path item
+func (l *openAPILoader) endpoint(method, path string, item, op map[string]interface{}) (*Endpoint, error) {
+	var req, resp grok.Annotation
+	for _, v := range []interface{}{item[OpenAPIExtension], op[OpenAPIExtension]} {
+		an, err := l.labels(v)
+		if err != nil {
+			return nil, err
+		}
+		req, resp = append(req, an...), append(resp, an...)
+	}
+
+	params, _ := item["parameters"].([]interface{})
+	ops, _ := op["parameters"].([]interface{})
+	for _, v := range append(append([]interface{}{}, params...), ops...) {
+		an, err := l.node(v, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		req = append(req, an...)
+	}
+	an, err := l.node(op["requestBody"], map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	req = append(req, an...)
+
+	responses, _ := op["responses"].(map[string]interface{})
+	codes := make([]string, 0, len(responses))
+	for c := range responses {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	for _, c := range codes {
+		an, err := l.node(responses[c], map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, an...)
+	}
+
+	e := &Endpoint{Method: method, Path: path, Request: distinct(req), Response: distinct(resp)}
+	if l.p.Schema != nil {
+		if err := l.p.Schema.Validate(e.Request); err != nil {
+			return nil, errors.New(fmt.Sprintf("request: %s", err))
+		}
+		if err := l.p.Schema.Validate(e.Response); err != nil {
+			return nil, errors.New(fmt.Sprintf("response: %s", err))
+		}
+	}
+	return e, nil
+}
+
+// node returns the annotations of a parameter, a request body, a response or
+// a schema, and of the nodes below it. seen holds the followed references, so
+// that recursive schemas are walked once.
+func (l *openAPILoader) node(v interface{}, seen map[string]bool) (grok.Annotation, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	if ref, ok := m["$ref"].(string); ok {
+		if seen[ref] {
+			return nil, nil
+		}
+		seen[ref] = true
+		defer delete(seen, ref)
+		return l.node(l.resolve(m), seen)
+	}
+	an, err := l.labels(m[OpenAPIExtension])
+	if err != nil {
+		return nil, err
+	}
+	// schema of a parameter (or Swagger 2 body or response), media types of a
+	// request body or response, items of arrays, and additional properties
+	children := []interface{}{m["schema"], m["items"], m["additionalProperties"]}
+	if content, ok := m["content"].(map[string]interface{}); ok {
+		for _, k := range sortedKeys(content) {
+			children = append(children, content[k])
+		}
+	}
+	if props, ok := m["properties"].(map[string]interface{}); ok {
+		for _, k := range sortedKeys(props) {
+			children = append(children, props[k])
+		}
+	}
+	for _, k := range []string{"allOf", "anyOf", "oneOf"} {
+		if subs, ok := m[k].([]interface{}); ok {
+			children = append(children, subs...)
+		}
+	}
+	for _, c := range children {
+		can, err := l.node(c, seen)
+		if err != nil {
+			return nil, err
+		}
+		an = append(an, can...)
+	}
+	return an, nil
+}
+
+// resolve returns the node a local reference ("#/components/schemas/User")
+// refers to, or v itself if it isn't a reference
+func (l *openAPILoader) resolve(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	ref, ok := m["$ref"].(string)
+	if !ok || !strings.HasPrefix(ref, "#/") {
+		return v
+	}
+	var node interface{} = l.spec
+	for _, k := range strings.Split(ref[2:], "/") {
+		k = strings.Replace(strings.Replace(k, "~1", "/", -1), "~0", "~", -1)
+		parent, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = parent[k]
+	}
+	return node
+}
+
+// labels parses the value of an x-grok extension, if it's a string
+func (l *openAPILoader) labels(v interface{}) (grok.Annotation, error) {
+	str, ok := v.(string)
+	if !ok {
+		return nil, nil
+	}
+	return l.p.ParseAnnotationPart(str)
+}
+
+// sortedKeys returns the sorted keys of a map
+func sortedKeys(m map[string]interface{}) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+// distinct returns an annotation without repeated values, e.g. of a schema
+// used twice
+func distinct(an grok.Annotation) grok.Annotation {
+	d := make(grok.Annotation, 0, len(an))
+	for i := range an {
+		dup := false
+		for j := range d {
+			if an[i] == d[j] {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			d = append(d, an[i])
+		}
+	}
+	return d
+}
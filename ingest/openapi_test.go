@@ -0,0 +1,109 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+const spec = `{
+	"openapi": "3.0.0",
+	"paths": {
+		"/users/{id}": {
+			"parameters": [{"$ref": "#/components/parameters/id"}],
+			"get": {
+				"x-grok": "Purpose Analytics",
+				"responses": {"200": {"content": {"application/json": {
+					"schema": {"$ref": "#/components/schemas/User"}}}}}
+			},
+			"put": {
+				"requestBody": {"content": {"application/json": {
+					"schema": {"$ref": "#/components/schemas/User"}}}},
+				"responses": {"204": {"description": "updated"}}
+			}
+		},
+		"/users/me": {
+			"get": {"responses": {"200": {"x-grok": "DataType UniqueID"}}}
+		}
+	},
+	"components": {
+		"parameters": {"id": {"name": "id", "in": "path", "x-grok": "DataType AccountID"}},
+		"schemas": {
+			"User": {"type": "object", "properties": {
+				"id": {"type": "string", "x-grok": "DataType AccountID"},
+				"devices": {"type": "array", "items": {"allOf": [
+					{"type": "object", "properties": {"ip": {"type": "string", "x-grok": "DataType IPAddress"}}}
+				]}},
+				"friends": {"type": "array", "items": {"$ref": "#/components/schemas/User"}}
+			}}
+		}
+	}
+}`
+
+func TestLoadOpenAPI(t *testing.T) {
+	p := policy(t)
+	api, err := LoadOpenAPI(strings.NewReader(spec), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	tests := []struct {
+		method, path      string
+		request, response string
+	}{
+		{"GET", "/users/me", "", "DataType UniqueID"},
+		{"GET", "/users/{id}", "Purpose Analytics DataType AccountID", "Purpose Analytics DataType IPAddress DataType AccountID"},
+		{"PUT", "/users/{id}", "DataType AccountID DataType IPAddress", ""},
+	}
+	if len(api.Endpoints) != len(tests) {
+		t.Fatalf("Endpoints = %d, want %d", len(api.Endpoints), len(tests))
+	}
+	for i, test := range tests {
+		e := api.Endpoints[i]
+		if e.Method != test.method || e.Path != test.path {
+			t.Errorf("%d: %s %s, want %s %s", i, e.Method, e.Path, test.method, test.path)
+		}
+		if e.Request.String() != test.request {
+			t.Errorf("%s %s: Request = %q, want %q", e.Method, e.Path, e.Request, test.request)
+		}
+		if e.Response.String() != test.response {
+			t.Errorf("%s %s: Response = %q, want %q", e.Method, e.Path, e.Response, test.response)
+		}
+	}
+
+	// the gateway denies responses with both an IPAddress and an AccountID
+	if e := api.Match("get", "/users/42"); e == nil || e.Path != "/users/{id}" || p.ApplyOn(e.Response) {
+		t.Errorf("Match(GET /users/42) = %v", e)
+	}
+	if e := api.Match("GET", "/users/me"); e == nil || e.Path != "/users/me" {
+		t.Errorf("Match(GET /users/me) = %v", e)
+	}
+	if e := api.Match("DELETE", "/users/42"); e != nil {
+		t.Errorf("Match(DELETE /users/42) = %v", e)
+	}
+}
+
+func TestLoadOpenAPIErrors(t *testing.T) {
+	schema, err := grok.NewAnnotationSchema(`{"attributes": {"Purpose": {"required": true}}}`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	tests := []struct {
+		spec   string
+		strict bool // whether the policy has the schema
+	}{
+		{`{"openapi": "3.0.0"}`, false},
+		{`{"paths": {"/a": {"get": {"x-grok": "DataType City"}}}}`, false},
+		{`{"paths": {"/a": {"get": {"parameters": [{"name": "q", "x-grok": "Purpose"}]}}}}`, false},
+		{`{"paths": {"/a": {"get": {"x-grok": "DataType IPAddress"}}}}`, true},
+	}
+	for i, test := range tests {
+		p := policy(t)
+		if test.strict {
+			p.Schema = schema
+		}
+		if _, err := LoadOpenAPI(strings.NewReader(test.spec), p); err == nil {
+			t.Errorf("%d: no error", i)
+		}
+	}
+}
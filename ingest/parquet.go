@@ -0,0 +1,302 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// ReadParquet reads the annotations of a dataset from the key-value metadata
+// in the footer of a Parquet file of size bytes, and adds them to the store.
+// The "grok" key labels the dataset, and the "grok.<column>" keys label the
+// columns, where nested columns are dotted paths:
+//
+//	grok          = Purpose Analytics
+//	grok.ip       = DataType IPAddress
+//	grok.user.id  = DataType AccountID
+//
+// The annotation of the dataset must conform to the schema of the policy, if any.
+func ReadParquet(r io.ReaderAt, size int64, dataset string, p *grok.Policy, s *Store) error {
+	meta, err := readParquetMetadata(r, size)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	t := NewStore()
+	for _, k := range keys {
+		var column string
+		switch {
+		case k == LabelProperty:
+		case strings.HasPrefix(k, LabelProperty+"."):
+			column = k[len(LabelProperty)+1:]
+		default:
+			continue
+		}
+		if err := addLabels(t, p, dataset, column, meta[k]); err != nil {
+			return err
+		}
+	}
+	if err := checkSchema(t, p, dataset); err != nil {
+		return err
+	}
+	s.merge(t)
+	return nil
+}
+
+// parquetMagic starts and ends Parquet files
+const parquetMagic = "PAR1"
+
+// readParquetMetadata returns the key-value metadata of a Parquet file
+func readParquetMetadata(r io.ReaderAt, size int64) (map[string]string, error) {
+	if size < 12 {
+		return nil, errors.New("ingest: not a Parquet file")
+	}
+	tail := make([]byte, 8)
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	if string(tail[4:]) != parquetMagic {
+		return nil, errors.New("ingest: not a Parquet file")
+	}
+	n := int64(binary.LittleEndian.Uint32(tail[:4]))
+	if n > size-12 || n > maxMetadataSize {
+		return nil, errors.New(fmt.Sprintf("ingest: invalid Parquet footer length %d", n))
+	}
+	footer := make([]byte, n)
+	if _, err := r.ReadAt(footer, size-8-n); err != nil {
+		return nil, err
+	}
+
+	// the footer is a FileMetaData struct in the Thrift compact protocol, whose
+	// field 5 is the list of KeyValue structs {1: key, 2: value}
+	d := &thriftDecoder{b: footer}
+	meta := make(map[string]string)
+	err := d.readStruct(func(id int16, typ byte) error {
+		if id != 5 || typ != thriftList {
+			return d.skip(typ)
+		}
+		n, elem, err := d.readListHeader()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if elem != thriftStruct {
+				if err := d.skip(elem); err != nil {
+					return err
+				}
+				continue
+			}
+			var key, value string
+			err := d.readStruct(func(id int16, typ byte) error {
+				if (id == 1 || id == 2) && typ == thriftBinary {
+					b, err := d.readBinary()
+					if id == 1 {
+						key = string(b)
+					} else {
+						value = string(b)
+					}
+					return err
+				}
+				return d.skip(typ)
+			})
+			if err != nil {
+				return err
+			}
+			meta[key] = value
+		}
+		return nil
+	})
+	return meta, err
+}
+
+// Thrift compact protocol types
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+const (
+	maxThriftDepth  = 64
+	errThriftFormat = "ingest: invalid Parquet footer"
+)
+
+// thriftDecoder decodes the Thrift compact protocol, as far as reading
+// Parquet footers requires
+type thriftDecoder struct {
+	b     []byte
+	pos   int
+	depth int
+}
+
+func (d *thriftDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.b) {
+		return 0, errors.New(errThriftFormat)
+	}
+	d.pos++
+	return d.b[d.pos-1], nil
+}
+
+func (d *thriftDecoder) readVarint() (uint64, error) {
+	var u uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := d.readByte()
+		if err != nil {
+			return 0, err
+		}
+		u |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return u, nil
+		}
+	}
+	return 0, errors.New(errThriftFormat)
+}
+
+func (d *thriftDecoder) readBinary() ([]byte, error) {
+	n, err := d.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.b)-d.pos) {
+		return nil, errors.New(errThriftFormat)
+	}
+	d.pos += int(n)
+	return d.b[d.pos-int(n) : d.pos], nil
+}
+
+// readListHeader returns the size and the element type of a list or a set
+func (d *thriftDecoder) readListHeader() (int, byte, error) {
+	h, err := d.readByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	n := uint64(h >> 4)
+	if n == 15 {
+		if n, err = d.readVarint(); err != nil {
+			return 0, 0, err
+		}
+	}
+	if n > uint64(len(d.b)) {
+		return 0, 0, errors.New(errThriftFormat)
+	}
+	return int(n), h & 0x0f, nil
+}
+
+// readStruct reads the fields of a struct, calling field on every field to
+// read (or skip) its value
+func (d *thriftDecoder) readStruct(field func(id int16, typ byte) error) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxThriftDepth {
+		return errors.New(errThriftFormat)
+	}
+	var id int16
+	for {
+		h, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		typ := h & 0x0f
+		if typ == thriftStop {
+			return nil
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			u, err := d.readVarint()
+			if err != nil {
+				return err
+			}
+			id = int16(u>>1) ^ -int16(u&1)
+		}
+		if err := field(id, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// skip skips a value of type typ
+func (d *thriftDecoder) skip(typ byte) error {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		return nil
+	case thriftByte:
+		_, err := d.readByte()
+		return err
+	case thriftI16, thriftI32, thriftI64:
+		_, err := d.readVarint()
+		return err
+	case thriftDouble:
+		if len(d.b)-d.pos < 8 {
+			return errors.New(errThriftFormat)
+		}
+		d.pos += 8
+		return nil
+	case thriftBinary:
+		_, err := d.readBinary()
+		return err
+	case thriftList, thriftSet:
+		n, elem, err := d.readListHeader()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			// booleans are one byte each in lists
+			if elem == thriftTrue || elem == thriftFalse {
+				elem = thriftByte
+			}
+			if err := d.skip(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftMap:
+		n, err := d.readVarint()
+		if err != nil || n == 0 {
+			return err
+		}
+		if n > uint64(len(d.b)) {
+			return errors.New(errThriftFormat)
+		}
+		kv, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < n; i++ {
+			for _, t := range []byte{kv >> 4, kv & 0x0f} {
+				if t == thriftTrue || t == thriftFalse {
+					t = thriftByte
+				}
+				if err := d.skip(t); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case thriftStruct:
+		return d.readStruct(func(id int16, typ byte) error {
+			return d.skip(typ)
+		})
+	default:
+		return errors.New(errThriftFormat)
+	}
+}
@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// thriftString encodes a binary field of a struct in the Thrift compact protocol
+func thriftString(id byte, s string) []byte {
+	b := []byte{id<<4 | thriftBinary, byte(len(s))}
+	return append(b, s...)
+}
+
+// parquetFile returns a Parquet file whose footer has the key-value metadata
+func parquetFile(keys, values []string) []byte {
+	footer := []byte{
+		1<<4 | thriftI32, 2, // version 1
+		1<<4 | thriftList, 0x10 | thriftI32, 4, // a schema of one element
+		1<<4 | thriftDouble, 0, 0, 0, 0, 0, 0, 0, 0, // not a Parquet field, skipped
+	}
+	footer = append(footer, 2<<4|thriftList, byte(len(keys))<<4|thriftStruct)
+	for i := range keys {
+		footer = append(footer, thriftString(1, keys[i])...)
+		footer = append(footer, thriftString(1, values[i])...)
+		footer = append(footer, thriftStop)
+	}
+	footer = append(footer, thriftStop)
+	var buf bytes.Buffer
+	buf.WriteString(parquetMagic)
+	buf.WriteString("column chunks")
+	buf.Write(footer)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(footer)))
+	buf.WriteString(parquetMagic)
+	return buf.Bytes()
+}
+
+func TestReadParquet(t *testing.T) {
+	p := policy(t)
+	s := NewStore()
+	f := parquetFile(
+		[]string{"grok.user.id", "writer.model.name", "grok", "grok.ip"},
+		[]string{"DataType AccountID", "avro", "Purpose Analytics", "DataType IPAddress"})
+	if err := ReadParquet(bytes.NewReader(f), int64(len(f)), "raw.clicks", p, s); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := strings.Join(s.Columns("raw.clicks"), ","); got != "ip,user.id" {
+		t.Errorf("Columns() = %q", got)
+	}
+	if got := s.Annotation("raw.clicks").String(); got != "Purpose Analytics DataType IPAddress DataType AccountID" {
+		t.Errorf("Annotation(raw.clicks) = %q", got)
+	}
+}
+
+func TestReadParquetErrors(t *testing.T) {
+	valid := parquetFile([]string{"grok"}, []string{"Purpose Analytics"})
+	truncated := append(append([]byte{}, valid[:len(valid)-10]...), valid[len(valid)-8:]...)
+	tests := [][]byte{
+		[]byte("PAR1"),
+		append(append([]byte{}, valid[:len(valid)-1]...), '2'),
+		append(append([]byte{}, valid[:len(valid)-8]...), 0xff, 0xff, 0, 0, 'P', 'A', 'R', '1'),
+		truncated,
+		parquetFile([]string{"grok.ip"}, []string{"DataType City"}),
+	}
+	for i, f := range tests {
+		s := NewStore()
+		if err := ReadParquet(bytes.NewReader(f), int64(len(f)), "raw.clicks", policy(t), s); err == nil {
+			t.Errorf("%d: no error", i)
+		}
+		if len(s.Datasets()) != 0 {
+			t.Errorf("%d: the store should be unchanged", i)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/graph"
+)
+
+// Dependency is a call of a service to another, or to one of its endpoints
+type Dependency struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+	// Endpoint is the endpoint called, e.g. "GET /users/42" or
+	// "GET /users/{id}", or all the endpoints of the callee when it's empty
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// LoadDependencies reads the dependencies of services in JSON:
+//
+//	[
+//	 {"caller": "web", "callee": "users", "endpoint": "GET /users/{id}"},
+//	 {"caller": "users", "callee": "billing"}
+//	]
+func LoadDependencies(r io.Reader) ([]Dependency, error) {
+	var deps []Dependency
+	if err := json.NewDecoder(r).Decode(&deps); err != nil {
+		return nil, err
+	}
+	for i, d := range deps {
+		if d.Caller == "" || d.Callee == "" {
+			return nil, errors.New(fmt.Sprintf("ingest: dependency %d should have a caller and a callee", i))
+		}
+	}
+	return deps, nil
+}
+
+// ServiceGraph adds the data flows between services to a graph, so that
+// policies are checked over microservice topologies and not just batch
+// pipelines. Services are the nodes, identified by their names, and the APIs
+// of the callees (see LoadOpenAPI) annotate the data of every dependency:
+// the request of an endpoint flows from the caller to the callee, and its
+// response back to the caller. A service is annotated with the data it sends
+// and receives, i.e. the requests and the responses of the endpoints it calls
+// or serves.
+//
+// A nil graph is a new graph, which is returned.
+func ServiceGraph(g *graph.DataFlowGraph, apis map[string]*API, deps []Dependency) (*graph.DataFlowGraph, error) {
+	if g == nil {
+		g = graph.NewDataFlowGraph()
+	}
+	ans := make(map[string]grok.Annotation)
+	services := make([]string, 0)
+	label := func(service string, an grok.Annotation) {
+		if _, ok := ans[service]; !ok {
+			services = append(services, service)
+		}
+		ans[service] = append(ans[service], an...)
+	}
+	for _, d := range deps {
+		api, ok := apis[d.Callee]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("ingest: service %s has no API", d.Callee))
+		}
+		es := api.Endpoints
+		if d.Endpoint != "" {
+			fields := strings.Fields(d.Endpoint)
+			var e *Endpoint
+			if len(fields) == 2 {
+				e = api.Match(fields[0], fields[1])
+			}
+			if e == nil {
+				return nil, errors.New(fmt.Sprintf("ingest: service %s has no endpoint %s", d.Callee, d.Endpoint))
+			}
+			es = []*Endpoint{e}
+		}
+		label(d.Caller, nil)
+		label(d.Callee, nil)
+		for _, e := range es {
+			label(d.Caller, append(append(grok.Annotation{}, e.Request...), e.Response...))
+			label(d.Callee, append(append(grok.Annotation{}, e.Request...), e.Response...))
+			if len(e.Request) > 0 {
+				g.AddFlow(d.Caller, d.Callee)
+			}
+			if len(e.Response) > 0 {
+				g.AddFlow(d.Callee, d.Caller)
+			}
+		}
+	}
+	for _, s := range services {
+		an := distinct(ans[s])
+		if n := g.Node(s); n != nil {
+			an = distinct(append(append(grok.Annotation{}, n.Annotation...), an...))
+		}
+		g.AddNode(s, an)
+	}
+	return g, nil
+}
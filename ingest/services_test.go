@@ -0,0 +1,63 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok/graph"
+)
+
+func TestServiceGraph(t *testing.T) {
+	p := policy(t)
+	api, err := LoadOpenAPI(strings.NewReader(spec), p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	deps, err := LoadDependencies(strings.NewReader(`[
+		{"caller": "web", "callee": "users", "endpoint": "GET /users/me"},
+		{"caller": "admin", "callee": "users", "endpoint": "PUT /users/42"}
+	]`))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	g, err := ServiceGraph(nil, map[string]*API{"users": api}, deps)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	annotations := []struct {
+		service string
+		want    string
+	}{
+		{"web", "DataType UniqueID"},
+		{"users", "DataType UniqueID DataType AccountID DataType IPAddress"},
+		{"admin", "DataType AccountID DataType IPAddress"},
+	}
+	for _, a := range annotations {
+		if n := g.Node(a.service); n == nil || n.Annotation.String() != a.want {
+			t.Errorf("%s = %v, want %q", a.service, n, a.want)
+		}
+	}
+	// the response of GET /users/me flows back to web, the request of PUT to users
+	want := []graph.Flow{{From: "users", To: "web"}, {From: "admin", To: "users"}}
+	if len(g.Flows) != len(want) || g.Flows[0] != want[0] || g.Flows[1] != want[1] {
+		t.Errorf("Flows = %v, want %v", g.Flows, want)
+	}
+	// a UniqueID may be an IPAddress and an AccountID, which web gets too
+	if vs := graph.CheckGraph(p, g); len(vs) != 3 || vs[0].Node != "admin" || vs[1].Node != "users" {
+		t.Errorf("CheckGraph() = %v", vs)
+	}
+
+	bad := []Dependency{
+		{Caller: "web", Callee: "billing"},
+		{Caller: "web", Callee: "users", Endpoint: "DELETE /users/42"},
+		{Caller: "web", Callee: "users", Endpoint: "/users/42"},
+	}
+	for _, d := range bad {
+		if _, err := ServiceGraph(nil, map[string]*API{"users": api}, []Dependency{d}); err == nil {
+			t.Errorf("ServiceGraph(%v) should fail", d)
+		}
+	}
+	if _, err := LoadDependencies(strings.NewReader(`[{"caller": "web"}]`)); err == nil {
+		t.Errorf("LoadDependencies() without a callee should fail")
+	}
+}
@@ -0,0 +1,213 @@
+package grok
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A Clause (or an Annotation) is serialized to JSON as an array of pairs, where
+// a pair is an array of its attribute name and value, followed by the
+// compatibility attribute of the pair if any, and by the RFC 3339 time the
+// value expires at if any (see Until):
+//
+//	[["DataType", "IPAddress"], ["Purpose", "Analytics", "CollectedFor"],
+//	 ["Consent", "Given", "", "2021-06-01T00:00:00Z"]]
+//
+// Unmarshalling doesn't validate the values against lattices, but expands the
+// ALLOF sets into a pair per element, like parsing does.
+
+// MarshalJSON implements json.Marshaler
+func (c Clause) MarshalJSON() ([]byte, error) {
+	ps := make([][]string, 0, len(c))
+	for _, p := range c {
+		if !p.expires.IsZero() {
+			ps = append(ps, []string{p.name, p.value, p.compatWith, p.expires.Format(time.RFC3339Nano)})
+		} else if p.compatWith != "" {
+			ps = append(ps, []string{p.name, p.value, p.compatWith})
+		} else {
+			ps = append(ps, []string{p.name, p.value})
+		}
+	}
+	return json.Marshal(ps)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (c *Clause) UnmarshalJSON(b []byte) error {
+	var ps [][]string
+	if err := json.Unmarshal(b, &ps); err != nil {
+		return err
+	}
+	clause := make(Clause, 0, len(ps))
+	for _, p := range ps {
+		var pa pair
+		switch len(p) {
+		case 2:
+			pa = pair{name: p[0], value: p[1]}
+		case 3:
+			pa = pair{name: p[0], value: p[1], compatWith: p[2]}
+		case 4:
+			t, err := time.Parse(time.RFC3339Nano, p[3])
+			if err != nil {
+				return errors.New(fmt.Sprintf("policy: pair %s %s expires at an invalid time: %s", p[0], p[1], err))
+			}
+			pa = pair{name: p[0], value: p[1], compatWith: p[2], expires: t}
+		default:
+			return errors.New("policy: pair should be composed of a name and a value")
+		}
+		if kind, members, ok := parseValueSet(pa.value); ok && kind == AllOf {
+			for _, m := range members {
+				pa.value = m
+				clause = append(clause, pa)
+			}
+			continue
+		}
+		clause = append(clause, pa)
+	}
+	*c = clause
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (an Annotation) MarshalJSON() ([]byte, error) {
+	return Clause(an).MarshalJSON()
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (an *Annotation) UnmarshalJSON(b []byte) error {
+	return (*Clause)(an).UnmarshalJSON(b)
+}
+
+// A Policy is serialized to JSON with its rule, and the names of the lattices
+// it's based on rather than the lattices themselves:
+//
+//	{"version": 2, "id": "no-joins", "mode": true, "clause": [["DataType", "TOP"]],
+//	 "excepts": [{"mode": false, "clause": [["DataType", "IPAddress"], ["DataType", "AccountID"]]}],
+//	 "lattices": ["DataType"], "numerics": ["Retention"]}
+//
+// The numeric and compatibility attributes, the derivation rules and the
+// settings of the policy (e.g. its Selector and Constraints) are serialized
+// too. An unmarshalled policy must be bound to its
+// lattices (see Bind) before it's used, or be loaded with UnmarshalPolicy.
+
+// PolicyJSONVersion is the version of the JSON of policies. Version 2 added
+// the settings of the policy, and the JSON of version 1 has no version.
+const PolicyJSONVersion = 2
+
+// policyJSON is the JSON representation of a policy
+type policyJSON struct {
+	Version int    `json:"version"`
+	ID      string `json:"id,omitempty"`
+	policySnapshot
+	policySettings
+	Lattices        []string                `json:"lattices"`
+	Numerics        []string                `json:"numerics,omitempty"`
+	Compatibilities []compatibilitySnapshot `json:"compatibilities,omitempty"`
+	Derivations     []string                `json:"derivations,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (p Policy) MarshalJSON() ([]byte, error) {
+	if p.unbound != nil {
+		return json.Marshal(p.unbound)
+	}
+	pj := policyJSON{Version: PolicyJSONVersion, ID: p.ID, policySnapshot: p.snapshot(), policySettings: p.settings(),
+		Lattices: p.latticeNames(), Numerics: p.numericNames()}
+	if len(p.compats) > 0 {
+		pj.Compatibilities = p.compatibilitySnapshots()
+	}
+	for _, r := range p.Derivations {
+		pj.Derivations = append(pj.Derivations, r.String())
+	}
+	return json.Marshal(&pj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The policy isn't bound to its
+// lattices.
+func (p *Policy) UnmarshalJSON(b []byte) error {
+	var pj policyJSON
+	if err := json.Unmarshal(b, &pj); err != nil {
+		return err
+	}
+	if pj.Version > PolicyJSONVersion {
+		return errors.New(fmt.Sprintf("policy: unsupported version %d", pj.Version))
+	}
+	if len(pj.Lattices) == 0 {
+		return errors.New("policy: policy isn't based on any lattice")
+	}
+	*p = Policy{ID: pj.ID, Mode: pj.Mode, Monitor: pj.Monitor, Clause: pj.Clause, unbound: &pj}
+	return nil
+}
+
+// Bind binds an unmarshalled policy to the lattices it's based on, which are
+// looked up by name in ls, and validates its rule against them
+func (p *Policy) Bind(ls []*Lattice) error {
+	pj := p.unbound
+	if pj == nil {
+		return errors.New("policy: policy is already bound")
+	}
+	byName := make(map[string]*Lattice)
+	for _, l := range ls {
+		byName[l.Name] = l
+	}
+	base := make([]*Lattice, 0, len(pj.Lattices))
+	for _, name := range pj.Lattices {
+		if byName[name] == nil {
+			return errors.New(fmt.Sprintf("policy: lattice %s is missing", name))
+		}
+		base = append(base, byName[name])
+	}
+	q := NewPolicy(base)
+	q.ID = pj.ID
+	if err := q.define(pj.Numerics, pj.Compatibilities, pj.Derivations); err != nil {
+		return err
+	}
+	if err := q.setSettings(pj.policySettings); err != nil {
+		return err
+	}
+	pp := q.restore(pj.policySnapshot)
+	if err := pp.checkBound(); err != nil {
+		return err
+	}
+	q.Mode, q.Monitor, q.Clause, q.Excepts = pp.Mode, pp.Monitor, pp.Clause, pp.Excepts
+	q.hasMonitor = q.monitorsExceptions()
+	*p = *q
+	return nil
+}
+
+// checkBound returns an error when the policy or its exceptions have invalid
+// values, or exceptions of the same mode
+func (p *Policy) checkBound() error {
+	if err := p.validateValues(p.Clause, false); err != nil {
+		return err
+	}
+	if p.Clause.hasAnyOf() {
+		return errors.New("policy: " + AnyOf + " sets are only allowed in annotations")
+	}
+	if p.hasUnclassified(p.Clause) {
+		return errUnclassifiedClause
+	}
+	for i := range p.Excepts {
+		if p.Excepts[i].Mode == p.Mode {
+			return errors.New("policy: except clause doesn't have the opposite mode")
+		}
+		if err := p.Excepts[i].checkBound(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalPolicy returns the policy unmarshalled from JSON, bound to its
+// lattices in ls
+func UnmarshalPolicy(b []byte, ls []*Lattice) (*Policy, error) {
+	p := &Policy{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, err
+	}
+	if err := p.Bind(ls); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
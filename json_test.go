@@ -0,0 +1,69 @@
+package grok
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPolicyJSON(t *testing.T) {
+	p := newBudgetPolicy(t, "ALLOW DataType TOP Epsilon <=1.0 EXCEPT { DENY MODE=monitor DataType IPAddress DataType AccountID DENY DataType Location }")
+	p.ID = "no-joins"
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	var q Policy
+	if err := json.Unmarshal(b, &q); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if q.ID != "no-joins" || !q.Mode || q.baseOn != nil {
+		t.Errorf("Unmarshal() = %+v", q)
+	}
+	// an unbound policy marshals as it was unmarshalled
+	if rb, err := json.Marshal(q); err != nil || string(rb) != string(b) {
+		t.Errorf("Marshal() of an unbound policy = %s, %v, want %s", rb, err, b)
+	}
+	if err := q.Bind(p.lattices()); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if q.String() != p.String() || !q.isNumeric(Epsilon) || len(q.Excepts[0].baseOn) != 1 {
+		t.Errorf("Bind() = %s, want %s", q.String(), p.String())
+	}
+	for _, astr := range []string{"DataType Location", "DataType IPAddress DataType AccountID", "DataType UniqueID Epsilon 0.5"} {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got, want := q.Evaluate(an), p.Evaluate(an); got.Allowed != want.Allowed || got.Monitored != want.Monitored {
+			t.Errorf("Evaluate(%s) = %+v, want %+v", astr, got, want)
+		}
+	}
+	if err := q.Bind(p.lattices()); err == nil || err.Error() != "policy: policy is already bound" {
+		t.Errorf("Bind() of a bound policy = %v", err)
+	}
+
+	// exceptions are marshalled through their policy
+	if b, err := json.Marshal(struct{ Rules []*Policy }{[]*Policy{p}}); err != nil || !strings.Contains(string(b), `"lattices":["DataType"]`) {
+		t.Errorf("Marshal() of a field = %s, %v", b, err)
+	}
+
+	errs := []struct {
+		json string
+		err  string
+	}{
+		{`{"mode": true, "clause": [["DataType", "TOP"]]}`, "policy: policy isn't based on any lattice"},
+		{`{"mode": true, "clause": [["Purpose", "TOP"]], "lattices": ["Purpose"]}`, "policy: lattice Purpose is missing"},
+		{`{"mode": true, "clause": [["DataType", "Birthday"]], "lattices": ["DataType"]}`, "policy: Birthday is not a valid value in lattice DataType"},
+		{`{"mode": true, "clause": [["DataType", "TOP"]], "excepts": [{"mode": true}], "lattices": ["DataType"]}`,
+			"policy: except clause doesn't have the opposite mode"},
+		{`{"mode": true, "clause": [["DataType", "ANYOF(Location,AccountID)"]], "lattices": ["DataType"]}`,
+			"policy: ANYOF sets are only allowed in annotations"},
+	}
+	for _, c := range errs {
+		if _, err := UnmarshalPolicy([]byte(c.json), p.lattices()); err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("UnmarshalPolicy(%s) = %v, want %s", c.json, err, c.err)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync/atomic"
 )
 
 type Edge struct {
@@ -15,11 +16,30 @@ type Lattice struct {
 	Name  string
 	// Edges are the edge collections in lattice structure
 	Edges []Edge
-	// state is used to run cartesian product with current lattice. It can be seen
-	// as the state of current lattice. For example, IPAddress:Truncated is a product
-	// of two lattices, where IPAddress is from DataType lattice, and Truncated is
-	// from TypeState lattice.
-	state *Lattice
+	// product (a *Lattice) is used to run cartesian product with current lattice.
+	// It can be seen as the state of current lattice. For example,
+	// IPAddress:Truncated is a product of two lattices, where IPAddress is from
+	// DataType lattice, and Truncated is from TypeState lattice.
+	product atomic.Value
+	// Weights are the sensitivity weights of elements, used to derive the
+	// severity of findings. Elements without a weight have weight 0.
+	Weights map[string]int
+	// Labels are the display names of elements per locale, e.g.
+	// Labels["de"]["IPAddress"] is "IP-Adresse"
+	Labels map[string]map[string]string
+	// Deprecated are the deprecated elements and their replacements, empty
+	// for the elements without replacement (see Deprecate)
+	Deprecated map[string]string
+	// children and parents index the edges by element, for len(Edges) == indexed
+	children, parents map[string][]string
+	indexed           int
+	// compiled (a *closure) is the compiled closure of the lattice, see Compile
+	compiled atomic.Value
+	// components are the component lattices of a product lattice, see ProductOf
+	components []*Lattice
+	// steps counts the edges visited by the walks of a copy of the lattice
+	// that spends a budget, see counting
+	steps *int
 }
 
 const (
@@ -44,8 +64,16 @@ const (
 //   AccountID   IPAddress
 //          \     /
 //          BOTTOM
-
-// NewLattice returns a Lattice instance that is parsed from a string
+// an optional "weights" object maps elements to their sensitivity weights, e.g.
+//  "weights": { "AccountID": 3, "IPAddress": 2 }
+// and an optional "labels" object maps locales to the display names of elements, e.g.
+//  "labels": { "de": { "IPAddress": "IP-Adresse" } }
+// and an optional "deprecated" object maps deprecated elements to their replacements, e.g.
+//  "deprecated": { "IPAddress": "NetworkAddress" }
+
+// NewLattice returns a Lattice instance that is parsed from a string. It
+// doesn't validate the definition: see NewLatticeE for definitions that may
+// be invalid.
 func NewLattice(str string) *Lattice {
 	var result map[string]interface{}
 	if err := json.Unmarshal([]byte(str), &result); err != nil {
@@ -53,10 +81,12 @@ func NewLattice(str string) *Lattice {
 	}
 
 	lattice := parse(result)
+	lattice.autoCompile()
 	return &lattice
 }
 
-// NewLattices returns a slice of Lattice instances that are parsed from a string
+// NewLattices returns a slice of Lattice instances that are parsed from a
+// string, without validating them like NewLatticesE does
 func NewLattices(str string) []*Lattice {
 	var result []map[string]interface{}
 	if err := json.Unmarshal([]byte(str), &result); err != nil {
@@ -65,6 +95,7 @@ func NewLattices(str string) []*Lattice {
 	lattices := make([]*Lattice, 0)
 	for _, m := range result {
 		l := parse(m)
+		l.autoCompile()
 		lattices = append(lattices, &l)
 	}
 	return lattices
@@ -77,7 +108,14 @@ func parse(m map[string]interface{}) Lattice {
 
 	var edges []Edge
 	ses := make([]string, 0)     // singleton elements in JSON defintions
-	for from, tos := range edgeMap { // edge_from, edge_tos
+	// edges are in the order of their elements, whatever the order of the map
+	keys := make([]string, 0, len(edgeMap))
+	for from := range edgeMap {
+		keys = append(keys, from)
+	}
+	sort.Strings(keys)
+	for _, from := range keys { // edge_from, edge_tos
+		tos := edgeMap[from]
 		if len(tos.([]interface{})) == 0 {
 			ses = append(ses, from)
 			continue
@@ -87,27 +125,70 @@ func parse(m map[string]interface{}) Lattice {
 		}
 	}
 
+	edges = completeEdges(edges, ses)
+
+	weights := make(map[string]int)
+	if wm, ok := m["weights"].(map[string]interface{}); ok {
+		for e, w := range wm {
+			if f, ok := w.(float64); ok {
+				weights[e] = int(f)
+			}
+		}
+	}
+
+	labels := make(map[string]map[string]string)
+	if lm, ok := m["labels"].(map[string]interface{}); ok {
+		for locale, em := range lm {
+			labels[locale] = make(map[string]string)
+			for e, label := range em.(map[string]interface{}) {
+				labels[locale][e] = label.(string)
+			}
+		}
+	}
+
+	deprecated := make(map[string]string)
+	if dm, ok := m["deprecated"].(map[string]interface{}); ok {
+		for e, r := range dm {
+			if s, ok := r.(string); ok {
+				deprecated[e] = s
+			}
+		}
+	}
+
+	l := Lattice{Name: name, Edges: edges, Weights: weights, Labels: labels, Deprecated: deprecated}
+	l.indexEdges()
+	return l
+}
+
+// completeEdges appends to edges the edges from TOP to the elements without
+// parents, the edges from the elements without children to BOTTOM, and the
+// edges through the singleton elements
+func completeEdges(edges []Edge, ses []string) []Edge {
 	// filter out "from" (i.e. "start") elements from all edges,
 	// and filter out "to" (i.e. "end") elements from all edges
 	froms := make([]string, 0)
 	tos := make([]string, 0)
+	isFrom := make(map[string]bool)
+	isTo := make(map[string]bool)
 	for _, edge := range edges {
-		if !contains(froms, edge.From) {
+		if !isFrom[edge.From] {
+			isFrom[edge.From] = true
 			froms = append(froms, edge.From)
 		}
-		if !contains(tos, edge.To) {
+		if !isTo[edge.To] {
+			isTo[edge.To] = true
 			tos = append(tos, edge.To)
 		}
 	}
 
 	// append edges that are from TOP, and edges that are connected to BOTTOM
 	for _, f := range froms {
-		if !contains(tos, f) {
+		if !isTo[f] {
 			edges = append(edges, Edge{Top, f})
 		}
 	}
 	for _, t := range tos {
-		if !contains(froms, t) {
+		if !isFrom[t] {
 			edges = append(edges, Edge{t, Bottom})
 		}
 	}
@@ -118,13 +199,51 @@ func parse(m map[string]interface{}) Lattice {
 		// edges = append(edges, Edge{se, "BOTTOM"})
 		edges = append(edges, Edge{Top, se}, Edge{se, Bottom})
 	}
+	return edges
+}
+
+// indexEdges builds the adjacency maps of the edges. The maps are only used
+// while the edges keep the same length, so that appending edges (or
+// building a Lattice without NewLattice) falls back on scanning them.
+func (l *Lattice) indexEdges() {
+	l.children = make(map[string][]string)
+	l.parents = make(map[string][]string)
+	for _, e := range l.Edges {
+		l.children[e.From] = append(l.children[e.From], e.To)
+		l.parents[e.To] = append(l.parents[e.To], e.From)
+	}
+	l.indexed = len(l.Edges)
+}
 
-	return Lattice{name, edges, nil}
+// isIndexed returns true when the adjacency maps are up to date
+func (l *Lattice) isIndexed() bool {
+	return l.children != nil && l.indexed == len(l.Edges)
+}
+
+// adjacent returns the sorted elements adjacent to nodes in adjacency map
+// adj (after removing duplicates)
+func adjacent(adj map[string][]string, nodes []string) []string {
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, n := range nodes {
+		for _, a := range adj[n] {
+			if !seen[a] {
+				seen[a] = true
+				res = append(res, a)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
 }
 
 
 // childrenOf returns children elements of input nodes (after removing duplicates)
 func (l *Lattice) childrenOf(nodes []string) []string {
+	l.walked(l.children, nodes)
+	if l.isIndexed() {
+		return adjacent(l.children, nodes)
+	}
 	ch := make([]string, 0)
 	for _, e := range l.Edges {
 		if contains(nodes, e.From) && !contains(ch, e.To) {
@@ -137,16 +256,45 @@ func (l *Lattice) childrenOf(nodes []string) []string {
 	return ch
 }
 
-// Product sets its state lattice for current lattice. And the lattice still 
-// keeps its behaviour as a single lattice
+// Product sets the state lattice of the lattice, e.g. TypeState for DataType.
+// The lattice still behaves as a single lattice, and also takes product values
+// a:s of one of its elements and an element of the state lattice, e.g.
+// IPAddress:Truncated, which are ordered componentwise. Its values without a
+// state have state TOP. A lattice has a single state lattice, see ProductOf
+// for the product of several lattices.
 func (l *Lattice) Product(la *Lattice) {
 	if la != nil {
-		l.state = la
+		l.product.Store(la)
 	}
 }
 
+// clone returns a copy of the lattice, sharing its edges and compiled closure
+func (l *Lattice) clone() *Lattice {
+	c := l.bare()
+	if s := l.state(); s != nil {
+		c.Product(s)
+	}
+	if cl := l.closure(); cl != nil {
+		c.compiled.Store(cl)
+	}
+	return c
+}
+
+// bare returns a copy of the lattice sharing its edges, without its state
+// lattice and its compiled closure
+func (l *Lattice) bare() *Lattice {
+	return &Lattice{Name: l.Name, Edges: l.Edges, Weights: l.Weights, Labels: l.Labels, Deprecated: l.Deprecated,
+		children: l.children, parents: l.parents, indexed: l.indexed, components: l.components}
+}
+
+// state returns the state lattice of current lattice, or nil
+func (l *Lattice) state() *Lattice {
+	la, _ := l.product.Load().(*Lattice)
+	return la
+}
+
 func (l *Lattice) isProductValue(a string) bool {
-	return l.state != nil && strings.ContainsRune(a, ':')
+	return l.state() != nil && strings.ContainsRune(a, ':')
 }
 
 func (l *Lattice) halve(a string) (string, string) {
@@ -168,13 +316,25 @@ func (l *Lattice) combine(a, b string) string {
 }
 
 
-// Meet returns greated lower bound (infimum, a ^ b) of two elements a and b
+// Meet returns greated lower bound (infimum, a ^ b) of two elements a and b,
+// or BOTTOM when one of them isn't an element of the lattice
 func (l *Lattice) Meet(a, b string) string {
 	// Meet operation for producted lattice
 	if l.isProductValue(a) || l.isProductValue(b) {
 		fsta, snda := l.halve(a)
 		fstb, sndb := l.halve(b)
-		return l.combine(l.Meet(fsta, fstb), l.state.Meet(snda, sndb))
+		return l.combine(l.Meet(fsta, fstb), l.state().Meet(snda, sndb))
+	}
+	// Meet operation for parameterized elements, e.g. Aggregated(k=25)
+	if isParamValue(a, b) {
+		return l.meetParam(a, b)
+	}
+	if m, ok := l.meetCompiled(a, b); ok {
+		return m
+	}
+	// the walk below never meets an element that isn't in the lattice
+	if !l.hasElement(a) || !l.hasElement(b) {
+		return Bottom
 	}
 
 	nodea := []string{a}
@@ -208,6 +368,10 @@ func (l *Lattice) Meet(a, b string) string {
 
 // parentsOf returns parents of a slice of elements in lattice (after removing duplicates)
 func (l *Lattice) parentsOf(nodes []string) []string {
+	l.walked(l.parents, nodes)
+	if l.isIndexed() {
+		return adjacent(l.parents, nodes)
+	}
 	pa := make([]string, 0)
 	for _, e := range l.Edges {
 		if contains(nodes, e.To) && !contains(pa, e.From) {
@@ -220,13 +384,25 @@ func (l *Lattice) parentsOf(nodes []string) []string {
 	return pa
 }
 
-// Join returns the least upper bound (supremum, a ∨ b) of two elements a and b
+// Join returns the least upper bound (supremum, a ∨ b) of two elements a and b,
+// or TOP when one of them isn't an element of the lattice
 func (l *Lattice) Join(a, b string) string {
 	// Join operation for producted lattice
 	if l.isProductValue(a) || l.isProductValue(b) {
 		fsta, snda := l.halve(a)
 		fstb, sndb := l.halve(b)
-		return l.combine(l.Join(fsta, fstb), l.state.Join(snda, sndb))
+		return l.combine(l.Join(fsta, fstb), l.state().Join(snda, sndb))
+	}
+	// Join operation for parameterized elements, e.g. Aggregated(k=25)
+	if isParamValue(a, b) {
+		return l.joinParam(a, b)
+	}
+	if j, ok := l.joinCompiled(a, b); ok {
+		return j
+	}
+	// the walk below never joins an element that isn't in the lattice
+	if !l.hasElement(a) || !l.hasElement(b) {
+		return Top
 	}
 
 	nodea := []string{a}
@@ -266,13 +442,21 @@ func (l *Lattice) Precede(a, b string) bool {
 	if l.isProductValue(a) || l.isProductValue(b) {
 		fsta, snda := l.halve(a)
 		fstb, sndb := l.halve(b)
-		return l.Precede(fsta, fstb) && l.state.Precede(snda, sndb)
+		return l.Precede(fsta, fstb) && l.state().Precede(snda, sndb)
+	}
+	// Precede operation for parameterized elements, e.g. Aggregated(k=25)
+	if isParamValue(a, b) {
+		return l.precedeParam(a, b)
+	}
+	if r, ok := l.precedeCompiled(a, b); ok {
+		return r
 	}
 
 	chb := []string{b}   // b and its children
 
 	for {
-		if len(chb) == 1 && chb[0] == Bottom {
+		// chb is empty below an element that isn't in the lattice
+		if len(chb) == 0 || (len(chb) == 1 && chb[0] == Bottom) {
 			return false
 		} else if contains(chb, a) {
 			return true
@@ -284,6 +468,9 @@ func (l *Lattice) Precede(a, b string) bool {
 
 // Allow returns true when annotation attributes are allowed by policy clause T[c].
 func (l *Lattice) Allow(pattrs, aattrs []string) bool {
+	if allowed, ok := l.allowCompiled(pattrs, aattrs); ok {
+		return allowed
+	}
 	for _, aattr := range aattrs {
 		allowed := false
 		for _, pattr := range pattrs {
@@ -319,24 +506,62 @@ func (l *Lattice) overlap(pattrs, aattrs []string) []string {
 	return res
 }
 
+// Overlap returns the overlaps of policy attributes and annotation attributes
+// (Tₓ ⨅ T'ₓ from paper): for every policy attribute, the join of its meets with
+// the annotation attributes. The overlaps are deduplicated and sorted by name,
+// so that they don't depend on the order of the inputs.
+func (l *Lattice) Overlap(pattrs, aattrs []string) []string {
+	res := make([]string, 0)
+	for _, o := range l.overlap(pattrs, aattrs) {
+		if !contains(res, o) {
+			res = append(res, o)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
 // Deny returns true when annotation attributes are denied by policy clause T[c] (⊥ ∉ Tₓ from paper)
 func (l *Lattice) Deny(pattrs, aattrs []string) bool {
 	overlaps := l.overlap(pattrs, aattrs)
 	for _, ol := range overlaps {
-		if l.isProductValue(ol) {
-			fst, snd := l.halve(ol)
-			if (fst == Bottom || snd == Bottom) {
-				return false
-			}
-		} else {
-			if ol == Bottom {
-				return false
-			}
+		if l.isBottom(ol) {
+			return false
 		}
 	}
 	return true
 }
 
+// Elements returns the sorted elements of the lattice, including TOP and BOTTOM
+func (l *Lattice) Elements() []string {
+	es := make([]string, 0)
+	for _, e := range l.Edges {
+		if !contains(es, e.From) {
+			es = append(es, e.From)
+		}
+		if !contains(es, e.To) {
+			es = append(es, e.To)
+		}
+	}
+	sort.Strings(es)
+	return es
+}
+
+// hasElement returns true when a (or the base element of a parameterized a) is
+// an element of the lattice
+func (l *Lattice) hasElement(a string) bool {
+	a = baseOf(a)
+	if l.isIndexed() {
+		return len(l.children[a]) > 0 || len(l.parents[a]) > 0
+	}
+	for _, e := range l.Edges {
+		if a == e.From || a == e.To {
+			return true
+		}
+	}
+	return false
+}
+
 // contains returns a boolean when a slice arr contains a string str
 func contains(arr []string, str string) bool {
 	for _, e := range arr {
@@ -1,6 +1,7 @@
 package grok
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
@@ -25,7 +26,7 @@ func TestNewLattice(t *testing.T) {
 	}{
 		{"name",       lattice.Name,       "DataType"},
 		{"len(edges)", len(lattice.Edges), 9},
-		{"state.name", lattice.state.Name,	"TypeState"},
+		{"state.name", lattice.state().Name,	"TypeState"},
 	}
 	for _, c := range cases {
 		if c.value != c.want {
@@ -153,6 +154,25 @@ func TestPrecede(t *testing.T) {
 	}
 }
 
+func TestUnknownElements(t *testing.T) {
+	compiled := NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"] } }`)
+	compiled.Compile()
+	for _, l := range []*Lattice{lattice, compiled} {
+		if got := l.Meet("AccountID", "Unknown"); got != Bottom {
+			t.Errorf("Meet(AccountID, Unknown) = %s, want %s", got, Bottom)
+		}
+		if got := l.Meet("Unknown", "Unknown"); got != Bottom {
+			t.Errorf("Meet(Unknown, Unknown) = %s, want %s", got, Bottom)
+		}
+		if got := l.Join("Unknown", "AccountID"); got != Top {
+			t.Errorf("Join(Unknown, AccountID) = %s, want %s", got, Top)
+		}
+		if l.Precede("AccountID", "Unknown") || l.Precede("Unknown", "AccountID") {
+			t.Errorf("Precede() with Unknown should be false")
+		}
+	}
+}
+
 func TestAllow(t *testing.T) {
 	cases := []struct {
 		pattrs []string
@@ -191,6 +211,32 @@ func TestOverlap(t *testing.T) {
 	}
 }
 
+func TestExportedOverlap(t *testing.T) {
+	cases := []struct {
+		pattrs []string
+		aattrs []string
+		want   []string
+	}{
+		{[]string{"IPAddress", "AccountID"}, []string{"IPAddress"}, []string{"BOTTOM", "IPAddress"}},
+		{[]string{"AccountID", "IPAddress"}, []string{"IPAddress"}, []string{"BOTTOM", "IPAddress"}},
+		{[]string{"UniqueID", "Location", "UniqueID"}, []string{"IPAddress"}, []string{"IPAddress"}},
+		{[]string{"IPAddress"}, []string{}, []string{}},
+	}
+	for _, c := range cases {
+		got := lattice.Overlap(c.pattrs, c.aattrs)
+		if !equals(got, c.want) {
+			t.Errorf("Overlap(%q, %q) = %q, want %q", c.pattrs, c.aattrs, got, c.want)
+		}
+	}
+
+	// the edges don't depend on the order of the definition
+	a := NewLattice(`{ "name": "L", "edges": { "B": ["D"], "A": ["C", "D"], "E": [] } }`)
+	b := NewLattice(`{ "name": "L", "edges": { "E": [], "A": ["C", "D"], "B": ["D"] } }`)
+	if fmt.Sprint(a.Edges) != fmt.Sprint(b.Edges) {
+		t.Errorf("Edges = %v and %v", a.Edges, b.Edges)
+	}
+}
+
 func TestDeny(t *testing.T) {
 	cases := []struct {
 		pattrs []string
@@ -244,6 +290,70 @@ func equals(a []string, b []string) bool {
 	return true
 }
 
+func TestIndexedEdges(t *testing.T) {
+	l := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	if !l.isIndexed() {
+		t.Fatalf("NewLattice() should index the edges")
+	}
+	if got := l.childrenOf([]string{"UniqueID", "Location"}); !equals(got, []string{"AccountID", "IPAddress"}) {
+		t.Errorf("childrenOf() = %q", got)
+	}
+	if got := l.parentsOf([]string{"IPAddress"}); !equals(got, []string{"Location", "UniqueID"}) {
+		t.Errorf("parentsOf() = %q", got)
+	}
+
+	// appended edges are seen by scanning them
+	l.Edges = append(l.Edges, Edge{"IPAddress", "Subnet"})
+	if l.isIndexed() || !l.hasElement("Subnet") {
+		t.Errorf("appended edges should be seen")
+	}
+	if got := l.childrenOf([]string{"IPAddress"}); !equals(got, []string{"BOTTOM", "Subnet"}) {
+		t.Errorf("childrenOf() = %q", got)
+	}
+}
+
+// largeLattice returns a lattice of layers of width elements, where every
+// element has two children in the next layer: about 50k edges by default
+func largeLattice(layers, width int) *Lattice {
+	edges := make(map[string][]string)
+	for k := 0; k < layers-1; k++ {
+		for i := 0; i < width; i++ {
+			edges[fmt.Sprintf("E%d_%d", k, i)] = []string{
+				fmt.Sprintf("E%d_%d", k+1, i), fmt.Sprintf("E%d_%d", k+1, (i+1)%width)}
+		}
+	}
+	b, _ := json.Marshal(map[string]interface{}{"name": "Large", "edges": edges})
+	return NewLattice(string(b))
+}
+
+func benchmarkLattice(b *testing.B, indexed bool, fn func(l *Lattice)) {
+	l := largeLattice(50, 500)
+	if !indexed {
+		l.children, l.parents = nil, nil
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn(l)
+	}
+}
+
+func BenchmarkChildrenOfIndexed(b *testing.B) {
+	benchmarkLattice(b, true, func(l *Lattice) { l.childrenOf([]string{"E10_10", "E20_20"}) })
+}
+
+func BenchmarkChildrenOfScan(b *testing.B) {
+	benchmarkLattice(b, false, func(l *Lattice) { l.childrenOf([]string{"E10_10", "E20_20"}) })
+}
+
+func BenchmarkPrecedeIndexed(b *testing.B) {
+	benchmarkLattice(b, true, func(l *Lattice) { l.Precede("E14_13", "E10_10") })
+}
+
+func BenchmarkPrecedeScan(b *testing.B) {
+	benchmarkLattice(b, false, func(l *Lattice) { l.Precede("E14_13", "E10_10") })
+}
+
 func setup() {
 	fmt.Println("setup")
 	var state = NewLattice(`{
@@ -0,0 +1,183 @@
+package grok
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// LatticeReplay is the outcome of the replay of recorded decisions with a
+// lattice change, the evidence to approve or reject a taxonomy change
+type LatticeReplay struct {
+	Lattice string
+	// Replayed counts the records of the policies based on the lattice, of
+	// which Flipped have another effect with the new version, and Stale
+	// reference elements that the new version removes
+	Replayed, Flipped, Stale int
+	// Missing counts the records of the policies that weren't given
+	Missing int
+	// Policies are the counts by policy ID, sorted by ID
+	Policies []FlipCount
+	// Elements are the counts by element of the old version in the recorded
+	// annotations, the most flipped first
+	Elements []FlipCount
+	// Examples are flipped records, at most MaxImpactExamples
+	Examples []Flip
+}
+
+// FlipCount counts the replayed records of a policy or an element
+type FlipCount struct {
+	Key                      string
+	Replayed, Flipped, Stale int
+}
+
+// Flip is a recorded decision whose effect flips when it's replayed
+type Flip struct {
+	Record Record
+	// Effect is the effect of the replayed decision, ALLOW or DENY
+	Effect string
+}
+
+// String returns the summary of the replay, and a line per policy, e.g.
+//
+//	120 decisions replayed with the change of DataType: 7 flipped, 2 stale, 0 missing
+//	  p1: 80 replayed, 7 flipped, 0 stale
+//	  p2: 40 replayed, 0 flipped, 2 stale
+func (r *LatticeReplay) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d decisions replayed with the change of %s: %d flipped, %d stale, %d missing",
+		r.Replayed, r.Lattice, r.Flipped, r.Stale, r.Missing)
+	for _, c := range r.Policies {
+		fmt.Fprintf(&b, "\n  %s: %d replayed, %d flipped, %d stale", c.Key, c.Replayed, c.Flipped, c.Stale)
+	}
+	return b.String()
+}
+
+// ReplayLatticeChange replays the decisions of a replay file with both
+// versions of a lattice, and reports the decisions whose effect flips, by
+// policy and by element. Records are matched to the policies by their IDs,
+// and the records of failed decisions aren't replayed. Both versions are
+// replayed rather than compared with the recorded effects, so that the
+// changes of the policies since the decisions were recorded aren't counted.
+// The records whose annotation or policy references removed elements can't
+// be decided with the new version, and are stale.
+func ReplayLatticeChange(diff LatticeDiff, ps []*Policy, r io.Reader) (*LatticeReplay, error) {
+	name := diff.Old.Name
+	type versions struct {
+		old, new *Policy
+		stale    bool
+	}
+	policies := make(map[string]versions)
+	for _, p := range ps {
+		if _, ok := p.baseOn[name]; !ok {
+			continue
+		}
+		v := versions{old: p.withLattice(diff.Old), new: p.withLattice(diff.New)}
+		for _, e := range diff.Removed {
+			v.stale = v.stale || p.references(name, e)
+		}
+		policies[p.ID] = v
+	}
+
+	rep := &LatticeReplay{Lattice: name, Policies: make([]FlipCount, 0), Elements: make([]FlipCount, 0),
+		Examples: make([]Flip, 0)}
+	byPolicy := make(map[string]*FlipCount)
+	byElement := make(map[string]*FlipCount)
+	count := func(m map[string]*FlipCount, key string, flipped, stale bool) {
+		c := m[key]
+		if c == nil {
+			c = &FlipCount{Key: key}
+			m[key] = c
+		}
+		c.Replayed++
+		if flipped {
+			c.Flipped++
+		}
+		if stale {
+			c.Stale++
+		}
+	}
+	rr := NewRecordReader(r)
+	for {
+		rec, err := rr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.Error != "" {
+			continue
+		}
+		v, ok := policies[rec.PolicyID]
+		if !ok {
+			rep.Missing++
+			continue
+		}
+		es := elementsOf(diff.Old, rec.Annotation.ValuesOf(name))
+		stale := v.stale
+		for _, e := range es {
+			stale = stale || contains(diff.Removed, e)
+		}
+		flipped := false
+		if !stale {
+			allowed := v.new.Evaluate(rec.Annotation).Allowed
+			if flipped = v.old.Evaluate(rec.Annotation).Allowed != allowed; flipped && len(rep.Examples) < MaxImpactExamples {
+				rep.Examples = append(rep.Examples, Flip{Record: rec, Effect: EffectOf(allowed)})
+			}
+		}
+		rep.Replayed++
+		if flipped {
+			rep.Flipped++
+		}
+		if stale {
+			rep.Stale++
+		}
+		count(byPolicy, rec.PolicyID, flipped, stale)
+		for _, e := range es {
+			count(byElement, e, flipped, stale)
+		}
+	}
+
+	for _, c := range byPolicy {
+		rep.Policies = append(rep.Policies, *c)
+	}
+	sort.Slice(rep.Policies, func(i, j int) bool {
+		return rep.Policies[i].Key < rep.Policies[j].Key
+	})
+	for _, c := range byElement {
+		rep.Elements = append(rep.Elements, *c)
+	}
+	sort.Slice(rep.Elements, func(i, j int) bool {
+		a, b := rep.Elements[i], rep.Elements[j]
+		return a.Flipped > b.Flipped || a.Flipped == b.Flipped && a.Key < b.Key
+	})
+	return rep, nil
+}
+
+// elementsOf returns the distinct elements of values of a lattice: the
+// members of value sets, the first halves of product values, and the base
+// elements of parameterized values
+func elementsOf(l *Lattice, vs []string) []string {
+	es := make([]string, 0, len(vs))
+	var add func(v string)
+	add = func(v string) {
+		if _, members, ok := parseValueSet(v); ok {
+			for _, m := range members {
+				add(m)
+			}
+			return
+		}
+		if l.isProductValue(v) {
+			v, _ = l.halve(v)
+		}
+		if e := baseOf(v); !contains(es, e) {
+			es = append(es, e)
+		}
+	}
+	for _, v := range vs {
+		add(v)
+	}
+	return es
+}
@@ -0,0 +1,82 @@
+package grok
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReplayLatticeChange(t *testing.T) {
+	old := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"], "Birthday": [] } }`)
+	// IPAddress isn't a unique ID anymore, and Birthday is removed
+	new := NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID"], "Location": ["IPAddress"] } }`)
+	ps := make([]*Policy, 0)
+	for i, pstr := range []string{
+		"ALLOW DataType TOP EXCEPT { DENY DataType UniqueID }",
+		"ALLOW DataType Location",
+		"ALLOW DataType TOP EXCEPT { DENY DataType Birthday }",
+	} {
+		p := NewPolicy([]*Lattice{old})
+		if err := p.ParsePolicy(pstr); err != nil {
+			t.Fatalf("%q", err)
+		}
+		p.ID = "p" + string(rune('1'+i))
+		ps = append(ps, p)
+	}
+
+	var buf bytes.Buffer
+	w := NewRecordWriter(&buf)
+	for _, rec := range []struct {
+		policy, astr, err string
+	}{
+		{"p1", "DataType IPAddress", ""},
+		{"p1", "DataType AccountID", ""},
+		{"p1", "DataType Birthday", ""},
+		{"p2", "DataType IPAddress", ""},
+		{"p3", "DataType AccountID", ""},
+		{"p9", "DataType AccountID", ""},
+		{"p1", "DataType IPAddress", ErrBudgetExceeded.Error()},
+	} {
+		an, err := ps[0].ParseAnnotation(rec.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if err := w.Write(Record{Annotation: an, PolicyID: rec.policy, Effect: Deny, Error: rec.err}); err != nil {
+			t.Fatalf("%q", err)
+		}
+	}
+
+	rep, err := ReplayLatticeChange(DiffLattices(old, new), ps, &buf)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if rep.Replayed != 5 || rep.Flipped != 1 || rep.Stale != 2 || rep.Missing != 1 {
+		t.Errorf("ReplayLatticeChange() = %+v", rep)
+	}
+	wantPolicies := []FlipCount{{"p1", 3, 1, 1}, {"p2", 1, 0, 0}, {"p3", 1, 0, 1}}
+	wantElements := []FlipCount{{"IPAddress", 2, 1, 0}, {"AccountID", 2, 0, 1}, {"Birthday", 1, 0, 1}}
+	for _, test := range []struct {
+		got, want []FlipCount
+	}{
+		{rep.Policies, wantPolicies},
+		{rep.Elements, wantElements},
+	} {
+		if len(test.got) != len(test.want) {
+			t.Errorf("counts = %v, want %v", test.got, test.want)
+			continue
+		}
+		for i := range test.want {
+			if test.got[i] != test.want[i] {
+				t.Errorf("counts = %v, want %v", test.got, test.want)
+				break
+			}
+		}
+	}
+	if len(rep.Examples) != 1 || rep.Examples[0].Record.Annotation.String() != "DataType IPAddress" || rep.Examples[0].Effect != Allow {
+		t.Errorf("Examples = %v", rep.Examples)
+	}
+	if s := rep.String(); !strings.HasPrefix(s, "5 decisions replayed with the change of DataType: 1 flipped, 2 stale, 1 missing\n  p1: 3 replayed, 1 flipped, 1 stale") {
+		t.Errorf("String() = %s", s)
+	}
+}
@@ -0,0 +1,211 @@
+// Package latticetest checks that custom lattices satisfy the lattice laws,
+// so that integrators can validate their taxonomies before relying on the
+// semantics of policies based on them:
+//
+//	func TestTaxonomy(t *testing.T) {
+//		latticetest.CheckLaws(t, grok.NewLattice(taxonomy))
+//	}
+//
+// The structure of the lattice is checked first: its edges must be acyclic,
+// TOP and BOTTOM must bound every element, and every two elements must have a
+// least upper bound and a greatest lower bound. Then Meet, Join and Precede
+// are checked against the laws, for every pair (and triple, for associativity)
+// of elements, so that the checks are cubic in the number of elements.
+//
+// Precede is false for BOTTOM, which stands for no data, so that BOTTOM isn't
+// checked against the consistency of Precede with Meet and Join.
+package latticetest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+// MaxErrors is the maximum number of violations that Laws reports
+const MaxErrors = 20
+
+// CheckLaws reports the violations of the lattice laws by a lattice as errors
+// of the test
+func CheckLaws(t testing.TB, l *grok.Lattice) {
+	t.Helper()
+	for _, err := range Laws(l) {
+		t.Error(err)
+	}
+}
+
+// Laws returns the violations of the lattice laws by a lattice, at most
+// MaxErrors of them
+func Laws(l *grok.Lattice) []error {
+	c := &checker{l: l, errs: make([]error, 0)}
+	if c.structure(); len(c.errs) > 0 {
+		// the operations aren't defined on a structure that isn't a lattice
+		return c.errs
+	}
+	c.operations()
+	return c.errs
+}
+
+type checker struct {
+	l    *grok.Lattice
+	es   []string
+	up   map[string]map[string]bool // the elements above every element, itself included
+	errs []error
+}
+
+// errorf adds a violation, and returns false when there are too many
+func (c *checker) errorf(format string, args ...interface{}) bool {
+	if len(c.errs) < MaxErrors {
+		c.errs = append(c.errs, errors.New(fmt.Sprintf("latticetest: %s: ", c.l.Name)+fmt.Sprintf(format, args...)))
+	}
+	return len(c.errs) < MaxErrors
+}
+
+// structure checks the order of the edges
+func (c *checker) structure() {
+	parents := make(map[string][]string)
+	for _, e := range c.l.Edges {
+		parents[e.To] = append(parents[e.To], e.From)
+	}
+	c.es = c.l.Elements()
+	c.up = make(map[string]map[string]bool)
+	for _, a := range c.es {
+		up := map[string]bool{a: true}
+		for queue := []string{a}; len(queue) > 0; queue = queue[1:] {
+			for _, p := range parents[queue[0]] {
+				if !up[p] {
+					up[p] = true
+					queue = append(queue, p)
+				}
+			}
+		}
+		c.up[a] = up
+	}
+
+	for i, a := range c.es {
+		for _, b := range c.es[i+1:] {
+			if c.up[a][b] && c.up[b][a] && !c.errorf("%s and %s are in a cycle", a, b) {
+				return
+			}
+		}
+	}
+	for _, a := range c.es {
+		if !c.up[a][grok.Top] && !c.errorf("%s isn't below TOP", a) {
+			return
+		}
+		if !c.up[grok.Bottom][a] && !c.errorf("%s isn't above BOTTOM", a) {
+			return
+		}
+	}
+	if len(c.errs) > 0 {
+		return
+	}
+	for i, a := range c.es {
+		for _, b := range c.es[i+1:] {
+			if _, bounds := c.bound(a, b, true); len(bounds) != 1 &&
+				!c.errorf("%s and %s have no least upper bound, but %s", a, b, strings.Join(bounds, ", ")) {
+				return
+			}
+			if _, bounds := c.bound(a, b, false); len(bounds) != 1 &&
+				!c.errorf("%s and %s have no greatest lower bound, but %s", a, b, strings.Join(bounds, ", ")) {
+				return
+			}
+		}
+	}
+}
+
+// above returns true when a is above b in the order of the edges
+func (c *checker) above(a, b string) bool {
+	return c.up[b][a]
+}
+
+// bound returns the least upper bound (or the greatest lower bound) of two
+// elements, and the minimal upper bounds (or the maximal lower bounds), which
+// are the bound alone in a lattice
+func (c *checker) bound(a, b string, upper bool) (string, []string) {
+	bounds := make([]string, 0)
+	for _, e := range c.es {
+		if upper && c.above(e, a) && c.above(e, b) || !upper && c.above(a, e) && c.above(b, e) {
+			bounds = append(bounds, e)
+		}
+	}
+	extreme := make([]string, 0)
+	for _, e := range bounds {
+		ok := true
+		for _, f := range bounds {
+			if f != e && (upper && c.above(e, f) || !upper && c.above(f, e)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			extreme = append(extreme, e)
+		}
+	}
+	sort.Strings(extreme)
+	if len(extreme) == 1 {
+		return extreme[0], extreme
+	}
+	return "", extreme
+}
+
+// operations checks Meet, Join and Precede
+func (c *checker) operations() {
+	l := c.l
+	for _, a := range c.es {
+		if l.Meet(a, a) != a && !c.errorf("Meet(%s, %s) = %s, not idempotent", a, a, l.Meet(a, a)) {
+			return
+		}
+		if l.Join(a, a) != a && !c.errorf("Join(%s, %s) = %s, not idempotent", a, a, l.Join(a, a)) {
+			return
+		}
+	}
+	for _, a := range c.es {
+		for _, b := range c.es {
+			meet, join := l.Meet(a, b), l.Join(a, b)
+			if glb, _ := c.bound(a, b, false); meet != glb && !c.errorf("Meet(%s, %s) = %s, want %s", a, b, meet, glb) {
+				return
+			}
+			if lub, _ := c.bound(a, b, true); join != lub && !c.errorf("Join(%s, %s) = %s, want %s", a, b, join, lub) {
+				return
+			}
+			if meet != l.Meet(b, a) && !c.errorf("Meet(%s, %s) = %s, Meet(%s, %s) = %s, not commutative", a, b, meet, b, a, l.Meet(b, a)) {
+				return
+			}
+			if join != l.Join(b, a) && !c.errorf("Join(%s, %s) = %s, Join(%s, %s) = %s, not commutative", a, b, join, b, a, l.Join(b, a)) {
+				return
+			}
+			if m := l.Meet(a, join); m != a && !c.errorf("Meet(%s, Join(%s, %s)) = %s, not absorbing", a, a, b, m) {
+				return
+			}
+			if j := l.Join(a, meet); j != a && !c.errorf("Join(%s, Meet(%s, %s)) = %s, not absorbing", a, a, b, j) {
+				return
+			}
+			if a != grok.Bottom && l.Precede(a, b) != (meet == a) &&
+				!c.errorf("Precede(%s, %s) = %t, but Meet(%s, %s) = %s", a, b, l.Precede(a, b), a, b, meet) {
+				return
+			}
+			if (meet == a) != (join == b) && !c.errorf("Meet(%s, %s) = %s, but Join(%s, %s) = %s", a, b, meet, a, b, join) {
+				return
+			}
+		}
+	}
+	for _, a := range c.es {
+		for _, b := range c.es {
+			for _, d := range c.es {
+				if x, y := l.Meet(l.Meet(a, b), d), l.Meet(a, l.Meet(b, d)); x != y &&
+					!c.errorf("Meet(Meet(%s, %s), %s) = %s, Meet(%s, Meet(%s, %s)) = %s, not associative", a, b, d, x, a, b, d, y) {
+					return
+				}
+				if x, y := l.Join(l.Join(a, b), d), l.Join(a, l.Join(b, d)); x != y &&
+					!c.errorf("Join(Join(%s, %s), %s) = %s, Join(%s, Join(%s, %s)) = %s, not associative", a, b, d, x, a, b, d, y) {
+					return
+				}
+			}
+		}
+	}
+}
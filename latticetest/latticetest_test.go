@@ -0,0 +1,32 @@
+package latticetest
+
+import (
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func TestCheckLaws(t *testing.T) {
+	CheckLaws(t, grok.NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`))
+	l := grok.NewLattice(`{ "name": "TypeState", "edges": { "Encrypted": [], "Hashed": [], "Truncated": ["Redacted"] } }`)
+	l.Compile()
+	CheckLaws(t, l)
+}
+
+func TestLaws(t *testing.T) {
+	cases := []struct {
+		lattice string
+		err     string
+	}{
+		{`{ "name": "Diamond", "edges": { "A": ["C", "D"], "B": ["C", "D"] } }`,
+			"latticetest: Diamond: A and B have no greatest lower bound, but C, D"},
+		{`{ "name": "Cycle", "edges": { "A": ["B"], "B": ["A"] } }`, "latticetest: Cycle: A and B are in a cycle"},
+	}
+	for _, c := range cases {
+		errs := Laws(grok.NewLattice(c.lattice))
+		if len(errs) == 0 || errs[0].Error() != c.err {
+			t.Errorf("Laws(%s) = %v, want %q first", c.lattice, errs, c.err)
+		}
+	}
+}
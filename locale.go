@@ -0,0 +1,127 @@
+package grok
+
+import (
+	"strings"
+	"sync"
+)
+
+// Locale is the localized display names of elements and explanation templates
+// of a language. See Renderer for the meaning of the maps.
+type Locale struct {
+	Labels    map[string]string
+	Templates map[string]string
+	Words     map[string]string
+}
+
+// Localizer selects the Locale of explanations by locale tag (e.g. "de-CH").
+// A tag falls back to its language ("de"), then to the fallback locale of the
+// localizer, then to the defaults. It is safe for concurrent use.
+type Localizer struct {
+	Fallback string
+	mu       sync.RWMutex
+	locales  map[string]*Locale
+}
+
+// NewLocalizer returns an empty Localizer with a fallback locale tag
+func NewLocalizer(fallback string) *Localizer {
+	return &Localizer{Fallback: fallback, locales: make(map[string]*Locale)}
+}
+
+// Add merges a Locale into the locale of a tag
+func (z *Localizer) Add(tag string, l *Locale) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	curr, ok := z.locales[tag]
+	if !ok {
+		curr = &Locale{make(map[string]string), make(map[string]string), make(map[string]string)}
+		z.locales[tag] = curr
+	}
+	merge(curr.Labels, l.Labels, true)
+	merge(curr.Templates, l.Templates, true)
+	merge(curr.Words, l.Words, true)
+}
+
+// AddLattice adds the display names of the elements of a lattice, for every
+// locale of the lattice
+func (z *Localizer) AddLattice(l *Lattice) {
+	for tag, labels := range l.Labels {
+		z.Add(tag, &Locale{Labels: labels})
+	}
+}
+
+// chain returns the locale tags that a tag resolves to, in order
+func (z *Localizer) chain(tag string) []string {
+	tags := make([]string, 0)
+	for _, t := range []string{tag, strings.SplitN(tag, "-", 2)[0], z.Fallback} {
+		if t != "" && !contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// Renderer returns a Renderer of the locale of a tag
+func (z *Localizer) Renderer(tag string) *Renderer {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	r := &Renderer{Labels: make(map[string]string), Templates: make(map[string]string), Words: make(map[string]string)}
+	for _, t := range z.chain(tag) {
+		if l, ok := z.locales[t]; ok {
+			merge(r.Labels, l.Labels, false)
+			merge(r.Templates, l.Templates, false)
+			merge(r.Words, l.Words, false)
+		}
+	}
+	return r
+}
+
+// merge copies the entries of src into dst, overwriting existing ones if asked
+func merge(dst, src map[string]string, overwrite bool) {
+	for k, v := range src {
+		if _, ok := dst[k]; overwrite || !ok {
+			dst[k] = v
+		}
+	}
+}
+
+// ExplainOption configures ExplainText
+type ExplainOption func(*explainConfig)
+
+type explainConfig struct {
+	locale    string
+	localizer *Localizer
+}
+
+// WithLocale selects the locale of the explanation
+func WithLocale(tag string) ExplainOption {
+	return func(c *explainConfig) {
+		c.locale = tag
+	}
+}
+
+// WithLocalizer selects the localizer providing the locales
+func WithLocalizer(z *Localizer) ExplainOption {
+	return func(c *explainConfig) {
+		c.localizer = z
+	}
+}
+
+// ExplainText applies the policy on an annotation, and returns the explanation
+// in prose. The display names of elements come from the localizer first, then
+// from the labels of the policy lattices.
+func (p *Policy) ExplainText(an Annotation, opts ...ExplainOption) (string, error) {
+	c := explainConfig{localizer: NewLocalizer("")}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	r := c.localizer.Renderer(c.locale)
+	lz := NewLocalizer(c.localizer.Fallback)
+	for _, name := range p.latticeNames() {
+		lz.AddLattice(p.baseOn[name])
+		if s := p.baseOn[name].state(); s != nil {
+			lz.AddLattice(s)
+		}
+	}
+	merge(r.Labels, lz.Renderer(c.locale).Labels, false)
+	return r.Render(p.Trace(an))
+}
@@ -0,0 +1,82 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestLocalizerRenderer(t *testing.T) {
+	z := NewLocalizer("en")
+	z.Add("en", &Locale{Labels: map[string]string{"IPAddress": "IP address", "AccountID": "account ID"}})
+	z.Add("de", &Locale{
+		Labels:    map[string]string{"IPAddress": "IP-Adresse"},
+		Templates: map[string]string{TemplateDenyExcept: "Abgelehnt: {{.Uses}}."},
+		Words:     map[string]string{"together with": "zusammen mit"},
+	})
+	z.Add("de-CH", &Locale{Labels: map[string]string{"IPAddress": "IP-Adrässe"}})
+
+	cases := []struct {
+		tag      string
+		label    string
+		fallback string
+		word     string
+	}{
+		{"de-CH", "IP-Adrässe", "account ID", "zusammen mit"},
+		{"de-AT", "IP-Adresse", "account ID", "zusammen mit"},
+		{"fr", "IP address", "account ID", "together with"},
+	}
+	for _, c := range cases {
+		r := z.Renderer(c.tag)
+		if got := r.Label("IPAddress"); got != c.label {
+			t.Errorf("Renderer(%q).Label(IPAddress) = %q, want %q", c.tag, got, c.label)
+		}
+		if got := r.Label("AccountID"); got != c.fallback {
+			t.Errorf("Renderer(%q).Label(AccountID) = %q, want %q", c.tag, got, c.fallback)
+		}
+		if got := r.word("together with"); got != c.word {
+			t.Errorf("Renderer(%q).word() = %q, want %q", c.tag, got, c.word)
+		}
+	}
+}
+
+func TestExplainText(t *testing.T) {
+	dt := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"] },
+		"labels": {
+			"de": { "IPAddress": "IP-Adresse", "AccountID": "Konto-ID" },
+			"en": { "IPAddress": "IP address" }
+		}
+	}`)
+	p := NewPolicy([]*Lattice{dt})
+	if err := p.ParsePolicy(`ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`); err != nil {
+		t.Fatalf("%q", err)
+	}
+	an, err := p.ParseAnnotation("DataType IPAddress DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	z := NewLocalizer("en")
+	z.Add("de", &Locale{
+		Templates: map[string]string{TemplateDenyExcept: "Abgelehnt, weil das Programm {{.Uses}} verwendet."},
+		Words:     map[string]string{"together with": "zusammen mit"},
+	})
+	cases := []struct {
+		opts []ExplainOption
+		want string
+	}{
+		{nil, "Denied because the program uses IPAddress together with AccountID, which the exception to the global allow forbids."},
+		{[]ExplainOption{WithLocale("en-US")},
+			"Denied because the program uses IP address together with AccountID, which the exception to the global allow forbids."},
+		{[]ExplainOption{WithLocale("de"), WithLocalizer(z)},
+			"Abgelehnt, weil das Programm IP-Adresse zusammen mit Konto-ID verwendet."},
+	}
+	for _, c := range cases {
+		got, err := p.ExplainText(an, c.opts...)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got != c.want {
+			t.Errorf("ExplainText() = %q, want %q", got, c.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package grok
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+// LoggingPurpose is the clause that LogRedactor adds to the annotations of
+// the fields of log records, unless it's given another
+const LoggingPurpose = "Purpose Logging"
+
+// LogRedactor redacts the fields of log records according to a grok policy,
+// applying the engine to the observability output of the package itself: a
+// field is annotated by its data, e.g. client_ip by DataType IPAddress, and
+// the policy decides whether it may be logged for the purpose of logging.
+// The fields it denies are masked by the weakest transform that gets them
+// allowed, e.g. Hashed into HashTransform(salt), and redacted when none does.
+// The fields that aren't annotated are logged as they are.
+type LogRedactor struct {
+	Policy *Policy
+	// transforms are the transforms of the masked fields, nil for the
+	// redacted ones
+	transforms map[string]Transform
+}
+
+// NewLogRedactor decides the masking of the fields of log records with the
+// policy. The purpose is the clause of logging, LoggingPurpose when it's
+// empty, and the transforms implement the states of the state lattices by
+// name, e.g. "Hashed": HashTransform(salt).
+func NewLogRedactor(p *Policy, purpose string, fields map[string]Annotation, transforms map[string]Transform) (*LogRedactor, error) {
+	if purpose == "" {
+		purpose = LoggingPurpose
+	}
+	pan, err := p.ParseAnnotation(purpose)
+	if err != nil {
+		return nil, err
+	}
+	r := &LogRedactor{Policy: p, transforms: make(map[string]Transform)}
+	for f, an := range fields {
+		if p.ApplyOn(append(append(Annotation{}, an...), pan...)) {
+			continue
+		}
+		r.transforms[f] = nil
+		for _, t := range p.Transforms(an) {
+			fn, ok := transforms[t]
+			if !ok {
+				continue
+			}
+			masked := append(Annotation{}, pan...)
+			for _, pa := range an {
+				pa.value = p.mask(pa, t)
+				masked = append(masked, pa)
+			}
+			if p.ApplyOn(masked) {
+				r.transforms[f] = fn
+				break
+			}
+		}
+	}
+	return r, nil
+}
+
+// Redacted returns the fields that are masked or redacted, sorted
+func (r *LogRedactor) Redacted() []string {
+	fs := make([]string, 0, len(r.transforms))
+	for f := range r.transforms {
+		fs = append(fs, f)
+	}
+	sort.Strings(fs)
+	return fs
+}
+
+// Redact returns a copy of the fields of a log record with the denied fields
+// masked, and the redacted ones removed
+func (r *LogRedactor) Redact(fields map[string]string) map[string]string {
+	res := make(map[string]string, len(fields))
+	for f, v := range fields {
+		t, ok := r.transforms[f]
+		if !ok {
+			res[f] = v
+			continue
+		}
+		if t == nil {
+			continue
+		}
+		if v = t(v); v != "" {
+			res[f] = v
+		}
+	}
+	return res
+}
+
+// Print logs a message with the redacted fields of its record, sorted by
+// name, e.g. "denied client_ip=3b1f2a4c5d6e7f80 policy=p1"
+func (r *LogRedactor) Print(l *log.Logger, msg string, fields map[string]string) {
+	fields = r.Redact(fields)
+	names := make([]string, 0, len(fields))
+	for f := range fields {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, f := range names {
+		b.WriteString(" " + f + "=" + fields[f])
+	}
+	l.Print(b.String())
+}
@@ -0,0 +1,54 @@
+package grok
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogRedactor(t *testing.T) {
+	l := NewLattice(`{ "name": "DataType", "edges": { "IPAddress": [], "AccountID": [], "Name": [] } }`)
+	l.Product(NewLattice(`{ "name": "DataState", "edges": { "Hashed": [] } }`))
+	p := NewPolicy([]*Lattice{l, NewLattice(`{ "name": "Purpose", "edges": { "Logging": [], "Analytics": [] } }`)})
+	if err := p.ParsePolicy("ALLOW DataType Name Purpose TOP DataType IPAddress:Hashed Purpose Logging"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	fields := make(map[string]Annotation)
+	for f, astr := range map[string]string{"user": "DataType Name", "client_ip": "DataType IPAddress", "account": "DataType AccountID"} {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		fields[f] = an
+	}
+	hash := HashTransform("salt")
+	r, err := NewLogRedactor(p, "", fields, map[string]Transform{"Hashed": hash})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := strings.Join(r.Redacted(), ","); got != "account,client_ip" {
+		t.Errorf("Redacted() = %s", got)
+	}
+
+	var buf bytes.Buffer
+	r.Print(log.New(&buf, "", 0), "denied", map[string]string{"user": "alice", "client_ip": "10.0.0.1",
+		"account": "42", "policy": "p1"})
+	if got, want := buf.String(), "denied client_ip="+hash("10.0.0.1")+" policy=p1 user=alice\n"; got != want {
+		t.Errorf("Print() = %q, want %q", got, want)
+	}
+
+	// without the transform, denied fields are redacted
+	r, err = NewLogRedactor(p, "Purpose Logging", fields, nil)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	got := r.Redact(map[string]string{"user": "alice", "client_ip": "10.0.0.1"})
+	if len(got) != 1 || got["user"] != "alice" {
+		t.Errorf("Redact() = %v", got)
+	}
+
+	if _, err := NewLogRedactor(p, "Purpose Debugging", fields, nil); err == nil {
+		t.Errorf("NewLogRedactor() should fail on an unknown purpose")
+	}
+}
@@ -0,0 +1,192 @@
+package grok
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxMaskedColumns is the maximum number of columns that PlanMasking masks
+const MaxMaskedColumns = 3
+
+// ColumnMask is a transform of a column, e.g. hashing the column client_ip
+type ColumnMask struct {
+	Column string
+	// Transform is the state of the state lattice (e.g. Hashed or Truncated)
+	// that the values of the column are brought into
+	Transform string
+	// Alternatives are the other transforms of the column that do as well,
+	// the other masks of the plan being the same
+	Alternatives []string
+}
+
+// String returns the mask, e.g. "client_ip: Truncated (or Hashed)"
+func (m ColumnMask) String() string {
+	if len(m.Alternatives) == 0 {
+		return m.Column + ": " + m.Transform
+	}
+	return fmt.Sprintf("%s: %s (or %s)", m.Column, m.Transform, strings.Join(m.Alternatives, ", "))
+}
+
+// MaskingPlan is a list of column transforms that gets data allowed by a
+// policy, for query rewriters and ETL jobs to execute
+type MaskingPlan struct {
+	// Allowed is true when the data is allowed once masked, and false when no
+	// masking of at most MaxMaskedColumns columns gets it allowed
+	Allowed bool
+	// Masks are the transforms, by column
+	Masks []ColumnMask
+}
+
+// String returns the plan in plain words
+func (mp MaskingPlan) String() string {
+	switch {
+	case !mp.Allowed:
+		return fmt.Sprintf("denied, and no masking of at most %d columns gets it allowed", MaxMaskedColumns)
+	case len(mp.Masks) == 0:
+		return "allowed"
+	}
+	masks := make([]string, 0, len(mp.Masks))
+	for _, m := range mp.Masks {
+		masks = append(masks, m.String())
+	}
+	return "allowed once masked: " + strings.Join(masks, "; ")
+}
+
+// PlanMasking returns the least masking of the columns that gets data allowed
+// by the policy, whose obligations are the states of product values, e.g.
+// ALLOW DataType IPAddress:Truncated. The data is annotated by the annotations
+// of its columns, and masking a column with a transform brings its values
+// into the state of the transform, e.g. IPAddress into IPAddress:Truncated.
+// The transforms are the elements of the state lattices, except TOP and
+// BOTTOM, the weakest ones (the least masking) tried first.
+func (p *Policy) PlanMasking(columns map[string]Annotation) MaskingPlan {
+	names := make([]string, 0, len(columns))
+	for c := range columns {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+
+	an := make(Annotation, 0)
+	maskable := make([]string, 0)
+	transforms := make(map[string][]string)
+	for _, c := range names {
+		an = append(an, columns[c]...)
+		if ts := p.Transforms(columns[c]); len(ts) > 0 {
+			maskable = append(maskable, c)
+			transforms[c] = ts
+		}
+	}
+	if p.ApplyOn(an) {
+		return MaskingPlan{Allowed: true, Masks: make([]ColumnMask, 0)}
+	}
+
+	// masked returns the annotation of the data once the columns are masked
+	// with the transforms
+	masked := func(cs, ts []string) Annotation {
+		res := make(Annotation, 0, len(an))
+		for _, c := range names {
+			t := ""
+			for i := range cs {
+				if cs[i] == c {
+					t = ts[i]
+				}
+			}
+			for _, pa := range columns[c] {
+				if t != "" {
+					pa.value = p.mask(pa, t)
+				}
+				res = append(res, pa)
+			}
+		}
+		return res
+	}
+
+	// the masks of d columns, as indexes of maskable columns in increasing
+	// order, and the transforms of the columns
+	var plan []ColumnMask
+	var try func(d, from int, cs, ts []string) bool
+	try = func(d, from int, cs, ts []string) bool {
+		if d == 0 {
+			if !p.ApplyOn(masked(cs, ts)) {
+				return false
+			}
+			plan = make([]ColumnMask, 0, len(cs))
+			for i, c := range cs {
+				m := ColumnMask{Column: c, Transform: ts[i], Alternatives: make([]string, 0)}
+				alt := append([]string(nil), ts...)
+				for _, t := range transforms[c] {
+					if alt[i] = t; t != ts[i] && p.ApplyOn(masked(cs, alt)) {
+						m.Alternatives = append(m.Alternatives, t)
+					}
+				}
+				plan = append(plan, m)
+			}
+			return true
+		}
+		for i := from; i < len(maskable); i++ {
+			c := maskable[i]
+			for _, t := range transforms[c] {
+				if try(d-1, i+1, append(cs, c), append(ts, t)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for d := 1; d <= MaxMaskedColumns && d <= len(maskable); d++ {
+		if try(d, 0, make([]string, 0, d), make([]string, 0, d)) {
+			return MaskingPlan{Allowed: true, Masks: plan}
+		}
+	}
+	return MaskingPlan{Allowed: false, Masks: make([]ColumnMask, 0)}
+}
+
+// Transforms returns the transforms of data annotated by an, e.g. a column,
+// i.e. the elements of the state lattices of its values, the weakest ones
+// first
+func (p *Policy) Transforms(an Annotation) []string {
+	ts := make([]string, 0)
+	for _, pa := range an {
+		l := p.baseOn[pa.name]
+		if l == nil || l.state() == nil {
+			continue
+		}
+		s := l.state()
+		es := filter(s.Elements(), func(e string) bool { return e != Top && e != Bottom && !contains(ts, e) })
+		// the weaker a state, the more states it precedes
+		below := make(map[string]int)
+		for _, e := range es {
+			for _, f := range es {
+				if s.Precede(f, e) {
+					below[e]++
+				}
+			}
+		}
+		sort.SliceStable(es, func(i, j int) bool { return below[es[i]] > below[es[j]] })
+		ts = append(ts, es...)
+	}
+	return ts
+}
+
+// Mask returns the annotation whose values are brought into the state t (see
+// Transforms), the values whose lattice has no such state being kept
+func (p *Policy) Mask(an Annotation, t string) Annotation {
+	res := make(Annotation, 0, len(an))
+	for _, pa := range an {
+		pa.value = p.mask(pa, t)
+		res = append(res, pa)
+	}
+	return res
+}
+
+// mask returns the value of a pair brought into the state t, or the value
+// itself when its lattice has no such state
+func (p *Policy) mask(pa pair, t string) string {
+	l := p.baseOn[pa.name]
+	if l == nil || l.state() == nil || !l.state().hasElement(t) {
+		return pa.value
+	}
+	v, s := l.halve(pa.value)
+	return l.combine(v, l.state().Meet(s, t))
+}
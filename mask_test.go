@@ -0,0 +1,40 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestPlanMasking(t *testing.T) {
+	dt := NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	dt.Product(NewLattice(`{ "name": "TypeState", "edges": { "Encrypted": [], "Hashed": [], "Truncated": ["Redacted"] } }`))
+	cases := []struct {
+		pstr string
+		plan string
+	}{
+		{"ALLOW DataType IPAddress:Truncated DataType AccountID:Hashed",
+			"allowed once masked: account: Hashed; ip: Truncated (or Redacted)"},
+		{"ALLOW DataType IPAddress:Redacted DataType AccountID",
+			"allowed once masked: ip: Redacted"},
+		{"ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID EXCEPT { ALLOW DataType AccountID:Encrypted DataType IPAddress } }",
+			"allowed once masked: account: Encrypted"},
+		{"ALLOW DataType TOP", "allowed"},
+		{"DENY DataType IPAddress", "denied, and no masking of at most 3 columns gets it allowed"},
+	}
+	for _, c := range cases {
+		p := NewPolicy([]*Lattice{dt})
+		if err := p.ParsePolicy(c.pstr); err != nil {
+			t.Fatalf("%q", err)
+		}
+		columns := make(map[string]Annotation)
+		for c, astr := range map[string]string{"ip": "DataType IPAddress", "account": "DataType AccountID"} {
+			an, err := p.ParseAnnotation(astr)
+			if err != nil {
+				t.Fatalf("%q", err)
+			}
+			columns[c] = an
+		}
+		if got := p.PlanMasking(columns).String(); got != c.plan {
+			t.Errorf("PlanMasking [%q] = %q, want %q", c.pstr, got, c.plan)
+		}
+	}
+}
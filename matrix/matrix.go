@@ -0,0 +1,304 @@
+// Package matrix imports policies from decision matrices, the grids where
+// privacy teams write their rules, e.g. data types by purposes:
+//
+//	DataType \ Purpose , Analytics , Sharing                 , Marketing
+//	IPAddress          , allow     , deny                    , allow if Epsilon <= 1.0
+//	AccountID          , allow     , deny                    , deny
+//	Location           , allow     , allow if Epsilon <= 0.5 , allow
+//
+// The corner cell names the attributes of the rows and of the columns, and
+// every other cell decides on the data with the element of its row and the
+// element of its column: allow (or yes), deny (or no), or allow under a
+// numeric condition. Empty cells are allowed.
+//
+// The imported policy allows everything except the denied cells, and the
+// conditional cells whose condition doesn't hold, where the main clause
+// allows any number:
+//
+//	ALLOW DataType TOP Purpose TOP Epsilon <0 Epsilon >=0 EXCEPT {
+//	  DENY DataType IPAddress Purpose Sharing
+//	  DENY DataType IPAddress Purpose Marketing Epsilon >1.0
+//	  ...
+//	}
+//
+// Every cell is then checked against the policy, and the cells that the
+// policy doesn't express, e.g. an allowed element below a denied one in the
+// same column, are reported.
+package matrix
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// Cell is a cell of a matrix that the imported policy doesn't express
+type Cell struct {
+	// Ref is the reference of the cell in the spreadsheet, e.g. C4
+	Ref    string
+	Row    string
+	Column string
+	Value  string
+	Reason string
+}
+
+func (c Cell) String() string {
+	return fmt.Sprintf("%s (%s, %s) %q: %s", c.Ref, c.Row, c.Column, c.Value, c.Reason)
+}
+
+// Report is the result of the import of a matrix
+type Report struct {
+	// Policy is the imported policy in the policy syntax
+	Policy string
+	// Cells is the number of the decision cells of the matrix
+	Cells int
+	// Unexpressed are the cells that the policy doesn't express
+	Unexpressed []Cell
+}
+
+// decision is the decision of a cell: a deny, or an allow, under the
+// condition attr op threshold when attr isn't empty
+type decision struct {
+	deny      bool
+	attr      string
+	op        string
+	threshold float64
+}
+
+// ReadCSV reads the grid of a matrix in CSV
+func ReadCSV(r io.Reader) ([][]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	return cr.ReadAll()
+}
+
+// Import returns the policy of the grid of a matrix, based on the lattices of
+// its rows and its columns, with the report of the cells it doesn't express.
+// The attributes of the conditions are numeric attributes of the policy.
+func Import(grid [][]string, ls []*grok.Lattice) (*grok.Policy, *Report, error) {
+	if len(grid) < 2 || len(grid[0]) < 2 {
+		return nil, nil, errors.New("matrix: the matrix should have a header row and a header column")
+	}
+	rowAttr, colAttr, err := parseCorner(grid[0][0])
+	if err != nil {
+		return nil, nil, err
+	}
+	p := grok.NewPolicy(ls)
+	rep := &Report{Unexpressed: make([]Cell, 0)}
+	for _, attr := range []string{rowAttr, colAttr} {
+		if _, err := p.LatticeName(attr); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("matrix: %s isn't a lattice", attr))
+		}
+	}
+
+	// the decisions of the valid cells, by cell
+	type cell struct {
+		ref, row, col, value string
+		decision
+	}
+	cells := make([]cell, 0)
+	cols := grid[0]
+	for i, row := range grid[1:] {
+		if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		r := strings.TrimSpace(row[0])
+		for j := 1; j < len(row) && j < len(cols); j++ {
+			v := strings.TrimSpace(row[j])
+			if v == "" {
+				continue
+			}
+			rep.Cells++
+			c := cell{ref: Ref(i+1, j), row: r, col: strings.TrimSpace(cols[j]), value: v}
+			if _, err := p.LatticeValue(c.row, rowAttr); err != nil {
+				rep.unexpressed(c.ref, c.row, c.col, v, fmt.Sprintf("%s isn't an element of %s", c.row, rowAttr))
+				continue
+			}
+			if _, err := p.LatticeValue(c.col, colAttr); err != nil {
+				rep.unexpressed(c.ref, c.row, c.col, v, fmt.Sprintf("%s isn't an element of %s", c.col, colAttr))
+				continue
+			}
+			d, err := parseDecision(v)
+			if err != nil {
+				rep.unexpressed(c.ref, c.row, c.col, v, err.Error())
+				continue
+			}
+			if d.attr != "" {
+				if err := p.DefineNumeric(d.attr); err != nil {
+					rep.unexpressed(c.ref, c.row, c.col, v, fmt.Sprintf("%s isn't a numeric attribute", d.attr))
+					continue
+				}
+			}
+			c.decision = d
+			cells = append(cells, c)
+		}
+	}
+
+	// the main clause allows any number, as TOP does for lattices
+	numerics := make([]string, 0)
+	excepts := make([]string, 0)
+	for _, c := range cells {
+		if c.attr != "" && !contains(numerics, c.attr) {
+			numerics = append(numerics, c.attr)
+		}
+		switch {
+		case c.deny:
+			excepts = append(excepts, fmt.Sprintf("DENY %s %s %s %s", rowAttr, c.row, colAttr, c.col))
+		case c.attr != "":
+			excepts = append(excepts, fmt.Sprintf("DENY %s %s %s %s %s %s%s", rowAttr, c.row, colAttr, c.col,
+				c.attr, negations[c.op], strconv.FormatFloat(c.threshold, 'g', -1, 64)))
+		}
+	}
+	rep.Policy = fmt.Sprintf("ALLOW %s TOP %s TOP", rowAttr, colAttr)
+	for _, n := range numerics {
+		rep.Policy += fmt.Sprintf(" %s <0 %s >=0", n, n)
+	}
+	if len(excepts) > 0 {
+		rep.Policy += " EXCEPT { " + strings.Join(excepts, " ") + " }"
+	}
+	if err := p.ParsePolicy(rep.Policy); err != nil {
+		return nil, nil, err
+	}
+
+	// every cell decides as the policy does
+	for _, c := range cells {
+		base := fmt.Sprintf("%s %s %s %s", rowAttr, c.row, colAttr, c.col)
+		if c.attr == "" {
+			if allowed := apply(p, base); allowed == c.deny {
+				rep.unexpressed(c.ref, c.row, c.col, c.value, fmt.Sprintf("the policy %s it", verb(allowed)))
+			}
+			continue
+		}
+		sat, unsat := samples(c.op, c.threshold)
+		switch {
+		case !apply(p, fmt.Sprintf("%s %s %s", base, c.attr, sat)):
+			rep.unexpressed(c.ref, c.row, c.col, c.value, fmt.Sprintf("the policy denies it with %s %s", c.attr, sat))
+		case apply(p, fmt.Sprintf("%s %s %s", base, c.attr, unsat)):
+			rep.unexpressed(c.ref, c.row, c.col, c.value, fmt.Sprintf("the policy allows it with %s %s", c.attr, unsat))
+		}
+	}
+	return p, rep, nil
+}
+
+func (r *Report) unexpressed(ref, row, col, value, reason string) {
+	r.Unexpressed = append(r.Unexpressed, Cell{Ref: ref, Row: row, Column: col, Value: value, Reason: reason})
+}
+
+// Ref returns the spreadsheet reference of the cell of a row and a column
+// (from 0), e.g. C4 for 3, 2
+func Ref(row, col int) string {
+	letters := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		letters = string(rune('A'+(col-1)%26)) + letters
+	}
+	return letters + strconv.Itoa(row+1)
+}
+
+// parseCorner returns the attributes of the rows and of the columns named by
+// the corner cell, e.g. "DataType \ Purpose"
+func parseCorner(s string) (string, string, error) {
+	for _, sep := range []string{`\`, "/", "×", " x "} {
+		if i := strings.Index(s, sep); i >= 0 {
+			r, c := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(sep):])
+			if r != "" && c != "" {
+				return r, c, nil
+			}
+		}
+	}
+	return "", "", errors.New(fmt.Sprintf(`matrix: the corner cell %q should name the row and column attributes, e.g. "DataType \ Purpose"`, s))
+}
+
+// parseDecision parses the value of a cell: allow, deny, or a condition such
+// as "allow if Epsilon <= 1.0" (or "conditional: Epsilon <= 1.0")
+func parseDecision(s string) (decision, error) {
+	v := strings.ToLower(s)
+	switch v {
+	case "allow", "allowed", "yes", "y":
+		return decision{}, nil
+	case "deny", "denied", "no", "n":
+		return decision{deny: true}, nil
+	}
+	var cond string
+	for _, prefix := range []string{"allow if ", "conditional:", "conditional "} {
+		if strings.HasPrefix(v, prefix) {
+			cond = strings.TrimSpace(s[len(prefix):])
+			break
+		}
+	}
+	if cond == "" {
+		return decision{}, errors.New("should be allow, deny or allow if <condition>")
+	}
+	i := strings.IndexAny(cond, "<>=!")
+	if i <= 0 {
+		return decision{}, errors.New(fmt.Sprintf("the condition %q should be a numeric comparison, e.g. Epsilon <= 1.0", cond))
+	}
+	attr := strings.TrimSpace(cond[:i])
+	rest := cond[i:]
+	j := 0
+	for j < len(rest) && strings.ContainsRune("<>=!", rune(rest[j])) {
+		j++
+	}
+	op := rest[:j]
+	if _, ok := negations[op]; !ok || strings.ContainsAny(attr, " \t") {
+		return decision{}, errors.New(fmt.Sprintf("the condition %q should be a numeric comparison, e.g. Epsilon <= 1.0", cond))
+	}
+	threshold, err := strconv.ParseFloat(strings.TrimSpace(rest[j:]), 64)
+	if err != nil {
+		return decision{}, errors.New(fmt.Sprintf("the condition %q should compare with a number", cond))
+	}
+	return decision{attr: attr, op: op, threshold: threshold}, nil
+}
+
+// negations are the negated numeric operators
+var negations = map[string]string{
+	"<": ">=", "<=": ">", ">": "<=", ">=": "<", "=": "!=", "!=": "=",
+}
+
+// samples returns a value satisfying a comparison, and a value that doesn't
+func samples(op string, threshold float64) (string, string) {
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	switch op {
+	case "<":
+		return f(threshold - 1), f(threshold)
+	case "<=":
+		return f(threshold), f(threshold + 1)
+	case ">":
+		return f(threshold + 1), f(threshold)
+	case ">=":
+		return f(threshold), f(threshold - 1)
+	case "!=":
+		return f(threshold + 1), f(threshold)
+	default:
+		return f(threshold), f(threshold + 1)
+	}
+}
+
+// apply returns true when the policy allows an annotation
+func apply(p *grok.Policy, an string) bool {
+	a, err := p.ParseAnnotation(an)
+	return err == nil && p.ApplyOn(a)
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func verb(allowed bool) string {
+	if allowed {
+		return "allows"
+	}
+	return "denies"
+}
@@ -0,0 +1,125 @@
+package matrix
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func lattices() []*grok.Lattice {
+	return []*grok.Lattice{
+		grok.NewLattice(`{ "name": "DataType",
+			"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`),
+		grok.NewLattice(`{ "name": "Purpose", "edges": { "Analytics": [], "Sharing": [], "Marketing": [] } }`),
+	}
+}
+
+const csvMatrix = `DataType \ Purpose, Analytics, Sharing, Marketing
+IPAddress, allow, deny, allow if Epsilon <= 1.0
+AccountID, yes, no, deny
+Location, allow, conditional: Epsilon<0.5,
+`
+
+func TestImport(t *testing.T) {
+	grid, err := ReadCSV(strings.NewReader(csvMatrix))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	p, rep, err := Import(grid, lattices())
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := "ALLOW DataType TOP Purpose TOP Epsilon <0 Epsilon >=0 EXCEPT { DENY DataType IPAddress Purpose Sharing " +
+		"DENY DataType IPAddress Purpose Marketing Epsilon >1 DENY DataType AccountID Purpose Sharing " +
+		"DENY DataType AccountID Purpose Marketing DENY DataType Location Purpose Sharing Epsilon >=0.5 }"
+	if rep.Policy != want {
+		t.Errorf("Policy = %q, want %q", rep.Policy, want)
+	}
+	if rep.Cells != 8 {
+		t.Errorf("Cells = %d, want 8", rep.Cells)
+	}
+	// Location is above IPAddress, whose Sharing is denied whatever Epsilon
+	if len(rep.Unexpressed) != 1 || rep.Unexpressed[0].String() != `C4 (Location, Sharing) "conditional: Epsilon<0.5": the policy denies it with Epsilon -0.5` {
+		t.Errorf("Unexpressed = %v", rep.Unexpressed)
+	}
+
+	for _, test := range []struct {
+		annotation string
+		allowed    bool
+	}{
+		{"DataType IPAddress Purpose Analytics", true},
+		{"DataType IPAddress Purpose Marketing Epsilon 0.5", true},
+		{"DataType IPAddress Purpose Marketing Epsilon 2", false},
+		{"DataType AccountID Purpose Sharing", false},
+		{"DataType AccountID Purpose Analytics Epsilon 5", true},
+		// Location data may contain IPAddress, whose Epsilon isn't known
+		{"DataType Location Purpose Marketing", false},
+		{"DataType Location Purpose Marketing Epsilon 1", true},
+	} {
+		an, err := p.ParseAnnotation(test.annotation)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if p.ApplyOn(an) != test.allowed {
+			t.Errorf("ApplyOn(%s) = %t", test.annotation, !test.allowed)
+		}
+	}
+}
+
+func TestImportUnexpressed(t *testing.T) {
+	grid := [][]string{
+		{"DataType/Purpose", "Analytics", "Shipping"},
+		{"UniqueID", "deny", "allow"},
+		{"IPAddress", "allow", "maybe"},
+		{"City", "deny", ""},
+		{"AccountID", "allow if TypeState Truncated", "allow if Purpose<1"},
+	}
+	_, rep, err := Import(grid, lattices())
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	got := make([]string, 0)
+	for _, c := range rep.Unexpressed {
+		got = append(got, c.Ref+" "+c.Reason)
+	}
+	want := []string{
+		"C2 Shipping isn't an element of Purpose",
+		"C3 Shipping isn't an element of Purpose",
+		"B4 City isn't an element of DataType",
+		`B5 the condition "TypeState Truncated" should be a numeric comparison, e.g. Epsilon <= 1.0`,
+		"C5 Shipping isn't an element of Purpose",
+		"B3 the policy denies it",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpressed = %q, want %q", got, want)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	for _, grid := range [][][]string{
+		{{"DataType \\ Purpose", "Analytics"}},
+		{{"DataType", "Analytics"}, {"IPAddress", "allow"}},
+		{{"DataType \\ Region", "EU"}, {"IPAddress", "allow"}},
+	} {
+		if _, _, err := Import(grid, lattices()); err == nil {
+			t.Errorf("Import(%q): no error", grid)
+		}
+	}
+}
+
+func TestRef(t *testing.T) {
+	for _, test := range []struct {
+		row, col int
+		ref      string
+	}{
+		{0, 0, "A1"}, {3, 2, "C4"}, {9, 25, "Z10"}, {0, 26, "AA1"}, {1, 701, "ZZ2"}, {0, 702, "AAA1"},
+	} {
+		if got := Ref(test.row, test.col); got != test.ref {
+			t.Errorf("Ref(%d, %d) = %s, want %s", test.row, test.col, got, test.ref)
+		}
+		if r, c, ok := parseRef(test.ref); !ok || r != test.row || c != test.col {
+			t.Errorf("parseRef(%s) = %d, %d, %t", test.ref, r, c, ok)
+		}
+	}
+}
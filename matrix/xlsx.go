@@ -0,0 +1,154 @@
+package matrix
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ReadXLSX reads the grid of a matrix from the first sheet of an XLSX
+// workbook of size bytes
+func ReadXLSX(r io.ReaderAt, size int64) ([][]string, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := readXML(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errors.New("matrix: the workbook has no sheet")
+	}
+	var rels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := readXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheet := ""
+	for _, rel := range rels.Rels {
+		if rel.ID == workbook.Sheets[0].ID {
+			sheet = rel.Target
+		}
+	}
+	if strings.HasPrefix(sheet, "/") {
+		sheet = sheet[1:]
+	} else {
+		sheet = path.Join("xl", sheet)
+	}
+
+	// strings are shared between the cells, and workbooks without strings
+	// have no shared strings
+	var sst struct {
+		Items []struct {
+			T    string   `xml:"t"`
+			Runs []string `xml:"r>t"`
+		} `xml:"si"`
+	}
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readXML(files, "xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+	}
+	shared := make([]string, 0, len(sst.Items))
+	for _, si := range sst.Items {
+		shared = append(shared, si.T+strings.Join(si.Runs, ""))
+	}
+
+	var ws struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := readXML(files, sheet, &ws); err != nil {
+		return nil, err
+	}
+	grid := make([][]string, 0)
+	for _, row := range ws.Rows {
+		for _, c := range row.Cells {
+			r, col, ok := parseRef(c.Ref)
+			if !ok {
+				return nil, errors.New("matrix: invalid cell reference " + c.Ref)
+			}
+			v := c.Value
+			switch c.Type {
+			case "s":
+				i, err := strconv.Atoi(v)
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil, errors.New("matrix: invalid shared string of " + c.Ref)
+				}
+				v = shared[i]
+			case "inlineStr":
+				v = c.Inline
+			}
+			for len(grid) <= r {
+				grid = append(grid, nil)
+			}
+			for len(grid[r]) <= col {
+				grid[r] = append(grid[r], "")
+			}
+			grid[r][col] = v
+		}
+	}
+	return grid, nil
+}
+
+// maxXMLSize is the maximum size of the XML parts of a workbook
+const maxXMLSize = 1 << 26
+
+// readXML decodes a part of a workbook
+func readXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return errors.New("matrix: the workbook has no " + name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(rc, maxXMLSize))
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(b, v)
+}
+
+// parseRef returns the row and the column (from 0) of a cell reference, the
+// inverse of Ref
+func parseRef(ref string) (int, int, bool) {
+	i := 0
+	col := 0
+	for i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' {
+		col = col*26 + int(ref[i]-'A') + 1
+		i++
+	}
+	row, err := strconv.Atoi(ref[i:])
+	if i == 0 || err != nil || row < 1 || col > 1<<14 || row > 1<<20 {
+		return 0, 0, false
+	}
+	return row - 1, col - 1, true
+}
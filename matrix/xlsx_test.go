@@ -0,0 +1,79 @@
+package matrix
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// workbook returns an XLSX workbook of parts
+func workbook(t *testing.T, parts map[string]string) []byte {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return buf.Bytes()
+}
+
+var parts = map[string]string{
+	"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+		xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+		<sheets><sheet name="Rules" sheetId="1" r:id="rId2"/><sheet name="Notes" sheetId="2" r:id="rId1"/></sheets></workbook>`,
+	"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+		<Relationship Id="rId1" Target="worksheets/sheet1.xml"/>
+		<Relationship Id="rId2" Target="worksheets/sheet2.xml"/></Relationships>`,
+	"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+		<si><t>DataType \ Purpose</t></si><si><t>Analytics</t></si><si><r><t>IP</t></r><r><t>Address</t></r></si><si><t>deny</t></si></sst>`,
+	"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>notes</t></is></c></row></sheetData></worksheet>`,
+	"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+		<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+		<row r="3"><c r="A3" t="s"><v>2</v></c><c r="C3" t="s"><v>3</v></c></row>
+		</sheetData></worksheet>`,
+}
+
+func TestReadXLSX(t *testing.T) {
+	b := workbook(t, parts)
+	grid, err := ReadXLSX(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := [][]string{{`DataType \ Purpose`, "", "Analytics"}, nil, {"IPAddress", "", "deny"}}
+	if len(grid) != len(want) {
+		t.Fatalf("ReadXLSX() = %q", grid)
+	}
+	for i := range want {
+		if strings.Join(grid[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d = %q, want %q", i, grid[i], want[i])
+		}
+	}
+	_, rep, err := Import(grid, lattices())
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if rep.Policy != "ALLOW DataType TOP Purpose TOP EXCEPT { DENY DataType IPAddress Purpose Analytics }" {
+		t.Errorf("Policy = %q", rep.Policy)
+	}
+}
+
+func TestReadXLSXErrors(t *testing.T) {
+	invalid := make(map[string]string)
+	for k, v := range parts {
+		invalid[k] = v
+	}
+	invalid["xl/worksheets/sheet2.xml"] = `<worksheet><sheetData><row><c r="A1" t="s"><v>7</v></c></row></sheetData></worksheet>`
+	noSheet := map[string]string{"xl/workbook.xml": parts["xl/workbook.xml"]}
+	for i, b := range [][]byte{[]byte("not a zip"), workbook(t, invalid), workbook(t, noSheet)} {
+		if _, err := ReadXLSX(bytes.NewReader(b), int64(len(b))); err == nil {
+			t.Errorf("%d: no error", i)
+		}
+	}
+}
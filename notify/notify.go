@@ -0,0 +1,221 @@
+// Package notify notifies on-call engineers of the problems of policy bundles
+// through webhooks: the violations found by graph checks, above a severity
+// threshold, and the failures of policy reloads.
+//
+// Webhooks receive either the JSON of the event (FormatGeneric) or a message
+// in the payload of Slack incoming webhooks (FormatSlack). They are
+// configured per bundle, e.g. in JSON for LoadConfig:
+//
+//	{
+//	 "bundles": {
+//	   "core": [
+//	     {"url": "https://hooks.slack.com/services/...", "format": "slack", "min_severity": "HIGH"}
+//	   ],
+//	   "*": [{"url": "https://alerts.example.com/grok"}]
+//	 }
+//	}
+//
+// where the webhooks of the bundle "*" are notified of the events of every
+// bundle.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/graph"
+)
+
+// Kinds of events
+const (
+	Violation     = "violation"
+	ReloadFailure = "reload_failure"
+)
+
+// Formats of the payloads of webhooks
+const (
+	FormatGeneric = "generic"
+	FormatSlack   = "slack"
+)
+
+// AllBundles is the bundle of the webhooks notified of the events of every bundle
+const AllBundles = "*"
+
+// Event is a problem of a bundle
+type Event struct {
+	Kind   string `json:"kind"`
+	Bundle string `json:"bundle"`
+	// Node, Annotation and Severity describe a violation
+	Node       string `json:"node,omitempty"`
+	Annotation string `json:"annotation,omitempty"`
+	Severity   string `json:"severity,omitempty"`
+	// Error is the error of a reload failure
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// Text returns the event in plain words
+func (e Event) Text() string {
+	if e.Kind == ReloadFailure {
+		return fmt.Sprintf("grok: bundle %s failed to reload: %s", e.Bundle, e.Error)
+	}
+	return fmt.Sprintf("grok: %s violation of bundle %s: %s (%s)", e.Severity, e.Bundle, e.Node, e.Annotation)
+}
+
+// Webhook is a webhook notified of the events of a bundle
+type Webhook struct {
+	URL string `json:"url"`
+	// Format is FormatGeneric when it's empty
+	Format string `json:"format,omitempty"`
+	// MinSeverity is the severity from which violations are notified, all of
+	// them when it's empty. Reload failures are always notified.
+	MinSeverity string `json:"min_severity,omitempty"`
+}
+
+// Notifier sends the events of bundles to their webhooks
+type Notifier struct {
+	// Webhooks are the webhooks by bundle
+	Webhooks map[string][]Webhook
+	// Client is the client of the requests, http.DefaultClient when it's nil
+	Client *http.Client
+	// Now timestamps the events, time.Now when it's nil
+	Now func() time.Time
+	// Limiter deduplicates and rate-limits the violations, if any, so that
+	// the violations found by every check don't flood the webhooks
+	Limiter *grok.EmissionLimiter
+}
+
+// NewNotifier returns a notifier without webhooks
+func NewNotifier() *Notifier {
+	return &Notifier{Webhooks: make(map[string][]Webhook)}
+}
+
+// LoadConfig reads the webhooks of bundles, and returns their notifier
+func LoadConfig(r io.Reader) (*Notifier, error) {
+	var def struct {
+		Bundles map[string][]Webhook `json:"bundles"`
+	}
+	if err := json.NewDecoder(r).Decode(&def); err != nil {
+		return nil, err
+	}
+	n := NewNotifier()
+	for b, hs := range def.Bundles {
+		for _, h := range hs {
+			if err := n.Subscribe(b, h); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Subscribe adds a webhook of a bundle, or of every bundle for AllBundles
+func (n *Notifier) Subscribe(bundle string, h Webhook) error {
+	if h.URL == "" {
+		return errors.New(fmt.Sprintf("notify: bundle %s: a webhook should have a URL", bundle))
+	}
+	if h.Format != "" && h.Format != FormatGeneric && h.Format != FormatSlack {
+		return errors.New(fmt.Sprintf("notify: bundle %s: unknown format %s", bundle, h.Format))
+	}
+	if h.MinSeverity != "" {
+		if _, err := grok.ParseSeverity(h.MinSeverity); err != nil {
+			return errors.New(fmt.Sprintf("notify: bundle %s: %s", bundle, err))
+		}
+	}
+	n.Webhooks[bundle] = append(n.Webhooks[bundle], h)
+	return nil
+}
+
+// Violations notifies the violations of a bundle found by a graph check
+// (see graph.CheckGraph), with the severities of the policy
+func (n *Notifier) Violations(bundle string, p *grok.Policy, vs []graph.Violation) error {
+	errs := make([]string, 0)
+	for _, v := range vs {
+		if n.Limiter != nil && !n.Limiter.Allow(grok.Fingerprint(bundle, v.Node, v.Annotation.String())) {
+			continue
+		}
+		ev := Event{Kind: Violation, Bundle: bundle, Node: v.Node, Annotation: v.Annotation.String(),
+			Severity: p.Severity(v.Annotation).String(), Time: n.now()}
+		if err := n.Notify(ev); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ReloadFailed notifies the failure of the reload of a bundle
+func (n *Notifier) ReloadFailed(bundle string, err error) error {
+	return n.Notify(Event{Kind: ReloadFailure, Bundle: bundle, Error: err.Error(), Time: n.now()})
+}
+
+// Notify sends an event to the webhooks of its bundle that it concerns, and
+// returns the errors of the deliveries that failed
+func (n *Notifier) Notify(ev Event) error {
+	errs := make([]string, 0)
+	for _, h := range append(append([]Webhook{}, n.Webhooks[ev.Bundle]...), n.Webhooks[AllBundles]...) {
+		if !h.concerns(ev) {
+			continue
+		}
+		if err := n.send(h, ev); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// concerns returns true when the webhook is notified of the event
+func (h Webhook) concerns(ev Event) bool {
+	if ev.Kind != Violation || h.MinSeverity == "" {
+		return true
+	}
+	min, _ := grok.ParseSeverity(h.MinSeverity)
+	s, err := grok.ParseSeverity(ev.Severity)
+	return err == nil && s >= min
+}
+
+// send posts the payload of an event to a webhook
+func (n *Notifier) send(h Webhook, ev Event) error {
+	var payload interface{} = ev
+	if h.Format == FormatSlack {
+		payload = struct {
+			Text string `json:"text"`
+		}{ev.Text()}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	c := n.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Post(h.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.New(fmt.Sprintf("notify: %s", err))
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New(fmt.Sprintf("notify: %s answered %s", h.URL, resp.Status))
+	}
+	return nil
+}
+
+func (n *Notifier) now() time.Time {
+	if n.Now != nil {
+		return n.Now()
+	}
+	return time.Now()
+}
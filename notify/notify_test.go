@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/graph"
+)
+
+func TestNotifier(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], string(b))
+		mu.Unlock()
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	config := `{"bundles": {
+		"core": [{"url": "` + srv.URL + `/slack", "format": "slack", "min_severity": "HIGH"}],
+		"*": [{"url": "` + srv.URL + `/all"}]
+	}}`
+	n, err := LoadConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	n.Now = func() time.Time { return time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	p := grok.NewPolicy([]*grok.Lattice{grok.NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] },
+		"weights": { "AccountID": 3, "IPAddress": 2 } }`)})
+	if err := p.ParsePolicy("ALLOW DataType Location"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	g := graph.NewDataFlowGraph()
+	for id, astr := range map[string]string{"accounts": "DataType AccountID", "ips": "DataType IPAddress", "ids": "DataType UniqueID"} {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		g.AddNode(id, an)
+	}
+	n.Limiter = grok.NewEmissionLimiter(time.Hour, 0, 0)
+	// the violations of the second check are duplicates
+	for i := 0; i < 2; i++ {
+		if err := n.Violations("core", p, graph.CheckGraph(p, g)); err != nil {
+			t.Fatalf("%q", err)
+		}
+	}
+	if err := n.ReloadFailed("other", errors.New("cue: 1 invalid policies")); err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if got := received["/slack"]; len(got) != 1 || got[0] != `{"text":"grok: HIGH violation of bundle core: accounts (DataType AccountID)"}` {
+		t.Errorf("slack = %q", got)
+	}
+	all := received["/all"]
+	if len(all) != 3 {
+		t.Fatalf("all = %q", all)
+	}
+	var ev Event
+	if err := json.Unmarshal([]byte(all[2]), &ev); err != nil || ev.Kind != ReloadFailure || ev.Bundle != "other" || ev.Error != "cue: 1 invalid policies" {
+		t.Errorf("reload failure = %s", all[2])
+	}
+
+	if err := n.Subscribe("core", Webhook{URL: srv.URL + "/broken"}); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := n.ReloadFailed("core", errors.New("boom")); err == nil || !strings.Contains(err.Error(), "/broken answered 500") {
+		t.Errorf("ReloadFailed() to a broken webhook = %v", err)
+	}
+	for _, h := range []Webhook{{}, {URL: "u", Format: "teams"}, {URL: "u", MinSeverity: "urgent"}} {
+		if err := n.Subscribe("core", h); err == nil {
+			t.Errorf("Subscribe(%+v) = nil error", h)
+		}
+	}
+}
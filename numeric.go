@@ -0,0 +1,230 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Epsilon is the conventional name of the differential-privacy budget attribute
+const Epsilon = "Epsilon"
+
+// operators are the characters of numeric predicate operators (<, <=, >, >=, =, !=)
+const operators = "<>=!"
+
+// Numeric attributes are attributes whose values are numbers rather than lattice
+// elements, e.g. the differential-privacy budget of a query. In an annotation,
+// a numeric attribute carries a number:
+//
+//   Epsilon 0.5
+//
+// In a policy clause, it carries a predicate over numbers, and a bare number is
+// the same as an equality predicate:
+//
+//   ALLOW DataType TOP Epsilon <= 1.0
+//
+// Numeric attributes follow the same rules as lattice attributes in ApplyOn,
+// where "a value satisfies a predicate" plays the role of "a value precedes an
+// element".
+
+// DefineNumeric declares a numeric attribute for the policy, so that it can
+// be used in clauses and annotations next to the lattice attributes.
+func (p *Policy) DefineNumeric(name string) error {
+	if _, ok := p.baseOn[name]; ok {
+		return errors.New(fmt.Sprintf("policy: %s is already a lattice name", name))
+	}
+	if p.numerics == nil {
+		p.numerics = make(map[string]bool)
+	}
+	p.numerics[name] = true
+	return nil
+}
+
+// isNumeric returns true when name is a numeric attribute of the policy
+func (p *Policy) isNumeric(name string) bool {
+	return p.numerics[name]
+}
+
+// NumericValue returns a valid value (a number or a predicate) of a numeric attribute in a clause, or returns error
+func (p *Policy) NumericValue(s string, name string) (string, error) {
+	if _, _, err := parsePredicate(s); err != nil {
+		return "", errors.New(fmt.Sprintf("policy: %s is not a valid value of numeric attribute %s", s, name))
+	}
+	return s, nil
+}
+
+// numberValue returns a valid value of a numeric attribute in an annotation,
+// which is a number rather than a predicate, or returns error
+func (p *Policy) numberValue(s string, name string) (string, error) {
+	if x, err := strconv.ParseFloat(s, 64); err != nil || math.IsNaN(x) {
+		return "", errors.New(fmt.Sprintf("policy: %s is not a number of numeric attribute %s", s, name))
+	}
+	return s, nil
+}
+
+// checkNumbers returns an error when a value of a numeric attribute of an
+// annotation isn't a number
+func (p *Policy) checkNumbers(an Annotation) error {
+	for _, pa := range an {
+		if p.isNumeric(pa.name) {
+			if _, err := p.numberValue(pa.value, pa.name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parsePredicate parses a predicate such as "<=1.0" into its operator and operand.
+// A bare number is parsed as an equality predicate.
+func parsePredicate(s string) (string, float64, error) {
+	i := 0
+	for i < len(s) && strings.ContainsRune(operators, rune(s[i])) {
+		i++
+	}
+	op := s[:i]
+	switch op {
+	case "":
+		op = "="
+	case "<", "<=", ">", ">=", "=", "!=":
+	default:
+		return "", 0, errors.New(fmt.Sprintf("policy: %s is not a valid operator", op))
+	}
+	v, err := strconv.ParseFloat(s[i:], 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return op, v, nil
+}
+
+// satisfies returns true when the numeric value a satisfies predicate pred
+func satisfies(a, pred string) bool {
+	x, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		return false
+	}
+	op, v, err := parsePredicate(pred)
+	if err != nil {
+		return false
+	}
+	switch op {
+	case "<":
+		return x < v
+	case "<=":
+		return x <= v
+	case ">":
+		return x > v
+	case ">=":
+		return x >= v
+	case "!=":
+		return x != v
+	default:
+		return x == v
+	}
+}
+
+// allowNumeric is Allow for numeric attributes: every annotation value must
+// satisfy at least one of the policy predicates
+func allowNumeric(preds, values []string) bool {
+	for _, v := range values {
+		allowed := false
+		for _, pred := range preds {
+			if satisfies(v, pred) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// overlapNumeric is overlap for numeric attributes: the annotation values that
+// satisfy each policy predicate, or nil for a predicate that no value satisfies
+func overlapNumeric(preds, values []string) [][]string {
+	res := make([][]string, 0)
+	if len(values) == 0 {
+		return res
+	}
+	for _, pred := range preds {
+		var sat []string
+		for _, v := range values {
+			if satisfies(v, pred) {
+				sat = append(sat, v)
+			}
+		}
+		res = append(res, sat)
+	}
+	return res
+}
+
+// denyNumeric is Deny for numeric attributes: every policy predicate must be
+// satisfied by some annotation value
+func denyNumeric(preds, values []string) bool {
+	for _, sat := range overlapNumeric(preds, values) {
+		if len(sat) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// formatNumber formats a numeric attribute value
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// BudgetAccountant accumulates the differential-privacy budget spent per dataset
+// across decisions. It is safe for concurrent use.
+type BudgetAccountant struct {
+	mu    sync.Mutex
+	spent map[string]float64
+}
+
+// NewBudgetAccountant returns an empty BudgetAccountant
+func NewBudgetAccountant() *BudgetAccountant {
+	return &BudgetAccountant{spent: make(map[string]float64)}
+}
+
+// Spent returns the budget spent on a dataset so far
+func (b *BudgetAccountant) Spent(dataset string) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spent[dataset]
+}
+
+// Charge decides whether a request annotated by an may run on dataset. The
+// Epsilon values of the annotation are added to the budget already spent on
+// the dataset, and the policy is applied on the annotation carrying the
+// cumulative budget instead. The budget is only recorded when the request is
+// allowed.
+func (b *BudgetAccountant) Charge(dataset string, p *Policy, an Annotation) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	requested := 0.0
+	cumulative := make(Annotation, 0, len(an))
+	for _, pa := range an {
+		if pa.name != Epsilon {
+			cumulative = append(cumulative, pa)
+			continue
+		}
+		v, err := strconv.ParseFloat(pa.value, 64)
+		if err != nil {
+			return false
+		}
+		requested += v
+	}
+	total := b.spent[dataset] + requested
+	cumulative = append(cumulative, pair{name: Epsilon, value: formatNumber(total)})
+	if !p.ApplyOn(cumulative) {
+		return false
+	}
+	b.spent[dataset] = total
+	return true
+}
@@ -0,0 +1,137 @@
+package grok
+
+import (
+	"testing"
+)
+
+func newBudgetPolicy(t *testing.T, pstr string) *Policy {
+	p := NewPolicy([]*Lattice{NewLattice(`{ "name": "DataType",
+		"edges": {
+			"UniqueID": ["AccountID", "IPAddress"],
+			"Location": ["IPAddress"] }
+		}`)})
+	if err := p.DefineNumeric(Epsilon); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := p.ParsePolicy(pstr); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return p
+}
+
+func TestParsePredicate(t *testing.T) {
+	cases := []struct {
+		s  string
+		op string
+		v  float64
+		ok bool
+	}{
+		{"<=1.0", "<=", 1, true},
+		{">2", ">", 2, true},
+		{"!=0.5", "!=", 0.5, true},
+		{"3", "=", 3, true},
+		{"=<1", "", 0, false},
+		{"<=x", "", 0, false},
+	}
+	for _, c := range cases {
+		op, v, err := parsePredicate(c.s)
+		if (err == nil) != c.ok || op != c.op || v != c.v {
+			t.Errorf("parsePredicate(%q) = %q, %v, %v", c.s, op, v, err)
+		}
+	}
+}
+
+func TestApplyOnNumeric(t *testing.T) {
+	cases := []struct {
+		pstr string
+		astr string
+		want bool
+	}{
+		{"ALLOW DataType TOP Epsilon <= 1.0", "DataType IPAddress Epsilon 0.5", true},
+		{"ALLOW DataType TOP Epsilon <= 1.0", "DataType IPAddress Epsilon 1.5", false},
+		{"ALLOW DataType TOP Epsilon <= 1.0", "DataType IPAddress", true},
+		{"DENY Epsilon > 1.0", "Epsilon 2", false},
+		{"DENY Epsilon > 1.0", "Epsilon 0.1", true},
+		{"ALLOW DataType TOP Epsilon <= 2 EXCEPT { DENY DataType AccountID Epsilon > 1 }",
+			"DataType AccountID Epsilon 1.5", false},
+		{"ALLOW DataType TOP Epsilon <= 2 EXCEPT { DENY DataType AccountID Epsilon > 1 }",
+			"DataType IPAddress Epsilon 1.5", true},
+	}
+	for _, c := range cases {
+		p := newBudgetPolicy(t, c.pstr)
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := p.ApplyOn(an); got != c.want {
+			t.Errorf("Apply [%q] on [%q]: %t, want %t", c.pstr, c.astr, got, c.want)
+		}
+	}
+}
+
+func TestParseNumericErrors(t *testing.T) {
+	p := newBudgetPolicy(t, "ALLOW Epsilon <= 1")
+	if _, err := p.ParseAnnotation("Epsilon high"); err == nil {
+		t.Errorf("ParseAnnotation(Epsilon high) should fail")
+	}
+	if err := p.DefineNumeric("DataType"); err == nil {
+		t.Errorf("DefineNumeric(DataType) should fail")
+	}
+
+	// annotations carry numbers, and only clauses carry predicates
+	q := newBudgetPolicy(t, "DENY DataType TOP Epsilon >1")
+	for _, astr := range []string{"DataType IPAddress Epsilon >=100", "DataType IPAddress Epsilon NaN"} {
+		if _, err := q.ParseAnnotation(astr); err == nil {
+			t.Errorf("ParseAnnotation(%s) should fail", astr)
+		}
+	}
+	if _, err := q.ParseValue(Epsilon, ">=100"); err == nil {
+		t.Errorf("ParseValue(Epsilon, >=100) should fail")
+	}
+	if err := q.ValidateAnnotation(Annotation{{name: "DataType", value: "IPAddress"}, {name: Epsilon, value: ">=100"}}); err == nil {
+		t.Errorf("ValidateAnnotation(Epsilon >=100) should fail")
+	}
+	an, err := q.ParseAnnotation("DataType IPAddress Epsilon 100")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if q.ApplyOn(an) {
+		t.Errorf("Apply [DENY DataType TOP Epsilon >1] on [%s]: true, want false", an)
+	}
+}
+
+func TestDefineNumericLiteral(t *testing.T) {
+	// a policy that isn't made with NewPolicy has no numerics yet
+	p := &Policy{}
+	if err := p.DefineNumeric(Epsilon); err != nil || !p.isNumeric(Epsilon) {
+		t.Errorf("DefineNumeric(Epsilon) = %v", err)
+	}
+}
+
+func TestBudgetAccountant(t *testing.T) {
+	p := newBudgetPolicy(t, "ALLOW DataType TOP Epsilon <= 1.0")
+	b := NewBudgetAccountant()
+	cases := []struct {
+		dataset string
+		astr    string
+		want    bool
+		spent   float64
+	}{
+		{"clicks", "DataType IPAddress Epsilon 0.5", true, 0.5},
+		{"clicks", "DataType IPAddress Epsilon 0.25", true, 0.75},
+		{"clicks", "DataType IPAddress Epsilon 0.5", false, 0.75},
+		{"orders", "DataType IPAddress Epsilon 0.5", true, 0.5},
+	}
+	for _, c := range cases {
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := b.Charge(c.dataset, p, an); got != c.want {
+			t.Errorf("Charge(%q, %q) = %t, want %t", c.dataset, c.astr, got, c.want)
+		}
+		if got := b.Spent(c.dataset); got != c.spent {
+			t.Errorf("Spent(%q) = %v, want %v", c.dataset, got, c.spent)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+// Package oci distributes policy bundles through OCI registries, so that
+// policies ride the same infrastructure as container images.
+//
+// A bundle is an OCI artifact: an image manifest whose layers are the
+// snapshots of the policies of a set (see grok.Policy.WriteSnapshot), signed
+// with an Ed25519 key. The signature covers the media types, digests and
+// sizes of the config and the layers, and is kept in the SignatureAnnotation
+// of the manifest:
+//
+//	manifest, blobs, err := oci.Pack(set, privateKey)
+//	// push the blobs and the manifest, e.g. with oras
+//	f := &oci.Fetcher{PublicKey: publicKey}
+//	set, digest, err := f.Fetch(ctx, "ghcr.io/acme/policies@sha256:...")
+//
+// Fetch needs no secrets: it pulls anonymously, with the anonymous bearer
+// tokens of the registries that require a token. A reference pinned by digest
+// must resolve to a manifest of that digest, and every blob is verified
+// against its digest.
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// Media types and annotations of bundles
+const (
+	ManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ConfigMediaType   = "application/vnd.grok.bundle.config.v1+json"
+	PolicyMediaType   = "application/vnd.grok.policy.snapshot.v1+json"
+	// SignatureAnnotation is the manifest annotation of the base64 Ed25519
+	// signature of the bundle
+	SignatureAnnotation = "dev.grok.bundle.signature"
+)
+
+// MaxBlobSize is the maximum size of the manifests and blobs that Fetch reads
+const MaxBlobSize = 64 << 20
+
+// Descriptor describes a blob of a manifest
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// Manifest is an OCI image manifest
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// payload returns what the signature of the manifest signs: the media type,
+// digest and size of its config and layers, one per line
+func (m *Manifest) payload() []byte {
+	ds := []string{m.Config.String()}
+	for _, l := range m.Layers {
+		ds = append(ds, l.String())
+	}
+	return []byte(strings.Join(ds, "\n"))
+}
+
+// String returns the media type, digest and size of the blob, e.g.
+// application/vnd.grok.bundle.config.v1+json sha256:44136f... 2
+func (d Descriptor) String() string {
+	return fmt.Sprintf("%s %s %d", d.MediaType, d.Digest, d.Size)
+}
+
+// Digest returns the sha256 digest of content, e.g. sha256:2c26b4...
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Pack packs a policy set into a bundle signed with the key, and returns its
+// manifest and its blobs by digest
+func Pack(s *grok.PolicySet, key ed25519.PrivateKey) ([]byte, map[string][]byte, error) {
+	if err := s.Validate(); err != nil {
+		return nil, nil, err
+	}
+	blobs := make(map[string][]byte)
+	add := func(mediaType string, content []byte) Descriptor {
+		d := Descriptor{MediaType: mediaType, Digest: Digest(content), Size: int64(len(content))}
+		blobs[d.Digest] = content
+		return d
+	}
+	m := Manifest{SchemaVersion: 2, MediaType: ManifestMediaType, Config: add(ConfigMediaType, []byte("{}")),
+		Layers: make([]Descriptor, 0, len(s.Policies))}
+	for _, p := range s.Policies {
+		var buf bytes.Buffer
+		if err := p.WriteSnapshot(&buf); err != nil {
+			return nil, nil, err
+		}
+		m.Layers = append(m.Layers, add(PolicyMediaType, buf.Bytes()))
+	}
+	m.Annotations = map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(ed25519.Sign(key, m.payload()))}
+	manifest, err := json.Marshal(&m)
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, blobs, nil
+}
+
+// Reference is a reference to a manifest, e.g.
+// ghcr.io/acme/policies:1.0@sha256:2c26b4...
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	// Digest pins the manifest, when it's set
+	Digest string
+}
+
+// ParseReference parses a reference. The tag defaults to latest when the
+// reference has neither a tag nor a digest.
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+	if i := strings.Index(s, "@"); i >= 0 {
+		s, ref.Digest = s[:i], s[i+1:]
+		if !strings.HasPrefix(ref.Digest, "sha256:") || len(ref.Digest) != len("sha256:")+64 {
+			return Reference{}, errors.New(fmt.Sprintf("oci: invalid digest %s", ref.Digest))
+		}
+	}
+	i := strings.Index(s, "/")
+	if i <= 0 || i == len(s)-1 {
+		return Reference{}, errors.New(fmt.Sprintf("oci: reference %s should be registry/repository", s))
+	}
+	ref.Registry, ref.Repository = s[:i], s[i+1:]
+	if j := strings.LastIndex(ref.Repository, ":"); j >= 0 {
+		ref.Repository, ref.Tag = ref.Repository[:j], ref.Repository[j+1:]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+func (ref Reference) String() string {
+	s := ref.Registry + "/" + ref.Repository
+	if ref.Tag != "" {
+		s += ":" + ref.Tag
+	}
+	if ref.Digest != "" {
+		s += "@" + ref.Digest
+	}
+	return s
+}
+
+// Fetcher pulls bundles from OCI registries
+type Fetcher struct {
+	// Client is the client of the requests, http.DefaultClient when it's nil
+	Client *http.Client
+	// PublicKey verifies the signatures of the bundles. Fetch fails without
+	// it, unless Insecure is set.
+	PublicKey ed25519.PublicKey
+	// Insecure fetches the bundles without verifying their signatures when
+	// there's no PublicKey, e.g. in tests
+	Insecure bool
+	// RequireDigest rejects the references that aren't pinned by digest
+	RequireDigest bool
+	// PlainHTTP pulls from registries over HTTP, e.g. local ones
+	PlainHTTP bool
+}
+
+// Fetch pulls the bundle of a reference, verifies it, and returns its policy
+// set and the digest of its manifest
+func (f *Fetcher) Fetch(ctx context.Context, reference string) (*grok.PolicySet, string, error) {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return nil, "", err
+	}
+	if f.RequireDigest && ref.Digest == "" {
+		return nil, "", errors.New(fmt.Sprintf("oci: reference %s should be pinned by digest", ref))
+	}
+	if f.PublicKey == nil && !f.Insecure {
+		return nil, "", errors.New(fmt.Sprintf("oci: no public key to verify bundle %s", ref))
+	}
+	pull := &pull{f: f, ref: ref}
+	tag := ref.Digest
+	if tag == "" {
+		tag = ref.Tag
+	}
+	manifest, err := pull.get(ctx, "manifests/"+tag, ManifestMediaType)
+	if err != nil {
+		return nil, "", err
+	}
+	digest := Digest(manifest)
+	if ref.Digest != "" && digest != ref.Digest {
+		return nil, "", errors.New(fmt.Sprintf("oci: manifest of %s has digest %s", ref, digest))
+	}
+	var m Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, "", errors.New(fmt.Sprintf("oci: manifest of %s: %s", ref, err))
+	}
+	if m.Config.MediaType != ConfigMediaType {
+		return nil, "", errors.New(fmt.Sprintf("oci: %s isn't a policy bundle", ref))
+	}
+	if f.PublicKey != nil {
+		sig, err := base64.StdEncoding.DecodeString(m.Annotations[SignatureAnnotation])
+		if err != nil || len(sig) == 0 {
+			return nil, "", errors.New(fmt.Sprintf("oci: bundle %s isn't signed", ref))
+		}
+		if !ed25519.Verify(f.PublicKey, m.payload(), sig) {
+			return nil, "", errors.New(fmt.Sprintf("oci: invalid signature of bundle %s", ref))
+		}
+	}
+
+	s := grok.NewPolicySet()
+	for _, l := range m.Layers {
+		if l.MediaType != PolicyMediaType {
+			return nil, "", errors.New(fmt.Sprintf("oci: layer %s of %s has unknown media type %s", l.Digest, ref, l.MediaType))
+		}
+		blob, err := pull.get(ctx, "blobs/"+l.Digest, l.MediaType)
+		if err != nil {
+			return nil, "", err
+		}
+		if Digest(blob) != l.Digest || int64(len(blob)) != l.Size {
+			return nil, "", errors.New(fmt.Sprintf("oci: blob %s of %s doesn't match its digest and size", l.Digest, ref))
+		}
+		p, err := grok.ReadSnapshot(bytes.NewReader(blob))
+		if err != nil {
+			return nil, "", errors.New(fmt.Sprintf("oci: blob %s of %s: %s", l.Digest, ref, err))
+		}
+		s.Add(p)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, "", err
+	}
+	return s, digest, nil
+}
+
+// pull is the state of a Fetch: the anonymous token of the repository, once
+// the registry asked for one
+type pull struct {
+	f     *Fetcher
+	ref   Reference
+	token string
+}
+
+// get gets a manifest or a blob of the repository
+func (p *pull) get(ctx context.Context, path, accept string) ([]byte, error) {
+	scheme := "https"
+	if p.f.PlainHTTP {
+		scheme = "http"
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", scheme, p.ref.Registry, p.ref.Repository, path)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", accept)
+		if p.token != "" {
+			req.Header.Set("Authorization", "Bearer "+p.token)
+		}
+		resp, err := p.client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxBlobSize+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			if err := p.authorize(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, err
+			}
+			continue
+		case resp.StatusCode != http.StatusOK:
+			return nil, errors.New(fmt.Sprintf("oci: GET %s: %s", u, resp.Status))
+		case len(body) > MaxBlobSize:
+			return nil, errors.New(fmt.Sprintf("oci: GET %s: larger than %d bytes", u, MaxBlobSize))
+		}
+		return body, nil
+	}
+}
+
+// authorize gets an anonymous token for the bearer challenge of a registry
+func (p *pull) authorize(ctx context.Context, challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return errors.New(fmt.Sprintf("oci: registry %s requires credentials", p.ref.Registry))
+	}
+	params := make(map[string]string)
+	for _, kv := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		if i := strings.Index(kv, "="); i > 0 {
+			params[strings.TrimSpace(kv[:i])] = strings.Trim(strings.TrimSpace(kv[i+1:]), `"`)
+		}
+	}
+	if params["realm"] == "" {
+		return errors.New(fmt.Sprintf("oci: registry %s has no token realm", p.ref.Registry))
+	}
+	q := url.Values{}
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", "repository:"+p.ref.Repository+":pull")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("oci: token of registry %s: %s", p.ref.Registry, resp.Status))
+	}
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return err
+	}
+	if p.token = t.Token; p.token == "" {
+		p.token = t.AccessToken
+	}
+	return nil
+}
+
+func (p *pull) client() *http.Client {
+	if p.f.Client != nil {
+		return p.f.Client
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,177 @@
+package oci
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+// registry serves a bundle, and requires an anonymous token
+func registry(manifest []byte, blobs map[string][]byte) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.URL.Query().Get("scope") != "repository:acme/policies:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"token": "anonymous"}`))
+		case r.Header.Get("Authorization") != "Bearer anonymous":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/acme/policies/manifests/1.0" || r.URL.Path == "/v2/acme/policies/manifests/"+Digest(manifest):
+			w.Write(manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/acme/policies/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/acme/policies/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv
+}
+
+func TestFetch(t *testing.T) {
+	p := grok.NewPolicy([]*grok.Lattice{grok.NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)})
+	p.ID = "no-joins"
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	manifest, blobs, err := Pack(grok.NewPolicySet(p), key)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	srv := registry(manifest, blobs)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	f := &Fetcher{PublicKey: pub, RequireDigest: true, PlainHTTP: true}
+	s, digest, err := f.Fetch(context.Background(), host+"/acme/policies:1.0@"+Digest(manifest))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if digest != Digest(manifest) || len(s.Policies) != 1 || s.Get("no-joins") == nil {
+		t.Errorf("Fetch() = %v, %s", s.Policies, digest)
+	}
+	an, err := s.Policies[0].ParseAnnotation("DataType IPAddress DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if s.Policies[0].ApplyOn(an) {
+		t.Errorf("the fetched policy allows %s", an)
+	}
+
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	cases := []struct {
+		f         *Fetcher
+		reference string
+		err       string
+	}{
+		{f, host + "/acme/policies:1.0", "oci: reference " + host + "/acme/policies:1.0 should be pinned by digest"},
+		{&Fetcher{Insecure: true, PlainHTTP: true}, host + "/acme/policies@sha256:" + strings.Repeat("0", 64), "oci: GET "},
+		{&Fetcher{PublicKey: other, PlainHTTP: true}, host + "/acme/policies:1.0", "oci: invalid signature of bundle "},
+		{&Fetcher{PlainHTTP: true}, host + "/acme/policies:1.0", "oci: no public key to verify bundle "},
+		{&Fetcher{Insecure: true, PlainHTTP: true}, host + "/acme/policies@sha256:1", "oci: invalid digest sha256:1"},
+		{&Fetcher{Insecure: true, PlainHTTP: true}, "policies", "oci: reference policies should be registry/repository"},
+	}
+	for _, c := range cases {
+		_, _, err := c.f.Fetch(context.Background(), c.reference)
+		if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("Fetch(%s) = %v, want %q", c.reference, err, c.err)
+		}
+	}
+}
+
+func TestFetchTampered(t *testing.T) {
+	p := grok.NewPolicy([]*grok.Lattice{grok.NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID"] } }`)})
+	p.ID = "p"
+	if err := p.ParsePolicy("ALLOW DataType AccountID"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	manifest, blobs, err := Pack(grok.NewPolicySet(p), key)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		t.Fatalf("%q", err)
+	}
+	blobs[Digest([]byte("{}\n"))] = []byte("{}\n")
+
+	cases := []struct {
+		tamper func(m *Manifest)
+		// sign signs the tampered manifest
+		sign bool
+		err  string
+	}{
+		{func(m *Manifest) { m.Layers[0].MediaType = "application/octet-stream" }, false, "oci: invalid signature of bundle "},
+		{func(m *Manifest) { m.Layers[0].Size++ }, false, "oci: invalid signature of bundle "},
+		{func(m *Manifest) { m.Config.MediaType = ConfigMediaType + "2" }, true, "oci: "},
+		{func(m *Manifest) {
+			m.Layers = append(m.Layers, Descriptor{MediaType: "application/octet-stream", Digest: Digest([]byte("{}\n")), Size: 3})
+		}, true, "oci: layer sha256:"},
+		{func(m *Manifest) { m.Layers[0].Size++ }, true, "oci: blob sha256:"},
+	}
+	for i, c := range cases {
+		tm := m
+		tm.Layers = append([]Descriptor(nil), m.Layers...)
+		c.tamper(&tm)
+		if c.sign {
+			tm.Annotations = map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(ed25519.Sign(key, tm.payload()))}
+		}
+		b, err := json.Marshal(&tm)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		srv := registry(b, blobs)
+		host := strings.TrimPrefix(srv.URL, "http://")
+		_, _, err = (&Fetcher{PublicKey: pub, PlainHTTP: true}).Fetch(context.Background(), host+"/acme/policies:1.0")
+		if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("Fetch() of the manifest %d = %v, want %q", i, err, c.err)
+		}
+		srv.Close()
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	cases := []struct {
+		s, ref string
+	}{
+		{"ghcr.io/acme/policies", "ghcr.io/acme/policies:latest"},
+		{"localhost:5000/policies:1.0", "localhost:5000/policies:1.0"},
+		{"ghcr.io/acme/policies@sha256:" + strings.Repeat("a", 64), "ghcr.io/acme/policies@sha256:" + strings.Repeat("a", 64)},
+	}
+	for _, c := range cases {
+		ref, err := ParseReference(c.s)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if ref.String() != c.ref {
+			t.Errorf("ParseReference(%s) = %s, want %s", c.s, ref, c.ref)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package grok
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Order is the relation of two elements in the partial order of a lattice
+type Order int
+
+const (
+	Equal Order = iota
+	Below
+	Above
+	Incomparable
+)
+
+// Symbols of orders in OrderTrace strings
+var orderSymbols = map[Order]string{Equal: "=", Below: "⊑", Above: "⊒", Incomparable: "⋢"}
+
+func (o Order) String() string {
+	switch o {
+	case Equal:
+		return "equal"
+	case Below:
+		return "below"
+	case Above:
+		return "above"
+	default:
+		return "incomparable"
+	}
+}
+
+// ComponentOrder is the comparison of one component of two elements: the
+// elements themselves, or one component of product elements
+type ComponentOrder struct {
+	// Lattice is the name of the lattice of the component
+	Lattice string
+	A, B    string
+	Order   Order
+}
+
+func (c ComponentOrder) String() string {
+	return c.A + " " + orderSymbols[c.Order] + " " + c.B
+}
+
+// OrderTrace explains the order of two elements of a lattice, component by
+// component for product elements, where an element without a state stands
+// for the element in any state (AccountID is AccountID:TOP)
+type OrderTrace struct {
+	A, B  string
+	Order Order
+	// Meet and Join are the meet and the join of the elements
+	Meet, Join string
+	// Components are the comparisons of the components of product elements,
+	// or the comparison of the elements themselves
+	Components []ComponentOrder
+}
+
+// String returns the trace in one line, e.g. "AccountID ⊑ UniqueID but
+// Hashed ⋢ Truncated ⇒ incomparable"
+func (t OrderTrace) String() string {
+	var sb strings.Builder
+	for i, c := range t.Components {
+		if i > 0 {
+			if c.Order == t.Components[i-1].Order {
+				sb.WriteString(" and ")
+			} else {
+				sb.WriteString(" but ")
+			}
+		}
+		sb.WriteString(c.String())
+	}
+	sb.WriteString(" ⇒ ")
+	if t.Order == Incomparable {
+		sb.WriteString(t.Order.String())
+	} else {
+		sb.WriteString(fmt.Sprintf("%s %s %s", t.A, orderSymbols[t.Order], t.B))
+	}
+	return sb.String()
+}
+
+// ExplainOrder returns the trace of the comparison of two elements, since
+// the order of product elements is component-wise: a product element is below
+// another one only when each of its components is.
+func (l *Lattice) ExplainOrder(a, b string) OrderTrace {
+	t := OrderTrace{A: a, B: b, Order: l.order(a, b), Meet: l.Meet(a, b), Join: l.Join(a, b)}
+	if l.isProductValue(a) || l.isProductValue(b) {
+		fsta, snda := l.halve(a)
+		fstb, sndb := l.halve(b)
+		s := l.state()
+		t.Components = []ComponentOrder{
+			{Lattice: l.Name, A: fsta, B: fstb, Order: l.order(fsta, fstb)},
+			{Lattice: s.Name, A: snda, B: sndb, Order: s.order(snda, sndb)},
+		}
+	} else {
+		t.Components = []ComponentOrder{{Lattice: l.Name, A: a, B: b, Order: t.Order}}
+	}
+	return t
+}
+
+// order returns the order of two elements
+func (l *Lattice) order(a, b string) Order {
+	below, above := l.Precede(a, b), l.Precede(b, a)
+	switch {
+	case a == b || (below && above):
+		return Equal
+	case below:
+		return Below
+	case above:
+		return Above
+	default:
+		return Incomparable
+	}
+}
@@ -0,0 +1,44 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestExplainOrder(t *testing.T) {
+	cases := []struct {
+		a, b  string
+		order Order
+		str   string
+	}{
+		{"AccountID", "UniqueID", Below, "AccountID ⊑ UniqueID ⇒ AccountID ⊑ UniqueID"},
+		{"AccountID", "Location", Incomparable, "AccountID ⋢ Location ⇒ incomparable"},
+		{"AccountID:Hashed", "UniqueID:Truncated", Incomparable,
+			"AccountID ⊑ UniqueID but Hashed ⋢ Truncated ⇒ incomparable"},
+		{"AccountID:Redacted", "UniqueID:Truncated", Below,
+			"AccountID ⊑ UniqueID and Redacted ⊑ Truncated ⇒ AccountID:Redacted ⊑ UniqueID:Truncated"},
+		{"AccountID:Truncated", "AccountID", Below,
+			"AccountID = AccountID but Truncated ⊑ TOP ⇒ AccountID:Truncated ⊑ AccountID"},
+		{"UniqueID:Truncated", "AccountID:Redacted", Above,
+			"UniqueID ⊒ AccountID and Truncated ⊒ Redacted ⇒ UniqueID:Truncated ⊒ AccountID:Redacted"},
+	}
+	for _, c := range cases {
+		tr := lattice.ExplainOrder(c.a, c.b)
+		if tr.Order != c.order {
+			t.Errorf("ExplainOrder(%s, %s).Order = %s, want %s", c.a, c.b, tr.Order, c.order)
+		}
+		if tr.String() != c.str {
+			t.Errorf("ExplainOrder(%s, %s) = %q, want %q", c.a, c.b, tr, c.str)
+		}
+		if (tr.Order == Below || tr.Order == Equal) != lattice.Precede(c.a, c.b) {
+			t.Errorf("ExplainOrder(%s, %s) disagrees with Precede", c.a, c.b)
+		}
+	}
+
+	tr := lattice.ExplainOrder("AccountID:Hashed", "UniqueID:Truncated")
+	if tr.Meet != lattice.Meet("AccountID:Hashed", "UniqueID:Truncated") || tr.Join != "UniqueID" {
+		t.Errorf("Meet, Join = %s, %s", tr.Meet, tr.Join)
+	}
+	if len(tr.Components) != 2 || tr.Components[1].Lattice != "TypeState" {
+		t.Errorf("Components = %v", tr.Components)
+	}
+}
@@ -0,0 +1,138 @@
+package grok
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parameterized elements carry a numeric parameter next to a lattice element,
+// e.g. Aggregated(k=25) where Aggregated is an element of the TypeState lattice.
+// Two parameterizations of the same element are ordered numerically, where the
+// larger parameter precedes the smaller one: Aggregated(k=50) ⊑ Aggregated(k=25).
+// Parameterizations of the same element with different parameter names, e.g.
+// Aggregated(k=25) and Aggregated(l=25), are incomparable. Every
+// parameterization precedes its base element, and elements strictly below the
+// base precede every parameterization of it.
+
+// param is a parsed parameterized element
+type param struct {
+	base  string  // element of the lattice, e.g. Aggregated
+	key   string  // parameter name, e.g. k
+	value float64 // parameter value, e.g. 25
+}
+
+// parseParam returns the parsed parameter of element a, and false if a is not
+// a well-formed parameterized element
+func parseParam(a string) (param, bool) {
+	open := strings.IndexRune(a, '(')
+	if open <= 0 || !strings.HasSuffix(a, ")") {
+		return param{}, false
+	}
+	kv := strings.SplitN(a[open+1:len(a)-1], "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return param{}, false
+	}
+	v, err := strconv.ParseFloat(kv[1], 64)
+	if err != nil {
+		return param{}, false
+	}
+	return param{a[:open], kv[0], v}, true
+}
+
+// isParamValue returns true when either a or b is a parameterized element
+func isParamValue(a, b string) bool {
+	_, oka := parseParam(a)
+	_, okb := parseParam(b)
+	return oka || okb
+}
+
+// baseOf returns the base element of a, or a itself if it's not parameterized
+func baseOf(a string) string {
+	if p, ok := parseParam(a); ok {
+		return p.base
+	}
+	return a
+}
+
+// precedeParam is Precede for elements where at least one is parameterized
+func (l *Lattice) precedeParam(a, b string) bool {
+	pa, oka := parseParam(a)
+	pb, okb := parseParam(b)
+	switch {
+	case oka && okb && pa.base == pb.base:
+		return pa.key == pb.key && pa.value >= pb.value
+	case oka && okb:
+		return l.Precede(pa.base, pb.base)
+	case oka:
+		return l.Precede(pa.base, b)
+	default:
+		return a != pb.base && l.Precede(a, pb.base)
+	}
+}
+
+// meetParam is Meet for elements where at least one is parameterized
+func (l *Lattice) meetParam(a, b string) string {
+	pa, oka := parseParam(a)
+	pb, okb := parseParam(b)
+	if oka && okb && pa.base == pb.base && pa.key != pb.key {
+		return l.below(pa.base)
+	}
+	if oka && okb && pa.base == pb.base {
+		if pa.value >= pb.value {
+			return a
+		}
+		return b
+	}
+	m := l.Meet(baseOf(a), baseOf(b))
+	switch {
+	case oka && m == pa.base:
+		return a
+	case okb && m == pb.base:
+		return b
+	}
+	return m
+}
+
+// joinParam is Join for elements where at least one is parameterized
+func (l *Lattice) joinParam(a, b string) string {
+	pa, oka := parseParam(a)
+	pb, okb := parseParam(b)
+	if oka && okb && pa.base == pb.base && pa.key != pb.key {
+		return pa.base
+	}
+	if oka && okb && pa.base == pb.base {
+		if pa.value <= pb.value {
+			return a
+		}
+		return b
+	}
+	j := l.Join(baseOf(a), baseOf(b))
+	switch {
+	case oka && j == pa.base:
+		if b == pa.base {
+			return b
+		}
+		return a
+	case okb && j == pb.base:
+		if a == pb.base {
+			return a
+		}
+		return b
+	}
+	return j
+}
+
+// below returns the greatest element strictly below a, which bounds the
+// incomparable parameterizations of a from below. When a has several
+// children there is no such element, and it returns the meet of the children.
+func (l *Lattice) below(a string) string {
+	ch := l.childrenOf([]string{a})
+	if len(ch) == 0 {
+		return Bottom
+	}
+	m := ch[0]
+	for _, c := range ch[1:] {
+		m = l.Meet(m, c)
+	}
+	return m
+}
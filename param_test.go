@@ -0,0 +1,136 @@
+package grok
+
+import (
+	"testing"
+)
+
+var aggregation = NewLattice(`{
+	"name": "TypeState",
+	"edges": {
+		"Raw": ["Aggregated", "Hashed"],
+		"Aggregated": ["Suppressed"]
+	}
+}`)
+
+func TestParseParam(t *testing.T) {
+	cases := []struct {
+		a    string
+		want param
+		ok   bool
+	}{
+		{"Aggregated(k=25)", param{"Aggregated", "k", 25}, true},
+		{"Aggregated(k=2.5)", param{"Aggregated", "k", 2.5}, true},
+		{"Aggregated", param{}, false},
+		{"Aggregated(k)", param{}, false},
+		{"Aggregated(k=x)", param{}, false},
+		{"(k=1)", param{}, false},
+	}
+	for _, c := range cases {
+		got, ok := parseParam(c.a)
+		if ok != c.ok || got != c.want {
+			t.Errorf("parseParam(%q) = %v, %t, want %v, %t", c.a, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestPrecedeParam(t *testing.T) {
+	cases := []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		{"Aggregated(k=50)", "Aggregated(k=25)", true},
+		{"Aggregated(k=25)", "Aggregated(k=50)", false},
+		{"Aggregated(k=25)", "Aggregated(k=25)", true},
+		{"Aggregated(k=25)", "Aggregated", true},
+		{"Aggregated", "Aggregated(k=25)", false},
+		{"Aggregated(k=25)", "Raw", true},
+		{"Suppressed", "Aggregated(k=25)", true},
+		{"Hashed", "Aggregated(k=25)", false},
+		{"Aggregated(k=25)", "Hashed", false},
+		{"Aggregated(k=50)", "Aggregated(l=25)", false},
+		{"Aggregated(l=25)", "Aggregated(k=25)", false},
+	}
+	for _, c := range cases {
+		got := aggregation.Precede(c.a, c.b)
+		if got != c.want {
+			t.Errorf("Precede(%q, %q) = %t, want %t", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestMeetJoinParam(t *testing.T) {
+	cases := []struct {
+		a    string
+		b    string
+		meet string
+		join string
+	}{
+		{"Aggregated(k=50)", "Aggregated(k=25)", "Aggregated(k=50)", "Aggregated(k=25)"},
+		{"Aggregated(k=25)", "Aggregated", "Aggregated(k=25)", "Aggregated"},
+		{"Aggregated(k=25)", "Raw", "Aggregated(k=25)", "Raw"},
+		{"Aggregated(k=25)", "Suppressed", "Suppressed", "Aggregated(k=25)"},
+		{"Aggregated(k=25)", "Hashed", "BOTTOM", "Raw"},
+		{"Aggregated(k=25)", "Aggregated(l=25)", "Suppressed", "Aggregated"},
+		{"Raw", "Raw(k=1)", "Raw(k=1)", "Raw"},
+		{"Raw(k=1)", "Raw(l=1)", "BOTTOM", "Raw"},
+	}
+	for _, c := range cases {
+		if got := aggregation.Meet(c.a, c.b); got != c.meet {
+			t.Errorf("Meet(%q, %q) = %s, want %s", c.a, c.b, got, c.meet)
+		}
+		if got := aggregation.Join(c.a, c.b); got != c.join {
+			t.Errorf("Join(%q, %q) = %s, want %s", c.a, c.b, got, c.join)
+		}
+	}
+}
+
+func TestApplyOnParam(t *testing.T) {
+	p := NewPolicy([]*Lattice{aggregation})
+	// sharing requires an aggregation level of at least 25
+	if err := p.ParsePolicy(`ALLOW TypeState Aggregated(k=25)`); err != nil {
+		t.Fatalf("%q", err)
+	}
+	cases := []struct {
+		astr string
+		want bool
+	}{
+		{"TypeState Aggregated(k=100)", true},
+		{"TypeState Aggregated(k=25)", true},
+		{"TypeState Aggregated(k=10)", false},
+		{"TypeState Aggregated", false},
+		{"TypeState Suppressed", true},
+		{"TypeState Aggregated(l=100)", false},
+	}
+	for _, c := range cases {
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := p.ApplyOn(an); got != c.want {
+			t.Errorf("ApplyOn(%q) = %t, want %t", c.astr, got, c.want)
+		}
+	}
+	if _, err := p.ParseAnnotation(`TypeState Unknown(k=10)`); err == nil {
+		t.Errorf("ParseAnnotation(Unknown(k=10)) should fail")
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		str  string
+		want []string
+	}{
+		{"DataType IPAddress", []string{"DataType", "IPAddress"}},
+		{"TypeState Aggregated(k=25)", []string{"TypeState", "Aggregated(k=25)"}},
+		{"DataType UniqueID:Aggregated(k=25) Purpose Sharing",
+			[]string{"DataType", "UniqueID:Aggregated(k=25)", "Purpose", "Sharing"}},
+		{"EXCEPT { ALLOW }", []string{"EXCEPT", "{", "ALLOW", "}"}},
+	}
+	for _, c := range cases {
+		got := tokenize(c.str)
+		if !equals(got, c.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", c.str, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package pdp
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// Scope is the scope of an API key of the admin endpoints
+type Scope int
+
+const (
+	// ReadOnly keys read the bundle
+	ReadOnly Scope = iota + 1
+	// Admin keys also upload and reload bundles
+	Admin
+)
+
+// Bundle is a bundle of the /admin/bundle endpoint: its version and the
+// snapshots of its policies (see grok.Policy.WriteSnapshot)
+type Bundle struct {
+	Version  string            `json:"version"`
+	Policies []json.RawMessage `json:"policies"`
+}
+
+func (s *Server) bundle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.authorize(w, r, ReadOnly, s.getBundle)
+	case http.MethodPut:
+		s.authorize(w, r, Admin, s.putBundle)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeError(w, http.StatusMethodNotAllowed, "pdp: the bundle is read with GET and uploaded with PUT")
+	}
+}
+
+func (s *Server) reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "pdp: reloads are POSTed")
+		return
+	}
+	s.authorize(w, r, Admin, func(w http.ResponseWriter, r *http.Request) {
+		if s.Source == nil {
+			writeError(w, http.StatusNotImplemented, "pdp: the server has no bundle source")
+			return
+		}
+		version, set, err := s.Source()
+		if err == nil {
+			err = s.Load(version, set)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, s.Status())
+	})
+}
+
+// authorize serves a request with h when its API key has the scope needed
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, need Scope, h http.HandlerFunc) {
+	scope := s.scopeOf(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	switch {
+	case scope == 0:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pdp"`)
+		writeError(w, http.StatusUnauthorized, "pdp: a valid API key is required")
+	case scope < need:
+		writeError(w, http.StatusForbidden, fmt.Sprintf("pdp: %s %s needs an admin API key", r.Method, r.URL.Path))
+	default:
+		h(w, r)
+	}
+}
+
+// scopeOf returns the scope of an API key, or 0 when it's unknown. Keys are
+// compared in constant time.
+func (s *Server) scopeOf(key string) Scope {
+	if key == "" {
+		return 0
+	}
+	for k, scope := range s.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return scope
+		}
+	}
+	return 0
+}
+
+func (s *Server) getBundle(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	set, version := s.set, s.version
+	s.mu.RUnlock()
+	if set == nil {
+		writeError(w, http.StatusNotFound, ErrNoBundle.Error())
+		return
+	}
+	b := Bundle{Version: version, Policies: make([]json.RawMessage, 0, len(set.Policies))}
+	for _, p := range set.Policies {
+		var buf bytes.Buffer
+		if err := p.WriteSnapshot(&buf); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		b.Policies = append(b.Policies, json.RawMessage(bytes.TrimSpace(buf.Bytes())))
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) putBundle(w http.ResponseWriter, r *http.Request) {
+	var b Bundle
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("pdp: %s", err))
+		return
+	}
+	set := grok.NewPolicySet()
+	for i, raw := range b.Policies {
+		p, err := grok.ReadSnapshot(bytes.NewReader(raw))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("pdp: policy %d: %s", i, err))
+			return
+		}
+		set.Add(p)
+	}
+	if err := s.Load(b.Version, set); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Status())
+}
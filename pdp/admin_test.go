@@ -0,0 +1,82 @@
+package pdp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func admin(s *Server, method, target, key string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdmin(t *testing.T) {
+	s := NewServer()
+	s.Keys = map[string]Scope{"reader": ReadOnly, "root": Admin}
+	if err := s.Load("v1", newSet(t, "p1")); err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	cases := []struct {
+		method, target, key string
+		code                int
+	}{
+		{http.MethodGet, "/admin/bundle", "", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/bundle", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/bundle", "reader", http.StatusOK},
+		{http.MethodGet, "/admin/bundle", "root", http.StatusOK},
+		{http.MethodPut, "/admin/bundle", "reader", http.StatusForbidden},
+		{http.MethodPost, "/admin/reload", "reader", http.StatusForbidden},
+		{http.MethodPost, "/admin/reload", "root", http.StatusNotImplemented},
+		{http.MethodDelete, "/admin/bundle", "root", http.StatusMethodNotAllowed},
+		// decisions stay unauthenticated
+		{http.MethodPost, "/v1/decisions", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		body := []byte(`{"annotation":[["DataType","Location"]]}`)
+		if w := admin(s, c.method, c.target, c.key, body); w.Code != c.code {
+			t.Errorf("%s %s with key %q = %d, want %d", c.method, c.target, c.key, w.Code, c.code)
+		}
+	}
+
+	// a bundle read with GET uploads with PUT
+	w := admin(s, http.MethodGet, "/admin/bundle", "reader", nil)
+	var b Bundle
+	if err := json.Unmarshal(w.Body.Bytes(), &b); err != nil || b.Version != "v1" || len(b.Policies) != 1 {
+		t.Fatalf("bundle = %+v, %v", b, err)
+	}
+	b.Version = "v2"
+	body, _ := json.Marshal(b)
+	if w := admin(s, http.MethodPut, "/admin/bundle", "root", body); w.Code != http.StatusOK || s.Status().Version != "v2" {
+		t.Errorf("PUT bundle = %d %s", w.Code, w.Body)
+	}
+	if w := admin(s, http.MethodPut, "/admin/bundle", "root", []byte(`{"version":"v3","policies":[{}]}`)); w.Code != http.StatusBadRequest || s.Status().Version != "v2" {
+		t.Errorf("PUT invalid bundle = %d %s", w.Code, w.Body)
+	}
+
+	s.Source = func() (string, *grok.PolicySet, error) { return "v4", newSet(t, "p1", "p2"), nil }
+	if w := admin(s, http.MethodPost, "/admin/reload", "root", nil); w.Code != http.StatusOK || s.Status().Version != "v4" {
+		t.Errorf("reload = %d %s", w.Code, w.Body)
+	}
+	s.Source = func() (string, *grok.PolicySet, error) { return "", nil, errors.New("registry unavailable") }
+	if w := admin(s, http.MethodPost, "/admin/reload", "root", nil); w.Code != http.StatusBadGateway || s.Status().Version != "v4" {
+		t.Errorf("failed reload = %d %s", w.Code, w.Body)
+	}
+
+	// without keys, the admin endpoints deny every request
+	s.Keys = nil
+	if w := admin(s, http.MethodGet, "/admin/bundle", "root", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET bundle without keys = %d", w.Code)
+	}
+}
@@ -0,0 +1,412 @@
+// Package pdp is a policy decision point: an HTTP server of the decisions of
+// a bundle of policies, for the enforcement points that don't embed grok.
+//
+// A bundle is a policy set of a version, e.g. the digest of an OCI bundle
+// (see package oci), which the server swaps atomically when it's reloaded:
+//
+//	s := pdp.NewServer()
+//	if err := s.Load("v42", set); err != nil { ... }
+//	http.ListenAndServe(":8181", s)
+//
+// The endpoints are
+//
+//	POST /v1/decisions  the decision of the bundle on an annotation:
+//	                    {"annotation":[["DataType","IPAddress"]]} → {"allowed":false,"denying":["p1"],"version":"v42"}
+//	                    or 400 when a policy rejects the annotation (see
+//	                    grok.Policy.ValidateAnnotation)
+//	POST /v1/decisions/stream
+//	                    the decisions of newline-delimited requests, each with
+//	                    an ID that correlates it to its response, pipelined
+//	                    within the StreamWindow and streamed back as
+//	                    newline-delimited responses in the order they're
+//	                    decided, over HTTP/2 (HTTP/1.x clients get them once
+//	                    their requests end, up to MaxBufferedStream
+//	                    requests): {"id":"r1","annotation":[...]} →
+//	                    {"id":"r1","allowed":true,...} or {"id":"r1","error":...}
+//	GET  /healthz       200 while the server is up
+//	GET  /readyz        200 once a bundle is loaded and validated, 503 before
+//	GET  /status        the version of the bundle, the fingerprints of its
+//	                    lattices, and the time and result of the last reload
+//	GET  /metrics       the counts of decisions and of shed decisions, in the
+//	                    Prometheus text format
+//
+// and the admin endpoints, which need an API key of the server (see Keys)
+// as a bearer token, so that decisions stay unauthenticated inside the mesh
+// while administration is protected:
+//
+//	GET  /admin/bundle  the version and the policy snapshots of the bundle,
+//	                    for ReadOnly and Admin keys
+//	PUT  /admin/bundle  loads a bundle of that form, for Admin keys
+//	POST /admin/reload  loads the bundle of the Source, for Admin keys
+//
+// A failed reload keeps the bundle loaded, so that a server stays ready, and
+// monitoring reads the failure from /status.
+//
+// The server sheds the decisions that exceed their Deadline, and the ones
+// beyond MaxInFlight concurrent decisions, so that enforcement never becomes
+// the availability bottleneck: shed decisions are denied with their reason,
+// or allowed in monitor mode (see ShedBehavior).
+//
+// The server records its decisions into its Recorder, e.g. a replay file,
+// which Replay replays against another bundle or build to diff the outcomes
+// before an upgrade.
+package pdp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+// ErrNoBundle is the error of the decisions requested before a bundle is loaded
+var ErrNoBundle = errors.New("pdp: no bundle is loaded")
+
+// Request is the request of the /v1/decisions endpoint
+type Request struct {
+	Annotation grok.Annotation `json:"annotation"`
+}
+
+// Response is the response of the /v1/decisions endpoint
+type Response struct {
+	Allowed bool `json:"allowed"`
+	// Denying are the IDs of the policies denying the annotation, or their
+	// indexes in the set when they have none
+	Denying []string `json:"denying"`
+	// Version is the version of the bundle that decided
+	Version string `json:"version"`
+	// Shed is true when the decision was shed, for the Reason
+	Shed   bool   `json:"shed,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ShedBehavior is the decision of the requests that the server sheds
+type ShedBehavior int
+
+const (
+	// ShedDeny denies the decisions shed, with the reason they were shed
+	ShedDeny ShedBehavior = iota
+	// ShedMonitor allows the decisions shed, like a policy in monitor mode
+	ShedMonitor
+)
+
+// Metrics are the counters of the decisions of a server
+type Metrics struct {
+	Decisions int64
+	// ShedDeadline and ShedOverload count the decisions shed because they
+	// exceeded their deadline, and because too many were in flight
+	ShedDeadline, ShedOverload int64
+	// InFlight is the number of decisions being evaluated, including the ones
+	// shed at their deadline that are still running
+	InFlight int64
+}
+
+// Reload is the result of a reload of the bundle
+type Reload struct {
+	Version string    `json:"version"`
+	Time    time.Time `json:"time"`
+	// Error is the reason the bundle was rejected, empty when it was loaded
+	Error string `json:"error,omitempty"`
+}
+
+// Status is the response of the /status endpoint
+type Status struct {
+	Ready bool `json:"ready"`
+	// Version is the version of the bundle loaded
+	Version string `json:"version,omitempty"`
+	// Lattices are the fingerprints of the lattices of the bundle by name (see
+	// grok.Policy.Fingerprints)
+	Lattices map[string]string `json:"lattices,omitempty"`
+	// LoadedAt is the time the bundle was loaded
+	LoadedAt   *time.Time `json:"loaded_at,omitempty"`
+	LastReload *Reload    `json:"last_reload,omitempty"`
+}
+
+// Server serves the decisions of a bundle. It's safe for concurrent use, but
+// its fields must be set before it serves.
+type Server struct {
+	// Now returns the current time, time.Now when it's nil
+	Now func() time.Time
+	// Deadline is the maximum latency of a decision, none when it's 0
+	Deadline time.Duration
+	// MaxInFlight is the maximum number of concurrent decisions, none when
+	// it's 0
+	MaxInFlight int
+	// StreamWindow is the maximum number of requests of a stream decided
+	// but not yet responded, DefaultStreamWindow when it's 0
+	StreamWindow int
+	// Shed is the decision of the decisions shed
+	Shed ShedBehavior
+	// Recorder records the decisions that aren't shed, a record per policy
+	// (see grok.Record) with the version of the bundle, e.g. into a replay
+	// file with a grok.RecordWriter, for Replay
+	Recorder grok.AuditSink
+	// Keys are the API keys of the admin endpoints and their scopes. The
+	// admin endpoints deny every request without keys, while the decision
+	// and health endpoints are never authenticated.
+	Keys map[string]Scope
+	// Source returns the bundle to load on POST /admin/reload, e.g. from an
+	// OCI registry
+	Source func() (string, *grok.PolicySet, error)
+	// BeforeDecision is called before every evaluation, within its deadline,
+	// e.g. to inject latency in tests (see package chaos)
+	BeforeDecision func()
+	mux            *http.ServeMux
+
+	// decisions, shedDeadline, shedOverload and inFlight are updated
+	// atomically
+	decisions, shedDeadline, shedOverload, inFlight int64
+
+	mu       sync.RWMutex
+	set      *grok.PolicySet
+	version  string
+	lattices map[string]string
+	loadedAt time.Time
+	last     *Reload
+}
+
+// NewServer returns a server without bundle, which isn't ready until a bundle
+// is loaded
+func NewServer() *Server {
+	s := &Server{mux: http.NewServeMux()}
+	s.mux.HandleFunc("/v1/decisions", s.decide)
+	s.mux.HandleFunc("/v1/decisions/stream", s.decideStream)
+	s.mux.HandleFunc("/healthz", s.healthz)
+	s.mux.HandleFunc("/readyz", s.readyz)
+	s.mux.HandleFunc("/status", s.status)
+	s.mux.HandleFunc("/metrics", s.metrics)
+	s.mux.HandleFunc("/admin/bundle", s.bundle)
+	s.mux.HandleFunc("/admin/reload", s.reload)
+	return s
+}
+
+// Load validates a bundle, and swaps it for the bundle loaded when it's
+// valid. The reload is reported by /status either way.
+func (s *Server) Load(version string, set *grok.PolicySet) error {
+	err := validate(version, set)
+	lattices := make(map[string]string)
+	if err == nil {
+		for _, p := range set.Policies {
+			_, ls := p.Fingerprints()
+			for name, fp := range ls {
+				lattices[name] = fp
+			}
+		}
+	}
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = &Reload{Version: version, Time: now}
+	if err != nil {
+		s.last.Error = err.Error()
+		return err
+	}
+	s.set, s.version, s.lattices, s.loadedAt = set, version, lattices, now
+	return nil
+}
+
+func validate(version string, set *grok.PolicySet) error {
+	if version == "" {
+		return errors.New("pdp: the bundle has no version")
+	}
+	if set == nil || len(set.Policies) == 0 {
+		return errors.New(fmt.Sprintf("pdp: bundle %s has no policies", version))
+	}
+	if err := set.Validate(); err != nil {
+		return errors.New(fmt.Sprintf("pdp: bundle %s: %s", version, err))
+	}
+	return nil
+}
+
+// Status returns the status of the server, see /status
+func (s *Server) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := Status{Ready: s.set != nil, Version: s.version, Lattices: s.lattices}
+	if s.set != nil {
+		t := s.loadedAt
+		st.LoadedAt = &t
+	}
+	if s.last != nil {
+		r := *s.last
+		st.LastReload = &r
+	}
+	return st
+}
+
+// ServeHTTP serves the endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Decide returns the decision of the bundle loaded on an annotation, or the
+// shed decision when it exceeds its deadline or too many decisions are in
+// flight. It returns ErrNoBundle before a bundle is loaded, and an error when
+// a policy of the bundle rejects the annotation, which isn't evaluated then.
+func (s *Server) Decide(an grok.Annotation) (Response, error) {
+	s.mu.RLock()
+	set, version := s.set, s.version
+	s.mu.RUnlock()
+	if set == nil {
+		return Response{}, ErrNoBundle
+	}
+	// an annotation with values unknown to the lattices can't be evaluated
+	for i, p := range set.Policies {
+		if err := p.ValidateAnnotation(an); err != nil {
+			return Response{}, errors.New(fmt.Sprintf("pdp: policy %s: %s", idOf(p, i), err))
+		}
+	}
+	atomic.AddInt64(&s.decisions, 1)
+	if n := atomic.AddInt64(&s.inFlight, 1); s.MaxInFlight > 0 && n > int64(s.MaxInFlight) {
+		atomic.AddInt64(&s.inFlight, -1)
+		atomic.AddInt64(&s.shedOverload, 1)
+		return s.shed(version, fmt.Sprintf("pdp: more than %d decisions in flight", s.MaxInFlight)), nil
+	}
+	if s.Deadline <= 0 {
+		defer atomic.AddInt64(&s.inFlight, -1)
+		return s.evaluate(set, version, an), nil
+	}
+
+	// the evaluation can't be interrupted, it runs to completion in the
+	// background once shed
+	done := make(chan Response, 1)
+	go func() {
+		defer atomic.AddInt64(&s.inFlight, -1)
+		done <- s.evaluate(set, version, an)
+	}()
+	timer := time.NewTimer(s.Deadline)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res, nil
+	case <-timer.C:
+		atomic.AddInt64(&s.shedDeadline, 1)
+		return s.shed(version, fmt.Sprintf("pdp: the decision exceeded its deadline of %s", s.Deadline)), nil
+	}
+}
+
+// evaluate returns the decision of a set on an annotation
+func (s *Server) evaluate(set *grok.PolicySet, version string, an grok.Annotation) Response {
+	if s.BeforeDecision != nil {
+		s.BeforeDecision()
+	}
+	res := Response{Allowed: true, Denying: make([]string, 0), Version: version}
+	for i, p := range set.Policies {
+		id := idOf(p, i)
+		allowed := false
+		if s.Recorder != nil {
+			allowed = p.Evaluate(an, grok.WithClock(s.now), grok.WithAuditSink(bundleSink{s.Recorder, id, version})).Allowed
+		} else {
+			allowed = p.ApplyOn(an)
+		}
+		if !allowed {
+			res.Allowed = false
+			res.Denying = append(res.Denying, id)
+		}
+	}
+	return res
+}
+
+// idOf returns the ID of the i-th policy of a set, or its index when it has
+// none
+func idOf(p *grok.Policy, i int) string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return fmt.Sprint(i)
+}
+
+// bundleSink records the decisions of a policy of a bundle
+type bundleSink struct {
+	s           grok.AuditSink
+	id, version string
+}
+
+func (b bundleSink) Write(r grok.Record) error {
+	r.PolicyID, r.Bundle = b.id, b.version
+	return b.s.Write(r)
+}
+
+// shed returns the decision of a shed request
+func (s *Server) shed(version, reason string) Response {
+	return Response{Allowed: s.Shed == ShedMonitor, Denying: make([]string, 0), Version: version, Shed: true, Reason: reason}
+}
+
+// Metrics returns the counters of the decisions of the server
+func (s *Server) Metrics() Metrics {
+	return Metrics{Decisions: atomic.LoadInt64(&s.decisions), ShedDeadline: atomic.LoadInt64(&s.shedDeadline),
+		ShedOverload: atomic.LoadInt64(&s.shedOverload), InFlight: atomic.LoadInt64(&s.inFlight)}
+}
+
+func (s *Server) decide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "pdp: decisions are POSTed")
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("pdp: %s", err))
+		return
+	}
+	res, err := s.Decide(req.Annotation)
+	if err == ErrNoBundle {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if st := s.Status(); !st.Ready {
+		writeError(w, http.StatusServiceUnavailable, ErrNoBundle.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Status())
+}
+
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	m := s.Metrics()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP grok_pdp_decisions_total The decisions requested.\n# TYPE grok_pdp_decisions_total counter\n")
+	fmt.Fprintf(w, "grok_pdp_decisions_total %d\n", m.Decisions)
+	fmt.Fprintf(w, "# HELP grok_pdp_shed_total The decisions shed, by reason.\n# TYPE grok_pdp_shed_total counter\n")
+	fmt.Fprintf(w, "grok_pdp_shed_total{reason=\"deadline\"} %d\n", m.ShedDeadline)
+	fmt.Fprintf(w, "grok_pdp_shed_total{reason=\"overload\"} %d\n", m.ShedOverload)
+	fmt.Fprintf(w, "# HELP grok_pdp_in_flight The decisions being evaluated.\n# TYPE grok_pdp_in_flight gauge\n")
+	fmt.Fprintf(w, "grok_pdp_in_flight %d\n", m.InFlight)
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,161 @@
+package pdp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+func newSet(t *testing.T, ids ...string) *grok.PolicySet {
+	ls := grok.NewLattices(`[
+		{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }
+	]`)
+	set := grok.NewPolicySet()
+	for _, id := range ids {
+		p := grok.NewPolicy(ls)
+		p.ID = id
+		if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType AccountID }"); err != nil {
+			t.Fatalf("%q", err)
+		}
+		set.Add(p)
+	}
+	return set
+}
+
+func serve(t *testing.T, s *Server, method, target, body string, v interface{}) int {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, target, bytes.NewBufferString(body)))
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %q", method, target, err)
+		}
+	}
+	return w.Code
+}
+
+func TestServer(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	s := NewServer()
+	s.Now = func() time.Time { return now }
+
+	if code := serve(t, s, http.MethodGet, "/healthz", "", nil); code != http.StatusOK {
+		t.Errorf("healthz = %d", code)
+	}
+	if code := serve(t, s, http.MethodGet, "/readyz", "", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz before a bundle = %d", code)
+	}
+	if code := serve(t, s, http.MethodPost, "/v1/decisions", `{"annotation":[["DataType","AccountID"]]}`, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("decision before a bundle = %d", code)
+	}
+
+	if err := s.Load("v1", newSet(t, "p1", "p2")); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if code := serve(t, s, http.MethodGet, "/readyz", "", nil); code != http.StatusOK {
+		t.Errorf("readyz = %d", code)
+	}
+	var res Response
+	if code := serve(t, s, http.MethodPost, "/v1/decisions", `{"annotation":[["DataType","AccountID"]]}`, &res); code != http.StatusOK ||
+		res.Allowed || len(res.Denying) != 2 || res.Denying[0] != "p1" || res.Version != "v1" {
+		t.Errorf("decision = %d %+v", code, res)
+	}
+	if code := serve(t, s, http.MethodPost, "/v1/decisions", `{"annotation":[["DataType","Location"]]}`, &res); code != http.StatusOK || !res.Allowed {
+		t.Errorf("decision = %d %+v", code, res)
+	}
+	// annotations that the policies reject aren't evaluated
+	var e map[string]string
+	for _, body := range []string{`{"annotation":[["DataType","Unknown"]]}`, `{"annotation":[["DataType","ALLOF(AccountID,Unknown)"]]}`} {
+		if code := serve(t, s, http.MethodPost, "/v1/decisions", body, &e); code != http.StatusBadRequest || !strings.HasPrefix(e["error"], "pdp: policy p1: ") {
+			t.Errorf("decision on %s = %d %+v", body, code, e)
+		}
+	}
+	if code := serve(t, s, http.MethodGet, "/v1/decisions", "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET decision = %d", code)
+	}
+
+	// a rejected bundle keeps the bundle loaded
+	now = now.Add(time.Minute)
+	if err := s.Load("v2", newSet(t, "p1", "p1")); err == nil {
+		t.Errorf("duplicate IDs should fail")
+	}
+	var st Status
+	serve(t, s, http.MethodGet, "/status", "", &st)
+	if !st.Ready || st.Version != "v1" || st.Lattices["DataType"] == "" || st.LoadedAt == nil || !st.LoadedAt.Equal(now.Add(-time.Minute)) {
+		t.Errorf("status = %+v", st)
+	}
+	if r := st.LastReload; r == nil || r.Version != "v2" || r.Error == "" || !r.Time.Equal(now) {
+		t.Errorf("last reload = %+v", r)
+	}
+	if code := serve(t, s, http.MethodGet, "/readyz", "", nil); code != http.StatusOK {
+		t.Errorf("readyz after a failed reload = %d", code)
+	}
+}
+
+func TestShed(t *testing.T) {
+	an := grok.Annotation{}
+	if err := an.UnmarshalJSON([]byte(`[["DataType","Location"]]`)); err != nil {
+		t.Fatalf("%q", err)
+	}
+	for _, behavior := range []ShedBehavior{ShedDeny, ShedMonitor} {
+		s := NewServer()
+		if err := s.Load("v1", newSet(t, "p1")); err != nil {
+			t.Fatalf("%q", err)
+		}
+		s.Deadline, s.MaxInFlight, s.Shed = 10*time.Millisecond, 1, behavior
+		release := make(chan struct{})
+		s.BeforeDecision = func() { <-release }
+
+		// the first decision is shed at its deadline, and still in flight
+		res, err := s.Decide(an)
+		if err != nil || !res.Shed || res.Allowed != (behavior == ShedMonitor) || res.Reason == "" {
+			t.Errorf("%d: decision past its deadline = %+v, %v", behavior, res, err)
+		}
+		// so the second one is shed as overload
+		res, err = s.Decide(an)
+		if err != nil || !res.Shed || res.Allowed != (behavior == ShedMonitor) {
+			t.Errorf("%d: decision over MaxInFlight = %+v, %v", behavior, res, err)
+		}
+		if m := s.Metrics(); m.Decisions != 2 || m.ShedDeadline != 1 || m.ShedOverload != 1 || m.InFlight != 1 {
+			t.Errorf("%d: metrics = %+v", behavior, m)
+		}
+		close(release)
+		for s.Metrics().InFlight != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if res, err := s.Decide(an); err != nil || res.Shed || !res.Allowed {
+			t.Errorf("%d: decision = %+v, %v", behavior, res, err)
+		}
+	}
+
+	// invalid annotations don't take a slot, even past a deadline
+	s := NewServer()
+	if err := s.Load("v1", newSet(t, "p1")); err != nil {
+		t.Fatalf("%q", err)
+	}
+	s.Deadline, s.MaxInFlight = 10*time.Millisecond, 1
+	unknown := grok.Annotation{}
+	if err := unknown.UnmarshalJSON([]byte(`[["DataType","Unknown"]]`)); err != nil {
+		t.Fatalf("%q", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := s.Decide(unknown); err == nil || err == ErrNoBundle {
+			t.Errorf("decision on an unknown element = %v", err)
+		}
+	}
+	if res, err := s.Decide(an); err != nil || res.Shed || !res.Allowed || s.Metrics().InFlight != 0 {
+		t.Errorf("decision = %+v, %v, metrics = %+v", res, err, s.Metrics())
+	}
+
+	s = NewServer()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if body := w.Body.String(); !strings.Contains(body, "grok_pdp_decisions_total 0\n") || !strings.Contains(body, `grok_pdp_shed_total{reason="deadline"} 0`) {
+		t.Errorf("metrics = %s", body)
+	}
+}
@@ -0,0 +1,89 @@
+package pdp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// Change is a recorded decision whose effect changed when it was replayed
+type Change struct {
+	Record grok.Record
+	// Effect is the effect of the replayed decision, ALLOW or DENY
+	Effect string
+}
+
+// ReplayReport is the outcome of the replay of recorded decisions against a
+// bundle
+type ReplayReport struct {
+	// Version is the version of the bundle replayed against
+	Version string
+	// Replayed counts the records, of which Unchanged have the same effect
+	Replayed, Unchanged int
+	Changed             []Change
+	// Missing are the records of the policies that the bundle doesn't have
+	Missing []grok.Record
+}
+
+// Regressed returns true when a decision changed, or a policy is missing
+func (r *ReplayReport) Regressed() bool {
+	return len(r.Changed) > 0 || len(r.Missing) > 0
+}
+
+// String returns the summary of the replay, and a line per change, e.g.
+//
+//	3 decisions replayed against v2: 1 unchanged, 1 changed, 1 missing
+//	  p1: DataType IPAddress: ALLOW → DENY
+//	  p2: DataType AccountID: missing from v2
+func (r *ReplayReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d decisions replayed against %s: %d unchanged, %d changed, %d missing",
+		r.Replayed, r.Version, r.Unchanged, len(r.Changed), len(r.Missing))
+	for _, c := range r.Changed {
+		fmt.Fprintf(&b, "\n  %s: %s: %s → %s", c.Record.PolicyID, c.Record.Annotation, c.Record.Effect, c.Effect)
+	}
+	for _, rec := range r.Missing {
+		fmt.Fprintf(&b, "\n  %s: %s: missing from %s", rec.PolicyID, rec.Annotation, r.Version)
+	}
+	return b.String()
+}
+
+// Replay replays the decisions recorded by a server (see Server.Recorder)
+// against a bundle, e.g. the next version of the bundle, or the same bundle
+// with a new build, and reports the decisions whose effect changed. Records
+// are matched to the policies of the bundle by the IDs of the policies, or
+// by their indexes when they have none. The records of failed decisions,
+// e.g. past their budget, aren't replayed.
+func Replay(r io.Reader, version string, set *grok.PolicySet) (*ReplayReport, error) {
+	policies := make(map[string]*grok.Policy)
+	for i, p := range set.Policies {
+		policies[idOf(p, i)] = p
+	}
+	report := &ReplayReport{Version: version, Changed: make([]Change, 0), Missing: make([]grok.Record, 0)}
+	rr := grok.NewRecordReader(r)
+	for {
+		rec, err := rr.Read()
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		if rec.Error != "" {
+			continue
+		}
+		report.Replayed++
+		p := policies[rec.PolicyID]
+		if p == nil {
+			report.Missing = append(report.Missing, rec)
+			continue
+		}
+		if effect := grok.EffectOf(p.Evaluate(rec.Annotation).Allowed); effect != rec.Effect {
+			report.Changed = append(report.Changed, Change{Record: rec, Effect: effect})
+		} else {
+			report.Unchanged++
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package pdp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewServer()
+	s.Recorder = grok.NewRecordWriter(&buf)
+	if err := s.Load("v1", newSet(t, "p1", "p2")); err != nil {
+		t.Fatalf("%q", err)
+	}
+	for _, js := range []string{`[["DataType","IPAddress"]]`, `[["DataType","AccountID"]]`} {
+		var an grok.Annotation
+		if err := an.UnmarshalJSON([]byte(js)); err != nil {
+			t.Fatalf("%q", err)
+		}
+		if _, err := s.Decide(an); err != nil {
+			t.Fatalf("%q", err)
+		}
+	}
+	recs, err := grok.ReadRecords(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(recs) != 4 || recs[0].PolicyID != "p1" || recs[0].Bundle != "v1" || recs[0].Effect != grok.Allow {
+		t.Fatalf("records = %+v, %v", recs, err)
+	}
+
+	// v2 denies IP addresses in p1, and drops p2
+	p1 := newSet(t, "p1").Policies[0]
+	if err := p1.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType AccountID DENY DataType IPAddress }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	r, err := Replay(bytes.NewReader(buf.Bytes()), "v2", grok.NewPolicySet(p1))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if r.Replayed != 4 || r.Unchanged != 1 || len(r.Changed) != 1 || len(r.Missing) != 2 || !r.Regressed() {
+		t.Fatalf("report = %+v", r)
+	}
+	if c := r.Changed[0]; c.Record.PolicyID != "p1" || c.Record.Effect != grok.Allow || c.Effect != grok.Deny {
+		t.Errorf("change = %+v", c)
+	}
+	if !strings.HasPrefix(r.String(), "4 decisions replayed against v2: 1 unchanged, 1 changed, 2 missing\n  p1: DataType IPAddress: ALLOW → DENY") {
+		t.Errorf("String() = %s", r)
+	}
+
+	// the same bundle replays unchanged
+	r, err = Replay(bytes.NewReader(buf.Bytes()), "v1", newSet(t, "p1", "p2"))
+	if err != nil || r.Regressed() || r.Unchanged != 4 {
+		t.Errorf("report = %+v, %v", r, err)
+	}
+}
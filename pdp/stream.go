@@ -0,0 +1,149 @@
+package pdp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/grongjun/grok"
+)
+
+// DefaultStreamWindow is the window of the streams when the server has none
+const DefaultStreamWindow = 64
+
+// MaxBufferedStream is the maximum number of requests of a stream over
+// HTTP/1.x, whose responses are buffered until its requests end. The
+// requests beyond it are rejected with an error response.
+const MaxBufferedStream = 1024
+
+// StreamRequest is a request of the /v1/decisions/stream endpoint, with the
+// ID that correlates it to its response
+type StreamRequest struct {
+	ID         string          `json:"id"`
+	Annotation grok.Annotation `json:"annotation"`
+}
+
+// StreamResponse is the response of the /v1/decisions/stream endpoint to the
+// request of its ID: the decision, or the error of the request
+type StreamResponse struct {
+	ID string `json:"id"`
+	Response
+	Error string `json:"error,omitempty"`
+}
+
+// decideStream decides the requests of a stream concurrently, and streams
+// their responses in the order they're decided. At most the window of the
+// server are decided or unsent at a time, so that a slow client holds the
+// reading of its requests back.
+func (s *Server) decideStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "pdp: decisions are POSTed")
+		return
+	}
+	s.mu.RLock()
+	loaded := s.set != nil
+	s.mu.RUnlock()
+	if !loaded {
+		writeError(w, http.StatusServiceUnavailable, ErrNoBundle.Error())
+		return
+	}
+	window := s.StreamWindow
+	if window < 1 {
+		window = DefaultStreamWindow
+	}
+	slots := make(chan struct{}, window)
+	responses := make(chan StreamResponse, window)
+	// stop stops the reading of the requests
+	stop := make(chan struct{})
+	go func() {
+		var decisions sync.WaitGroup
+		defer func() {
+			decisions.Wait()
+			close(responses)
+		}()
+		dec := json.NewDecoder(r.Body)
+		for {
+			var req StreamRequest
+			err := dec.Decode(&req)
+			if err == io.EOF {
+				return
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				// the stream can't be resynchronized after a malformed request
+				responses <- StreamResponse{Error: fmt.Sprintf("pdp: %s", err)}
+				return
+			}
+			if req.ID == "" {
+				responses <- StreamResponse{Error: "pdp: stream requests need an ID"}
+				continue
+			}
+			decisions.Add(1)
+			go func() {
+				defer decisions.Done()
+				res, err := s.Decide(req.Annotation)
+				sr := StreamResponse{ID: req.ID, Response: res}
+				if err != nil {
+					sr.Error = err.Error()
+				}
+				responses <- sr
+			}()
+		}
+	}()
+
+	// HTTP/1.x can't read the requests once the responses are written, so
+	// they're streamed over HTTP/2 only, and written at the end otherwise
+	duplex := r.ProtoMajor >= 2
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if duplex && flusher != nil {
+		flusher.Flush()
+	}
+	enc := json.NewEncoder(w)
+	pending := make([]StreamResponse, 0)
+	for res := range responses {
+		<-slots
+		if !duplex && len(pending) == MaxBufferedStream {
+			// the responses are dropped once the buffer is full, and the
+			// decisions in flight finish
+			if !stopped(stop) {
+				close(stop)
+			}
+			continue
+		}
+		if !duplex {
+			pending = append(pending, res)
+			continue
+		}
+		// the responses are drained even when the client is gone, so that
+		// the decisions in flight finish
+		enc.Encode(res)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	for _, res := range pending {
+		enc.Encode(res)
+	}
+	if stopped(stop) {
+		enc.Encode(StreamResponse{Error: fmt.Sprintf("pdp: streams over HTTP/1.x are limited to %d requests", MaxBufferedStream)})
+	}
+}
+
+// stopped returns true when stop is closed
+func stopped(stop chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
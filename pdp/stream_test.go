@@ -0,0 +1,145 @@
+package pdp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecideStream(t *testing.T) {
+	s := NewServer()
+	body := `{"id":"r1","annotation":[["DataType","AccountID"]]}`
+	if code := serve(t, s, http.MethodPost, "/v1/decisions/stream", body, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("stream before a bundle = %d", code)
+	}
+	if err := s.Load("v1", newSet(t, "p1")); err != nil {
+		t.Fatalf("%q", err)
+	}
+	s.StreamWindow = 2
+
+	body = strings.Join([]string{
+		`{"id":"r1","annotation":[["DataType","AccountID"]]}`,
+		`{"id":"r2","annotation":[["DataType","Location"]]}`,
+		`{"annotation":[["DataType","Location"]]}`,
+		`{"id":"r3","annotation":[["DataType","Unknown"]]}`,
+		`{"id":"r4","annotation":[["DataType","IPAddress"]]}`,
+		`{"id":"r5",`,
+	}, "\n")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/decisions/stream", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("stream = %d", w.Code)
+	}
+	got := make(map[string]StreamResponse)
+	errs := 0
+	dec := json.NewDecoder(w.Body)
+	for dec.More() {
+		var res StreamResponse
+		if err := dec.Decode(&res); err != nil {
+			t.Fatalf("%q", err)
+		}
+		if res.ID == "" {
+			errs++
+			continue
+		}
+		got[res.ID] = res
+	}
+
+	tests := []struct {
+		id      string
+		allowed bool
+		err     bool
+	}{
+		{"r1", false, false},
+		{"r2", true, false},
+		{"r3", false, true},
+		{"r4", true, false},
+	}
+	for _, tt := range tests {
+		res, ok := got[tt.id]
+		if !ok || res.Allowed != tt.allowed || (res.Error != "") != tt.err || !tt.err && res.Version != "v1" {
+			t.Errorf("response %s = %+v, want allowed %v and error %v", tt.id, res, tt.allowed, tt.err)
+		}
+	}
+	if len(got) != len(tests) || errs != 2 {
+		t.Errorf("got %d responses and %d errors, want %d and 2 (no ID, malformed)", len(got), errs, len(tests))
+	}
+}
+
+func TestDecideStreamBuffered(t *testing.T) {
+	s := NewServer()
+	if err := s.Load("v1", newSet(t, "p1")); err != nil {
+		t.Fatalf("%q", err)
+	}
+	var body strings.Builder
+	for i := 0; i < MaxBufferedStream+10; i++ {
+		fmt.Fprintf(&body, `{"id":"r%d","annotation":[["DataType","Location"]]}`+"\n", i)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/decisions/stream", strings.NewReader(body.String())))
+	responses, errs := 0, make([]string, 0)
+	dec := json.NewDecoder(w.Body)
+	for dec.More() {
+		var res StreamResponse
+		if err := dec.Decode(&res); err != nil {
+			t.Fatalf("%q", err)
+		}
+		if res.Error != "" {
+			errs = append(errs, res.Error)
+			continue
+		}
+		responses++
+	}
+	want := fmt.Sprintf("pdp: streams over HTTP/1.x are limited to %d requests", MaxBufferedStream)
+	if responses != MaxBufferedStream || len(errs) != 1 || errs[0] != want {
+		t.Errorf("got %d responses and errors %q, want %d and %q", responses, errs, MaxBufferedStream, want)
+	}
+}
+
+func TestDecideStreamPipelined(t *testing.T) {
+	s := NewServer()
+	if err := s.Load("v1", newSet(t, "p1")); err != nil {
+		t.Fatalf("%q", err)
+	}
+	ts := httptest.NewUnstartedServer(s)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	// every response is read before the next request is sent
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	resp, err := ts.Client().Post(ts.URL+"/v1/decisions/stream", "application/x-ndjson", pr)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for _, req := range []struct {
+		id, element string
+		allowed     bool
+	}{
+		{"r1", "AccountID", false},
+		{"r2", "Location", true},
+		{"r3", "IPAddress", true},
+	} {
+		if _, err := io.WriteString(pw, `{"id":"`+req.id+`","annotation":[["DataType","`+req.element+`"]]}`+"\n"); err != nil {
+			t.Fatalf("%q", err)
+		}
+		var res StreamResponse
+		if err := dec.Decode(&res); err != nil {
+			t.Fatalf("response %s: %q", req.id, err)
+		}
+		if res.ID != req.id || res.Allowed != req.allowed {
+			t.Errorf("response = %+v, want %s allowed %v", res, req.id, req.allowed)
+		}
+	}
+	pw.Close()
+	if dec.More() {
+		t.Errorf("the stream should end once the requests are closed")
+	}
+}
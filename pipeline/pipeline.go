@@ -0,0 +1,131 @@
+// Package pipeline checks data pipelines, e.g. Spark or Beam jobs, against a
+// policy when they're constructed, so that a violating job fails to launch
+// instead of writing data it shouldn't.
+//
+// A job declares the datasets it reads and writes, whose annotations come from
+// the catalog (see the ingest package). The job itself uses the data of all
+// its inputs, and so does every output, on top of its own annotation:
+//
+//	c := pipeline.NewChecker(policy, store)
+//	if err := c.Check(pipeline.Job{Name: "daily-join",
+//		Inputs: []string{"raw.clicks", "raw.accounts"}, Outputs: []string{"daily.joined"}}); err != nil {
+//		log.Fatal(err) // the explanation of the violation is in the error
+//	}
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/ingest"
+)
+
+// Job is a pipeline, by the datasets it reads and writes
+type Job struct {
+	Name    string
+	Inputs  []string
+	Outputs []string
+}
+
+// Violation is a part of a job, the job itself or one of its outputs, whose
+// annotation is denied by the policy
+type Violation struct {
+	// Dataset is the violating output, or empty for the job itself
+	Dataset    string
+	Annotation grok.Annotation
+	// Explanation is the explanation of the denial, and Reason its prose
+	Explanation *grok.Explanation
+	Reason      string
+}
+
+func (v Violation) String() string {
+	what := "the job"
+	if v.Dataset != "" {
+		what = "output " + v.Dataset
+	}
+	return fmt.Sprintf("%s (%s): %s", what, v.Annotation, v.Reason)
+}
+
+// ViolationError is the error of a job that violates the policy
+type ViolationError struct {
+	Job        string
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	vs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		vs = append(vs, v.String())
+	}
+	return fmt.Sprintf("pipeline: job %s violates the policy: %s", e.Job, strings.Join(vs, "; "))
+}
+
+// Checker checks jobs against a policy, with the annotations of a catalog
+type Checker struct {
+	Policy *grok.Policy
+	Store  *ingest.Store
+	// Renderer renders the explanations of violations, a default Renderer
+	// when it's nil
+	Renderer *grok.Renderer
+}
+
+// NewChecker returns a checker of the policy, with the annotations of the store
+func NewChecker(p *grok.Policy, s *ingest.Store) *Checker {
+	return &Checker{Policy: p, Store: s}
+}
+
+// Check returns nil when the job complies with the policy, and a
+// *ViolationError when it doesn't. The inputs must be in the catalog, so that
+// unknown data doesn't pass unchecked, while the outputs may be new datasets.
+func (c *Checker) Check(j Job) error {
+	if len(j.Inputs) == 0 {
+		return errors.New(fmt.Sprintf("pipeline: job %s has no inputs", j.Name))
+	}
+	known := make(map[string]bool)
+	for _, d := range c.Store.Datasets() {
+		known[d] = true
+	}
+	uses := make(grok.Annotation, 0)
+	for _, d := range j.Inputs {
+		if !known[d] {
+			return errors.New(fmt.Sprintf("pipeline: job %s: input %s isn't in the catalog", j.Name, d))
+		}
+		uses = append(uses, c.Store.Annotation(d)...)
+	}
+
+	e := &ViolationError{Job: j.Name, Violations: make([]Violation, 0)}
+	if err := c.check(&e.Violations, "", uses); err != nil {
+		return err
+	}
+	for _, d := range j.Outputs {
+		an := append(append(grok.Annotation{}, uses...), c.Store.Annotation(d)...)
+		if err := c.check(&e.Violations, d, an); err != nil {
+			return err
+		}
+	}
+	if len(e.Violations) > 0 {
+		return e
+	}
+	return nil
+}
+
+// check appends a violation of the dataset to vs when the policy denies its
+// annotation
+func (c *Checker) check(vs *[]Violation, dataset string, an grok.Annotation) error {
+	ex := c.Policy.Trace(an)
+	if ex.Allowed {
+		return nil
+	}
+	r := c.Renderer
+	if r == nil {
+		r = &grok.Renderer{}
+	}
+	reason, err := r.Render(ex)
+	if err != nil {
+		return err
+	}
+	*vs = append(*vs, Violation{Dataset: dataset, Annotation: an, Explanation: ex, Reason: reason})
+	return nil
+}
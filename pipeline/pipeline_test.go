@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/grongjun/grok"
+	"github.com/grongjun/grok/ingest"
+)
+
+func TestCheck(t *testing.T) {
+	p := grok.NewPolicy([]*grok.Lattice{grok.NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)})
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	s := ingest.NewStore()
+	for d, v := range map[string]string{"raw.clicks": "IPAddress", "raw.accounts": "AccountID", "raw.cities": "Location"} {
+		an, err := p.ParseValue("DataType", v)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		s.Add(d, "c", an)
+	}
+	c := NewChecker(p, s)
+
+	cases := []struct {
+		job Job
+		err string
+	}{
+		{Job{Name: "clicks", Inputs: []string{"raw.clicks", "raw.cities"}, Outputs: []string{"daily.clicks"}}, ""},
+		{Job{Name: "join", Inputs: []string{"raw.clicks"}, Outputs: []string{"raw.accounts"}},
+			"pipeline: job join violates the policy: output raw.accounts (DataType IPAddress DataType AccountID): " +
+				"Denied because the program uses IPAddress together with AccountID, which the exception to the global allow forbids."},
+		{Job{Name: "join", Inputs: []string{"raw.clicks", "raw.accounts"}},
+			"pipeline: job join violates the policy: the job (DataType IPAddress DataType AccountID): " +
+				"Denied because the program uses IPAddress together with AccountID, which the exception to the global allow forbids."},
+		{Job{Name: "unknown", Inputs: []string{"raw.users"}}, "pipeline: job unknown: input raw.users isn't in the catalog"},
+		{Job{Name: "empty"}, "pipeline: job empty has no inputs"},
+	}
+	for _, tc := range cases {
+		err := c.Check(tc.job)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("Check(%s) = %q", tc.job.Name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("Check(%s) = %v, want %q", tc.job.Name, err, tc.err)
+		}
+	}
+
+	err := c.Check(Job{Name: "join", Inputs: []string{"raw.clicks", "raw.accounts"}, Outputs: []string{"daily.joined"}})
+	ve, ok := err.(*ViolationError)
+	if !ok || len(ve.Violations) != 2 || ve.Violations[1].Dataset != "daily.joined" || ve.Violations[1].Explanation.Allowed {
+		t.Errorf("Check() = %#v", err)
+	}
+}
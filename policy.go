@@ -3,24 +3,43 @@ package grok
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"text/scanner"
+	"time"
 )
 
 const (
-	ALLOW      = true
-	DENY       = false
-	Allow      = "ALLOW"
-	Deny       = "DENY"
-	Except     = "EXCEPT"
-	lefBrace   = "{"
-	rightBrace = "}"
+	ALLOW          = true
+	DENY           = false
+	Allow          = "ALLOW"
+	Deny           = "DENY"
+	Except         = "EXCEPT"
+	CompatibleWith = "COMPATIBLEWITH"
+	ModeOption     = "MODE"
+	Monitor        = "monitor"
+	Enforce        = "enforce"
+	lefBrace       = "{"
+	rightBrace     = "}"
+)
+
+const (
+	// DefaultMaxExceptDepth is the maximum nesting depth of exceptions that
+	// ParsePolicy accepts when Policy.MaxExceptDepth isn't set
+	DefaultMaxExceptDepth = 16
+	// ExceptDepthWarning is the nesting depth of exceptions above which
+	// Validate reports a policy as hard to read and to evaluate
+	ExceptDepthWarning = 4
 )
 
 // pair is an pair of attribute name and attribute value. exmaple: DataType IPAddrees
 type pair struct {
 	name  string // attribute name (i.e. lattice)
 	value string // attribute value (picked from lattice elements)
+	// compatWith is the compatibility attribute that the value must be compatible with, if any
+	compatWith string
+	// expires is the time the value expires at, if any (see Until)
+	expires time.Time
 }
 
 // Clause is a slice of pairs.
@@ -38,6 +57,18 @@ func (c Clause) ValuesOf(attr string) []string {
 	return values
 }
 
+// String returns the clause in the policy syntax, e.g. DataType IPAddress Purpose Sharing
+func (c Clause) String() string {
+	tokens := make([]string, 0, 2*len(c))
+	for _, p := range c {
+		tokens = append(tokens, p.name, p.value)
+		if p.compatWith != "" {
+			tokens = append(tokens, CompatibleWith, p.compatWith)
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
 // Annotation is an alias of Clause, which is used as metadata of a program block
 type Annotation Clause
 
@@ -46,12 +77,130 @@ func (an Annotation) ValuesOf(attr string) []string {
 	return Clause(an).ValuesOf(attr)
 }
 
+// String returns the annotation in the policy syntax
+func (an Annotation) String() string {
+	return Clause(an).String()
+}
+
+// Names returns the attributes of the annotation, in the order they first
+// appear
+func (an Annotation) Names() []string {
+	names := make([]string, 0)
+	for _, pa := range an {
+		if !contains(names, pa.name) {
+			names = append(names, pa.name)
+		}
+	}
+	return names
+}
+
+// Select returns the pairs of the annotation of some attributes
+func (an Annotation) Select(attrs ...string) Annotation {
+	res := make(Annotation, 0)
+	for _, pa := range an {
+		if contains(attrs, pa.name) {
+			res = append(res, pa)
+		}
+	}
+	return res
+}
+
+// MapValues returns a copy of the annotation where the values of an attribute
+// are replaced by f of them, with their compatibility and expiry
+func (an Annotation) MapValues(attr string, f func(v string) string) Annotation {
+	res := make(Annotation, 0, len(an))
+	for _, pa := range an {
+		if pa.name == attr {
+			pa.value = f(pa.value)
+		}
+		res = append(res, pa)
+	}
+	return res
+}
+
+// Union returns the pairs of the annotation followed by the pairs of other
+// whose attribute values it doesn't have yet
+func (an Annotation) Union(other Annotation) Annotation {
+	res := append(make(Annotation, 0, len(an)+len(other)), an...)
+	for _, pb := range other {
+		dup := false
+		for _, pa := range res {
+			if pa.name == pb.name && pa.value == pb.value {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			res = append(res, pb)
+		}
+	}
+	return res
+}
+
 // Policy is composed of its mode, clause, and exceptions. It is based on some lattices.
+//
+// A parsed policy is safe for concurrent evaluation (ApplyOn, Evaluate, Trace
+// and the like), and so are its lattices, even while they are compiled or their
+// products are set. A policy must not be modified (ParsePolicy, DefineNumeric,
+// DefineCompatibility) while it's evaluated: to reload a policy, parse a new
+// one and swap it, e.g. by registering it in a Registry.
 type Policy struct {
+	// ID identifies the policy in policy sets, decision records and metrics,
+	// e.g. its name. Exceptions have no ID.
+	ID      string
 	Mode    bool
+	// Monitor is true for a policy (or exception) in monitor mode (MODE=monitor),
+	// whose effect is recorded but not enforced
+	Monitor bool
 	Clause
 	Excepts []Policy
 	baseOn  map[string]*Lattice
+	// numerics are the numeric attributes of the policy, see DefineNumeric
+	numerics map[string]bool
+	// compats are the compatibility attributes of the policy, see DefineCompatibility
+	compats map[string]*Compatibility
+	// Unknown is how ParseAnnotation and Evaluate handle the attributes that
+	// aren't known to the policy
+	Unknown UnknownAttributes
+	// Schema is the schema that ParseAnnotation enforces, if any
+	Schema *AnnotationSchema
+	// Repeated is how the repeated values of lattice attributes in annotations
+	// are interpreted, and RepeatedOf overrides it per attribute
+	Repeated   RepeatedValues
+	RepeatedOf map[string]RepeatedValues
+	// Unclassified is how the Unknown values of lattice attributes in
+	// annotations are evaluated, and UnclassifiedOf overrides it per
+	// attribute (see UnknownElement)
+	Unclassified   UnclassifiedValues
+	UnclassifiedOf map[string]UnclassifiedValues
+	// Resolver resolves the elements that the lattices don't define when
+	// ParsePolicy parses a policy, and adds them to the lattices
+	Resolver ElementResolver
+	// Selector selects the resources the policy applies to in a policy set
+	// (see PolicySet.EvaluateFor), all of them when it's nil
+	Selector *Selector
+	// MaxExceptDepth is the maximum nesting depth of exceptions that
+	// ParsePolicy accepts, DefaultMaxExceptDepth when it's 0
+	MaxExceptDepth int
+	// Warnings are the warnings of the last ParsePolicy, e.g. the deprecated
+	// elements that the policy uses
+	Warnings []string
+	// MapDeprecated maps the deprecated elements of the annotations that
+	// ParseAnnotation parses to their replacements, if any
+	MapDeprecated bool
+	// Constraints are the constraints between lattices that ParseAnnotation
+	// enforces, see ParseConstraint
+	Constraints []Constraint
+	// Derivations are the rules deriving pairs from annotations before they
+	// are evaluated, see ParseDerivation
+	Derivations []DerivationRule
+	// unbound is the policy unmarshalled from JSON until its lattices are
+	// bound, see Bind
+	unbound *policyJSON
+	// hasMonitor is true when an exception of the policy is in monitor mode,
+	// so that Evaluate only runs its would-be pass when it can differ. It's
+	// computed when the rule of the policy is parsed or loaded.
+	hasMonitor bool
 }
 
 // NewPolicy creates a Policy instance based on some lattices.
@@ -68,35 +217,78 @@ func NewPolicy(ls []*Lattice) *Policy {
 	for _, l := range ls {
 		policy.baseOn[l.Name] = l
 	}
+	policy.numerics = make(map[string]bool)
+	policy.compats = make(map[string]*Compatibility)
 
 	return policy
 }
 
 // ParsePolicy parses a policy string
 func (p *Policy) ParsePolicy(pstr string) error {
-	var s scanner.Scanner
-	s.Init(strings.NewReader(pstr))
-
 	// policy is a nested structure
-	tokens := make([]string, 0)
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
-		tt := s.TokenText()
-		// fmt.Println(tt)
-		tokens = append(tokens, tt)
+	tokens := tokenize(pstr)
+	if p.Resolver != nil {
+		if err := p.resolveElements(tokens); err != nil {
+			return err
+		}
 	}
 
-	pp, err := p.parsePolicyTokens(tokens)
+	pp, err := p.parsePolicyTokens(tokens, 0)
 	if err != nil {
 		return err
 	}
 	p.Mode = pp.Mode
+	p.Monitor = pp.Monitor
 	p.Clause = pp.Clause
 	p.Excepts = pp.Excepts
+	p.hasMonitor = p.monitorsExceptions()
+	p.Warnings = make([]string, 0)
+	for _, err := range p.deprecatedUses() {
+		p.Warnings = append(p.Warnings, err.Error())
+	}
 	return nil
 }
 
-// parsePolicyTokens parses a slice of tokens to a Policy
-func (p *Policy) parsePolicyTokens(ts []string) (Policy, error) {
+// tokenize splits a string into policy tokens. Product values (AccountID:Truncated),
+// parameterized values (Aggregated(k=25)) and numeric predicates (<=1.0) are kept
+// as single tokens.
+func tokenize(str string) []string {
+	var s scanner.Scanner
+	s.Init(strings.NewReader(str))
+
+	tokens := make([]string, 0)
+	glue := false // whether the next token is appended to the previous one
+	depth := 0    // depth of parentheses
+	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
+		tt := s.TokenText()
+		switch {
+		case tt == "(" && len(tokens) > 0:
+			depth++
+		case tt == ")" && depth > 0:
+			depth--
+		case tt == ":" && len(tokens) > 0:
+			glue = true
+		case len(tt) == 1 && strings.Contains(operators, tt) && depth == 0:
+			if !glue {
+				tokens = append(tokens, tt)
+				glue = true
+				continue
+			}
+		default:
+			if !glue && depth == 0 {
+				tokens = append(tokens, tt)
+				continue
+			}
+			glue = false
+		}
+		tokens[len(tokens)-1] += tt
+	}
+	return tokens
+}
+
+// parsePolicyTokens parses a slice of tokens to a Policy, whose exceptions are
+// nested depth levels deep
+func (p *Policy) parsePolicyTokens(ts []string, depth int) (Policy, error) {
 	n := len(ts)
 	pi := 0
 	// the first token must be ALLOW or DENY
@@ -107,17 +299,34 @@ func (p *Policy) parsePolicyTokens(ts []string) (Policy, error) {
 	} else {
 		return policy, errors.New("policy: don't start with ALLOW or DENY")
 	}
+	// the mode can be followed by an enforcement mode, e.g. DENY MODE=monitor
+	if n > 2 && ModeOption == ts[1] {
+		switch ts[2] {
+		case "=" + Monitor:
+			policy.Monitor = true
+		case "=" + Enforce:
+		default:
+			return policy, errors.New("policy: MODE should be monitor or enforce")
+		}
+		pi = 3
+	}
 
-	i := 1
+	i := pi
 	// The tokens between ALLOW/DENY and EXCEPT are the main content of current policy's clause
 	for i < n && Except != ts[i] {
 		i++
 	}
 	tt := ts[pi:i]
-	clause, err := p.parseClauseTokens(tt)
+	clause, err := p.parseClauseTokens(tt, false)
 	if err != nil {
 		return policy, err
 	}
+	if clause.hasAnyOf() {
+		return policy, errors.New("policy: " + AnyOf + " sets are only allowed in annotations")
+	}
+	if p.hasUnclassified(clause) {
+		return policy, errUnclassifiedClause
+	}
 	policy.Clause = clause
 
 	// There must be except clauses if i < n
@@ -125,6 +334,9 @@ func (p *Policy) parsePolicyTokens(ts []string) (Policy, error) {
 		if ts[i+1] != lefBrace || ts[n-1] != rightBrace {
 			return policy, errors.New("policy: except clause isn't warpped by { and }")
 		}
+		if max := p.maxExceptDepth(); depth >= max {
+			return policy, errors.New(fmt.Sprintf("policy: exceptions are nested more than %d levels deep", max))
+		}
 		// the mode of except clauses must be the opposite of policy's main clause
 		var mode string
 		if policy.Mode {
@@ -136,24 +348,24 @@ func (p *Policy) parsePolicyTokens(ts []string) (Policy, error) {
 		if ts[i+2] != mode {
 			return policy, errors.New("policy: except clause doesn't have the opposite mode")
 		}
-		depth := 0
+		braces := 0
 		i = i + 3 // skip the { and mode
 
 		excepts := make([]Policy, 0)
 		for i < n-1 {
 			if ts[i] == lefBrace {
-				depth++
+				braces++
 			}
 			if ts[i] == rightBrace {
-				depth--
+				braces--
 			}
 			// first condition: for multiple exceptions
 			// second condition: for only one exception
-			if (depth == 0 && mode == ts[i]) || (i == n-2) {
+			if (braces == 0 && mode == ts[i]) || (i == n-2) {
 				if i == n-2 {
 					i++
 				}
-				po, err := p.parsePolicyTokens(ts[pi:i])
+				po, err := p.parsePolicyTokens(ts[pi:i], depth+1)
 				if err != nil {
 					return policy, err
 				}
@@ -166,54 +378,156 @@ func (p *Policy) parsePolicyTokens(ts []string) (Policy, error) {
 	}
 
 	policy.baseOn = p.baseOn
+	policy.numerics = p.numerics
+	policy.compats = p.compats
 	return policy, nil
 }
 
+// maxExceptDepth returns the maximum nesting depth of exceptions
+func (p *Policy) maxExceptDepth() int {
+	if p.MaxExceptDepth > 0 {
+		return p.MaxExceptDepth
+	}
+	return DefaultMaxExceptDepth
+}
+
 // ParseClause returns a Clause instance after parsing a string
 func (p *Policy) ParseClause(str string) (Clause, error) {
-	var s scanner.Scanner
-	s.Init(strings.NewReader(str))
+	return p.parseClause(str, false)
+}
 
-	tokens := make([]string, 0)
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
-		tt := s.TokenText()
-		tokens = append(tokens, tt)
+// ParseAnnotation returns an Annotation instance after parsing a string.
+// Unknown attributes are handled according to p.Unknown, and the annotation
+// must conform to p.Schema if any.
+func (p *Policy) ParseAnnotation(str string) (Annotation, error) {
+	clause, err := p.parseClause(str, p.Unknown != RejectUnknown)
+	if err != nil {
+		return nil, err
 	}
-	if len(tokens) % 2 != 0 {
-		return nil, errors.New("policy: clause is not composed of name-value pairs")
+	if err := p.checkNumbers(Annotation(clause)); err != nil {
+		return nil, err
+	}
+	if p.MapDeprecated {
+		clause = Clause(p.mapDeprecated(Annotation(clause)))
+	}
+	if err := checkAlternatives(Annotation(clause)); err != nil {
+		return nil, err
 	}
+	if p.Schema != nil {
+		if err := p.Schema.Validate(Annotation(clause)); err != nil {
+			return nil, err
+		}
+	}
+	if errs := p.CheckConstraints(Annotation(clause)); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return Annotation(clause), nil
+}
 
-	return p.parseClauseTokens(tokens)
+// ParseAnnotationPart parses a part of an annotation, e.g. the labels of a
+// column, like ParseAnnotation does but without enforcing the schema, which
+// applies to whole annotations.
+func (p *Policy) ParseAnnotationPart(str string) (Annotation, error) {
+	clause, err := p.parseClause(str, p.Unknown != RejectUnknown)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkNumbers(Annotation(clause)); err != nil {
+		return nil, err
+	}
+	if p.MapDeprecated {
+		return p.mapDeprecated(Annotation(clause)), nil
+	}
+	return Annotation(clause), nil
 }
 
-// ParseAnnotation returns an Annotation instance after parsing a string
-func (p *Policy) ParseAnnotation(str string) (Annotation, error) {
-	clause, err := p.ParseClause(str)
+// ParseValue parses a single attribute value to the pairs of an annotation
+// (more than one for ALLOF sets), like ParseAnnotation does but without
+// enforcing the schema, so that annotations can be built value by value.
+func (p *Policy) ParseValue(name, value string) (Annotation, error) {
+	tokens := tokenize(value)
+	if len(tokens) != 1 {
+		return nil, errors.New(fmt.Sprintf("policy: %s is not a single value", value))
+	}
+	clause, err := p.parseClauseTokens([]string{name, tokens[0]}, p.Unknown != RejectUnknown)
 	if err != nil {
 		return nil, err
 	}
+	if err := p.checkNumbers(Annotation(clause)); err != nil {
+		return nil, err
+	}
 	return Annotation(clause), nil
 }
 
-// parseClauseTokens returns a Clause instance after parsing a slice of tokens
-func (p *Policy) parseClauseTokens(ts []string) (Clause, error) {
+// parseClause parses a string to a Clause, keeping the pairs of unknown
+// attributes as they are when lenient
+func (p *Policy) parseClause(str string, lenient bool) (Clause, error) {
+	tokens := tokenize(str)
+	if len(tokens) % 2 != 0 {
+		return nil, errors.New("policy: clause is not composed of name-value pairs")
+	}
+
+	return p.parseClauseTokens(tokens, lenient)
+}
+
+// parseClauseTokens returns a Clause instance after parsing a slice of tokens.
+// When lenient, the pairs of unknown attributes are kept without validation.
+func (p *Policy) parseClauseTokens(ts []string, lenient bool) (Clause, error) {
 	var clause Clause = make(Clause, 0)
 	
 	// current lattice name
 	var currLa string
-	for _, tt := range ts {
-		if "" == currLa {
+	// whether currLa is an unknown attribute
+	unknown := false
+	// the number of pairs of the last value, more than one for ALLOF sets
+	last := 1
+	for i := 0; i < len(ts); i++ {
+		tt := ts[i]
+		if unknown {
+			clause = append(clause, pair{name: currLa, value: tt})
+			currLa, unknown, last = "", false, 1
+		} else if "" == currLa && CompatibleWith == tt {
+			// the condition is attached to the preceding pair
+			if len(clause) == 0 || i+1 == len(ts) || !p.isCompatibility(ts[i+1]) {
+				return nil, errors.New("policy: COMPATIBLEWITH should be between a pair and a compatibility attribute")
+			}
+			for j := len(clause) - last; j < len(clause); j++ {
+				clause[j].compatWith = ts[i+1]
+			}
+			i++
+		} else if "" == currLa && (p.isNumeric(tt) || p.isCompatibility(tt)) {
+			currLa = tt
+		} else if "" == currLa {
 			la, err := p.LatticeName(tt)
+			if err != nil && lenient {
+				currLa, unknown = tt, true
+				continue
+			}
 			if err != nil {
 				return nil, err
 			}
 			currLa = la
+		} else if p.isNumeric(currLa) {
+			nv, err := p.NumericValue(tt, currLa)
+			if err != nil {
+				return nil, err
+			}
+			clause = append(clause, pair{name: currLa, value: nv})
+			currLa, last = "", 1
+		} else if p.isCompatibility(currLa) {
+			cv, err := p.CompatibilityValue(tt, currLa)
+			if err != nil {
+				return nil, err
+			}
+			clause = append(clause, pair{name: currLa, value: cv})
+			currLa, last = "", 1
 		} else {
-			lv, err := p.LatticeValue(tt, currLa)
+			ps, err := p.latticeValues(tt, currLa)
 			if err != nil {
 				return nil , err
 			}
-			clause = append(clause, pair{currLa, lv})
+			clause = append(clause, ps...)
+			last = len(ps)
 			currLa = ""
 		}
 	}
@@ -225,44 +539,169 @@ func (p *Policy) parseClauseTokens(ts []string) (Clause, error) {
 // false means annotation is denied by the policy
 // Note: refer to inferences rules in page 7
 func (p *Policy) ApplyOn(an Annotation) bool {
+	if p.Monitor {
+		return true
+	}
+	return p.apply(an, nil, nil)
+}
+
+// apply is ApplyOn, which also traces the evaluation into e when e isn't nil.
+// A nil ctx evaluates with the default options.
+func (p *Policy) apply(an Annotation, e *Explanation, ctx *evalContext) bool {
+	an = p.Derive(an)
+	// an annotation with ANYOF sets is allowed when all its alternatives are,
+	// and e traces the first denied one (or the last one). Each alternative
+	// is a step of the budget.
+	if Clause(an).hasAnyOf() {
+		allowed := true
+		an.EachAlternative(func(alt Annotation) bool {
+			if !ctx.alternative() {
+				allowed = e.exhausted()
+			} else {
+				allowed = p.apply(alt, e, ctx)
+			}
+			return allowed
+		})
+		return allowed
+	}
+	ctx = p.classifying(ctx)
+	an = p.JoinRepeated(ctx.classify(an))
+	e.start(p, an)
+	if ctx != nil && ctx.profile != nil {
+		defer ctx.profile.node(p, time.Now())
+	}
 	if p.Mode {
-		for attr, l := range p.baseOn {
-			v := an.ValuesOf(attr)
-			if !l.Allow(p.Clause.ValuesOf(attr), v) {
-				return false
+		for _, attr := range p.latticeNames() {
+			v := ctx.valuesOf(an, attr, true)
+			var allowed bool
+			ctx.timed(attr, OpAllow, func() { allowed = ctx.lattice(p.baseOn[attr]).Allow(p.Clause.ValuesOf(attr), v) })
+			if ctx.exceeded() {
+				return e.exhausted()
+			}
+			if !allowed {
+				e.failed(p, attr, v)
+				return e.unmatched(attr, false)
+			}
+		}
+		if !p.allowCompatible(an) {
+			return e.unmatched(CompatibleWith, false)
+		}
+		for _, attr := range p.numericNames() {
+			if !allowNumeric(p.Clause.ValuesOf(attr), an.ValuesOf(attr)) {
+				return e.unmatched(attr, false)
 			}
 		}
 
-		for _, ex := range p.Excepts {
-			if !(&ex).ApplyOn(an) {
-				return false
+		e.matched(nil)
+		ctx.fired(p)
+		for i := range p.Excepts {
+			ex := &p.Excepts[i]
+			if ctx.skipped(ex) {
+				e.except().start(ex, an)
+				continue
+			}
+			if !ctx.exception() {
+				return e.exhausted()
+			}
+			allowed := ex.apply(an, e.except(), ctx)
+			if ctx.exceeded() {
+				return e.exhausted()
+			}
+			if !allowed && !ctx.monitored(ex) {
+				return e.decided(i, false)
 			}
 		}
-		return true
+		return e.result(true)
 
 	} else {
-		for attr, l := range p.baseOn {
-			v := an.ValuesOf(attr)
-			if !l.Deny(p.Clause.ValuesOf(attr), v) {
-				return true
+		for _, attr := range p.latticeNames() {
+			v := ctx.valuesOf(an, attr, false)
+			var denied bool
+			ctx.timed(attr, OpDeny, func() { denied = ctx.lattice(p.baseOn[attr]).Deny(p.Clause.ValuesOf(attr), v) })
+			if ctx.exceeded() {
+				return e.exhausted()
+			}
+			if !denied {
+				e.failed(p, attr, v)
+				return e.unmatched(attr, true)
+			}
+		}
+		if !p.denyCompatible(an) {
+			return e.unmatched(CompatibleWith, true)
+		}
+		for _, attr := range p.numericNames() {
+			if !denyNumeric(p.Clause.ValuesOf(attr), an.ValuesOf(attr)) {
+				return e.unmatched(attr, true)
 			}
 		}
 		var overlap Annotation
-		for attr, l := range p.baseOn {
-			vs := l.overlap(an.ValuesOf(attr), p.Clause.ValuesOf(attr))
+		for _, attr := range p.latticeNames() {
+			var vs []string
+			ctx.timed(attr, OpOverlap, func() { vs = ctx.lattice(p.baseOn[attr]).Overlap(ctx.valuesOf(an, attr, false), p.Clause.ValuesOf(attr)) })
+			if ctx.exceeded() {
+				return e.exhausted()
+			}
 			for _, v := range vs {
-				overlap = append(overlap, pair{attr, v})
+				overlap = append(overlap, pair{name: attr, value: v})
 			}
 		}
-		for _, ex := range p.Excepts {
-			if (&ex).ApplyOn(overlap) {
-				return true
+		for _, attr := range p.numericNames() {
+			for _, vs := range overlapNumeric(p.Clause.ValuesOf(attr), an.ValuesOf(attr)) {
+				for _, v := range vs {
+					overlap = append(overlap, pair{name: attr, value: v})
+				}
+			}
+		}
+		// compatibility attributes are kept for the exceptions to check their conditions
+		for _, pa := range an {
+			if p.isCompatibility(pa.name) {
+				overlap = append(overlap, pa)
+			}
+		}
+
+		e.matched(overlap)
+		ctx.fired(p)
+		for i := range p.Excepts {
+			ex := &p.Excepts[i]
+			if ctx.skipped(ex) {
+				e.except().start(ex, overlap)
+				continue
+			}
+			if !ctx.exception() {
+				return e.exhausted()
+			}
+			allowed := ex.apply(overlap, e.except(), ctx)
+			if ctx.exceeded() {
+				return e.exhausted()
+			}
+			if allowed && !ctx.monitored(ex) {
+				return e.decided(i, true)
 			}
 		}
-		return false
+		return e.result(false)
 	}
 }
 
+// latticeNames returns the sorted names of the lattices of the policy
+func (p *Policy) latticeNames() []string {
+	names := make([]string, 0, len(p.baseOn))
+	for name := range p.baseOn {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// numericNames returns the sorted names of the numeric attributes of the policy
+func (p *Policy) numericNames() []string {
+	names := make([]string, 0, len(p.numerics))
+	for name := range p.numerics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // LatticeName returns a valid lattice name, or returns error
 func (p *Policy) LatticeName(s string) (string, error) {
 	for _, l := range p.baseOn {
@@ -273,12 +712,22 @@ func (p *Policy) LatticeName(s string) (string, error) {
 	return "", errors.New(fmt.Sprintf("policy: %s is not a valid lattice name", s))
 }
 
+// Lattice returns the lattice of a lattice attribute, or nil when the
+// attribute isn't based on a lattice of the policy
+func (p *Policy) Lattice(attr string) *Lattice {
+	return p.baseOn[attr]
+}
+
 // LatticeValue returns a valid lattice value from its a dependant lattice, or returns error
 func (p *Policy) LatticeValue(s string, name string) (string, error) {
-	for _, e := range p.baseOn[name].Edges {
-		if s == e.From || s == e.To {
+	l := p.baseOn[name]
+	if l.isProductValue(s) {
+		fst, snd := l.halve(s)
+		if (l.hasElement(fst) || p.isUnclassified(fst, name)) && l.state().hasElement(snd) {
 			return s, nil
 		}
+	} else if l.hasElement(s) || p.isUnclassified(s, name) {
+		return s, nil
 	}
 	return "", errors.New(fmt.Sprintf("policy: %s is not a valid value in lattice %s", s, name))
 }
@@ -216,3 +216,30 @@ func TestApplyOn(t *testing.T) {
 		}
 	}
 }
+
+func TestAnnotationPairs(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	if err := p.DefineNumeric("Epsilon"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	an, err := p.ParseAnnotation("DataType IPAddress Epsilon 1 DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := an.Names(); !equals(got, []string{"DataType", "Epsilon"}) {
+		t.Errorf("Names() = %q", got)
+	}
+	if got := an.Select("DataType").String(); got != "DataType IPAddress DataType AccountID" {
+		t.Errorf("Select() = %q", got)
+	}
+	mapped := an.MapValues("DataType", func(v string) string { return "UniqueID" })
+	if got := mapped.String(); got != "DataType UniqueID Epsilon 1 DataType UniqueID" {
+		t.Errorf("MapValues() = %q", got)
+	}
+	if got := an.Union(mapped).String(); got != "DataType IPAddress Epsilon 1 DataType AccountID DataType UniqueID" {
+		t.Errorf("Union() = %q", got)
+	}
+	if p.Lattice("DataType") == nil || p.Lattice("Epsilon") != nil {
+		t.Errorf("Lattice() should return the lattices of lattice attributes only")
+	}
+}
@@ -0,0 +1,119 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// PolicySet is a collection of policies that are enforced together: an
+// annotation is allowed by the set only when every policy allows it. Add is
+// safe to call while the set is applied, but Policies must not be modified
+// directly then.
+type PolicySet struct {
+	Policies []*Policy
+	mu       sync.RWMutex
+	// tags are the tags of resources, see Tag
+	tags map[string][]string
+}
+
+// NewPolicySet returns a PolicySet of the input policies
+func NewPolicySet(ps ...*Policy) *PolicySet {
+	return &PolicySet{Policies: append(make([]*Policy, 0, len(ps)), ps...)}
+}
+
+// Add appends a policy to the set
+func (s *PolicySet) Add(p *Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Policies = append(s.Policies, p)
+}
+
+// Get returns the policy of an ID, and nil if there's none
+func (s *PolicySet) Get(id string) *Policy {
+	for _, p := range s.policies() {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// Remove removes the policies of an ID, and returns false if there's none
+func (s *PolicySet) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the policies are copied, since they may be applied concurrently
+	ps := make([]*Policy, 0, len(s.Policies))
+	for _, p := range s.Policies {
+		if p.ID != id {
+			ps = append(ps, p)
+		}
+	}
+	removed := len(ps) < len(s.Policies)
+	s.Policies = ps
+	return removed
+}
+
+// Validate returns an error when two policies of the set have the same ID,
+// so that decisions can be attributed to their policy. Policies without an ID
+// aren't checked.
+func (s *PolicySet) Validate() error {
+	seen := make(map[string]bool)
+	for _, p := range s.policies() {
+		if p.ID == "" {
+			continue
+		}
+		if seen[p.ID] {
+			return errors.New(fmt.Sprintf("policy: duplicate policy ID %s", p.ID))
+		}
+		seen[p.ID] = true
+	}
+	return nil
+}
+
+// policies returns the current policies of the set
+func (s *PolicySet) policies() []*Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Policies[:len(s.Policies):len(s.Policies)]
+}
+
+// Snapshot returns a copy of the current policies of the set, which isn't
+// affected by later changes of the set
+func (s *PolicySet) Snapshot() []*Policy {
+	return append([]*Policy(nil), s.policies()...)
+}
+
+// ApplyOn returns true when the annotation is allowed by every policy of the set
+func (s *PolicySet) ApplyOn(an Annotation) bool {
+	for _, p := range s.policies() {
+		if !p.ApplyOn(an) {
+			return false
+		}
+	}
+	return true
+}
+
+// Denying returns the indexes of the policies that deny the annotation, see
+// DenyingIDs for their IDs
+func (s *PolicySet) Denying(an Annotation) []int {
+	ds := make([]int, 0)
+	for i, p := range s.policies() {
+		if !p.ApplyOn(an) {
+			ds = append(ds, i)
+		}
+	}
+	return ds
+}
+
+// DenyingIDs returns the IDs of the policies that deny the annotation
+func (s *PolicySet) DenyingIDs(an Annotation) []string {
+	ids := make([]string, 0)
+	for _, p := range s.policies() {
+		if !p.ApplyOn(an) {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
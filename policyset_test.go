@@ -0,0 +1,82 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestPolicySet(t *testing.T) {
+	s := NewPolicySet(newScopedPolicy(t, "ALLOW DataType UniqueID"))
+	s.Add(newScopedPolicy(t, "DENY DataType AccountID"))
+
+	cases := []struct {
+		astr    string
+		allowed bool
+		denying []int
+	}{
+		{"DataType IPAddress", true, []int{}},
+		{"DataType AccountID", false, []int{1}},
+		{"DataType Location", false, []int{0}},
+	}
+	for _, c := range cases {
+		an, err := s.Policies[0].ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := s.ApplyOn(an); got != c.allowed {
+			t.Errorf("ApplyOn(%q) = %t, want %t", c.astr, got, c.allowed)
+		}
+		got := s.Denying(an)
+		if len(got) != len(c.denying) || (len(got) > 0 && got[0] != c.denying[0]) {
+			t.Errorf("Denying(%q) = %v, want %v", c.astr, got, c.denying)
+		}
+	}
+}
+
+func TestPolicySetSnapshot(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType UniqueID")
+	p.ID = "p1"
+	s := NewPolicySet(p)
+	snapshot := s.Snapshot()
+	s.Add(newScopedPolicy(t, "DENY DataType AccountID"))
+	s.Remove("p1")
+	if len(snapshot) != 1 || snapshot[0] != p {
+		t.Errorf("Snapshot() = %v", snapshot)
+	}
+}
+
+func TestPolicySetIDs(t *testing.T) {
+	named := func(id, pstr string) *Policy {
+		p := newScopedPolicy(t, pstr)
+		p.ID = id
+		return p
+	}
+	s := NewPolicySet(named("locations", "ALLOW DataType Location"), named("no-accounts", "DENY DataType AccountID"))
+	if err := s.Validate(); err != nil {
+		t.Errorf("Validate() = %q", err)
+	}
+	if p := s.Get("no-accounts"); p == nil || p != s.Policies[1] {
+		t.Errorf("Get(no-accounts) = %v", p)
+	}
+	if p := s.Get("none"); p != nil {
+		t.Errorf("Get(none) = %v, want nil", p)
+	}
+
+	an, err := s.Policies[0].ParseAnnotation("DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := s.DenyingIDs(an); len(got) != 2 || got[0] != "locations" || got[1] != "no-accounts" {
+		t.Errorf("DenyingIDs() = %q", got)
+	}
+
+	s.Add(named("locations", "ALLOW DataType TOP"))
+	if err := s.Validate(); err == nil || err.Error() != "policy: duplicate policy ID locations" {
+		t.Errorf("Validate() = %v", err)
+	}
+	if !s.Remove("locations") || len(s.Policies) != 1 || s.Policies[0].ID != "no-accounts" {
+		t.Errorf("Remove(locations) left %d policies", len(s.Policies))
+	}
+	if s.Remove("locations") {
+		t.Errorf("Remove(locations) = true, want false")
+	}
+}
@@ -0,0 +1,152 @@
+package grok
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// StoredPolicy is a policy of a PolicyStore in JSON (see Policy.MarshalJSON),
+// with its tombstone when it's deleted
+type StoredPolicy struct {
+	ID     string          `json:"id"`
+	Policy json.RawMessage `json:"policy"`
+	// Deleted is the time the policy was deleted at, nil while it's live
+	Deleted *time.Time `json:"deleted,omitempty"`
+}
+
+// NewStoredPolicy returns the stored policy of a policy, which must have an ID
+func NewStoredPolicy(p *Policy) (StoredPolicy, error) {
+	if p.ID == "" {
+		return StoredPolicy{}, errors.New("policy: a stored policy should have an ID")
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return StoredPolicy{}, err
+	}
+	return StoredPolicy{ID: p.ID, Policy: b}, nil
+}
+
+// Tombstoned returns true when the policy was deleted at or before t
+func (s StoredPolicy) Tombstoned(t time.Time) bool {
+	return s.Deleted != nil && !s.Deleted.After(t)
+}
+
+// PolicyStore stores policies by ID, e.g. in key-value stores or in SQL
+// tables. Deleting a policy tombstones it rather than removing it, so that
+// the enforcement points that may still cache the policy keep monitoring it
+// for a grace period (see LoadPolicySet) before it's purged.
+type PolicyStore interface {
+	// Put stores a policy, replacing the policy of the same ID and its
+	// tombstone if any
+	Put(p StoredPolicy) error
+	// Delete tombstones the policy of an ID at a time
+	Delete(id string, at time.Time) error
+	// Purge removes the policy of an ID, tombstoned or not
+	Purge(id string) error
+	// Policies returns the policies of the store, tombstoned ones included,
+	// sorted by ID
+	Policies() ([]StoredPolicy, error)
+}
+
+// MemoryPolicyStore is a PolicyStore in memory
+type MemoryPolicyStore struct {
+	policies map[string]StoredPolicy
+}
+
+// Put implements PolicyStore
+func (m *MemoryPolicyStore) Put(p StoredPolicy) error {
+	if p.ID == "" {
+		return errors.New("policy: a stored policy should have an ID")
+	}
+	if m.policies == nil {
+		m.policies = make(map[string]StoredPolicy)
+	}
+	p.Deleted = nil
+	m.policies[p.ID] = p
+	return nil
+}
+
+// Delete implements PolicyStore. Deleting a tombstoned policy keeps its
+// first tombstone.
+func (m *MemoryPolicyStore) Delete(id string, at time.Time) error {
+	p, ok := m.policies[id]
+	if !ok {
+		return errors.New(fmt.Sprintf("policy: no policy %s in the store", id))
+	}
+	if p.Deleted == nil {
+		p.Deleted = &at
+		m.policies[id] = p
+	}
+	return nil
+}
+
+// Purge implements PolicyStore
+func (m *MemoryPolicyStore) Purge(id string) error {
+	if _, ok := m.policies[id]; !ok {
+		return errors.New(fmt.Sprintf("policy: no policy %s in the store", id))
+	}
+	delete(m.policies, id)
+	return nil
+}
+
+// Policies implements PolicyStore
+func (m *MemoryPolicyStore) Policies() ([]StoredPolicy, error) {
+	ps := make([]StoredPolicy, 0, len(m.policies))
+	for _, p := range m.policies {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].ID < ps[j].ID
+	})
+	return ps, nil
+}
+
+// LoadPolicySet returns the policy set of the policies of a store at time
+// now, bound to the lattices ls. The policies tombstoned for less than grace
+// are in monitor mode, so that their denials are recorded but not enforced,
+// and the ones tombstoned for longer are left out.
+func LoadPolicySet(store PolicyStore, ls []*Lattice, grace time.Duration, now time.Time) (*PolicySet, error) {
+	sps, err := store.Policies()
+	if err != nil {
+		return nil, err
+	}
+	set := NewPolicySet()
+	for _, sp := range sps {
+		if sp.Tombstoned(now.Add(-grace)) {
+			continue
+		}
+		p, err := UnmarshalPolicy(sp.Policy, ls)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("policy: stored policy %s: %s", sp.ID, err))
+		}
+		p.ID = sp.ID
+		if sp.Tombstoned(now) {
+			p.Monitor = true
+		}
+		set.Add(p)
+	}
+	return set, nil
+}
+
+// PurgeTombstones purges the policies of a store tombstoned for grace or
+// longer at time now, and returns their IDs
+func PurgeTombstones(store PolicyStore, grace time.Duration, now time.Time) ([]string, error) {
+	sps, err := store.Policies()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0)
+	for _, sp := range sps {
+		if !sp.Tombstoned(now.Add(-grace)) {
+			continue
+		}
+		if err := store.Purge(sp.ID); err != nil {
+			return ids, err
+		}
+		ids = append(ids, sp.ID)
+	}
+	return ids, nil
+}
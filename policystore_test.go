@@ -0,0 +1,90 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyStore(t *testing.T) {
+	store := &MemoryPolicyStore{}
+	for id, pstr := range map[string]string{"no-joins": "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }",
+		"no-location": "DENY DataType Location"} {
+		p := newScopedPolicy(t, pstr)
+		p.ID = id
+		sp, err := NewStoredPolicy(p)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if err := store.Put(sp); err != nil {
+			t.Fatalf("%q", err)
+		}
+	}
+	ls := newScopedPolicy(t, "ALLOW DataType TOP").lattices()
+	an, err := newScopedPolicy(t, "ALLOW DataType TOP").ParseAnnotation("DataType Location")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	deleted := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.Delete("no-location", deleted); err != nil {
+		t.Fatalf("%q", err)
+	}
+	// deleting again keeps the first tombstone
+	if err := store.Delete("no-location", deleted.Add(time.Hour)); err != nil {
+		t.Fatalf("%q", err)
+	}
+	cases := []struct {
+		now     time.Time
+		ids     string
+		monitor bool
+		allowed bool
+	}{
+		// a policy is enforced until it's deleted, monitored during the
+		// grace period, and left out after it
+		{deleted.Add(-time.Minute), "no-joins,no-location", false, false},
+		{deleted.Add(time.Minute), "no-joins,no-location", true, true},
+		{deleted.Add(time.Hour), "no-joins", false, true},
+	}
+	for _, c := range cases {
+		set, err := LoadPolicySet(store, ls, time.Hour, c.now)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		ids := make([]string, 0)
+		for _, p := range set.Policies {
+			ids = append(ids, p.ID)
+		}
+		if strings.Join(ids, ",") != c.ids {
+			t.Errorf("LoadPolicySet() at %s = %v, want %s", c.now, ids, c.ids)
+		}
+		if p := set.Get("no-location"); p != nil && p.Monitor != c.monitor {
+			t.Errorf("no-location at %s has Monitor %t", c.now, p.Monitor)
+		}
+		if set.ApplyOn(an) != c.allowed {
+			t.Errorf("ApplyOn() at %s = %t", c.now, !c.allowed)
+		}
+	}
+
+	// nothing is purged before the grace period ends
+	if ids, err := PurgeTombstones(store, time.Hour, deleted.Add(time.Minute)); err != nil || len(ids) != 0 {
+		t.Errorf("PurgeTombstones() = %v, %v", ids, err)
+	}
+	if ids, err := PurgeTombstones(store, time.Hour, deleted.Add(time.Hour)); err != nil || !equals(ids, []string{"no-location"}) {
+		t.Errorf("PurgeTombstones() = %v, %v", ids, err)
+	}
+	if sps, _ := store.Policies(); len(sps) != 1 || sps[0].ID != "no-joins" {
+		t.Errorf("Policies() = %v", sps)
+	}
+
+	if err := store.Delete("no-location", deleted); err == nil || err.Error() != "policy: no policy no-location in the store" {
+		t.Errorf("Delete() of a purged policy = %v", err)
+	}
+	if _, err := NewStoredPolicy(newScopedPolicy(t, "ALLOW DataType TOP")); err == nil {
+		t.Errorf("NewStoredPolicy() without ID should fail")
+	}
+	store.Put(StoredPolicy{ID: "broken", Policy: []byte(`{"mode": true, "lattices": ["Purpose"]}`)})
+	if _, err := LoadPolicySet(store, ls, time.Hour, deleted); err == nil || !strings.HasPrefix(err.Error(), "policy: stored policy broken:") {
+		t.Errorf("LoadPolicySet() of a broken policy = %v", err)
+	}
+}
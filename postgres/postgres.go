@@ -0,0 +1,111 @@
+// Package postgres generates the row-level security (RLS) policies that
+// enforce a policy set in Postgres, so that database enforcement stays in sync
+// with the central policy bundle. Each policy of the set becomes a
+// restrictive RLS policy whose expression is the SQL filter of the policy
+// (see grok.Policy.ToSQLFilter) over the columns holding the per-row labels:
+//
+//	ALTER TABLE "sales"."orders" ENABLE ROW LEVEL SECURITY;
+//	DROP POLICY IF EXISTS "grok" ON "sales"."orders";
+//	CREATE POLICY "grok" ON "sales"."orders" AS PERMISSIVE FOR SELECT TO PUBLIC USING (true);
+//	DROP POLICY IF EXISTS "grok_no-joins" ON "sales"."orders";
+//	CREATE POLICY "grok_no-joins" ON "sales"."orders" AS RESTRICTIVE FOR SELECT TO PUBLIC USING (...);
+//
+// Postgres shows no rows without a permissive policy, hence the permissive
+// "grok" policy, which the restrictive ones narrow down.
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// PolicyPrefix prefixes the names of the generated RLS policies
+const PolicyPrefix = "grok"
+
+// Table is a table whose rows carry labels in some columns
+type Table struct {
+	// Name is the name of the table, qualified by its schema or not
+	Name string
+	// Mapping maps attributes to the columns of their labels, which are
+	// used in the expressions as they are
+	Mapping grok.ColumnMapping
+	// Roles are the roles the policies apply to, PUBLIC when empty
+	Roles []string
+}
+
+// Statements returns the statements that enforce a policy set on the rows of
+// a table. Policies without an ID are named by their index in the set.
+func Statements(s *grok.PolicySet, t Table) ([]string, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if t.Name == "" {
+		return nil, errors.New("postgres: the table has no name")
+	}
+	table := qualified(t.Name)
+	roles := "PUBLIC"
+	if len(t.Roles) > 0 {
+		quoted := make([]string, 0, len(t.Roles))
+		for _, r := range t.Roles {
+			quoted = append(quoted, Quote(r))
+		}
+		roles = strings.Join(quoted, ", ")
+	}
+
+	stmts := []string{
+		fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY;", table),
+		fmt.Sprintf("DROP POLICY IF EXISTS %s ON %s;", Quote(PolicyPrefix), table),
+		fmt.Sprintf("CREATE POLICY %s ON %s AS PERMISSIVE FOR SELECT TO %s USING (true);", Quote(PolicyPrefix), table, roles),
+	}
+	for i, p := range s.Policies {
+		id := p.ID
+		if id == "" {
+			id = strconv.Itoa(i)
+		}
+		filter, err := p.ToSQLFilter(t.Mapping.For(p))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("postgres: policy %s: %s", id, strings.TrimPrefix(err.Error(), "policy: ")))
+		}
+		name := Quote(PolicyPrefix + "_" + id)
+		stmts = append(stmts,
+			fmt.Sprintf("DROP POLICY IF EXISTS %s ON %s;", name, table),
+			fmt.Sprintf("CREATE POLICY %s ON %s AS RESTRICTIVE FOR SELECT TO %s USING (%s);", name, table, roles, filter))
+	}
+	return stmts, nil
+}
+
+// Script returns the statements that enforce a policy set on tables, in one
+// transaction
+func Script(s *grok.PolicySet, ts ...Table) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("BEGIN;\n")
+	for _, t := range ts {
+		stmts, err := Statements(s, t)
+		if err != nil {
+			return "", err
+		}
+		for _, stmt := range stmts {
+			sb.WriteString(stmt + "\n")
+		}
+	}
+	sb.WriteString("COMMIT;\n")
+	return sb.String(), nil
+}
+
+// Quote returns an identifier quoted for Postgres
+func Quote(id string) string {
+	return `"` + strings.Replace(id, `"`, `""`, -1) + `"`
+}
+
+// qualified returns the quoted parts of a qualified name, e.g. sales.orders
+func qualified(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = Quote(p)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+func TestStatements(t *testing.T) {
+	ls := grok.NewLattices(`[
+		{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } },
+		{ "name": "Purpose", "edges": { "Analytics": [], "Sharing": [] } }
+	]`)
+	locations := grok.NewPolicy(ls[:1])
+	locations.ID = "locations"
+	if err := locations.ParsePolicy("ALLOW DataType Location"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	sharing := grok.NewPolicy(ls[1:])
+	if err := sharing.ParsePolicy("DENY Purpose Sharing"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	s := grok.NewPolicySet(locations, sharing)
+
+	got, err := Statements(s, Table{Name: "sales.orders", Roles: []string{"analyst"},
+		Mapping: grok.ColumnMapping{"DataType": "data_type", "Purpose": "purpose"}})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := []string{
+		`ALTER TABLE "sales"."orders" ENABLE ROW LEVEL SECURITY;`,
+		`DROP POLICY IF EXISTS "grok" ON "sales"."orders";`,
+		`CREATE POLICY "grok" ON "sales"."orders" AS PERMISSIVE FOR SELECT TO "analyst" USING (true);`,
+		`DROP POLICY IF EXISTS "grok_locations" ON "sales"."orders";`,
+		`CREATE POLICY "grok_locations" ON "sales"."orders" AS RESTRICTIVE FOR SELECT TO "analyst" ` +
+			`USING ((data_type IS NULL OR data_type IN ('IPAddress', 'Location')));`,
+		`DROP POLICY IF EXISTS "grok_1" ON "sales"."orders";`,
+		`CREATE POLICY "grok_1" ON "sales"."orders" AS RESTRICTIVE FOR SELECT TO "analyst" ` +
+			`USING (NOT (purpose IS NULL OR purpose IN ('Sharing', 'TOP')));`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Statements() = \n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	script, err := Script(s, Table{Name: "orders"}, Table{Name: "clicks"})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if !strings.HasPrefix(script, "BEGIN;\n") || !strings.HasSuffix(script, "COMMIT;\n") || strings.Count(script, "CREATE POLICY") != 6 ||
+		!strings.Contains(script, `CREATE POLICY "grok_1" ON "clicks" AS RESTRICTIVE FOR SELECT TO PUBLIC USING (1 = 0);`) {
+		t.Errorf("Script() = %s", script)
+	}
+
+	s.Add(locations)
+	if _, err := Statements(s, Table{Name: "orders"}); err == nil {
+		t.Errorf("Statements() with duplicate IDs = nil error")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := Quote(`grok_"x"`); got != `"grok_""x"""` {
+		t.Errorf("Quote() = %s", got)
+	}
+}
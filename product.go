@@ -0,0 +1,124 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ProductSeparator separates the components of the elements of product
+// lattices, e.g. IPAddress:Raw, like the values of a lattice and its state
+// lattice (see Product)
+const ProductSeparator = ":"
+
+// ProductOf returns the product lattice of lattices: its elements are the
+// tuples of their elements, ordered componentwise, i.e. (a1, ..., an) precedes
+// (b1, ..., bn) when every ai precedes bi. Tuples are written with their
+// components separated by ProductSeparator, e.g. IPAddress:Raw:EU, except
+// that the tuple of TOPs is TOP and the tuple of BOTTOMs is BOTTOM. The
+// lattice is named after its components, e.g. DataType×TypeState×Region.
+//
+// Unlike Product, which gives a lattice a single state lattice and keeps it a
+// single lattice, the product is materialized: it has as many elements as the
+// product of the numbers of elements of its components, TOP and BOTTOM
+// included, so it's meant for small components. The components must not be
+// modified afterwards, and their elements must not contain ProductSeparator.
+// ProductOf returns nil without lattices.
+func ProductOf(ls ...*Lattice) *Lattice {
+	if len(ls) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(ls))
+	tuples := [][]string{{}}
+	for _, l := range ls {
+		names = append(names, l.Name)
+		es := l.Elements()
+		next := make([][]string, 0, len(tuples)*len(es))
+		for _, t := range tuples {
+			for _, e := range es {
+				next = append(next, append(append(make([]string, 0, len(ls)), t...), e))
+			}
+		}
+		tuples = next
+	}
+
+	// the edges of the product cover a tuple by the tuples with one component
+	// covered in its lattice
+	edges := make([]Edge, 0)
+	for _, t := range tuples {
+		from := tupleOf(t)
+		for i, l := range ls {
+			for _, ch := range l.childrenOf([]string{t[i]}) {
+				u := append([]string{}, t...)
+				u[i] = ch
+				edges = append(edges, Edge{From: from, To: tupleOf(u)})
+			}
+		}
+	}
+	p := &Lattice{Name: strings.Join(names, "×"), Edges: edges,
+		Weights: make(map[string]int), Labels: make(map[string]map[string]string),
+		components: append([]*Lattice{}, ls...)}
+	p.indexEdges()
+	p.autoCompile()
+	return p
+}
+
+// Components returns the component lattices of a lattice built by ProductOf,
+// or nil for other lattices
+func (l *Lattice) Components() []*Lattice {
+	return l.components
+}
+
+// Project returns the components of an element of a product lattice, one per
+// component lattice, e.g. [IPAddress Raw] for IPAddress:Raw
+func (l *Lattice) Project(e string) ([]string, error) {
+	if l.components == nil {
+		return nil, errors.New(fmt.Sprintf("lattice: %s isn't a product lattice", l.Name))
+	}
+	n := len(l.components)
+	switch e {
+	case Top, Bottom:
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = e
+		}
+		return parts, nil
+	}
+	parts := strings.Split(e, ProductSeparator)
+	if len(parts) != n || !l.hasElement(e) {
+		return nil, errors.New(fmt.Sprintf("lattice: %s isn't an element of product lattice %s", e, l.Name))
+	}
+	return parts, nil
+}
+
+// Tuple returns the element of a product lattice of components, one per
+// component lattice, see Project
+func (l *Lattice) Tuple(parts ...string) (string, error) {
+	if l.components == nil {
+		return "", errors.New(fmt.Sprintf("lattice: %s isn't a product lattice", l.Name))
+	}
+	if len(parts) != len(l.components) {
+		return "", errors.New(fmt.Sprintf("lattice: product lattice %s has %d components, not %d", l.Name, len(l.components), len(parts)))
+	}
+	for i, c := range l.components {
+		if !c.hasElement(parts[i]) {
+			return "", errors.New(fmt.Sprintf("lattice: %s isn't an element of lattice %s", parts[i], c.Name))
+		}
+	}
+	return tupleOf(parts), nil
+}
+
+// tupleOf returns the element of a product lattice of components
+func tupleOf(parts []string) string {
+	top, bottom := true, true
+	for _, p := range parts {
+		top, bottom = top && p == Top, bottom && p == Bottom
+	}
+	switch {
+	case top:
+		return Top
+	case bottom:
+		return Bottom
+	}
+	return strings.Join(parts, ProductSeparator)
+}
@@ -0,0 +1,91 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestProductOf(t *testing.T) {
+	dt := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	ts := NewLattice(`{ "name": "TypeState", "edges": { "Raw": ["Truncated"] } }`)
+	p := ProductOf(dt, ts)
+	if p.Name != "DataType×TypeState" || len(p.Elements()) != 6*4 || len(p.Components()) != 2 {
+		t.Fatalf("ProductOf() = %s with %d elements", p.Name, len(p.Elements()))
+	}
+
+	// the product agrees with the state lattice of Product
+	single := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	single.Product(ts)
+	cases := []struct {
+		a, b       string
+		precede    bool
+		meet, join string
+	}{
+		{"IPAddress:Truncated", "UniqueID:Raw", true, "IPAddress:Truncated", "UniqueID:Raw"},
+		{"IPAddress:Raw", "UniqueID:Truncated", false, "IPAddress:Truncated", "UniqueID:Raw"},
+		{"UniqueID:Truncated", "Location:Raw", false, "IPAddress:Truncated", "TOP:Raw"},
+		{"AccountID:Truncated", "IPAddress:Raw", false, "BOTTOM:Truncated", "UniqueID:Raw"},
+	}
+	for _, c := range cases {
+		for _, l := range []*Lattice{p, single} {
+			if got := l.Precede(c.a, c.b); got != c.precede {
+				t.Errorf("%s: Precede(%s, %s) = %v, want %v", l.Name, c.a, c.b, got, c.precede)
+			}
+			if got := l.Meet(c.a, c.b); got != c.meet {
+				t.Errorf("%s: Meet(%s, %s) = %s, want %s", l.Name, c.a, c.b, got, c.meet)
+			}
+			if got := l.Join(c.a, c.b); got != c.join {
+				t.Errorf("%s: Join(%s, %s) = %s, want %s", l.Name, c.a, c.b, got, c.join)
+			}
+		}
+	}
+
+	region := NewLattice(`{ "name": "Region", "edges": { "Global": ["EU", "US"] } }`)
+	p3 := ProductOf(dt, ts, region)
+	if len(p3.Elements()) != 6*4*5 {
+		t.Errorf("ProductOf() of 3 lattices has %d elements", len(p3.Elements()))
+	}
+	if !p3.Precede("IPAddress:Truncated:EU", "UniqueID:Raw:Global") || p3.Precede("IPAddress:Truncated:EU", "UniqueID:Raw:US") {
+		t.Errorf("Precede() of 3 lattices isn't componentwise")
+	}
+	if got := p3.Meet("UniqueID:Raw:Global", "Location:Truncated:EU"); got != "IPAddress:Truncated:EU" {
+		t.Errorf("Meet() = %s", got)
+	}
+
+	projects := []struct {
+		e    string
+		want []string
+	}{
+		{"IPAddress:Raw:EU", []string{"IPAddress", "Raw", "EU"}},
+		{Top, []string{Top, Top, Top}},
+		{"BOTTOM:Raw:TOP", []string{Bottom, "Raw", Top}},
+		{"IPAddress:Raw", nil},
+		{"Unknown:Raw:EU", nil},
+	}
+	for _, c := range projects {
+		got, err := p3.Project(c.e)
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("Project(%s) should fail", c.e)
+			}
+			continue
+		}
+		if err != nil || !equals(got, c.want) {
+			t.Errorf("Project(%s) = %v, %v, want %v", c.e, got, err, c.want)
+			continue
+		}
+		if e, err := p3.Tuple(got...); err != nil || e != c.e {
+			t.Errorf("Tuple(%v) = %s, %v, want %s", got, e, err, c.e)
+		}
+	}
+	if _, err := p3.Tuple("IPAddress", "Raw"); err == nil {
+		t.Errorf("Tuple() with missing components should fail")
+	}
+	if _, err := dt.Project("IPAddress"); err == nil {
+		t.Errorf("Project() on a lattice that isn't a product should fail")
+	}
+	if ProductOf() != nil {
+		t.Errorf("ProductOf() without lattices should be nil")
+	}
+}
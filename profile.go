@@ -0,0 +1,172 @@
+package grok
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Lattice operations measured by ProfileEvaluate
+const (
+	OpAllow   = "allow"
+	OpDeny    = "deny"
+	OpOverlap = "overlap"
+)
+
+// Profile is the time spent evaluating a policy across a corpus of annotations
+type Profile struct {
+	Evaluations int
+	Total       time.Duration
+	// Nodes are the top-level policy and its exceptions, in the order of the
+	// policy text
+	Nodes []*NodeProfile
+	// Operations are the lattice operations, sorted by decreasing time
+	Operations []*OperationProfile
+}
+
+// NodeProfile is the time spent in the top-level policy or in an exception
+type NodeProfile struct {
+	// Path locates the node in the policy, e.g. "EXCEPT[0].EXCEPT[1]", and is
+	// empty for the top-level policy
+	Path   string
+	Mode   bool
+	Clause Clause
+	// Calls is the number of times the node was applied, which is less than
+	// the evaluations when its parent doesn't match
+	Calls int
+	// Time includes the time spent in the exceptions of the node, Self doesn't
+	Time time.Duration
+	Self time.Duration
+}
+
+// OperationProfile is the time spent in an operation of a lattice
+type OperationProfile struct {
+	Lattice   string
+	Operation string
+	Calls     int
+	Time      time.Duration
+}
+
+// profiler collects a profile during evaluations
+type profiler struct {
+	nodes map[*Policy]*NodeProfile
+	ops   map[[2]string]*OperationProfile
+}
+
+// ProfileEvaluate applies the policy on every annotation of the corpus, and
+// returns where the time was spent, so that policy authors can see which
+// exception makes their policy slow. Exceptions in monitor mode are profiled
+// like the others.
+func ProfileEvaluate(p *Policy, corpus []Annotation) *Profile {
+	pr := &profiler{make(map[*Policy]*NodeProfile), make(map[[2]string]*OperationProfile)}
+	profile := &Profile{Evaluations: len(corpus), Nodes: make([]*NodeProfile, 0)}
+	var walk func(p *Policy, path string)
+	walk = func(p *Policy, path string) {
+		n := &NodeProfile{Path: path, Mode: p.Mode, Clause: p.Clause}
+		pr.nodes[p] = n
+		profile.Nodes = append(profile.Nodes, n)
+		for i := range p.Excepts {
+			sub := Except + "[" + strconv.Itoa(i) + "]"
+			if path != "" {
+				sub = path + "." + sub
+			}
+			walk(&p.Excepts[i], sub)
+		}
+	}
+	walk(p, "")
+
+	ctx := &evalContext{profile: pr, enforce: true}
+	for _, an := range corpus {
+		start := time.Now()
+		p.apply(an, nil, ctx)
+		profile.Total += time.Since(start)
+	}
+
+	// the self time of a node is its time minus the time of its exceptions
+	var self func(p *Policy)
+	self = func(p *Policy) {
+		n := pr.nodes[p]
+		n.Self = n.Time
+		for i := range p.Excepts {
+			n.Self -= pr.nodes[&p.Excepts[i]].Time
+			self(&p.Excepts[i])
+		}
+	}
+	self(p)
+
+	profile.Operations = make([]*OperationProfile, 0, len(pr.ops))
+	for _, op := range pr.ops {
+		profile.Operations = append(profile.Operations, op)
+	}
+	sort.Slice(profile.Operations, func(i, j int) bool {
+		oi, oj := profile.Operations[i], profile.Operations[j]
+		if oi.Time != oj.Time {
+			return oi.Time > oj.Time
+		}
+		if oi.Lattice != oj.Lattice {
+			return oi.Lattice < oj.Lattice
+		}
+		return oi.Operation < oj.Operation
+	})
+	return profile
+}
+
+// String returns the profile as a table of nodes followed by a table of
+// lattice operations
+func (pr *Profile) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "%d evaluations in %s\n\n", pr.Evaluations, pr.Total)
+	fmt.Fprintln(w, "NODE\tCALLS\tTIME\tSELF\tCLAUSE")
+	for _, n := range pr.Nodes {
+		path, mode := n.Path, Deny
+		if path == "" {
+			path = "policy"
+		}
+		if n.Mode {
+			mode = Allow
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s %s\n", path, n.Calls, n.Time, n.Self, mode, n.Clause)
+	}
+	fmt.Fprintln(w, "\nLATTICE\tOPERATION\tCALLS\tTIME")
+	for _, op := range pr.Operations {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", op.Lattice, op.Operation, op.Calls, op.Time)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// node records the time spent in p since start
+func (pr *profiler) node(p *Policy, start time.Time) {
+	if n, ok := pr.nodes[p]; ok {
+		n.Calls++
+		n.Time += time.Since(start)
+	}
+}
+
+// timed runs fn, a lattice operation, and records its time when profiling.
+// fn isn't run when the budget is exceeded, and its steps are spent from the
+// budget once it has run (see WithBudget).
+func (ctx *evalContext) timed(lattice, op string, fn func()) {
+	if ctx.exceeded() {
+		return
+	}
+	defer ctx.spent()
+	if ctx == nil || ctx.profile == nil {
+		fn()
+		return
+	}
+	start := time.Now()
+	fn()
+	key := [2]string{lattice, op}
+	o, ok := ctx.profile.ops[key]
+	if !ok {
+		o = &OperationProfile{Lattice: lattice, Operation: op}
+		ctx.profile.ops[key] = o
+	}
+	o.Calls++
+	o.Time += time.Since(start)
+}
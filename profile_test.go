@@ -0,0 +1,58 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfileEvaluate(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType UniqueID EXCEPT {
+		DENY DataType IPAddress DataType AccountID
+		DENY MODE=monitor DataType AccountID }`)
+	corpus := make([]Annotation, 0)
+	for _, astr := range []string{"DataType IPAddress", "DataType AccountID", "DataType Location"} {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		corpus = append(corpus, an)
+	}
+
+	pr := ProfileEvaluate(p, corpus)
+	if pr.Evaluations != 3 || len(pr.Nodes) != 3 {
+		t.Fatalf("ProfileEvaluate() = %+v", pr)
+	}
+	cases := []struct {
+		path  string
+		calls int
+	}{
+		{"", 3},
+		// Location isn't a UniqueID, so the exceptions aren't applied on it
+		{"EXCEPT[0]", 2},
+		{"EXCEPT[1]", 2},
+	}
+	for i, c := range cases {
+		n := pr.Nodes[i]
+		if n.Path != c.path || n.Calls != c.calls {
+			t.Errorf("Nodes[%d] = %+v, want path %q and %d calls", i, n, c.path, c.calls)
+		}
+		if n.Self > n.Time || n.Self < 0 {
+			t.Errorf("Nodes[%d]: self time %s, time %s", i, n.Self, n.Time)
+		}
+	}
+
+	calls := make(map[string]int)
+	for _, op := range pr.Operations {
+		if op.Lattice != "DataType" {
+			t.Errorf("unexpected lattice %q", op.Lattice)
+		}
+		calls[op.Operation] = op.Calls
+	}
+	// AccountID is denied by the monitored exception, so it has an overlap
+	if calls[OpAllow] != 3 || calls[OpDeny] != 4 || calls[OpOverlap] != 1 {
+		t.Errorf("operation calls = %v", calls)
+	}
+	if s := pr.String(); !strings.Contains(s, "EXCEPT[1]") || !strings.Contains(s, "DENY DataType AccountID") {
+		t.Errorf("String() = %s", s)
+	}
+}
@@ -0,0 +1,281 @@
+// Package rbac bridges the role-based access control of the rest of an
+// organization, e.g. the groups of an LDAP directory or the roles of an IAM
+// export, to lattices. It converts a role-permission matrix into a Principal
+// lattice and baseline policies, so that data policies reference the same
+// roles:
+//
+//	Role     , sales:read , sales:write , hr:read
+//	Analyst  , x          ,             ,
+//	Engineer , x          , x           ,
+//	Admin    , x          , x           , x
+//
+// A role is below the roles whose permissions it has, so that a clause
+// allowing a role allows the roles that have its permissions too: Admin is
+// below Engineer, which is below Analyst. Conversely a clause denying a role
+// denies the roles above it, whose principals may have it. Roles inheriting
+// others should list the inherited permissions, as the exports usually
+// flatten them.
+//
+// Every permission has a baseline policy allowing the roles that have it, by
+// the highest of them, with the other lattices at TOP:
+//
+//	ALLOW DataType TOP Principal Analyst     (sales:read)
+//	ALLOW DataType TOP Principal Admin       (hr:read)
+//
+// Roles with the same permissions aren't ordered, and are reported.
+package rbac
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/grongjun/grok"
+)
+
+// Matrix is a role-permission matrix
+type Matrix struct {
+	// Roles and Permissions are in the order of the export
+	Roles       []string
+	Permissions []string
+	// Grants are the permissions of the roles, by role
+	Grants map[string][]string
+}
+
+// NewMatrix returns an empty matrix
+func NewMatrix() *Matrix {
+	return &Matrix{Roles: make([]string, 0), Permissions: make([]string, 0), Grants: make(map[string][]string)}
+}
+
+// Grant grants permissions to a role, adding the role and the permissions
+// that the matrix doesn't have yet
+func (m *Matrix) Grant(role string, permissions ...string) {
+	if _, ok := m.Grants[role]; !ok {
+		m.Roles = append(m.Roles, role)
+		m.Grants[role] = make([]string, 0)
+	}
+	for _, perm := range permissions {
+		if !contains(m.Permissions, perm) {
+			m.Permissions = append(m.Permissions, perm)
+		}
+		if !contains(m.Grants[role], perm) {
+			m.Grants[role] = append(m.Grants[role], perm)
+		}
+	}
+}
+
+// ReadCSV reads a matrix in CSV, with the permissions in the header row and
+// a row per role. The granted cells are x, yes, y, allow or true, and the
+// others are empty, no, n, deny, false or -.
+func ReadCSV(r io.Reader) (*Matrix, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	grid, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(grid) < 1 || len(grid[0]) < 2 {
+		return nil, errors.New("rbac: the matrix should have a header row of permissions")
+	}
+	perms := grid[0]
+	m := NewMatrix()
+	for _, perm := range perms[1:] {
+		if perm = strings.TrimSpace(perm); perm != "" && !contains(m.Permissions, perm) {
+			m.Permissions = append(m.Permissions, perm)
+		}
+	}
+	for i, row := range grid[1:] {
+		if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		role := strings.TrimSpace(row[0])
+		m.Grant(role)
+		for j := 1; j < len(row) && j < len(perms); j++ {
+			switch strings.ToLower(strings.TrimSpace(row[j])) {
+			case "x", "yes", "y", "allow", "true":
+				m.Grant(role, strings.TrimSpace(perms[j]))
+			case "", "no", "n", "deny", "false", "-":
+			default:
+				return nil, errors.New(fmt.Sprintf("rbac: the cell of role %s and permission %s (row %d) should be x or empty, not %q",
+					role, strings.TrimSpace(perms[j]), i+2, row[j]))
+			}
+		}
+	}
+	return m, nil
+}
+
+// roleJSON is a role of an export in JSON
+type roleJSON struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+// ReadJSON reads a matrix from an export in JSON, i.e. an array of roles and
+// their permissions:
+//
+//	[{"role": "Analyst", "permissions": ["sales:read"]}, ...]
+func ReadJSON(r io.Reader) (*Matrix, error) {
+	var roles []roleJSON
+	if err := json.NewDecoder(r).Decode(&roles); err != nil {
+		return nil, errors.New(fmt.Sprintf("rbac: %s", err))
+	}
+	m := NewMatrix()
+	for i, role := range roles {
+		if role.Role == "" {
+			return nil, errors.New(fmt.Sprintf("rbac: role %d has no name", i))
+		}
+		m.Grant(role.Role, role.Permissions...)
+	}
+	return m, nil
+}
+
+// Result is the lattice and the baseline policies of a matrix
+type Result struct {
+	// Lattice is the lattice of the roles, for the data policies too
+	Lattice *grok.Lattice
+	// Baselines are the baseline policies by permission, in the order of the
+	// matrix, whose IDs are the permissions
+	Baselines []*grok.Policy
+	// Equivalent are the groups of roles with the same permissions
+	Equivalent [][]string
+	// Ungranted are the permissions that no role has, without baseline
+	Ungranted []string
+}
+
+// Import returns the lattice of the roles of a matrix named attr, e.g.
+// Principal, and the baseline policies of its permissions, based on the
+// lattice and the other lattices ls
+func Import(m *Matrix, attr string, ls []*grok.Lattice) (*Result, error) {
+	for _, role := range m.Roles {
+		if role == grok.Top || role == grok.Bottom || strings.ContainsAny(role, " \t\r\n(){},") {
+			return nil, errors.New(fmt.Sprintf("rbac: role %q isn't a valid element", role))
+		}
+	}
+	for _, l := range ls {
+		if l.Name == attr {
+			return nil, errors.New(fmt.Sprintf("rbac: lattice %s is already defined", attr))
+		}
+	}
+
+	// a role is right below the roles whose permissions it strictly
+	// includes, unless a third role is between them
+	perms := make(map[string]map[string]bool, len(m.Roles))
+	for _, role := range m.Roles {
+		perms[role] = make(map[string]bool)
+		for _, perm := range m.Grants[role] {
+			perms[role][perm] = true
+		}
+	}
+	below := func(a, b string) bool {
+		return len(perms[a]) > len(perms[b]) && includes(perms[a], perms[b])
+	}
+	b := grok.NewLatticeBuilder(attr)
+	if err := b.AddElements(m.Roles...); err != nil {
+		return nil, err
+	}
+	edges := make([]grok.Edge, 0)
+	for _, from := range m.Roles {
+		for _, to := range m.Roles {
+			if !below(to, from) {
+				continue
+			}
+			direct := true
+			for _, mid := range m.Roles {
+				if below(to, mid) && below(mid, from) {
+					direct = false
+					break
+				}
+			}
+			if direct {
+				edges = append(edges, grok.Edge{From: from, To: to})
+			}
+		}
+	}
+	if _, err := b.AddEdges(edges); err != nil {
+		return nil, err
+	}
+	res := &Result{Lattice: b.Build(), Baselines: make([]*grok.Policy, 0), Equivalent: make([][]string, 0),
+		Ungranted: make([]string, 0)}
+
+	grouped := make(map[string]bool)
+	for i, role := range m.Roles {
+		if grouped[role] {
+			continue
+		}
+		group := []string{role}
+		for _, other := range m.Roles[i+1:] {
+			if len(perms[other]) == len(perms[role]) && includes(perms[other], perms[role]) {
+				group = append(group, other)
+				grouped[other] = true
+			}
+		}
+		if len(group) > 1 {
+			res.Equivalent = append(res.Equivalent, group)
+		}
+	}
+
+	// the baseline of a permission allows its highest roles, whose roles
+	// below have it too
+	all := append(append(make([]*grok.Lattice, 0, len(ls)+1), ls...), res.Lattice)
+	others := make([]string, 0, len(ls))
+	for _, l := range ls {
+		others = append(others, l.Name)
+	}
+	sort.Strings(others)
+	for _, perm := range m.Permissions {
+		clause := make([]string, 0)
+		for _, name := range others {
+			clause = append(clause, name, grok.Top)
+		}
+		for _, role := range m.Roles {
+			if !perms[role][perm] {
+				continue
+			}
+			highest := true
+			for _, other := range m.Roles {
+				if perms[other][perm] && below(role, other) {
+					highest = false
+					break
+				}
+			}
+			if highest {
+				clause = append(clause, attr, role)
+			}
+		}
+		if len(clause) == 2*len(others) {
+			res.Ungranted = append(res.Ungranted, perm)
+			continue
+		}
+		p := grok.NewPolicy(all)
+		if err := p.ParsePolicy(grok.Allow + " " + strings.Join(clause, " ")); err != nil {
+			return nil, errors.New(fmt.Sprintf("rbac: the baseline of permission %s: %s", perm, err))
+		}
+		p.ID = perm
+		res.Baselines = append(res.Baselines, p)
+	}
+	return res, nil
+}
+
+// includes returns true when a includes b
+func includes(a, b map[string]bool) bool {
+	for e := range b {
+		if !a[e] {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
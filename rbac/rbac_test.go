@@ -0,0 +1,126 @@
+package rbac
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grongjun/grok"
+)
+
+const csvMatrix = `Role, sales:read, sales:write, hr:read, ops:deploy
+Intern, , , ,
+Analyst, x, , ,
+Auditor, yes, no, ,
+Engineer, x, x, ,
+Admin, x, x, x, -
+`
+
+func TestImport(t *testing.T) {
+	m, err := ReadCSV(strings.NewReader(csvMatrix))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	ls := []*grok.Lattice{grok.NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"] } }`)}
+	res, err := Import(m, "Principal", ls)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	l := res.Lattice
+	for _, test := range []struct {
+		a, b    string
+		precede bool
+	}{
+		{"Admin", "Engineer", true},
+		{"Engineer", "Analyst", true},
+		{"Auditor", "Intern", true},
+		{"Analyst", "Auditor", false},
+		{"Analyst", "Engineer", false},
+	} {
+		if got := l.Precede(test.a, test.b); got != test.precede {
+			t.Errorf("Precede(%s, %s) = %t, want %t", test.a, test.b, got, test.precede)
+		}
+	}
+	if !reflect.DeepEqual(res.Equivalent, [][]string{{"Analyst", "Auditor"}}) {
+		t.Errorf("Equivalent = %v", res.Equivalent)
+	}
+	if !reflect.DeepEqual(res.Ungranted, []string{"ops:deploy"}) {
+		t.Errorf("Ungranted = %v", res.Ungranted)
+	}
+
+	want := map[string]string{
+		"sales:read":  "DataType TOP Principal Analyst Principal Auditor",
+		"sales:write": "DataType TOP Principal Engineer",
+		"hr:read":     "DataType TOP Principal Admin",
+	}
+	if len(res.Baselines) != len(want) {
+		t.Fatalf("Baselines = %v", res.Baselines)
+	}
+	for _, p := range res.Baselines {
+		if got := p.Clause.String(); got != want[p.ID] {
+			t.Errorf("the baseline of %s = %s, want %s", p.ID, got, want[p.ID])
+		}
+	}
+
+	// the data policies share the lattice of the roles with the baselines
+	p := grok.NewPolicy(append(ls, l))
+	if err := p.ParsePolicy("ALLOW DataType TOP Principal TOP EXCEPT { DENY DataType AccountID Principal Admin }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	set := grok.NewPolicySet(append([]*grok.Policy{p}, res.Baselines[1])...)
+	for _, test := range []struct {
+		annotation string
+		allowed    bool
+	}{
+		{"DataType IPAddress Principal Engineer", true},
+		{"DataType IPAddress Principal Admin", true},
+		// an Engineer may be an Admin
+		{"DataType AccountID Principal Engineer", false},
+		{"DataType IPAddress Principal Auditor", false},
+	} {
+		an, err := p.ParseAnnotation(test.annotation)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := set.ApplyOn(an); got != test.allowed {
+			t.Errorf("ApplyOn(%s) = %t, want %t", test.annotation, got, test.allowed)
+		}
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	m, err := ReadJSON(strings.NewReader(`[{"role": "Analyst", "permissions": ["sales:read"]},
+		{"role": "Admin", "permissions": ["sales:read", "hr:read"]}, {"role": "Analyst", "permissions": ["sales:read"]}]`))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if !reflect.DeepEqual(m.Roles, []string{"Analyst", "Admin"}) || !reflect.DeepEqual(m.Permissions, []string{"sales:read", "hr:read"}) {
+		t.Errorf("ReadJSON() = %+v", m)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		read func() (*Matrix, error)
+		err  string
+	}{
+		{"cell", func() (*Matrix, error) { return ReadCSV(strings.NewReader("Role, a\nAdmin, maybe\n")) },
+			`rbac: the cell of role Admin and permission a (row 2) should be x or empty, not "maybe"`},
+		{"header", func() (*Matrix, error) { return ReadCSV(strings.NewReader("Role\n")) },
+			"rbac: the matrix should have a header row of permissions"},
+		{"name", func() (*Matrix, error) { return ReadJSON(strings.NewReader(`[{"permissions": ["a"]}]`)) },
+			"rbac: role 0 has no name"},
+		{"role", func() (*Matrix, error) {
+			m := NewMatrix()
+			m.Grant("Data Owner", "a")
+			_, err := Import(m, "Principal", nil)
+			return m, err
+		}, `rbac: role "Data Owner" isn't a valid element`},
+	} {
+		if _, err := test.read(); err == nil || err.Error() != test.err {
+			t.Errorf("%s: err = %v, want %s", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+// Package recertify re-certifies the datasets of a catalog against the active
+// policies, and reports the datasets whose annotations violate them.
+//
+// Findings carry a severity derived from the weights of the dataset's elements,
+// and a fingerprint that suppression files refer to, so that accepted risks are
+// reported apart from the actionable findings.
+//
+// Findings refer to policies by ID, so that their fingerprints don't depend
+// on the order of the policies in the set, and every policy of the set must
+// have a distinct ID. A run checks a snapshot of the set taken when it starts,
+// so that the set can be edited meanwhile.
+//
+// Runs over large catalogs check datasets in parallel and can be resumed from
+// a checkpoint file of the same policies and catalog, and each report is compared with the previous run so that
+// new violations stand out from the known ones.
+package recertify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+// Catalog is an export of a data catalog, mapping datasets to their annotations
+type Catalog map[string]grok.Annotation
+
+// Status tells whether a finding is new since the previous run
+type Status string
+
+const (
+	New        Status = "NEW"
+	Persisting Status = "PERSISTING"
+)
+
+// Finding is a dataset whose annotation is denied by some policies
+type Finding struct {
+	Dataset string `json:"dataset"`
+	// Policies are the sorted IDs of the denying policies
+	Policies    []string      `json:"policies"`
+	Status      Status        `json:"status"`
+	Severity    grok.Severity `json:"severity"`
+	Fingerprint string        `json:"fingerprint"`
+	// Justification is the justification of the suppression of a suppressed finding
+	Justification string `json:"justification,omitempty"`
+}
+
+// Report is the result of a re-certification run
+type Report struct {
+	// Findings are ordered by priority: new findings first, then by severity,
+	// then findings with more denying policies, then by dataset
+	Findings []Finding `json:"findings"`
+	// Suppressed are the findings suppressed by a valid suppression
+	Suppressed []Finding `json:"suppressed"`
+	// Resolved are the datasets that were findings of the previous run, and are
+	// no longer violating (or no longer in the catalog)
+	Resolved []string `json:"resolved"`
+	// Checked is the number of checked datasets
+	Checked int `json:"checked"`
+	// Warnings are the warnings of the run, e.g. about a discarded checkpoint
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Options configures a re-certification run
+type Options struct {
+	// Workers is the number of datasets checked in parallel, 1 if not positive
+	Workers int
+	// Previous is the report of the previous run, if any
+	Previous *Report
+	// Checkpoint is the path of the checkpoint file. When set, the progress of
+	// the run is saved to it every CheckpointEvery datasets, a run resumes from
+	// it when it exists, and it's removed once the run completes. A checkpoint
+	// of other policies or of another catalog is discarded with a warning.
+	Checkpoint      string
+	CheckpointEvery int
+	// Suppressions are honored when they are valid at Now, which is the start
+	// time of the run if zero
+	Suppressions grok.Suppressions
+	Now          time.Time
+}
+
+// checkpoint is the progress of a run: the IDs of the denying policies of
+// every checked dataset, and the fingerprint of the policies and the catalog
+// of the run
+type checkpoint struct {
+	Fingerprint string              `json:"fingerprint"`
+	Done        map[string][]string `json:"done"`
+}
+
+// fingerprint returns the digest of the policies of a run, by ID, and of
+// its catalog
+func fingerprint(policies []*grok.Policy, c Catalog) (string, error) {
+	ps := make(map[string]string, len(policies))
+	for _, p := range policies {
+		ps[p.ID], _ = p.Fingerprints()
+	}
+	b, err := json.Marshal(struct {
+		Policies map[string]string
+		Catalog  Catalog
+	}{ps, c})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Run re-certifies the datasets of a catalog against a PolicySet, whose
+// policies must have distinct IDs
+func Run(c Catalog, ps *grok.PolicySet, opts Options) (*Report, error) {
+	policies := ps.Snapshot()
+	byID := make(map[string]*grok.Policy, len(policies))
+	for i, p := range policies {
+		if p.ID == "" {
+			return nil, errors.New(fmt.Sprintf("recertify: the policy %d has no ID", i))
+		}
+		if byID[p.ID] != nil {
+			return nil, errors.New(fmt.Sprintf("recertify: duplicate policy ID %s", p.ID))
+		}
+		byID[p.ID] = p
+	}
+	fp, err := fingerprint(policies, c)
+	if err != nil {
+		return nil, err
+	}
+	cp := checkpoint{fp, make(map[string][]string)}
+	warnings := make([]string, 0)
+	if opts.Checkpoint != "" {
+		var saved checkpoint
+		switch err := load(opts.Checkpoint, &saved); {
+		case err == nil && saved.Fingerprint == fp:
+			if saved.Done != nil {
+				cp.Done = saved.Done
+			}
+		case err == nil:
+			warnings = append(warnings, fmt.Sprintf("recertify: discarded the checkpoint %s of other policies or of another catalog", opts.Checkpoint))
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+	}
+
+	// datasets are checked in a sorted order, so that interrupted runs are reproducible
+	todo := make([]string, 0, len(c))
+	for ds := range c {
+		if _, ok := cp.Done[ds]; !ok {
+			todo = append(todo, ds)
+		}
+	}
+	sort.Strings(todo)
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	type result struct {
+		dataset string
+		denying []string
+	}
+	jobs := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ds := range jobs {
+				ids := make([]string, 0)
+				for _, p := range policies {
+					if !p.ApplyOn(c[ds]) {
+						ids = append(ids, p.ID)
+					}
+				}
+				sort.Strings(ids)
+				results <- result{ds, ids}
+			}
+		}()
+	}
+	go func() {
+		for _, ds := range todo {
+			jobs <- ds
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	n := 0
+	for r := range results {
+		cp.Done[r.dataset] = r.denying
+		n++
+		if opts.Checkpoint != "" && opts.CheckpointEvery > 0 && n%opts.CheckpointEvery == 0 && err == nil {
+			// keep draining the results even if the checkpoint can't be saved
+			err = save(opts.Checkpoint, &cp)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	report := newReport(c, byID, cp.Done, opts)
+	if len(warnings) > 0 {
+		report.Warnings = warnings
+	}
+	if opts.Checkpoint != "" {
+		if err := os.Remove(opts.Checkpoint); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// newReport builds the report of the checked datasets, compared to the previous
+// report. The denying policies that are no longer in the set are ignored.
+func newReport(c Catalog, byID map[string]*grok.Policy, done map[string][]string, opts Options) *Report {
+	before := make(map[string]bool)
+	if prev := opts.Previous; prev != nil {
+		for _, f := range prev.Findings {
+			before[f.Dataset] = true
+		}
+		for _, f := range prev.Suppressed {
+			before[f.Dataset] = true
+		}
+	}
+
+	report := &Report{Findings: make([]Finding, 0), Suppressed: make([]Finding, 0), Resolved: make([]string, 0)}
+	for ds, ids := range done {
+		if _, ok := c[ds]; !ok {
+			continue
+		}
+		report.Checked++
+		denying := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if byID[id] != nil {
+				denying = append(denying, id)
+			}
+		}
+		done[ds] = denying
+		if len(denying) == 0 {
+			continue
+		}
+		status := New
+		if before[ds] {
+			status = Persisting
+		}
+		f := Finding{Dataset: ds, Policies: denying, Status: status}
+		for _, id := range denying {
+			if sev := byID[id].Severity(c[ds]); sev > f.Severity {
+				f.Severity = sev
+			}
+		}
+		f.Fingerprint = grok.Fingerprint(append([]string{ds}, denying...)...)
+		if s, ok := opts.Suppressions.Suppressed(f.Fingerprint, opts.Now); ok {
+			f.Justification = s.Justification
+			report.Suppressed = append(report.Suppressed, f)
+			continue
+		}
+		report.Findings = append(report.Findings, f)
+	}
+	for ds := range before {
+		if len(done[ds]) == 0 {
+			report.Resolved = append(report.Resolved, ds)
+		}
+	}
+
+	prioritize(report.Findings)
+	prioritize(report.Suppressed)
+	sort.Strings(report.Resolved)
+	return report
+}
+
+// prioritize sorts findings by priority
+func prioritize(fs []Finding) {
+	sort.Slice(fs, func(p, q int) bool {
+		fp, fq := fs[p], fs[q]
+		if fp.Status != fq.Status {
+			return fp.Status == New
+		}
+		if fp.Severity != fq.Severity {
+			return fp.Severity > fq.Severity
+		}
+		if len(fp.Policies) != len(fq.Policies) {
+			return len(fp.Policies) > len(fq.Policies)
+		}
+		return fp.Dataset < fq.Dataset
+	})
+}
+
+// LoadReport reads a report saved by Save
+func LoadReport(path string) (*Report, error) {
+	var r Report
+	if err := load(path, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Save writes the report to a JSON file
+func (r *Report) Save(path string) error {
+	return save(path, r)
+}
+
+func load(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// save writes v to a temporary file first, so that an interrupted save
+// doesn't corrupt a previous checkpoint
+func save(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
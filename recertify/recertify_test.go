@@ -0,0 +1,253 @@
+package recertify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grongjun/grok"
+)
+
+func setup(t *testing.T) (Catalog, *grok.PolicySet) {
+	dt := grok.NewLattice(`{ "name": "DataType",
+		"edges": {
+			"UniqueID": ["AccountID", "IPAddress"],
+			"Location": ["IPAddress"] },
+		"weights": { "AccountID": 3, "IPAddress": 2 }
+		}`)
+	p1 := grok.NewPolicy([]*grok.Lattice{dt})
+	p1.ID = "minimization"
+	if err := p1.ParsePolicy(`ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`); err != nil {
+		t.Fatalf("%q", err)
+	}
+	p2 := grok.NewPolicy([]*grok.Lattice{dt})
+	p2.ID = "accounts"
+	if err := p2.ParsePolicy(`DENY DataType AccountID`); err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	c := make(Catalog)
+	for ds, astr := range map[string]string{
+		"clicks":   "DataType IPAddress",
+		"accounts": "DataType AccountID",
+		"joined":   "DataType IPAddress DataType AccountID",
+		"geo":      "DataType Location",
+	} {
+		an, err := p1.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		c[ds] = an
+	}
+	return c, grok.NewPolicySet(p1, p2)
+}
+
+func datasets(fs []Finding) []string {
+	ds := make([]string, 0)
+	for _, f := range fs {
+		ds = append(ds, f.Dataset)
+	}
+	return ds
+}
+
+func equals(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRun(t *testing.T) {
+	c, ps := setup(t)
+	r, err := Run(c, ps, Options{Workers: 3})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := datasets(r.Findings); !equals(got, []string{"joined", "accounts"}) {
+		t.Errorf("findings = %q", got)
+	}
+	if r.Checked != 4 || r.Findings[0].Status != New {
+		t.Errorf("report = %+v", r)
+	}
+
+	// the second run compares with the first one
+	delete(c, "accounts")
+	c["new"] = c["joined"]
+	r2, err := Run(c, ps, Options{Workers: 2, Previous: r})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := datasets(r2.Findings); !equals(got, []string{"new", "joined"}) {
+		t.Errorf("findings = %q", got)
+	}
+	if r2.Findings[1].Status != Persisting {
+		t.Errorf("status(joined) = %q, want %q", r2.Findings[1].Status, Persisting)
+	}
+	if !equals(r2.Resolved, []string{"accounts"}) {
+		t.Errorf("resolved = %q", r2.Resolved)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recertify")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	// a previous interrupted run has checked accounts (and recorded it clean)
+	c, ps := setup(t)
+	fp, err := fingerprint(ps.Snapshot(), c)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := save(path, &checkpoint{fp, map[string][]string{"accounts": {}}}); err != nil {
+		t.Fatalf("%q", err)
+	}
+	r, err := Run(c, ps, Options{Checkpoint: path, CheckpointEvery: 1})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := datasets(r.Findings); !equals(got, []string{"joined"}) || r.Checked != 4 {
+		t.Errorf("findings = %q, checked = %d", got, r.Checked)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint should be removed after the run")
+	}
+}
+
+func TestRunResumeOtherCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recertify")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+	c, ps := setup(t)
+
+	// the checkpoint of a run over other policies, or over another catalog,
+	// is discarded
+	other := make(Catalog)
+	for ds, an := range c {
+		other[ds] = an
+	}
+	delete(other, "geo")
+	fp, err := fingerprint(ps.Snapshot(), other)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	for _, cp := range []checkpoint{
+		{"sha256:0", map[string][]string{"accounts": {}, "geo": {"retired"}}},
+		{fp, map[string][]string{"accounts": {}}},
+	} {
+		if err := save(path, &cp); err != nil {
+			t.Fatalf("%q", err)
+		}
+		r, err := Run(c, ps, Options{Checkpoint: path})
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := datasets(r.Findings); !equals(got, []string{"joined", "accounts"}) || r.Checked != 4 {
+			t.Errorf("findings = %q, checked = %d", got, r.Checked)
+		}
+		if len(r.Warnings) != 1 {
+			t.Errorf("warnings = %q", r.Warnings)
+		}
+	}
+}
+
+func TestReportSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recertify")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.json")
+
+	c, ps := setup(t)
+	r, err := Run(c, ps, Options{})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := r.Save(path); err != nil {
+		t.Fatalf("%q", err)
+	}
+	loaded, err := LoadReport(path)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if !equals(datasets(loaded.Findings), datasets(r.Findings)) || loaded.Checked != r.Checked {
+		t.Errorf("LoadReport() = %+v, want %+v", loaded, r)
+	}
+}
+
+func TestRunSuppressions(t *testing.T) {
+	c, ps := setup(t)
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	ss := grok.Suppressions{
+		{Fingerprint: grok.Fingerprint("accounts", "accounts"), Expires: now.Add(time.Hour), Justification: "accepted by review"},
+		{Fingerprint: grok.Fingerprint("joined", "accounts", "minimization"), Expires: now.Add(-time.Hour), Justification: "expired"},
+	}
+	r, err := Run(c, ps, Options{Suppressions: ss, Now: now})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := datasets(r.Findings); !equals(got, []string{"joined"}) {
+		t.Errorf("findings = %q", got)
+	}
+	if got := datasets(r.Suppressed); !equals(got, []string{"accounts"}) {
+		t.Errorf("suppressed = %q", got)
+	}
+	if r.Findings[0].Severity != grok.SeverityHigh || r.Suppressed[0].Justification != "accepted by review" {
+		t.Errorf("report = %+v", r)
+	}
+}
+
+func TestRunFingerprints(t *testing.T) {
+	c, ps := setup(t)
+	r, err := Run(c, ps, Options{})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	// reordering the policies and adding one that denies nothing keeps the findings
+	p3 := grok.NewPolicy([]*grok.Lattice{grok.NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)})
+	p3.ID = "retention"
+	if err := p3.ParsePolicy(`ALLOW DataType TOP`); err != nil {
+		t.Fatalf("%q", err)
+	}
+	r2, err := Run(c, grok.NewPolicySet(p3, ps.Policies[1], ps.Policies[0]), Options{Previous: r})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if len(r2.Findings) != len(r.Findings) {
+		t.Fatalf("findings = %+v, want %+v", r2.Findings, r.Findings)
+	}
+	for i, f := range r2.Findings {
+		if f.Fingerprint != r.Findings[i].Fingerprint || !equals(f.Policies, r.Findings[i].Policies) || f.Status != Persisting {
+			t.Errorf("finding = %+v, want %+v", f, r.Findings[i])
+		}
+	}
+	if !equals(r.Findings[0].Policies, []string{"accounts", "minimization"}) {
+		t.Errorf("policies = %q", r.Findings[0].Policies)
+	}
+
+	// the policies are told apart by their IDs
+	ps.Policies[1].ID = ""
+	if _, err := Run(c, ps, Options{}); err == nil {
+		t.Errorf("Run() without policy ID should fail")
+	}
+	ps.Policies[1].ID = ps.Policies[0].ID
+	if _, err := Run(c, ps, Options{}); err == nil {
+		t.Errorf("Run() with duplicate policy IDs should fail")
+	}
+}
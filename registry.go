@@ -0,0 +1,145 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ScopeSeparator separates the levels of a scope path, e.g. acme/marketing/clicks
+// is the dataset clicks of the business unit marketing of the organization acme.
+const ScopeSeparator = "/"
+
+// CombiningRule decides the final effect when the policies of several scopes
+// apply to the same annotation
+type CombiningRule int
+
+const (
+	// DenyOverrides denies when any scope denies
+	DenyOverrides CombiningRule = iota
+	// AllowOverrides allows when any scope allows
+	AllowOverrides
+	// MostSpecific takes the effect of the most specific scope
+	MostSpecific
+)
+
+// ScopeEffect is the effect of the policy registered at a scope
+type ScopeEffect struct {
+	Scope   string
+	Allowed bool
+}
+
+// ScopedDecision is the result of evaluating an annotation across scopes
+type ScopedDecision struct {
+	Allowed bool
+	// Scope is the scope that produced the final effect
+	Scope string
+	// Effects are the effects of each applicable scope, from the least specific one
+	Effects []ScopeEffect
+}
+
+// Registry resolves the policies applicable to a scope (organization → business
+// unit → dataset) and combines their effects. It is safe for concurrent use.
+type Registry struct {
+	Rule     CombiningRule
+	mu       sync.RWMutex
+	policies map[string]*Policy
+	// listeners are notified of reloads, see OnReload
+	listeners []func(scope string)
+}
+
+// NewRegistry returns an empty Registry combining effects by rule
+func NewRegistry(rule CombiningRule) *Registry {
+	return &Registry{Rule: rule, policies: make(map[string]*Policy)}
+}
+
+// Register sets the policy of a scope, replacing any previous one
+func (r *Registry) Register(scope string, p *Policy) {
+	r.mu.Lock()
+	r.policies[strings.Trim(scope, ScopeSeparator)] = p
+	r.mu.Unlock()
+	r.reloaded(scope)
+}
+
+// Unregister removes the policy of a scope
+func (r *Registry) Unregister(scope string) {
+	r.mu.Lock()
+	delete(r.policies, strings.Trim(scope, ScopeSeparator))
+	r.mu.Unlock()
+	r.reloaded(scope)
+}
+
+// OnReload registers a listener that is called with the scope of every policy
+// that is registered or unregistered, e.g. to invalidate the decisions cached
+// by gateways (see DecisionCache), so that stale allows don't outlive a
+// tightening change. Policies based on reloaded lattices are reloaded by
+// registering them again. Listeners are called after the change.
+func (r *Registry) OnReload(fn func(scope string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// reloaded notifies the listeners of a reloaded scope
+func (r *Registry) reloaded(scope string) {
+	r.mu.RLock()
+	ls := r.listeners[:len(r.listeners):len(r.listeners)]
+	r.mu.RUnlock()
+	for _, fn := range ls {
+		fn(strings.Trim(scope, ScopeSeparator))
+	}
+}
+
+// Chain returns the scopes with a registered policy that apply to scope,
+// from the least specific one
+func (r *Registry) Chain(scope string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.chainLocked(scope)
+}
+
+// chainLocked is Chain, with r.mu held
+func (r *Registry) chainLocked(scope string) []string {
+	chain := make([]string, 0)
+	levels := strings.Split(strings.Trim(scope, ScopeSeparator), ScopeSeparator)
+	for i := range levels {
+		s := strings.Join(levels[:i+1], ScopeSeparator)
+		if _, ok := r.policies[s]; ok {
+			chain = append(chain, s)
+		}
+	}
+	return chain
+}
+
+// Evaluate applies the policies of the scope chain on an annotation in order,
+// and combines their effects by the registry's rule
+func (r *Registry) Evaluate(scope string, an Annotation) (ScopedDecision, error) {
+	// the chain is evaluated under the lock it's computed under, so that
+	// its scopes can't be unregistered in between
+	r.mu.RLock()
+	chain := r.chainLocked(scope)
+	d := ScopedDecision{Effects: make([]ScopeEffect, 0, len(chain))}
+	for _, s := range chain {
+		d.Effects = append(d.Effects, ScopeEffect{s, r.policies[s].ApplyOn(an)})
+	}
+	r.mu.RUnlock()
+	if len(chain) == 0 {
+		return ScopedDecision{}, errors.New(fmt.Sprintf("registry: no policy applies to scope %s", scope))
+	}
+
+	// the most specific scope decides, unless an overriding effect is found
+	last := d.Effects[len(d.Effects)-1]
+	d.Allowed, d.Scope = last.Allowed, last.Scope
+	if r.Rule == MostSpecific {
+		return d, nil
+	}
+	override := r.Rule == AllowOverrides
+	for _, e := range d.Effects {
+		if e.Allowed == override {
+			d.Allowed, d.Scope = e.Allowed, e.Scope
+			break
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,112 @@
+package grok
+
+import (
+	"sync"
+	"testing"
+)
+
+func newScopedPolicy(t *testing.T, pstr string) *Policy {
+	p := NewPolicy([]*Lattice{NewLattice(`{ "name": "DataType",
+		"edges": {
+			"UniqueID": ["AccountID", "IPAddress"],
+			"Location": ["IPAddress"] }
+		}`)})
+	if err := p.ParsePolicy(pstr); err != nil {
+		t.Fatalf("%q", err)
+	}
+	return p
+}
+
+func TestChain(t *testing.T) {
+	r := NewRegistry(DenyOverrides)
+	r.Register("acme", newScopedPolicy(t, "ALLOW DataType TOP"))
+	r.Register("acme/marketing/clicks", newScopedPolicy(t, "ALLOW DataType TOP"))
+	cases := []struct {
+		scope string
+		want  []string
+	}{
+		{"acme/marketing/clicks", []string{"acme", "acme/marketing/clicks"}},
+		{"/acme/marketing/", []string{"acme"}},
+		{"other", []string{}},
+	}
+	for _, c := range cases {
+		if got := r.Chain(c.scope); !equals(got, c.want) {
+			t.Errorf("Chain(%q) = %q, want %q", c.scope, got, c.want)
+		}
+	}
+}
+
+func TestRegistryEvaluate(t *testing.T) {
+	cases := []struct {
+		rule    CombiningRule
+		astr    string
+		allowed bool
+		scope   string
+	}{
+		{DenyOverrides, "DataType IPAddress", true, "acme/marketing/clicks"},
+		{DenyOverrides, "DataType AccountID", false, "acme/marketing"},
+		{AllowOverrides, "DataType AccountID", true, "acme"},
+		{MostSpecific, "DataType AccountID", true, "acme/marketing/clicks"},
+		{MostSpecific, "DataType Location", false, "acme/marketing/clicks"},
+	}
+	for _, c := range cases {
+		r := NewRegistry(c.rule)
+		r.Register("acme", newScopedPolicy(t, "ALLOW DataType TOP"))
+		r.Register("acme/marketing", newScopedPolicy(t, "DENY DataType AccountID"))
+		r.Register("acme/marketing/clicks", newScopedPolicy(t, "ALLOW DataType UniqueID"))
+		p := newScopedPolicy(t, "ALLOW DataType TOP")
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		d, err := r.Evaluate("acme/marketing/clicks", an)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if d.Allowed != c.allowed || d.Scope != c.scope || len(d.Effects) != 3 {
+			t.Errorf("Evaluate(%v, %q) = %+v, want %t by %q", c.rule, c.astr, d, c.allowed, c.scope)
+		}
+	}
+}
+
+func TestRegistryEvaluateNoPolicy(t *testing.T) {
+	r := NewRegistry(DenyOverrides)
+	r.Register("acme", newScopedPolicy(t, "ALLOW DataType TOP"))
+	r.Unregister("acme")
+	if _, err := r.Evaluate("acme", Annotation{}); err == nil {
+		t.Errorf("Evaluate should fail without applicable policies")
+	}
+}
+
+// TestRegistryEvaluateUnregister evaluates while scopes are unregistered and
+// registered again, which the race detector checks with go test -race
+func TestRegistryEvaluateUnregister(t *testing.T) {
+	r := NewRegistry(DenyOverrides)
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	an, err := p.ParseAnnotation("DataType IPAddress")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	r.Register("acme", p)
+	r.Register("acme/marketing", p)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20000; i++ {
+			r.Unregister("acme/marketing")
+			r.Register("acme/marketing", p)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20000; i++ {
+			if d, err := r.Evaluate("acme/marketing", an); err != nil || !d.Allowed {
+				t.Errorf("Evaluate() = %+v, %v", d, err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,212 @@
+package grok
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Template names of a Renderer. The templates are executed with a TemplateData.
+const (
+	// the annotation is allowed by an ALLOW policy
+	TemplateAllow = "allow"
+	// the annotation is out of the scope of a DENY policy
+	TemplateAllowUnmatched = "allow.unmatched"
+	// an exception of a DENY policy allows the annotation
+	TemplateAllowExcept = "allow.except"
+	// the annotation is denied by a DENY policy
+	TemplateDeny = "deny"
+	// the annotation is out of the scope of an ALLOW policy
+	TemplateDenyUnmatched = "deny.unmatched"
+	// an exception of an ALLOW policy denies the annotation
+	TemplateDenyExcept = "deny.except"
+	// the prefix of the templates of the warnings of a kind, e.g.
+	// "warning.expired-value", which are executed with the Warning. The
+	// warnings without a template are rendered as their message.
+	TemplateWarning = "warning."
+)
+
+// DefaultTemplates are the templates used when a Renderer doesn't override them
+var DefaultTemplates = map[string]string{
+	TemplateAllow:          "Allowed because the program uses {{.Uses}}, which {{.Policy}} allows.",
+	TemplateAllowUnmatched: "Allowed because the program uses {{.Uses}}, which {{.Policy}} doesn't cover.",
+	TemplateAllowExcept:    "Allowed because the program uses {{.Uses}}, which the exception to {{.Policy}} allows.",
+	TemplateDeny:           "Denied because the program uses {{.Uses}}, which {{.Policy}} forbids.",
+	TemplateDenyUnmatched:  "Denied because the program uses {{.Uses}}, which {{.Policy}} doesn't allow.",
+	TemplateDenyExcept:     "Denied because the program uses {{.Uses}}, which the exception to {{.Policy}} forbids.",
+}
+
+// TemplateData is the data of the templates of a Renderer
+type TemplateData struct {
+	// Uses are the labels of the annotation values that the decision is about,
+	// e.g. "IPAddress together with AccountID"
+	Uses string
+	// Policy names the top-level policy, e.g. "the global allow" or
+	// "the deny of IPAddress"
+	Policy string
+	// Exception names the deciding exception, if any, e.g. "the deny of IPAddress and AccountID"
+	Exception string
+	// Explanation is the rendered explanation
+	Explanation *Explanation
+}
+
+// Renderer converts explanations into readable prose
+type Renderer struct {
+	// Labels are the display names of elements, e.g. "IPAddress": "IP addresses".
+	// Elements without a label are displayed as they are.
+	Labels map[string]string
+	// Templates override DefaultTemplates by name
+	Templates map[string]string
+	// Words override the words used to build the template data: "global allow",
+	// "global deny", "allow of", "deny of", "together with", "and", "nothing"
+	Words map[string]string
+
+	mu sync.Mutex
+	// parsed are the templates parsed so far, by text
+	parsed map[string]*template.Template
+}
+
+// Render returns the explanation in prose, followed by its warnings
+func (r *Renderer) Render(e *Explanation) (string, error) {
+	name, data := r.data(e)
+	text, ok := r.Templates[name]
+	if !ok {
+		text = DefaultTemplates[name]
+	}
+	var buf bytes.Buffer
+	if err := r.execute(&buf, name, text, data); err != nil {
+		return "", err
+	}
+	for _, w := range e.Warnings {
+		buf.WriteString(" ")
+		text, ok := r.Templates[TemplateWarning+w.Kind]
+		if !ok {
+			buf.WriteString(w.Message)
+			continue
+		}
+		if err := r.execute(&buf, TemplateWarning+w.Kind, text, w); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// execute executes the template of a text with data into buf. A text is
+// parsed once, the first time it's executed by the renderer.
+func (r *Renderer) execute(buf *bytes.Buffer, name, text string, data interface{}) error {
+	r.mu.Lock()
+	t, ok := r.parsed[text]
+	if !ok {
+		var err error
+		if t, err = template.New(name).Parse(text); err != nil {
+			r.mu.Unlock()
+			return err
+		}
+		if r.parsed == nil {
+			r.parsed = make(map[string]*template.Template)
+		}
+		r.parsed[text] = t
+	}
+	r.mu.Unlock()
+	return t.Execute(buf, data)
+}
+
+// data returns the template name and data of an explanation
+func (r *Renderer) data(e *Explanation) (string, TemplateData) {
+	data := TemplateData{Policy: r.policy(e), Explanation: e}
+	switch {
+	case !e.Matched:
+		data.Uses = r.uses(e.Annotation, []string{e.Attribute})
+		if e.Allowed {
+			return TemplateAllowUnmatched, data
+		}
+		return TemplateDenyUnmatched, data
+	case e.Decider >= 0:
+		d := e.Excepts[e.Decider]
+		data.Exception = r.policy(d)
+		data.Uses = r.uses(d.Annotation, attributesOf(d.Clause))
+		if e.Allowed {
+			return TemplateAllowExcept, data
+		}
+		return TemplateDenyExcept, data
+	default:
+		data.Uses = r.uses(e.Annotation, nil)
+		if e.Allowed {
+			return TemplateAllow, data
+		}
+		return TemplateDeny, data
+	}
+}
+
+// Label returns the display name of an element. Product elements are
+// displayed as their first component followed by the second one in parentheses.
+func (r *Renderer) Label(v string) string {
+	if l, ok := r.Labels[v]; ok {
+		return l
+	}
+	if i := strings.IndexRune(v, ':'); i > 0 {
+		return r.Label(v[:i]) + " (" + r.Label(v[i+1:]) + ")"
+	}
+	return v
+}
+
+// word returns the (possibly overridden) word w
+func (r *Renderer) word(w string) string {
+	if o, ok := r.Words[w]; ok {
+		return o
+	}
+	return w
+}
+
+// policy names the policy of an explanation
+func (r *Renderer) policy(e *Explanation) string {
+	mode := Deny
+	if e.Mode {
+		mode = Allow
+	}
+	mode = strings.ToLower(mode)
+	global := true
+	labels := make([]string, 0)
+	for _, p := range e.Clause {
+		if p.value != Top {
+			global = false
+		}
+		labels = append(labels, r.Label(p.value))
+	}
+	if global {
+		return "the " + r.word("global "+mode)
+	}
+	return "the " + r.word(mode+" of") + " " + strings.Join(labels, " "+r.word("and")+" ")
+}
+
+// uses lists the labels of the annotation values of the attributes, or of all
+// the values if attrs is nil
+func (r *Renderer) uses(an Annotation, attrs []string) string {
+	labels := make([]string, 0)
+	for _, p := range an {
+		if (attrs == nil || contains(attrs, p.name)) && !contains(labels, r.Label(p.value)) {
+			labels = append(labels, r.Label(p.value))
+		}
+	}
+	switch len(labels) {
+	case 0:
+		return r.word("nothing")
+	case 1:
+		return labels[0]
+	default:
+		n := len(labels)
+		return strings.Join(labels[:n-1], ", ") + " " + r.word("together with") + " " + labels[n-1]
+	}
+}
+
+// attributesOf returns the attribute names of a clause
+func attributesOf(c Clause) []string {
+	attrs := make([]string, 0)
+	for _, p := range c {
+		if !contains(attrs, p.name) {
+			attrs = append(attrs, p.name)
+		}
+	}
+	return attrs
+}
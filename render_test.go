@@ -0,0 +1,97 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	pglobal := `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`
+	cases := []struct {
+		pstr string
+		astr string
+		want string
+	}{
+		{pglobal, "DataType IPAddress DataType AccountID",
+			"Denied because the program uses IPAddress together with AccountID, which the exception to the global allow forbids."},
+		{pglobal, "DataType IPAddress",
+			"Allowed because the program uses IPAddress, which the global allow allows."},
+		{"ALLOW DataType UniqueID", "DataType Location",
+			"Denied because the program uses Location, which the allow of UniqueID doesn't allow."},
+		{"DENY DataType Location", "DataType AccountID",
+			"Allowed because the program uses AccountID, which the deny of Location doesn't cover."},
+		{"DENY DataType UniqueID EXCEPT { ALLOW DataType AccountID }", "DataType AccountID",
+			"Allowed because the program uses AccountID, which the exception to the deny of UniqueID allows."},
+		{"DENY DataType UniqueID", "DataType AccountID DataType IPAddress DataType UniqueID",
+			"Denied because the program uses AccountID, IPAddress together with UniqueID, which the deny of UniqueID forbids."},
+	}
+	r := &Renderer{}
+	for _, c := range cases {
+		p := newScopedPolicy(t, c.pstr)
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		got, err := r.Render(p.Trace(an))
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got != c.want {
+			t.Errorf("Render [%q] on [%q] = %q, want %q", c.pstr, c.astr, got, c.want)
+		}
+	}
+}
+
+func TestRenderCustomized(t *testing.T) {
+	r := &Renderer{
+		Labels:    map[string]string{"IPAddress": "IP addresses", "AccountID": "account IDs"},
+		Templates: map[string]string{TemplateDenyExcept: "{{.Uses}} can't be combined ({{.Exception}})."},
+		Words:     map[string]string{"together with": "and"},
+	}
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	an, err := p.ParseAnnotation("DataType IPAddress DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	got, err := r.Render(p.Trace(an))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := "IP addresses and account IDs can't be combined (the deny of IP addresses and account IDs)."
+	if got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	r.Templates[TemplateDenyExcept] = "{{.Unknown}}"
+	if _, err := r.Render(p.Trace(an)); err == nil {
+		t.Errorf("Render() with an invalid template should fail")
+	}
+}
+
+func TestRenderWarnings(t *testing.T) {
+	r := &Renderer{Templates: map[string]string{
+		TemplateDeny:                          "Abgelehnt.",
+		TemplateWarning + ExpiredValueWarning: "{{.Attribute}} ist abgelaufen.",
+	}}
+	e := &Explanation{Mode: false, Matched: true, Decider: -1, Warnings: []Warning{
+		{ExpiredValueWarning, "Consent", "Consent Given expired at 2021-06-01T00:00:00Z and was dropped."},
+		{UnknownAttributeWarning, "Retention", "Retention is unknown to the policy and was ignored."},
+	}}
+	// the warnings without a template are left as they are
+	want := "Abgelehnt. Consent ist abgelaufen. Retention is unknown to the policy and was ignored."
+	for i := 0; i < 2; i++ {
+		if got, err := r.Render(e); err != nil || got != want {
+			t.Errorf("Render() = %q, %v, want %q", got, err, want)
+		}
+	}
+	// the templates are parsed once
+	if len(r.parsed) != 2 {
+		t.Errorf("Render() parsed %d templates, want 2", len(r.parsed))
+	}
+}
+
+func TestLabel(t *testing.T) {
+	r := &Renderer{Labels: map[string]string{"IPAddress": "IP address"}}
+	if got := r.Label("IPAddress:Hashed"); got != "IP address (Hashed)" {
+		t.Errorf("Label() = %q", got)
+	}
+}
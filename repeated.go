@@ -0,0 +1,59 @@
+package grok
+
+// RepeatedValues is how a policy interprets the repeated values of a lattice
+// attribute in annotations, e.g. DataType IPAddress DataType AccountID
+type RepeatedValues int
+
+const (
+	// AllValues means that the data contains every value, which is the
+	// semantics of the paper
+	AllValues RepeatedValues = iota
+	// JoinValues means that the data contains the join of the values, which
+	// is what some labelers mean when they emit every candidate label: the
+	// annotation above is then evaluated as DataType UniqueID
+	JoinValues
+)
+
+// repeatedOf returns how the repeated values of an attribute are interpreted
+func (p *Policy) repeatedOf(attr string) RepeatedValues {
+	if r, ok := p.RepeatedOf[attr]; ok {
+		return r
+	}
+	return p.Repeated
+}
+
+// JoinRepeated returns the annotation where the repeated values of the
+// lattice attributes interpreted as JoinValues are replaced by their join, at
+// the position of the first value, or an itself when there are none
+func (p *Policy) JoinRepeated(an Annotation) Annotation {
+	if p.Repeated == AllValues && len(p.RepeatedOf) == 0 {
+		return an
+	}
+	counts := make(map[string]int)
+	joined := false
+	for _, pa := range an {
+		counts[pa.name]++
+		if _, ok := p.baseOn[pa.name]; ok && counts[pa.name] > 1 && p.repeatedOf(pa.name) == JoinValues {
+			joined = true
+		}
+	}
+	if !joined {
+		return an
+	}
+	res := make(Annotation, 0, len(an))
+	first := make(map[string]int) // the position of the joined value of an attribute
+	for _, pa := range an {
+		l, ok := p.baseOn[pa.name]
+		if !ok || counts[pa.name] == 1 || p.repeatedOf(pa.name) != JoinValues {
+			res = append(res, pa)
+			continue
+		}
+		if i, ok := first[pa.name]; ok {
+			res[i].value = l.Join(res[i].value, pa.value)
+			continue
+		}
+		first[pa.name] = len(res)
+		res = append(res, pair{name: pa.name, value: pa.value})
+	}
+	return res
+}
@@ -0,0 +1,53 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestRepeatedValues(t *testing.T) {
+	pstr := "ALLOW DataType AccountID DataType IPAddress"
+	cases := []struct {
+		repeated   RepeatedValues
+		repeatedOf map[string]RepeatedValues
+		astr       string
+		allowed    bool
+	}{
+		{AllValues, nil, "DataType AccountID DataType IPAddress", true},
+		// the join of AccountID and IPAddress is UniqueID
+		{JoinValues, nil, "DataType AccountID DataType IPAddress", false},
+		{AllValues, map[string]RepeatedValues{"DataType": JoinValues}, "DataType AccountID DataType IPAddress", false},
+		{JoinValues, map[string]RepeatedValues{"DataType": AllValues}, "DataType AccountID DataType IPAddress", true},
+		{JoinValues, nil, "DataType AccountID DataType AccountID", true},
+		{JoinValues, nil, "DataType IPAddress", true},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, pstr)
+		p.Repeated, p.RepeatedOf = c.repeated, c.repeatedOf
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := p.ApplyOn(an); got != c.allowed {
+			t.Errorf("ApplyOn(%q) with %v, %v = %t, want %t", c.astr, c.repeated, c.repeatedOf, got, c.allowed)
+		}
+		if got := p.Trace(an).Allowed; got != c.allowed {
+			t.Errorf("Trace(%q) with %v, %v = %t, want %t", c.astr, c.repeated, c.repeatedOf, got, c.allowed)
+		}
+	}
+}
+
+func TestJoinRepeated(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	p.Repeated = JoinValues
+	if err := p.DefineNumeric(Epsilon); err != nil {
+		t.Fatalf("%q", err)
+	}
+	an, err := p.ParseAnnotation("Epsilon 1 DataType AccountID Epsilon 2 DataType IPAddress DataType Location")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	// numeric values aren't joined
+	if got := p.JoinRepeated(an).String(); got != "Epsilon 1 DataType TOP Epsilon 2" {
+		t.Errorf("JoinRepeated() = %q", got)
+	}
+}
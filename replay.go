@@ -0,0 +1,130 @@
+package grok
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a recorded decision. Records are stored in JSON lines files, one
+// record per line:
+//
+//	{"annotation":[["DataType","IPAddress"]],"policy":"p1","effect":"ALLOW","ts":"2020-06-01T00:00:00Z"}
+//
+// Replay files are shared by the analyses over past decisions (shadow
+// evaluation, coverage, what-if).
+type Record struct {
+	Annotation Annotation `json:"annotation"`
+	PolicyID   string     `json:"policy"`
+	Effect     string     `json:"effect"` // ALLOW or DENY
+	Timestamp  time.Time  `json:"ts"`
+	// WouldBe is the effect the decision would have without monitor mode,
+	// when it differs from Effect
+	WouldBe string `json:"would_be,omitempty"`
+	// Unknown are the attributes of the annotation unknown to the policy,
+	// when the policy flags them
+	Unknown []string `json:"unknown,omitempty"`
+	// Unclassified is true when the effect depended on Unknown values
+	Unclassified bool `json:"unclassified,omitempty"`
+	// Error is the error of the decision, e.g. ErrBudgetExceeded
+	Error string `json:"error,omitempty"`
+	// Bundle is the version of the bundle of the policy, for the decisions
+	// recorded by decision points
+	Bundle string `json:"bundle,omitempty"`
+}
+
+// EffectOf returns the effect of a decision, ALLOW or DENY
+func EffectOf(allowed bool) string {
+	if allowed {
+		return Allow
+	}
+	return Deny
+}
+
+// Allowed returns true when the recorded effect is ALLOW
+func (r Record) Allowed() bool {
+	return r.Effect == Allow
+}
+
+// RecordWriter writes records to a replay file. It is safe for concurrent
+// use, e.g. as the audit sink of concurrent evaluations.
+type RecordWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecordWriter returns a RecordWriter writing to w
+func NewRecordWriter(w io.Writer) *RecordWriter {
+	return &RecordWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes a record as one line
+func (w *RecordWriter) Write(r Record) error {
+	if r.Effect != Allow && r.Effect != Deny {
+		return errors.New(fmt.Sprintf("replay: %s is not a valid effect", r.Effect))
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(r)
+}
+
+// RecordReader reads records from a replay file
+type RecordReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// maxRecordSize is the maximum size of a line in a replay file
+const maxRecordSize = 1 << 20
+
+// NewRecordReader returns a RecordReader reading from r
+func NewRecordReader(r io.Reader) *RecordReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	return &RecordReader{s: s}
+}
+
+// Read returns the next record, or io.EOF at the end of the file. Blank lines
+// are skipped.
+func (r *RecordReader) Read() (Record, error) {
+	for r.s.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.s.Text())
+		if line == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return rec, errors.New(fmt.Sprintf("replay: line %d: %s", r.line, err))
+		}
+		if rec.Effect != Allow && rec.Effect != Deny {
+			return rec, errors.New(fmt.Sprintf("replay: line %d: %s is not a valid effect", r.line, rec.Effect))
+		}
+		return rec, nil
+	}
+	if err := r.s.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// ReadRecords reads all the records of a replay file
+func ReadRecords(r io.Reader) ([]Record, error) {
+	rr := NewRecordReader(r)
+	recs := make([]Record, 0)
+	for {
+		rec, err := rr.Read()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return recs, err
+		}
+		recs = append(recs, rec)
+	}
+}
@@ -0,0 +1,79 @@
+package grok
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClauseJSON(t *testing.T) {
+	c := Clause{{name: "DataType", value: "IPAddress"}, {name: "Purpose", value: "Analytics", compatWith: "CollectedFor"}}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := `[["DataType","IPAddress"],["Purpose","Analytics","CollectedFor"]]`
+	if string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+	var got Clause
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if len(got) != 2 || got[0] != c[0] || got[1] != c[1] {
+		t.Errorf("Unmarshal() = %v, want %v", got, c)
+	}
+	if err := json.Unmarshal([]byte(`[["DataType"]]`), &got); err == nil {
+		t.Errorf("Unmarshal() of a single-element pair should fail")
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	ts := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	recs := []Record{
+		{Annotation: Annotation{{name: "DataType", value: "IPAddress"}}, PolicyID: "p1", Effect: Allow, Timestamp: ts},
+		{Annotation: Annotation{{name: "DataType", value: "AccountID"}, {name: "Purpose", value: "Sharing"}},
+			PolicyID: "p2", Effect: Deny, Timestamp: ts.Add(time.Second)},
+	}
+	var buf bytes.Buffer
+	w := NewRecordWriter(&buf)
+	for _, r := range recs {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("%q", err)
+		}
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("lines = %d, want 2", n)
+	}
+	got, err := ReadRecords(&buf)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if len(got) != 2 || got[1].PolicyID != "p2" || got[1].Allowed() || !got[1].Timestamp.Equal(recs[1].Timestamp) ||
+		got[1].Annotation.ValuesOf("Purpose")[0] != "Sharing" {
+		t.Errorf("ReadRecords() = %+v, want %+v", got, recs)
+	}
+	if err := w.Write(Record{Effect: "MAYBE"}); err == nil {
+		t.Errorf("Write() with an invalid effect should fail")
+	}
+}
+
+func TestReadRecordsErrors(t *testing.T) {
+	cases := []string{
+		"{\"annotation\":[],\"policy\":\"p\",\"effect\":\"ALLOW\",\"ts\":\"2020-06-01T00:00:00Z\"}\n\nnot json\n",
+		"{\"annotation\":[],\"policy\":\"p\",\"effect\":\"MAYBE\"}\n",
+	}
+	for _, c := range cases {
+		if _, err := ReadRecords(strings.NewReader(c)); err == nil {
+			t.Errorf("ReadRecords(%q) should fail", c)
+		}
+	}
+}
+
+func TestEffectOf(t *testing.T) {
+	if EffectOf(ALLOW) != Allow || EffectOf(DENY) != Deny {
+		t.Errorf("EffectOf() is wrong")
+	}
+}
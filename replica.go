@@ -0,0 +1,183 @@
+package grok
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ReplicaEntry is the state of a bundle at a replica
+type ReplicaEntry struct {
+	// Version is the version of the bundle, which the control plane increases
+	// on every publication
+	Version uint64 `json:"version"`
+	// Seen is the last time the control plane vouched for the version, when
+	// it published it or confirmed it since
+	Seen time.Time `json:"seen"`
+	// Policies are the snapshots of the policies of the bundle (see
+	// WriteSnapshot)
+	Policies []json.RawMessage `json:"policies"`
+}
+
+// ReplicaState is the state of the bundles of a replica by name, that
+// replicas exchange over any transport to converge, e.g. in JSON
+type ReplicaState struct {
+	Bundles map[string]ReplicaEntry `json:"bundles"`
+}
+
+// ReplicaDecision is the decision of a bundle cached by a replica
+type ReplicaDecision struct {
+	Allowed bool
+	// Version is the version of the bundle that decided
+	Version uint64
+	// Denying are the IDs of the policies that deny the annotation
+	Denying []string
+	// Staleness bounds how out of date the version may be: the time since the
+	// control plane last vouched for it
+	Staleness time.Duration
+	// Stale is true when the staleness exceeds the MaxStaleness of the replica
+	Stale bool
+}
+
+// PolicyReplica caches the bundles of policies of an edge enforcement point,
+// which keeps deciding from its cache while it's partitioned from the control
+// plane. Replicas converge by merging the states of one another, in any order
+// and any number of times: the state of a bundle is a last-writer-wins
+// register keyed by version, whose Seen times are max registers, so that
+// staleness bounds propagate with the gossip too. It is safe for concurrent
+// use.
+type PolicyReplica struct {
+	// MaxStaleness is the staleness beyond which decisions are stale, never
+	// when it's 0
+	MaxStaleness time.Duration
+	// Now is the clock of the replica, time.Now when it's nil
+	Now func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]ReplicaEntry
+	// sets are the policy sets of the entries, read from their snapshots
+	sets map[string]*PolicySet
+}
+
+// NewPolicyReplica returns an empty PolicyReplica
+func NewPolicyReplica(maxStaleness time.Duration) *PolicyReplica {
+	return &PolicyReplica{MaxStaleness: maxStaleness, entries: make(map[string]ReplicaEntry),
+		sets: make(map[string]*PolicySet)}
+}
+
+// Publish publishes a version of a bundle, at the control plane. The version
+// must be greater than the version of the bundle the replica has.
+func (r *PolicyReplica) Publish(bundle string, version uint64, s *PolicySet) error {
+	e := ReplicaEntry{Version: version, Seen: r.now(), Policies: make([]json.RawMessage, 0)}
+	for _, p := range s.policies() {
+		var buf bytes.Buffer
+		if err := p.WriteSnapshot(&buf); err != nil {
+			return err
+		}
+		e.Policies = append(e.Policies, json.RawMessage(bytes.TrimSpace(buf.Bytes())))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.entries[bundle]; ok && old.Version >= version {
+		return errors.New(fmt.Sprintf("policy: bundle %s is already at version %d", bundle, old.Version))
+	}
+	r.entries[bundle], r.sets[bundle] = e, s
+	return nil
+}
+
+// Confirm vouches for the version of a bundle the replica has, at the control
+// plane, which resets its staleness
+func (r *PolicyReplica) Confirm(bundle string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[bundle]
+	if !ok {
+		return errors.New(fmt.Sprintf("policy: no bundle %s", bundle))
+	}
+	if now := r.now(); now.After(e.Seen) {
+		e.Seen = now
+	}
+	r.entries[bundle] = e
+	return nil
+}
+
+// State returns the state of the replica, to be merged into the other replicas
+func (r *PolicyReplica) State() ReplicaState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s := ReplicaState{Bundles: make(map[string]ReplicaEntry, len(r.entries))}
+	for name, e := range r.entries {
+		s.Bundles[name] = e
+	}
+	return s
+}
+
+// Merge merges the state of another replica: the greater version of every
+// bundle wins, and the later Seen time of equal versions. Equal versions with
+// different policies, which a control plane doesn't publish, are resolved by
+// digest so that replicas still converge.
+func (r *PolicyReplica) Merge(s ReplicaState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, e := range s.Bundles {
+		old, ok := r.entries[name]
+		if ok && !wins(e, old) {
+			continue
+		}
+		if !ok || e.Version != old.Version || digest(e.Policies) != digest(old.Policies) {
+			set := NewPolicySet()
+			for _, raw := range e.Policies {
+				p, err := ReadSnapshot(bytes.NewReader(raw))
+				if err != nil {
+					return errors.New(fmt.Sprintf("policy: bundle %s version %d: %s", name, e.Version, err))
+				}
+				set.Add(p)
+			}
+			r.sets[name] = set
+		}
+		r.entries[name] = e
+	}
+	return nil
+}
+
+// wins returns true when an entry replaces another in a merge
+func wins(e, old ReplicaEntry) bool {
+	if e.Version != old.Version {
+		return e.Version > old.Version
+	}
+	if d, o := digest(e.Policies), digest(old.Policies); d != o {
+		return d > o
+	}
+	return e.Seen.After(old.Seen)
+}
+
+// Evaluate applies the policies of the cached version of a bundle on an
+// annotation. The annotation is allowed when every policy allows it. The
+// decision carries the staleness of the version, and is made even when the
+// version is stale: enforcement points that fail closed deny stale decisions.
+func (r *PolicyReplica) Evaluate(bundle string, an Annotation) (ReplicaDecision, error) {
+	r.mu.RLock()
+	e, ok := r.entries[bundle]
+	s := r.sets[bundle]
+	r.mu.RUnlock()
+	if !ok {
+		return ReplicaDecision{}, errors.New(fmt.Sprintf("policy: no bundle %s", bundle))
+	}
+	d := ReplicaDecision{Version: e.Version, Denying: s.DenyingIDs(an), Staleness: r.now().Sub(e.Seen)}
+	if d.Staleness < 0 {
+		d.Staleness = 0
+	}
+	d.Allowed = len(d.Denying) == 0
+	d.Stale = r.MaxStaleness > 0 && d.Staleness > r.MaxStaleness
+	return d, nil
+}
+
+func (r *PolicyReplica) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,111 @@
+package grok
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPolicyReplica(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	replica := func() *PolicyReplica {
+		r := NewPolicyReplica(time.Minute)
+		r.Now = clock
+		return r
+	}
+	set := func(id, pstr string) *PolicySet {
+		p := newScopedPolicy(t, pstr)
+		p.ID = id
+		return NewPolicySet(p)
+	}
+	control, edge1, edge2 := replica(), replica(), replica()
+	an, err := newScopedPolicy(t, "ALLOW DataType TOP").ParseAnnotation("DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if err := control.Publish("web", 1, set("open", "ALLOW DataType TOP")); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := control.Publish("web", 1, set("open", "ALLOW DataType TOP")); err == nil {
+		t.Errorf("Publish() should fail when the version isn't greater")
+	}
+	if _, err := edge1.Evaluate("web", an); err == nil {
+		t.Errorf("Evaluate() should fail on a bundle the replica doesn't have")
+	}
+	if err := edge1.Merge(control.State()); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if d, err := edge1.Evaluate("web", an); err != nil || !d.Allowed || d.Version != 1 || d.Stale {
+		t.Errorf("Evaluate() = %v, %v, want allowed by version 1", d, err)
+	}
+
+	// edge1 is partitioned from the control plane, which publishes version 2
+	// and reaches edge2 only
+	now = now.Add(2 * time.Minute)
+	if err := control.Publish("web", 2, set("no-accounts", "DENY DataType AccountID")); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := edge2.Merge(control.State()); err != nil {
+		t.Fatalf("%q", err)
+	}
+	d, err := edge1.Evaluate("web", an)
+	if err != nil || !d.Allowed || d.Version != 1 || !d.Stale || d.Staleness != 2*time.Minute {
+		t.Errorf("Evaluate() = %v, %v, want allowed by version 1, stale by 2m", d, err)
+	}
+	d, err = edge2.Evaluate("web", an)
+	if err != nil || d.Allowed || d.Version != 2 || d.Stale || !equals(d.Denying, []string{"no-accounts"}) {
+		t.Errorf("Evaluate() = %v, %v, want denied by version 2", d, err)
+	}
+
+	// the partition heals: edge1 and edge2 gossip, in both orders, and
+	// through JSON
+	b, err := json.Marshal(edge2.State())
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	var s ReplicaState
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := edge1.Merge(s); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := edge2.Merge(edge1.State()); err != nil {
+		t.Fatalf("%q", err)
+	}
+	for i, r := range []*PolicyReplica{edge1, edge2} {
+		if d, err := r.Evaluate("web", an); err != nil || d.Allowed || d.Version != 2 || d.Stale {
+			t.Errorf("edge%d Evaluate() = %v, %v, want denied by version 2", i+1, d, err)
+		}
+	}
+
+	// confirmations reset the staleness on the replicas they reach
+	now = now.Add(5 * time.Minute)
+	if err := control.Confirm("web"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := edge1.Merge(control.State()); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if d, _ := edge1.Evaluate("web", an); d.Stale || d.Staleness != 0 {
+		t.Errorf("Evaluate() = %v, want fresh after the confirmation", d)
+	}
+	if d, _ := edge2.Evaluate("web", an); !d.Stale || d.Staleness != 5*time.Minute {
+		t.Errorf("Evaluate() = %v, want stale by 5m", d)
+	}
+	if err := control.Confirm("mobile"); err == nil {
+		t.Errorf("Confirm() should fail on a bundle the replica doesn't have")
+	}
+}
+
+func TestPolicyReplicaMergeInvalid(t *testing.T) {
+	r := NewPolicyReplica(0)
+	s := ReplicaState{Bundles: map[string]ReplicaEntry{
+		"web": {Version: 1, Policies: []json.RawMessage{json.RawMessage(`{"version": 0}`)}},
+	}}
+	if err := r.Merge(s); err == nil {
+		t.Errorf("Merge() should fail on invalid snapshots")
+	}
+}
@@ -0,0 +1,169 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Placement is the place of an element in a lattice: the elements right above
+// it and right below it
+type Placement struct {
+	Parents, Children []string
+}
+
+// ElementResolver looks up the elements that the lattices of a policy don't
+// define, e.g. in a central taxonomy service, so that teams can reference
+// newly added global elements before their lattices are updated
+type ElementResolver interface {
+	// Resolve returns the placement of an element in a lattice, and false
+	// when the element is unknown to the resolver too
+	Resolve(lattice, element string) (Placement, bool, error)
+}
+
+// ResolverChain resolves elements with the first of its resolvers that knows
+// them
+type ResolverChain []ElementResolver
+
+// Resolve returns the placement of the first resolver that knows the element
+func (c ResolverChain) Resolve(lattice, element string) (Placement, bool, error) {
+	for _, r := range c {
+		pl, ok, err := r.Resolve(lattice, element)
+		if err != nil || ok {
+			return pl, ok, err
+		}
+	}
+	return Placement{}, false, nil
+}
+
+// LatticeResolver resolves elements in secondary lattices, by the name of the
+// lattices
+type LatticeResolver []*Lattice
+
+// Resolve returns the placement of an element in the secondary lattice of the
+// same name
+func (ls LatticeResolver) Resolve(lattice, element string) (Placement, bool, error) {
+	for _, l := range ls {
+		if l.Name == lattice && l.hasElement(element) {
+			return Placement{Parents: l.parentsOf([]string{element}), Children: l.childrenOf([]string{element})}, true, nil
+		}
+	}
+	return Placement{}, false, nil
+}
+
+// CachingResolver caches the placements of a resolver, including the elements
+// it doesn't know, so that a remote taxonomy is looked up once per element.
+// Errors aren't cached. It is safe for concurrent use.
+type CachingResolver struct {
+	r          ElementResolver
+	mu         sync.Mutex
+	placements map[[2]string]*Placement
+}
+
+// NewCachingResolver returns a CachingResolver of a resolver
+func NewCachingResolver(r ElementResolver) *CachingResolver {
+	return &CachingResolver{r: r, placements: make(map[[2]string]*Placement)}
+}
+
+// Resolve returns the cached placement of an element, and resolves it when it
+// isn't cached
+func (c *CachingResolver) Resolve(lattice, element string) (Placement, bool, error) {
+	key := [2]string{lattice, element}
+	c.mu.Lock()
+	pl, cached := c.placements[key]
+	c.mu.Unlock()
+	if cached {
+		if pl == nil {
+			return Placement{}, false, nil
+		}
+		return *pl, true, nil
+	}
+
+	resolved, ok, err := c.r.Resolve(lattice, element)
+	if err != nil {
+		return resolved, ok, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ok {
+		c.placements[key] = &resolved
+	} else {
+		c.placements[key] = nil
+	}
+	return resolved, ok, nil
+}
+
+// AddElement adds an element to the lattice right below its parents and right
+// above its children. The parents and children that the lattice doesn't
+// define are ignored, and the element is placed below TOP (or above BOTTOM)
+// when none is left. A lattice must not be modified while it's evaluated.
+func (l *Lattice) AddElement(e string, pl Placement) error {
+	if l.hasElement(e) {
+		return errors.New(fmt.Sprintf("policy: %s is already an element of lattice %s", e, l.Name))
+	}
+	parents := filter(pl.Parents, l.hasElement)
+	if len(parents) == 0 {
+		parents = []string{Top}
+	}
+	children := filter(pl.Children, l.hasElement)
+	if len(children) == 0 {
+		children = []string{Bottom}
+	}
+	for _, p := range parents {
+		for _, c := range children {
+			if p == Bottom || c == Top || (p != Top && c != Bottom && !l.Precede(c, p)) {
+				return errors.New(fmt.Sprintf("policy: %s can't be placed below %s and above %s in lattice %s", e, p, c, l.Name))
+			}
+		}
+	}
+
+	edges := append(make([]Edge, 0, len(l.Edges)+len(parents)+len(children)), l.Edges...)
+	for _, p := range parents {
+		edges = append(edges, Edge{p, e})
+	}
+	for _, c := range children {
+		edges = append(edges, Edge{e, c})
+	}
+	l.Edges = edges
+	l.indexEdges()
+	// the compiled closure doesn't know the element
+	if l.Compiled() {
+		l.compiled.Store((*closure)(nil))
+	}
+	return nil
+}
+
+// resolveElements resolves the elements of the lattice values of the policy
+// tokens that the lattices don't define, and adds them to the lattices
+func (p *Policy) resolveElements(ts []string) error {
+	for i := 0; i+1 < len(ts); i++ {
+		l, ok := p.baseOn[ts[i]]
+		if !ok {
+			continue
+		}
+		members := []string{ts[i+1]}
+		if _, ms, ok := parseValueSet(ts[i+1]); ok {
+			members = ms
+		}
+		for _, m := range members {
+			if l.isProductValue(m) {
+				m, _ = l.halve(m)
+			}
+			if m = baseOf(m); l.hasElement(m) {
+				continue
+			}
+			pl, ok, err := p.Resolver.Resolve(l.Name, m)
+			if err != nil {
+				return errors.New(fmt.Sprintf("policy: resolving %s of lattice %s: %s", m, l.Name, err))
+			}
+			if !ok {
+				continue
+			}
+			if err := l.AddElement(m, pl); err != nil {
+				return err
+			}
+		}
+		i++
+	}
+	return nil
+}
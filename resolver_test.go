@@ -0,0 +1,125 @@
+package grok
+
+import (
+	"errors"
+	"testing"
+)
+
+// countingResolver counts the lookups of a resolver, and fails when err is set
+type countingResolver struct {
+	r       ElementResolver
+	lookups int
+	err     error
+}
+
+func (c *countingResolver) Resolve(lattice, element string) (Placement, bool, error) {
+	c.lookups++
+	if c.err != nil {
+		return Placement{}, false, c.err
+	}
+	return c.r.Resolve(lattice, element)
+}
+
+var taxonomy = LatticeResolver{NewLattice(`{ "name": "DataType",
+	"edges": {
+		"UniqueID": ["AccountID", "IPAddress", "DeviceID"],
+		"Location": ["IPAddress"] }
+	}`)}
+
+func TestResolveElements(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	p.Resolver = taxonomy
+	if err := p.ParsePolicy("ALLOW DataType UniqueID EXCEPT { DENY DataType DeviceID }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	cases := []struct {
+		astr    string
+		allowed bool
+	}{
+		{"DataType AccountID", true},
+		{"DataType DeviceID", false},
+		{"DataType Location", false},
+	}
+	for _, c := range cases {
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := p.ApplyOn(an); got != c.allowed {
+			t.Errorf("ApplyOn(%q) = %t, want %t", c.astr, got, c.allowed)
+		}
+	}
+	if err := p.ParsePolicy("ALLOW DataType Unknown"); err == nil || err.Error() != "policy: Unknown is not a valid value in lattice DataType" {
+		t.Errorf("ParsePolicy() with an unknown element = %v", err)
+	}
+}
+
+func TestResolverChain(t *testing.T) {
+	regional := LatticeResolver{NewLattice(`{ "name": "DataType", "edges": { "Location": ["PostalCode"] } }`)}
+	r := ResolverChain{regional, taxonomy}
+	cases := []struct {
+		element string
+		ok      bool
+		parents []string
+	}{
+		{"PostalCode", true, []string{"Location"}},
+		{"DeviceID", true, []string{"UniqueID"}},
+		{"Unknown", false, nil},
+	}
+	for _, c := range cases {
+		pl, ok, err := r.Resolve("DataType", c.element)
+		if err != nil || ok != c.ok || !equals(pl.Parents, c.parents) && ok {
+			t.Errorf("Resolve(%s) = %v, %t, %v", c.element, pl, ok, err)
+		}
+	}
+}
+
+func TestCachingResolver(t *testing.T) {
+	counting := &countingResolver{r: taxonomy, err: errors.New("unavailable")}
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	p.Resolver = NewCachingResolver(counting)
+	want := "policy: resolving DeviceID of lattice DataType: unavailable"
+	if err := p.ParsePolicy("DENY DataType DeviceID"); err == nil || err.Error() != want {
+		t.Errorf("ParsePolicy() = %v, want %q", err, want)
+	}
+	counting.err = nil
+	for i := 0; i < 2; i++ {
+		if err := p.ParsePolicy("DENY DataType Unknown"); err == nil {
+			t.Errorf("ParsePolicy() with an unknown element = nil error")
+		}
+	}
+	// errors aren't cached, misses are
+	if counting.lookups != 2 {
+		t.Errorf("lookups = %d, want 2", counting.lookups)
+	}
+}
+
+func TestAddElement(t *testing.T) {
+	l := NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	l.Compile()
+	if err := l.AddElement("DeviceID", Placement{Parents: []string{"UniqueID", "Unknown"}}); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if l.Compiled() || !l.Precede("DeviceID", "UniqueID") || l.Precede("DeviceID", "Location") || l.Meet("DeviceID", "AccountID") != Bottom {
+		t.Errorf("DeviceID isn't right below UniqueID")
+	}
+	cases := []struct {
+		element string
+		pl      Placement
+		err     string
+	}{
+		{"DeviceID", Placement{}, "policy: DeviceID is already an element of lattice DataType"},
+		{"Subnet", Placement{Parents: []string{"Location"}, Children: []string{"AccountID"}},
+			"policy: Subnet can't be placed below Location and above AccountID in lattice DataType"},
+		{"Subnet", Placement{Parents: []string{"Location"}, Children: []string{"IPAddress"}}, ""},
+	}
+	for _, c := range cases {
+		err := l.AddElement(c.element, c.pl)
+		if (err == nil) != (c.err == "") || (err != nil && err.Error() != c.err) {
+			t.Errorf("AddElement(%s, %v) = %v, want %q", c.element, c.pl, err, c.err)
+		}
+	}
+	if !l.Precede("IPAddress", "Subnet") || !l.Precede("Subnet", "Location") {
+		t.Errorf("Subnet isn't between IPAddress and Location")
+	}
+}
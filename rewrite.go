@@ -0,0 +1,202 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Operators of logical plans that grok knows
+const (
+	// ScanOp reads a source, whose columns are annotated
+	ScanOp = "scan"
+	// MaskOp brings a column into a state, when no operator of the engine
+	// maps to the state
+	MaskOp = "mask"
+)
+
+// Verdicts of query rewrites
+const (
+	PlanApproved  = "approved"
+	PlanRewritten = "rewritten"
+	PlanDenied    = "denied"
+)
+
+// PlanNode is an operator of the logical plan of a query, as a query engine
+// hands it to grok
+type PlanNode struct {
+	// Op is the operator, e.g. scan, join, project or aggregate
+	Op string `json:"op"`
+	// Source is the source that a scan reads, and Columns the annotations of
+	// its columns
+	Source  string                `json:"source,omitempty"`
+	Columns map[string]Annotation `json:"columns,omitempty"`
+	// Column is the column that the operator transforms, all of them when
+	// it's empty, and Transform the state it brings them into when the
+	// operator is inserted by a rewrite
+	Column    string      `json:"column,omitempty"`
+	Transform string      `json:"transform,omitempty"`
+	Inputs    []*PlanNode `json:"inputs,omitempty"`
+}
+
+// RewriteResult is the result of the rewrite of a plan
+type RewriteResult struct {
+	// Verdict is PlanApproved, PlanRewritten or PlanDenied
+	Verdict string `json:"verdict"`
+	// Plan is the rewritten plan, with masking operators inserted above the
+	// scans, or the plan itself when it's approved
+	Plan *PlanNode `json:"plan,omitempty"`
+	// Explanation explains a denial
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// QueryRewriter rewrites the logical plans of a query engine according to a
+// policy
+type QueryRewriter interface {
+	Rewrite(plan *PlanNode) (RewriteResult, error)
+}
+
+// PlanRewriter is the QueryRewriter of a policy. The output of a plan is
+// annotated by the annotations of its columns, which flow from the scans
+// through the operators: an operator mapped to a transformer brings the
+// columns it transforms into the state of the transformer, e.g. aggregate
+// into Aggregated, and the other operators pass them on. A denied output is
+// rewritten with the least masking that gets it allowed (see PlanMasking).
+type PlanRewriter struct {
+	Policy *Policy
+	// Transformers map the operators of the engine to the states they bring
+	// their columns into, e.g. "aggregate": "Aggregated", "sha256": "Hashed"
+	Transformers map[string]string
+	// Renderer renders the explanations of denials, a default Renderer when
+	// it's nil
+	Renderer *Renderer
+}
+
+// NewPlanRewriter returns the rewriter of a policy with the transformers of
+// an engine
+func NewPlanRewriter(p *Policy, transformers map[string]string) *PlanRewriter {
+	return &PlanRewriter{Policy: p, Transformers: transformers}
+}
+
+// Rewrite approves a plan, rewrites it, or denies it with an explanation
+func (r *PlanRewriter) Rewrite(plan *PlanNode) (RewriteResult, error) {
+	columns, err := r.columns(plan)
+	if err != nil {
+		return RewriteResult{}, err
+	}
+	mp := r.Policy.PlanMasking(columns)
+	switch {
+	case mp.Allowed && len(mp.Masks) == 0:
+		return RewriteResult{Verdict: PlanApproved, Plan: plan}, nil
+	case mp.Allowed:
+		masks := make(map[string]string)
+		for _, m := range mp.Masks {
+			masks[m.Column] = m.Transform
+		}
+		return RewriteResult{Verdict: PlanRewritten, Plan: r.insert(plan, masks)}, nil
+	}
+	rd := r.Renderer
+	if rd == nil {
+		rd = &Renderer{}
+	}
+	an := make(Annotation, 0)
+	for _, c := range sortedColumns(columns) {
+		an = append(an, columns[c]...)
+	}
+	text, err := rd.Render(r.Policy.Trace(an))
+	if err != nil {
+		return RewriteResult{}, err
+	}
+	return RewriteResult{Verdict: PlanDenied, Explanation: text}, nil
+}
+
+// columns returns the annotations of the columns of the output of a plan
+func (r *PlanRewriter) columns(n *PlanNode) (map[string]Annotation, error) {
+	if n == nil {
+		return nil, errors.New("rewrite: the plan should not be empty")
+	}
+	if n.Op == ScanOp {
+		if len(n.Inputs) > 0 {
+			return nil, errors.New(fmt.Sprintf("rewrite: scan of %s should have no inputs", n.Source))
+		}
+		res := make(map[string]Annotation, len(n.Columns))
+		for c, an := range n.Columns {
+			res[c] = append(Annotation{}, an...)
+		}
+		return res, nil
+	}
+	if len(n.Inputs) == 0 {
+		return nil, errors.New(fmt.Sprintf("rewrite: operator %s should have inputs", n.Op))
+	}
+	res := make(map[string]Annotation)
+	for _, in := range n.Inputs {
+		cs, err := r.columns(in)
+		if err != nil {
+			return nil, err
+		}
+		for c, an := range cs {
+			res[c] = append(res[c], an...)
+		}
+	}
+	t, ok := r.Transformers[n.Op]
+	if n.Transform != "" {
+		t, ok = n.Transform, true
+	}
+	if !ok {
+		return res, nil
+	}
+	for c, an := range res {
+		if n.Column != "" && c != n.Column {
+			continue
+		}
+		for i := range an {
+			an[i].value = r.Policy.mask(an[i], t)
+		}
+	}
+	return res, nil
+}
+
+// insert returns a copy of the plan with the masks of columns inserted above
+// the scans of the columns
+func (r *PlanRewriter) insert(n *PlanNode, masks map[string]string) *PlanNode {
+	if n.Op != ScanOp {
+		cp := *n
+		cp.Inputs = make([]*PlanNode, 0, len(n.Inputs))
+		for _, in := range n.Inputs {
+			cp.Inputs = append(cp.Inputs, r.insert(in, masks))
+		}
+		return &cp
+	}
+	res := n
+	for _, c := range sortedColumns(n.Columns) {
+		if t, ok := masks[c]; ok {
+			res = &PlanNode{Op: r.operatorOf(t), Column: c, Transform: t, Inputs: []*PlanNode{res}}
+		}
+	}
+	return res
+}
+
+// operatorOf returns the operator of the engine that brings columns into a
+// state, the first one by name, or MaskOp
+func (r *PlanRewriter) operatorOf(t string) string {
+	ops := make([]string, 0, len(r.Transformers))
+	for op, s := range r.Transformers {
+		if s == t {
+			ops = append(ops, op)
+		}
+	}
+	if len(ops) == 0 {
+		return MaskOp
+	}
+	sort.Strings(ops)
+	return ops[0]
+}
+
+func sortedColumns(columns map[string]Annotation) []string {
+	cs := make([]string, 0, len(columns))
+	for c := range columns {
+		cs = append(cs, c)
+	}
+	sort.Strings(cs)
+	return cs
+}
@@ -0,0 +1,91 @@
+package grok
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPlanRewriter(t *testing.T) {
+	dt := NewLattice(`{ "name": "DataType", "edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"] } }`)
+	dt.Product(NewLattice(`{ "name": "TypeState", "edges": { "Encrypted": [], "Hashed": [], "Truncated": ["Redacted"] } }`))
+	var plan PlanNode
+	err := json.Unmarshal([]byte(`{"op": "join", "inputs": [
+		{"op": "scan", "source": "clicks", "columns": {"ip": [["DataType", "IPAddress"]]}},
+		{"op": "project", "inputs": [
+			{"op": "scan", "source": "accounts", "columns": {"account": [["DataType", "AccountID"]]}}
+		]}
+	]}`), &plan)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	cases := []struct {
+		pstr    string
+		verdict string
+		plan    string
+	}{
+		{"ALLOW DataType TOP", PlanApproved, "join(scan clicks, project(scan accounts))"},
+		{"ALLOW DataType IPAddress:Truncated DataType AccountID:Hashed", PlanRewritten,
+			"join(mask ip Truncated(scan clicks), project(sha256 account Hashed(scan accounts)))"},
+		{"DENY DataType IPAddress", PlanDenied, ""},
+	}
+	for _, c := range cases {
+		p := NewPolicy([]*Lattice{dt})
+		if err := p.ParsePolicy(c.pstr); err != nil {
+			t.Fatalf("%q", err)
+		}
+		r := NewPlanRewriter(p, map[string]string{"sha256": "Hashed", "aggregate": "Aggregated"})
+		res, err := r.Rewrite(&plan)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if res.Verdict != c.verdict || planString(res.Plan) != c.plan {
+			t.Errorf("Rewrite() [%q] = %s %s, want %s %s", c.pstr, res.Verdict, planString(res.Plan), c.verdict, c.plan)
+		}
+		if c.verdict == PlanDenied && res.Explanation == "" {
+			t.Errorf("Rewrite() [%q] should explain the denial", c.pstr)
+		}
+		// a rewritten plan is approved
+		if c.verdict == PlanRewritten {
+			if again, err := r.Rewrite(res.Plan); err != nil || again.Verdict != PlanApproved {
+				t.Errorf("Rewrite() of the rewritten plan = %v, %q", again, err)
+			}
+		}
+	}
+	if planString(&plan) != "join(scan clicks, project(scan accounts))" {
+		t.Errorf("Rewrite() modified the plan: %s", planString(&plan))
+	}
+
+	p := NewPolicy([]*Lattice{dt})
+	p.ParsePolicy("ALLOW DataType TOP")
+	bad := []*PlanNode{nil, {Op: "join"}, {Op: ScanOp, Inputs: []*PlanNode{{Op: ScanOp}}}}
+	for _, b := range bad {
+		if _, err := NewPlanRewriter(p, nil).Rewrite(b); err == nil {
+			t.Errorf("Rewrite(%v) should fail", b)
+		}
+	}
+}
+
+// planString returns a plan in one line, e.g. join(scan a, scan b)
+func planString(n *PlanNode) string {
+	if n == nil {
+		return ""
+	}
+	s := n.Op
+	switch {
+	case n.Source != "":
+		s += " " + n.Source
+	case n.Transform != "":
+		s += " " + n.Column + " " + n.Transform
+	}
+	if len(n.Inputs) == 0 {
+		return s
+	}
+	s += "("
+	for i, in := range n.Inputs {
+		if i > 0 {
+			s += ", "
+		}
+		s += planString(in)
+	}
+	return s + ")"
+}
@@ -0,0 +1,136 @@
+package grok
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// AnnotationSchema declares the attributes that annotations must (or may)
+// carry, so that datasets missing a label are caught when their annotations
+// are parsed rather than silently evaluated. A schema is parsed from JSON:
+//
+//	{
+//	 "attributes": {
+//	     "DataType": { "required": true, "max": 5 },
+//	     "Purpose":  { "required": true, "max": 1 },
+//	     "Epsilon":  { "max": 1 }
+//	 },
+//	 "closed": true
+//	}
+//
+// where a closed schema rejects the attributes it doesn't declare.
+type AnnotationSchema struct {
+	Attributes map[string]AttributeRule `json:"attributes"`
+	Closed     bool                     `json:"closed"`
+}
+
+// AttributeRule is the rule of an attribute in an AnnotationSchema. Min and Max
+// bound the number of values of the attribute, where 0 means no bound; a
+// required attribute has at least one value. An ANYOF set counts as one value.
+// A recommended attribute may be missing, which decisions warn about (see
+// Decision.Warnings).
+type AttributeRule struct {
+	Required    bool `json:"required"`
+	Recommended bool `json:"recommended"`
+	Min         int  `json:"min"`
+	Max         int  `json:"max"`
+}
+
+// NewAnnotationSchema returns an AnnotationSchema that is parsed from a string
+func NewAnnotationSchema(str string) (*AnnotationSchema, error) {
+	s := new(AnnotationSchema)
+	if err := json.Unmarshal([]byte(str), s); err != nil {
+		return nil, err
+	}
+	for name, r := range s.Attributes {
+		if r.Min < 0 || r.Max < 0 || (r.Max > 0 && r.Min > r.Max) {
+			return nil, errors.New(fmt.Sprintf("schema: %s has invalid cardinality bounds", name))
+		}
+	}
+	return s, nil
+}
+
+// Validate returns an error when the annotation doesn't conform to the schema
+func (s *AnnotationSchema) Validate(an Annotation) error {
+	counts := make(map[string]int)
+	for _, pa := range an {
+		counts[pa.name]++
+	}
+	names := make([]string, 0, len(s.Attributes))
+	for name := range s.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r, n := s.Attributes[name], counts[name]
+		min := r.Min
+		if r.Required && min < 1 {
+			min = 1
+		}
+		switch {
+		case n == 0 && min > 0:
+			return errors.New(fmt.Sprintf("schema: %s is required", name))
+		case n < min:
+			return errors.New(fmt.Sprintf("schema: %s should have at least %d values", name, min))
+		case r.Max > 0 && n > r.Max:
+			return errors.New(fmt.Sprintf("schema: %s should have at most %d values", name, r.Max))
+		}
+	}
+	if s.Closed {
+		for _, pa := range an {
+			if _, ok := s.Attributes[pa.name]; !ok {
+				return errors.New(fmt.Sprintf("schema: %s isn't declared", pa.name))
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateAnnotation returns an error when an annotation that wasn't parsed
+// by the policy, e.g. read from JSON, isn't valid: when its values aren't
+// valid (or are ALLOF sets that weren't expanded), when it has unknown
+// attributes that the policy rejects, or when it doesn't conform to the
+// schema of the policy, if any.
+func (p *Policy) ValidateAnnotation(an Annotation) error {
+	if err := p.validateValues(Clause(an), true); err != nil {
+		return err
+	}
+	if err := checkAlternatives(an); err != nil {
+		return err
+	}
+	if p.Schema != nil {
+		return p.Schema.Validate(an)
+	}
+	return nil
+}
+
+// validateValues returns an error when a value of a clause, or of an
+// annotation whose numeric values are numbers rather than predicates, isn't
+// valid
+func (p *Policy) validateValues(c Clause, annotation bool) error {
+	for _, pa := range c {
+		var err error
+		switch {
+		case p.isNumeric(pa.name) && annotation:
+			_, err = p.numberValue(pa.value, pa.name)
+		case p.isNumeric(pa.name):
+			_, err = p.NumericValue(pa.value, pa.name)
+		case p.isCompatibility(pa.name):
+			_, err = p.CompatibilityValue(pa.value, pa.name)
+		case p.isAttribute(pa.name):
+			// an ALLOF set stands for several pairs, which apply doesn't expand
+			var ps []pair
+			if ps, err = p.latticeValues(pa.value, pa.name); err == nil && len(ps) > 1 {
+				err = errors.New(fmt.Sprintf("policy: %s should be expanded into a pair per element", pa.value))
+			}
+		case p.Unknown == RejectUnknown:
+			_, err = p.LatticeName(pa.name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package grok
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewAnnotationSchema(t *testing.T) {
+	for _, str := range []string{
+		`{"attributes": {"DataType": {"min": 2, "max": 1}}}`,
+		`{"attributes": {"DataType": {"max": -1}}}`,
+		`{"attributes": []}`,
+	} {
+		if _, err := NewAnnotationSchema(str); err == nil {
+			t.Errorf("NewAnnotationSchema(%s) should fail", str)
+		}
+	}
+}
+
+func TestParseAnnotationSchema(t *testing.T) {
+	s, err := NewAnnotationSchema(`{
+		"attributes": {
+			"DataType": { "required": true, "max": 2 },
+			"Epsilon": { "max": 1 }
+		},
+		"closed": true
+	}`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	p := newScopedPolicy(t, `DENY DataType AccountID`)
+	if err := p.DefineNumeric(Epsilon); err != nil {
+		t.Fatalf("%q", err)
+	}
+	p.Schema = s
+	p.Unknown = IgnoreUnknown
+	cases := []struct {
+		astr string
+		ok   bool
+	}{
+		{"DataType IPAddress", true},
+		{"DataType ANYOF(IPAddress,AccountID) Epsilon 0.5", true},
+		{"Epsilon 0.5", false},
+		{"", false},
+		{"DataType IPAddress DataType AccountID DataType Location", false},
+		{"DataType IPAddress Epsilon 0.5 Epsilon 1", false},
+		// the schema is closed, even if the policy ignores unknown attributes
+		{"DataType IPAddress Region EU", false},
+	}
+	for _, c := range cases {
+		_, err := p.ParseAnnotation(c.astr)
+		if (err == nil) != c.ok {
+			t.Errorf("ParseAnnotation(%q) = %v", c.astr, err)
+		}
+	}
+}
+
+func TestValidateAnnotation(t *testing.T) {
+	p := newScopedPolicy(t, `DENY DataType AccountID`)
+	cases := []struct {
+		json string
+		ok   bool
+	}{
+		{`[["DataType", "IPAddress"]]`, true},
+		{`[["DataType", "Unknown"]]`, false},
+		{`[["DataType", "ANYOF(IPAddress,AccountID)"]]`, true},
+		{`[["DataType", "ALLOF(IPAddress,AccountID)"]]`, true},
+		{`[["DataType", "ALLOF(IPAddress,Unknown)"]]`, false},
+		{`[["Region", "EU"]]`, false},
+	}
+	for _, c := range cases {
+		var an Annotation
+		if err := json.Unmarshal([]byte(c.json), &an); err != nil {
+			t.Fatalf("%q", err)
+		}
+		if err := p.ValidateAnnotation(an); (err == nil) != c.ok {
+			t.Errorf("ValidateAnnotation(%s) = %v", c.json, err)
+		}
+	}
+
+	// an ALLOF set isn't a value of a single pair
+	if err := p.ValidateAnnotation(Annotation{{name: "DataType", value: "ALLOF(IPAddress,AccountID)"}}); err == nil {
+		t.Errorf("ValidateAnnotation(ALLOF) = nil")
+	}
+
+	p.Schema = &AnnotationSchema{Attributes: map[string]AttributeRule{"Purpose": {Required: true}}}
+	p.Unknown = IgnoreUnknown
+	var an Annotation
+	if err := json.Unmarshal([]byte(`[["DataType", "IPAddress"], ["Region", "EU"]]`), &an); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := p.ValidateAnnotation(an); err == nil || err.Error() != "schema: Purpose is required" {
+		t.Errorf("ValidateAnnotation() = %v", err)
+	}
+}
+
+func TestValidateAnnotationAllOf(t *testing.T) {
+	p := newScopedPolicy(t, `ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }`)
+	var an Annotation
+	if err := json.Unmarshal([]byte(`[["DataType", "ALLOF(IPAddress,AccountID)"]]`), &an); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := p.ValidateAnnotation(an); err != nil {
+		t.Fatalf("ValidateAnnotation() = %v", err)
+	}
+	// the set is the same as repeating the attribute
+	d, err := p.Explain(an)
+	if err != nil || d.Allowed || len(an) != 2 {
+		t.Errorf("Explain(%s) = %+v, %v", an, d, err)
+	}
+	if d := p.Evaluate(an); d.Allowed {
+		t.Errorf("Evaluate(%s) = %+v", an, d)
+	}
+}
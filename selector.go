@@ -0,0 +1,114 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Selector prefixes: a selector is a tag, a catalog path, or else a glob of
+// dataset names
+const (
+	TagSelector  = "tag:"
+	PathSelector = "path:"
+)
+
+// Selector selects the resources a policy applies to, so that one policy set
+// can serve a whole warehouse. Resources are named by their catalog path, e.g.
+// warehouse/sales/orders is the dataset orders of the schema sales, and a
+// selector is one of
+//
+//	orders_*                the datasets whose name matches a glob (see path.Match)
+//	tag:pii                 the resources tagged pii (see PolicySet.Tag)
+//	path:warehouse/sales    the resources under a catalog path
+type Selector struct {
+	kind    string
+	pattern string
+}
+
+// ParseSelector returns the Selector of a string
+func ParseSelector(s string) (*Selector, error) {
+	switch {
+	case strings.HasPrefix(s, TagSelector):
+		if tag := strings.TrimPrefix(s, TagSelector); tag != "" {
+			return &Selector{kind: TagSelector, pattern: tag}, nil
+		}
+	case strings.HasPrefix(s, PathSelector):
+		if p := strings.Trim(strings.TrimPrefix(s, PathSelector), ScopeSeparator); p != "" {
+			return &Selector{kind: PathSelector, pattern: p}, nil
+		}
+	case s != "":
+		if _, err := path.Match(s, ""); err != nil || strings.Contains(s, ScopeSeparator) {
+			return nil, errors.New(fmt.Sprintf("policy: %s is not a valid glob of dataset names", s))
+		}
+		return &Selector{pattern: s}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("policy: %q is not a valid selector", s))
+}
+
+// String returns the selector in the syntax of ParseSelector
+func (s *Selector) String() string {
+	return s.kind + s.pattern
+}
+
+// Matches returns true when the selector selects a resource with some tags
+func (s *Selector) Matches(resource string, tags []string) bool {
+	resource = strings.Trim(resource, ScopeSeparator)
+	switch s.kind {
+	case TagSelector:
+		return contains(tags, s.pattern)
+	case PathSelector:
+		return resource == s.pattern || strings.HasPrefix(resource, s.pattern+ScopeSeparator)
+	default:
+		name := resource[strings.LastIndex(resource, ScopeSeparator)+1:]
+		matched, _ := path.Match(s.pattern, name)
+		return matched
+	}
+}
+
+// ResourceDecision is the result of evaluating an annotation of a resource
+// with the policies of a set that apply to the resource
+type ResourceDecision struct {
+	Allowed bool
+	// Applicable and Denying are the IDs of the policies that apply to the
+	// resource, and of those that deny the annotation
+	Applicable []string
+	Denying    []string
+}
+
+// Tag sets the tags of a resource, which tag selectors select
+func (s *PolicySet) Tag(resource string, tags ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tags == nil {
+		s.tags = make(map[string][]string)
+	}
+	s.tags[strings.Trim(resource, ScopeSeparator)] = append([]string(nil), tags...)
+}
+
+// EvaluateFor applies the policies of the set that apply to a resource on an
+// annotation of the resource: the policies without a selector, and those
+// whose selector selects the resource. The annotation is allowed when every
+// applicable policy allows it.
+func (s *PolicySet) EvaluateFor(resource string, an Annotation) (ResourceDecision, error) {
+	s.mu.RLock()
+	tags := s.tags[strings.Trim(resource, ScopeSeparator)]
+	s.mu.RUnlock()
+
+	d := ResourceDecision{Allowed: true, Applicable: make([]string, 0), Denying: make([]string, 0)}
+	for _, p := range s.policies() {
+		if p.Selector != nil && !p.Selector.Matches(resource, tags) {
+			continue
+		}
+		d.Applicable = append(d.Applicable, p.ID)
+		if !p.ApplyOn(an) {
+			d.Allowed = false
+			d.Denying = append(d.Denying, p.ID)
+		}
+	}
+	if len(d.Applicable) == 0 {
+		return ResourceDecision{}, errors.New(fmt.Sprintf("policy: no policy applies to resource %s", resource))
+	}
+	return d, nil
+}
@@ -0,0 +1,102 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	cases := []struct {
+		str, err string
+	}{
+		{"orders_*", ""},
+		{"tag:pii", ""},
+		{"path:/warehouse/sales/", ""},
+		{"", `policy: "" is not a valid selector`},
+		{"tag:", `policy: "tag:" is not a valid selector`},
+		{"orders_[", "policy: orders_[ is not a valid glob of dataset names"},
+		{"sales/orders", "policy: sales/orders is not a valid glob of dataset names"},
+	}
+	for _, c := range cases {
+		_, err := ParseSelector(c.str)
+		if (err == nil) != (c.err == "") || (err != nil && err.Error() != c.err) {
+			t.Errorf("ParseSelector(%q) = %v, want %q", c.str, err, c.err)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	cases := []struct {
+		selector, resource string
+		tags               []string
+		matches            bool
+	}{
+		{"orders_*", "warehouse/sales/orders_2020", nil, true},
+		{"orders_*", "warehouse/sales/customers", nil, false},
+		{"orders_*", "orders_2020", nil, true},
+		{"tag:pii", "warehouse/sales/customers", []string{"finance", "pii"}, true},
+		{"tag:pii", "warehouse/sales/customers", []string{"finance"}, false},
+		{"path:warehouse/sales", "warehouse/sales/orders", nil, true},
+		{"path:warehouse/sales", "/warehouse/sales", nil, true},
+		{"path:warehouse/sales", "warehouse/salesforce/leads", nil, false},
+	}
+	for _, c := range cases {
+		s, err := ParseSelector(c.selector)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := s.Matches(c.resource, c.tags); got != c.matches {
+			t.Errorf("%s.Matches(%q, %q) = %t, want %t", s, c.resource, c.tags, got, c.matches)
+		}
+	}
+}
+
+func TestEvaluateFor(t *testing.T) {
+	selected := func(id, selector, pstr string) *Policy {
+		p := newScopedPolicy(t, pstr)
+		p.ID = id
+		if selector != "" {
+			s, err := ParseSelector(selector)
+			if err != nil {
+				t.Fatalf("%q", err)
+			}
+			p.Selector = s
+		}
+		return p
+	}
+	s := NewPolicySet(
+		selected("no-joins", "", "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }"),
+		selected("no-accounts", "tag:pii", "DENY DataType AccountID"),
+		selected("locations", "path:warehouse/geo", "ALLOW DataType Location"),
+	)
+	s.Tag("warehouse/sales/customers", "pii")
+
+	cases := []struct {
+		resource, astr      string
+		allowed             bool
+		applicable, denying string
+	}{
+		{"warehouse/sales/orders", "DataType AccountID", true, "no-joins", ""},
+		{"warehouse/sales/customers", "DataType AccountID", false, "no-joins no-accounts", "no-accounts"},
+		{"warehouse/geo/visits", "DataType AccountID", false, "no-joins locations", "locations"},
+		{"warehouse/geo/visits", "DataType IPAddress", true, "no-joins locations", ""},
+	}
+	for _, c := range cases {
+		an, err := s.Policies[0].ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		d, err := s.EvaluateFor(c.resource, an)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if d.Allowed != c.allowed || strings.Join(d.Applicable, " ") != c.applicable || strings.Join(d.Denying, " ") != c.denying {
+			t.Errorf("EvaluateFor(%q, %q) = %+v", c.resource, c.astr, d)
+		}
+	}
+
+	s.Remove("no-joins")
+	if _, err := s.EvaluateFor("warehouse/sales/orders", Annotation{}); err == nil {
+		t.Errorf("EvaluateFor() without applicable policies = nil error")
+	}
+}
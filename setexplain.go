@@ -0,0 +1,116 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetRule is the combining rule of policy sets: an annotation is allowed
+// only when every applicable policy allows it, i.e. deny overrides
+const SetRule = "deny-overrides"
+
+// PolicyExplanation is the explanation of a policy of a set
+type PolicyExplanation struct {
+	// Policy is the ID of the policy, or its index in the set when it has none
+	Policy      string
+	Explanation *Explanation
+}
+
+// SetExplanation explains the decision of a policy set across its policies
+type SetExplanation struct {
+	Allowed bool
+	// Rule is the combining rule that decided, SetRule
+	Rule string
+	// Applicable are the policies that applied, Denying those of them that
+	// denied and Allowing those that would have allowed
+	Applicable, Denying, Allowing []string
+	// NotApplicable are the policies whose selector didn't select the resource
+	NotApplicable []string
+	// Explanations are the explanations of the applicable policies, in order
+	Explanations []PolicyExplanation
+}
+
+// Explain explains the decision of the set on an annotation, aggregated
+// across its policies
+func (s *PolicySet) Explain(an Annotation) *SetExplanation {
+	e, _ := s.explain(an, nil)
+	return e
+}
+
+// ExplainFor explains the decision of the set on an annotation of a
+// resource like EvaluateFor, aggregated across its policies
+func (s *PolicySet) ExplainFor(resource string, an Annotation) (*SetExplanation, error) {
+	return s.explain(an, &resource)
+}
+
+func (s *PolicySet) explain(an Annotation, resource *string) (*SetExplanation, error) {
+	var tags []string
+	if resource != nil {
+		s.mu.RLock()
+		tags = s.tags[strings.Trim(*resource, ScopeSeparator)]
+		s.mu.RUnlock()
+	}
+	e := &SetExplanation{Allowed: true, Rule: SetRule, Applicable: make([]string, 0), Denying: make([]string, 0),
+		Allowing: make([]string, 0), NotApplicable: make([]string, 0), Explanations: make([]PolicyExplanation, 0)}
+	for i, p := range s.policies() {
+		id := p.ID
+		if id == "" {
+			id = strconv.Itoa(i)
+		}
+		if resource != nil && p.Selector != nil && !p.Selector.Matches(*resource, tags) {
+			e.NotApplicable = append(e.NotApplicable, id)
+			continue
+		}
+		pe := p.Trace(an)
+		e.Applicable = append(e.Applicable, id)
+		e.Explanations = append(e.Explanations, PolicyExplanation{id, pe})
+		if pe.Allowed {
+			e.Allowing = append(e.Allowing, id)
+		} else {
+			e.Allowed = false
+			e.Denying = append(e.Denying, id)
+		}
+	}
+	if resource != nil && len(e.Applicable) == 0 {
+		return nil, errors.New(fmt.Sprintf("policy: no policy applies to resource %s", *resource))
+	}
+	return e, nil
+}
+
+// RenderSet converts the explanation of a policy set into prose: the
+// decision and the rule that decided it, then the explanation of every
+// applicable policy, the denying ones first, e.g.
+//
+//	Denied by no-joins, 1 of the 2 applicable policies, since every applicable policy must allow.
+//	no-joins: Denied because the program uses IPAddress together with AccountID, which the exception to the global allow forbids.
+//	analytics: Allowed because the program uses IPAddress and AccountID, which the global allow allows.
+func (r *Renderer) RenderSet(e *SetExplanation) (string, error) {
+	var b strings.Builder
+	switch {
+	case len(e.Applicable) == 0:
+		b.WriteString("Allowed since no policy applies.")
+	case e.Allowed:
+		b.WriteString(fmt.Sprintf("Allowed by all the %d applicable policies.", len(e.Applicable)))
+	default:
+		b.WriteString(fmt.Sprintf("Denied by %s, %d of the %d applicable policies, since every applicable policy must allow.",
+			strings.Join(e.Denying, ", "), len(e.Denying), len(e.Applicable)))
+	}
+	for _, allowed := range []bool{false, true} {
+		for _, pe := range e.Explanations {
+			if pe.Explanation.Allowed != allowed {
+				continue
+			}
+			text, err := r.Render(pe.Explanation)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString("\n" + pe.Policy + ": " + text)
+		}
+	}
+	if len(e.NotApplicable) > 0 {
+		b.WriteString("\nNot applicable: " + strings.Join(e.NotApplicable, ", ") + ".")
+	}
+	return b.String(), nil
+}
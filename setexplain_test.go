@@ -0,0 +1,91 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetExplain(t *testing.T) {
+	joins := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }")
+	joins.ID = "no-joins"
+	all := newScopedPolicy(t, "ALLOW DataType TOP")
+	s := NewPolicySet(joins, all)
+
+	cases := []struct {
+		astr                        string
+		allowed                     bool
+		applicable, denying, allows []string
+	}{
+		{"DataType IPAddress", true, []string{"no-joins", "1"}, []string{}, []string{"no-joins", "1"}},
+		{"DataType IPAddress DataType AccountID", false, []string{"no-joins", "1"}, []string{"no-joins"}, []string{"1"}},
+	}
+	for _, c := range cases {
+		an, err := joins.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		e := s.Explain(an)
+		if e.Allowed != c.allowed || e.Allowed != s.ApplyOn(an) || e.Rule != SetRule {
+			t.Errorf("Explain(%q) = %v by %s, want %v", c.astr, e.Allowed, e.Rule, c.allowed)
+		}
+		if !equals(e.Applicable, c.applicable) || !equals(e.Denying, c.denying) || !equals(e.Allowing, c.allows) {
+			t.Errorf("Explain(%q) = %v %v %v, want %v %v %v", c.astr, e.Applicable, e.Denying, e.Allowing,
+				c.applicable, c.denying, c.allows)
+		}
+		if len(e.Explanations) != 2 || e.Explanations[0].Explanation.Allowed != joins.ApplyOn(an) {
+			t.Errorf("Explain(%q) explanations = %v", c.astr, e.Explanations)
+		}
+	}
+}
+
+func TestSetExplainFor(t *testing.T) {
+	joins := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }")
+	joins.ID = "no-joins"
+	accounts := newScopedPolicy(t, "DENY DataType AccountID")
+	accounts.ID = "no-accounts"
+	sel, err := ParseSelector("tag:pii")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	accounts.Selector = sel
+	s := NewPolicySet(joins, accounts)
+	s.Tag("warehouse/customers", "pii")
+
+	an, err := joins.ParseAnnotation("DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	e, err := s.ExplainFor("warehouse/customers", an)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	d, _ := s.EvaluateFor("warehouse/customers", an)
+	if e.Allowed != d.Allowed || !equals(e.Denying, d.Denying) || !equals(e.Applicable, d.Applicable) {
+		t.Errorf("ExplainFor() = %v, want %v", e, d)
+	}
+	text, err := (&Renderer{}).RenderSet(e)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "Denied by no-accounts, 1 of the 2 applicable policies") ||
+		!strings.HasPrefix(lines[1], "no-accounts: Denied") || !strings.HasPrefix(lines[2], "no-joins: Allowed") {
+		t.Errorf("RenderSet() = %q", text)
+	}
+
+	e, err = s.ExplainFor("warehouse/events", an)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if !e.Allowed || !equals(e.NotApplicable, []string{"no-accounts"}) {
+		t.Errorf("ExplainFor() = %v, want allowed with no-accounts not applicable", e)
+	}
+	if text, _ := (&Renderer{}).RenderSet(e); !strings.HasSuffix(text, "Not applicable: no-accounts.") {
+		t.Errorf("RenderSet() = %q", text)
+	}
+
+	s = NewPolicySet(accounts)
+	if _, err := s.ExplainFor("warehouse/events", an); err == nil {
+		t.Errorf("ExplainFor() should fail when no policy applies")
+	}
+}
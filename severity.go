@@ -0,0 +1,135 @@
+package grok
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Severity is the severity of a finding, derived from the weights of the
+// elements involved
+type Severity int
+
+const (
+	SeverityNone Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"NONE", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity returns the severity of a name, e.g. HIGH, whatever its case
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityNone, errors.New(fmt.Sprintf("severity: unknown severity %s", name))
+}
+
+// SeverityOf returns the severity of a weight, where weights above
+// SeverityCritical are critical
+func SeverityOf(weight int) Severity {
+	switch {
+	case weight <= 0:
+		return SeverityNone
+	case weight >= int(SeverityCritical):
+		return SeverityCritical
+	default:
+		return Severity(weight)
+	}
+}
+
+// Weight returns the weight of an element. The weight of a product element is
+// the larger weight of its components, and a parameterized element has the
+// weight of its base element.
+func (l *Lattice) Weight(a string) int {
+	if l.isProductValue(a) {
+		fst, snd := l.halve(a)
+		w, sw := l.Weight(fst), l.state().Weight(snd)
+		if sw > w {
+			return sw
+		}
+		return w
+	}
+	return l.Weights[baseOf(a)]
+}
+
+// Severity returns the severity of an annotation, i.e. the severity of the
+// heaviest of its values in the lattices of the policy
+func (p *Policy) Severity(an Annotation) Severity {
+	max := 0
+	for _, pa := range an {
+		l, ok := p.baseOn[pa.name]
+		if !ok {
+			continue
+		}
+		for _, v := range valuesOf(pa.value) {
+			if w := l.Weight(v); w > max {
+				max = w
+			}
+		}
+	}
+	return SeverityOf(max)
+}
+
+// Fingerprint returns a stable identifier of a finding from its parts, e.g.
+// the dataset and the denying policies
+func Fingerprint(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h[:8])
+}
+
+// Suppression accepts the risk of a known finding until it expires
+type Suppression struct {
+	Fingerprint   string    `json:"fingerprint"`
+	Expires       time.Time `json:"expires"`
+	Justification string    `json:"justification"`
+}
+
+// Suppressions is the content of a suppression file, which is a JSON array of
+// suppressions:
+//
+//	[{"fingerprint": "9f86d081884c7d65", "expires": "2021-01-01T00:00:00Z",
+//	  "justification": "accepted by the privacy review #42"}]
+type Suppressions []Suppression
+
+// LoadSuppressions reads a suppression file. Every suppression must have a
+// fingerprint, an expiry and a justification.
+func LoadSuppressions(r io.Reader) (Suppressions, error) {
+	var ss Suppressions
+	if err := json.NewDecoder(r).Decode(&ss); err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		if s.Fingerprint == "" || s.Expires.IsZero() || s.Justification == "" {
+			return nil, errors.New("suppression: fingerprint, expires and justification are mandatory")
+		}
+	}
+	return ss, nil
+}
+
+// Suppressed returns the suppression of a fingerprint that is still valid at now
+func (ss Suppressions) Suppressed(fingerprint string, now time.Time) (Suppression, bool) {
+	for _, s := range ss {
+		if s.Fingerprint == fingerprint && now.Before(s.Expires) {
+			return s, true
+		}
+	}
+	return Suppression{}, false
+}
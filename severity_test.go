@@ -0,0 +1,106 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWeight(t *testing.T) {
+	dt := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"] },
+		"weights": { "AccountID": 3, "IPAddress": 2 }
+	}`)
+	dt.Product(NewLattice(`{ "name": "TypeState",
+		"edges": { "Raw": ["Aggregated"] },
+		"weights": { "Raw": 4 }
+	}`))
+	cases := []struct {
+		a    string
+		want int
+	}{
+		{"AccountID", 3},
+		{"UniqueID", 0},
+		{"IPAddress:Raw", 4},
+		{"AccountID:Aggregated(k=10)", 3},
+	}
+	for _, c := range cases {
+		if got := dt.Weight(c.a); got != c.want {
+			t.Errorf("Weight(%q) = %d, want %d", c.a, got, c.want)
+		}
+	}
+
+	p := NewPolicy([]*Lattice{dt})
+	an, err := p.ParseAnnotation("DataType IPAddress DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := p.Severity(an); got != SeverityHigh {
+		t.Errorf("Severity(%q) = %s, want %s", an, got, SeverityHigh)
+	}
+}
+
+func TestSeverityOf(t *testing.T) {
+	cases := []struct {
+		weight int
+		want   Severity
+	}{
+		{-1, SeverityNone},
+		{0, SeverityNone},
+		{2, SeverityMedium},
+		{10, SeverityCritical},
+	}
+	for _, c := range cases {
+		if got := SeverityOf(c.weight); got != c.want {
+			t.Errorf("SeverityOf(%d) = %s, want %s", c.weight, got, c.want)
+		}
+	}
+}
+
+func TestSeverityString(t *testing.T) {
+	cases := []struct {
+		s    Severity
+		want string
+	}{
+		{SeverityNone, "NONE"},
+		{SeverityCritical, "CRITICAL"},
+		{Severity(-1), "Severity(-1)"},
+		{Severity(7), "Severity(7)"},
+	}
+	for _, c := range cases {
+		if got := c.s.String(); got != c.want {
+			t.Errorf("String() = %s, want %s", got, c.want)
+		}
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	if s, err := ParseSeverity("high"); err != nil || s != SeverityHigh {
+		t.Errorf("ParseSeverity(high) = %s, %v", s, err)
+	}
+	if _, err := ParseSeverity("urgent"); err == nil {
+		t.Errorf("ParseSeverity(urgent) = nil error")
+	}
+}
+
+func TestSuppressions(t *testing.T) {
+	fp := Fingerprint("clicks", "0")
+	if fp != Fingerprint("clicks", "0") || fp == Fingerprint("clicks0") {
+		t.Errorf("Fingerprint should be stable and separate its parts")
+	}
+	ss, err := LoadSuppressions(strings.NewReader(`[
+		{"fingerprint": "` + fp + `", "expires": "2021-01-01T00:00:00Z", "justification": "accepted"}
+	]`))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if _, ok := ss.Suppressed(fp, time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)); !ok {
+		t.Errorf("Suppressed(%q) before expiry should be true", fp)
+	}
+	if _, ok := ss.Suppressed(fp, time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("Suppressed(%q) after expiry should be false", fp)
+	}
+	if _, err := LoadSuppressions(strings.NewReader(`[{"fingerprint": "x"}]`)); err == nil {
+		t.Errorf("LoadSuppressions without justification should fail")
+	}
+}
@@ -0,0 +1,164 @@
+package grok
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// DefaultSimulationSamples is the number of annotations a Simulator
+// generates when Samples isn't set
+const DefaultSimulationSamples = 1000
+
+// WeightedAnnotation is an annotation with its observed frequency
+type WeightedAnnotation struct {
+	Annotation Annotation
+	Weight     int
+}
+
+// FrequencyProfile is the observed frequency of annotations, e.g. in the
+// decision logs of a decision point (see ProfileRecords)
+type FrequencyProfile []WeightedAnnotation
+
+// ProfileRecords returns the frequency profile of the annotations of decision
+// records, sorted by decreasing frequency
+func ProfileRecords(recs []Record) FrequencyProfile {
+	index := make(map[string]int)
+	fp := make(FrequencyProfile, 0)
+	for _, r := range recs {
+		key := r.Annotation.String()
+		if i, ok := index[key]; ok {
+			fp[i].Weight++
+			continue
+		}
+		index[key] = len(fp)
+		fp = append(fp, WeightedAnnotation{Annotation: r.Annotation, Weight: 1})
+	}
+	sort.SliceStable(fp, func(i, j int) bool {
+		return fp[i].Weight > fp[j].Weight
+	})
+	return fp
+}
+
+// Simulator generates representative annotations and reports the decisions
+// of policies on them, so that authors can see the share of the traffic a
+// change denies before shipping it. Annotations are drawn from the frequency
+// profile when there's one, and are made of random elements of the lattices
+// of the policies otherwise.
+type Simulator struct {
+	// Samples is the number of generated annotations, DefaultSimulationSamples
+	// when it's 0
+	Samples int
+	// MaxValues is the maximum number of values of a random annotation, 2
+	// when it's 0
+	MaxValues int
+	// Profile weights the generated annotations by their observed frequency
+	Profile FrequencyProfile
+	// Rand is the source of the generator, seeded with 1 when it's nil so
+	// that simulations are reproducible
+	Rand *rand.Rand
+}
+
+// PolicySimulation is the distribution of the decisions of a policy in a
+// simulation
+type PolicySimulation struct {
+	ID              string
+	Allowed, Denied int
+}
+
+// DenyRate returns the share of the denied annotations
+func (s PolicySimulation) DenyRate() float64 {
+	if s.Allowed+s.Denied == 0 {
+		return 0
+	}
+	return float64(s.Denied) / float64(s.Allowed+s.Denied)
+}
+
+// String returns the distribution in one line, e.g. "no-joins denies 12.0% of
+// 1000 annotations"
+func (s PolicySimulation) String() string {
+	return fmt.Sprintf("%s denies %.1f%% of %d annotations", s.ID, 100*s.DenyRate(), s.Allowed+s.Denied)
+}
+
+// Generate returns the annotations of a simulation of policies
+func (sim *Simulator) Generate(ps ...*Policy) []Annotation {
+	n := sim.Samples
+	if n <= 0 {
+		n = DefaultSimulationSamples
+	}
+	r := sim.Rand
+	if r == nil {
+		r = rand.New(rand.NewSource(1))
+	}
+	ans := make([]Annotation, 0, n)
+
+	if len(sim.Profile) > 0 {
+		// the cumulative weights of the profile
+		cum := make([]int64, len(sim.Profile))
+		var total int64
+		for i, wa := range sim.Profile {
+			if wa.Weight > 0 {
+				total += int64(wa.Weight)
+			}
+			cum[i] = total
+		}
+		if total > 0 {
+			for len(ans) < n {
+				x := r.Int63n(total)
+				i := sort.Search(len(cum), func(i int) bool { return cum[i] > x })
+				ans = append(ans, sim.Profile[i].Annotation)
+			}
+			return ans
+		}
+	}
+
+	values := make([]pair, 0)
+	seen := make(map[string]bool)
+	for _, p := range ps {
+		for _, name := range p.latticeNames() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			for _, e := range p.baseOn[name].Elements() {
+				if e != Top && e != Bottom {
+					values = append(values, pair{name: name, value: e})
+				}
+			}
+		}
+	}
+	if len(values) == 0 {
+		return ans
+	}
+	max := sim.MaxValues
+	if max <= 0 {
+		max = 2
+	}
+	for len(ans) < n {
+		an := make(Annotation, 0, max)
+		for k := 1 + r.Intn(max); k > 0; k-- {
+			an = append(an, values[r.Intn(len(values))])
+		}
+		ans = append(ans, an)
+	}
+	return ans
+}
+
+// Run applies the policies on the generated annotations, and returns the
+// distributions of their decisions, in the order of the policies
+func (sim *Simulator) Run(ps ...*Policy) []PolicySimulation {
+	ans := sim.Generate(ps...)
+	res := make([]PolicySimulation, 0, len(ps))
+	for _, p := range ps {
+		s := PolicySimulation{ID: p.ID}
+		for _, an := range ans {
+			if p.ApplyOn(an) {
+				s.Allowed++
+			} else {
+				s.Denied++
+			}
+		}
+		res = append(res, s)
+	}
+	return res
+}
@@ -0,0 +1,69 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestProfileRecords(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	record := func(astr string) Record {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		return Record{Annotation: an, Effect: Allow}
+	}
+	fp := ProfileRecords([]Record{record("DataType AccountID"), record("DataType IPAddress"), record("DataType IPAddress")})
+	if len(fp) != 2 || fp[0].Annotation.String() != "DataType IPAddress" || fp[0].Weight != 2 || fp[1].Weight != 1 {
+		t.Errorf("ProfileRecords() = %v", fp)
+	}
+}
+
+func TestSimulatorProfile(t *testing.T) {
+	p := newScopedPolicy(t, "DENY DataType AccountID")
+	p.ID = "no-accounts"
+	account, err := p.ParseAnnotation("DataType AccountID")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	address, err := p.ParseAnnotation("DataType IPAddress")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	sim := &Simulator{Samples: 4000, Profile: FrequencyProfile{{account, 1}, {address, 3}}}
+	res := sim.Run(p)
+	if len(res) != 1 || res[0].Allowed+res[0].Denied != 4000 {
+		t.Fatalf("Run() = %v", res)
+	}
+	// a quarter of the traffic is denied
+	if rate := res[0].DenyRate(); rate < 0.22 || rate > 0.28 {
+		t.Errorf("DenyRate() = %f, want about 0.25", rate)
+	}
+	if s := (PolicySimulation{ID: "no-accounts", Allowed: 880, Denied: 120}).String(); s != "no-accounts denies 12.0% of 1000 annotations" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestSimulatorRandom(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }")
+	sim := &Simulator{Samples: 200, MaxValues: 3}
+	ans := sim.Generate(p)
+	if len(ans) != 200 {
+		t.Fatalf("len(Generate()) = %d, want 200", len(ans))
+	}
+	for _, an := range ans {
+		if len(an) < 1 || len(an) > 3 {
+			t.Errorf("Generate() has %q", an)
+		}
+		for _, pa := range an {
+			if _, err := p.LatticeValue(pa.value, pa.name); err != nil || pa.value == Top || pa.value == Bottom {
+				t.Errorf("Generate() has %q", an)
+			}
+		}
+	}
+	// simulations are reproducible
+	first, second := sim.Run(p), sim.Run(p)
+	if first[0] != second[0] || first[0].Denied == 0 || first[0].Allowed == 0 {
+		t.Errorf("Run() = %v, then %v", first, second)
+	}
+}
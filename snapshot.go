@@ -0,0 +1,315 @@
+package grok
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// SnapshotVersion is the version of the snapshot format written by WriteSnapshot.
+// Version 2 added the settings of the policy.
+const SnapshotVersion = 2
+
+// Compile compiles the lattices the policy is based on, and their products
+func (p *Policy) Compile() {
+	for _, l := range p.lattices() {
+		if !l.Compiled() {
+			l.Compile()
+		}
+	}
+}
+
+// lattices returns the lattices of the policy and their products, sorted by name
+func (p *Policy) lattices() []*Lattice {
+	seen := make(map[string]*Lattice)
+	for _, l := range p.baseOn {
+		for ; l != nil && seen[l.Name] == nil; l = l.state() {
+			seen[l.Name] = l
+		}
+	}
+	ls := make([]*Lattice, 0, len(seen))
+	for _, l := range seen {
+		ls = append(ls, l)
+	}
+	sort.Slice(ls, func(p, q int) bool {
+		return ls[p].Name < ls[q].Name
+	})
+	return ls
+}
+
+// A snapshot is the compiled state of a policy in JSON: its lattices with
+// their closures, its numeric and compatibility attributes, and the parsed
+// policy itself. Loading a snapshot neither parses the policy nor computes
+// the closures, which cuts the cold start of decision points evaluating
+// bundles of policies over large lattices.
+type snapshot struct {
+	Version         int                     `json:"version"`
+	ID              string                  `json:"id,omitempty"`
+	Lattices        []latticeSnapshot       `json:"lattices"`
+	Numerics        []string                `json:"numerics,omitempty"`
+	Compatibilities []compatibilitySnapshot `json:"compatibilities,omitempty"`
+	Policy          policySnapshot          `json:"policy"`
+	// Base are the names of the lattices the policy is based on, the other
+	// lattices being only products
+	Base []string `json:"base"`
+	// Derivations are the derivation rules of the policy in their syntax
+	Derivations []string `json:"derivations,omitempty"`
+	policySettings
+}
+
+type latticeSnapshot struct {
+	Name       string                       `json:"name"`
+	Edges      [][2]string                  `json:"edges"`
+	Weights    map[string]int               `json:"weights,omitempty"`
+	Labels     map[string]map[string]string `json:"labels,omitempty"`
+	Deprecated map[string]string            `json:"deprecated,omitempty"`
+	Product    string                       `json:"product,omitempty"`
+	Elements   []string                     `json:"elements"`
+	Below      []bitset                     `json:"below"`
+}
+
+type compatibilitySnapshot struct {
+	Name       string              `json:"name"`
+	Compatible map[string][]string `json:"compatible"`
+}
+
+// policySettings are the settings of a policy that change how it parses and
+// evaluates annotations. Exceptions are evaluated with the settings of their
+// policy.
+type policySettings struct {
+	Unknown        UnknownAttributes             `json:"unknown,omitempty"`
+	Repeated       RepeatedValues                `json:"repeated,omitempty"`
+	RepeatedOf     map[string]RepeatedValues     `json:"repeated_of,omitempty"`
+	Unclassified   UnclassifiedValues            `json:"unclassified,omitempty"`
+	UnclassifiedOf map[string]UnclassifiedValues `json:"unclassified_of,omitempty"`
+	Selector       string                        `json:"selector,omitempty"`
+	Constraints    []string                      `json:"constraints,omitempty"`
+	MaxExceptDepth int                           `json:"max_except_depth,omitempty"`
+	MapDeprecated  bool                          `json:"map_deprecated,omitempty"`
+}
+
+type policySnapshot struct {
+	Mode    bool             `json:"mode"`
+	Monitor bool             `json:"monitor,omitempty"`
+	Clause  Clause           `json:"clause"`
+	Excepts []policySnapshot `json:"excepts,omitempty"`
+}
+
+// WriteSnapshot compiles the policy and writes its compiled state to w
+func (p *Policy) WriteSnapshot(w io.Writer) error {
+	p.Compile()
+	s := snapshot{Version: SnapshotVersion, ID: p.ID, Policy: p.snapshot(), Numerics: p.numericNames(), Base: p.latticeNames(),
+		policySettings: p.settings()}
+	for _, r := range p.Derivations {
+		s.Derivations = append(s.Derivations, r.String())
+	}
+	for _, l := range p.lattices() {
+		c := l.closure()
+		ls := latticeSnapshot{Name: l.Name, Weights: l.Weights, Labels: l.Labels, Deprecated: l.Deprecated, Elements: c.symbols.Names(), Below: c.below}
+		for _, e := range l.Edges {
+			ls.Edges = append(ls.Edges, [2]string{e.From, e.To})
+		}
+		if s := l.state(); s != nil {
+			ls.Product = s.Name
+		}
+		s.Lattices = append(s.Lattices, ls)
+	}
+	s.Compatibilities = p.compatibilitySnapshots()
+	return json.NewEncoder(w).Encode(&s)
+}
+
+// compatibilitySnapshots returns the compatibility attributes of the policy,
+// sorted by name
+func (p *Policy) compatibilitySnapshots() []compatibilitySnapshot {
+	names := make([]string, 0, len(p.compats))
+	for name := range p.compats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := make([]compatibilitySnapshot, 0, len(names))
+	for _, name := range names {
+		c := p.compats[name]
+		cs := compatibilitySnapshot{Name: name, Compatible: make(map[string][]string)}
+		for a, bs := range c.compatible {
+			for b := range bs {
+				cs.Compatible[a] = append(cs.Compatible[a], b)
+			}
+			sort.Strings(cs.Compatible[a])
+		}
+		res = append(res, cs)
+	}
+	return res
+}
+
+// settings returns the settings of the policy
+func (p *Policy) settings() policySettings {
+	s := policySettings{Unknown: p.Unknown, Repeated: p.Repeated, RepeatedOf: p.RepeatedOf, Unclassified: p.Unclassified,
+		UnclassifiedOf: p.UnclassifiedOf, MaxExceptDepth: p.MaxExceptDepth, MapDeprecated: p.MapDeprecated}
+	if p.Selector != nil {
+		s.Selector = p.Selector.String()
+	}
+	for _, c := range p.Constraints {
+		s.Constraints = append(s.Constraints, c.String())
+	}
+	return s
+}
+
+// isZero returns true when the settings are the defaults of a policy
+func (s *policySettings) isZero() bool {
+	return s.Unknown == RejectUnknown && s.Repeated == AllValues && len(s.RepeatedOf) == 0 &&
+		s.Unclassified == RejectUnclassified && len(s.UnclassifiedOf) == 0 && s.Selector == "" &&
+		len(s.Constraints) == 0 && s.MaxExceptDepth == 0 && !s.MapDeprecated
+}
+
+// setSettings sets the settings of the policy, whose lattices the
+// constraints are parsed against
+func (p *Policy) setSettings(s policySettings) error {
+	p.Unknown, p.Repeated, p.RepeatedOf = s.Unknown, s.Repeated, s.RepeatedOf
+	p.Unclassified, p.UnclassifiedOf = s.Unclassified, s.UnclassifiedOf
+	p.MaxExceptDepth, p.MapDeprecated = s.MaxExceptDepth, s.MapDeprecated
+	if s.Selector != "" {
+		sel, err := ParseSelector(s.Selector)
+		if err != nil {
+			return err
+		}
+		p.Selector = sel
+	}
+	for _, str := range s.Constraints {
+		c, err := p.ParseConstraint(str)
+		if err != nil {
+			return err
+		}
+		p.Constraints = append(p.Constraints, c)
+	}
+	return nil
+}
+
+func (p *Policy) snapshot() policySnapshot {
+	s := policySnapshot{Mode: p.Mode, Monitor: p.Monitor, Clause: p.Clause}
+	for i := range p.Excepts {
+		s.Excepts = append(s.Excepts, p.Excepts[i].snapshot())
+	}
+	return s
+}
+
+// ReadSnapshot reads a policy written by WriteSnapshot. The lattices of the
+// policy are restored compiled.
+func ReadSnapshot(r io.Reader) (*Policy, error) {
+	var s snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Version != SnapshotVersion {
+		return nil, errors.New(fmt.Sprintf("snapshot: unsupported version %d", s.Version))
+	}
+
+	all := make(map[string]*Lattice)
+	for _, ls := range s.Lattices {
+		if !validClosure(ls.Below, len(ls.Elements)) {
+			return nil, errors.New(fmt.Sprintf("snapshot: lattice %s has a corrupted closure", ls.Name))
+		}
+		l := &Lattice{Name: ls.Name, Weights: ls.Weights, Labels: ls.Labels, Deprecated: ls.Deprecated}
+		for _, e := range ls.Edges {
+			l.Edges = append(l.Edges, Edge{e[0], e[1]})
+		}
+		l.indexEdges()
+		symbols := NewSymbols()
+		for _, e := range ls.Elements {
+			symbols.Intern(e)
+		}
+		if symbols.Len() != len(ls.Elements) {
+			return nil, errors.New(fmt.Sprintf("snapshot: lattice %s has duplicate elements", ls.Name))
+		}
+		l.setClosure(symbols, ls.Below)
+		all[l.Name] = l
+	}
+	for _, ls := range s.Lattices {
+		if ls.Product == "" {
+			continue
+		}
+		if all[ls.Product] == nil {
+			return nil, errors.New(fmt.Sprintf("snapshot: lattice %s is missing", ls.Product))
+		}
+		all[ls.Name].Product(all[ls.Product])
+	}
+
+	base := make([]*Lattice, 0, len(s.Base))
+	for _, name := range s.Base {
+		if all[name] == nil {
+			return nil, errors.New(fmt.Sprintf("snapshot: lattice %s is missing", name))
+		}
+		base = append(base, all[name])
+	}
+	if len(base) == 0 {
+		return nil, errors.New("snapshot: policy isn't based on any lattice")
+	}
+	p := NewPolicy(base)
+	p.ID = s.ID
+	if err := p.define(s.Numerics, s.Compatibilities, s.Derivations); err != nil {
+		return nil, err
+	}
+	if err := p.setSettings(s.policySettings); err != nil {
+		return nil, err
+	}
+	pp := p.restore(s.Policy)
+	p.Mode, p.Monitor, p.Clause, p.Excepts = pp.Mode, pp.Monitor, pp.Clause, pp.Excepts
+	p.hasMonitor = p.monitorsExceptions()
+	return p, nil
+}
+
+// define defines the numeric and compatibility attributes, and the
+// derivation rules of the policy
+func (p *Policy) define(numerics []string, compats []compatibilitySnapshot, derivations []string) error {
+	for _, name := range numerics {
+		if err := p.DefineNumeric(name); err != nil {
+			return err
+		}
+	}
+	for _, cs := range compats {
+		c := &Compatibility{cs.Name, make(map[string]map[string]bool)}
+		for a, bs := range cs.Compatible {
+			for _, b := range bs {
+				c.add(a, b)
+			}
+		}
+		if err := p.DefineCompatibility(c); err != nil {
+			return err
+		}
+	}
+	for _, str := range derivations {
+		r, err := p.ParseDerivation(str)
+		if err != nil {
+			return err
+		}
+		p.Derivations = append(p.Derivations, r)
+	}
+	return nil
+}
+
+// restore returns the policy of a snapshot, based on the attributes of p
+func (p *Policy) restore(s policySnapshot) Policy {
+	policy := Policy{Mode: s.Mode, Monitor: s.Monitor, Clause: s.Clause, Excepts: make([]Policy, 0, len(s.Excepts))}
+	if policy.Clause == nil {
+		policy.Clause = make(Clause, 0)
+	}
+	for _, ex := range s.Excepts {
+		policy.Excepts = append(policy.Excepts, p.restore(ex))
+	}
+	policy.baseOn, policy.numerics, policy.compats = p.baseOn, p.numerics, p.compats
+	return policy
+}
+
+// validClosure returns true when below is a closure of n elements
+func validClosure(below []bitset, n int) bool {
+	if len(below) != n {
+		return false
+	}
+	for _, bs := range below {
+		if len(bs) != (n+63)/64 {
+			return false
+		}
+	}
+	return true
+}
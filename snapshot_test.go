@@ -0,0 +1,175 @@
+package grok
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	dt := NewLattice(`{ "name": "DataType",
+		"edges": {
+			"UniqueID": ["AccountID", "IPAddress"],
+			"Location": ["IPAddress"] },
+		"weights": { "AccountID": 3 }
+		}`)
+	dt.Product(NewLattice(`{ "name": "TypeState", "edges": { "Raw": ["Truncated"] } }`))
+	purpose := NewLattice(`{ "name": "Purpose", "edges": { "Analytics": ["Research"], "Billing": [] } }`)
+	c, err := NewCompatibility(`{ "name": "CollectedFor", "compatible": { "Billing": ["Analytics"] } }`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	p := NewPolicy([]*Lattice{dt, purpose})
+	if err := p.DefineNumeric(Epsilon); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := p.DefineCompatibility(c); err != nil {
+		t.Fatalf("%q", err)
+	}
+	pstr := `ALLOW DataType TOP Purpose Analytics COMPATIBLEWITH CollectedFor Epsilon <=1.0
+		EXCEPT { DENY MODE=monitor DataType IPAddress:Raw DENY DataType AccountID }`
+	if err := p.ParsePolicy(pstr); err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("%q", err)
+	}
+	restored, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	for _, l := range restored.lattices() {
+		if !l.Compiled() {
+			t.Errorf("lattice %s isn't compiled", l.Name)
+		}
+	}
+	if restored.baseOn["DataType"].Weight("AccountID") != 3 || !restored.Excepts[0].Monitor {
+		t.Errorf("ReadSnapshot() = %+v", restored)
+	}
+
+	astrs := []string{
+		"DataType IPAddress:Raw Purpose Research CollectedFor Billing Epsilon 0.5",
+		"DataType IPAddress:Truncated Purpose Research CollectedFor Billing Epsilon 0.5",
+		"DataType AccountID Purpose Analytics",
+		"DataType Location Purpose Billing",
+		"DataType Location Epsilon 2",
+	}
+	for _, astr := range astrs {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got, want := restored.Evaluate(an), p.Evaluate(an); got.Allowed != want.Allowed || got.WouldBe != want.WouldBe {
+			t.Errorf("restored policy on [%q] = %+v, want %+v", astr, got, want)
+		}
+	}
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	cases := []string{
+		`{"version": 2}`,
+		`{"version": 2, "lattices": [{"name": "DataType", "elements": ["TOP"], "below": []}]}`,
+		`{"version": 2, "lattices": [{"name": "DataType", "elements": ["TOP"], "below": [[]]}]}`,
+		`{"version": 2, "lattices": [{"name": "DataType", "product": "TypeState"}]}`,
+		`{"version": 2, "base": ["DataType"]}`,
+		`{"version": 2}`,
+	}
+	for _, c := range cases {
+		if _, err := ReadSnapshot(strings.NewReader(c)); err == nil {
+			t.Errorf("ReadSnapshot(%s) should fail", c)
+		}
+	}
+}
+
+func TestSnapshotSettings(t *testing.T) {
+	dt := NewLattice(`{ "name": "DataType",
+		"edges": {
+			"UniqueID": ["AccountID", "IPAddress"],
+			"Location": ["IPAddress"] }
+		}`)
+	dt.Product(NewLattice(`{ "name": "TypeState", "edges": { "Raw": ["Truncated"] } }`))
+	p := NewPolicy([]*Lattice{dt})
+	p.ID = "settings"
+	p.Unknown, p.Repeated, p.Unclassified = FlagUnknown, JoinValues, ConservativeUnclassified
+	p.RepeatedOf = map[string]RepeatedValues{"TypeState": AllValues}
+	p.UnclassifiedOf = map[string]UnclassifiedValues{"TypeState": PermissiveUnclassified}
+	p.MaxExceptDepth, p.MapDeprecated = 2, true
+	sel, err := ParseSelector("tag:pii")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	p.Selector = sel
+	c, err := p.ParseConstraint("TypeState Raw REQUIRES DataType IPAddress")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	p.Constraints = []Constraint{c}
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType UniqueID }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	roundTrips := map[string]func() (*Policy, error){
+		"snapshot": func() (*Policy, error) {
+			var buf bytes.Buffer
+			if err := p.WriteSnapshot(&buf); err != nil {
+				return nil, err
+			}
+			return ReadSnapshot(&buf)
+		},
+		"JSON": func() (*Policy, error) {
+			b, err := json.Marshal(p)
+			if err != nil {
+				return nil, err
+			}
+			return UnmarshalPolicy(b, []*Lattice{dt})
+		},
+	}
+	astrs := []string{
+		// joined to UniqueID, which the exception denies
+		"DataType AccountID DataType IPAddress",
+		// evaluated as TOP
+		"DataType Unknown",
+		// flagged
+		"DataType Location Color Red",
+		// violates the constraint
+		"DataType Location:Raw",
+	}
+	for name, roundTrip := range roundTrips {
+		q, err := roundTrip()
+		if err != nil {
+			t.Fatalf("%s: %q", name, err)
+		}
+		if got, want := q.settings(), p.settings(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: settings = %+v, want %+v", name, got, want)
+		}
+		for _, astr := range astrs {
+			want, werr := p.ParseAnnotation(astr)
+			got, gerr := q.ParseAnnotation(astr)
+			if (gerr == nil) != (werr == nil) {
+				t.Errorf("%s: ParseAnnotation(%s) = %v, want %v", name, astr, gerr, werr)
+				continue
+			}
+			if werr != nil {
+				continue
+			}
+			if gd, wd := q.Evaluate(got), p.Evaluate(want); gd.Allowed != wd.Allowed || !reflect.DeepEqual(gd.Unknown, wd.Unknown) {
+				t.Errorf("%s: Evaluate(%s) = %+v, want %+v", name, astr, gd, wd)
+			}
+		}
+	}
+
+	// the settings are part of the fingerprint of the policy
+	d := NewPolicy([]*Lattice{dt})
+	d.ID = p.ID
+	if err := d.ParsePolicy(p.String()); err != nil {
+		t.Fatalf("%q", err)
+	}
+	got, _ := d.Fingerprints()
+	if want, _ := p.Fingerprints(); got == want {
+		t.Errorf("the policy without settings has the fingerprint %s of the policy", got)
+	}
+}
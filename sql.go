@@ -0,0 +1,191 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ColumnMapping maps the attributes of a policy to the columns of a table
+// holding the per-row labels, e.g. DataType to data_type. A column holds one
+// value per row, the name of an element of a lattice or a number for numeric
+// attributes, and NULL for no value.
+type ColumnMapping map[string]string
+
+// For returns the mapping of the attributes that a policy knows as lattice
+// or numeric attributes, e.g. to map the tables of a policy set once
+func (m ColumnMapping) For(p *Policy) ColumnMapping {
+	res := make(ColumnMapping)
+	for attr, col := range m {
+		if _, ok := p.baseOn[attr]; ok || p.isNumeric(attr) {
+			res[attr] = col
+		}
+	}
+	return res
+}
+
+// SQL expressions of the constant filters
+const (
+	sqlTrue  = "1 = 1"
+	sqlFalse = "1 = 0"
+)
+
+// ToSQLFilter compiles the policy into a SQL boolean expression over the
+// columns of the mapping, for a WHERE clause or a row-level security policy,
+// so that databases can enforce it natively. Rows are annotated by the values
+// of their mapped columns.
+//
+// The filter is a conservative approximation of the policy: it never keeps a
+// row that the policy denies, but the exceptions of the DENY clauses, which
+// apply on overlaps, are ignored, so that it may drop rows that the policy
+// allows. Product and parameterized values of rows are dropped as well, since
+// only the elements of the lattices are enumerated.
+func (p *Policy) ToSQLFilter(mapping ColumnMapping) (string, error) {
+	for attr := range mapping {
+		if _, ok := p.baseOn[attr]; !ok && !p.isNumeric(attr) {
+			return "", errors.New(fmt.Sprintf("policy: %s is not a lattice or numeric attribute of the policy", attr))
+		}
+	}
+	if p.Monitor {
+		return sqlTrue, nil
+	}
+	return p.sqlFilter(mapping)
+}
+
+// sqlFilter returns the filter of the rows that the policy allows
+func (p *Policy) sqlFilter(mapping ColumnMapping) (string, error) {
+	for _, pa := range p.Clause {
+		if pa.compatWith != "" {
+			return "", errors.New(fmt.Sprintf("policy: %s conditions can't be compiled to SQL", CompatibleWith))
+		}
+	}
+	scope := p.sqlScope(mapping)
+	if !p.Mode {
+		// the allowing exceptions of DENY clauses are ignored
+		return sqlNot(scope), nil
+	}
+	conds := []string{scope}
+	for i := range p.Excepts {
+		ex := &p.Excepts[i]
+		if ex.Monitor {
+			continue
+		}
+		c, err := ex.sqlFilter(mapping)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, c)
+	}
+	return sqlAnd(conds), nil
+}
+
+// sqlScope returns the filter of the rows in the scope of the clause: within
+// the downsets of an ALLOW clause, or overlapping every value of a DENY clause
+func (p *Policy) sqlScope(mapping ColumnMapping) string {
+	attrs := make([]string, 0, len(mapping))
+	for attr := range mapping {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+
+	conds := make([]string, 0)
+	for _, attr := range attrs {
+		col := mapping[attr]
+		pvs := p.Clause.ValuesOf(attr)
+		if !p.Mode && len(pvs) == 0 {
+			continue
+		}
+		var cond string
+		if p.isNumeric(attr) {
+			cond = sqlNumeric(col, pvs, p.Mode)
+		} else {
+			l := p.baseOn[attr]
+			es := make([]string, 0)
+			for _, e := range l.Elements() {
+				if e == Bottom {
+					continue
+				}
+				if (p.Mode && l.Allow(pvs, []string{e})) || (!p.Mode && l.Deny(pvs, []string{e})) {
+					es = append(es, e)
+				}
+			}
+			cond = sqlIn(col, es)
+		}
+		// rows without a value are in the scope of the clause
+		conds = append(conds, sqlOr([]string{col + " IS NULL", cond}))
+	}
+	return sqlAnd(conds)
+}
+
+// sqlNumeric returns the filter of the values satisfying some predicates (in
+// an ALLOW clause) or all of them (in a DENY clause)
+func sqlNumeric(col string, preds []string, allow bool) string {
+	conds := make([]string, 0, len(preds))
+	for _, pred := range preds {
+		op, v, err := parsePredicate(pred)
+		if err != nil {
+			continue
+		}
+		if op == "!=" {
+			op = "<>"
+		}
+		conds = append(conds, fmt.Sprintf("%s %s %s", col, op, formatNumber(v)))
+	}
+	if allow {
+		return sqlOr(conds)
+	}
+	return sqlAnd(conds)
+}
+
+// sqlIn returns the filter of the rows whose column is one of some values
+func sqlIn(col string, values []string) string {
+	if len(values) == 0 {
+		return sqlFalse
+	}
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, "'"+strings.Replace(v, "'", "''", -1)+"'")
+	}
+	return fmt.Sprintf("%s IN (%s)", col, strings.Join(quoted, ", "))
+}
+
+func sqlAnd(conds []string) string {
+	return sqlJoin(conds, " AND ", sqlTrue, sqlFalse)
+}
+
+func sqlOr(conds []string) string {
+	return sqlJoin(conds, " OR ", sqlFalse, sqlTrue)
+}
+
+// sqlJoin joins conditions with an operator, whose neutral condition is
+// dropped and whose absorbing condition absorbs the others
+func sqlJoin(conds []string, op, neutral, absorbing string) string {
+	res := make([]string, 0, len(conds))
+	for _, c := range conds {
+		switch c {
+		case neutral:
+		case absorbing:
+			return absorbing
+		default:
+			res = append(res, c)
+		}
+	}
+	switch len(res) {
+	case 0:
+		return neutral
+	case 1:
+		return res[0]
+	}
+	return "(" + strings.Join(res, op) + ")"
+}
+
+func sqlNot(cond string) string {
+	switch cond {
+	case sqlTrue:
+		return sqlFalse
+	case sqlFalse:
+		return sqlTrue
+	}
+	return "NOT " + cond
+}
@@ -0,0 +1,62 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestToSQLFilter(t *testing.T) {
+	mapping := ColumnMapping{"DataType": "data_type"}
+	cases := []struct {
+		pstr, filter string
+	}{
+		{"ALLOW DataType Location", "(data_type IS NULL OR data_type IN ('IPAddress', 'Location'))"},
+		{"DENY DataType AccountID", "NOT (data_type IS NULL OR data_type IN ('AccountID', 'TOP', 'UniqueID'))"},
+		{"ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }",
+			"((data_type IS NULL OR data_type IN ('AccountID', 'IPAddress', 'Location', 'TOP', 'UniqueID')) AND " +
+				"NOT (data_type IS NULL OR data_type IN ('TOP', 'UniqueID')))"},
+		{"ALLOW DataType TOP EXCEPT { DENY MODE=monitor DataType AccountID }",
+			"(data_type IS NULL OR data_type IN ('AccountID', 'IPAddress', 'Location', 'TOP', 'UniqueID'))"},
+		{"DENY MODE=monitor DataType AccountID", "1 = 1"},
+		{"DENY DataType UniqueID EXCEPT { ALLOW DataType AccountID }",
+			"NOT (data_type IS NULL OR data_type IN ('AccountID', 'IPAddress', 'Location', 'TOP', 'UniqueID'))"},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, c.pstr)
+		got, err := p.ToSQLFilter(mapping)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got != c.filter {
+			t.Errorf("ToSQLFilter [%q] = %q, want %q", c.pstr, got, c.filter)
+		}
+	}
+}
+
+func TestToSQLFilterNumeric(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	if err := p.DefineNumeric(Epsilon); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if err := p.ParsePolicy("ALLOW DataType Location Epsilon <=1.0 Epsilon =2 EXCEPT { DENY DataType IPAddress Epsilon >0.5 Epsilon !=2 }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := "(((data_type IS NULL OR data_type IN ('IPAddress', 'Location')) AND (epsilon IS NULL OR (epsilon <= 1 OR epsilon = 2))) AND " +
+		"NOT ((data_type IS NULL OR data_type IN ('IPAddress', 'Location', 'TOP', 'UniqueID')) AND (epsilon IS NULL OR (epsilon > 0.5 AND epsilon <> 2))))"
+	if got, err := p.ToSQLFilter(ColumnMapping{"DataType": "data_type", Epsilon: "epsilon"}); err != nil || got != want {
+		t.Errorf("ToSQLFilter() = %q, %v, want %q", got, err, want)
+	}
+	if _, err := p.ToSQLFilter(ColumnMapping{"Purpose": "purpose"}); err == nil {
+		t.Errorf("ToSQLFilter() with an unknown attribute = nil error")
+	}
+}
+
+func TestColumnMappingFor(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	if err := p.DefineNumeric(Epsilon); err != nil {
+		t.Fatalf("%q", err)
+	}
+	m := ColumnMapping{"DataType": "data_type", string(Epsilon): "epsilon", "Purpose": "purpose"}.For(p)
+	if len(m) != 2 || m["DataType"] != "data_type" || m[string(Epsilon)] != "epsilon" {
+		t.Errorf("For() = %v", m)
+	}
+}
@@ -0,0 +1,140 @@
+package grok
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Summarize returns plain-language rules implied by a policy, for privacy
+// review documents: the top-level permission, each exception (indented by
+// its depth), and the net effect of the policy on the data made of the
+// elements it mentions, e.g.
+//
+//	Allows data with any DataType and any Purpose.
+//	  Except: denies data with DataType IPAddress together with AccountID.
+//	Net effect: DataType IPAddress alone is allowed.
+//	Net effect: DataType IPAddress together with AccountID is denied.
+func Summarize(p *Policy) []string {
+	lines := make([]string, 0)
+	summarizeRules(p, 0, &lines)
+
+	is := "is"
+	if p.Monitor {
+		is = "would be"
+	}
+	for _, an := range keyAnnotations(p) {
+		decision := "denied"
+		if p.apply(an, nil, nil) {
+			decision = "allowed"
+		}
+		lines = append(lines, fmt.Sprintf("Net effect: %s %s %s.", describeData(an), is, decision))
+	}
+	return lines
+}
+
+// summarizeRules appends the rules of a policy and of its exceptions
+func summarizeRules(p *Policy, depth int, lines *[]string) {
+	verb := "Denies"
+	if p.Mode {
+		verb = "Allows"
+	}
+	if depth > 0 {
+		verb = "Except: " + strings.ToLower(verb)
+	}
+	rule := fmt.Sprintf("%s%s data with %s", strings.Repeat("  ", depth), verb, describeClause(p.Clause, p.Mode))
+	if p.Monitor {
+		rule += " (in monitor mode: recorded, not enforced)"
+	}
+	*lines = append(*lines, rule+".")
+	for i := range p.Excepts {
+		summarizeRules(&p.Excepts[i], depth+1, lines)
+	}
+}
+
+// describeClause describes the data in the scope of a clause: data within
+// (any of) the values of an ALLOW clause, and data with all the values of a
+// DENY clause
+func describeClause(c Clause, allow bool) string {
+	if len(c) == 0 {
+		return "anything"
+	}
+	r := new(Renderer)
+	parts := make([]string, 0)
+	for _, attr := range attributesOf(c) {
+		labels := make([]string, 0)
+		top := false
+		for _, pa := range c {
+			if pa.name != attr {
+				continue
+			}
+			if pa.value == Top {
+				top = true
+			}
+			label := r.Label(pa.value)
+			if pa.compatWith != "" {
+				label += " compatible with " + pa.compatWith
+			}
+			labels = append(labels, label)
+		}
+		switch {
+		case top && allow:
+			parts = append(parts, "any "+attr)
+		case allow:
+			parts = append(parts, attr+" within "+strings.Join(labels, " or "))
+		default:
+			parts = append(parts, attr+" "+strings.Join(labels, " together with "))
+		}
+	}
+	return strings.Join(parts, " and ")
+}
+
+// describeData describes an annotation, e.g. "DataType IPAddress together
+// with AccountID and Purpose Sharing", or "... alone" for a single value
+func describeData(an Annotation) string {
+	s := describeClause(Clause(an), false)
+	if len(an) == 1 {
+		s += " alone"
+	}
+	return s
+}
+
+// keyAnnotations returns the annotations whose decisions sum up a policy:
+// every element the policy mentions alone, then the lattice values of every
+// clause together
+func keyAnnotations(p *Policy) []Annotation {
+	ans := make([]Annotation, 0)
+	seen := make(map[string]bool)
+	add := func(an Annotation) {
+		if len(an) > 0 && !seen[an.String()] {
+			seen[an.String()] = true
+			ans = append(ans, an)
+		}
+	}
+	clauses := make([]Clause, 0)
+	var collect func(p *Policy)
+	collect = func(p *Policy) {
+		clauses = append(clauses, p.Clause)
+		for i := range p.Excepts {
+			collect(&p.Excepts[i])
+		}
+	}
+	collect(p)
+
+	together := make([]Annotation, 0)
+	for _, c := range clauses {
+		an := make(Annotation, 0, len(c))
+		for _, pa := range c {
+			if _, ok := p.baseOn[pa.name]; ok && pa.value != Top && pa.value != Bottom {
+				an = append(an, pair{name: pa.name, value: pa.value})
+				add(Annotation{{name: pa.name, value: pa.value}})
+			}
+		}
+		together = append(together, an)
+	}
+	for _, an := range together {
+		if len(an) > 1 {
+			add(an)
+		}
+	}
+	return ans
+}
@@ -0,0 +1,36 @@
+package grok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	cases := []struct {
+		pstr string
+		want []string
+	}{
+		{"ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }", []string{
+			"Allows data with any DataType.",
+			"  Except: denies data with DataType IPAddress together with AccountID.",
+			"Net effect: DataType IPAddress alone is allowed.",
+			"Net effect: DataType AccountID alone is allowed.",
+			"Net effect: DataType IPAddress together with AccountID is denied.",
+		}},
+		{"DENY MODE=monitor DataType UniqueID EXCEPT { ALLOW DataType AccountID DataType Location }", []string{
+			"Denies data with DataType UniqueID (in monitor mode: recorded, not enforced).",
+			"  Except: allows data with DataType within AccountID or Location.",
+			"Net effect: DataType UniqueID alone would be denied.",
+			"Net effect: DataType AccountID alone would be allowed.",
+			// Location doesn't overlap UniqueID
+			"Net effect: DataType Location alone would be allowed.",
+			"Net effect: DataType AccountID together with Location would be allowed.",
+		}},
+	}
+	for _, c := range cases {
+		got := Summarize(newScopedPolicy(t, c.pstr))
+		if strings.Join(got, "\n") != strings.Join(c.want, "\n") {
+			t.Errorf("Summarize(%q) =\n%s\nwant\n%s", c.pstr, strings.Join(got, "\n"), strings.Join(c.want, "\n"))
+		}
+	}
+}
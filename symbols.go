@@ -0,0 +1,114 @@
+package grok
+
+// Symbols interns the elements of a lattice as integer IDs. A compiled
+// lattice works on IDs internally, and converts elements to IDs (and back)
+// at the boundaries of its API, so that evaluation compares integers and
+// tests bits instead of comparing strings and scanning slices.
+type Symbols struct {
+	ids   map[string]int
+	names []string
+}
+
+// NewSymbols returns an empty symbol table
+func NewSymbols() *Symbols {
+	return &Symbols{make(map[string]int), make([]string, 0)}
+}
+
+// Intern returns the ID of an element, adding it to the table if missing.
+// IDs are assigned in sequence from 0.
+func (s *Symbols) Intern(name string) int {
+	if id, ok := s.ids[name]; ok {
+		return id
+	}
+	id := len(s.names)
+	s.ids[name] = id
+	s.names = append(s.names, name)
+	return id
+}
+
+// ID returns the ID of an element, and false if it isn't in the table
+func (s *Symbols) ID(name string) (int, bool) {
+	id, ok := s.ids[name]
+	return id, ok
+}
+
+// IDs returns the IDs of elements, and false if any isn't in the table
+func (s *Symbols) IDs(names []string) ([]int, bool) {
+	ids := make([]int, len(names))
+	for i, name := range names {
+		id, ok := s.ids[name]
+		if !ok {
+			return nil, false
+		}
+		ids[i] = id
+	}
+	return ids, true
+}
+
+// Name returns the element of an ID
+func (s *Symbols) Name(id int) string {
+	return s.names[id]
+}
+
+// Names returns the elements of the table, indexed by ID
+func (s *Symbols) Names() []string {
+	return append([]string(nil), s.names...)
+}
+
+// Len returns the number of elements in the table
+func (s *Symbols) Len() int {
+	return len(s.names)
+}
+
+// bitset is a set of IDs
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(id int) {
+	b[id/64] |= 1 << uint(id%64)
+}
+
+func (b bitset) has(id int) bool {
+	return b[id/64]&(1<<uint(id%64)) != 0
+}
+
+// union adds the IDs of c to b
+func (b bitset) union(c bitset) {
+	for w := range b {
+		b[w] |= c[w]
+	}
+}
+
+// intersect returns a new bitset of the IDs in both b and c
+func (b bitset) intersect(c bitset) bitset {
+	r := make(bitset, len(b))
+	for w := range b {
+		r[w] = b[w] & c[w]
+	}
+	return r
+}
+
+// covers returns true when every ID of c is in b
+func (b bitset) covers(c bitset) bool {
+	for w := range b {
+		if c[w]&^b[w] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// each calls fn on every ID of b, in increasing order
+func (b bitset) each(fn func(id int)) {
+	for w, word := range b {
+		for i := 0; word != 0; i++ {
+			if word&1 != 0 {
+				fn(w*64 + i)
+			}
+			word >>= 1
+		}
+	}
+}
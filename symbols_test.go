@@ -0,0 +1,52 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestSymbols(t *testing.T) {
+	s := NewSymbols()
+	if s.Intern("TOP") != 0 || s.Intern("IPAddress") != 1 || s.Intern("TOP") != 0 {
+		t.Errorf("Intern() doesn't assign IDs in sequence")
+	}
+	if id, ok := s.ID("IPAddress"); !ok || id != 1 || s.Name(id) != "IPAddress" {
+		t.Errorf("ID(IPAddress) = %d, %t", id, ok)
+	}
+	if _, ok := s.ID("AccountID"); ok {
+		t.Errorf("ID(AccountID) should be missing")
+	}
+	if _, ok := s.IDs([]string{"TOP", "AccountID"}); ok {
+		t.Errorf("IDs() should fail on a missing element")
+	}
+	if ids, ok := s.IDs([]string{"IPAddress", "TOP"}); !ok || len(ids) != 2 || ids[0] != 1 || ids[1] != 0 {
+		t.Errorf("IDs() = %v, %t", ids, ok)
+	}
+	if got := s.Names(); s.Len() != 2 || len(got) != 2 || got[1] != "IPAddress" {
+		t.Errorf("Names() = %q", got)
+	}
+}
+
+func TestBitset(t *testing.T) {
+	b := newBitset(130)
+	for _, id := range []int{0, 64, 129} {
+		b.set(id)
+	}
+	c := newBitset(130)
+	c.set(64)
+	c.set(1)
+	if !b.has(129) || b.has(1) {
+		t.Errorf("has() is wrong")
+	}
+	ids := make([]int, 0)
+	b.intersect(c).each(func(id int) { ids = append(ids, id) })
+	if len(ids) != 1 || ids[0] != 64 {
+		t.Errorf("intersect() = %v", ids)
+	}
+	if b.covers(c) {
+		t.Errorf("covers() should be false")
+	}
+	b.union(c)
+	if !b.covers(c) {
+		t.Errorf("covers() should be true after union()")
+	}
+}
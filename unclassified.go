@@ -0,0 +1,168 @@
+package grok
+
+import (
+	"errors"
+	"strings"
+)
+
+// UnknownElement is the standard value of the data that isn't classified
+// yet, e.g. DataType Unknown for a column that no labeler has labeled. The
+// lattices don't define it: how it's evaluated is a setting of the policy
+// (see UnclassifiedValues). A lattice that defines it as an element keeps its
+// own element.
+const UnknownElement = "Unknown"
+
+// UnclassifiedValues is how a policy evaluates the UnknownElement values of a
+// lattice attribute in annotations
+type UnclassifiedValues int
+
+const (
+	// RejectUnclassified doesn't have the convention: Unknown is an invalid
+	// value unless the lattice defines it
+	RejectUnclassified UnclassifiedValues = iota
+	// ConservativeUnclassified evaluates Unknown as TOP, i.e. the data may be
+	// anything, which denies it wherever a deny could apply
+	ConservativeUnclassified
+	// PermissiveUnclassified evaluates Unknown as BOTTOM, i.e. the data is
+	// nothing in particular, which allows it wherever an allow applies
+	PermissiveUnclassified
+)
+
+// unclassifiedOf returns how the Unknown values of an attribute are
+// evaluated
+func (p *Policy) unclassifiedOf(attr string) UnclassifiedValues {
+	if l := p.baseOn[attr]; l == nil || l.hasElement(UnknownElement) {
+		return RejectUnclassified
+	}
+	if u, ok := p.UnclassifiedOf[attr]; ok {
+		return u
+	}
+	return p.Unclassified
+}
+
+// isUnclassified returns true when an element of a lattice attribute is the
+// UnknownElement of the convention
+func (p *Policy) isUnclassified(s, attr string) bool {
+	return s == UnknownElement && p.unclassifiedOf(attr) != RejectUnclassified
+}
+
+// hasUnclassified returns true when a value of the clause is Unknown, or the
+// Unknown of a value set or a product value
+func (p *Policy) hasUnclassified(c Clause) bool {
+	for _, pa := range c {
+		if p.unclassifiedOf(pa.name) == RejectUnclassified {
+			continue
+		}
+		_, members, ok := parseValueSet(pa.value)
+		if !ok {
+			members = []string{pa.value}
+		}
+		for _, m := range members {
+			if m == UnknownElement || strings.HasPrefix(m, UnknownElement+ProductSeparator) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// classifying returns the context of an evaluation whose Unknown values are
+// evaluated as p says, unless ctx already has a policy saying it, so that
+// the exceptions of p evaluate them as p does
+func (p *Policy) classifying(ctx *evalContext) *evalContext {
+	if ctx != nil && ctx.classifier != nil || p.Unclassified == RejectUnclassified && len(p.UnclassifiedOf) == 0 {
+		return ctx
+	}
+	c := evalContext{}
+	if ctx != nil {
+		c = *ctx
+	}
+	c.classifier = p
+	return &c
+}
+
+// unclassifiedOf returns how the Unknown values of an attribute are
+// evaluated in the context
+func (ctx *evalContext) unclassifiedOf(attr string) UnclassifiedValues {
+	u := ctx.classifier.unclassifiedOf(attr)
+	if ctx.flipUnclassified && u == ConservativeUnclassified {
+		return PermissiveUnclassified
+	} else if ctx.flipUnclassified && u == PermissiveUnclassified {
+		return ConservativeUnclassified
+	}
+	return u
+}
+
+// classify returns the annotation where the Unknown values evaluated as TOP
+// are replaced by TOP, and the ones evaluated as BOTTOM are removed when
+// their attribute has other values, which they add nothing to. The sole
+// Unknown values evaluated as BOTTOM are kept for valuesOf, since BOTTOM
+// isn't allowed by any clause while a missing attribute is denied by any
+// clause (see Lattice.Allow and Lattice.Deny).
+func (ctx *evalContext) classify(an Annotation) Annotation {
+	if ctx == nil || ctx.classifier == nil || !ctx.classifier.hasUnclassified(Clause(an)) {
+		return an
+	}
+	counts := make(map[string]int)
+	for _, pa := range an {
+		counts[pa.name]++
+	}
+	res := make(Annotation, 0, len(an))
+	for _, pa := range an {
+		base := pa.value
+		if i := strings.Index(base, ProductSeparator); i >= 0 {
+			base = base[:i]
+		}
+		if base == UnknownElement {
+			switch ctx.unclassifiedOf(pa.name) {
+			case ConservativeUnclassified:
+				pa.value = Top + pa.value[len(UnknownElement):]
+			case PermissiveUnclassified:
+				if counts[pa.name] > 1 {
+					counts[pa.name]--
+					continue
+				}
+			}
+		}
+		res = append(res, pa)
+	}
+	return res
+}
+
+// valuesOf returns the values of a lattice attribute of a classified
+// annotation for the clause of an ALLOW policy or a DENY one: a sole Unknown
+// value evaluated as BOTTOM is left out of the former, which BOTTOM precedes
+// every value of, and replaced by BOTTOM in the latter, which BOTTOM
+// overlaps with no value of
+func (ctx *evalContext) valuesOf(an Annotation, attr string, allow bool) []string {
+	vs := an.ValuesOf(attr)
+	if ctx == nil || ctx.classifier == nil || len(vs) != 1 {
+		return vs
+	}
+	base := vs[0]
+	if i := strings.Index(base, ProductSeparator); i >= 0 {
+		base = base[:i]
+	}
+	if base != UnknownElement || ctx.unclassifiedOf(attr) != PermissiveUnclassified {
+		return vs
+	}
+	if allow {
+		return []string{}
+	}
+	return []string{Bottom + vs[0][len(UnknownElement):]}
+}
+
+// dependsOnUnclassified returns true when the effect of the policy on an
+// annotation with Unknown values changes when they're evaluated the other
+// way, e.g. TOP rather than BOTTOM. The evaluation spends the budget of ctx,
+// and doesn't depend on them when it runs out of it.
+func (p *Policy) dependsOnUnclassified(an Annotation, allowed bool, ctx *evalContext) bool {
+	if p.Monitor || !p.hasUnclassified(Clause(an)) {
+		return false
+	}
+	flipped := &evalContext{flipUnclassified: true, budget: ctx.budget}
+	return p.apply(an, nil, flipped) != allowed && !flipped.exceeded()
+}
+
+// errUnclassifiedClause is the error of the policy clauses with Unknown values
+var errUnclassifiedClause = errors.New("policy: " + UnknownElement + " is only allowed in annotations")
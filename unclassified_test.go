@@ -0,0 +1,76 @@
+package grok
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestUnclassified(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }")
+	// without the convention, Unknown isn't a valid value
+	if _, err := p.ParseAnnotation("DataType Unknown"); err == nil {
+		t.Errorf("ParseAnnotation(DataType Unknown) without the convention should fail")
+	}
+
+	cases := []struct {
+		unclassified UnclassifiedValues
+		astr         string
+		allowed      bool
+		depends      bool
+	}{
+		{ConservativeUnclassified, "DataType IPAddress DataType Unknown", false, true},
+		{PermissiveUnclassified, "DataType IPAddress DataType Unknown", true, true},
+		{ConservativeUnclassified, "DataType Unknown", false, true},
+		{PermissiveUnclassified, "DataType Unknown", true, true},
+		{ConservativeUnclassified, "DataType Location DataType ANYOF(Unknown,AccountID)", false, false},
+		{PermissiveUnclassified, "DataType Location", true, false},
+	}
+	for _, c := range cases {
+		p.Unclassified = c.unclassified
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if d := p.Evaluate(an); d.Allowed != c.allowed || d.Unclassified != c.depends {
+			t.Errorf("Evaluate(%s) with %d = %t, %t, want %t, %t", c.astr, c.unclassified, d.Allowed, d.Unclassified, c.allowed, c.depends)
+		}
+	}
+
+	// the attributes override the policy, and the decisions that depended
+	// on Unknown values are recorded and counted
+	p.Unclassified = ConservativeUnclassified
+	p.UnclassifiedOf = map[string]UnclassifiedValues{"DataType": PermissiveUnclassified}
+	an, err := p.ParseAnnotation("DataType IPAddress DataType Unknown")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	var buf bytes.Buffer
+	u := NewUsageTracker()
+	if d := p.Evaluate(an, WithAuditSink(NewRecordWriter(&buf)), WithUsage(u)); !d.Allowed || !d.Unclassified {
+		t.Errorf("Evaluate() with UnclassifiedOf = %+v", d)
+	}
+	if !strings.Contains(buf.String(), `"unclassified":true`) || u.UsageReport().Unclassified != 1 {
+		t.Errorf("the record = %s, the report = %+v", buf.String(), u.UsageReport())
+	}
+
+	if err := p.ParsePolicy("ALLOW DataType TOP EXCEPT { DENY DataType Unknown }"); err == nil || err.Error() != "policy: Unknown is only allowed in annotations" {
+		t.Errorf("ParsePolicy() with Unknown = %v", err)
+	}
+}
+
+func TestUnclassifiedElement(t *testing.T) {
+	// a lattice defining Unknown keeps its element
+	p := NewPolicy([]*Lattice{NewLattice(`{ "name": "DataType", "edges": { "Sensitive": ["Unknown"] } }`)})
+	p.Unclassified = ConservativeUnclassified
+	if err := p.ParsePolicy("ALLOW DataType Sensitive EXCEPT { DENY DataType Unknown }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	an, err := p.ParseAnnotation("DataType Unknown")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if d := p.Evaluate(an); d.Allowed || d.Unclassified {
+		t.Errorf("Evaluate() = %+v", d)
+	}
+}
@@ -0,0 +1,41 @@
+package grok
+
+import (
+	"sort"
+)
+
+// UnknownAttributes is how a policy handles the annotation attributes it
+// doesn't know, i.e. that aren't lattices, numeric or compatibility attributes
+// of the policy. In federated settings annotations legitimately carry
+// attributes of other domains.
+type UnknownAttributes int
+
+const (
+	// RejectUnknown fails to parse annotations with unknown attributes
+	RejectUnknown UnknownAttributes = iota
+	// IgnoreUnknown keeps the unknown pairs of annotations, so that they
+	// round-trip, and evaluates annotations as if they were missing
+	IgnoreUnknown
+	// FlagUnknown is IgnoreUnknown, and also reports the unknown attributes
+	// in decisions and their audit records
+	FlagUnknown
+)
+
+// isAttribute returns true when name is an attribute known to the policy
+func (p *Policy) isAttribute(name string) bool {
+	_, ok := p.baseOn[name]
+	return ok || p.isNumeric(name) || p.isCompatibility(name)
+}
+
+// UnknownAttributesOf returns the sorted attributes of an annotation that
+// aren't known to the policy
+func (p *Policy) UnknownAttributesOf(an Annotation) []string {
+	unknown := make([]string, 0)
+	for _, pa := range an {
+		if !p.isAttribute(pa.name) && !contains(unknown, pa.name) {
+			unknown = append(unknown, pa.name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
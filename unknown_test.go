@@ -0,0 +1,69 @@
+package grok
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAnnotationUnknown(t *testing.T) {
+	p := newScopedPolicy(t, `DENY DataType AccountID`)
+	astr := "DataType AccountID Region EU DataType IPAddress"
+	if _, err := p.ParseAnnotation(astr); err == nil {
+		t.Errorf("ParseAnnotation() should reject unknown attributes by default")
+	}
+
+	p.Unknown = IgnoreUnknown
+	an, err := p.ParseAnnotation(astr)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := an.String(); got != astr {
+		t.Errorf("String() = %q, want %q", got, astr)
+	}
+	b, err := json.Marshal(an)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	var back Annotation
+	if err := json.Unmarshal(b, &back); err != nil || back.String() != astr {
+		t.Errorf("JSON round-trip = %q, %v", back, err)
+	}
+	if got := p.UnknownAttributesOf(an); !equals(got, []string{"Region"}) {
+		t.Errorf("UnknownAttributesOf() = %q", got)
+	}
+
+	// policies never accept unknown attributes
+	if err := p.ParsePolicy(`DENY Region EU`); err == nil {
+		t.Errorf("ParsePolicy() should reject unknown attributes")
+	}
+	// a known attribute with an invalid value is still an error
+	if _, err := p.ParseAnnotation("DataType Unknown Region EU"); err == nil {
+		t.Errorf("ParseAnnotation() should reject invalid values of known attributes")
+	}
+}
+
+func TestEvaluateUnknown(t *testing.T) {
+	cases := []struct {
+		mode    UnknownAttributes
+		unknown []string
+	}{
+		{IgnoreUnknown, nil},
+		{FlagUnknown, []string{"Owner", "Region"}},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, `DENY DataType AccountID`)
+		p.Unknown = c.mode
+		an, err := p.ParseAnnotation("Region EU DataType AccountID Owner Team1 Region US")
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		sink := &memorySink{}
+		d := p.Evaluate(an, WithAuditSink(sink))
+		if d.Allowed || !equals(d.Unknown, c.unknown) || len(d.Unknown) != len(c.unknown) {
+			t.Errorf("Evaluate() with mode %d = %+v", c.mode, d)
+		}
+		if !equals(sink.records[0].Unknown, c.unknown) {
+			t.Errorf("record = %+v", sink.records[0])
+		}
+	}
+}
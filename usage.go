@@ -0,0 +1,185 @@
+package grok
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// UsageTracker counts the lattice elements that appear in the evaluated
+// annotations, and how often the clauses of the policies fire, so that
+// taxonomy owners retire the elements that are never used and tighten the
+// broad allows that are hit the most. Evaluations are tracked with
+// WithUsage. A tracker is safe for concurrent use, and may be shared by the
+// policies of a set.
+type UsageTracker struct {
+	mu                        sync.Mutex
+	evaluations, unclassified int64
+	// roots are the tracked policies in the order they were first evaluated
+	roots []*Policy
+	seen  map[*Policy]bool
+	// elements are the counts of elements by lattice, fired the number of
+	// times the clause of a policy or an exception matched
+	elements map[string]map[string]int64
+	fired    map[*Policy]int64
+}
+
+// UsageReport is the usage tracked by a UsageTracker
+type UsageReport struct {
+	Evaluations int64
+	// Unclassified is the number of evaluations whose effect depended on
+	// Unknown values (see UnknownElement)
+	Unclassified int64
+	// Elements are the number of evaluated annotations that have an element,
+	// by lattice and element. The elements of value sets and of product
+	// values are counted, the parameters of parameterized elements aren't.
+	Elements map[string]map[string]int64
+	// Unused are the sorted elements of the lattices of the policies that
+	// no evaluated annotation has, by lattice. TOP and BOTTOM are left out.
+	Unused map[string][]string
+	// Clauses are the clauses of the policies and their exceptions, in the
+	// order of the policy texts
+	Clauses []ClauseUsage
+}
+
+// ClauseUsage is the number of times the clause of a policy or of an
+// exception matched an annotation
+type ClauseUsage struct {
+	PolicyID string
+	// Path locates the exception in the policy like NodeProfile.Path, and is
+	// empty for the top-level policy
+	Path   string
+	Mode   bool
+	Clause Clause
+	Fired  int64
+}
+
+// NewUsageTracker returns an empty tracker
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{seen: make(map[*Policy]bool), elements: make(map[string]map[string]int64),
+		fired: make(map[*Policy]int64)}
+}
+
+// WithUsage tracks the usage of the evaluation in a tracker. Exceptions in
+// monitor mode fire like the others.
+func WithUsage(u *UsageTracker) EvalOption {
+	return func(ctx *evalContext) {
+		ctx.usage = u
+	}
+}
+
+// observe counts an evaluation of the policy on an annotation
+func (u *UsageTracker) observe(p *Policy, an Annotation) {
+	counted := make(map[[2]string]bool)
+	var count func(l *Lattice, v string)
+	count = func(l *Lattice, v string) {
+		if _, members, ok := parseValueSet(v); ok {
+			for _, m := range members {
+				count(l, m)
+			}
+			return
+		}
+		if l.isProductValue(v) {
+			a, s := l.halve(v)
+			counted[[2]string{l.state().Name, baseOf(s)}] = true
+			v = a
+		}
+		counted[[2]string{l.Name, baseOf(v)}] = true
+	}
+	for _, pa := range an {
+		if l := p.baseOn[pa.name]; l != nil {
+			count(l, pa.value)
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.evaluations++
+	if !u.seen[p] {
+		u.seen[p] = true
+		u.roots = append(u.roots, p)
+	}
+	for k := range counted {
+		if u.elements[k[0]] == nil {
+			u.elements[k[0]] = make(map[string]int64)
+		}
+		u.elements[k[0]][k[1]]++
+	}
+}
+
+// fire counts a match of the clause of a policy or an exception
+func (u *UsageTracker) fire(p *Policy) {
+	u.mu.Lock()
+	u.fired[p]++
+	u.mu.Unlock()
+}
+
+// depended counts an evaluation that depended on Unknown values
+func (u *UsageTracker) depended() {
+	u.mu.Lock()
+	u.unclassified++
+	u.mu.Unlock()
+}
+
+// fired counts a match of the clause of p when the evaluation is tracked.
+// Only the enforcing pass of an evaluation is counted, which applies the
+// exceptions in monitor mode too.
+func (ctx *evalContext) fired(p *Policy) {
+	if ctx != nil && ctx.usage != nil && ctx.enforce {
+		ctx.usage.fire(p)
+	}
+}
+
+// UsageReport returns the usage tracked so far
+func (u *UsageTracker) UsageReport() *UsageReport {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	r := &UsageReport{Evaluations: u.evaluations, Unclassified: u.unclassified, Elements: make(map[string]map[string]int64),
+		Unused: make(map[string][]string), Clauses: make([]ClauseUsage, 0)}
+	for name, es := range u.elements {
+		r.Elements[name] = make(map[string]int64, len(es))
+		for e, n := range es {
+			r.Elements[name][e] = n
+		}
+	}
+
+	var walk func(root, p *Policy, path string)
+	walk = func(root, p *Policy, path string) {
+		r.Clauses = append(r.Clauses, ClauseUsage{PolicyID: root.ID, Path: path, Mode: p.Mode, Clause: p.Clause, Fired: u.fired[p]})
+		for i := range p.Excepts {
+			sub := Except + "[" + strconv.Itoa(i) + "]"
+			if path != "" {
+				sub = path + "." + sub
+			}
+			walk(root, &p.Excepts[i], sub)
+		}
+	}
+	lattices := make(map[string]*Lattice)
+	for _, p := range u.roots {
+		walk(p, p, "")
+		for _, l := range p.lattices() {
+			lattices[l.Name] = l
+		}
+	}
+	for name, l := range lattices {
+		unused := filter(l.Elements(), func(e string) bool {
+			return e != Top && e != Bottom && u.elements[name][e] == 0
+		})
+		if len(unused) > 0 {
+			sort.Strings(unused)
+			r.Unused[name] = unused
+		}
+	}
+	return r
+}
+
+// Unfired returns the clauses that never fired
+func (r *UsageReport) Unfired() []ClauseUsage {
+	cs := make([]ClauseUsage, 0)
+	for _, c := range r.Clauses {
+		if c.Fired == 0 {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
@@ -0,0 +1,52 @@
+package grok
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestUsageTracker(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID DENY MODE=monitor DataType Location }")
+	u := NewUsageTracker()
+	var wg sync.WaitGroup
+	for _, astr := range []string{"DataType IPAddress", "DataType IPAddress DataType AccountID", "DataType IPAddress", "DataType ANYOF(IPAddress,AccountID)"} {
+		an, err := p.ParseAnnotation(astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Evaluate(an, WithUsage(u))
+		}()
+	}
+	wg.Wait()
+	// untracked evaluations aren't counted
+	p.Evaluate(Annotation{{name: "DataType", value: "Location"}})
+
+	r := u.UsageReport()
+	if r.Evaluations != 4 || r.Elements["DataType"]["IPAddress"] != 4 || r.Elements["DataType"]["AccountID"] != 2 {
+		t.Errorf("UsageReport().Elements = %v", r.Elements)
+	}
+	if !equals(r.Unused["DataType"], []string{"Location", "UniqueID"}) {
+		t.Errorf("UsageReport().Unused = %v", r.Unused)
+	}
+	// the alternatives of an ANYOF set are applied until one is denied, here
+	// by the exception in monitor mode, and the first denying exception
+	// stops the others
+	fired := []struct {
+		path  string
+		fired int64
+	}{{"", 4}, {"EXCEPT[0]", 1}, {"EXCEPT[1]", 3}}
+	if len(r.Clauses) != len(fired) {
+		t.Fatalf("UsageReport().Clauses = %+v", r.Clauses)
+	}
+	for i, c := range fired {
+		if r.Clauses[i].Path != c.path || r.Clauses[i].Fired != c.fired {
+			t.Errorf("UsageReport().Clauses[%d] = %+v, want %s fired %d times", i, r.Clauses[i], c.path, c.fired)
+		}
+	}
+	if len(r.Unfired()) != 0 {
+		t.Errorf("Unfired() = %+v", r.Unfired())
+	}
+}
@@ -0,0 +1,111 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validate returns the semantic issues of a parsed policy: exceptions nested
+// more than ExceptDepthWarning levels deep, which are hard to read and slow to
+// evaluate, and the exceptions whose scope is disjoint from the scope of their
+// parent clause, which never fire and are almost always authoring bugs, e.g.
+//
+//	ALLOW DataType Location EXCEPT { DENY DataType AccountID }
+//
+// An exception is disjoint from its parent on a lattice attribute when one of
+// its values (for a DENY exception, whose values must all be overlapped) or
+// all of them (for an ALLOW exception) meet none of the parent values at
+// BOTTOM. Exceptions are numbered from 1, and nested ones by their path, e.g.
+// 2.1 is the first exception of the second one. The clauses violating the
+// constraints of the policy (see Constraints), and the deprecated elements
+// that the policy still uses are issues too.
+func (p *Policy) Validate() []error {
+	errs := make([]error, 0)
+	if d := p.exceptDepth(); d > ExceptDepthWarning {
+		errs = append(errs, errors.New(fmt.Sprintf("policy: exceptions are nested %d levels deep, more than %d, which is hard to read and slow to evaluate",
+			d, ExceptDepthWarning)))
+	}
+	p.validate(p, "", &errs)
+	for _, err := range p.CheckConstraints(Annotation(p.Clause)) {
+		errs = append(errs, errors.New(fmt.Sprintf("policy: the clause (%s) violates a constraint: %s", p.rule(), strings.TrimPrefix(err.Error(), "policy: "))))
+	}
+	return append(errs, p.deprecatedUses()...)
+}
+
+// validate appends the issues of the exceptions of p, whose constraints are
+// those of the root policy
+func (p *Policy) validate(root *Policy, path string, errs *[]error) {
+	for i := range p.Excepts {
+		ex := &p.Excepts[i]
+		expath := fmt.Sprintf("%s%d", path, i+1)
+		if attr, ok := p.disjointFrom(ex); ok {
+			*errs = append(*errs, errors.New(fmt.Sprintf("policy: exception %s (%s) doesn't overlap its parent clause on %s, and never applies",
+				expath, ex.rule(), attr)))
+		}
+		for _, err := range root.CheckConstraints(Annotation(ex.Clause)) {
+			*errs = append(*errs, errors.New(fmt.Sprintf("policy: exception %s (%s) violates a constraint: %s",
+				expath, ex.rule(), strings.TrimPrefix(err.Error(), "policy: "))))
+		}
+		ex.validate(root, expath+".", errs)
+	}
+}
+
+// exceptDepth returns the nesting depth of the exceptions of a policy
+func (p *Policy) exceptDepth() int {
+	depth := 0
+	for i := range p.Excepts {
+		if d := p.Excepts[i].exceptDepth() + 1; d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// disjointFrom returns the first lattice attribute on which the scope of an
+// exception is disjoint from the scope of the policy
+func (p *Policy) disjointFrom(ex *Policy) (string, bool) {
+	for _, attr := range p.latticeNames() {
+		pvs, evs := p.Clause.ValuesOf(attr), ex.Clause.ValuesOf(attr)
+		if len(pvs) == 0 || len(evs) == 0 {
+			continue
+		}
+		l := p.baseOn[attr]
+		disjoint := 0
+		for _, ev := range evs {
+			overlaps := false
+			for _, pv := range pvs {
+				if !l.isBottom(l.Meet(pv, ev)) {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				disjoint++
+			}
+		}
+		if (!ex.Mode && disjoint > 0) || (ex.Mode && disjoint == len(evs)) {
+			return attr, true
+		}
+	}
+	return "", false
+}
+
+// isBottom returns true for BOTTOM, and for product values with a BOTTOM half
+func (l *Lattice) isBottom(a string) bool {
+	if l.isProductValue(a) {
+		fst, snd := l.halve(a)
+		return fst == Bottom || snd == Bottom
+	}
+	return a == Bottom
+}
+
+// rule returns the mode and the clause of a policy in the policy syntax,
+// without its exceptions
+func (p *Policy) rule() string {
+	mode := Deny
+	if p.Mode {
+		mode = Allow
+	}
+	return strings.TrimSpace(mode + " " + p.Clause.String())
+}
@@ -0,0 +1,106 @@
+package grok
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		pstr string
+		errs []string
+	}{
+		{"ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }", nil},
+		{"ALLOW DataType Location EXCEPT { DENY DataType IPAddress }", nil},
+		{"ALLOW DataType Location EXCEPT { DENY DataType AccountID }", []string{
+			"policy: exception 1 (DENY DataType AccountID) doesn't overlap its parent clause on DataType, and never applies"}},
+		// a DENY exception needs all its values
+		{"ALLOW DataType Location EXCEPT { DENY DataType IPAddress DataType AccountID }", []string{
+			"policy: exception 1 (DENY DataType IPAddress DataType AccountID) doesn't overlap its parent clause on DataType, and never applies"}},
+		// an ALLOW exception needs one of its values
+		{"DENY DataType Location EXCEPT { ALLOW DataType IPAddress DataType AccountID }", nil},
+		{"DENY DataType Location EXCEPT { ALLOW DataType AccountID }", []string{
+			"policy: exception 1 (ALLOW DataType AccountID) doesn't overlap its parent clause on DataType, and never applies"}},
+		{"ALLOW DataType Location EXCEPT { DENY DataType Location EXCEPT { ALLOW DataType AccountID } DENY DataType AccountID }", []string{
+			"policy: exception 1.1 (ALLOW DataType AccountID) doesn't overlap its parent clause on DataType, and never applies",
+			"policy: exception 2 (DENY DataType AccountID) doesn't overlap its parent clause on DataType, and never applies"}},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, c.pstr)
+		errs := p.Validate()
+		got := make([]string, 0, len(errs))
+		for _, err := range errs {
+			got = append(got, err.Error())
+		}
+		if len(got) != len(c.errs) {
+			t.Errorf("Validate(%q) = %q, want %q", c.pstr, got, c.errs)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.errs[i] {
+				t.Errorf("Validate(%q) = %q, want %q", c.pstr, got, c.errs)
+				break
+			}
+		}
+	}
+}
+
+func TestValidateProduct(t *testing.T) {
+	setup()
+	p := NewPolicy([]*Lattice{lattice})
+	if err := p.ParsePolicy("ALLOW DataType AccountID:Hashed EXCEPT { DENY DataType AccountID:Encrypted }"); err != nil {
+		t.Fatalf("%q", err)
+	}
+	if errs := p.Validate(); len(errs) != 1 {
+		t.Errorf("Validate() = %q, want one error", errs)
+	}
+}
+
+// nested returns a policy whose exceptions are nested depth levels deep
+func nested(depth int) string {
+	modes := []string{Allow, Deny}
+	pstr := ""
+	for d := depth; d >= 0; d-- {
+		rule := modes[d%2] + " DataType TOP"
+		if pstr != "" {
+			rule += " EXCEPT { " + pstr + " }"
+		}
+		pstr = rule
+	}
+	return pstr
+}
+
+func TestExceptDepth(t *testing.T) {
+	cases := []struct {
+		depth, max int
+		err        string
+		warnings   int
+	}{
+		{ExceptDepthWarning, 0, "", 0},
+		{ExceptDepthWarning + 1, 0, "", 1},
+		{DefaultMaxExceptDepth, 0, "", 1},
+		{DefaultMaxExceptDepth + 1, 0, "policy: exceptions are nested more than 16 levels deep", 0},
+		{2, 2, "", 0},
+		{3, 2, "policy: exceptions are nested more than 2 levels deep", 0},
+	}
+	for _, c := range cases {
+		p := NewPolicy(lattices)
+		p.MaxExceptDepth = c.max
+		err := p.ParsePolicy(nested(c.depth))
+		switch {
+		case c.err != "" && (err == nil || err.Error() != c.err):
+			t.Errorf("ParsePolicy() of depth %d with max %d = %v, want %q", c.depth, c.max, err, c.err)
+		case c.err == "" && err != nil:
+			t.Errorf("ParsePolicy() of depth %d with max %d = %q", c.depth, c.max, err)
+		case c.err == "" && len(p.Validate()) != c.warnings:
+			t.Errorf("Validate() of depth %d = %q, want %d warnings", c.depth, p.Validate(), c.warnings)
+		}
+	}
+	p := NewPolicy(lattices)
+	if err := p.ParsePolicy(nested(ExceptDepthWarning + 1)); err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := "policy: exceptions are nested 5 levels deep, more than 4, which is hard to read and slow to evaluate"
+	if errs := p.Validate(); len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("Validate() = %q, want %q", errs, want)
+	}
+}
@@ -0,0 +1,188 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Value sets are annotation values made of several lattice elements, with
+// declared semantics:
+//
+//	DataType ALLOF(IPAddress,AccountID)
+//
+// means that the data contains every element of the set, and is the same as
+// repeating the attribute (DataType IPAddress DataType AccountID), while
+//
+//	DataType ANYOF(IPAddress,DeviceID)
+//
+// means that the data contains one of the elements, e.g. a table where each row
+// has either an IPAddress or a DeviceID. An annotation with ANYOF sets is
+// allowed only when it's allowed whatever element of each set the data contains,
+// so that a DENY of IPAddress together with DeviceID doesn't deny the table
+// above, while a DENY of either element does.
+//
+// ALLOF sets can be used in policy clauses too, ANYOF sets only in annotations.
+const (
+	AllOf = "ALLOF"
+	AnyOf = "ANYOF"
+)
+
+// parseValueSet returns the kind (ALLOF or ANYOF) and the elements of a value
+// set, and false if s isn't a value set
+func parseValueSet(s string) (string, []string, bool) {
+	for _, kind := range []string{AllOf, AnyOf} {
+		if strings.HasPrefix(s, kind+"(") && strings.HasSuffix(s, ")") {
+			members := make([]string, 0)
+			depth, start := 0, len(kind)+1
+			for i := start; i < len(s)-1; i++ {
+				switch s[i] {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				case ',':
+					if depth == 0 {
+						members = append(members, s[start:i])
+						start = i + 1
+					}
+				}
+			}
+			members = append(members, s[start:len(s)-1])
+			return kind, members, true
+		}
+	}
+	return "", nil, false
+}
+
+// InState returns a value of a product lattice in a state of its state
+// lattice, e.g. IPAddress:Truncated for IPAddress and IPAddress:Raw, member
+// by member for value sets
+func InState(v, state string) string {
+	if kind, members, ok := parseValueSet(v); ok {
+		ms := make([]string, 0, len(members))
+		for _, m := range members {
+			ms = append(ms, InState(m, state))
+		}
+		return kind + "(" + strings.Join(ms, ",") + ")"
+	}
+	if i := strings.Index(v, ProductSeparator); i >= 0 {
+		v = v[:i]
+	}
+	return v + ProductSeparator + state
+}
+
+// latticeValues returns the pairs of a (possibly value set) value of lattice
+// name: the pairs of the elements of an ALLOF set, or a single pair otherwise
+func (p *Policy) latticeValues(s string, name string) ([]pair, error) {
+	kind, members, ok := parseValueSet(s)
+	if !ok {
+		lv, err := p.LatticeValue(s, name)
+		if err != nil {
+			return nil, err
+		}
+		return []pair{{name: name, value: lv}}, nil
+	}
+	if len(members) < 2 {
+		return nil, errors.New(fmt.Sprintf("policy: %s should have at least two elements", s))
+	}
+	pairs := make([]pair, 0, len(members))
+	for _, m := range members {
+		if _, _, ok := parseValueSet(m); ok {
+			return nil, errors.New(fmt.Sprintf("policy: %s can't be nested in %s", m, s))
+		}
+		lv, err := p.LatticeValue(m, name)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{name: name, value: lv})
+	}
+	if kind == AllOf {
+		return pairs, nil
+	}
+	return []pair{{name: name, value: AnyOf + "(" + strings.Join(members, ",") + ")"}}, nil
+}
+
+// hasAnyOf returns true when a value of the clause is an ANYOF set
+func (c Clause) hasAnyOf() bool {
+	for _, p := range c {
+		if kind, _, ok := parseValueSet(p.value); ok && kind == AnyOf {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxAlternatives is the maximum number of alternatives of the annotations
+// that ParseAnnotation and ValidateAnnotation accept
+const MaxAlternatives = 1024
+
+// Alternatives returns the annotations that an annotation with ANYOF sets
+// stands for, where every set is replaced by one of its elements, or the
+// annotation itself if it has no ANYOF set. The number of alternatives is the
+// product of the sizes of the sets, see EachAlternative to enumerate them
+// lazily.
+func (an Annotation) Alternatives() []Annotation {
+	alts := make([]Annotation, 0)
+	an.EachAlternative(func(alt Annotation) bool {
+		alts = append(alts, alt)
+		return true
+	})
+	return alts
+}
+
+// EachAlternative calls fn on the alternatives of an annotation in the order
+// of Alternatives, one at a time, until fn returns false
+func (an Annotation) EachAlternative(fn func(Annotation) bool) {
+	// the positions of the ANYOF sets in the annotation, and their elements
+	at, members := make([]int, 0), make([][]string, 0)
+	for i, pa := range an {
+		if kind, ms, ok := parseValueSet(pa.value); ok && kind == AnyOf {
+			at, members = append(at, i), append(members, ms)
+		}
+	}
+	choice := make([]int, len(at))
+	for {
+		alt := append(make(Annotation, 0, len(an)), an...)
+		for i, j := range at {
+			alt[j].value = members[i][choice[i]]
+		}
+		if !fn(alt) {
+			return
+		}
+		// the next choice, where the last set varies the fastest
+		i := len(choice) - 1
+		for ; i >= 0; i-- {
+			if choice[i]++; choice[i] < len(members[i]) {
+				break
+			}
+			choice[i] = 0
+		}
+		if i < 0 {
+			return
+		}
+	}
+}
+
+// checkAlternatives returns an error when an annotation has more than
+// MaxAlternatives alternatives
+func checkAlternatives(an Annotation) error {
+	n := 1
+	for _, pa := range an {
+		if kind, members, ok := parseValueSet(pa.value); ok && kind == AnyOf {
+			if n *= len(members); n > MaxAlternatives {
+				return errors.New(fmt.Sprintf("policy: annotation has more than %d alternatives", MaxAlternatives))
+			}
+		}
+	}
+	return nil
+}
+
+// valuesOf returns the elements of a value, i.e. the elements of a value set
+// or the value itself
+func valuesOf(v string) []string {
+	if _, members, ok := parseValueSet(v); ok {
+		return members
+	}
+	return []string{v}
+}
@@ -0,0 +1,164 @@
+package grok
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseValueSet(t *testing.T) {
+	cases := []struct {
+		s       string
+		kind    string
+		members []string
+		ok      bool
+	}{
+		{"ANYOF(IPAddress,AccountID)", AnyOf, []string{"IPAddress", "AccountID"}, true},
+		{"ALLOF(IPAddress:Raw,Aggregated(k=5))", AllOf, []string{"IPAddress:Raw", "Aggregated(k=5)"}, true},
+		{"Aggregated(k=5)", "", nil, false},
+		{"IPAddress", "", nil, false},
+	}
+	for _, c := range cases {
+		kind, members, ok := parseValueSet(c.s)
+		if kind != c.kind || !equals(members, c.members) || ok != c.ok {
+			t.Errorf("parseValueSet(%q) = %q, %q, %t", c.s, kind, members, ok)
+		}
+	}
+}
+
+func TestInState(t *testing.T) {
+	cases := []struct{ v, want string }{
+		{"IPAddress", "IPAddress:Truncated"},
+		{"IPAddress:Raw", "IPAddress:Truncated"},
+		{"ANYOF(IPAddress,Email:Raw)", "ANYOF(IPAddress:Truncated,Email:Truncated)"},
+	}
+	for _, c := range cases {
+		if got := InState(c.v, "Truncated"); got != c.want {
+			t.Errorf("InState(%s) = %s, want %s", c.v, got, c.want)
+		}
+	}
+}
+
+func TestParseAnnotationValueSet(t *testing.T) {
+	p := newScopedPolicy(t, `DENY DataType AccountID`)
+	an, err := p.ParseAnnotation("DataType ANYOF(IPAddress, AccountID) DataType ALLOF(Location,UniqueID)")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	if got := an.String(); got != "DataType ANYOF(IPAddress,AccountID) DataType Location DataType UniqueID" {
+		t.Errorf("String() = %q", got)
+	}
+	for _, astr := range []string{
+		"DataType ANYOF(IPAddress)",
+		"DataType ANYOF(IPAddress,Unknown)",
+		"DataType ANYOF(IPAddress,ALLOF(AccountID,Location))",
+	} {
+		if _, err := p.ParseAnnotation(astr); err == nil {
+			t.Errorf("ParseAnnotation(%q) should fail", astr)
+		}
+	}
+	if err := p.ParsePolicy("DENY DataType ANYOF(IPAddress,AccountID)"); err == nil {
+		t.Errorf("ParsePolicy() should reject ANYOF sets")
+	}
+	if err := p.ParsePolicy("DENY DataType ALLOF(IPAddress,AccountID)"); err != nil || len(p.Clause) != 2 {
+		t.Errorf("ParsePolicy() = %v, clause %q", err, p.Clause)
+	}
+}
+
+func TestAlternatives(t *testing.T) {
+	p := newScopedPolicy(t, `DENY DataType AccountID`)
+	an, err := p.ParseAnnotation("DataType ANYOF(IPAddress,AccountID) DataType ANYOF(Location,UniqueID)")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	alts := an.Alternatives()
+	want := []string{
+		"DataType IPAddress DataType Location",
+		"DataType IPAddress DataType UniqueID",
+		"DataType AccountID DataType Location",
+		"DataType AccountID DataType UniqueID",
+	}
+	if len(alts) != len(want) {
+		t.Fatalf("Alternatives() = %q", alts)
+	}
+	for i := range want {
+		if alts[i].String() != want[i] {
+			t.Errorf("Alternatives()[%d] = %q, want %q", i, alts[i], want[i])
+		}
+	}
+}
+
+func TestEachAlternative(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY DataType AccountID }")
+	an, err := p.ParseAnnotation("DataType ANYOF(AccountID,IPAddress,Location) DataType ANYOF(IPAddress,Location,UniqueID)")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	// the enumeration stops at the first denied alternative
+	calls := 0
+	an.EachAlternative(func(alt Annotation) bool {
+		calls++
+		return p.ApplyOn(alt)
+	})
+	if calls != 1 {
+		t.Errorf("EachAlternative() called fn %d times, want 1", calls)
+	}
+	if d := p.Evaluate(an); d.Allowed {
+		t.Errorf("Evaluate(%s) = %+v", an, d)
+	}
+
+	// each alternative is a step of the budget
+	q := newScopedPolicy(t, "ALLOW DataType TOP")
+	if d := q.Evaluate(an, WithBudget(Budget{Steps: 1})); d.Allowed || d.Err != ErrBudgetExceeded {
+		t.Errorf("Evaluate(%s) with a budget of a step = %+v", an, d)
+	}
+
+	// the annotations with too many alternatives are rejected
+	astr := strings.Repeat("DataType ANYOF(AccountID,IPAddress) ", 10)
+	if _, err := p.ParseAnnotation(astr); err != nil {
+		t.Errorf("ParseAnnotation() of %d alternatives = %v", MaxAlternatives, err)
+	}
+	astr += "DataType ANYOF(Location,UniqueID)"
+	want := fmt.Sprintf("policy: annotation has more than %d alternatives", MaxAlternatives)
+	if _, err := p.ParseAnnotation(astr); err == nil || err.Error() != want {
+		t.Errorf("ParseAnnotation() of %d alternatives = %v, want %s", 2*MaxAlternatives, err, want)
+	}
+	big := make(Annotation, 0)
+	for i := 0; i < 11; i++ {
+		big = append(big, pair{name: "DataType", value: "ANYOF(AccountID,IPAddress)"})
+	}
+	if err := p.ValidateAnnotation(big); err == nil || err.Error() != want {
+		t.Errorf("ValidateAnnotation() of %d alternatives = %v, want %s", 2*MaxAlternatives, err, want)
+	}
+}
+
+func TestApplyOnValueSet(t *testing.T) {
+	cases := []struct {
+		pstr string
+		astr string
+		want bool
+	}{
+		// a row has either an IPAddress or an AccountID, never both
+		{"ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }", "DataType ANYOF(IPAddress,AccountID)", true},
+		{"ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }", "DataType ALLOF(IPAddress,AccountID)", false},
+		{"ALLOW DataType TOP EXCEPT { DENY DataType IPAddress DataType AccountID }", "DataType IPAddress DataType AccountID", false},
+		// but any of the rows may have an AccountID
+		{"DENY DataType AccountID", "DataType ANYOF(IPAddress,AccountID)", false},
+		{"DENY DataType IPAddress DataType AccountID", "DataType ANYOF(IPAddress,AccountID)", true},
+		{"ALLOW DataType UniqueID", "DataType ANYOF(AccountID,IPAddress)", true},
+		{"ALLOW DataType UniqueID", "DataType ANYOF(AccountID,Location)", false},
+	}
+	for _, c := range cases {
+		p := newScopedPolicy(t, c.pstr)
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		if got := p.ApplyOn(an); got != c.want {
+			t.Errorf("[%q] ApplyOn [%q] = %t, want %t", c.pstr, c.astr, got, c.want)
+		}
+		if e := p.Trace(an); e.Allowed != c.want || Clause(e.Annotation).hasAnyOf() {
+			t.Errorf("Trace [%q] on [%q] = %+v", c.pstr, c.astr, e)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package grok
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of the warnings of decisions
+const (
+	// UnknownAttributeWarning is an attribute of the annotation unknown to
+	// the policy, which the evaluation ignored
+	UnknownAttributeWarning = "unknown-attribute"
+	// MissingRecommendedWarning is an attribute that the schema of the policy
+	// recommends and the annotation lacks
+	MissingRecommendedWarning = "missing-recommended"
+	// MonitorMatchedWarning is a policy or exception in monitor mode that
+	// would have changed the effect if it was enforced
+	MonitorMatchedWarning = "monitor-matched"
+	// ExpiredValueWarning is a value of the annotation that expired, and that
+	// EvaluateAt dropped or flipped to its fallback
+	ExpiredValueWarning = "expired-value"
+)
+
+// Warning is a non-fatal issue of an evaluation, e.g. of the quality of the
+// annotation, that callers log without failing the request
+type Warning struct {
+	Kind string
+	// Attribute is the attribute the warning is about, if any
+	Attribute string
+	Message   string
+}
+
+// String returns the message of the warning
+func (w Warning) String() string {
+	return w.Message
+}
+
+// warningsOf returns the warnings of a decision of the policy on an
+// annotation, by kind then attribute
+func (p *Policy) warningsOf(an Annotation, d Decision) []Warning {
+	ws := make([]Warning, 0)
+	for _, name := range p.UnknownAttributesOf(an) {
+		ws = append(ws, Warning{UnknownAttributeWarning, name,
+			fmt.Sprintf("%s is unknown to the policy and was ignored.", name)})
+	}
+	if p.Schema != nil {
+		names := make([]string, 0)
+		for name, r := range p.Schema.Attributes {
+			if r.Recommended && len(Clause(an).ValuesOf(name)) == 0 {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ws = append(ws, Warning{MissingRecommendedWarning, name,
+				fmt.Sprintf("The annotation has no %s, which the schema recommends.", name)})
+		}
+	}
+	if d.Monitored {
+		effect := strings.ToLower(d.WouldBe)
+		ws = append(ws, Warning{Kind: MonitorMatchedWarning,
+			Message: fmt.Sprintf("Monitor mode matched: the policy would %s if it was enforced.", effect)})
+	}
+	return ws
+}
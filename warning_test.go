@@ -0,0 +1,64 @@
+package grok
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecisionWarnings(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP EXCEPT { DENY MODE=monitor DataType IPAddress DataType AccountID }")
+	p.Unknown = IgnoreUnknown
+	schema, err := NewAnnotationSchema(`{ "attributes": { "DataType": { "required": true }, "Purpose": { "recommended": true } } }`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	cases := []struct {
+		astr   string
+		schema *AnnotationSchema
+		want   []Warning
+	}{
+		{"DataType IPAddress", nil, []Warning{}},
+		{"DataType IPAddress Region EU", nil, []Warning{
+			{UnknownAttributeWarning, "Region", "Region is unknown to the policy and was ignored."}}},
+		{"DataType IPAddress", schema, []Warning{
+			{MissingRecommendedWarning, "Purpose", "The annotation has no Purpose, which the schema recommends."}}},
+		{"DataType IPAddress DataType AccountID", nil, []Warning{
+			{Kind: MonitorMatchedWarning, Message: "Monitor mode matched: the policy would deny if it was enforced."}}},
+	}
+	for _, c := range cases {
+		p.Schema = nil
+		an, err := p.ParseAnnotation(c.astr)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		p.Schema = c.schema
+		d := p.Evaluate(an)
+		if !d.Allowed {
+			t.Errorf("Evaluate(%q) should allow despite the warnings", c.astr)
+		}
+		if len(d.Warnings) != len(c.want) {
+			t.Errorf("Evaluate(%q) warnings = %v, want %v", c.astr, d.Warnings, c.want)
+			continue
+		}
+		for i, w := range d.Warnings {
+			if w != c.want[i] {
+				t.Errorf("Evaluate(%q) warning %d = %+v, want %+v", c.astr, i, w, c.want[i])
+			}
+		}
+	}
+}
+
+func TestEvaluateAtWarnings(t *testing.T) {
+	p := newScopedPolicy(t, "ALLOW DataType TOP")
+	an, err := p.ParseAnnotation("DataType Location")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	lapse := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	d := p.EvaluateAt(lapse, an.Until("DataType", "Location", lapse))
+	if len(d.Warnings) != 1 || d.Warnings[0].Kind != ExpiredValueWarning || d.Warnings[0].Attribute != "DataType" ||
+		d.Warnings[0].String() != "DataType Location expired at 2021-06-01T00:00:00Z and was dropped." {
+		t.Errorf("EvaluateAt() warnings = %v", d.Warnings)
+	}
+}
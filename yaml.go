@@ -0,0 +1,434 @@
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NewLatticeFromYAML returns a Lattice instance that is parsed from a YAML
+// definition, which has the structure of the JSON definitions (see
+// NewLattice), and is validated like NewLatticeE does:
+//
+//	name: DataType
+//	edges:
+//	  UniqueID: [AccountID, IPAddress]
+//	  Location:
+//	    - IPAddress
+//	weights: { AccountID: 3 }
+//
+// The parser supports the subset of YAML that definitions need: block and
+// flow mappings and sequences, plain and quoted scalars, and comments, but
+// not anchors, tags, multi-line scalars or several documents.
+func NewLatticeFromYAML(str string) (*Lattice, error) {
+	v, err := parseYAML(str)
+	if err != nil {
+		return nil, &LatticeError{Err: err.Error()}
+	}
+	m, _ := v.(map[string]interface{})
+	return newLatticeOf(m, "")
+}
+
+// NewLatticesFromYAML returns a slice of Lattice instances that are parsed
+// from a YAML sequence of definitions, see NewLatticeFromYAML
+func NewLatticesFromYAML(str string) ([]*Lattice, error) {
+	v, err := parseYAML(str)
+	if err != nil {
+		return nil, &LatticeError{Err: err.Error()}
+	}
+	defs, ok := v.([]interface{})
+	if !ok {
+		return nil, &LatticeError{Err: "the definitions should be a sequence"}
+	}
+	lattices := make([]*Lattice, 0, len(defs))
+	for i, def := range defs {
+		m, _ := def.(map[string]interface{})
+		l, err := newLatticeOf(m, fmt.Sprint(i))
+		if err != nil {
+			return nil, err
+		}
+		lattices = append(lattices, l)
+	}
+	return lattices, nil
+}
+
+// yamlLine is a line of YAML without its indentation and comment
+type yamlLine struct {
+	indent int
+	text   string
+	num    int
+}
+
+// yamlParser parses YAML into the values that encoding/json decodes JSON
+// into: maps, slices, strings, float64, bools and nil
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func parseYAML(str string) (interface{}, error) {
+	p := &yamlParser{}
+	for n, raw := range strings.Split(str, "\n") {
+		text := stripYAMLComment(strings.TrimRight(raw, "\r"))
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" || trimmed == "---" && len(p.lines) == 0 {
+			continue
+		}
+		if trimmed[0] == '\t' {
+			return nil, yamlErrorf(n+1, "tabs can't indent")
+		}
+		p.lines = append(p.lines, yamlLine{len(text) - len(trimmed), strings.TrimRight(trimmed, " \t"), n + 1})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		return nil, yamlErrorf(p.lines[p.i].num, "unexpected indentation")
+	}
+	return v, nil
+}
+
+func yamlErrorf(line int, format string, args ...interface{}) error {
+	return errors.New(fmt.Sprintf("yaml: line %d: %s", line, fmt.Sprintf(format, args...)))
+}
+
+// block parses the node starting at the current line, which is indented by
+// indent
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	l := p.lines[p.i]
+	if isYAMLItem(l.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(l.text); ok {
+		return p.mapping(indent)
+	}
+	p.i++
+	return parseYAMLValue(l.text, l.num)
+}
+
+// sequence parses the items of a block sequence indented by indent
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	seq := make([]interface{}, 0)
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent || l.indent == indent && !isYAMLItem(l.text) {
+			break
+		}
+		if l.indent > indent || !isYAMLItem(l.text) {
+			return nil, yamlErrorf(l.num, "unexpected indentation")
+		}
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" {
+			p.i++
+			var v interface{}
+			if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+				var err error
+				if v, err = p.block(p.lines[p.i].indent); err != nil {
+					return nil, err
+				}
+			}
+			seq = append(seq, v)
+			continue
+		}
+		// the item starts on the line of its dash, e.g. - name: DataType, and
+		// its next lines are indented like its start
+		p.lines[p.i] = yamlLine{l.indent + len(l.text) - len(rest), rest, l.num}
+		v, err := p.block(p.lines[p.i].indent)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+// mapping parses the keys of a block mapping indented by indent
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, yamlErrorf(l.num, "unexpected indentation")
+		}
+		key, rest, ok := splitYAMLKey(l.text)
+		if !ok {
+			return nil, yamlErrorf(l.num, "expected a key")
+		}
+		if _, dup := m[key]; dup {
+			return nil, yamlErrorf(l.num, "duplicate key %s", key)
+		}
+		p.i++
+		if rest != "" {
+			v, err := parseYAMLValue(rest, l.num)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		// the value is on the next lines, which are indented, or are the items
+		// of a sequence at the indentation of the key
+		m[key] = nil
+		if p.i < len(p.lines) {
+			next := p.lines[p.i]
+			if next.indent > indent || next.indent == indent && isYAMLItem(next.text) {
+				v, err := p.block(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			}
+		}
+	}
+	return m, nil
+}
+
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a line of a mapping into its key and the rest of the
+// line, which is empty when the value is on the next lines
+func splitYAMLKey(text string) (string, string, bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	key, end := "", -1
+	if text[0] == '"' || text[0] == '\'' {
+		s := &yamlFlow{s: text}
+		k, err := s.quoted()
+		if err != nil {
+			return "", "", false
+		}
+		key, end = k, s.pos
+		for end < len(text) && text[end] == ' ' {
+			end++
+		}
+		if end >= len(text) || text[end] != ':' {
+			return "", "", false
+		}
+	} else {
+		for i := 0; i < len(text); i++ {
+			if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+				key, end = strings.TrimSpace(text[:i]), i
+				break
+			}
+		}
+		if end < 0 {
+			return "", "", false
+		}
+	}
+	return key, strings.TrimSpace(text[end+1:]), true
+}
+
+// stripYAMLComment removes the comment of a line, which starts with a # at
+// the start of the line or after a space, outside of quoted scalars
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,", line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseYAMLValue parses the value of a line: a flow sequence or mapping, or
+// a scalar
+func parseYAMLValue(text string, line int) (interface{}, error) {
+	s := &yamlFlow{s: text}
+	v, err := s.value(false)
+	if err == nil {
+		s.space()
+		if s.pos < len(s.s) {
+			err = errors.New(fmt.Sprintf("unexpected %q", s.s[s.pos:]))
+		}
+	}
+	if err != nil {
+		return nil, yamlErrorf(line, "%s", err)
+	}
+	return v, nil
+}
+
+// yamlFlow scans a flow value of a line
+type yamlFlow struct {
+	s   string
+	pos int
+}
+
+func (f *yamlFlow) space() {
+	for f.pos < len(f.s) && f.s[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+// value scans a value, in a flow collection when nested
+func (f *yamlFlow) value(nested bool) (interface{}, error) {
+	f.space()
+	if f.pos >= len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.pos] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		return f.quoted()
+	}
+	return yamlScalar(f.plain(nested, false)), nil
+}
+
+func (f *yamlFlow) sequence() (interface{}, error) {
+	f.pos++
+	seq := make([]interface{}, 0)
+	for {
+		f.space()
+		if f.pos >= len(f.s) {
+			return nil, errors.New("unclosed [")
+		}
+		if f.s[f.pos] == ']' {
+			f.pos++
+			return seq, nil
+		}
+		v, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+		if err := f.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (interface{}, error) {
+	f.pos++
+	m := make(map[string]interface{})
+	for {
+		f.space()
+		if f.pos >= len(f.s) {
+			return nil, errors.New("unclosed {")
+		}
+		if f.s[f.pos] == '}' {
+			f.pos++
+			return m, nil
+		}
+		var key string
+		if c := f.s[f.pos]; c == '"' || c == '\'' {
+			k, err := f.quoted()
+			if err != nil {
+				return nil, err
+			}
+			key = k
+		} else {
+			key = f.plain(true, true)
+		}
+		f.space()
+		if f.pos >= len(f.s) || f.s[f.pos] != ':' {
+			return nil, errors.New(fmt.Sprintf("expected : after key %s", key))
+		}
+		f.pos++
+		v, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := m[key]; dup {
+			return nil, errors.New(fmt.Sprintf("duplicate key %s", key))
+		}
+		m[key] = v
+		if err := f.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator scans the comma after an item of a flow collection, which isn't
+// needed before its closing bracket
+func (f *yamlFlow) separator(closing byte) error {
+	f.space()
+	switch {
+	case f.pos < len(f.s) && f.s[f.pos] == ',':
+		f.pos++
+	case f.pos < len(f.s) && f.s[f.pos] == closing:
+	case f.pos >= len(f.s) && closing == ']':
+		return errors.New("unclosed [")
+	case f.pos >= len(f.s):
+		return errors.New("unclosed {")
+	default:
+		return errors.New(fmt.Sprintf("expected , or %c", closing))
+	}
+	return nil
+}
+
+// quoted scans a single- or double-quoted scalar
+func (f *yamlFlow) quoted() (string, error) {
+	quote := f.s[f.pos]
+	for i := f.pos + 1; i < len(f.s); i++ {
+		switch {
+		case quote == '"' && f.s[i] == '\\':
+			i++
+		case f.s[i] == quote && quote == '\'' && i+1 < len(f.s) && f.s[i+1] == '\'':
+			i++
+		case f.s[i] == quote:
+			raw := f.s[f.pos : i+1]
+			f.pos = i + 1
+			if quote == '\'' {
+				return strings.Replace(raw[1:len(raw)-1], "''", "'", -1), nil
+			}
+			return strconv.Unquote(raw)
+		}
+	}
+	return "", errors.New(fmt.Sprintf("unclosed %c", quote))
+}
+
+// plain scans a plain scalar up to the end of the line, or up to the next
+// item or the closing bracket of its flow collection when nested, or up to
+// the colon when it's a key
+func (f *yamlFlow) plain(nested, key bool) string {
+	start := f.pos
+	for ; f.pos < len(f.s); f.pos++ {
+		c := f.s[f.pos]
+		if nested && (c == ',' || c == ']' || c == '}') || key && c == ':' {
+			break
+		}
+	}
+	return strings.TrimSpace(f.s[start:f.pos])
+}
+
+// yamlScalar returns the value of a plain scalar: null, a bool, a number or a
+// string
+func yamlScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if c := s[0]; c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package grok
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewLatticeFromYAML(t *testing.T) {
+	l, err := NewLatticeFromYAML(`
+# the data types
+name: DataType
+edges:
+  UniqueID: [AccountID, IPAddress]   # flow sequence
+  Location:
+    - IPAddress
+  "Birthday": []
+weights: { AccountID: 3, 'IPAddress': 2 }
+labels:
+  de:
+    IPAddress: "IP-Adresse #1"
+`)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	want := NewLattice(`{ "name": "DataType",
+		"edges": { "UniqueID": ["AccountID", "IPAddress"], "Location": ["IPAddress"], "Birthday": [] },
+		"weights": { "AccountID": 3, "IPAddress": 2 },
+		"labels": { "de": { "IPAddress": "IP-Adresse #1" } } }`)
+	if l.Name != want.Name || !reflect.DeepEqual(l.Elements(), want.Elements()) ||
+		!reflect.DeepEqual(l.Weights, want.Weights) || !reflect.DeepEqual(l.Labels, want.Labels) {
+		t.Errorf("NewLatticeFromYAML() = %+v, want %+v", l, want)
+	}
+	if !l.Precede("IPAddress", "Location") || l.Precede("Birthday", "UniqueID") {
+		t.Errorf("NewLatticeFromYAML() has the wrong order")
+	}
+
+	ls, err := NewLatticesFromYAML(`---
+- name: DataType
+  edges:
+    UniqueID:
+    - AccountID
+- name: Purpose
+  edges: { Analytics: [Research], Billing: [] }
+`)
+	if err != nil || len(ls) != 2 || ls[0].Name != "DataType" || !ls[1].Precede("Research", "Analytics") {
+		t.Fatalf("NewLatticesFromYAML() = %v, %v", ls, err)
+	}
+
+	errs := []struct {
+		yaml, err string
+	}{
+		{"name: DataType\nedges: [a, b]", "lattice: DataType: edges: should be an object"},
+		{"name: DataType\nedges:\n  UniqueID: [AccountID\n", "lattice: yaml: line 3: unclosed ["},
+		{"name: DataType\nname: Purpose", "lattice: yaml: line 2: duplicate key name"},
+		{"name: DataType\n  edges: {}", "lattice: yaml: line 2: unexpected indentation"},
+		{"name: DataType\nedges: { TOP: [A] }", "lattice: DataType: edges: TOP is added by the lattice"},
+		{"name: DataType\nedges: {}\ncolor: red", "lattice: DataType: color: unknown key"},
+		{"- a", "lattice: the definition should be an object"},
+	}
+	for _, c := range errs {
+		if _, err := NewLatticeFromYAML(c.yaml); err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("NewLatticeFromYAML(%q) = %v, want %s", c.yaml, err, c.err)
+		}
+	}
+	if _, err := NewLatticesFromYAML("name: DataType"); err == nil || err.Error() != "lattice: the definitions should be a sequence" {
+		t.Errorf("NewLatticesFromYAML() of a mapping = %v", err)
+	}
+	if _, err := NewLatticesFromYAML("- name: DataType\n  edges: {}\n- edges: {}"); err == nil || !strings.HasPrefix(err.Error(), "lattice: 1: name:") {
+		t.Errorf("NewLatticesFromYAML() without name = %v", err)
+	}
+}